@@ -1,26 +1,38 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
 
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
 	"github.com/mosiko1234/heimdal/sensor/internal/logger"
 	"github.com/mosiko1234/heimdal/sensor/internal/orchestrator"
+	"github.com/mosiko1234/heimdal/sensor/internal/replay"
 )
 
 const (
 	defaultConfigPath = "/etc/heimdal/config.json"
-	version           = "2.0.0"
+	version           = config.Version
 )
 
 var (
-	configPath = flag.String("config", defaultConfigPath, "Path to configuration file")
+	configPath  = flag.String("config", defaultConfigPath, "Path to configuration file")
 	showVersion = flag.Bool("version", false, "Show version information")
 	showHelp    = flag.Bool("help", false, "Show help information")
+
+	replayPath   = flag.String("replay", "", "Replay a pcap/pcapng file or directory of rotated captures instead of capturing live")
+	replaySpeed  = flag.Float64("replay-speed", 0, "Replay speed multiplier (1 = original timing, 0 = as fast as possible)")
+	replayFilter = flag.String("replay-filter", "", "BPF filter applied to replayed packets")
+	replayDB     = flag.String("replay-db", "", "Database directory for replayed profiles (default: temporary)")
+	replayRules  = flag.String("replay-rules", "", "Detection rule file (YAML or JSON) applied to replayed profiles")
+	replayOutput = flag.String("replay-output", "", "Write the replay report as JSON to this file (default: stdout)")
 )
 
 func main() {
@@ -48,6 +60,11 @@ func main() {
 		}
 	}()
 
+	// Offline replay does not need the sensor configuration
+	if *replayPath != "" {
+		os.Exit(runReplay())
+	}
+
 	// Load configuration
 	log.Printf("Loading configuration from: %s", *configPath)
 	cfg, err := config.LoadConfig(*configPath)
@@ -83,7 +100,49 @@ func main() {
 	logger.Info("Heimdal Sensor exited cleanly")
 }
 
+// runReplay replays recorded captures through the packet pipeline and prints a report
+func runReplay() int {
+	cfg := replay.DefaultConfig()
+	cfg.Path = *replayPath
+	cfg.Speed = *replaySpeed
+	cfg.Filter = *replayFilter
+	cfg.DatabasePath = *replayDB
+	cfg.RulesFile = *replayRules
+
+	runner, err := replay.NewRunner(cfg)
+	if err != nil {
+		log.Printf("Failed to create replay runner: %v", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	report, err := runner.Run(ctx)
+	if err != nil {
+		log.Printf("Replay failed: %v", err)
+		return 1
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("Failed to serialize replay report: %v", err)
+		return 1
+	}
 
+	if *replayOutput == "" {
+		fmt.Println(string(data))
+		return 0
+	}
+
+	if err := os.WriteFile(*replayOutput, data, 0644); err != nil {
+		log.Printf("Failed to write replay report: %v", err)
+		return 1
+	}
+
+	log.Printf("Replay report written to %s", *replayOutput)
+	return 0
+}
 
 // printHelp displays usage information
 func printHelp() {
@@ -100,4 +159,6 @@ func printHelp() {
 	fmt.Printf("  %s\n", os.Args[0])
 	fmt.Printf("  %s --config /path/to/config.json\n", os.Args[0])
 	fmt.Printf("  %s --version\n", os.Args[0])
+	fmt.Printf("  %s --replay capture.pcapng\n", os.Args[0])
+	fmt.Printf("  %s --replay /var/captures/ --replay-speed 10 --replay-output report.json\n", os.Args[0])
 }
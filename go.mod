@@ -4,8 +4,10 @@ go 1.25.4
 
 require (
 	github.com/dgraph-io/badger/v4 v4.2.0
+	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/google/gopacket v1.1.19
 	github.com/hashicorp/mdns v1.0.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -42,6 +42,7 @@ import (
 	"github.com/google/gopacket/pcap"
 	"golang.org/x/time/rate"
 
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
 	"github.com/mosiko1234/heimdal/sensor/internal/netconfig"
 )
 
@@ -53,6 +54,11 @@ type PacketInfo struct {
 	DstPort   uint16
 	Protocol  string
 	Size      uint32
+
+	// Set by the core packet analyzer; the sniffer leaves them empty
+	DstMAC string
+	DNS    *packet.DNSInfo
+	TLS    *packet.TLSClientHello
 }
 
 // Sniffer captures and analyzes network packets
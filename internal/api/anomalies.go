@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+)
+
+// AnomalyListResponse represents the response for the anomaly list endpoint
+type AnomalyListResponse struct {
+	Anomalies []*detection.StoredAnomaly     `json:"anomalies"`
+	Count     int                            `json:"count"`
+	States    map[detection.AnomalyState]int `json:"states"` // Totals per state, ignoring filters
+}
+
+// AnomalyActionRequest is the optional body of an anomaly triage request
+type AnomalyActionRequest struct {
+	Note string `json:"note"`
+}
+
+// SetAnomalyStore enables the anomaly endpoints
+func (s *APIServer) SetAnomalyStore(store *detection.AnomalyStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.anomalies = store
+}
+
+// getAnomalyStore returns the configured anomaly store or responds with an error
+func (s *APIServer) getAnomalyStore(w http.ResponseWriter) *detection.AnomalyStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.anomalies == nil {
+		respondError(w, http.StatusServiceUnavailable, "anomaly store is not enabled")
+		return nil
+	}
+	return s.anomalies
+}
+
+// handleListAnomalies returns stored anomalies matching the query filters
+func (s *APIServer) handleListAnomalies(w http.ResponseWriter, r *http.Request) {
+	store := s.getAnomalyStore(w)
+	if store == nil {
+		return
+	}
+
+	filter, err := detection.ParseAnomalyFilter(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	anomalies := store.List(filter)
+	respondJSON(w, http.StatusOK, AnomalyListResponse{
+		Anomalies: anomalies,
+		Count:     len(anomalies),
+		States:    store.Counts(),
+	})
+}
+
+// handleGetAnomaly returns a stored anomaly by ID
+func (s *APIServer) handleGetAnomaly(w http.ResponseWriter, r *http.Request) {
+	store := s.getAnomalyStore(w)
+	if store == nil {
+		return
+	}
+
+	anomaly, err := store.Get(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, anomaly)
+}
+
+// handleAnomalyAction moves an anomaly to the state of the requested action
+// (acknowledge, resolve, suppress or reopen)
+func (s *APIServer) handleAnomalyAction(w http.ResponseWriter, r *http.Request) {
+	store := s.getAnomalyStore(w)
+	if store == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	state, ok := detection.StateForAction(vars["action"])
+	if !ok {
+		respondError(w, http.StatusNotFound, "unknown anomaly action: "+vars["action"])
+		return
+	}
+
+	var req AnomalyActionRequest
+	if r.Body != nil && r.ContentLength != 0 && !decodeRequest(w, r, &req) {
+		return
+	}
+
+	anomaly, err := store.SetState(vars["id"], state, req.Note)
+	if errors.Is(err, detection.ErrAnomalyNotFound) {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("API: Failed to %s anomaly %s: %v", vars["action"], vars["id"], err)
+		respondError(w, http.StatusInternalServerError, "failed to update anomaly")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, anomaly)
+}
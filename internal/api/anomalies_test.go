@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+func TestHandleAnomalyActionStatusCodes(t *testing.T) {
+	storage := mocks.NewMockStorageProvider()
+	if err := storage.Open("", nil); err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	store, err := detection.NewAnomalyStore(storage, nil)
+	if err != nil {
+		t.Fatalf("Failed to create anomaly store: %v", err)
+	}
+	stored, _, err := store.Record(&detection.Anomaly{
+		DeviceMAC:   "aa:bb:cc:dd:ee:ff",
+		Type:        detection.AnomalyUnusualPort,
+		Severity:    detection.SeverityMedium,
+		Description: "Unusual port",
+		Timestamp:   time.Now(),
+		Evidence:    map[string]interface{}{"port": 4444},
+	})
+	if err != nil {
+		t.Fatalf("Failed to record anomaly: %v", err)
+	}
+	s := NewAPIServer(nil, "127.0.0.1", 0, 100)
+	s.SetAnomalyStore(store)
+
+	act := func(id, body string) int {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/anomalies/"+id+"/acknowledge", strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": id, "action": "acknowledge"})
+		w := httptest.NewRecorder()
+		s.handleAnomalyAction(w, r)
+		return w.Code
+	}
+
+	if code := act(stored.ID, `{"note": "looking into it"}`); code != http.StatusOK {
+		t.Errorf("Expected 200 for a known anomaly, got %d", code)
+	}
+	if code := act("missing", ""); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown anomaly, got %d", code)
+	}
+	if code := act(stored.ID, `{"note": "`+strings.Repeat("a", maxRequestBody)+`"}`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized body, got %d", code)
+	}
+
+	// Failing to save the new state is not the client's fault
+	storage.SetSetError(&mocks.MockError{Message: "disk full"})
+	if code := act(stored.ID, ""); code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 when the state cannot be saved, got %d", code)
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// handleUpdateDevice applies a metadata patch to a device and returns the updated device
+func (s *APIServer) handleUpdateDevice(w http.ResponseWriter, r *http.Request) {
+	mac := mux.Vars(r)["mac"]
+
+	var patch database.DeviceMetadataPatch
+	if !decodeRequest(w, r, &patch) {
+		return
+	}
+
+	device, err := s.db.UpdateDeviceMetadata(mac, &patch, requestUser(r))
+	switch {
+	case errors.Is(err, database.ErrDeviceNotFound):
+		respondError(w, http.StatusNotFound, "device not found")
+		return
+	case errors.Is(err, database.ErrInvalidMetadata):
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Printf("API: Failed to update device %s: %v", mac, err)
+		respondError(w, http.StatusInternalServerError, "failed to update device")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, device)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+)
+
+// FlowListResponse represents the response for the flow list endpoint
+type FlowListResponse struct {
+	Flows []*flow.Record `json:"flows"`
+	Count int            `json:"count"`
+	Total int            `json:"total"` // Stored flows, ignoring filters
+}
+
+// SetFlowStore enables the flow endpoints
+func (s *APIServer) SetFlowStore(store *flow.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flows = store
+}
+
+// handleListFlows returns completed flows matching the query filters
+func (s *APIServer) handleListFlows(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	store := s.flows
+	s.mu.RUnlock()
+
+	if store == nil {
+		respondError(w, http.StatusServiceUnavailable, "flow tracking is not enabled")
+		return
+	}
+
+	filter, err := flow.ParseFilter(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	flows := store.List(filter)
+	respondJSON(w, http.StatusOK, FlowListResponse{
+		Flows: flows,
+		Count: len(flows),
+		Total: store.Count(),
+	})
+}
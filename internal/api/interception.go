@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/auth"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
+)
+
+// InterceptionTargetRequest is the body of an add interception target request
+type InterceptionTargetRequest struct {
+	MAC string `json:"mac"`
+}
+
+// SetInterception enables the interception control endpoints
+func (s *APIServer) SetInterception(controller *interception.Controller) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interception = controller
+}
+
+// getInterception returns the configured interception controller or responds with an error
+func (s *APIServer) getInterception(w http.ResponseWriter) *interception.Controller {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.interception == nil {
+		respondError(w, http.StatusServiceUnavailable, "traffic interception is not enabled")
+		return nil
+	}
+	return s.interception
+}
+
+// requestUser returns the name of the authenticated user, if any
+func requestUser(r *http.Request) string {
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		return principal.Username
+	}
+	return ""
+}
+
+// handleGetInterception returns the interception targets and their health
+func (s *APIServer) handleGetInterception(w http.ResponseWriter, r *http.Request) {
+	controller := s.getInterception(w)
+	if controller == nil {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, controller.Status())
+}
+
+// handleAddInterceptionTarget starts intercepting a device
+func (s *APIServer) handleAddInterceptionTarget(w http.ResponseWriter, r *http.Request) {
+	controller := s.getInterception(w)
+	if controller == nil {
+		return
+	}
+
+	var req InterceptionTargetRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	target, err := controller.AddTarget(req.MAC, requestUser(r))
+	if err != nil {
+		respondInterceptionError(w, req.MAC, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, target)
+}
+
+// handleRemoveInterceptionTarget stops intercepting a device
+func (s *APIServer) handleRemoveInterceptionTarget(w http.ResponseWriter, r *http.Request) {
+	controller := s.getInterception(w)
+	if controller == nil {
+		return
+	}
+
+	mac := mux.Vars(r)["mac"]
+	if err := controller.RemoveTarget(mac, requestUser(r)); err != nil {
+		respondInterceptionError(w, mac, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, controller.Status())
+}
+
+// handleInterceptionAction pauses or resumes interception of every target
+func (s *APIServer) handleInterceptionAction(w http.ResponseWriter, r *http.Request) {
+	controller := s.getInterception(w)
+	if controller == nil {
+		return
+	}
+
+	var err error
+	switch action := mux.Vars(r)["action"]; action {
+	case "pause":
+		err = controller.Pause(requestUser(r))
+	case "resume":
+		err = controller.Resume(requestUser(r))
+	default:
+		respondError(w, http.StatusNotFound, "unknown interception action: "+action)
+		return
+	}
+	if err != nil {
+		log.Printf("API: Failed to save interception state: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to save interception state")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, controller.Status())
+}
+
+// respondInterceptionError maps an interception controller error to a response
+func respondInterceptionError(w http.ResponseWriter, mac string, err error) {
+	if errors.Is(err, interception.ErrInvalidTarget) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("API: Failed to update interception target %s: %v", mac, err)
+	respondError(w, http.StatusInternalServerError, "failed to update interception target")
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/recorder"
+)
+
+// RecordingListResponse represents the response for the recording list endpoint
+type RecordingListResponse struct {
+	Recordings []*recorder.Status `json:"recordings"`
+	Count      int                `json:"count"`
+}
+
+// StartRecordingRequest is the optional body of a start recording request
+type StartRecordingRequest struct {
+	// DurationSeconds stops the recording automatically (0 = until stopped)
+	DurationSeconds int `json:"duration_seconds"`
+}
+
+// SetRecorder enables the packet recording endpoints
+func (s *APIServer) SetRecorder(rec *recorder.Recorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorder = rec
+}
+
+// getRecorder returns the configured recorder or responds with an error
+func (s *APIServer) getRecorder(w http.ResponseWriter) *recorder.Recorder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.recorder == nil {
+		respondError(w, http.StatusServiceUnavailable, "packet recording is not enabled")
+		return nil
+	}
+	return s.recorder
+}
+
+// handleListRecordings returns the state of all active and stored recordings
+func (s *APIServer) handleListRecordings(w http.ResponseWriter, r *http.Request) {
+	rec := s.getRecorder(w)
+	if rec == nil {
+		return
+	}
+
+	recordings, err := rec.List()
+	if err != nil {
+		log.Printf("API: Failed to list recordings: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to list recordings")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, RecordingListResponse{
+		Recordings: recordings,
+		Count:      len(recordings),
+	})
+}
+
+// handleGetRecording returns the recording state of a device
+func (s *APIServer) handleGetRecording(w http.ResponseWriter, r *http.Request) {
+	rec := s.getRecorder(w)
+	if rec == nil {
+		return
+	}
+
+	status, err := rec.Status(mux.Vars(r)["mac"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
+
+// handleStartRecording starts recording traffic for a device
+func (s *APIServer) handleStartRecording(w http.ResponseWriter, r *http.Request) {
+	rec := s.getRecorder(w)
+	if rec == nil {
+		return
+	}
+
+	var req StartRecordingRequest
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	if req.DurationSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "duration_seconds cannot be negative")
+		return
+	}
+
+	status, err := rec.Start(mux.Vars(r)["mac"], time.Duration(req.DurationSeconds)*time.Second)
+	if err != nil {
+		log.Printf("API: Failed to start recording: %v", err)
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
+
+// handleStopRecording stops recording traffic for a device
+func (s *APIServer) handleStopRecording(w http.ResponseWriter, r *http.Request) {
+	rec := s.getRecorder(w)
+	if rec == nil {
+		return
+	}
+
+	status, err := rec.Stop(mux.Vars(r)["mac"])
+	if err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
+
+// handleDownloadRecording streams a device's recording as a single pcap file
+func (s *APIServer) handleDownloadRecording(w http.ResponseWriter, r *http.Request) {
+	rec := s.getRecorder(w)
+	if rec == nil {
+		return
+	}
+
+	status, err := rec.Status(mux.Vars(r)["mac"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if status.Files == 0 {
+		respondError(w, http.StatusNotFound, "no recording found")
+		return
+	}
+
+	// Recordings can be large; lift the server write timeout for this response
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("API: Failed to extend write deadline for download: %v", err)
+	}
+
+	filename := fmt.Sprintf("heimdal-%s-%s.pcap",
+		strings.ReplaceAll(status.MAC, ":", ""), time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	if err := rec.WritePcap(status.MAC, w); err != nil {
+		log.Printf("API: Failed to stream recording for %s: %v", status.MAC, err)
+	}
+}
@@ -5,11 +5,27 @@
 // gorilla/mux router for HTTP routing and implements per-IP rate limiting for security.
 //
 // API Endpoints:
-//   GET  /api/v1/devices              → List all discovered devices
+//   GET  /api/v1/devices              → List discovered devices, a page at a time with limit or cursor (see database.ParseDeviceFilter)
 //   GET  /api/v1/devices/:mac         → Get device details by MAC address
+//   PATCH /api/v1/devices/:mac        → Edit a device's label, owner, location, tags, notes, trust or type
 //   GET  /api/v1/profiles/:mac        → Get behavioral profile by MAC address
 //   GET  /api/v1/stats                → System statistics (uptime, device counts, etc.)
-//   GET  /api/v1/health               → Health check endpoint
+//   GET  /api/v1/health               → Health check endpoint (includes cloud queue depth, age and dead letters)
+//   GET  /api/v1/recordings           → List per-device packet recordings
+//   GET  /api/v1/recordings/:mac      → Recording state for a device
+//   POST /api/v1/recordings/:mac/start    → Start recording a device
+//   POST /api/v1/recordings/:mac/stop     → Stop recording a device
+//   GET  /api/v1/recordings/:mac/download → Download a device recording as pcap
+//   GET  /api/v1/anomalies            → List anomalies (filters: device, type, severity, state, since, limit)
+//   GET  /api/v1/anomalies/:id        → Get an anomaly by ID
+//   POST /api/v1/anomalies/:id/:action    → acknowledge, resolve, suppress or reopen an anomaly
+//   GET  /api/v1/flows                → List completed flows (filters: device, ip, protocol, port, since, min_bytes, limit)
+//   GET  /api/v1/interception         → Interception targets with their spoofing health, and whether paused
+//   POST /api/v1/interception/targets        → Start intercepting a device ({"mac": ...})
+//   DELETE /api/v1/interception/targets/:mac → Stop intercepting a device
+//   POST /api/v1/interception/pause|resume   → Pause or resume interception of every target
+//   *    /api/v1/auth/...             → Login, logout, users and API tokens (see auth.Manager.Handler)
+//   GET  /api/v1/tls/ca.crt           → Download the sensor's local CA for trusting it in browsers
 //   GET  /                            → Dashboard HTML (static files)
 //
 // Dashboard Features:
@@ -23,8 +39,11 @@
 // Security:
 //   - Rate limiting: configurable requests per minute per IP (default: 100/min)
 //   - Input validation on all endpoints
+//   - HTTPS with HSTS when a certs.Manager is set
 //   - CORS enabled for local network access
-//   - No authentication (local network trust model)
+//   - Authentication when an auth.Manager is set: API tokens (Authorization: Bearer) for
+//     scripts and session cookies for the dashboard; viewers may read, operators may also
+//     change state, admins may also manage users and tokens
 //
 // The server listens on a configurable host and port (default: 0.0.0.0:8080) and
 // implements graceful shutdown via context cancellation.
@@ -33,6 +52,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -40,20 +60,35 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/auth"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/certs"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/recorder"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 	"golang.org/x/time/rate"
 )
 
 // APIServer provides HTTP API and dashboard for Heimdal sensor
 type APIServer struct {
-	db          *database.DatabaseManager
-	router      *mux.Router
-	server      *http.Server
-	port        int
-	host        string
-	rateLimiter *rateLimiterMiddleware
-	startTime   time.Time
-	mu          sync.RWMutex
+	db           *database.DatabaseManager
+	recorder     *recorder.Recorder
+	anomalies    *detection.AnomalyStore
+	flows        *flow.Store
+	interception *interception.Controller
+	cloudQueue   CloudQueueSource
+	auth         *auth.Manager
+	authHandler  http.Handler
+	certs        *certs.Manager
+	router       *mux.Router
+	server       *http.Server
+	port         int
+	host         string
+	rateLimiter  *rateLimiterMiddleware
+	startTime    time.Time
+	mu           sync.RWMutex
 }
 
 // rateLimiterMiddleware implements per-IP rate limiting
@@ -97,17 +132,35 @@ func NewAPIServer(db *database.DatabaseManager, host string, port int, rateLimit
 // setupRoutes configures all API routes and middleware
 func (s *APIServer) setupRoutes() {
 	// Apply middleware
+	s.router.Use(s.hstsMiddleware)
 	s.router.Use(s.corsMiddleware)
 	s.router.Use(s.rateLimiter.middleware)
+	s.router.Use(s.authMiddleware)
 	s.router.Use(s.loggingMiddleware)
 
 	// API routes
 	api := s.router.PathPrefix("/api/v1").Subrouter()
 	api.HandleFunc("/devices", s.handleGetDevices).Methods("GET")
 	api.HandleFunc("/devices/{mac}", s.handleGetDevice).Methods("GET")
+	api.HandleFunc("/devices/{mac}", s.handleUpdateDevice).Methods("PATCH")
 	api.HandleFunc("/profiles/{mac}", s.handleGetProfile).Methods("GET")
 	api.HandleFunc("/stats", s.handleGetStats).Methods("GET")
 	api.HandleFunc("/health", s.handleGetHealth).Methods("GET")
+	api.HandleFunc("/recordings", s.handleListRecordings).Methods("GET")
+	api.HandleFunc("/recordings/{mac}", s.handleGetRecording).Methods("GET")
+	api.HandleFunc("/recordings/{mac}/start", s.handleStartRecording).Methods("POST")
+	api.HandleFunc("/recordings/{mac}/stop", s.handleStopRecording).Methods("POST")
+	api.HandleFunc("/recordings/{mac}/download", s.handleDownloadRecording).Methods("GET")
+	api.HandleFunc("/anomalies", s.handleListAnomalies).Methods("GET")
+	api.HandleFunc("/anomalies/{id}", s.handleGetAnomaly).Methods("GET")
+	api.HandleFunc("/anomalies/{id}/{action}", s.handleAnomalyAction).Methods("POST")
+	api.HandleFunc("/flows", s.handleListFlows).Methods("GET")
+	api.HandleFunc("/interception", s.handleGetInterception).Methods("GET")
+	api.HandleFunc("/interception/targets", s.handleAddInterceptionTarget).Methods("POST")
+	api.HandleFunc("/interception/targets/{mac}", s.handleRemoveInterceptionTarget).Methods("DELETE")
+	api.HandleFunc("/interception/{action}", s.handleInterceptionAction).Methods("POST")
+	api.PathPrefix("/auth/").HandlerFunc(s.handleAuth)
+	api.HandleFunc("/tls/ca.crt", s.handleGetCA).Methods("GET")
 
 	// Static file serving for dashboard
 	s.router.PathPrefix("/").Handler(http.FileServer(http.Dir("web/dashboard")))
@@ -117,8 +170,8 @@ func (s *APIServer) setupRoutes() {
 func (s *APIServer) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -130,6 +183,62 @@ func (s *APIServer) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// hstsMiddleware sends Strict-Transport-Security when serving HTTPS
+func (s *APIServer) hstsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		manager := s.certs
+		s.mu.RUnlock()
+
+		if manager == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		manager.HSTS(next).ServeHTTP(w, r)
+	})
+}
+
+// authMiddleware authenticates requests when an auth manager is set
+func (s *APIServer) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		manager := s.auth
+		s.mu.RUnlock()
+
+		if manager == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		manager.Middleware(next).ServeHTTP(w, r)
+	})
+}
+
+// handleAuth serves the authentication endpoints
+func (s *APIServer) handleAuth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	handler := s.authHandler
+	s.mu.RUnlock()
+
+	if handler == nil {
+		respondError(w, http.StatusNotFound, "authentication is not enabled")
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// handleGetCA serves the local CA certificate
+func (s *APIServer) handleGetCA(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	manager := s.certs
+	s.mu.RUnlock()
+
+	if manager == nil {
+		respondError(w, http.StatusNotFound, "HTTPS is not enabled")
+		return
+	}
+	manager.HandleCA(w, r)
+}
+
 // loggingMiddleware logs all HTTP requests
 func (s *APIServer) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -167,14 +276,27 @@ func (rl *rateLimiterMiddleware) middleware(next http.Handler) http.Handler {
 
 // Start begins serving HTTP requests
 func (s *APIServer) Start(ctx context.Context) error {
-	log.Printf("API: Starting server on %s:%d", s.host, s.port)
+	s.mu.RLock()
+	manager := s.certs
+	s.mu.RUnlock()
 
 	// Start server in goroutine
-	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("API: Server error: %v", err)
-		}
-	}()
+	if manager != nil {
+		log.Printf("API: Starting HTTPS server on %s:%d", s.host, s.port)
+		s.server.TLSConfig = manager.TLSConfig()
+		go func() {
+			if err := s.server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				log.Printf("API: Server error: %v", err)
+			}
+		}()
+	} else {
+		log.Printf("API: Starting server on %s:%d", s.host, s.port)
+		go func() {
+			if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("API: Server error: %v", err)
+			}
+		}()
+	}
 
 	// Wait for context cancellation
 	<-ctx.Done()
@@ -218,10 +340,33 @@ func respondError(w http.ResponseWriter, status int, message string) {
 	})
 }
 
+// maxRequestBody caps the size of JSON request bodies
+const maxRequestBody = 64 << 10
+
+// decodeRequest decodes a JSON request body into v, rejecting oversized bodies
+// and fields v does not have. It responds with an error and returns false on failure.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(w, http.StatusRequestEntityTooLarge, "request body is too large")
+			return false
+		}
+		respondError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
 // DeviceResponse represents the response for device list endpoint
 type DeviceResponse struct {
-	Devices []*database.Device `json:"devices"`
-	Count   int                `json:"count"`
+	Devices    []interface{} `json:"devices"` // Devices, or the selected fields of each
+	Count      int           `json:"count"`
+	Total      int           `json:"total"`                 // Devices matching the filters across all pages
+	NextCursor string        `json:"next_cursor,omitempty"` // Pass as cursor to get the next page
 }
 
 // StatsResponse represents system statistics
@@ -235,24 +380,80 @@ type StatsResponse struct {
 
 // HealthResponse represents health check status
 type HealthResponse struct {
-	Status     string    `json:"status"`
-	Uptime     string    `json:"uptime"`
-	Database   string    `json:"database"`
-	Timestamp  time.Time `json:"timestamp"`
+	Status     string                `json:"status"`
+	Uptime     string                `json:"uptime"`
+	Database   string                `json:"database"`
+	CloudQueue *corecloud.QueueStats `json:"cloud_queue,omitempty"` // Present when a cloud connector is active
+	Timestamp  time.Time             `json:"timestamp"`
+}
+
+// CloudQueueSource reports the state of the cloud transmission queue
+type CloudQueueSource interface {
+	QueueStats() (corecloud.QueueStats, bool)
+}
+
+// SetAuth requires authentication for the API endpoints; dashboard files stay
+// public so the login page can load.
+func (s *APIServer) SetAuth(manager *auth.Manager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = manager
+	s.authHandler = manager.Handler()
+}
+
+// SetTLS serves HTTPS with certificates from manager. It must be called
+// before Start.
+func (s *APIServer) SetTLS(manager *certs.Manager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certs = manager
+}
+
+// SetCloudQueue adds cloud transmission queue statistics to the health endpoint
+func (s *APIServer) SetCloudQueue(source CloudQueueSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cloudQueue = source
 }
 
-// handleGetDevices returns a list of all discovered devices
+// handleGetDevices returns the discovered devices matching the query filters,
+// a page at a time when a limit or cursor is given
 func (s *APIServer) handleGetDevices(w http.ResponseWriter, r *http.Request) {
-	devices, err := s.db.GetAllDevices()
+	query := r.URL.Query()
+	filter, err := database.ParseDeviceFilter(query)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Clients that do not page, like those written before paging, get every device
+	var page *database.DevicePage
+	if query.Has("limit") || query.Has("cursor") {
+		page, err = s.db.QueryDevices(filter)
+	} else {
+		page, err = s.db.QueryAllDevices(filter)
+	}
 	if err != nil {
 		log.Printf("API: Failed to get devices: %v", err)
 		respondError(w, http.StatusInternalServerError, "failed to retrieve devices")
 		return
 	}
 
+	devices := make([]interface{}, 0, len(page.Devices))
+	for _, device := range page.Devices {
+		selected, err := filter.SelectFields(device)
+		if err != nil {
+			log.Printf("API: Failed to encode device %s: %v", device.MAC, err)
+			continue
+		}
+		devices = append(devices, selected)
+	}
+
 	response := DeviceResponse{
-		Devices: devices,
-		Count:   len(devices),
+		Devices:    devices,
+		Count:      len(devices),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
 	}
 
 	respondJSON(w, http.StatusOK, response)
@@ -369,5 +570,14 @@ func (s *APIServer) handleGetHealth(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now(),
 	}
 
+	s.mu.RLock()
+	cloudQueue := s.cloudQueue
+	s.mu.RUnlock()
+	if cloudQueue != nil {
+		if stats, ok := cloudQueue.QueueStats(); ok {
+			response.CloudQueue = &stats
+		}
+	}
+
 	respondJSON(w, http.StatusOK, response)
 }
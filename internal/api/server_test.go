@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+func TestHandleGetDevicesListsEveryDeviceWithoutPaging(t *testing.T) {
+	db, err := database.NewDatabaseManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// More than the default page size and the largest page
+	const count = database.MaxDeviceLimit + 50
+	now := time.Now()
+	devices := make([]*database.Device, 0, count)
+	for i := 0; i < count; i++ {
+		devices = append(devices, &database.Device{
+			MAC:       fmt.Sprintf("aa:00:00:00:%02x:%02x", i/256, i%256),
+			IP:        fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+			FirstSeen: now,
+			LastSeen:  now.Add(-time.Duration(i) * time.Second),
+		})
+	}
+	if err := db.SaveDeviceBatch(devices); err != nil {
+		t.Fatalf("Failed to save devices: %v", err)
+	}
+	s := NewAPIServer(db, "127.0.0.1", 0, 100)
+
+	list := func(query string) DeviceResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.handleGetDevices(w, httptest.NewRequest(http.MethodGet, "/api/v1/devices"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %q, got %d: %s", query, w.Code, w.Body.String())
+		}
+		var response DeviceResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	response := list("")
+	if response.Count != count || len(response.Devices) != count {
+		t.Errorf("Expected all %d devices, got %d", count, len(response.Devices))
+	}
+	if response.NextCursor != "" {
+		t.Error("Expected no cursor when every device is returned")
+	}
+
+	response = list("?limit=100")
+	if response.Count != 100 || response.NextCursor == "" {
+		t.Errorf("Expected a page of 100 devices with a cursor, got %d", response.Count)
+	}
+	if response.Total != count {
+		t.Errorf("Expected a total of %d, got %d", count, response.Total)
+	}
+}
@@ -1,24 +1,29 @@
 package aws
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/mosiko1234/heimdal/sensor/internal/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 )
 
-// AWSIoTConnector implements CloudConnector for AWS IoT Core
+// maxBatchBytes keeps batch messages below the 128KB AWS IoT Core message limit
+const maxBatchBytes = 96 * 1024
+
+// AWSIoTConnector implements CloudConnector for AWS IoT Core. Devices and
+// profiles are wrapped in schemas.CloudMessage envelopes and published over
+// MQTT with mutual TLS to heimdal/sensor/<client ID>/<message type>.
 type AWSIoTConnector struct {
 	*cloud.BaseConnector
-	endpoint string
-	clientID string
-	certPath string
-	keyPath  string
-	// MQTT client would be initialized here in full implementation
-	// client mqtt.Client
+	endpoint  string
+	clientID  string
+	transport *corecloud.MQTTTransport
 }
 
 // NewAWSIoTConnector creates a new AWS IoT Core connector
@@ -47,63 +52,37 @@ func NewAWSIoTConnector(cfg *config.AWSConfig, db *database.DatabaseManager) (*A
 		BaseConnector: cloud.NewBaseConnector(db, 5*time.Minute),
 		endpoint:      cfg.Endpoint,
 		clientID:      cfg.ClientID,
-		certPath:      cfg.CertPath,
-		keyPath:       cfg.KeyPath,
 	}
 
+	mqttCfg := corecloud.DefaultMQTTConfig()
+	mqttCfg.Endpoint = cfg.Endpoint
+	mqttCfg.ClientID = cfg.ClientID
+	mqttCfg.CertPath = cfg.CertPath
+	mqttCfg.KeyPath = cfg.KeyPath
+	mqttCfg.CAPath = cfg.CAPath
+	mqttCfg.OnConnectionChange = connector.SetConnected
+
+	transport, err := corecloud.NewMQTTTransport(mqttCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MQTT transport: %w", err)
+	}
+	connector.transport = transport
+
 	return connector, nil
 }
 
-// Connect establishes connection to AWS IoT Core
-// This is a stub implementation showing the connection logic
+// Connect establishes connection to AWS IoT Core. If the endpoint cannot be
+// reached yet, the connection keeps being retried in the background and
+// transmission starts once it succeeds.
 func (a *AWSIoTConnector) Connect() error {
-	log.Printf("[AWS IoT] Connecting to AWS IoT Core...")
-	log.Printf("[AWS IoT] Endpoint: %s", a.endpoint)
-	log.Printf("[AWS IoT] Client ID: %s", a.clientID)
-	log.Printf("[AWS IoT] Certificate: %s", a.certPath)
-	log.Printf("[AWS IoT] Key: %s", a.keyPath)
-
-	// STUB: In a full implementation, this would:
-	// 1. Load TLS certificates from certPath and keyPath
-	// 2. Create MQTT client options with:
-	//    - Broker URL: ssl://<endpoint>:8883
-	//    - Client ID
-	//    - TLS configuration with certificates
-	//    - Keep-alive interval
-	//    - Clean session flag
-	// 3. Create MQTT client instance
-	// 4. Connect to AWS IoT Core
-	// 5. Subscribe to relevant topics for bidirectional communication
-	//
-	// Example pseudo-code:
-	// tlsConfig, err := loadTLSConfig(a.certPath, a.keyPath)
-	// if err != nil {
-	//     return fmt.Errorf("failed to load TLS config: %w", err)
-	// }
-	//
-	// opts := mqtt.NewClientOptions()
-	// opts.AddBroker(fmt.Sprintf("ssl://%s:8883", a.endpoint))
-	// opts.SetClientID(a.clientID)
-	// opts.SetTLSConfig(tlsConfig)
-	// opts.SetKeepAlive(60 * time.Second)
-	// opts.SetCleanSession(true)
-	// opts.SetAutoReconnect(true)
-	// opts.SetOnConnectHandler(func(client mqtt.Client) {
-	//     log.Println("[AWS IoT] Connected successfully")
-	// })
-	// opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
-	//     log.Printf("[AWS IoT] Connection lost: %v", err)
-	// })
-	//
-	// a.client = mqtt.NewClient(opts)
-	// token := a.client.Connect()
-	// if token.Wait() && token.Error() != nil {
-	//     return fmt.Errorf("failed to connect: %w", token.Error())
-	// }
-
-	// For stub purposes, simulate successful connection
-	log.Println("[AWS IoT] STUB: Simulating successful connection")
-	a.SetConnected(true)
+	log.Printf("[AWS IoT] Connecting to %s as %s...", a.endpoint, a.clientID)
+
+	if err := a.transport.Connect(); err != nil {
+		if !errors.Is(err, corecloud.ErrMQTTConnectPending) {
+			return err
+		}
+		log.Printf("[AWS IoT] %v", err)
+	}
 
 	// Start transmission loop
 	a.StartTransmissionLoop(a)
@@ -118,18 +97,8 @@ func (a *AWSIoTConnector) Disconnect() error {
 	// Stop transmission loop
 	a.StopTransmissionLoop()
 
-	// STUB: In a full implementation, this would:
-	// 1. Unsubscribe from topics
-	// 2. Disconnect MQTT client gracefully
-	// 3. Clean up resources
-	//
-	// Example pseudo-code:
-	// if a.client != nil && a.client.IsConnected() {
-	//     a.client.Disconnect(250) // Wait up to 250ms for graceful disconnect
-	// }
-
-	a.SetConnected(false)
-	log.Println("[AWS IoT] STUB: Disconnected")
+	a.transport.Disconnect()
+	log.Println("[AWS IoT] Disconnected")
 
 	return nil
 }
@@ -144,29 +113,16 @@ func (a *AWSIoTConnector) SendProfile(profile *database.BehavioralProfile) error
 		return fmt.Errorf("not connected to AWS IoT Core")
 	}
 
-	// Serialize profile to JSON
-	data, err := cloud.SerializeProfile(profile)
+	msg, err := schemas.WrapMessage(schemas.MessageTypeProfile, a.clientID, a.Anonymizer().AnonymizeProfile(schemas.ProfileToMessage(profile)))
 	if err != nil {
 		return fmt.Errorf("failed to serialize profile: %w", err)
 	}
 
-	log.Printf("[AWS IoT] Sending profile for MAC: %s", profile.MAC)
-	log.Printf("[AWS IoT] Profile data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, this would:
-	// 1. Construct MQTT topic (e.g., "heimdal/sensor/{clientID}/profile")
-	// 2. Publish JSON payload to the topic
-	// 3. Wait for publish acknowledgment
-	// 4. Handle QoS levels (recommend QoS 1 for at-least-once delivery)
-	//
-	// Example pseudo-code:
-	// topic := fmt.Sprintf("heimdal/sensor/%s/profile", a.clientID)
-	// token := a.client.Publish(topic, 1, false, data)
-	// if token.Wait() && token.Error() != nil {
-	//     return fmt.Errorf("failed to publish profile: %w", token.Error())
-	// }
+	if err := a.transport.Publish(msg); err != nil {
+		return fmt.Errorf("failed to publish profile: %w", err)
+	}
 
-	log.Printf("[AWS IoT] STUB: Successfully sent profile for MAC: %s", profile.MAC)
+	log.Printf("[AWS IoT] Sent profile for MAC: %s", profile.MAC)
 	return nil
 }
 
@@ -180,29 +136,61 @@ func (a *AWSIoTConnector) SendDevice(device *database.Device) error {
 		return fmt.Errorf("not connected to AWS IoT Core")
 	}
 
-	// Serialize device to JSON
-	data, err := cloud.SerializeDevice(device)
+	msg, err := schemas.WrapMessage(schemas.MessageTypeDevice, a.clientID, a.Anonymizer().AnonymizeDevice(schemas.DeviceToMessage(device, a.clientID, "", "")))
 	if err != nil {
 		return fmt.Errorf("failed to serialize device: %w", err)
 	}
 
-	log.Printf("[AWS IoT] Sending device: %s (%s)", device.MAC, device.IP)
-	log.Printf("[AWS IoT] Device data size: %d bytes", len(data))
+	if err := a.transport.Publish(msg); err != nil {
+		return fmt.Errorf("failed to publish device: %w", err)
+	}
+
+	log.Printf("[AWS IoT] Sent device: %s (%s)", device.MAC, device.IP)
+	return nil
+}
+
+// SendMessage publishes any schema message, such as a heartbeat, to the
+// message type's topic without queueing it
+func (a *AWSIoTConnector) SendMessage(messageType schemas.MessageType, payload interface{}) error {
+	if !a.IsConnected() {
+		return fmt.Errorf("not connected to AWS IoT Core")
+	}
+
+	msg, err := schemas.WrapMessage(messageType, a.clientID, payload)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", messageType, err)
+	}
+
+	if err := a.transport.Publish(msg); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", messageType, err)
+	}
+	return nil
+}
+
+// SendBatch publishes devices and profiles as compressed batch messages
+func (a *AWSIoTConnector) SendBatch(sync schemas.SyncKind, devices []*database.Device, profiles []*database.BehavioralProfile) error {
+	batches, err := a.PackBatches(sync, a.clientID, devices, profiles, maxBatchBytes)
+	if err != nil {
+		return fmt.Errorf("failed to pack batch: %w", err)
+	}
+	for _, batch := range batches {
+		if err := a.SendMessage(schemas.MessageTypeBatch, batch); err != nil {
+			return err
+		}
+	}
 
-	// STUB: In a full implementation, this would:
-	// 1. Construct MQTT topic (e.g., "heimdal/sensor/{clientID}/device")
-	// 2. Publish JSON payload to the topic
-	// 3. Wait for publish acknowledgment
-	// 4. Handle QoS levels (recommend QoS 1 for at-least-once delivery)
-	//
-	// Example pseudo-code:
-	// topic := fmt.Sprintf("heimdal/sensor/%s/device", a.clientID)
-	// token := a.client.Publish(topic, 1, false, data)
-	// if token.Wait() && token.Error() != nil {
-	//     return fmt.Errorf("failed to publish device: %w", token.Error())
-	// }
+	log.Printf("[AWS IoT] Sent %d devices and %d profiles in %d batches", len(devices), len(profiles), len(batches))
+	return nil
+}
 
-	log.Printf("[AWS IoT] STUB: Successfully sent device: %s", device.MAC)
+// SubscribeCommands receives commands published to this sensor's command
+// topic and to the fleet-wide command topic
+func (a *AWSIoTConnector) SubscribeCommands(handler func(data []byte)) error {
+	for _, topic := range []string{corecloud.CommandTopic(a.clientID), corecloud.FleetCommandTopic} {
+		if err := a.transport.Subscribe(topic, handler); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
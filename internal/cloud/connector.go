@@ -8,8 +8,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
 )
 
 // CloudConnector defines the interface for cloud platform connectivity
@@ -30,8 +33,29 @@ type CloudConnector interface {
 	IsConnected() bool
 }
 
+// MessageSender is implemented by connectors that can publish any schema
+// message directly, outside the transmission queue. Heartbeats and telemetry
+// use it: a stale one is worthless, so they are dropped rather than queued.
+type MessageSender interface {
+	SendMessage(messageType schemas.MessageType, payload interface{}) error
+}
+
+// CommandSubscriber is implemented by connectors that can receive commands
+// from the cloud. The handler is called with each command's raw JSON; call
+// before Connect so no command is missed.
+type CommandSubscriber interface {
+	SubscribeCommands(handler func(data []byte)) error
+}
+
+// BatchSender is implemented by connectors that can pack many devices and
+// profiles into compressed batch messages instead of one message per record
+type BatchSender interface {
+	SendBatch(sync schemas.SyncKind, devices []*database.Device, profiles []*database.BehavioralProfile) error
+}
+
 // TransmissionItem represents an item in the transmission queue
 type TransmissionItem struct {
+	ID        uint64      // Queue item ID
 	Type      string      // "profile" or "device"
 	Data      interface{} // *BehavioralProfile or *Device
 	Timestamp time.Time
@@ -40,22 +64,23 @@ type TransmissionItem struct {
 
 // BaseConnector provides common functionality for cloud connectors
 type BaseConnector struct {
-	connected      bool
-	mu             sync.RWMutex
-	queue          []*TransmissionItem
-	queueMu        sync.Mutex
-	maxQueueSize   int
-	maxRetries     int
-	retryDelay     time.Duration
-	ctx            context.Context
-	cancel         context.CancelFunc
-	wg             sync.WaitGroup
-	db             *database.DatabaseManager
-	transmitTicker *time.Ticker
+	connected        bool
+	mu               sync.RWMutex
+	queue            *corecloud.Queue
+	queueMu          sync.RWMutex // Guards replacing the queue
+	anonymizer       *schemas.Anonymizer
+	maxRetries       int
+	retryDelay       time.Duration
+	ctx              context.Context
+	cancel           context.CancelFunc
+	wg               sync.WaitGroup
+	db               *database.DatabaseManager
+	transmitTicker   *time.Ticker
 	transmitInterval time.Duration
 }
 
-// NewBaseConnector creates a new base connector with common functionality
+// NewBaseConnector creates a new base connector with common functionality.
+// The transmission queue is kept in memory until SetQueueStorage is called.
 func NewBaseConnector(db *database.DatabaseManager, transmitInterval time.Duration) *BaseConnector {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -63,10 +88,11 @@ func NewBaseConnector(db *database.DatabaseManager, transmitInterval time.Durati
 		transmitInterval = 5 * time.Minute // Default to 5 minutes
 	}
 
+	queue, _ := corecloud.NewQueue(nil, &corecloud.QueueConfig{MaxItems: 100, MaxDeadLetters: 100})
+
 	return &BaseConnector{
 		connected:        false,
-		queue:            make([]*TransmissionItem, 0),
-		maxQueueSize:     100,
+		queue:            queue,
 		maxRetries:       3,
 		retryDelay:       time.Second,
 		ctx:              ctx,
@@ -76,6 +102,70 @@ func NewBaseConnector(db *database.DatabaseManager, transmitInterval time.Durati
 	}
 }
 
+// SetQueueStorage makes the transmission queue durable so queued items and
+// dead letters survive restarts. Items already queued in memory are carried
+// over. Call before Connect.
+func (bc *BaseConnector) SetQueueStorage(storage platform.StorageProvider, cfg *corecloud.QueueConfig) error {
+	if storage == nil {
+		return fmt.Errorf("storage provider is required")
+	}
+	queue, err := corecloud.NewQueue(storage, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open transmission queue: %w", err)
+	}
+
+	bc.queueMu.Lock()
+	defer bc.queueMu.Unlock()
+
+	for item := bc.queue.Peek(); item != nil; item = bc.queue.Peek() {
+		if err := queue.Push(item.Type, item.DeviceType, item.Payload); err != nil {
+			log.Printf("[CloudConnector] Failed to carry over queued %s: %v", item.Type, err)
+		}
+		bc.queue.Remove(item.ID)
+	}
+	bc.queue = queue
+	return nil
+}
+
+// SetAnonymizer makes the connector pseudonymize identifying fields before
+// upload. A nil anonymizer sends data as-is.
+func (bc *BaseConnector) SetAnonymizer(anonymizer *schemas.Anonymizer) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.anonymizer = anonymizer
+}
+
+// Anonymizer returns the connector's anonymizer, or nil when uploads are not
+// anonymized
+func (bc *BaseConnector) Anonymizer() *schemas.Anonymizer {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.anonymizer
+}
+
+// PackBatches converts devices and profiles into records, anonymized when
+// the connector anonymizes uploads, and compresses them into batches whose
+// data stays within maxBytes
+func (bc *BaseConnector) PackBatches(sync schemas.SyncKind, sensorID string, devices []*database.Device, profiles []*database.BehavioralProfile, maxBytes int) ([]*schemas.BatchMessage, error) {
+	anonymizer := bc.Anonymizer()
+	records := make([]schemas.BatchRecord, 0, len(devices)+len(profiles))
+	for _, device := range devices {
+		record, err := schemas.NewBatchRecord(schemas.MessageTypeDevice, anonymizer.AnonymizeDevice(schemas.DeviceToMessage(device, sensorID, "", "")))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	for _, profile := range profiles {
+		record, err := schemas.NewBatchRecord(schemas.MessageTypeProfile, anonymizer.AnonymizeProfile(schemas.ProfileToMessage(profile)))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return schemas.PackBatches(sync, records, maxBytes)
+}
+
 // SetConnected updates the connection status
 func (bc *BaseConnector) SetConnected(connected bool) {
 	bc.mu.Lock()
@@ -100,66 +190,80 @@ func (bc *BaseConnector) EnqueueDevice(device *database.Device) error {
 	return bc.enqueue("device", device)
 }
 
-// enqueue adds an item to the transmission queue
+// enqueue adds an item to the transmission queue; when the queue is full
+// the oldest item is evicted
 func (bc *BaseConnector) enqueue(itemType string, data interface{}) error {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
-
-	// Check if queue is full
-	if len(bc.queue) >= bc.maxQueueSize {
-		// Remove oldest item to make room
-		log.Printf("[CloudConnector] Queue full, dropping oldest item")
-		bc.queue = bc.queue[1:]
-	}
-
-	item := &TransmissionItem{
-		Type:      itemType,
-		Data:      data,
-		Timestamp: time.Now(),
-		Retries:   0,
-	}
+	return bc.currentQueue().Push(itemType, "", data)
+}
 
-	bc.queue = append(bc.queue, item)
-	return nil
+// currentQueue returns the transmission queue
+func (bc *BaseConnector) currentQueue() *corecloud.Queue {
+	bc.queueMu.RLock()
+	defer bc.queueMu.RUnlock()
+	return bc.queue
 }
 
-// DequeueNext returns the next item from the queue without removing it
+// DequeueNext returns the next item from the queue without removing it.
+// Items that can no longer be decoded are moved to the dead-letter area.
 func (bc *BaseConnector) DequeueNext() *TransmissionItem {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
+	queue := bc.currentQueue()
+	for {
+		item := queue.Peek()
+		if item == nil {
+			return nil
+		}
 
-	if len(bc.queue) == 0 {
-		return nil
-	}
+		var data interface{}
+		switch item.Type {
+		case "profile":
+			data = &database.BehavioralProfile{}
+		case "device":
+			data = &database.Device{}
+		default:
+			log.Printf("[CloudConnector] Unknown item type: %s", item.Type)
+			queue.DeadLetter(item.ID, "unknown item type")
+			continue
+		}
+		if err := json.Unmarshal(item.Payload, data); err != nil {
+			log.Printf("[CloudConnector] Invalid %s data: %v", item.Type, err)
+			queue.DeadLetter(item.ID, fmt.Sprintf("invalid payload: %v", err))
+			continue
+		}
 
-	return bc.queue[0]
+		return &TransmissionItem{
+			ID:        item.ID,
+			Type:      item.Type,
+			Data:      data,
+			Timestamp: item.Enqueued,
+			Retries:   item.Retries,
+		}
+	}
 }
 
 // RemoveFromQueue removes the first item from the queue
 func (bc *BaseConnector) RemoveFromQueue() {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
-
-	if len(bc.queue) > 0 {
-		bc.queue = bc.queue[1:]
+	queue := bc.currentQueue()
+	if item := queue.Peek(); item != nil {
+		queue.Remove(item.ID)
 	}
 }
 
 // IncrementRetries increments the retry count for the first item in the queue
 func (bc *BaseConnector) IncrementRetries() {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
-
-	if len(bc.queue) > 0 {
-		bc.queue[0].Retries++
+	queue := bc.currentQueue()
+	if item := queue.Peek(); item != nil {
+		queue.MarkFailed(item.ID, nil)
 	}
 }
 
 // GetQueueSize returns the current queue size
 func (bc *BaseConnector) GetQueueSize() int {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
-	return len(bc.queue)
+	return bc.currentQueue().Len()
+}
+
+// QueueStats returns the depth, age and dead-letter count of the transmission queue
+func (bc *BaseConnector) QueueStats() corecloud.QueueStats {
+	return bc.currentQueue().Stats()
 }
 
 // StartTransmissionLoop starts the periodic transmission goroutine
@@ -230,21 +334,29 @@ func (bc *BaseConnector) processQueue(connector CloudConnector) {
 
 		if err != nil {
 			log.Printf("[CloudConnector] Failed to transmit %s: %v", item.Type, err)
-			bc.IncrementRetries()
+
+			// Keep items queued, without using up their retries, while the
+			// connection is down
+			if !connector.IsConnected() {
+				log.Printf("[CloudConnector] Connection lost, %d items remain queued", bc.GetQueueSize())
+				return
+			}
+
+			retries := bc.currentQueue().MarkFailed(item.ID, err)
 
 			// Check if max retries exceeded
-			if item.Retries >= bc.maxRetries {
-				log.Printf("[CloudConnector] Max retries exceeded for %s, dropping item", item.Type)
-				bc.RemoveFromQueue()
+			if retries >= bc.maxRetries {
+				log.Printf("[CloudConnector] Max retries exceeded for %s, moving to dead letters", item.Type)
+				bc.currentQueue().DeadLetter(item.ID, "")
 			} else {
 				// Exponential backoff
-				backoff := bc.retryDelay * time.Duration(1<<uint(item.Retries))
-				log.Printf("[CloudConnector] Will retry in %v (attempt %d/%d)", backoff, item.Retries+1, bc.maxRetries)
+				backoff := bc.retryDelay * time.Duration(1<<uint(retries))
+				log.Printf("[CloudConnector] Will retry in %v (attempt %d/%d)", backoff, retries+1, bc.maxRetries)
 				time.Sleep(backoff)
 			}
 		} else {
 			log.Printf("[CloudConnector] Successfully transmitted %s", item.Type)
-			bc.RemoveFromQueue()
+			bc.currentQueue().Remove(item.ID)
 		}
 	}
 }
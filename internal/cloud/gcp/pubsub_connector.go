@@ -1,23 +1,37 @@
 package gcp
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/mosiko1234/heimdal/sensor/internal/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 )
 
-// GoogleCloudConnector implements CloudConnector for Google Cloud Pub/Sub
+// maxBatchBytes bounds batch messages; Pub/Sub accepts up to 10MB, but
+// smaller messages are retried more cheaply on flaky links
+const maxBatchBytes = 512 * 1024
+
+// GoogleCloudConnector implements CloudConnector for Google Cloud Pub/Sub.
+// Devices and profiles are wrapped in schemas.CloudMessage envelopes and
+// published over the Pub/Sub REST API, ordered per sensor.
 type GoogleCloudConnector struct {
 	*cloud.BaseConnector
 	projectID string
 	topicID   string
-	// Pub/Sub client would be initialized here in full implementation
-	// client *pubsub.Client
-	// topic  *pubsub.Topic
+	sensorID  string
+	pubsubCfg *corecloud.PubSubConfig
+	publisher *corecloud.PubSubPublisher
+
+	commandSubscription string
+	commandHandler      func([]byte)
+	subscriber          *corecloud.PubSubSubscriber
 }
 
 // NewGoogleCloudConnector creates a new Google Cloud Pub/Sub connector
@@ -34,68 +48,68 @@ func NewGoogleCloudConnector(cfg *config.GCPConfig, db *database.DatabaseManager
 		return nil, fmt.Errorf("GCP topic ID is required")
 	}
 
+	sensorID := cfg.SensorID
+	if sensorID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("GCP sensor ID is required when the hostname is unavailable: %w", err)
+		}
+		sensorID = hostname
+	}
+
+	pubsubCfg := corecloud.DefaultPubSubConfig()
+	pubsubCfg.ProjectID = cfg.ProjectID
+	pubsubCfg.TopicID = cfg.TopicID
+	pubsubCfg.CredentialsPath = cfg.CredentialsPath
+	pubsubCfg.EmulatorHost = cfg.EmulatorHost
+	if cfg.Endpoint != "" {
+		pubsubCfg.Endpoint = cfg.Endpoint
+	}
+	pubsubCfg.OrderingKey = sensorID
+
 	connector := &GoogleCloudConnector{
 		BaseConnector: cloud.NewBaseConnector(db, 5*time.Minute),
 		projectID:     cfg.ProjectID,
 		topicID:       cfg.TopicID,
+		sensorID:      sensorID,
+		pubsubCfg:     pubsubCfg,
+
+		commandSubscription: cfg.CommandSubscription,
 	}
 
 	return connector, nil
 }
 
 // Connect establishes connection to Google Cloud Pub/Sub
-// This is a stub implementation showing the connection logic
 func (g *GoogleCloudConnector) Connect() error {
-	log.Printf("[Google Cloud] Connecting to Google Cloud Pub/Sub...")
-	log.Printf("[Google Cloud] Project ID: %s", g.projectID)
-	log.Printf("[Google Cloud] Topic ID: %s", g.topicID)
-
-	// STUB: In a full implementation, this would:
-	// 1. Create context with timeout
-	// 2. Initialize Pub/Sub client with project ID
-	// 3. Get or create the topic
-	// 4. Configure topic settings (batching, compression, etc.)
-	// 5. Verify topic exists and is accessible
-	//
-	// Example pseudo-code:
-	// ctx := context.Background()
-	//
-	// // Create Pub/Sub client
-	// client, err := pubsub.NewClient(ctx, g.projectID)
-	// if err != nil {
-	//     return fmt.Errorf("failed to create Pub/Sub client: %w", err)
-	// }
-	// g.client = client
-	//
-	// // Get topic reference
-	// topic := client.Topic(g.topicID)
-	// exists, err := topic.Exists(ctx)
-	// if err != nil {
-	//     return fmt.Errorf("failed to check topic existence: %w", err)
-	// }
-	//
-	// if !exists {
-	//     // Create topic if it doesn't exist
-	//     topic, err = client.CreateTopic(ctx, g.topicID)
-	//     if err != nil {
-	//         return fmt.Errorf("failed to create topic: %w", err)
-	//     }
-	//     log.Printf("[Google Cloud] Created topic: %s", g.topicID)
-	// }
-	//
-	// // Configure topic settings for optimal performance
-	// topic.PublishSettings = pubsub.PublishSettings{
-	//     ByteThreshold:  5000,        // Batch messages up to 5KB
-	//     CountThreshold: 100,         // Or 100 messages
-	//     DelayThreshold: 100 * time.Millisecond,
-	//     Timeout:        60 * time.Second,
-	// }
-	//
-	// g.topic = topic
-
-	// For stub purposes, simulate successful connection
-	log.Println("[Google Cloud] STUB: Simulating successful connection")
+	log.Printf("[Google Cloud] Connecting to Pub/Sub topic %s in project %s...", g.topicID, g.projectID)
+
+	publisher, err := corecloud.NewPubSubPublisher(g.pubsubCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create Pub/Sub publisher: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.pubsubCfg.RequestTimeout)
+	defer cancel()
+	if err := publisher.CheckTopic(ctx); err != nil {
+		publisher.Stop()
+		return fmt.Errorf("failed to connect to Pub/Sub: %w", err)
+	}
+
+	g.publisher = publisher
 	g.SetConnected(true)
+	log.Println("[Google Cloud] Connected")
+
+	if g.commandHandler != nil {
+		subscriber, err := corecloud.NewPubSubSubscriber(g.subscriberConfig(), g.commandHandler)
+		if err != nil {
+			// Publishing works without commands, so keep the connection
+			log.Printf("[Google Cloud] Failed to subscribe to commands: %v", err)
+		} else {
+			g.subscriber = subscriber
+			log.Printf("[Google Cloud] Pulling commands from subscription %s", g.commandSubscription)
+		}
+	}
 
 	// Start transmission loop
 	g.StartTransmissionLoop(g)
@@ -110,24 +124,15 @@ func (g *GoogleCloudConnector) Disconnect() error {
 	// Stop transmission loop
 	g.StopTransmissionLoop()
 
-	// STUB: In a full implementation, this would:
-	// 1. Stop the topic (flush pending messages)
-	// 2. Close the Pub/Sub client
-	// 3. Clean up resources
-	//
-	// Example pseudo-code:
-	// if g.topic != nil {
-	//     g.topic.Stop()
-	// }
-	//
-	// if g.client != nil {
-	//     if err := g.client.Close(); err != nil {
-	//         log.Printf("[Google Cloud] Error closing client: %v", err)
-	//     }
-	// }
+	if g.subscriber != nil {
+		g.subscriber.Stop()
+	}
+	if g.publisher != nil {
+		g.publisher.Stop()
+	}
 
 	g.SetConnected(false)
-	log.Println("[Google Cloud] STUB: Disconnected")
+	log.Println("[Google Cloud] Disconnected")
 
 	return nil
 }
@@ -138,48 +143,12 @@ func (g *GoogleCloudConnector) SendProfile(profile *database.BehavioralProfile)
 		return fmt.Errorf("profile is nil")
 	}
 
-	if !g.IsConnected() {
-		return fmt.Errorf("not connected to Google Cloud Pub/Sub")
+	msg := g.Anonymizer().AnonymizeProfile(schemas.ProfileToMessage(profile))
+	if err := g.publish(schemas.MessageTypeProfile, msg, msg.MAC); err != nil {
+		return err
 	}
 
-	// Serialize profile to JSON
-	data, err := cloud.SerializeProfile(profile)
-	if err != nil {
-		return fmt.Errorf("failed to serialize profile: %w", err)
-	}
-
-	log.Printf("[Google Cloud] Sending profile for MAC: %s", profile.MAC)
-	log.Printf("[Google Cloud] Profile data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, this would:
-	// 1. Create a Pub/Sub message with the JSON payload
-	// 2. Add attributes for filtering/routing (e.g., message_type, mac_address)
-	// 3. Publish the message asynchronously
-	// 4. Handle the publish result
-	//
-	// Example pseudo-code:
-	// ctx := context.Background()
-	//
-	// msg := &pubsub.Message{
-	//     Data: data,
-	//     Attributes: map[string]string{
-	//         "message_type": "profile",
-	//         "mac_address":  profile.MAC,
-	//         "timestamp":    time.Now().Format(time.RFC3339),
-	//     },
-	// }
-	//
-	// result := g.topic.Publish(ctx, msg)
-	//
-	// // Block until the result is available
-	// id, err := result.Get(ctx)
-	// if err != nil {
-	//     return fmt.Errorf("failed to publish profile: %w", err)
-	// }
-	//
-	// log.Printf("[Google Cloud] Published profile with message ID: %s", id)
-
-	log.Printf("[Google Cloud] STUB: Successfully sent profile for MAC: %s", profile.MAC)
+	log.Printf("[Google Cloud] Sent profile for MAC: %s", profile.MAC)
 	return nil
 }
 
@@ -189,52 +158,88 @@ func (g *GoogleCloudConnector) SendDevice(device *database.Device) error {
 		return fmt.Errorf("device is nil")
 	}
 
+	msg := g.Anonymizer().AnonymizeDevice(schemas.DeviceToMessage(device, g.sensorID, "", ""))
+	if err := g.publish(schemas.MessageTypeDevice, msg, msg.MAC); err != nil {
+		return err
+	}
+
+	log.Printf("[Google Cloud] Sent device: %s (%s)", device.MAC, device.IP)
+	return nil
+}
+
+// SendMessage publishes any schema message, such as a heartbeat, without
+// queueing it
+func (g *GoogleCloudConnector) SendMessage(messageType schemas.MessageType, payload interface{}) error {
+	return g.publish(messageType, payload, "")
+}
+
+// SendBatch publishes devices and profiles as compressed batch messages
+func (g *GoogleCloudConnector) SendBatch(sync schemas.SyncKind, devices []*database.Device, profiles []*database.BehavioralProfile) error {
+	batches, err := g.PackBatches(sync, g.sensorID, devices, profiles, maxBatchBytes)
+	if err != nil {
+		return fmt.Errorf("failed to pack batch: %w", err)
+	}
+	for _, batch := range batches {
+		if err := g.publish(schemas.MessageTypeBatch, batch, ""); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[Google Cloud] Sent %d devices and %d profiles in %d batches", len(devices), len(profiles), len(batches))
+	return nil
+}
+
+// publish wraps a payload in an envelope and publishes it to the topic
+func (g *GoogleCloudConnector) publish(messageType schemas.MessageType, payload interface{}, mac string) error {
 	if !g.IsConnected() {
 		return fmt.Errorf("not connected to Google Cloud Pub/Sub")
 	}
 
-	// Serialize device to JSON
-	data, err := cloud.SerializeDevice(device)
+	msg, err := schemas.WrapMessage(messageType, g.sensorID, payload)
 	if err != nil {
-		return fmt.Errorf("failed to serialize device: %w", err)
-	}
-
-	log.Printf("[Google Cloud] Sending device: %s (%s)", device.MAC, device.IP)
-	log.Printf("[Google Cloud] Device data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, this would:
-	// 1. Create a Pub/Sub message with the JSON payload
-	// 2. Add attributes for filtering/routing (e.g., message_type, mac_address)
-	// 3. Publish the message asynchronously
-	// 4. Handle the publish result
-	//
-	// Example pseudo-code:
-	// ctx := context.Background()
-	//
-	// msg := &pubsub.Message{
-	//     Data: data,
-	//     Attributes: map[string]string{
-	//         "message_type": "device",
-	//         "mac_address":  device.MAC,
-	//         "ip_address":   device.IP,
-	//         "timestamp":    time.Now().Format(time.RFC3339),
-	//     },
-	// }
-	//
-	// result := g.topic.Publish(ctx, msg)
-	//
-	// // Block until the result is available
-	// id, err := result.Get(ctx)
-	// if err != nil {
-	//     return fmt.Errorf("failed to publish device: %w", err)
-	// }
-	//
-	// log.Printf("[Google Cloud] Published device with message ID: %s", id)
-
-	log.Printf("[Google Cloud] STUB: Successfully sent device: %s", device.MAC)
+		return fmt.Errorf("failed to serialize %s: %w", messageType, err)
+	}
+	data, err := schemas.SerializeMessage(msg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", messageType, err)
+	}
+
+	attributes := map[string]string{
+		"message_type": string(messageType),
+		"sensor_id":    g.sensorID,
+	}
+	if mac != "" {
+		attributes["mac_address"] = mac
+	}
+	err = g.publisher.Publish(&corecloud.PubSubMessage{Data: data, Attributes: attributes})
+	if err != nil {
+		return fmt.Errorf("failed to publish %s: %w", messageType, err)
+	}
 	return nil
 }
 
+// SubscribeCommands pulls commands from the configured command subscription
+// once connected
+func (g *GoogleCloudConnector) SubscribeCommands(handler func(data []byte)) error {
+	if g.commandSubscription == "" {
+		return fmt.Errorf("no GCP command subscription configured")
+	}
+	g.commandHandler = handler
+	return nil
+}
+
+// subscriberConfig derives the command subscriber configuration from the
+// publisher's, so both use the same project, endpoint and credentials
+func (g *GoogleCloudConnector) subscriberConfig() *corecloud.PubSubSubscriberConfig {
+	cfg := corecloud.DefaultPubSubSubscriberConfig()
+	cfg.ProjectID = g.projectID
+	cfg.SubscriptionID = g.commandSubscription
+	cfg.CredentialsPath = g.pubsubCfg.CredentialsPath
+	cfg.EmulatorHost = g.pubsubCfg.EmulatorHost
+	cfg.Endpoint = g.pubsubCfg.Endpoint
+	return cfg
+}
+
 // Start begins the Google Cloud connector operations
 func (g *GoogleCloudConnector) Start() error {
 	return g.Connect()
@@ -6,7 +6,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 )
 
@@ -16,6 +18,7 @@ type Orchestrator struct {
 	db               *database.DatabaseManager
 	cfg              *config.CloudConfig
 	transmitInterval time.Duration
+	syncTracker      *corecloud.SyncTracker
 	stopChan         chan struct{}
 	wg               sync.WaitGroup
 	mu               sync.RWMutex
@@ -33,10 +36,19 @@ func NewOrchestrator(cfg *config.CloudConfig, db *database.DatabaseManager) (*Or
 
 	transmitInterval := 5 * time.Minute // Default 5-minute interval
 
+	// Remember what the cloud already has across restarts, so a reboot on a
+	// metered link does not resend everything
+	syncTracker, err := corecloud.NewSyncTracker(db)
+	if err != nil {
+		log.Printf("[Cloud Orchestrator] Sync state unavailable, everything will be sent once: %v", err)
+		syncTracker, _ = corecloud.NewSyncTracker(nil)
+	}
+
 	return &Orchestrator{
 		db:               db,
 		cfg:              cfg,
 		transmitInterval: transmitInterval,
+		syncTracker:      syncTracker,
 		stopChan:         make(chan struct{}),
 	}, nil
 }
@@ -140,58 +152,114 @@ func (o *Orchestrator) transmissionLoop() {
 	}
 }
 
-// transmitData sends profiles and devices to the cloud
+// transmitData sends the devices and profiles that changed since the last
+// acknowledged sync
 func (o *Orchestrator) transmitData() {
 	if o.connector == nil || !o.connector.IsConnected() {
 		log.Println("[Cloud Orchestrator] Not connected, skipping transmission")
 		return
 	}
 
-	log.Println("[Cloud Orchestrator] Starting data transmission...")
-
-	// Transmit all profiles
+	devices, err := o.db.GetAllDevices()
+	if err != nil {
+		log.Printf("[Cloud Orchestrator] Failed to get devices: %v", err)
+		devices = nil
+	}
 	profiles, err := o.db.GetAllProfiles()
 	if err != nil {
 		log.Printf("[Cloud Orchestrator] Failed to get profiles: %v", err)
-	} else {
-		successCount := 0
-		for _, profile := range profiles {
-			if profile == nil {
-				continue
-			}
+		profiles = nil
+	}
 
-			// Enqueue profile for transmission with retry logic
-			if err := o.enqueueWithRetry("profile", profile); err != nil {
-				log.Printf("[Cloud Orchestrator] Failed to enqueue profile %s: %v", profile.MAC, err)
-			} else {
-				successCount++
-			}
+	versions := make(map[string]string)
+	changedDevices := make([]*database.Device, 0)
+	for _, device := range devices {
+		if version, changed := o.changed("device", device.MAC, deviceVersion(device)); changed {
+			changedDevices = append(changedDevices, device)
+			versions[corecloud.SyncKey("device", device.MAC)] = version
+		}
+	}
+	changedProfiles := make([]*database.BehavioralProfile, 0)
+	for _, profile := range profiles {
+		if version, changed := o.changed("profile", profile.MAC, schemas.ProfileToMessage(profile)); changed {
+			changedProfiles = append(changedProfiles, profile)
+			versions[corecloud.SyncKey("profile", profile.MAC)] = version
 		}
-		log.Printf("[Cloud Orchestrator] Enqueued %d/%d profiles", successCount, len(profiles))
 	}
 
-	// Transmit all devices
-	devices, err := o.db.GetAllDevices()
+	if len(versions) == 0 {
+		log.Println("[Cloud Orchestrator] Nothing changed since the last sync")
+		return
+	}
+
+	log.Printf("[Cloud Orchestrator] Syncing %d/%d changed devices and %d/%d changed profiles",
+		len(changedDevices), len(devices), len(changedProfiles), len(profiles))
+	if err := o.send(schemas.SyncDelta, changedDevices, changedProfiles, versions); err != nil {
+		log.Printf("[Cloud Orchestrator] Sync incomplete, unsent changes will be retried: %v", err)
+		return
+	}
+	log.Println("[Cloud Orchestrator] Data transmission completed")
+}
+
+// changed returns an entity's version and whether it differs from the one
+// the cloud last acknowledged. Entities that cannot be versioned count as
+// changed.
+func (o *Orchestrator) changed(kind, id string, entity interface{}) (string, bool) {
+	if entity == nil {
+		return "", false
+	}
+	version, err := corecloud.Version(entity)
 	if err != nil {
-		log.Printf("[Cloud Orchestrator] Failed to get devices: %v", err)
-	} else {
-		successCount := 0
-		for _, device := range devices {
-			if device == nil {
-				continue
-			}
+		return "", true
+	}
+	return version, o.syncTracker.Changed(kind, id, version)
+}
 
-			// Enqueue device for transmission with retry logic
-			if err := o.enqueueWithRetry("device", device); err != nil {
-				log.Printf("[Cloud Orchestrator] Failed to enqueue device %s: %v", device.MAC, err)
-			} else {
-				successCount++
-			}
+// deviceVersion returns the part of a device that decides whether it is
+// resent. The last-seen time moves on every scan, so it alone does not
+// trigger an upload; activity reaches the cloud through profiles and
+// heartbeats.
+func deviceVersion(device *database.Device) interface{} {
+	msg := schemas.DeviceToMessage(device, "", "", "")
+	if msg != nil {
+		msg.LastSeen = time.Time{}
+	}
+	return msg
+}
+
+// send transmits devices and profiles, in compressed batches when the
+// connector supports them, and records the versions the cloud accepted
+func (o *Orchestrator) send(sync schemas.SyncKind, devices []*database.Device, profiles []*database.BehavioralProfile, versions map[string]string) error {
+	if batcher, ok := o.connector.(BatchSender); ok {
+		if err := batcher.SendBatch(sync, devices, profiles); err != nil {
+			return err
 		}
-		log.Printf("[Cloud Orchestrator] Enqueued %d/%d devices", successCount, len(devices))
+		return o.syncTracker.Acknowledge(versions)
 	}
 
-	log.Println("[Cloud Orchestrator] Data transmission completed")
+	// One message per record: acknowledge each as it is accepted
+	var firstErr error
+	send := func(kind, mac string, data interface{}) {
+		if err := o.enqueueWithRetry(kind, data); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to send %s %s: %w", kind, mac, err)
+			}
+			return
+		}
+		key := corecloud.SyncKey(kind, mac)
+		if version, ok := versions[key]; ok {
+			if err := o.syncTracker.Acknowledge(map[string]string{key: version}); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	for _, device := range devices {
+		send("device", device.MAC, device)
+	}
+	for _, profile := range profiles {
+		send("profile", profile.MAC, profile)
+	}
+	return firstErr
 }
 
 // enqueueWithRetry attempts to enqueue data with exponential backoff
@@ -253,17 +321,109 @@ func (o *Orchestrator) IsConnected() bool {
 	return o.connector.IsConnected()
 }
 
+// SendMessage publishes a schema message through the connector right away,
+// bypassing the transmission queue. It fails when the connector is not
+// connected or cannot send arbitrary messages.
+func (o *Orchestrator) SendMessage(messageType schemas.MessageType, payload interface{}) error {
+	o.mu.RLock()
+	connector := o.connector
+	o.mu.RUnlock()
+
+	if connector == nil || !connector.IsConnected() {
+		return fmt.Errorf("cloud connector is not connected")
+	}
+	sender, ok := connector.(MessageSender)
+	if !ok {
+		return fmt.Errorf("cloud connector cannot send %s messages", messageType)
+	}
+	return sender.SendMessage(messageType, payload)
+}
+
+// SubscribeCommands passes commands received by the connector to handler.
+// Call before Start.
+func (o *Orchestrator) SubscribeCommands(handler func(data []byte)) error {
+	o.mu.RLock()
+	connector := o.connector
+	o.mu.RUnlock()
+
+	subscriber, ok := connector.(CommandSubscriber)
+	if !ok {
+		return fmt.Errorf("cloud connector cannot receive commands")
+	}
+	return subscriber.SubscribeCommands(handler)
+}
+
+// SendSnapshot sends the current devices and profiles with the given MACs,
+// or all of them when macs is empty, whether or not they changed. It returns
+// how many records were sent.
+func (o *Orchestrator) SendSnapshot(macs []string) (int, error) {
+	if !o.IsConnected() {
+		return 0, fmt.Errorf("cloud connector is not connected")
+	}
+
+	var devices []*database.Device
+	var profiles []*database.BehavioralProfile
+	if len(macs) == 0 {
+		var err error
+		if devices, err = o.db.GetAllDevices(); err != nil {
+			return 0, fmt.Errorf("failed to get devices: %w", err)
+		}
+		if profiles, err = o.db.GetAllProfiles(); err != nil {
+			return 0, fmt.Errorf("failed to get profiles: %w", err)
+		}
+	} else {
+		// MACs the sensor does not know are skipped
+		for _, mac := range macs {
+			if device, err := o.db.GetDevice(mac); err == nil {
+				devices = append(devices, device)
+			}
+			if profile, err := o.db.GetProfile(mac); err == nil {
+				profiles = append(profiles, profile)
+			}
+		}
+		if len(devices) == 0 && len(profiles) == 0 {
+			return 0, fmt.Errorf("none of the %d requested devices are known", len(macs))
+		}
+	}
+
+	versions := make(map[string]string)
+	for _, device := range devices {
+		if version, err := corecloud.Version(deviceVersion(device)); err == nil {
+			versions[corecloud.SyncKey("device", device.MAC)] = version
+		}
+	}
+	for _, profile := range profiles {
+		if version, err := corecloud.Version(schemas.ProfileToMessage(profile)); err == nil {
+			versions[corecloud.SyncKey("profile", profile.MAC)] = version
+		}
+	}
+
+	if err := o.send(schemas.SyncSnapshot, devices, profiles, versions); err != nil {
+		return 0, err
+	}
+	sent := len(devices) + len(profiles)
+	log.Printf("[Cloud Orchestrator] Sent snapshot of %d devices and %d profiles", len(devices), len(profiles))
+	return sent, nil
+}
+
 // GetQueueSize returns the current transmission queue size
 func (o *Orchestrator) GetQueueSize() int {
+	stats, ok := o.QueueStats()
+	if !ok {
+		return 0
+	}
+	return stats.Depth
+}
+
+// QueueStats returns the transmission queue statistics of the connector, if
+// it keeps a queue
+func (o *Orchestrator) QueueStats() (corecloud.QueueStats, bool) {
 	o.mu.RLock()
 	defer o.mu.RUnlock()
 
-	if o.connector == nil {
-		return 0
+	reporter, ok := o.connector.(interface{ QueueStats() corecloud.QueueStats })
+	if !ok {
+		return corecloud.QueueStats{}, false
 	}
-
-	// Queue size tracking is internal to each connector implementation
-	// This would require adding a GetQueueSize method to the CloudConnector interface
-	// For now, return 0 as queue management is handled by the connector
-	return 0
+	return reporter.QueueStats(), true
 }
@@ -0,0 +1,197 @@
+package schemas
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MinAnonymizationKeySize is the smallest key NewAnonymizer accepts
+const MinAnonymizationKeySize = 16
+
+// Anonymizer pseudonymizes the identifying fields of cloud messages with a
+// keyed hash. The key is per installation, so a device maps to the same
+// pseudonym in every upload from that sensor but cannot be correlated across
+// installations or reversed without the key.
+//
+// MACs become locally administered MACs, internal IPs are truncated to their
+// network, other IPs and names become "anon-" tokens, and mDNS services and
+// device notes are dropped. A nil *Anonymizer leaves messages untouched.
+type Anonymizer struct {
+	key []byte
+}
+
+// NewAnonymizer creates an anonymizer from a per-installation secret key
+func NewAnonymizer(key []byte) (*Anonymizer, error) {
+	if len(key) < MinAnonymizationKeySize {
+		return nil, fmt.Errorf("anonymization key must be at least %d bytes, got %d", MinAnonymizationKeySize, len(key))
+	}
+	return &Anonymizer{key: append([]byte(nil), key...)}, nil
+}
+
+// AnonymizeDevice returns an anonymized copy of a device message
+func (a *Anonymizer) AnonymizeDevice(msg *DeviceMessage) *DeviceMessage {
+	if a == nil || msg == nil {
+		return msg
+	}
+
+	anon := *msg
+	anon.MAC = a.MAC(msg.MAC)
+	anon.IP = a.IP(msg.IP)
+	anon.Name = a.Name(msg.Name)
+	anon.Hostname = a.Name(msg.Hostname)
+	anon.Services = nil
+	anon.Gateway = a.IP(msg.Gateway)
+	anon.Label = a.Name(msg.Label)
+	anon.Owner = a.Name(msg.Owner)
+	anon.Location = a.Name(msg.Location)
+	anon.Notes = ""
+	return &anon
+}
+
+// AnonymizeProfile returns an anonymized copy of a profile message.
+// Destination IPs are anonymized; the domains they were resolved from are kept.
+func (a *Anonymizer) AnonymizeProfile(msg *ProfileMessage) *ProfileMessage {
+	if a == nil || msg == nil {
+		return msg
+	}
+
+	anon := *msg
+	anon.MAC = a.MAC(msg.MAC)
+	if msg.TopDestinations != nil {
+		anon.TopDestinations = make([]DestinationSummary, len(msg.TopDestinations))
+		for i, dest := range msg.TopDestinations {
+			dest.IP = a.IP(dest.IP)
+			anon.TopDestinations[i] = dest
+		}
+	}
+	return &anon
+}
+
+// AnonymizeAnomaly returns an anonymized copy of an anomaly message. The
+// free-text description often names the device, so it is withheld; addresses
+// and names in the evidence are anonymized like the fields of other messages.
+func (a *Anonymizer) AnonymizeAnomaly(msg *AnomalyMessage) *AnomalyMessage {
+	if a == nil || msg == nil {
+		return msg
+	}
+
+	anon := *msg
+	anon.DeviceMAC = a.MAC(msg.DeviceMAC)
+	anon.Description = ""
+	if msg.Evidence != nil {
+		anon.Evidence = make(map[string]interface{}, len(msg.Evidence))
+		for key, value := range msg.Evidence {
+			anon.Evidence[key] = a.evidenceValue(key, value)
+		}
+	}
+	return &anon
+}
+
+// evidenceValue anonymizes a single evidence value. Strings that parse as MACs
+// or IPs are anonymized wherever they appear; name-like keys are hashed.
+func (a *Anonymizer) evidenceValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if _, err := net.ParseMAC(v); err == nil {
+			return a.MAC(v)
+		}
+		if net.ParseIP(v) != nil {
+			return a.IP(v)
+		}
+		if isNameKey(key) {
+			return a.Name(v)
+		}
+		return v
+	case []string:
+		result := make([]string, len(v))
+		for i, s := range v {
+			result[i], _ = a.evidenceValue(key, s).(string)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = a.evidenceValue(key, item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// isNameKey reports whether an evidence key holds a device or host name
+func isNameKey(key string) bool {
+	key = strings.ToLower(key)
+	return key == "name" || strings.HasSuffix(key, "_name") || strings.Contains(key, "hostname")
+}
+
+// MAC returns the pseudonym of a MAC address: a locally administered unicast
+// MAC derived from the keyed hash, so it still parses as a MAC downstream.
+// Values that are not MACs are hashed like names.
+func (a *Anonymizer) MAC(mac string) string {
+	if a == nil || mac == "" {
+		return mac
+	}
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return a.Name(mac)
+	}
+
+	sum := a.sum("mac", hw.String())
+	pseudo := net.HardwareAddr(sum[:6])
+	pseudo[0] = pseudo[0]&^0x01 | 0x02 // Unicast, locally administered
+	return pseudo.String()
+}
+
+// IP returns the anonymized form of an IP address. Internal addresses
+// (private, loopback and link-local) are truncated to their /24 or /64
+// network, which keeps subnet context without identifying the host; other
+// addresses are replaced by a pseudonym. Values that are not IPs are hashed
+// like names.
+func (a *Anonymizer) IP(ip string) string {
+	if a == nil || ip == "" {
+		return ip
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return a.Name(ip)
+	}
+
+	if parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() {
+		if v4 := parsed.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return parsed.Mask(net.CIDRMask(64, 128)).String()
+	}
+	return a.token("ip", parsed.String())
+}
+
+// Name returns the pseudonym of a device name or hostname. Names are compared
+// case-insensitively, so a hostname and an identical device name map to the
+// same pseudonym.
+func (a *Anonymizer) Name(name string) string {
+	if a == nil || name == "" {
+		return name
+	}
+	return a.token("name", strings.ToLower(strings.TrimSpace(name)))
+}
+
+// token returns an "anon-" pseudonym for a value of the given kind
+func (a *Anonymizer) token(kind, value string) string {
+	sum := a.sum(kind, value)
+	return "anon-" + hex.EncodeToString(sum[:8])
+}
+
+// sum returns the keyed hash of a value. The kind keeps the same text used as
+// different field types from mapping to related pseudonyms.
+func (a *Anonymizer) sum(kind, value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
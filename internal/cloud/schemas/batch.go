@@ -0,0 +1,138 @@
+package schemas
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BatchEncodingGzip marks batch data as a gzip-compressed JSON array of records
+const BatchEncodingGzip = "gzip"
+
+// ErrRecordTooLarge is returned when a single record does not fit in a batch
+var ErrRecordTooLarge = errors.New("record exceeds the batch size limit")
+
+// SyncKind tells the cloud how a batch relates to what it already holds
+type SyncKind string
+
+const (
+	// SyncDelta batches carry only the records that changed since the last
+	// acknowledged sync
+	SyncDelta SyncKind = "delta"
+	// SyncSnapshot batches carry records regardless of change, on request
+	SyncSnapshot SyncKind = "snapshot"
+)
+
+// BatchRecord is one device, profile or other message inside a batch
+type BatchRecord struct {
+	Type    MessageType     `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// BatchMessage carries many records in one compressed message, which costs
+// far less than a message per record on metered links
+type BatchMessage struct {
+	Sync     SyncKind `json:"sync"`
+	Encoding string   `json:"encoding"`
+	Count    int      `json:"count"`
+	Data     []byte   `json:"data"` // Compressed records, base64 in JSON
+}
+
+// NewBatchRecord marshals a payload into a batch record
+func NewBatchRecord(messageType MessageType, payload interface{}) (BatchRecord, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return BatchRecord{}, fmt.Errorf("failed to marshal %s record: %w", messageType, err)
+	}
+	return BatchRecord{Type: messageType, Payload: data}, nil
+}
+
+// PackBatches compresses records into as few batches as possible whose
+// base64-encoded data stays within maxBytes. Records keep their order.
+func PackBatches(sync SyncKind, records []BatchRecord, maxBytes int) ([]*BatchMessage, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("batch size limit must be positive, got %d", maxBytes)
+	}
+
+	// JSON records compress well, so start from chunks of several times the
+	// limit and split only the chunks that still come out too large
+	var batches []*BatchMessage
+	start, size := 0, 0
+	for i, record := range records {
+		size += len(record.Payload)
+		if size >= 4*maxBytes || i == len(records)-1 {
+			packed, err := packChunk(sync, records[start:i+1], maxBytes)
+			if err != nil {
+				return nil, err
+			}
+			batches = append(batches, packed...)
+			start, size = i+1, 0
+		}
+	}
+	return batches, nil
+}
+
+// packChunk compresses records into one batch, halving the chunk until each
+// part fits
+func packChunk(sync SyncKind, records []BatchRecord, maxBytes int) ([]*BatchMessage, error) {
+	data, err := compressRecords(records)
+	if err != nil {
+		return nil, err
+	}
+	if base64.StdEncoding.EncodedLen(len(data)) <= maxBytes {
+		return []*BatchMessage{{Sync: sync, Encoding: BatchEncodingGzip, Count: len(records), Data: data}}, nil
+	}
+	if len(records) == 1 {
+		return nil, fmt.Errorf("%w: %s record of %d bytes", ErrRecordTooLarge, records[0].Type, len(records[0].Payload))
+	}
+
+	half := len(records) / 2
+	first, err := packChunk(sync, records[:half], maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	second, err := packChunk(sync, records[half:], maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// compressRecords gzips the JSON array of records
+func compressRecords(records []BatchRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(records); err != nil {
+		return nil, fmt.Errorf("failed to encode batch: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress batch: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Records decompresses and decodes a batch's records
+func (b *BatchMessage) Records() ([]BatchRecord, error) {
+	if b.Encoding != BatchEncodingGzip {
+		return nil, fmt.Errorf("unsupported batch encoding: %s", b.Encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress batch: %w", err)
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress batch: %w", err)
+	}
+	var records []BatchRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode batch records: %w", err)
+	}
+	return records, nil
+}
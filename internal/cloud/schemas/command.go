@@ -0,0 +1,190 @@
+package schemas
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CommandSchemaVersion is the command schema version this sensor understands
+const CommandSchemaVersion = 1
+
+// CommandBroadcast as a command's sensor ID addresses every sensor
+const CommandBroadcast = "*"
+
+// maxCommandClockSkew tolerates sensors whose clocks run behind the issuer's
+const maxCommandClockSkew = 5 * time.Minute
+
+// CommandType identifies an operation the cloud asks a sensor to perform
+type CommandType string
+
+const (
+	CommandRescan                CommandType = "rescan"                   // Run a discovery scan now
+	CommandAddInterceptTarget    CommandType = "add_intercept_target"     // Start intercepting a device
+	CommandRemoveInterceptTarget CommandType = "remove_intercept_target"  // Stop intercepting a device
+	CommandSetSensitivity        CommandType = "set_detector_sensitivity" // Change anomaly detector sensitivity
+	CommandProfileSnapshot       CommandType = "profile_snapshot"         // Upload current profiles now
+	CommandRotateLogs            CommandType = "rotate_logs"              // Start a new log file
+)
+
+var (
+	// ErrCommandSignature is returned for unsigned commands and commands no
+	// trusted key signed
+	ErrCommandSignature = errors.New("command signature is invalid")
+	// ErrCommandExpired is returned for commands past their expiry
+	ErrCommandExpired = errors.New("command has expired")
+	// ErrCommandVersion is returned for commands of an unsupported schema version
+	ErrCommandVersion = errors.New("unsupported command version")
+	// ErrCommandTarget is returned for commands addressed to another sensor
+	ErrCommandTarget = errors.New("command is addressed to another sensor")
+)
+
+// Command is an operation sent from the cloud to one sensor or all of them.
+// Commands are signed with Ed25519 by the issuer and expire, so a sensor only
+// needs the issuer's public key to reject forged and replayed commands.
+type Command struct {
+	ID        string          `json:"id"`
+	Version   int             `json:"version"`
+	Type      CommandType     `json:"type"`
+	SensorID  string          `json:"sensor_id"` // Target sensor, or "*" for all
+	IssuedAt  time.Time       `json:"issued_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Signature string          `json:"signature"` // Base64 Ed25519 signature of SigningPayload
+}
+
+// InterceptTargetParams are the parameters of add/remove intercept target
+type InterceptTargetParams struct {
+	MAC string `json:"mac"`
+}
+
+// SensitivityParams are the parameters of set detector sensitivity
+type SensitivityParams struct {
+	Sensitivity float64 `json:"sensitivity"` // 0.0 to 1.0
+}
+
+// ProfileSnapshotParams are the parameters of profile snapshot
+type ProfileSnapshotParams struct {
+	MACs []string `json:"macs,omitempty"` // Devices to include; all when empty
+}
+
+// CommandStatus is the outcome reported in a command acknowledgement
+type CommandStatus string
+
+const (
+	CommandSucceeded CommandStatus = "succeeded"
+	CommandFailed    CommandStatus = "failed"   // Accepted, but the operation failed
+	CommandRejected  CommandStatus = "rejected" // Not executed: invalid, expired, duplicate or unknown
+)
+
+// CommandAckMessage reports the outcome of a command back to the cloud
+type CommandAckMessage struct {
+	CommandID string                 `json:"command_id"`
+	Type      CommandType            `json:"type"`
+	Status    CommandStatus          `json:"status"`
+	Error     string                 `json:"error,omitempty"`
+	Result    map[string]interface{} `json:"result,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// ParseCommand decodes a command. Params are kept byte for byte, since the
+// signature covers their hash.
+func ParseCommand(data []byte) (*Command, error) {
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal command: %w", err)
+	}
+	if cmd.ID == "" {
+		return nil, fmt.Errorf("command ID is required")
+	}
+	if cmd.Type == "" {
+		return nil, fmt.Errorf("command type is required")
+	}
+	return &cmd, nil
+}
+
+// SigningPayload returns the bytes a command's signature covers: one field
+// per line, with times in RFC 3339 UTC and the params as a SHA-256 hash. The
+// format is simple to reproduce in any language, unlike canonical JSON.
+func (c *Command) SigningPayload() []byte {
+	paramsHash := sha256.Sum256(c.Params)
+	return []byte(strings.Join([]string{
+		"heimdal-command",
+		strconv.Itoa(c.Version),
+		c.ID,
+		string(c.Type),
+		c.SensorID,
+		c.IssuedAt.UTC().Format(time.RFC3339Nano),
+		c.ExpiresAt.UTC().Format(time.RFC3339Nano),
+		base64.StdEncoding.EncodeToString(paramsHash[:]),
+	}, "\n"))
+}
+
+// SignCommand signs a command with the issuer's private key
+func SignCommand(cmd *Command, key ed25519.PrivateKey) {
+	cmd.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, cmd.SigningPayload()))
+}
+
+// VerifyCommand checks that a command was signed by one of the trusted keys,
+// uses a supported schema version, is addressed to sensorID and is valid at now
+func VerifyCommand(cmd *Command, keys []ed25519.PublicKey, sensorID string, now time.Time) error {
+	signature, err := base64.StdEncoding.DecodeString(cmd.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return ErrCommandSignature
+	}
+	payload := cmd.SigningPayload()
+	trusted := false
+	for _, key := range keys {
+		if len(key) == ed25519.PublicKeySize && ed25519.Verify(key, payload, signature) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return ErrCommandSignature
+	}
+
+	if cmd.Version != CommandSchemaVersion {
+		return fmt.Errorf("%w: %d", ErrCommandVersion, cmd.Version)
+	}
+	if cmd.SensorID != CommandBroadcast && cmd.SensorID != sensorID {
+		return ErrCommandTarget
+	}
+	// An expiry is mandatory: it bounds how long a captured command can be replayed
+	if cmd.ExpiresAt.IsZero() || !now.Before(cmd.ExpiresAt) {
+		return ErrCommandExpired
+	}
+	if cmd.IssuedAt.After(now.Add(maxCommandClockSkew)) {
+		return fmt.Errorf("command issued in the future (%s)", cmd.IssuedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// DecodeParams unmarshals a command's params into v
+func (c *Command) DecodeParams(v interface{}) error {
+	if len(c.Params) == 0 {
+		return fmt.Errorf("%s requires params", c.Type)
+	}
+	if err := json.Unmarshal(c.Params, v); err != nil {
+		return fmt.Errorf("invalid %s params: %w", c.Type, err)
+	}
+	return nil
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
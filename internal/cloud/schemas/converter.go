@@ -15,7 +15,7 @@ func DeviceToMessage(device *database.Device, sensorID, networkID, gateway strin
 		return nil
 	}
 
-	return &DeviceMessage{
+	msg := &DeviceMessage{
 		MAC:          device.MAC,
 		IP:           device.IP,
 		Name:         device.Name,
@@ -30,6 +30,17 @@ func DeviceToMessage(device *database.Device, sensorID, networkID, gateway strin
 		NetworkID:    networkID,
 		Gateway:      gateway,
 	}
+
+	if metadata := device.Metadata; metadata != nil {
+		msg.Label = metadata.Label
+		msg.Owner = metadata.Owner
+		msg.Location = metadata.Location
+		msg.Tags = metadata.Tags
+		msg.Notes = metadata.Notes
+		msg.Trusted = metadata.Trusted
+	}
+
+	return msg
 }
 
 // ProfileToMessage converts a database.BehavioralProfile to a ProfileMessage
@@ -47,6 +58,13 @@ func ProfileToMessage(profile *database.BehavioralProfile) *ProfileMessage {
 		UniqueDestinations: len(profile.Destinations),
 		UniquePorts:        len(profile.Ports),
 		HourlyActivity:     profile.HourlyActivity,
+		UniqueDomains:      len(profile.Domains),
+		DNSQueries:         profile.DNSQueries,
+		NXDomainResponses:  profile.NXDomainResponses,
+		Flows:              profile.Flows,
+		BytesSent:          profile.BytesSent,
+		BytesReceived:      profile.BytesReceived,
+		LongestFlowSeconds: profile.LongestFlowSeconds,
 	}
 
 	// Calculate protocol distribution percentages
@@ -67,6 +85,15 @@ func ProfileToMessage(profile *database.BehavioralProfile) *ProfileMessage {
 	// Extract top 10 ports
 	msg.TopPorts = getTopPorts(profile.Ports, 10)
 
+	// Extract top 20 domains
+	msg.TopDomains = getTopDomains(profile.Domains, 20)
+
+	// List TLS client fingerprints
+	for ja4 := range profile.TLSClients {
+		msg.TLSFingerprints = append(msg.TLSFingerprints, ja4)
+	}
+	sort.Strings(msg.TLSFingerprints)
+
 	// Include baseline if available
 	if profile.Baseline != nil {
 		msg.Baseline = &BaselineMetrics{
@@ -92,6 +119,7 @@ func getTopDestinations(destinations map[string]*database.DestInfo, limit int) [
 	for ip, info := range destinations {
 		destSlice = append(destSlice, DestinationSummary{
 			IP:       ip,
+			Domain:   info.Domain,
 			Count:    info.Count,
 			LastSeen: info.LastSeen,
 		})
@@ -110,6 +138,37 @@ func getTopDestinations(destinations map[string]*database.DestInfo, limit int) [
 	return destSlice
 }
 
+// getTopDomains returns the top N domains by query count
+func getTopDomains(domains map[string]*database.DomainInfo, limit int) []DomainSummary {
+	if len(domains) == 0 {
+		return nil
+	}
+
+	domainSlice := make([]DomainSummary, 0, len(domains))
+	for name, info := range domains {
+		domainSlice = append(domainSlice, DomainSummary{
+			Domain:   name,
+			Count:    info.Count,
+			NXDomain: info.NXDomain,
+			LastSeen: info.LastSeen,
+		})
+	}
+
+	// Sort by count (descending), then name for a stable order
+	sort.Slice(domainSlice, func(i, j int) bool {
+		if domainSlice[i].Count != domainSlice[j].Count {
+			return domainSlice[i].Count > domainSlice[j].Count
+		}
+		return domainSlice[i].Domain < domainSlice[j].Domain
+	})
+
+	if len(domainSlice) > limit {
+		domainSlice = domainSlice[:limit]
+	}
+
+	return domainSlice
+}
+
 // getTopPorts returns the top N ports by usage count
 func getTopPorts(ports map[uint16]int, limit int) []PortSummary {
 	// Calculate total
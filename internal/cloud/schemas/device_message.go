@@ -11,17 +11,21 @@ import (
 type MessageType string
 
 const (
-	MessageTypeDevice    MessageType = "device"
-	MessageTypeProfile   MessageType = "profile"
-	MessageTypeAnomaly   MessageType = "anomaly"
-	MessageTypeHeartbeat MessageType = "heartbeat"
-	MessageTypeTelemetry MessageType = "telemetry"
+	MessageTypeDevice     MessageType = "device"
+	MessageTypeProfile    MessageType = "profile"
+	MessageTypeAnomaly    MessageType = "anomaly"
+	MessageTypeHeartbeat  MessageType = "heartbeat"
+	MessageTypeTelemetry  MessageType = "telemetry"
+	MessageTypeCommand    MessageType = "commands"    // Cloud to sensor
+	MessageTypeCommandAck MessageType = "command_ack" // Sensor to cloud
+	MessageTypeBatch      MessageType = "batch"       // Compressed devices and profiles
 )
 
 // CloudMessage is the envelope for all cloud communications
 type CloudMessage struct {
 	MessageType MessageType     `json:"message_type"`
-	SensorID    string          `json:"sensor_id"` // Unique sensor identifier
+	SensorID    string          `json:"sensor_id"`             // Unique sensor identifier
+	SensorType  string          `json:"sensor_type,omitempty"` // "hardware" or "desktop"
 	Timestamp   time.Time       `json:"timestamp"`
 	Version     string          `json:"version"` // Schema version
 	Payload     json.RawMessage `json:"payload"`
@@ -44,6 +48,14 @@ type DeviceMessage struct {
 	// Network context
 	NetworkID string `json:"network_id,omitempty"` // Subnet or network identifier
 	Gateway   string `json:"gateway,omitempty"`    // Gateway IP
+
+	// Inventory details edited by the site's users
+	Label    string   `json:"label,omitempty"`
+	Owner    string   `json:"owner,omitempty"`
+	Location string   `json:"location,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Notes    string   `json:"notes,omitempty"`
+	Trusted  bool     `json:"trusted,omitempty"`
 }
 
 // ProfileMessage contains behavioral profile data
@@ -65,6 +77,21 @@ type ProfileMessage struct {
 	// Top ports (limited to top 10)
 	TopPorts []PortSummary `json:"top_ports"`
 
+	// Domains looked up over DNS (top 20 by query count)
+	UniqueDomains     int             `json:"unique_domains"`
+	TopDomains        []DomainSummary `json:"top_domains,omitempty"`
+	DNSQueries        int64           `json:"dns_queries"`
+	NXDomainResponses int64           `json:"nxdomain_responses"`
+
+	// JA4 fingerprints of the TLS clients the device runs, sorted
+	TLSFingerprints []string `json:"tls_fingerprints,omitempty"`
+
+	// Completed connections, with volume from the device's side
+	Flows              int64   `json:"flows"`
+	BytesSent          int64   `json:"bytes_sent"`
+	BytesReceived      int64   `json:"bytes_received"`
+	LongestFlowSeconds float64 `json:"longest_flow_seconds"`
+
 	// Hourly activity pattern
 	HourlyActivity [24]int `json:"hourly_activity"`
 
@@ -75,7 +102,16 @@ type ProfileMessage struct {
 // DestinationSummary summarizes communication with a destination
 type DestinationSummary struct {
 	IP       string    `json:"ip"`
+	Domain   string    `json:"domain,omitempty"` // Name the device resolved the IP from
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// DomainSummary summarizes lookups of a domain
+type DomainSummary struct {
+	Domain   string    `json:"domain"`
 	Count    int64     `json:"count"`
+	NXDomain int64     `json:"nxdomain,omitempty"`
 	LastSeen time.Time `json:"last_seen"`
 }
 
@@ -118,6 +154,7 @@ type HeartbeatMessage struct {
 	SensorID      string    `json:"sensor_id"`
 	Timestamp     time.Time `json:"timestamp"`
 	Uptime        int64     `json:"uptime_seconds"`
+	Version       string    `json:"version,omitempty"` // Sensor software version
 	DeviceCount   int       `json:"device_count"`
 	ActiveDevices int       `json:"active_devices"`
 	ProfileCount  int       `json:"profile_count"`
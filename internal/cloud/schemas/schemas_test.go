@@ -1,7 +1,12 @@
 package schemas
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -21,6 +26,7 @@ func TestDeviceToMessage(t *testing.T) {
 		FirstSeen:    time.Now().Add(-24 * time.Hour),
 		LastSeen:     time.Now(),
 		IsActive:     true,
+		Metadata:     &database.DeviceMetadata{Label: "Front desk phone", Tags: []string{"reception"}, Trusted: true},
 	}
 
 	msg := DeviceToMessage(device, "sensor-001", "192.168.1.0/24", "192.168.1.1")
@@ -34,6 +40,9 @@ func TestDeviceToMessage(t *testing.T) {
 	if msg.NetworkID != "192.168.1.0/24" {
 		t.Errorf("Expected NetworkID 192.168.1.0/24, got %s", msg.NetworkID)
 	}
+	if msg.Label != "Front desk phone" || len(msg.Tags) != 1 || !msg.Trusted {
+		t.Errorf("Expected the device metadata, got label %q, tags %v, trusted %v", msg.Label, msg.Tags, msg.Trusted)
+	}
 }
 
 func TestProfileToMessage(t *testing.T) {
@@ -209,3 +218,214 @@ func TestGetTopPorts(t *testing.T) {
 		t.Errorf("Expected percentage ~%.3f, got %.3f", expectedPercentage, top[0].Percentage)
 	}
 }
+
+func TestAnonymizer(t *testing.T) {
+	anonymizer, err := NewAnonymizer([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("NewAnonymizer failed: %v", err)
+	}
+
+	device := &database.Device{
+		MAC:      "AA:BB:CC:DD:EE:FF",
+		IP:       "192.168.1.100",
+		Name:     "Dana's iPhone",
+		Hostname: "danas-iphone",
+		Vendor:   "Apple",
+		Services: []string{"_airplay._tcp"},
+		Metadata: &database.DeviceMetadata{Owner: "Dana", Notes: "Personal phone", Tags: []string{"staff"}},
+	}
+	msg := anonymizer.AnonymizeDevice(DeviceToMessage(device, "sensor-001", "192.168.1.0/24", "192.168.1.1"))
+
+	hw, err := net.ParseMAC(msg.MAC)
+	if err != nil || hw[0]&0x02 == 0 || msg.MAC == "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("Expected a locally administered pseudonym MAC, got %q", msg.MAC)
+	}
+	if msg.IP != "192.168.1.0" || msg.Gateway != "192.168.1.0" {
+		t.Errorf("Expected internal IPs truncated to the /24, got %q and %q", msg.IP, msg.Gateway)
+	}
+	if !strings.HasPrefix(msg.Name, "anon-") || !strings.HasPrefix(msg.Hostname, "anon-") {
+		t.Errorf("Expected pseudonymized names, got %q and %q", msg.Name, msg.Hostname)
+	}
+	if msg.Services != nil || msg.Vendor != "Apple" {
+		t.Errorf("Expected services stripped and vendor kept, got %v and %q", msg.Services, msg.Vendor)
+	}
+	if !strings.HasPrefix(msg.Owner, "anon-") || msg.Notes != "" || len(msg.Tags) != 1 {
+		t.Errorf("Expected a pseudonymized owner, no notes and the tags kept, got %q, %q and %v", msg.Owner, msg.Notes, msg.Tags)
+	}
+
+	// Pseudonyms are stable and shared across message types
+	profile := anonymizer.AnonymizeProfile(ProfileToMessage(&database.BehavioralProfile{
+		MAC: "aa:bb:cc:dd:ee:ff",
+		Destinations: map[string]*database.DestInfo{
+			"8.8.8.8": {IP: "8.8.8.8", Domain: "dns.google", Count: 3},
+		},
+	}))
+	if profile.MAC != msg.MAC {
+		t.Errorf("Expected the same MAC pseudonym in profiles, got %q and %q", profile.MAC, msg.MAC)
+	}
+	if dest := profile.TopDestinations[0]; !strings.HasPrefix(dest.IP, "anon-") || dest.Domain != "dns.google" {
+		t.Errorf("Unexpected anonymized destination: %+v", dest)
+	}
+
+	anomaly := anonymizer.AnonymizeAnomaly(&AnomalyMessage{
+		DeviceMAC:   "aa:bb:cc:dd:ee:ff",
+		Type:        "new_device",
+		Description: "New device joined the network: Dana's iPhone [aa:bb:cc:dd:ee:ff, 192.168.1.100]",
+		Evidence:    map[string]interface{}{"ip": "192.168.1.100", "hostname": "danas-iphone", "count": 3},
+	})
+	if anomaly.DeviceMAC != msg.MAC || anomaly.Description != "" {
+		t.Errorf("Unexpected anonymized anomaly: %+v", anomaly)
+	}
+	if anomaly.Evidence["ip"] != "192.168.1.0" || anomaly.Evidence["hostname"] != msg.Hostname || anomaly.Evidence["count"] != 3 {
+		t.Errorf("Unexpected anonymized evidence: %v", anomaly.Evidence)
+	}
+
+	// A different installation key yields unrelated pseudonyms
+	other, _ := NewAnonymizer([]byte("fedcba9876543210fedcba9876543210"))
+	if other.MAC(device.MAC) == msg.MAC {
+		t.Error("Expected pseudonyms to depend on the installation key")
+	}
+
+	// Without an anonymizer messages pass through untouched
+	var none *Anonymizer
+	if plain := none.AnonymizeDevice(DeviceToMessage(device, "", "", "")); plain.MAC != device.MAC || plain.Services == nil {
+		t.Errorf("Expected a nil anonymizer to leave the message as-is, got %+v", plain)
+	}
+}
+
+func TestCommandSignAndVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	keys := []ed25519.PublicKey{otherPub, pub}
+
+	now := time.Now()
+	cmd := &Command{
+		ID:        "cmd-1",
+		Version:   CommandSchemaVersion,
+		Type:      CommandAddInterceptTarget,
+		SensorID:  "sensor-01",
+		IssuedAt:  now,
+		ExpiresAt: now.Add(time.Minute),
+		Params:    json.RawMessage(`{"mac":"aa:bb:cc:dd:ee:ff"}`),
+	}
+	SignCommand(cmd, priv)
+
+	// A command survives the round trip through JSON with its signature intact
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("Failed to marshal command: %v", err)
+	}
+	parsed, err := ParseCommand(data)
+	if err != nil {
+		t.Fatalf("ParseCommand failed: %v", err)
+	}
+	if err := VerifyCommand(parsed, keys, "sensor-01", now); err != nil {
+		t.Fatalf("Expected valid command, got %v", err)
+	}
+	var params InterceptTargetParams
+	if err := parsed.DecodeParams(&params); err != nil || params.MAC != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("Unexpected params %+v (%v)", params, err)
+	}
+
+	tampered := *parsed
+	tampered.Params = json.RawMessage(`{"mac":"11:22:33:44:55:66"}`)
+	if err := VerifyCommand(&tampered, keys, "sensor-01", now); !errors.Is(err, ErrCommandSignature) {
+		t.Errorf("Expected tampered params to fail verification, got %v", err)
+	}
+	if err := VerifyCommand(parsed, []ed25519.PublicKey{otherPub}, "sensor-01", now); !errors.Is(err, ErrCommandSignature) {
+		t.Errorf("Expected untrusted signer to fail verification, got %v", err)
+	}
+	if err := VerifyCommand(parsed, keys, "sensor-02", now); !errors.Is(err, ErrCommandTarget) {
+		t.Errorf("Expected other sensor to be rejected, got %v", err)
+	}
+	if err := VerifyCommand(parsed, keys, "sensor-01", now.Add(2*time.Minute)); !errors.Is(err, ErrCommandExpired) {
+		t.Errorf("Expected expired command to be rejected, got %v", err)
+	}
+
+	broadcast := *parsed
+	broadcast.SensorID = CommandBroadcast
+	broadcast.Version = CommandSchemaVersion + 1
+	SignCommand(&broadcast, priv)
+	if err := VerifyCommand(&broadcast, keys, "sensor-02", now); !errors.Is(err, ErrCommandVersion) {
+		t.Errorf("Expected unsupported version to be rejected, got %v", err)
+	}
+	broadcast.Version = CommandSchemaVersion
+	SignCommand(&broadcast, priv)
+	if err := VerifyCommand(&broadcast, keys, "sensor-02", now); err != nil {
+		t.Errorf("Expected broadcast command to be accepted, got %v", err)
+	}
+
+	if _, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub)); err != nil {
+		t.Errorf("ParsePublicKey failed: %v", err)
+	}
+	if _, err := ParsePublicKey("c2hvcnQ="); err == nil {
+		t.Error("Expected short public key to be rejected")
+	}
+}
+
+func TestPackBatches(t *testing.T) {
+	var records []BatchRecord
+	for i := 0; i < 200; i++ {
+		record, err := NewBatchRecord(MessageTypeDevice, map[string]interface{}{
+			"mac":  net.HardwareAddr{0xaa, 0xbb, 0xcc, 0, byte(i >> 8), byte(i)}.String(),
+			"name": strings.Repeat("x", i),
+		})
+		if err != nil {
+			t.Fatalf("NewBatchRecord failed: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	batches, err := PackBatches(SyncDelta, records, 2048)
+	if err != nil {
+		t.Fatalf("PackBatches failed: %v", err)
+	}
+	if len(batches) < 2 {
+		t.Fatalf("Expected records to be split under a 2KB cap, got %d batch", len(batches))
+	}
+
+	var unpacked []BatchRecord
+	for _, batch := range batches {
+		encoded, err := json.Marshal(batch)
+		if err != nil {
+			t.Fatalf("Failed to marshal batch: %v", err)
+		}
+		var decoded BatchMessage
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("Failed to unmarshal batch: %v", err)
+		}
+		if decoded.Sync != SyncDelta || base64.StdEncoding.EncodedLen(len(decoded.Data)) > 2048 {
+			t.Errorf("Unexpected batch: sync %s, %d bytes", decoded.Sync, len(decoded.Data))
+		}
+		got, err := decoded.Records()
+		if err != nil {
+			t.Fatalf("Records failed: %v", err)
+		}
+		if len(got) != decoded.Count {
+			t.Errorf("Expected %d records, got %d", decoded.Count, len(got))
+		}
+		unpacked = append(unpacked, got...)
+	}
+
+	if len(unpacked) != len(records) {
+		t.Fatalf("Expected %d records after unpacking, got %d", len(records), len(unpacked))
+	}
+	for i := range records {
+		if string(unpacked[i].Payload) != string(records[i].Payload) {
+			t.Fatalf("Record %d changed or moved in transit", i)
+		}
+	}
+
+	// Random data does not compress, so one record can exceed the cap alone
+	big := make([]byte, 4096)
+	for i := range big {
+		big[i] = byte(i * 7919 >> 3)
+	}
+	record, _ := NewBatchRecord(MessageTypeProfile, base64.StdEncoding.EncodeToString(big))
+	if _, err := PackBatches(SyncSnapshot, []BatchRecord{record}, 1024); !errors.Is(err, ErrRecordTooLarge) {
+		t.Errorf("Expected ErrRecordTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// WebhookConnector implements CloudConnector for self-hosted collectors.
+// Devices and profiles are wrapped in schemas.CloudMessage envelopes and
+// POSTed in batches to an HTTPS endpoint, signed with HMAC-SHA256.
+type WebhookConnector struct {
+	*cloud.BaseConnector
+	sensorID   string
+	webhookCfg *corecloud.WebhookConfig
+	publisher  *corecloud.WebhookPublisher
+}
+
+// NewWebhookConnector creates a new webhook connector
+func NewWebhookConnector(cfg *config.WebhookConfig, db *database.DatabaseManager) (*WebhookConnector, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("webhook configuration is required")
+	}
+	if err := config.ValidateWebhookURL(cfg.URL); err != nil {
+		return nil, err
+	}
+
+	sensorID := cfg.SensorID
+	if sensorID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("webhook sensor ID is required when the hostname is unavailable: %w", err)
+		}
+		sensorID = hostname
+	}
+
+	return &WebhookConnector{
+		BaseConnector: cloud.NewBaseConnector(db, 5*time.Minute),
+		sensorID:      sensorID,
+		webhookCfg:    corecloud.NewWebhookConfig(cfg),
+	}, nil
+}
+
+// Connect starts the publisher. Collectors have no health check to call, so
+// an unreachable one shows up as failed sends, which stay queued.
+func (w *WebhookConnector) Connect() error {
+	log.Printf("[Webhook] Connecting to %s...", w.webhookCfg.URL)
+
+	publisher, err := corecloud.NewWebhookPublisher(w.webhookCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook publisher: %w", err)
+	}
+
+	w.publisher = publisher
+	w.SetConnected(true)
+	log.Println("[Webhook] Connected")
+
+	// Start transmission loop
+	w.StartTransmissionLoop(w)
+
+	return nil
+}
+
+// Disconnect stops the publisher after sending any batched messages
+func (w *WebhookConnector) Disconnect() error {
+	log.Println("[Webhook] Disconnecting...")
+
+	// Stop transmission loop
+	w.StopTransmissionLoop()
+
+	if w.publisher != nil {
+		w.publisher.Stop()
+	}
+
+	w.SetConnected(false)
+	log.Println("[Webhook] Disconnected")
+
+	return nil
+}
+
+// SendProfile posts a behavioral profile
+func (w *WebhookConnector) SendProfile(profile *database.BehavioralProfile) error {
+	if profile == nil {
+		return fmt.Errorf("profile is nil")
+	}
+
+	msg := w.Anonymizer().AnonymizeProfile(schemas.ProfileToMessage(profile))
+	if err := w.SendMessage(schemas.MessageTypeProfile, msg); err != nil {
+		return err
+	}
+
+	log.Printf("[Webhook] Sent profile for MAC: %s", profile.MAC)
+	return nil
+}
+
+// SendDevice posts device information
+func (w *WebhookConnector) SendDevice(device *database.Device) error {
+	if device == nil {
+		return fmt.Errorf("device is nil")
+	}
+
+	msg := w.Anonymizer().AnonymizeDevice(schemas.DeviceToMessage(device, w.sensorID, "", ""))
+	if err := w.SendMessage(schemas.MessageTypeDevice, msg); err != nil {
+		return err
+	}
+
+	log.Printf("[Webhook] Sent device: %s (%s)", device.MAC, device.IP)
+	return nil
+}
+
+// SendMessage posts any schema message, such as a heartbeat, without
+// queueing it
+func (w *WebhookConnector) SendMessage(messageType schemas.MessageType, payload interface{}) error {
+	data, err := w.envelope(messageType, payload)
+	if err != nil {
+		return err
+	}
+	if err := w.post([][]byte{data}); err != nil {
+		return fmt.Errorf("failed to post %s: %w", messageType, err)
+	}
+	return nil
+}
+
+// SendBatch posts devices and profiles as individual envelopes sharing as
+// few requests as the batch settings allow. The collector sees the same
+// messages as for single sends; request compression is left to the
+// compress setting.
+func (w *WebhookConnector) SendBatch(sync schemas.SyncKind, devices []*database.Device, profiles []*database.BehavioralProfile) error {
+	anonymizer := w.Anonymizer()
+	messages := make([][]byte, 0, len(devices)+len(profiles))
+	for _, device := range devices {
+		data, err := w.envelope(schemas.MessageTypeDevice, anonymizer.AnonymizeDevice(schemas.DeviceToMessage(device, w.sensorID, "", "")))
+		if err != nil {
+			return err
+		}
+		messages = append(messages, data)
+	}
+	for _, profile := range profiles {
+		data, err := w.envelope(schemas.MessageTypeProfile, anonymizer.AnonymizeProfile(schemas.ProfileToMessage(profile)))
+		if err != nil {
+			return err
+		}
+		messages = append(messages, data)
+	}
+
+	if err := w.post(messages); err != nil {
+		return fmt.Errorf("failed to post %s sync: %w", sync, err)
+	}
+
+	log.Printf("[Webhook] Sent %d devices and %d profiles (%s)", len(devices), len(profiles), sync)
+	return nil
+}
+
+// envelope wraps a payload in a serialized CloudMessage
+func (w *WebhookConnector) envelope(messageType schemas.MessageType, payload interface{}) ([]byte, error) {
+	msg, err := schemas.WrapMessage(messageType, w.sensorID, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize %s: %w", messageType, err)
+	}
+	data, err := schemas.SerializeMessage(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize %s: %w", messageType, err)
+	}
+	return data, nil
+}
+
+// post publishes serialized envelopes
+func (w *WebhookConnector) post(messages [][]byte) error {
+	if !w.IsConnected() {
+		return fmt.Errorf("webhook connector is not connected")
+	}
+	return w.publisher.PublishAll(messages)
+}
+
+// Start begins the webhook connector operations
+func (w *WebhookConnector) Start() error {
+	return w.Connect()
+}
+
+// Stop gracefully stops the webhook connector
+func (w *WebhookConnector) Stop() error {
+	return w.Disconnect()
+}
+
+// Name returns the component name
+func (w *WebhookConnector) Name() string {
+	return "Webhook Connector"
+}
@@ -11,6 +11,10 @@
 //   - Interceptor: ARP spoofing enable/disable, spoof interval, target MACs
 //   - Profiler: Persistence interval, max destinations per profile
 //   - API: Host, port, rate limiting
+//   - Recorder: Per-device rolling pcap recording limits
+//   - ThreatIntel: Indicator feeds matched against destinations
+//   - Syslog: Alert forwarding to a SIEM as CEF or LEEF over syslog
+//   - Lifecycle: New-device and dormant-device anomaly rules
 //   - Cloud: Provider selection, AWS IoT and Google Cloud settings
 //   - Logging: Log level and file path
 //
@@ -25,11 +29,20 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// Version is the sensor software version, shown by --version and reported in
+// cloud heartbeats
+const Version = "2.0.0"
+
 // Config represents the complete application configuration
 type Config struct {
 	Database    DatabaseConfig    `json:"database"`
@@ -38,6 +51,10 @@ type Config struct {
 	Interceptor InterceptorConfig `json:"interceptor"`
 	Profiler    ProfilerConfig    `json:"profiler"`
 	API         APIConfig         `json:"api"`
+	Recorder    RecorderConfig    `json:"recorder"`
+	ThreatIntel ThreatIntelConfig `json:"threat_intel"`
+	Syslog      SyslogConfig      `json:"syslog"`
+	Lifecycle   LifecycleConfig   `json:"lifecycle"`
 	Cloud       CloudConfig       `json:"cloud"`
 	Logging     LoggingConfig     `json:"logging"`
 }
@@ -79,14 +96,108 @@ type APIConfig struct {
 	Port               int    `json:"port"`
 	Host               string `json:"host"`
 	RateLimitPerMinute int    `json:"rate_limit_per_minute"`
+
+	Auth AuthConfig `json:"auth"`
+	TLS  TLSConfig  `json:"tls"`
+}
+
+// AuthConfig contains API authentication settings
+type AuthConfig struct {
+	Enabled             bool   `json:"enabled"`
+	SessionHours        int    `json:"session_hours"`         // Dashboard session lifetime (default: 12)
+	InitialPasswordFile string `json:"initial_password_file"` // Generated admin password on first start (default: next to the database)
+	PublicHealth        bool   `json:"public_health"`         // Serve /api/v1/health without authentication
+}
+
+// TLSConfig contains HTTPS settings for the API and dashboard
+type TLSConfig struct {
+	Enabled   bool     `json:"enabled"`
+	CertFile  string   `json:"cert_file,omitempty"` // User-supplied certificate (PEM); a local CA issues one when empty
+	KeyFile   string   `json:"key_file,omitempty"`  // Key for cert_file
+	Directory string   `json:"directory,omitempty"` // Generated CA and certificate (default: "tls" next to the database)
+	Hostnames []string `json:"hostnames,omitempty"` // Extra names or addresses for the generated certificate
+	HSTS      bool     `json:"hsts"`                // Send Strict-Transport-Security
+}
+
+// RecorderConfig contains per-device packet recording settings
+type RecorderConfig struct {
+	Enabled           bool   `json:"enabled"`
+	Directory         string `json:"directory"`
+	MaxFileSizeMB     int    `json:"max_file_size_mb"`
+	MaxFileAgeMinutes int    `json:"max_file_age_minutes"`
+	MaxFilesPerDevice int    `json:"max_files_per_device"`
+}
+
+// ThreatIntelConfig contains threat-intelligence feed settings
+type ThreatIntelConfig struct {
+	Enabled        bool               `json:"enabled"`
+	RefreshMinutes int                `json:"refresh_minutes"` // How often feed files are re-read (0 = load once)
+	Feeds          []ThreatFeedConfig `json:"feeds"`
+}
+
+// ThreatFeedConfig describes a local indicator feed file
+type ThreatFeedConfig struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Format   string `json:"format"`   // "plain", "csv" or "stix" (default: from file extension)
+	Severity string `json:"severity"` // Severity of matches (default: "high")
+}
+
+// SyslogConfig contains settings for forwarding alerts to a SIEM
+type SyslogConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Address      string `json:"address"`                // host:port of the syslog receiver
+	Protocol     string `json:"protocol"`               // "udp", "tcp" or "tls" (default: "udp")
+	Format       string `json:"format"`                 // "cef" or "leef" (default: "cef")
+	CAPath       string `json:"ca_path,omitempty"`      // CA bundle for verifying a TLS receiver
+	Facility     int    `json:"facility,omitempty"`     // Syslog facility (0 = 4, security/authorization)
+	MinSeverity  string `json:"min_severity,omitempty"` // Lowest anomaly severity forwarded (default: "low")
+	DeviceEvents bool   `json:"device_events"`          // Also forward devices joining and going inactive
+}
+
+// LifecycleConfig contains the device lifecycle anomaly rules
+type LifecycleConfig struct {
+	NewDevice     NewDeviceRuleConfig `json:"new_device"`
+	DormantDevice DormantRuleConfig   `json:"dormant_device"`
+}
+
+// NewDeviceRuleConfig controls anomalies for devices joining the network
+type NewDeviceRuleConfig struct {
+	Enabled               bool `json:"enabled"`
+	BusinessHoursStart    int  `json:"business_hours_start"` // Local hour, 0-23
+	BusinessHoursEnd      int  `json:"business_hours_end"`   // Local hour, 0-23
+	BusinessDaysOnly      bool `json:"business_days_only"`   // Weekends count as outside hours
+	LearningPeriodMinutes int  `json:"learning_period_minutes"`
+}
+
+// DormantRuleConfig controls anomalies for always-on devices going dark
+type DormantRuleConfig struct {
+	Enabled      bool     `json:"enabled"`
+	AfterMinutes int      `json:"after_minutes"`
+	DeviceTypes  []string `json:"device_types"` // Classifier types expected to be always on
+	Devices      []string `json:"devices"`      // Additional MAC addresses expected to be always on
 }
 
 // CloudConfig contains cloud connectivity settings
 type CloudConfig struct {
-	Enabled  bool      `json:"enabled"`
-	Provider string    `json:"provider"`
-	AWS      AWSConfig `json:"aws"`
-	GCP      GCPConfig `json:"gcp"`
+	Enabled       bool          `json:"enabled"`
+	Provider      string        `json:"provider"`
+	AWS           AWSConfig     `json:"aws"`
+	GCP           GCPConfig     `json:"gcp"`
+	Webhook       WebhookConfig `json:"webhook"`
+	AnonymizeData bool          `json:"anonymize_data"` // Pseudonymize MACs, IPs and names before upload
+
+	HeartbeatSeconds int  `json:"heartbeat_seconds,omitempty"` // How often a heartbeat is sent (0 = every 60 seconds)
+	SendTelemetry    bool `json:"send_telemetry"`              // Also send capture, queue, database and memory diagnostics
+
+	Commands CommandsConfig `json:"commands"`
+}
+
+// CommandsConfig contains settings for commands sent from the cloud
+type CommandsConfig struct {
+	Enabled    bool     `json:"enabled"`
+	PublicKeys []string `json:"public_keys"`        // Base64 Ed25519 keys of trusted command issuers
+	PollURL    string   `json:"poll_url,omitempty"` // HTTP long-poll endpoint, instead of the provider's channel
 }
 
 // AWSConfig contains AWS IoT Core settings
@@ -95,12 +206,34 @@ type AWSConfig struct {
 	ClientID string `json:"client_id"`
 	CertPath string `json:"cert_path"`
 	KeyPath  string `json:"key_path"`
+	CAPath   string `json:"ca_path,omitempty"` // Optional CA bundle for verifying the endpoint
 }
 
 // GCPConfig contains Google Cloud IoT Core settings
 type GCPConfig struct {
-	ProjectID string `json:"project_id"`
-	TopicID   string `json:"topic_id"`
+	ProjectID       string `json:"project_id"`
+	TopicID         string `json:"topic_id"`
+	CredentialsPath string `json:"credentials_path,omitempty"` // Service account key file
+	EmulatorHost    string `json:"emulator_host,omitempty"`    // host:port of a local Pub/Sub emulator
+	Endpoint        string `json:"endpoint,omitempty"`         // Regional endpoint override
+	SensorID        string `json:"sensor_id,omitempty"`        // Defaults to the hostname
+
+	CommandSubscription string `json:"command_subscription,omitempty"` // Pull subscription delivering commands
+}
+
+// WebhookConfig contains settings for posting to a self-hosted HTTPS collector
+type WebhookConfig struct {
+	URL         string            `json:"url"`
+	Secret      string            `json:"secret,omitempty"`       // HMAC-SHA256 key signing each request body
+	BearerToken string            `json:"bearer_token,omitempty"` // Sent as "Authorization: Bearer <token>"
+	Headers     map[string]string `json:"headers,omitempty"`      // Extra headers added to every request
+	CAPath      string            `json:"ca_path,omitempty"`      // Additional CA bundle for verifying the collector
+	SensorID    string            `json:"sensor_id,omitempty"`    // Defaults to the hostname
+	Compress    bool              `json:"compress"`               // Gzip request bodies
+
+	BatchSize    int `json:"batch_size,omitempty"`     // Messages per request (0 = 50)
+	BatchDelayMs int `json:"batch_delay_ms,omitempty"` // How long a batch waits to fill (0 = 1000)
+	MaxRetries   int `json:"max_retries,omitempty"`    // Retries of a failed request (0 = 3)
 }
 
 // LoggingConfig contains logging settings
@@ -138,6 +271,46 @@ func DefaultConfig() *Config {
 			Port:               8080,
 			Host:               "0.0.0.0",
 			RateLimitPerMinute: 100,
+			Auth: AuthConfig{
+				Enabled:      true,
+				SessionHours: 12,
+				PublicHealth: true,
+			},
+			TLS: TLSConfig{
+				Enabled: true,
+				HSTS:    true,
+			},
+		},
+		Recorder: RecorderConfig{
+			Enabled:           true,
+			Directory:         "/var/lib/heimdal/recordings",
+			MaxFileSizeMB:     10,
+			MaxFileAgeMinutes: 15,
+			MaxFilesPerDevice: 5,
+		},
+		ThreatIntel: ThreatIntelConfig{
+			Enabled:        false,
+			RefreshMinutes: 60,
+			Feeds:          []ThreatFeedConfig{},
+		},
+		Syslog: SyslogConfig{
+			Enabled:  false,
+			Protocol: "udp",
+			Format:   "cef",
+		},
+		Lifecycle: LifecycleConfig{
+			NewDevice: NewDeviceRuleConfig{
+				Enabled:               true,
+				BusinessHoursStart:    8,
+				BusinessHoursEnd:      18,
+				BusinessDaysOnly:      false,
+				LearningPeriodMinutes: 10,
+			},
+			DormantDevice: DormantRuleConfig{
+				Enabled:      true,
+				AfterMinutes: 30,
+				DeviceTypes:  []string{"camera", "iot", "smarthome", "nas", "router"},
+			},
 		},
 		Cloud: CloudConfig{
 			Enabled:  false,
@@ -222,11 +395,110 @@ func (c *Config) Validate() error {
 	if c.API.RateLimitPerMinute < 1 {
 		return fmt.Errorf("rate limit must be at least 1 request per minute")
 	}
+	if c.API.Auth.Enabled && c.API.Auth.SessionHours < 1 {
+		return fmt.Errorf("API session lifetime must be at least 1 hour")
+	}
+	if c.API.TLS.Enabled {
+		if (c.API.TLS.CertFile == "") != (c.API.TLS.KeyFile == "") {
+			return fmt.Errorf("API TLS requires both cert_file and key_file, or neither")
+		}
+		for _, path := range []string{c.API.TLS.CertFile, c.API.TLS.KeyFile} {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				return fmt.Errorf("API TLS file not found: %s", path)
+			}
+		}
+	}
+
+	// Validate recorder configuration if enabled
+	if c.Recorder.Enabled {
+		if c.Recorder.Directory == "" {
+			return fmt.Errorf("recorder directory cannot be empty when recording is enabled")
+		}
+		if c.Recorder.MaxFileSizeMB < 1 {
+			return fmt.Errorf("recorder max file size must be at least 1 MB")
+		}
+		if c.Recorder.MaxFileAgeMinutes < 0 {
+			return fmt.Errorf("recorder max file age cannot be negative")
+		}
+		if c.Recorder.MaxFilesPerDevice < 1 {
+			return fmt.Errorf("recorder must keep at least 1 file per device")
+		}
+	}
+
+	// Validate threat intel configuration if enabled
+	if c.ThreatIntel.Enabled {
+		if c.ThreatIntel.RefreshMinutes < 0 {
+			return fmt.Errorf("threat intel refresh interval cannot be negative")
+		}
+		feedNames := make(map[string]bool)
+		for _, feed := range c.ThreatIntel.Feeds {
+			if feed.Name == "" || feed.Path == "" {
+				return fmt.Errorf("threat intel feeds require a name and a path")
+			}
+			if feedNames[feed.Name] {
+				return fmt.Errorf("duplicate threat intel feed name: %s", feed.Name)
+			}
+			feedNames[feed.Name] = true
+			switch feed.Format {
+			case "", "plain", "csv", "stix":
+			default:
+				return fmt.Errorf("invalid format for threat intel feed %s: %s (must be plain, csv or stix)", feed.Name, feed.Format)
+			}
+			switch feed.Severity {
+			case "", "low", "medium", "high", "critical":
+			default:
+				return fmt.Errorf("invalid severity for threat intel feed %s: %s", feed.Name, feed.Severity)
+			}
+		}
+	}
+
+	if err := c.Syslog.Validate(); err != nil {
+		return err
+	}
+
+	// Validate device lifecycle rules
+	if c.Lifecycle.NewDevice.Enabled {
+		if c.Lifecycle.NewDevice.BusinessHoursStart < 0 || c.Lifecycle.NewDevice.BusinessHoursStart > 23 ||
+			c.Lifecycle.NewDevice.BusinessHoursEnd < 0 || c.Lifecycle.NewDevice.BusinessHoursEnd > 23 {
+			return fmt.Errorf("new device business hours must be between 0 and 23")
+		}
+		if c.Lifecycle.NewDevice.LearningPeriodMinutes < 0 {
+			return fmt.Errorf("new device learning period cannot be negative")
+		}
+	}
+	if c.Lifecycle.DormantDevice.Enabled && c.Lifecycle.DormantDevice.AfterMinutes < 1 {
+		return fmt.Errorf("dormant device threshold must be at least 1 minute")
+	}
 
 	// Validate cloud configuration if enabled
 	if c.Cloud.Enabled {
-		if c.Cloud.Provider != "aws" && c.Cloud.Provider != "gcp" {
-			return fmt.Errorf("cloud provider must be 'aws' or 'gcp'")
+		if c.Cloud.HeartbeatSeconds < 0 {
+			return fmt.Errorf("cloud heartbeat interval cannot be negative")
+		}
+
+		if c.Cloud.Provider != "aws" && c.Cloud.Provider != "gcp" && c.Cloud.Provider != "webhook" {
+			return fmt.Errorf("cloud provider must be 'aws', 'gcp' or 'webhook'")
+		}
+
+		if c.Cloud.Commands.Enabled {
+			if len(c.Cloud.Commands.PublicKeys) == 0 {
+				return fmt.Errorf("cloud commands require at least one public key")
+			}
+			for _, key := range c.Cloud.Commands.PublicKeys {
+				decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+				if err != nil || len(decoded) != ed25519.PublicKeySize {
+					return fmt.Errorf("cloud command public key must be a base64 Ed25519 key: %s", key)
+				}
+			}
+			if c.Cloud.Commands.PollURL == "" && c.Cloud.Provider == "gcp" && c.Cloud.GCP.CommandSubscription == "" {
+				return fmt.Errorf("cloud commands on GCP require a command subscription or a poll URL")
+			}
+			if c.Cloud.Commands.PollURL == "" && c.Cloud.Provider == "webhook" {
+				return fmt.Errorf("cloud commands with the webhook provider require a poll URL")
+			}
 		}
 
 		if c.Cloud.Provider == "aws" {
@@ -249,6 +521,11 @@ func (c *Config) Validate() error {
 			if _, err := os.Stat(c.Cloud.AWS.KeyPath); os.IsNotExist(err) {
 				return fmt.Errorf("AWS key file not found: %s", c.Cloud.AWS.KeyPath)
 			}
+			if c.Cloud.AWS.CAPath != "" {
+				if _, err := os.Stat(c.Cloud.AWS.CAPath); os.IsNotExist(err) {
+					return fmt.Errorf("AWS CA file not found: %s", c.Cloud.AWS.CAPath)
+				}
+			}
 		}
 
 		if c.Cloud.Provider == "gcp" {
@@ -258,6 +535,25 @@ func (c *Config) Validate() error {
 			if c.Cloud.GCP.TopicID == "" {
 				return fmt.Errorf("GCP topic ID cannot be empty when cloud is enabled")
 			}
+			if c.Cloud.GCP.CredentialsPath != "" {
+				if _, err := os.Stat(c.Cloud.GCP.CredentialsPath); os.IsNotExist(err) {
+					return fmt.Errorf("GCP credentials file not found: %s", c.Cloud.GCP.CredentialsPath)
+				}
+			}
+		}
+
+		if c.Cloud.Provider == "webhook" {
+			if err := ValidateWebhookURL(c.Cloud.Webhook.URL); err != nil {
+				return err
+			}
+			if c.Cloud.Webhook.BatchSize < 0 || c.Cloud.Webhook.BatchDelayMs < 0 || c.Cloud.Webhook.MaxRetries < 0 {
+				return fmt.Errorf("webhook batch size, batch delay and retries cannot be negative")
+			}
+			if c.Cloud.Webhook.CAPath != "" {
+				if _, err := os.Stat(c.Cloud.Webhook.CAPath); os.IsNotExist(err) {
+					return fmt.Errorf("webhook CA file not found: %s", c.Cloud.Webhook.CAPath)
+				}
+			}
 		}
 	}
 
@@ -283,3 +579,83 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// ValidateWebhookURL checks a webhook URL is absolute and HTTPS. Plain HTTP
+// is accepted only for loopback hosts, so secrets and bearer tokens never
+// cross the network in clear text.
+func ValidateWebhookURL(rawURL string) error {
+	if rawURL == "" {
+		return fmt.Errorf("webhook URL cannot be empty when cloud is enabled")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("webhook URL must be absolute: %s", rawURL)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+		return fmt.Errorf("webhook URL must use https unless it is loopback: %s", rawURL)
+	default:
+		return fmt.Errorf("webhook URL must use https: %s", rawURL)
+	}
+}
+
+// Validate checks the syslog settings when forwarding is enabled
+func (s *SyslogConfig) Validate() error {
+	if !s.Enabled {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return fmt.Errorf("syslog address must be host:port: %q", s.Address)
+	}
+	switch s.Protocol {
+	case "", "udp", "tcp", "tls":
+	default:
+		return fmt.Errorf("invalid syslog protocol: %s (must be udp, tcp or tls)", s.Protocol)
+	}
+	switch s.Format {
+	case "", "cef", "leef":
+	default:
+		return fmt.Errorf("invalid syslog format: %s (must be cef or leef)", s.Format)
+	}
+	if s.Facility < 0 || s.Facility > 23 {
+		return fmt.Errorf("syslog facility must be between 0 and 23")
+	}
+	switch s.MinSeverity {
+	case "", "low", "medium", "high", "critical":
+	default:
+		return fmt.Errorf("invalid syslog minimum severity: %s", s.MinSeverity)
+	}
+	if s.CAPath != "" {
+		if _, err := os.Stat(s.CAPath); os.IsNotExist(err) {
+			return fmt.Errorf("syslog CA file not found: %s", s.CAPath)
+		}
+	}
+	return nil
+}
+
+// InitialPasswordPath returns the file the generated admin password is written
+// to, defaulting to the directory that holds the database
+func (c *Config) InitialPasswordPath() string {
+	if c.API.Auth.InitialPasswordFile != "" {
+		return c.API.Auth.InitialPasswordFile
+	}
+	return filepath.Join(filepath.Dir(c.Database.Path), "initial-admin-password")
+}
+
+// TLSDirectory returns where the generated CA and server certificate are
+// kept, defaulting to the directory that holds the database
+func (c *Config) TLSDirectory() string {
+	if c.API.TLS.Directory != "" {
+		return c.API.TLS.Directory
+	}
+	return filepath.Join(filepath.Dir(c.Database.Path), "tls")
+}
@@ -154,6 +154,77 @@ func TestValidateConfig(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "webhook to an HTTPS collector",
+			modify: func(c *Config) {
+				c.Cloud.Enabled = true
+				c.Cloud.Provider = "webhook"
+				c.Cloud.Webhook.URL = "https://collector.example.com/ingest"
+			},
+			expectErr: false,
+		},
+		{
+			name: "webhook over plain HTTP to a remote host",
+			modify: func(c *Config) {
+				c.Cloud.Enabled = true
+				c.Cloud.Provider = "webhook"
+				c.Cloud.Webhook.URL = "http://collector.example.com/ingest"
+			},
+			expectErr: true,
+		},
+		{
+			name: "syslog without a port",
+			modify: func(c *Config) {
+				c.Syslog.Enabled = true
+				c.Syslog.Address = "siem.example.com"
+			},
+			expectErr: true,
+		},
+		{
+			name: "syslog LEEF over TLS",
+			modify: func(c *Config) {
+				c.Syslog.Enabled = true
+				c.Syslog.Address = "siem.example.com:6514"
+				c.Syslog.Protocol = "tls"
+				c.Syslog.Format = "leef"
+			},
+			expectErr: false,
+		},
+		{
+			name: "API auth without a session lifetime",
+			modify: func(c *Config) {
+				c.API.Auth.SessionHours = 0
+			},
+			expectErr: true,
+		},
+		{
+			name: "API TLS certificate without a key",
+			modify: func(c *Config) {
+				c.API.TLS.CertFile = "/etc/heimdal/tls/server.crt"
+			},
+			expectErr: true,
+		},
+		{
+			name: "new device business hours out of range",
+			modify: func(c *Config) {
+				c.Lifecycle.NewDevice.BusinessHoursEnd = 24
+			},
+			expectErr: true,
+		},
+		{
+			name: "dormant device threshold below a minute",
+			modify: func(c *Config) {
+				c.Lifecycle.DormantDevice.AfterMinutes = 0
+			},
+			expectErr: true,
+		},
+		{
+			name: "dormant device rule disabled",
+			modify: func(c *Config) {
+				c.Lifecycle.DormantDevice = DormantRuleConfig{}
+			},
+			expectErr: false,
+		},
 	}
 
 	for _, tt := range tests {
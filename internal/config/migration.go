@@ -154,6 +154,11 @@ func MigrateLegacyConfig(legacyPath string) (*Config, *MigrationResult, error) {
 		Logging:  legacy.Logging,
 	}
 
+	// Sections added after the legacy format keep their defaults unless the file sets them
+	if err := applyPostLegacySections(newConfig, data); err != nil {
+		return nil, result, err
+	}
+
 	// Validate the migrated configuration
 	if err := newConfig.Validate(); err != nil {
 		result.MigrationErrors = append(result.MigrationErrors, fmt.Sprintf("Validation error: %v", err))
@@ -167,6 +172,43 @@ func MigrateLegacyConfig(legacyPath string) (*Config, *MigrationResult, error) {
 	return newConfig, result, nil
 }
 
+// applyPostLegacySections fills configuration sections that did not exist in the
+// legacy format with defaults, then overlays any values present in data
+func applyPostLegacySections(cfg *Config, data []byte) error {
+	defaults := DefaultConfig()
+	cfg.Recorder = defaults.Recorder
+	cfg.ThreatIntel = defaults.ThreatIntel
+	cfg.Syslog = defaults.Syslog
+	cfg.Lifecycle = defaults.Lifecycle
+	cfg.API.Auth = defaults.API.Auth
+	cfg.API.TLS = defaults.API.TLS
+
+	// Only the api subsections added after the legacy format are overlaid
+	type apiSections struct {
+		Auth *AuthConfig `json:"auth"`
+		TLS  *TLSConfig  `json:"tls"`
+	}
+	api := apiSections{Auth: &cfg.API.Auth, TLS: &cfg.API.TLS}
+	overlay := struct {
+		API         *apiSections       `json:"api"`
+		Recorder    *RecorderConfig    `json:"recorder"`
+		ThreatIntel *ThreatIntelConfig `json:"threat_intel"`
+		Syslog      *SyslogConfig      `json:"syslog"`
+		Lifecycle   *LifecycleConfig   `json:"lifecycle"`
+	}{
+		API:         &api,
+		Recorder:    &cfg.Recorder,
+		ThreatIntel: &cfg.ThreatIntel,
+		Syslog:      &cfg.Syslog,
+		Lifecycle:   &cfg.Lifecycle,
+	}
+	if err := json.Unmarshal(data, &overlay); err != nil {
+		return fmt.Errorf("failed to parse configuration sections: %w", err)
+	}
+
+	return nil
+}
+
 // MigrateLegacyConfigInPlace migrates a legacy configuration file in place
 func MigrateLegacyConfigInPlace(configPath string) (*MigrationResult, error) {
 	newConfig, result, err := MigrateLegacyConfig(configPath)
@@ -0,0 +1,203 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+)
+
+// Format is the payload format of forwarded alerts
+type Format string
+
+const (
+	// FormatCEF is ArcSight Common Event Format, read by Splunk and most SIEMs
+	FormatCEF Format = "cef"
+	// FormatLEEF is IBM QRadar Log Event Extended Format 2.0
+	FormatLEEF Format = "leef"
+)
+
+// Event categories
+const (
+	CategoryAnomaly = "anomaly"
+	CategoryDevice  = "device"
+)
+
+const (
+	productVendor = "Heimdal"
+	productName   = "Sensor"
+)
+
+// Event is an anomaly or device event ready to be formatted. Device fields
+// are filled from the device inventory when known.
+type Event struct {
+	ID          string             `json:"id"` // Signature ID: the anomaly type or device event
+	Name        string             `json:"name"`
+	Category    string             `json:"category"` // CategoryAnomaly or CategoryDevice
+	Severity    detection.Severity `json:"severity,omitempty"`
+	Time        time.Time          `json:"time"`
+	Description string             `json:"description"`
+
+	DeviceMAC  string                 `json:"device_mac"`
+	DeviceIP   string                 `json:"device_ip,omitempty"`
+	DeviceName string                 `json:"device_name,omitempty"`
+	Vendor     string                 `json:"vendor,omitempty"`
+	DeviceType string                 `json:"device_type,omitempty"`
+	Evidence   map[string]interface{} `json:"evidence,omitempty"`
+}
+
+// cefSeverity maps severities onto the 0-10 CEF and LEEF scale
+func cefSeverity(severity detection.Severity) int {
+	switch severity {
+	case detection.SeverityCritical:
+		return 10
+	case detection.SeverityHigh:
+		return 8
+	case detection.SeverityMedium:
+		return 5
+	case detection.SeverityLow:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// field is one key/value pair of a CEF extension or LEEF attribute list
+type field struct {
+	key   string
+	value string
+}
+
+// fields returns the event's attributes in a stable order, skipping empty
+// values. CEF has no keys for vendor, device type and evidence, so they use
+// its custom string slots with labels.
+func (e *Event) fields(cef bool) []field {
+	evidence := ""
+	if len(e.Evidence) > 0 {
+		// Keys are sorted by encoding/json, which keeps output stable
+		if data, err := json.Marshal(e.Evidence); err == nil {
+			evidence = string(data)
+		}
+	}
+
+	var fs []field
+	add := func(key, value string) {
+		if value != "" {
+			fs = append(fs, field{key, value})
+		}
+	}
+
+	if cef {
+		add("rt", strconv.FormatInt(e.Time.UnixMilli(), 10))
+		add("cat", e.Category)
+		add("smac", e.DeviceMAC)
+		add("src", e.DeviceIP)
+		add("shost", e.DeviceName)
+		add("msg", e.Description)
+		if e.Vendor != "" {
+			add("cs1Label", "vendor")
+			add("cs1", e.Vendor)
+		}
+		if e.DeviceType != "" {
+			add("cs2Label", "deviceType")
+			add("cs2", e.DeviceType)
+		}
+		if e.Category == CategoryAnomaly {
+			add("cs3Label", "anomalyType")
+			add("cs3", e.ID)
+		}
+		if evidence != "" {
+			add("cs4Label", "evidence")
+			add("cs4", evidence)
+		}
+		return fs
+	}
+
+	add("devTime", strconv.FormatInt(e.Time.UnixMilli(), 10))
+	add("devTimeFormat", "epoch")
+	add("cat", e.Category)
+	add("sev", strconv.Itoa(cefSeverity(e.Severity)))
+	add("srcMAC", e.DeviceMAC)
+	add("src", e.DeviceIP)
+	add("identHostName", e.DeviceName)
+	add("vendor", e.Vendor)
+	add("deviceType", e.DeviceType)
+	if e.Category == CategoryAnomaly {
+		add("anomalyType", e.ID)
+	}
+	add("severity", string(e.Severity))
+	add("msg", e.Description)
+	add("evidence", evidence)
+	return fs
+}
+
+// FormatCEF renders the event as a CEF:0 record
+func (e *Event) FormatCEF(version string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeader(productVendor), cefHeader(productName), cefHeader(version),
+		cefHeader(e.ID), cefHeader(e.Name), cefSeverity(e.Severity))
+
+	for i, f := range e.fields(true) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(cefValue(f.value))
+	}
+	return b.String()
+}
+
+// FormatLEEF renders the event as a LEEF:2.0 record with tab-separated
+// attributes
+func (e *Event) FormatLEEF(version string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:2.0|%s|%s|%s|%s|x09|",
+		leefHeader(productVendor), leefHeader(productName), leefHeader(version), leefHeader(e.ID))
+
+	for i, f := range e.fields(false) {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(leefValue(f.value))
+	}
+	return b.String()
+}
+
+// Format renders the event in the given format
+func (e *Event) Format(format Format, version string) string {
+	if format == FormatLEEF {
+		return e.FormatLEEF(version)
+	}
+	return e.FormatCEF(version)
+}
+
+// cefHeader escapes a CEF header field: backslashes and pipes
+func cefHeader(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// cefValue escapes a CEF extension value: backslashes, equals signs and
+// line breaks
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// leefHeader strips the header separator from a LEEF header field, which
+// has no escape sequence
+func leefHeader(s string) string {
+	return strings.NewReplacer("|", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// leefValue strips the attribute delimiter and line breaks from a LEEF value
+func leefValue(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,332 @@
+// Package alerting forwards anomalies and device events to SIEMs as RFC 5424
+// syslog with CEF or LEEF payloads, for both hardware and desktop products.
+package alerting
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// Config contains configuration for the alert forwarder
+type Config struct {
+	Address  string   // host:port of the syslog receiver
+	Protocol Protocol // udp, tcp or tls
+	Format   Format   // cef or leef
+	CAPath   string   // CA bundle verifying a TLS receiver (default: system roots)
+
+	Facility int    // Syslog facility (default 4, security/authorization)
+	Hostname string // Sent in the syslog header (default: the hostname)
+	AppName  string // Sent in the syslog header (default "heimdal")
+	Version  string // Product version in CEF/LEEF headers
+
+	// MinSeverity drops anomalies below this severity
+	MinSeverity detection.Severity
+	// DeviceEvents also forwards devices joining and going inactive
+	DeviceEvents bool
+
+	QueueSize     int           // Events buffered while the receiver is unreachable
+	RetryInterval time.Duration // Wait between reconnection attempts
+	WriteTimeout  time.Duration
+}
+
+// DefaultConfig returns a forwarder configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Protocol:      ProtocolUDP,
+		Format:        FormatCEF,
+		Facility:      4,
+		AppName:       "heimdal",
+		MinSeverity:   detection.SeverityLow,
+		QueueSize:     1000,
+		RetryInterval: 10 * time.Second,
+		WriteTimeout:  5 * time.Second,
+	}
+}
+
+// DeviceLookup returns the inventory entry of a device, or nil when unknown.
+// It enriches anomalies with the device's IP, vendor and type.
+type DeviceLookup func(mac string) *database.Device
+
+// Forwarder ships anomalies and device events to a syslog receiver. Events
+// are queued and sent in the background, so callers never wait on the
+// network; when the receiver is down events wait in the queue, and the
+// newest are dropped once it is full.
+type Forwarder struct {
+	cfg    *Config
+	lookup DeviceLookup
+	writer *syslogWriter
+
+	events  chan *Event
+	dropped atomic.Int64
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	running atomic.Bool
+}
+
+// NewForwarder creates a forwarder. lookup may be nil.
+func NewForwarder(cfg *Config, lookup DeviceLookup) (*Forwarder, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	writer, err := newSyslogWriter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Forwarder{
+		cfg:    cfg,
+		lookup: lookup,
+		writer: writer,
+		events: make(chan *Event, cfg.QueueSize),
+		stopCh: make(chan struct{}),
+	}, nil
+}
+
+// validateConfig checks the configuration and fills in defaults
+func validateConfig(cfg *Config) error {
+	if cfg.Address == "" {
+		return fmt.Errorf("syslog address is required")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return fmt.Errorf("syslog address must be host:port: %w", err)
+	}
+
+	defaults := DefaultConfig()
+	if cfg.Protocol == "" {
+		cfg.Protocol = defaults.Protocol
+	}
+	switch cfg.Protocol {
+	case ProtocolUDP, ProtocolTCP, ProtocolTLS:
+	default:
+		return fmt.Errorf("syslog protocol must be udp, tcp or tls: %s", cfg.Protocol)
+	}
+	if cfg.Format == "" {
+		cfg.Format = defaults.Format
+	}
+	if cfg.Format != FormatCEF && cfg.Format != FormatLEEF {
+		return fmt.Errorf("syslog format must be cef or leef: %s", cfg.Format)
+	}
+	if cfg.Facility < 0 || cfg.Facility > 23 {
+		return fmt.Errorf("syslog facility must be between 0 and 23: %d", cfg.Facility)
+	}
+	if cfg.MinSeverity == "" {
+		cfg.MinSeverity = defaults.MinSeverity
+	}
+	if severityRank(cfg.MinSeverity) == 0 {
+		return fmt.Errorf("invalid minimum severity: %s", cfg.MinSeverity)
+	}
+
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = defaults.AppName
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaults.RetryInterval
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = defaults.WriteTimeout
+	}
+	return nil
+}
+
+// severityRank orders severities; unknown ones rank 0
+func severityRank(severity detection.Severity) int {
+	switch severity {
+	case detection.SeverityLow:
+		return 1
+	case detection.SeverityMedium:
+		return 2
+	case detection.SeverityHigh:
+		return 3
+	case detection.SeverityCritical:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// Start begins sending queued events
+func (f *Forwarder) Start() error {
+	if !f.running.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	f.wg.Add(1)
+	go f.sendLoop()
+
+	log.Printf("[Alerting] Forwarding %s alerts to %s over %s", strings.ToUpper(string(f.cfg.Format)), f.cfg.Address, f.cfg.Protocol)
+	return nil
+}
+
+// Stop stops sending; events still queued are discarded
+func (f *Forwarder) Stop() error {
+	if !f.running.CompareAndSwap(true, false) {
+		return nil
+	}
+
+	close(f.stopCh)
+	f.wg.Wait()
+	f.writer.Close()
+	return nil
+}
+
+// Name returns the component name
+func (f *Forwarder) Name() string {
+	return "Alert Forwarder"
+}
+
+// Dropped returns how many events were discarded because the queue was full
+func (f *Forwarder) Dropped() int64 {
+	return f.dropped.Load()
+}
+
+// Anomaly queues an anomaly unless it is below the minimum severity
+func (f *Forwarder) Anomaly(anomaly *detection.Anomaly) {
+	if anomaly == nil || severityRank(anomaly.Severity) < severityRank(f.cfg.MinSeverity) {
+		return
+	}
+	f.enqueue(NewAnomalyEvent(anomaly, f.lookup))
+}
+
+// Forward queues an event as is, without the severity and device event
+// filters. It is used when notification rules decide what reaches syslog.
+func (f *Forwarder) Forward(event *Event) {
+	if event != nil {
+		f.enqueue(event)
+	}
+}
+
+// NewAnomalyEvent converts an anomaly into an event, enriched with the
+// device's inventory entry when lookup is set and knows the device
+func NewAnomalyEvent(anomaly *detection.Anomaly, lookup DeviceLookup) *Event {
+	event := &Event{
+		ID:          string(anomaly.Type),
+		Name:        anomalyName(anomaly.Type),
+		Category:    CategoryAnomaly,
+		Severity:    anomaly.Severity,
+		Time:        anomaly.Timestamp,
+		Description: anomaly.Description,
+		DeviceMAC:   anomaly.DeviceMAC,
+		Evidence:    anomaly.Evidence,
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if lookup != nil {
+		if device := lookup(anomaly.DeviceMAC); device != nil {
+			fillDevice(event, device)
+		}
+	}
+	return event
+}
+
+// DeviceEvent queues devices joining the network and going inactive, when
+// device events are enabled. Routine sightings are not forwarded.
+func (f *Forwarder) DeviceEvent(event database.DeviceEvent) {
+	if !f.cfg.DeviceEvents {
+		return
+	}
+
+	var id, name string
+	switch event.Type {
+	case database.DeviceEventNew:
+		id, name = "device_new", "New device discovered"
+	case database.DeviceEventInactive:
+		id, name = "device_inactive", "Device went inactive"
+	default:
+		return
+	}
+
+	device := event.Device
+	e := &Event{
+		ID:          id,
+		Name:        name,
+		Category:    CategoryDevice,
+		Time:        event.Time,
+		Description: fmt.Sprintf("%s: %s", name, device.MAC),
+	}
+	fillDevice(e, &device)
+	f.enqueue(e)
+}
+
+// fillDevice copies a device's identifying fields onto an event
+func fillDevice(event *Event, device *database.Device) {
+	event.DeviceMAC = device.MAC
+	event.DeviceIP = device.IP
+	event.DeviceName = device.Name
+	if event.DeviceName == "" {
+		event.DeviceName = device.Hostname
+	}
+	event.Vendor = device.Vendor
+	if event.Vendor == "" {
+		event.Vendor = device.Manufacturer
+	}
+	event.DeviceType = device.DeviceType
+}
+
+// enqueue adds an event to the queue without blocking
+func (f *Forwarder) enqueue(event *Event) {
+	select {
+	case f.events <- event:
+	default:
+		if f.dropped.Add(1)%100 == 1 {
+			log.Printf("[Alerting] Queue full, dropped %d alerts so far", f.dropped.Load())
+		}
+	}
+}
+
+// sendLoop writes queued events, holding on to an event until the receiver
+// accepts it
+func (f *Forwarder) sendLoop() {
+	defer f.wg.Done()
+
+	for {
+		var event *Event
+		select {
+		case event = <-f.events:
+		case <-f.stopCh:
+			return
+		}
+
+		msg := event.Format(f.cfg.Format, f.cfg.Version)
+		for {
+			err := f.writer.write(syslogSeverity(event.Severity), event.Category, event.Time, msg)
+			if err == nil {
+				break
+			}
+			log.Printf("[Alerting] %v; retrying in %v", err, f.cfg.RetryInterval)
+			select {
+			case <-time.After(f.cfg.RetryInterval):
+			case <-f.stopCh:
+				return
+			}
+		}
+	}
+}
+
+// anomalyName returns a readable event name for an anomaly type
+func anomalyName(anomalyType detection.AnomalyType) string {
+	name := strings.ReplaceAll(string(anomalyType), "_", " ")
+	if name == "" {
+		return "Anomaly"
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
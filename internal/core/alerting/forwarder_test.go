@@ -0,0 +1,172 @@
+package alerting
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+func testEvent() *Event {
+	return &Event{
+		ID:          "unusual_port",
+		Name:        "Unusual port",
+		Category:    CategoryAnomaly,
+		Severity:    detection.SeverityHigh,
+		Time:        time.UnixMilli(1700000000123),
+		Description: "Port 4444 a=b|c\nnext",
+		DeviceMAC:   "aa:bb:cc:dd:ee:ff",
+		DeviceIP:    "192.168.1.20",
+		Vendor:      "Acme",
+		DeviceType:  "Camera",
+		Evidence:    map[string]interface{}{"port": 4444},
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	got := testEvent().FormatCEF("2.0.0")
+	want := `CEF:0|Heimdal|Sensor|2.0.0|unusual_port|Unusual port|8|` +
+		`rt=1700000000123 cat=anomaly smac=aa:bb:cc:dd:ee:ff src=192.168.1.20 msg=Port 4444 a\=b|c\nnext ` +
+		`cs1Label=vendor cs1=Acme cs2Label=deviceType cs2=Camera cs3Label=anomalyType cs3=unusual_port ` +
+		`cs4Label=evidence cs4={"port":4444}`
+	if got != want {
+		t.Errorf("Unexpected CEF record:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestFormatLEEF(t *testing.T) {
+	got := testEvent().FormatLEEF("2.0.0")
+	if !strings.HasPrefix(got, "LEEF:2.0|Heimdal|Sensor|2.0.0|unusual_port|x09|") {
+		t.Fatalf("Unexpected LEEF header: %s", got)
+	}
+
+	attrs := make(map[string]string)
+	for _, pair := range strings.Split(strings.SplitN(got, "|x09|", 2)[1], "\t") {
+		key, value, _ := strings.Cut(pair, "=")
+		attrs[key] = value
+	}
+	for key, want := range map[string]string{
+		"sev":         "8",
+		"srcMAC":      "aa:bb:cc:dd:ee:ff",
+		"src":         "192.168.1.20",
+		"vendor":      "Acme",
+		"deviceType":  "Camera",
+		"anomalyType": "unusual_port",
+		"msg":         "Port 4444 a=b|c next",
+		"evidence":    `{"port":4444}`,
+	} {
+		if attrs[key] != want {
+			t.Errorf("Expected %s=%q, got %q", key, want, attrs[key])
+		}
+	}
+}
+
+func TestForwarderSendsOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 4)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			// Octet counting: "<length> <message>"
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(reader, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	cfg := DefaultConfig()
+	cfg.Address = listener.Addr().String()
+	cfg.Protocol = ProtocolTCP
+	cfg.Hostname = "sensor-01"
+	cfg.MinSeverity = detection.SeverityMedium
+	cfg.DeviceEvents = true
+	forwarder, err := NewForwarder(cfg, func(mac string) *database.Device {
+		return &database.Device{MAC: mac, IP: "192.168.1.20", Vendor: "Acme", DeviceType: "Camera"}
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+	if err := forwarder.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer forwarder.Stop()
+
+	forwarder.Anomaly(&detection.Anomaly{DeviceMAC: "aa:bb:cc:dd:ee:ff", Type: detection.AnomalyUnusualPort, Severity: detection.SeverityLow})
+	forwarder.Anomaly(&detection.Anomaly{DeviceMAC: "aa:bb:cc:dd:ee:ff", Type: detection.AnomalyThreatIntelMatch, Severity: detection.SeverityCritical, Description: "Known C2"})
+	forwarder.DeviceEvent(database.DeviceEvent{Type: database.DeviceEventSeen, Device: database.Device{MAC: "11:22:33:44:55:66"}})
+	forwarder.DeviceEvent(database.DeviceEvent{Type: database.DeviceEventNew, Device: database.Device{MAC: "11:22:33:44:55:66", IP: "192.168.1.30"}, Time: time.Now()})
+
+	expect := []string{
+		// Facility 4 (auth) * 8 + severity 2 (critical)
+		"<34>1 ",
+		// Severity 6 (informational)
+		"<38>1 ",
+	}
+	contains := []string{
+		"sensor-01 heimdal ",
+		"CEF:0|Heimdal|Sensor||device_new|New device discovered|1|",
+	}
+	var msgs []string
+	for range expect {
+		select {
+		case msg := <-received:
+			msgs = append(msgs, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Received only %d messages: %v", len(msgs), msgs)
+		}
+	}
+
+	for i, prefix := range expect {
+		if !strings.HasPrefix(msgs[i], prefix) {
+			t.Errorf("Expected message %d to start with %q, got %s", i, prefix, msgs[i])
+		}
+	}
+	if !strings.Contains(msgs[0], contains[0]) || !strings.Contains(msgs[0], "threat_intel_match") || !strings.Contains(msgs[0], "cs1=Acme") {
+		t.Errorf("Expected an enriched threat intel alert, got %s", msgs[0])
+	}
+	if !strings.Contains(msgs[1], contains[1]) || !strings.Contains(msgs[1], "src=192.168.1.30") {
+		t.Errorf("Expected a new device event, got %s", msgs[1])
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("Expected low severity anomalies and sightings to be dropped, got %s", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNewForwarderValidatesConfig(t *testing.T) {
+	for _, cfg := range []*Config{
+		{Address: "localhost"},
+		{Address: "localhost:514", Protocol: "http"},
+		{Address: "localhost:514", Format: "json"},
+		{Address: "localhost:514", MinSeverity: "urgent"},
+	} {
+		if _, err := NewForwarder(cfg, nil); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package alerting
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+)
+
+// Protocol is the syslog transport
+type Protocol string
+
+const (
+	ProtocolUDP Protocol = "udp"
+	ProtocolTCP Protocol = "tcp"
+	ProtocolTLS Protocol = "tls"
+)
+
+// Syslog severities (RFC 5424 section 6.2.1)
+const (
+	syslogCritical      = 2
+	syslogError         = 3
+	syslogWarning       = 4
+	syslogNotice        = 5
+	syslogInformational = 6
+)
+
+// maxUDPMessage keeps datagrams within what receivers must accept over IPv4
+// without fragmentation trouble (RFC 5426 recommends at most 2048 octets)
+const maxUDPMessage = 2048
+
+// syslogSeverity maps an event severity onto a syslog severity. Device
+// events without a severity are informational.
+func syslogSeverity(severity detection.Severity) int {
+	switch severity {
+	case detection.SeverityCritical:
+		return syslogCritical
+	case detection.SeverityHigh:
+		return syslogError
+	case detection.SeverityMedium:
+		return syslogWarning
+	case detection.SeverityLow:
+		return syslogNotice
+	default:
+		return syslogInformational
+	}
+}
+
+// syslogWriter sends RFC 5424 messages to one receiver. Over TCP and TLS
+// messages are framed with octet counting (RFC 6587, RFC 5425).
+type syslogWriter struct {
+	protocol Protocol
+	address  string
+	tls      *tls.Config
+	timeout  time.Duration
+
+	facility int
+	hostname string
+	appName  string
+	procID   string
+
+	conn net.Conn
+}
+
+// newSyslogWriter creates a writer; the connection is made on first write
+func newSyslogWriter(cfg *Config) (*syslogWriter, error) {
+	w := &syslogWriter{
+		protocol: cfg.Protocol,
+		address:  cfg.Address,
+		timeout:  cfg.WriteTimeout,
+		facility: cfg.Facility,
+		hostname: headerField(cfg.Hostname, 255),
+		appName:  headerField(cfg.AppName, 48),
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+
+	if cfg.Protocol == ProtocolTLS {
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog address %s: %w", cfg.Address, err)
+		}
+		w.tls = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if cfg.CAPath != "" {
+			pem, err := os.ReadFile(cfg.CAPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in syslog CA file %s", cfg.CAPath)
+			}
+			w.tls.RootCAs = pool
+		}
+	}
+
+	return w, nil
+}
+
+// format builds an RFC 5424 message with no structured data
+func (w *syslogWriter) format(severity int, msgID string, at time.Time, msg string) []byte {
+	line := fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		w.facility*8+severity,
+		at.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname, w.appName, w.procID, headerField(msgID, 32), msg)
+
+	if w.protocol == ProtocolUDP && len(line) > maxUDPMessage {
+		line = line[:maxUDPMessage]
+	}
+	if w.protocol != ProtocolUDP {
+		line = strconv.Itoa(len(line)) + " " + line
+	}
+	return []byte(line)
+}
+
+// write sends one message, connecting first if needed. A failed write
+// closes the connection so the next write reconnects.
+func (w *syslogWriter) write(severity int, msgID string, at time.Time, msg string) error {
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	if _, err := w.conn.Write(w.format(severity, msgID, at, msg)); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write to syslog receiver %s: %w", w.address, err)
+	}
+	return nil
+}
+
+// connect dials the receiver
+func (w *syslogWriter) connect() error {
+	dialer := &net.Dialer{Timeout: w.timeout}
+
+	var conn net.Conn
+	var err error
+	switch w.protocol {
+	case ProtocolTLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.address, w.tls)
+	case ProtocolTCP:
+		conn, err = dialer.Dial("tcp", w.address)
+	default:
+		conn, err = dialer.Dial("udp", w.address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog receiver %s: %w", w.address, err)
+	}
+	w.conn = conn
+	return nil
+}
+
+// Close closes the connection
+func (w *syslogWriter) Close() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// headerField makes a value fit an RFC 5424 header field: printable ASCII
+// without spaces, at most maxLen characters, "-" when empty
+func headerField(s string, maxLen int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
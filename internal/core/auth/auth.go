@@ -0,0 +1,683 @@
+// Package auth provides local users, API tokens, roles and dashboard sessions
+// for the REST APIs of the hardware sensor and the desktop agent.
+//
+// Passwords are stored as salted PBKDF2-SHA256 hashes; API tokens and session
+// IDs are random and only their SHA-256 digests are stored. Roles are ordered:
+// viewers can read, operators can also change state (recordings, anomaly
+// triage), and admins can also manage users and tokens.
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// Storage key prefixes
+const (
+	UserPrefix    = "auth:user:"
+	TokenPrefix   = "auth:token:"
+	SessionPrefix = "auth:session:"
+)
+
+// tokenPrefix marks Heimdal API tokens, which makes leaked tokens easy to
+// find with secret scanners
+const tokenPrefix = "hmd_"
+
+// Role is a user or token's permission level
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+// ValidRole reports whether r is a known role
+func ValidRole(r Role) bool {
+	return r.rank() > 0
+}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Allows reports whether r grants at least the permissions of required
+func (r Role) Allows(required Role) bool {
+	return r.rank() > 0 && r.rank() >= required.rank()
+}
+
+// Errors returned to API callers
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrNotFound           = errors.New("not found")
+	ErrLastAdmin          = errors.New("the last admin cannot be removed or demoted")
+	ErrTokensDisabled     = errors.New("API tokens are not available")
+)
+
+// User is a local account
+type User struct {
+	Username     string    `json:"username"`
+	Role         Role      `json:"role"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UserInfo is a user without credentials, as returned by the API
+type UserInfo struct {
+	Username  string    `json:"username"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Token is an API token for scripts and integrations
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      Role       `json:"role"`
+	Hash      string     `json:"hash"` // SHA-256 of the secret part
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+// TokenInfo is a token without its hash, as returned by the API
+type TokenInfo struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      Role       `json:"role"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+// Session is a logged-in dashboard session
+type Session struct {
+	Hash      string    `json:"hash"` // SHA-256 of the session cookie
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Config contains configuration for the authentication manager
+type Config struct {
+	SessionTTL time.Duration // Dashboard session lifetime
+	Iterations int           // PBKDF2 iterations for new password hashes
+
+	// TokensAllowed, when set, is consulted before issuing or accepting API
+	// tokens, e.g. to tie them to a license tier
+	TokensAllowed func() error
+
+	// PublicPaths are API paths served without authentication
+	PublicPaths []string
+}
+
+// DefaultConfig returns an authentication configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		SessionTTL: 12 * time.Hour,
+		Iterations: 600000,
+	}
+}
+
+// lastUsedInterval limits how often token use is written to storage
+const lastUsedInterval = 10 * time.Minute
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Manager stores users, tokens and sessions and authenticates requests
+type Manager struct {
+	cfg     *Config
+	storage platform.StorageProvider
+
+	mu       sync.RWMutex
+	users    map[string]*User
+	tokens   map[string]*Token
+	sessions map[string]*Session
+
+	// dummyHash keeps failed logins for unknown users as slow as for known ones
+	dummyHash string
+}
+
+// NewManager creates a manager and loads stored users, tokens and sessions
+func NewManager(storage platform.StorageProvider, cfg *Config) (*Manager, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("storage provider is required")
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	defaults := DefaultConfig()
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = defaults.SessionTTL
+	}
+	if cfg.Iterations <= 0 {
+		cfg.Iterations = defaults.Iterations
+	}
+
+	m := &Manager{
+		cfg:      cfg,
+		storage:  storage,
+		users:    make(map[string]*User),
+		tokens:   make(map[string]*Token),
+		sessions: make(map[string]*Session),
+	}
+	dummy, err := m.hashPassword(randomString(16))
+	if err != nil {
+		return nil, err
+	}
+	m.dummyHash = dummy
+
+	if err := load(storage, UserPrefix, func(u *User) { m.users[u.Username] = u }); err != nil {
+		return nil, err
+	}
+	if err := load(storage, TokenPrefix, func(t *Token) { m.tokens[t.ID] = t }); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := load(storage, SessionPrefix, func(s *Session) {
+		if now.Before(s.ExpiresAt) {
+			m.sessions[s.Hash] = s
+		} else {
+			storage.Delete(SessionPrefix + s.Hash)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// load decodes every stored record under prefix
+func load[T any](storage platform.StorageProvider, prefix string, add func(*T)) error {
+	keys, err := storage.List(prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list %s records: %w", strings.TrimSuffix(prefix, ":"), err)
+	}
+	for _, key := range keys {
+		data, err := storage.Get(key)
+		if err != nil {
+			log.Printf("[Auth] Failed to load %s: %v", key, err)
+			continue
+		}
+		var record T
+		if err := json.Unmarshal(data, &record); err != nil {
+			log.Printf("[Auth] Failed to decode %s: %v", key, err)
+			continue
+		}
+		add(&record)
+	}
+	return nil
+}
+
+// save stores a record as JSON
+func (m *Manager) save(key string, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	if err := m.storage.Set(key, data); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+// Bootstrap creates an "admin" user with a random password when no users
+// exist, and writes the password to passwordFile (readable by the owner
+// only). It reports whether the user was created.
+func (m *Manager) Bootstrap(passwordFile string) (bool, error) {
+	m.mu.RLock()
+	empty := len(m.users) == 0
+	m.mu.RUnlock()
+	if !empty {
+		return false, nil
+	}
+
+	password := randomString(18)
+	if err := os.MkdirAll(filepath.Dir(passwordFile), 0700); err != nil {
+		return false, fmt.Errorf("failed to create directory for the initial password: %w", err)
+	}
+	if err := os.WriteFile(passwordFile, []byte(password+"\n"), 0600); err != nil {
+		return false, fmt.Errorf("failed to write initial admin password: %w", err)
+	}
+	if _, err := m.CreateUser("admin", password, RoleAdmin); err != nil {
+		return false, err
+	}
+
+	log.Printf("[Auth] Created user \"admin\"; the initial password is in %s", passwordFile)
+	return true, nil
+}
+
+// Users returns all users sorted by name
+func (m *Manager) Users() []UserInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]UserInfo, 0, len(m.users))
+	for _, u := range m.users {
+		users = append(users, u.info())
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+func (u *User) info() UserInfo {
+	return UserInfo{Username: u.Username, Role: u.Role, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt}
+}
+
+// CreateUser adds a user
+func (m *Manager) CreateUser(username, password string, role Role) (*UserInfo, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("username must be 1-64 letters, digits, dots, dashes or underscores")
+	}
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("invalid role: %s", role)
+	}
+	hash, err := m.newPasswordHash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.users[username]; exists {
+		return nil, fmt.Errorf("user %s already exists", username)
+	}
+
+	now := time.Now().UTC()
+	user := &User{Username: username, Role: role, PasswordHash: hash, CreatedAt: now, UpdatedAt: now}
+	if err := m.save(UserPrefix+username, user); err != nil {
+		return nil, err
+	}
+	m.users[username] = user
+	info := user.info()
+	return &info, nil
+}
+
+// UpdateUser changes a user's password and/or role; empty values are left
+// unchanged. A password change ends the user's other sessions.
+func (m *Manager) UpdateUser(username, password string, role Role) (*UserInfo, error) {
+	if role != "" && !ValidRole(role) {
+		return nil, fmt.Errorf("invalid role: %s", role)
+	}
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = m.newPasswordHash(password); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if role != "" && role != RoleAdmin && user.Role == RoleAdmin && m.adminCount() == 1 {
+		return nil, ErrLastAdmin
+	}
+
+	updated := *user
+	if hash != "" {
+		updated.PasswordHash = hash
+	}
+	if role != "" {
+		updated.Role = role
+	}
+	updated.UpdatedAt = time.Now().UTC()
+	if err := m.save(UserPrefix+username, &updated); err != nil {
+		return nil, err
+	}
+	m.users[username] = &updated
+	if hash != "" {
+		m.endSessions(username)
+	}
+	info := updated.info()
+	return &info, nil
+}
+
+// DeleteUser removes a user and ends their sessions
+func (m *Manager) DeleteUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.Role == RoleAdmin && m.adminCount() == 1 {
+		return ErrLastAdmin
+	}
+	if err := m.storage.Delete(UserPrefix + username); err != nil {
+		return fmt.Errorf("failed to delete user %s: %w", username, err)
+	}
+	delete(m.users, username)
+	m.endSessions(username)
+	return nil
+}
+
+// adminCount counts admins; the caller holds the lock
+func (m *Manager) adminCount() int {
+	count := 0
+	for _, u := range m.users {
+		if u.Role == RoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+// Login checks a username and password and starts a session. It returns the
+// session ID to set as the cookie value.
+func (m *Manager) Login(username, password string) (string, *Session, error) {
+	m.mu.RLock()
+	user, ok := m.users[username]
+	m.mu.RUnlock()
+
+	if !ok {
+		verifyPassword(m.dummyHash, password)
+		return "", nil, ErrInvalidCredentials
+	}
+	if !verifyPassword(user.PasswordHash, password) {
+		return "", nil, ErrInvalidCredentials
+	}
+
+	id := randomString(32)
+	now := time.Now().UTC()
+	session := &Session{
+		Hash:      digest(id),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.cfg.SessionTTL),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.save(SessionPrefix+session.Hash, session); err != nil {
+		return "", nil, err
+	}
+	m.sessions[session.Hash] = session
+	m.pruneSessions(now)
+	return id, session, nil
+}
+
+// Logout ends the session with the given cookie value
+func (m *Manager) Logout(sessionID string) {
+	hash := digest(sessionID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[hash]; ok {
+		delete(m.sessions, hash)
+		m.storage.Delete(SessionPrefix + hash)
+	}
+}
+
+// endSessions removes every session of a user; the caller holds the lock
+func (m *Manager) endSessions(username string) {
+	for hash, s := range m.sessions {
+		if s.Username == username {
+			delete(m.sessions, hash)
+			m.storage.Delete(SessionPrefix + hash)
+		}
+	}
+}
+
+// pruneSessions removes expired sessions; the caller holds the lock
+func (m *Manager) pruneSessions(now time.Time) {
+	for hash, s := range m.sessions {
+		if !now.Before(s.ExpiresAt) {
+			delete(m.sessions, hash)
+			m.storage.Delete(SessionPrefix + hash)
+		}
+	}
+}
+
+// Tokens returns all API tokens, newest first
+func (m *Manager) Tokens() []TokenInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := make([]TokenInfo, 0, len(m.tokens))
+	for _, t := range m.tokens {
+		tokens = append(tokens, t.info())
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens
+}
+
+func (t *Token) info() TokenInfo {
+	return TokenInfo{
+		ID:        t.ID,
+		Name:      t.Name,
+		Role:      t.Role,
+		CreatedBy: t.CreatedBy,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		LastUsed:  t.LastUsed,
+	}
+}
+
+// IssueToken creates an API token. The returned secret is shown once and
+// cannot be recovered; ttl 0 never expires.
+func (m *Manager) IssueToken(name string, role Role, createdBy string, ttl time.Duration) (string, *TokenInfo, error) {
+	if err := m.tokensAllowed(); err != nil {
+		return "", nil, err
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("token name is required")
+	}
+	if !ValidRole(role) {
+		return "", nil, fmt.Errorf("invalid role: %s", role)
+	}
+
+	id := randomHex(8)
+	secret := randomString(32)
+	now := time.Now().UTC()
+	token := &Token{
+		ID:        id,
+		Name:      name,
+		Role:      role,
+		Hash:      digest(secret),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		token.ExpiresAt = &expires
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.save(TokenPrefix+id, token); err != nil {
+		return "", nil, err
+	}
+	m.tokens[id] = token
+	info := token.info()
+	return tokenPrefix + id + "_" + secret, &info, nil
+}
+
+// RevokeToken deletes an API token
+func (m *Manager) RevokeToken(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[id]; !ok {
+		return ErrNotFound
+	}
+	if err := m.storage.Delete(TokenPrefix + id); err != nil {
+		return fmt.Errorf("failed to revoke token %s: %w", id, err)
+	}
+	delete(m.tokens, id)
+	return nil
+}
+
+// tokensAllowed consults the TokensAllowed hook
+func (m *Manager) tokensAllowed() error {
+	if m.cfg.TokensAllowed == nil {
+		return nil
+	}
+	if err := m.cfg.TokensAllowed(); err != nil {
+		return fmt.Errorf("%w: %v", ErrTokensDisabled, err)
+	}
+	return nil
+}
+
+// Principal is an authenticated user or token
+type Principal struct {
+	Username string `json:"username"`           // User name, or the creator of a token
+	Role     Role   `json:"role"`               // Current role
+	TokenID  string `json:"token_id,omitempty"` // Set when authenticated with an API token
+	session  string // Session cookie value, for logout
+}
+
+// authenticateSession resolves a session cookie value
+func (m *Manager) authenticateSession(id string) *Principal {
+	hash := digest(id)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[hash]
+	if !ok || !time.Now().Before(session.ExpiresAt) {
+		return nil
+	}
+	// Roles are looked up on every request so changes apply immediately
+	user, ok := m.users[session.Username]
+	if !ok {
+		return nil
+	}
+	return &Principal{Username: user.Username, Role: user.Role, session: id}
+}
+
+// authenticateToken resolves an API token
+func (m *Manager) authenticateToken(value string) (*Principal, error) {
+	rest, ok := strings.CutPrefix(value, tokenPrefix)
+	if !ok {
+		return nil, nil
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(digest(secret))) != 1 {
+		return nil, nil
+	}
+	now := time.Now().UTC()
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return nil, nil
+	}
+	if err := m.tokensAllowed(); err != nil {
+		return nil, err
+	}
+
+	if token.LastUsed == nil || now.Sub(*token.LastUsed) > lastUsedInterval {
+		token.LastUsed = &now
+		if err := m.save(TokenPrefix+id, token); err != nil {
+			log.Printf("[Auth] %v", err)
+		}
+	}
+	return &Principal{Username: token.CreatedBy, Role: token.Role, TokenID: id}, nil
+}
+
+// newPasswordHash checks the password policy and hashes the password
+func (m *Manager) newPasswordHash(password string) (string, error) {
+	if len(password) < 8 {
+		return "", fmt.Errorf("password must be at least 8 characters")
+	}
+	return m.hashPassword(password)
+}
+
+// hashPassword derives a salted PBKDF2-SHA256 hash, encoded as
+// "pbkdf2-sha256$iterations$salt$hash"
+func (m *Manager) hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, m.cfg.Iterations, 32)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", m.cfg.Iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword checks a password against a stored hash
+func verifyPassword(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// digest returns the hex SHA-256 of a secret
+func digest(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes, URL-safe base64 encoded
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
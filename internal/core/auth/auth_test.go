@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+func newTestManager(t *testing.T, cfg *Config) (*Manager, *mocks.MockStorageProvider) {
+	t.Helper()
+	storage := mocks.NewMockStorageProvider()
+	if err := storage.Open("", nil); err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	cfg.Iterations = 1000 // Keep tests fast
+	m, err := NewManager(storage, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	return m, storage
+}
+
+// serve runs a request through the middleware and the auth handler, with an
+// "ok" handler behind everything else
+func serve(m *Manager, method, path, body string, setup func(r *http.Request)) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle(AuthPath, m.Handler())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if setup != nil {
+		setup(r)
+	}
+	w := httptest.NewRecorder()
+	m.Middleware(mux).ServeHTTP(w, r)
+	return w
+}
+
+func bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
+
+func TestPasswordLoginAndSessions(t *testing.T) {
+	m, storage := newTestManager(t, nil)
+	if _, err := m.CreateUser("alice", "correct horse", RoleViewer); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if _, _, err := m.Login("alice", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected invalid credentials, got %v", err)
+	}
+	if _, _, err := m.Login("bob", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected invalid credentials for unknown user, got %v", err)
+	}
+
+	w := serve(m, "POST", AuthPath+"login", `{"username":"alice","password":"correct horse"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d: %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != SessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly session cookie, got %v", cookies)
+	}
+	withCookie := func(r *http.Request) { r.AddCookie(cookies[0]) }
+
+	// The password hash and session ID never reach storage in clear text
+	for _, key := range mustList(t, storage, "auth:") {
+		data, _ := storage.Get(key)
+		if strings.Contains(string(data), "correct horse") || strings.Contains(string(data), cookies[0].Value) {
+			t.Errorf("Secret stored in clear text under %s", key)
+		}
+	}
+
+	if w := serve(m, "GET", "/api/v1/devices", "", withCookie); w.Code != http.StatusOK {
+		t.Errorf("Expected viewer to read devices, got %d", w.Code)
+	}
+	if w := serve(m, "POST", "/api/v1/recordings/aa/start", "", withCookie); w.Code != http.StatusForbidden {
+		t.Errorf("Expected viewer to be denied a state change, got %d", w.Code)
+	}
+
+	// Role changes apply to existing sessions
+	if _, err := m.UpdateUser("alice", "", RoleOperator); err != nil {
+		t.Fatalf("Failed to update role: %v", err)
+	}
+	if w := serve(m, "POST", "/api/v1/recordings/aa/start", "", withCookie); w.Code != http.StatusOK {
+		t.Errorf("Expected operator to change state, got %d", w.Code)
+	}
+
+	// Cookie-authenticated state changes must come from the same origin
+	crossSite := func(r *http.Request) {
+		withCookie(r)
+		r.Header.Set("Origin", "http://evil.example")
+	}
+	if w := serve(m, "POST", "/api/v1/recordings/aa/start", "", crossSite); w.Code != http.StatusForbidden {
+		t.Errorf("Expected cross-origin request to be rejected, got %d", w.Code)
+	}
+
+	// Sessions survive a restart
+	reloaded, err := NewManager(storage, &Config{Iterations: 1000})
+	if err != nil {
+		t.Fatalf("Failed to reload manager: %v", err)
+	}
+	if w := serve(reloaded, "GET", "/ws", "", withCookie); w.Code != http.StatusOK {
+		t.Errorf("Expected reloaded session to be valid, got %d", w.Code)
+	}
+
+	if w := serve(m, "POST", AuthPath+"logout", "", withCookie); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected logout to succeed, got %d", w.Code)
+	}
+	if w := serve(m, "GET", "/api/v1/devices", "", withCookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected session to end on logout, got %d", w.Code)
+	}
+}
+
+func TestMiddlewarePublicPaths(t *testing.T) {
+	m, _ := newTestManager(t, &Config{PublicPaths: []string{"/api/v1/health"}})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/", http.StatusOK},
+		{"/app.js", http.StatusOK},
+		{"/api/v1/health", http.StatusOK},
+		{"/api/v1/devices", http.StatusUnauthorized},
+		{"/ws", http.StatusUnauthorized},
+		{AuthPath + "me", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := serve(m, "GET", tt.path, "", nil); w.Code != tt.want {
+			t.Errorf("GET %s: expected %d, got %d", tt.path, tt.want, w.Code)
+		}
+	}
+	if w := serve(m, "GET", "/api/v1/devices", "", bearer("hmd_0000_nope")); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	var licensed = true
+	m, _ := newTestManager(t, &Config{
+		TokensAllowed: func() error {
+			if !licensed {
+				return errors.New("requires the Enterprise tier")
+			}
+			return nil
+		},
+	})
+
+	secret, info, err := m.IssueToken("grafana", RoleViewer, "admin", 0)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if !strings.HasPrefix(secret, "hmd_"+info.ID+"_") {
+		t.Errorf("Unexpected token format: %s", secret)
+	}
+
+	if w := serve(m, "GET", "/api/v1/devices", "", bearer(secret)); w.Code != http.StatusOK {
+		t.Errorf("Expected token to read devices, got %d", w.Code)
+	}
+	if w := serve(m, "GET", "/api/v1/devices", "", bearer(secret+"x")); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected tampered token to be rejected, got %d", w.Code)
+	}
+	if w := serve(m, "GET", AuthPath+"tokens", "", bearer(secret)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected viewer token to be denied token management, got %d", w.Code)
+	}
+
+	// Tokens stop working when the license no longer allows them
+	licensed = false
+	if w := serve(m, "GET", "/api/v1/devices", "", bearer(secret)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected token to be refused without API access, got %d", w.Code)
+	}
+	if _, _, err := m.IssueToken("ci", RoleViewer, "admin", 0); !errors.Is(err, ErrTokensDisabled) {
+		t.Errorf("Expected issuance to be refused, got %v", err)
+	}
+	licensed = true
+
+	if err := m.RevokeToken(info.ID); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if w := serve(m, "GET", "/api/v1/devices", "", bearer(secret)); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be rejected, got %d", w.Code)
+	}
+
+	expiring, _, err := m.IssueToken("short", RoleViewer, "admin", time.Nanosecond)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if w := serve(m, "GET", "/api/v1/devices", "", bearer(expiring)); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected expired token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestUserManagementEndpoints(t *testing.T) {
+	m, _ := newTestManager(t, nil)
+	adminToken, _, err := m.IssueToken("setup", RoleAdmin, "admin", 0)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if _, err := m.CreateUser("admin", "admin password", RoleAdmin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+
+	w := serve(m, "POST", AuthPath+"users", `{"username":"bob","password":"short","role":"viewer"}`, bearer(adminToken))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected short password to be rejected, got %d", w.Code)
+	}
+	w = serve(m, "POST", AuthPath+"users", `{"username":"bob","password":"bob password","role":"viewer"}`, bearer(adminToken))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected user to be created, got %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "pbkdf2") {
+		t.Error("Password hash leaked in API response")
+	}
+
+	// Bob can change his own password but not his role
+	id, _, err := m.Login("bob", "bob password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	asBob := func(r *http.Request) { r.AddCookie(&http.Cookie{Name: SessionCookie, Value: id}) }
+	if w := serve(m, "PUT", AuthPath+"users/bob", `{"role":"admin"}`, asBob); w.Code != http.StatusForbidden {
+		t.Errorf("Expected self-promotion to be denied, got %d", w.Code)
+	}
+	if w := serve(m, "PUT", AuthPath+"users/bob", `{"password":"new bob password"}`, asBob); w.Code != http.StatusOK {
+		t.Errorf("Expected own password change to succeed, got %d: %s", w.Code, w.Body)
+	}
+	if _, _, err := m.Login("bob", "new bob password"); err != nil {
+		t.Errorf("Expected new password to work: %v", err)
+	}
+
+	if w := serve(m, "DELETE", AuthPath+"users/admin", "", bearer(adminToken)); w.Code != http.StatusConflict {
+		t.Errorf("Expected the last admin to be kept, got %d", w.Code)
+	}
+	if w := serve(m, "DELETE", AuthPath+"users/bob", "", bearer(adminToken)); w.Code != http.StatusNoContent {
+		t.Errorf("Expected user to be deleted, got %d", w.Code)
+	}
+	if w := serve(m, "GET", AuthPath+"me", "", asBob); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected deleted user's session to end, got %d", w.Code)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	m, _ := newTestManager(t, nil)
+	path := filepath.Join(t.TempDir(), "initial-admin-password")
+
+	created, err := m.Bootstrap(path)
+	if err != nil || !created {
+		t.Fatalf("Expected admin to be created, got %v (%v)", created, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Password file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected password file mode 0600, got %v", info.Mode().Perm())
+	}
+	password, _ := os.ReadFile(path)
+	if _, _, err := m.Login("admin", strings.TrimSpace(string(password))); err != nil {
+		t.Errorf("Expected bootstrap password to work: %v", err)
+	}
+
+	if created, _ := m.Bootstrap(path); created {
+		t.Error("Expected bootstrap to do nothing once users exist")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://sensor.local:8080", true},
+		{"http://evil.example", false},
+		{"http://sensor.local:9090", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://sensor.local:8080/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := CheckOrigin(r); got != tt.want {
+			t.Errorf("CheckOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func mustList(t *testing.T, storage *mocks.MockStorageProvider, prefix string) []string {
+	t.Helper()
+	keys, err := storage.List(prefix)
+	if err != nil {
+		t.Fatalf("Failed to list keys: %v", err)
+	}
+	return keys
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Handler serves the authentication endpoints under /api/v1/auth/:
+//
+//	POST   /api/v1/auth/login            → Start a dashboard session (public)
+//	POST   /api/v1/auth/logout           → End the current session
+//	GET    /api/v1/auth/me               → Current user or token
+//	GET    /api/v1/auth/users            → List users (admin)
+//	POST   /api/v1/auth/users            → Create a user (admin)
+//	PUT    /api/v1/auth/users/{username} → Change password (self or admin) or role (admin)
+//	DELETE /api/v1/auth/users/{username} → Delete a user (admin)
+//	GET    /api/v1/auth/tokens           → List API tokens (admin)
+//	POST   /api/v1/auth/tokens           → Issue an API token (admin)
+//	DELETE /api/v1/auth/tokens/{id}      → Revoke an API token (admin)
+//
+// It must be wrapped in Middleware.
+func (m *Manager) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+AuthPath+"login", m.handleLogin)
+	mux.HandleFunc("POST "+AuthPath+"logout", m.handleLogout)
+	mux.HandleFunc("GET "+AuthPath+"me", m.handleMe)
+	mux.HandleFunc("GET "+AuthPath+"users", m.requireAdmin(m.handleListUsers))
+	mux.HandleFunc("POST "+AuthPath+"users", m.requireAdmin(m.handleCreateUser))
+	mux.HandleFunc("PUT "+AuthPath+"users/{username}", m.handleUpdateUser)
+	mux.HandleFunc("DELETE "+AuthPath+"users/{username}", m.requireAdmin(m.handleDeleteUser))
+	mux.HandleFunc("GET "+AuthPath+"tokens", m.requireAdmin(m.handleListTokens))
+	mux.HandleFunc("POST "+AuthPath+"tokens", m.requireAdmin(m.handleIssueToken))
+	mux.HandleFunc("DELETE "+AuthPath+"tokens/{id}", m.requireAdmin(m.handleRevokeToken))
+	return mux
+}
+
+// requireAdmin rejects principals without the admin role
+func (m *Manager) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := FromContext(r.Context())
+		if principal == nil || !principal.Role.Allows(RoleAdmin) {
+			writeError(w, http.StatusForbidden, "requires the admin role")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// LoginRequest is the body of a login request
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// UserRequest is the body of a user create or update request
+type UserRequest struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Role     Role   `json:"role,omitempty"`
+}
+
+// TokenRequest is the body of a token request
+type TokenRequest struct {
+	Name           string `json:"name"`
+	Role           Role   `json:"role"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty"` // 0 never expires
+}
+
+// TokenResponse is returned once when a token is issued
+type TokenResponse struct {
+	Token string `json:"token"` // Secret, not retrievable later
+	TokenInfo
+}
+
+func (m *Manager) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	id, session, err := m.Login(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("[Auth] Failed login for %q from %s", req.Username, r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		log.Printf("[Auth] Login failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "login failed")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	writeJSON(w, http.StatusOK, m.authenticateSession(id))
+}
+
+func (m *Manager) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if principal := FromContext(r.Context()); principal != nil && principal.session != "" {
+		m.Logout(principal.session)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Manager) handleMe(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, FromContext(r.Context()))
+}
+
+func (m *Manager) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"users": m.Users()})
+}
+
+func (m *Manager) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req UserRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Role == "" {
+		req.Role = RoleViewer
+	}
+
+	user, err := m.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("[Auth] %s created user %s (%s)", FromContext(r.Context()).Username, user.Username, user.Role)
+	writeJSON(w, http.StatusCreated, user)
+}
+
+func (m *Manager) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	principal := FromContext(r.Context())
+	username := r.PathValue("username")
+
+	var req UserRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	// Anyone may change their own password; everything else needs admin.
+	// Tokens act for their creator but cannot change passwords.
+	self := principal.TokenID == "" && principal.Username == username
+	if !principal.Role.Allows(RoleAdmin) && (!self || req.Role != "") {
+		writeError(w, http.StatusForbidden, "requires the admin role")
+		return
+	}
+
+	user, err := m.UpdateUser(username, req.Password, req.Role)
+	if err != nil {
+		m.writeManagerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (m *Manager) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if err := m.DeleteUser(username); err != nil {
+		m.writeManagerError(w, err)
+		return
+	}
+	log.Printf("[Auth] %s deleted user %s", FromContext(r.Context()).Username, username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Manager) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tokens": m.Tokens()})
+}
+
+func (m *Manager) handleIssueToken(w http.ResponseWriter, r *http.Request) {
+	var req TokenRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Role == "" {
+		req.Role = RoleViewer
+	}
+	if req.ExpiresInHours < 0 {
+		writeError(w, http.StatusBadRequest, "expires_in_hours cannot be negative")
+		return
+	}
+
+	principal := FromContext(r.Context())
+	secret, info, err := m.IssueToken(req.Name, req.Role, principal.Username, time.Duration(req.ExpiresInHours)*time.Hour)
+	if err != nil {
+		m.writeManagerError(w, err)
+		return
+	}
+	log.Printf("[Auth] %s issued token %s (%s, %s)", principal.Username, info.ID, info.Name, info.Role)
+	writeJSON(w, http.StatusCreated, &TokenResponse{Token: secret, TokenInfo: *info})
+}
+
+func (m *Manager) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := m.RevokeToken(id); err != nil {
+		m.writeManagerError(w, err)
+		return
+	}
+	log.Printf("[Auth] %s revoked token %s", FromContext(r.Context()).Username, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeManagerError maps manager errors to HTTP statuses
+func (m *Manager) writeManagerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrLastAdmin):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrTokensDisabled):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// decode reads a JSON request body, answering 400 on failure
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
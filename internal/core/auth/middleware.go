@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SessionCookie is the name of the dashboard session cookie
+const SessionCookie = "heimdal_session"
+
+// AuthPath is the prefix of the authentication endpoints
+const AuthPath = "/api/v1/auth/"
+
+type contextKey struct{}
+
+// FromContext returns the principal of an authenticated request, or nil
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Middleware authenticates API and WebSocket requests. Static dashboard
+// files, the login endpoint and configured public paths are served to
+// anyone. Reads require the viewer role and everything else the operator
+// role; the authentication endpoints check admin rights themselves.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.isPublic(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, viaCookie, err := m.authenticate(r)
+		if err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if principal == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="heimdal"`)
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		// Browsers attach the session cookie to cross-site requests, so
+		// state changes through a cookie must come from the dashboard itself
+		if viaCookie && !safeMethod(r.Method) && !sameOrigin(r) {
+			writeError(w, http.StatusForbidden, "cross-origin request rejected")
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, AuthPath) {
+			required := RoleOperator
+			if safeMethod(r.Method) {
+				required = RoleViewer
+			}
+			if !principal.Role.Allows(required) {
+				writeError(w, http.StatusForbidden, "requires the "+string(required)+" role")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, principal)))
+	})
+}
+
+// isPublic reports whether a request is served without authentication
+func (m *Manager) isPublic(r *http.Request) bool {
+	path := r.URL.Path
+	if r.Method == http.MethodOptions {
+		return true
+	}
+	if path == "/ws" || strings.HasPrefix(path, "/api/") {
+		if path == AuthPath+"login" {
+			return true
+		}
+		for _, public := range m.cfg.PublicPaths {
+			if path == public {
+				return true
+			}
+		}
+		return false
+	}
+	// Dashboard assets; the data they display comes from the API
+	return true
+}
+
+// authenticate resolves the request's bearer token or session cookie. It
+// reports whether the cookie was used.
+func (m *Manager) authenticate(r *http.Request) (*Principal, bool, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, value, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return nil, false, nil
+		}
+		principal, err := m.authenticateToken(strings.TrimSpace(value))
+		return principal, false, err
+	}
+	if cookie, err := r.Cookie(SessionCookie); err == nil && cookie.Value != "" {
+		return m.authenticateSession(cookie.Value), true, nil
+	}
+	return nil, false, nil
+}
+
+// CheckOrigin accepts WebSocket upgrades without an Origin header (non-browser
+// clients) or from the serving host
+func CheckOrigin(r *http.Request) bool {
+	return r.Header.Get("Origin") == "" || sameOrigin(r)
+}
+
+// sameOrigin reports whether the request's Origin, if any, matches its Host
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,526 @@
+// Package certs provides TLS certificates for the sensor's HTTPS servers.
+//
+// By default the Manager creates a local certificate authority on first start
+// and issues a short-lived server certificate from it for the sensor's host
+// names and IP addresses. Both are persisted, and the server certificate is
+// reissued before it expires or when the sensor's addresses change, so
+// browsers that trust the CA once keep trusting the sensor. Alternatively a
+// user-supplied certificate and key are served and reloaded when the files
+// change.
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File names in the certificate directory
+const (
+	CAFile        = "ca.crt"
+	CAKeyFile     = "ca.key"
+	ServerFile    = "server.crt"
+	ServerKeyFile = "server.key"
+)
+
+// Config contains configuration for the certificate manager
+type Config struct {
+	Directory string   // Where the generated CA and server certificate are kept
+	Hostnames []string // Extra DNS names or IP addresses for the server certificate
+
+	// CertFile and KeyFile serve a user-supplied certificate instead of
+	// generated ones
+	CertFile string
+	KeyFile  string
+
+	HSTS          bool          // Send Strict-Transport-Security on HTTPS responses
+	HSTSMaxAge    time.Duration // How long browsers keep using HTTPS after seeing the header
+	CAValidity    time.Duration // Lifetime of a generated CA
+	CertValidity  time.Duration // Lifetime of a generated server certificate
+	RenewBefore   time.Duration // Reissue certificates this long before they expire
+	CheckInterval time.Duration // How often certificates are checked for renewal
+}
+
+// DefaultConfig returns a certificate configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		HSTS:          true,
+		HSTSMaxAge:    365 * 24 * time.Hour,
+		CAValidity:    10 * 365 * 24 * time.Hour,
+		CertValidity:  90 * 24 * time.Hour,
+		RenewBefore:   30 * 24 * time.Hour,
+		CheckInterval: time.Hour,
+	}
+}
+
+// Manager provides the current server certificate and renews it
+type Manager struct {
+	cfg *Config
+
+	mu      sync.RWMutex
+	ca      *x509.Certificate
+	caKey   crypto.Signer
+	caPEM   []byte
+	cert    *tls.Certificate
+	leaf    *x509.Certificate
+	modTime time.Time // Of a user-supplied certificate
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	now    func() time.Time
+}
+
+// NewManager loads or creates the certificates
+func NewManager(cfg *Config) (*Manager, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	defaults := DefaultConfig()
+	if cfg.CAValidity <= 0 {
+		cfg.CAValidity = defaults.CAValidity
+	}
+	if cfg.CertValidity <= 0 {
+		cfg.CertValidity = defaults.CertValidity
+	}
+	if cfg.RenewBefore <= 0 || cfg.RenewBefore >= cfg.CertValidity {
+		cfg.RenewBefore = cfg.CertValidity / 3
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaults.CheckInterval
+	}
+	if cfg.HSTSMaxAge <= 0 {
+		cfg.HSTSMaxAge = defaults.HSTSMaxAge
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("both a certificate and a key file are required")
+	}
+	if cfg.CertFile == "" && cfg.Directory == "" {
+		return nil, fmt.Errorf("certificate directory is required")
+	}
+
+	m := &Manager{
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
+		now:    time.Now,
+	}
+	if err := m.refresh(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Start begins the periodic renewal check
+func (m *Manager) Start() error {
+	m.wg.Add(1)
+	go m.renewLoop()
+	return nil
+}
+
+// Stop ends the renewal check
+func (m *Manager) Stop() error {
+	close(m.stopCh)
+	m.wg.Wait()
+	return nil
+}
+
+// Name returns the component name
+func (m *Manager) Name() string {
+	return "Certificate Manager"
+}
+
+func (m *Manager) renewLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			if err := m.refresh(); err != nil {
+				log.Printf("[Certs] Renewal check failed: %v", err)
+			}
+		}
+	}
+}
+
+// refresh loads a changed user-supplied certificate, or renews generated
+// certificates that are close to expiry or no longer match the host
+func (m *Manager) refresh() error {
+	if m.cfg.CertFile != "" {
+		return m.loadUserCertificate()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ca == nil {
+		if err := m.loadCA(); err != nil {
+			return err
+		}
+	}
+	now := m.now()
+	if !now.Add(m.cfg.RenewBefore).Before(m.ca.NotAfter) {
+		// Browsers that trusted the old CA will warn until the new one is
+		// installed, but an expired CA would be worse
+		log.Printf("[Certs] Local CA expires %s; creating a new one", m.ca.NotAfter.Format(time.RFC3339))
+		if err := m.createCA(); err != nil {
+			return err
+		}
+		m.cert, m.leaf = nil, nil
+	}
+
+	if m.cert == nil {
+		m.loadServerCertificate()
+	}
+	hosts := m.hostnames()
+	if reason := m.renewalReason(now, hosts); reason != "" {
+		log.Printf("[Certs] Issuing server certificate (%s)", reason)
+		return m.issueServerCertificate(now, hosts)
+	}
+	return nil
+}
+
+// loadCA reads the CA from the certificate directory, creating it when missing
+func (m *Manager) loadCA() error {
+	certPEM, certErr := os.ReadFile(filepath.Join(m.cfg.Directory, CAFile))
+	keyPEM, keyErr := os.ReadFile(filepath.Join(m.cfg.Directory, CAKeyFile))
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		log.Printf("[Certs] Creating local CA in %s", m.cfg.Directory)
+		return m.createCA()
+	}
+	if certErr != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", certErr)
+	}
+	if keyErr != nil {
+		return fmt.Errorf("failed to read CA key: %w", keyErr)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid CA certificate or key: %w", err)
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported CA key type")
+	}
+	m.ca = pair.Leaf
+	m.caKey = signer
+	m.caPEM = certPEM
+	return nil
+}
+
+// createCA generates and persists a new CA; the caller holds the lock
+func (m *Manager) createCA() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	now := m.now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"Heimdal"},
+			CommonName:   strings.TrimSpace("Heimdal Local CA " + hostname),
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(m.cfg.CAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := m.writePair(CAFile, certPEM, CAKeyFile, key); err != nil {
+		return err
+	}
+	m.ca = ca
+	m.caKey = key
+	m.caPEM = certPEM
+	return nil
+}
+
+// loadServerCertificate reads a previously issued server certificate; a
+// missing or unreadable one is simply reissued
+func (m *Manager) loadServerCertificate() {
+	pair, err := tls.LoadX509KeyPair(
+		filepath.Join(m.cfg.Directory, ServerFile),
+		filepath.Join(m.cfg.Directory, ServerKeyFile),
+	)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[Certs] Ignoring stored server certificate: %v", err)
+		}
+		return
+	}
+	m.cert = &pair
+	m.leaf = pair.Leaf
+}
+
+// renewalReason explains why the server certificate must be reissued, or
+// returns "" when it is still good
+func (m *Manager) renewalReason(now time.Time, hosts []string) string {
+	if m.leaf == nil {
+		return "none issued yet"
+	}
+	if err := m.leaf.CheckSignatureFrom(m.ca); err != nil {
+		return "not issued by the current CA"
+	}
+	if !now.Add(m.cfg.RenewBefore).Before(m.leaf.NotAfter) {
+		return "expires " + m.leaf.NotAfter.Format(time.RFC3339)
+	}
+	for _, host := range hosts {
+		if m.leaf.VerifyHostname(host) != nil {
+			return "new host name or address " + host
+		}
+	}
+	return ""
+}
+
+// issueServerCertificate issues and persists a server certificate for hosts;
+// the caller holds the lock
+func (m *Manager) issueServerCertificate(now time.Time, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate server key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"Heimdal"},
+			CommonName:   hosts[0],
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(m.cfg.CertValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if template.NotAfter.After(m.ca.NotAfter) {
+		template.NotAfter = m.ca.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, m.ca, &key.PublicKey, m.caKey)
+	if err != nil {
+		return fmt.Errorf("failed to create server certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse server certificate: %w", err)
+	}
+
+	// The stored chain includes the CA, so clients that trust it can verify
+	// the server certificate without fetching anything
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certPEM = append(certPEM, m.caPEM...)
+	if err := m.writePair(ServerFile, certPEM, ServerKeyFile, key); err != nil {
+		return err
+	}
+	m.cert = &tls.Certificate{
+		Certificate: [][]byte{der, m.ca.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	m.leaf = leaf
+	return nil
+}
+
+// writePair persists a certificate and its key, the key readable by the
+// owner only
+func (m *Manager) writePair(certName string, certPEM []byte, keyName string, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.MkdirAll(m.cfg.Directory, 0700); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(m.cfg.Directory, keyName), keyPEM, 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.cfg.Directory, certName), certPEM, 0644)
+}
+
+// loadUserCertificate (re)loads a user-supplied certificate when it changed
+func (m *Manager) loadUserCertificate() error {
+	info, err := os.Stat(m.cfg.CertFile)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cert != nil && info.ModTime().Equal(m.modTime) {
+		return nil
+	}
+	pair, err := tls.LoadX509KeyPair(m.cfg.CertFile, m.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	if m.cert != nil {
+		log.Printf("[Certs] Reloaded %s", m.cfg.CertFile)
+	}
+	m.cert = &pair
+	m.leaf = pair.Leaf
+	m.modTime = info.ModTime()
+	if m.now().After(pair.Leaf.NotAfter) {
+		log.Printf("[Certs] Certificate %s expired on %s", m.cfg.CertFile, pair.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// hostnames returns the names and addresses the server certificate covers
+func (m *Manager) hostnames() []string {
+	hosts := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+		if !strings.Contains(hostname, ".") {
+			hosts = append(hosts, hostname+".local") // mDNS
+		}
+	}
+	hosts = append(hosts, m.cfg.Hostnames...)
+	hosts = append(hosts, "127.0.0.1", "::1")
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			hosts = append(hosts, ipNet.IP.String())
+		}
+	}
+
+	seen := make(map[string]bool, len(hosts))
+	unique := hosts[:0]
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" && !seen[host] {
+			seen[host] = true
+			unique = append(unique, host)
+		}
+	}
+	return unique
+}
+
+// TLSConfig returns a server TLS configuration that always presents the
+// current certificate
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			m.mu.RLock()
+			defer m.mu.RUnlock()
+			return m.cert, nil
+		},
+	}
+}
+
+// Certificate returns the current server certificate
+func (m *Manager) Certificate() *x509.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.leaf
+}
+
+// CACertificate returns the PEM-encoded local CA, or nil when a
+// user-supplied certificate is served
+func (m *Manager) CACertificate() []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return bytes.Clone(m.caPEM)
+}
+
+// HandleCA serves the local CA certificate for installing in browsers and
+// operating system trust stores
+func (m *Manager) HandleCA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ca := m.CACertificate()
+	if ca == nil {
+		http.Error(w, "this sensor uses a user-supplied certificate", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	w.Header().Set("Content-Disposition", `attachment; filename="heimdal-ca.crt"`)
+	w.Write(ca)
+}
+
+// HSTS tells browsers to use HTTPS for the sensor from now on. The header is
+// only sent over HTTPS, as browsers ignore it otherwise.
+func (m *Manager) HSTS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.cfg.HSTS && r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", int64(m.cfg.HSTSMaxAge.Seconds())))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// writeFileAtomic replaces a file so readers never see a partial write
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T, dir string) *Manager {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Directory = dir
+	cfg.Hostnames = []string{"sensor.example", "10.9.8.7"}
+	m, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	return m
+}
+
+func caPool(t *testing.T, m *Manager) *x509.CertPool {
+	t.Helper()
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(m.CACertificate()) {
+		t.Fatal("Failed to parse CA certificate")
+	}
+	return pool
+}
+
+func TestGeneratedCertificates(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir)
+
+	leaf := m.Certificate()
+	for _, host := range []string{"sensor.example", "10.9.8.7", "localhost", "127.0.0.1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: caPool(t, m)}); err != nil {
+			t.Errorf("Certificate does not verify for %s: %v", host, err)
+		}
+	}
+
+	for _, name := range []string{CAKeyFile, ServerKeyFile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Missing %s: %v", name, err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s mode 0600, got %v", name, info.Mode().Perm())
+		}
+	}
+
+	// A restart keeps the CA, so browsers that trust it keep working
+	reloaded := newTestManager(t, dir)
+	if string(reloaded.CACertificate()) != string(m.CACertificate()) {
+		t.Error("Expected the CA to be reused after a restart")
+	}
+	if reloaded.Certificate().SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Error("Expected the server certificate to be reused after a restart")
+	}
+}
+
+func TestRenewalBeforeExpiry(t *testing.T) {
+	m := newTestManager(t, t.TempDir())
+	first := m.Certificate()
+	ca := string(m.CACertificate())
+
+	m.now = func() time.Time { return time.Now().Add(30 * 24 * time.Hour) }
+	if err := m.refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if m.Certificate().SerialNumber.Cmp(first.SerialNumber) != 0 {
+		t.Error("Expected no renewal two months before expiry")
+	}
+
+	m.now = func() time.Time { return time.Now().Add(70 * 24 * time.Hour) }
+	if err := m.refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	renewed := m.Certificate()
+	if renewed.SerialNumber.Cmp(first.SerialNumber) == 0 {
+		t.Fatal("Expected the certificate to be renewed within the renewal window")
+	}
+	if !renewed.NotAfter.After(first.NotAfter) {
+		t.Errorf("Expected a later expiry, got %v (was %v)", renewed.NotAfter, first.NotAfter)
+	}
+	if string(m.CACertificate()) != ca {
+		t.Error("Expected the CA to be kept when renewing the server certificate")
+	}
+}
+
+func TestUserSuppliedCertificate(t *testing.T) {
+	generated := newTestManager(t, t.TempDir())
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	copyFile(t, filepath.Join(generated.cfg.Directory, ServerFile), certFile)
+	copyFile(t, filepath.Join(generated.cfg.Directory, ServerKeyFile), keyFile)
+
+	m, err := NewManager(&Config{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if m.CACertificate() != nil {
+		t.Error("Expected no CA for a user-supplied certificate")
+	}
+	w := httptest.NewRecorder()
+	m.HandleCA(w, httptest.NewRequest("GET", "/api/v1/tls/ca.crt", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the CA download, got %d", w.Code)
+	}
+
+	// A replaced certificate is picked up without a restart
+	other := newTestManager(t, t.TempDir())
+	copyFile(t, filepath.Join(other.cfg.Directory, ServerFile), certFile)
+	copyFile(t, filepath.Join(other.cfg.Directory, ServerKeyFile), keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if err := m.refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if m.Certificate().SerialNumber.Cmp(other.Certificate().SerialNumber) != 0 {
+		t.Error("Expected the replaced certificate to be loaded")
+	}
+
+	if _, err := NewManager(&Config{CertFile: certFile}); err == nil {
+		t.Error("Expected an error for a certificate without a key")
+	}
+}
+
+func TestServeHTTPS(t *testing.T) {
+	m := newTestManager(t, t.TempDir())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/tls/ca.crt", m.HandleCA)
+	server := httptest.NewUnstartedServer(m.HSTS(mux))
+	server.TLS = m.TLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: caPool(t, m), ServerName: "localhost"},
+	}}
+	resp, err := client.Get(server.URL + "/api/v1/tls/ca.crt")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if hsts := resp.Header.Get("Strict-Transport-Security"); hsts != "max-age=31536000" {
+		t.Errorf("Expected a one-year HSTS header, got %q", hsts)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != string(m.CACertificate()) {
+		t.Error("Expected the CA certificate to be served")
+	}
+}
+
+func copyFile(t *testing.T, from, to string) {
+	t.Helper()
+	data, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", from, err)
+	}
+	if err := os.WriteFile(to, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", to, err)
+	}
+}
@@ -0,0 +1,48 @@
+package cloud
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// AnonymizationKeyKey is the storage key of the per-installation secret used
+// to pseudonymize cloud uploads
+const AnonymizationKeyKey = "cloud:anonymization_key"
+
+// LoadAnonymizer returns an anonymizer keyed with this installation's secret,
+// generating and storing a new secret on first use. Pseudonyms stay stable
+// for as long as the secret is kept in storage.
+func LoadAnonymizer(storage platform.StorageProvider) (*schemas.Anonymizer, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("storage provider is required")
+	}
+
+	// Check the key exists before reading it, so a failing read is reported
+	// instead of silently rotating every pseudonym
+	keys, err := storage.List(AnonymizationKeyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up anonymization key: %w", err)
+	}
+	for _, k := range keys {
+		if k != AnonymizationKeyKey {
+			continue
+		}
+		key, err := storage.Get(AnonymizationKeyKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read anonymization key: %w", err)
+		}
+		return schemas.NewAnonymizer(key)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate anonymization key: %w", err)
+	}
+	if err := storage.Set(AnonymizationKeyKey, key); err != nil {
+		return nil, fmt.Errorf("failed to store anonymization key: %w", err)
+	}
+	return schemas.NewAnonymizer(key)
+}
@@ -0,0 +1,32 @@
+package cloud
+
+import "testing"
+
+func TestLoadAnonymizerKeepsKeyAcrossRestarts(t *testing.T) {
+	storage := newQueueStorage(t)
+
+	first, err := LoadAnonymizer(storage)
+	if err != nil {
+		t.Fatalf("LoadAnonymizer failed: %v", err)
+	}
+	key, err := storage.Get(AnonymizationKeyKey)
+	if err != nil || len(key) != 32 {
+		t.Fatalf("Expected a 32-byte key in storage, got %d bytes (%v)", len(key), err)
+	}
+
+	second, err := LoadAnonymizer(storage)
+	if err != nil {
+		t.Fatalf("LoadAnonymizer failed on reload: %v", err)
+	}
+	if first.MAC("aa:bb:cc:dd:ee:ff") != second.MAC("aa:bb:cc:dd:ee:ff") {
+		t.Error("Expected pseudonyms to stay stable across reloads")
+	}
+
+	other, err := LoadAnonymizer(newQueueStorage(t))
+	if err != nil {
+		t.Fatalf("LoadAnonymizer failed: %v", err)
+	}
+	if other.MAC("aa:bb:cc:dd:ee:ff") == first.MAC("aa:bb:cc:dd:ee:ff") {
+		t.Error("Expected each installation to get its own key")
+	}
+}
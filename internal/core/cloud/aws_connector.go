@@ -1,23 +1,23 @@
 package cloud
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 )
 
-// AWSIoTConnector implements Connector for AWS IoT Core
+// AWSIoTConnector implements Connector for AWS IoT Core, publishing
+// schemas.CloudMessage envelopes over an MQTTTransport
 type AWSIoTConnector struct {
 	*BaseConnector
-	endpoint string
-	clientID string
-	certPath string
-	keyPath  string
-	// MQTT client would be initialized here in full implementation
-	// client mqtt.Client
+	endpoint  string
+	clientID  string
+	transport *MQTTTransport
 }
 
 // NewAWSIoTConnector creates a new AWS IoT Core connector
@@ -46,30 +46,36 @@ func NewAWSIoTConnector(cfg *config.AWSConfig) (*AWSIoTConnector, error) {
 		BaseConnector: NewBaseConnector(5 * time.Minute),
 		endpoint:      cfg.Endpoint,
 		clientID:      cfg.ClientID,
-		certPath:      cfg.CertPath,
-		keyPath:       cfg.KeyPath,
 	}
 
+	mqttCfg := DefaultMQTTConfig()
+	mqttCfg.Endpoint = cfg.Endpoint
+	mqttCfg.ClientID = cfg.ClientID
+	mqttCfg.CertPath = cfg.CertPath
+	mqttCfg.KeyPath = cfg.KeyPath
+	mqttCfg.CAPath = cfg.CAPath
+	mqttCfg.OnConnectionChange = connector.SetConnected
+
+	transport, err := NewMQTTTransport(mqttCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MQTT transport: %w", err)
+	}
+	connector.transport = transport
+
 	return connector, nil
 }
 
-// Connect establishes connection to AWS IoT Core
+// Connect establishes connection to AWS IoT Core. An unreachable endpoint is
+// retried in the background rather than failing the connector.
 func (a *AWSIoTConnector) Connect() error {
-	log.Printf("[AWS IoT] Connecting to AWS IoT Core...")
-	log.Printf("[AWS IoT] Endpoint: %s", a.endpoint)
-	log.Printf("[AWS IoT] Client ID: %s", a.clientID)
-	log.Printf("[AWS IoT] Certificate: %s", a.certPath)
-	log.Printf("[AWS IoT] Key: %s", a.keyPath)
-
-	// STUB: In a full implementation, this would:
-	// 1. Load TLS certificates from certPath and keyPath
-	// 2. Create MQTT client options with broker URL, client ID, TLS config
-	// 3. Connect to AWS IoT Core
-	// 4. Subscribe to relevant topics
-
-	// For stub purposes, simulate successful connection
-	log.Println("[AWS IoT] STUB: Simulating successful connection")
-	a.SetConnected(true)
+	log.Printf("[AWS IoT] Connecting to %s as %s...", a.endpoint, a.clientID)
+
+	if err := a.transport.Connect(); err != nil {
+		if !errors.Is(err, ErrMQTTConnectPending) {
+			return err
+		}
+		log.Printf("[AWS IoT] %v", err)
+	}
 
 	// Start transmission loop
 	a.StartTransmissionLoop(a)
@@ -84,10 +90,8 @@ func (a *AWSIoTConnector) Disconnect() error {
 	// Stop transmission loop
 	a.StopTransmissionLoop()
 
-	// STUB: In a full implementation, disconnect MQTT client
-
-	a.SetConnected(false)
-	log.Println("[AWS IoT] STUB: Disconnected")
+	a.transport.Disconnect()
+	log.Println("[AWS IoT] Disconnected")
 
 	return nil
 }
@@ -98,31 +102,11 @@ func (a *AWSIoTConnector) SendProfile(profile *database.BehavioralProfile, devic
 		return fmt.Errorf("profile is nil")
 	}
 
-	if !a.IsConnected() {
-		return fmt.Errorf("not connected to AWS IoT Core")
+	if err := a.publish(schemas.MessageTypeProfile, a.Anonymizer().AnonymizeProfile(schemas.ProfileToMessage(profile)), deviceType); err != nil {
+		return err
 	}
 
-	// Create ProfileData with device type metadata
-	profileData := &ProfileData{
-		Profile:    profile,
-		DeviceType: deviceType,
-		Timestamp:  time.Now(),
-	}
-
-	// Serialize profile data to JSON
-	data, err := SerializeProfileData(profileData)
-	if err != nil {
-		return fmt.Errorf("failed to serialize profile data: %w", err)
-	}
-
-	log.Printf("[AWS IoT] Sending profile for MAC: %s (device type: %s)", profile.MAC, deviceType)
-	log.Printf("[AWS IoT] Profile data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, publish to MQTT topic
-	// topic := fmt.Sprintf("heimdal/sensor/%s/profile", a.clientID)
-	// token := a.client.Publish(topic, 1, false, data)
-
-	log.Printf("[AWS IoT] STUB: Successfully sent profile for MAC: %s", profile.MAC)
+	log.Printf("[AWS IoT] Sent profile for MAC: %s (device type: %s)", profile.MAC, deviceType)
 	return nil
 }
 
@@ -132,31 +116,11 @@ func (a *AWSIoTConnector) SendDevice(device *database.Device, deviceType DeviceT
 		return fmt.Errorf("device is nil")
 	}
 
-	if !a.IsConnected() {
-		return fmt.Errorf("not connected to AWS IoT Core")
-	}
-
-	// Create DeviceData with device type metadata
-	deviceData := &DeviceData{
-		Device:     device,
-		DeviceType: deviceType,
-		Timestamp:  time.Now(),
+	if err := a.publish(schemas.MessageTypeDevice, a.Anonymizer().AnonymizeDevice(schemas.DeviceToMessage(device, a.clientID, "", "")), deviceType); err != nil {
+		return err
 	}
 
-	// Serialize device data to JSON
-	data, err := SerializeDeviceData(deviceData)
-	if err != nil {
-		return fmt.Errorf("failed to serialize device data: %w", err)
-	}
-
-	log.Printf("[AWS IoT] Sending device: %s (%s) (device type: %s)", device.MAC, device.IP, deviceType)
-	log.Printf("[AWS IoT] Device data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, publish to MQTT topic
-	// topic := fmt.Sprintf("heimdal/sensor/%s/device", a.clientID)
-	// token := a.client.Publish(topic, 1, false, data)
-
-	log.Printf("[AWS IoT] STUB: Successfully sent device: %s", device.MAC)
+	log.Printf("[AWS IoT] Sent device: %s (%s) (device type: %s)", device.MAC, device.IP, deviceType)
 	return nil
 }
 
@@ -166,24 +130,37 @@ func (a *AWSIoTConnector) SendAnomaly(anomaly *AnomalyData, deviceType DeviceTyp
 		return fmt.Errorf("anomaly is nil")
 	}
 
+	msg := &schemas.AnomalyMessage{
+		DeviceMAC:   anomaly.DeviceMAC,
+		Type:        anomaly.Type,
+		Severity:    anomaly.Severity,
+		Description: anomaly.Description,
+		Timestamp:   anomaly.Timestamp,
+		Evidence:    anomaly.Evidence,
+	}
+	if err := a.publish(schemas.MessageTypeAnomaly, a.Anonymizer().AnonymizeAnomaly(msg), deviceType); err != nil {
+		return err
+	}
+
+	log.Printf("[AWS IoT] Sent anomaly: %s (device type: %s)", anomaly.Type, deviceType)
+	return nil
+}
+
+// publish wraps a payload in an envelope and publishes it to the sensor's topic
+func (a *AWSIoTConnector) publish(messageType schemas.MessageType, payload interface{}, deviceType DeviceType) error {
 	if !a.IsConnected() {
 		return fmt.Errorf("not connected to AWS IoT Core")
 	}
 
-	// Serialize anomaly data to JSON
-	data, err := SerializeAnomalyData(anomaly)
+	msg, err := schemas.WrapMessage(messageType, a.clientID, payload)
 	if err != nil {
-		return fmt.Errorf("failed to serialize anomaly data: %w", err)
+		return fmt.Errorf("failed to serialize %s: %w", messageType, err)
 	}
+	msg.SensorType = string(deviceType)
 
-	log.Printf("[AWS IoT] Sending anomaly: %s (device type: %s)", anomaly.Type, deviceType)
-	log.Printf("[AWS IoT] Anomaly data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, publish to MQTT topic
-	// topic := fmt.Sprintf("heimdal/sensor/%s/anomaly", a.clientID)
-	// token := a.client.Publish(topic, 1, false, data)
-
-	log.Printf("[AWS IoT] STUB: Successfully sent anomaly: %s", anomaly.Type)
+	if err := a.transport.Publish(msg); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", messageType, err)
+	}
 	return nil
 }
 
@@ -13,7 +13,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
 )
 
 // DeviceType distinguishes hardware vs desktop deployments
@@ -71,6 +73,7 @@ type DeviceData struct {
 
 // TransmissionItem represents an item in the transmission queue
 type TransmissionItem struct {
+	ID         uint64      // Queue item ID
 	Type       string      // "profile", "device", or "anomaly"
 	Data       interface{} // *ProfileData, *DeviceData, or *AnomalyData
 	DeviceType DeviceType
@@ -82,9 +85,9 @@ type TransmissionItem struct {
 type BaseConnector struct {
 	connected        bool
 	mu               sync.RWMutex
-	queue            []*TransmissionItem
-	queueMu          sync.Mutex
-	maxQueueSize     int
+	queue            *Queue
+	queueMu          sync.RWMutex // Guards replacing the queue
+	anonymizer       *schemas.Anonymizer
 	maxRetries       int
 	retryDelay       time.Duration
 	ctx              context.Context
@@ -94,7 +97,8 @@ type BaseConnector struct {
 	transmitInterval time.Duration
 }
 
-// NewBaseConnector creates a new base connector with common functionality
+// NewBaseConnector creates a new base connector with common functionality.
+// The transmission queue is kept in memory until SetQueueStorage is called.
 func NewBaseConnector(transmitInterval time.Duration) *BaseConnector {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -102,10 +106,12 @@ func NewBaseConnector(transmitInterval time.Duration) *BaseConnector {
 		transmitInterval = 5 * time.Minute // Default to 5 minutes
 	}
 
+	// A memory-only queue cannot survive an outage long enough to need more
+	queue, _ := NewQueue(nil, &QueueConfig{MaxItems: 100, MaxDeadLetters: 100})
+
 	return &BaseConnector{
 		connected:        false,
-		queue:            make([]*TransmissionItem, 0),
-		maxQueueSize:     100,
+		queue:            queue,
 		maxRetries:       3,
 		retryDelay:       time.Second,
 		ctx:              ctx,
@@ -114,6 +120,47 @@ func NewBaseConnector(transmitInterval time.Duration) *BaseConnector {
 	}
 }
 
+// SetQueueStorage makes the transmission queue durable: queued items and dead
+// letters are kept in storage, and those left by a previous run are restored.
+// Items already queued in memory are carried over. Call before Connect.
+func (bc *BaseConnector) SetQueueStorage(storage platform.StorageProvider, cfg *QueueConfig) error {
+	if storage == nil {
+		return fmt.Errorf("storage provider is required")
+	}
+	queue, err := NewQueue(storage, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open transmission queue: %w", err)
+	}
+
+	bc.queueMu.Lock()
+	defer bc.queueMu.Unlock()
+
+	for item := bc.queue.Peek(); item != nil; item = bc.queue.Peek() {
+		if err := queue.Push(item.Type, item.DeviceType, item.Payload); err != nil {
+			log.Printf("[CloudConnector] Failed to carry over queued %s: %v", item.Type, err)
+		}
+		bc.queue.Remove(item.ID)
+	}
+	bc.queue = queue
+	return nil
+}
+
+// SetAnonymizer makes the connector pseudonymize identifying fields before
+// upload. A nil anonymizer sends data as-is.
+func (bc *BaseConnector) SetAnonymizer(anonymizer *schemas.Anonymizer) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.anonymizer = anonymizer
+}
+
+// Anonymizer returns the connector's anonymizer, or nil when uploads are not
+// anonymized
+func (bc *BaseConnector) Anonymizer() *schemas.Anonymizer {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.anonymizer
+}
+
 // SetConnected updates the connection status
 func (bc *BaseConnector) SetConnected(connected bool) {
 	bc.mu.Lock()
@@ -153,67 +200,89 @@ func (bc *BaseConnector) EnqueueAnomaly(anomaly *AnomalyData, deviceType DeviceT
 	return bc.enqueue("anomaly", anomaly, deviceType)
 }
 
-// enqueue adds an item to the transmission queue
+// enqueue adds an item to the transmission queue; when the queue is full
+// the oldest item is evicted
 func (bc *BaseConnector) enqueue(itemType string, data interface{}, deviceType DeviceType) error {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
-
-	// Check if queue is full
-	if len(bc.queue) >= bc.maxQueueSize {
-		// Remove oldest item to make room
-		log.Printf("[CloudConnector] Queue full, dropping oldest item")
-		bc.queue = bc.queue[1:]
-	}
-
-	item := &TransmissionItem{
-		Type:       itemType,
-		Data:       data,
-		DeviceType: deviceType,
-		Timestamp:  time.Now(),
-		Retries:    0,
-	}
+	return bc.currentQueue().Push(itemType, deviceType, data)
+}
 
-	bc.queue = append(bc.queue, item)
-	return nil
+// currentQueue returns the transmission queue
+func (bc *BaseConnector) currentQueue() *Queue {
+	bc.queueMu.RLock()
+	defer bc.queueMu.RUnlock()
+	return bc.queue
 }
 
-// DequeueNext returns the next item from the queue without removing it
+// DequeueNext returns the next item from the queue without removing it.
+// Items whose payload can no longer be decoded are moved to the dead-letter
+// area and skipped.
 func (bc *BaseConnector) DequeueNext() *TransmissionItem {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
+	queue := bc.currentQueue()
+	for {
+		item := queue.Peek()
+		if item == nil {
+			return nil
+		}
 
-	if len(bc.queue) == 0 {
-		return nil
-	}
+		var data interface{}
+		switch item.Type {
+		case "profile":
+			data = &ProfileData{}
+		case "device":
+			data = &DeviceData{}
+		case "anomaly":
+			data = &AnomalyData{}
+		default:
+			log.Printf("[CloudConnector] Unknown item type: %s", item.Type)
+			queue.DeadLetter(item.ID, "unknown item type")
+			continue
+		}
+		if err := json.Unmarshal(item.Payload, data); err != nil {
+			log.Printf("[CloudConnector] Invalid %s data: %v", item.Type, err)
+			queue.DeadLetter(item.ID, fmt.Sprintf("invalid payload: %v", err))
+			continue
+		}
 
-	return bc.queue[0]
+		return &TransmissionItem{
+			ID:         item.ID,
+			Type:       item.Type,
+			Data:       data,
+			DeviceType: item.DeviceType,
+			Timestamp:  item.Enqueued,
+			Retries:    item.Retries,
+		}
+	}
 }
 
 // RemoveFromQueue removes the first item from the queue
 func (bc *BaseConnector) RemoveFromQueue() {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
-
-	if len(bc.queue) > 0 {
-		bc.queue = bc.queue[1:]
+	queue := bc.currentQueue()
+	if item := queue.Peek(); item != nil {
+		queue.Remove(item.ID)
 	}
 }
 
 // IncrementRetries increments the retry count for the first item in the queue
 func (bc *BaseConnector) IncrementRetries() {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
-
-	if len(bc.queue) > 0 {
-		bc.queue[0].Retries++
+	queue := bc.currentQueue()
+	if item := queue.Peek(); item != nil {
+		queue.MarkFailed(item.ID, nil)
 	}
 }
 
 // GetQueueSize returns the current queue size
 func (bc *BaseConnector) GetQueueSize() int {
-	bc.queueMu.Lock()
-	defer bc.queueMu.Unlock()
-	return len(bc.queue)
+	return bc.currentQueue().Len()
+}
+
+// QueueStats returns the depth, age and dead-letter count of the transmission queue
+func (bc *BaseConnector) QueueStats() QueueStats {
+	return bc.currentQueue().Stats()
+}
+
+// DeadLetters returns the items that exceeded the maximum retries
+func (bc *BaseConnector) DeadLetters() []*QueueItem {
+	return bc.currentQueue().DeadLetters()
 }
 
 // StartTransmissionLoop starts the periodic transmission goroutine
@@ -292,21 +361,29 @@ func (bc *BaseConnector) processQueue(connector Connector) {
 
 		if err != nil {
 			log.Printf("[CloudConnector] Failed to transmit %s: %v", item.Type, err)
-			bc.IncrementRetries()
+
+			// A lost connection is not the item's fault; keep it queued
+			// without using up its retries until the connection is back
+			if !connector.IsConnected() {
+				log.Printf("[CloudConnector] Connection lost, %d items remain queued", bc.GetQueueSize())
+				return
+			}
+
+			retries := bc.currentQueue().MarkFailed(item.ID, err)
 
 			// Check if max retries exceeded
-			if item.Retries >= bc.maxRetries {
-				log.Printf("[CloudConnector] Max retries exceeded for %s, dropping item", item.Type)
-				bc.RemoveFromQueue()
+			if retries >= bc.maxRetries {
+				log.Printf("[CloudConnector] Max retries exceeded for %s, moving to dead letters", item.Type)
+				bc.currentQueue().DeadLetter(item.ID, "")
 			} else {
 				// Exponential backoff
-				backoff := bc.retryDelay * time.Duration(1<<uint(item.Retries))
-				log.Printf("[CloudConnector] Will retry in %v (attempt %d/%d)", backoff, item.Retries+1, bc.maxRetries)
+				backoff := bc.retryDelay * time.Duration(1<<uint(retries))
+				log.Printf("[CloudConnector] Will retry in %v (attempt %d/%d)", backoff, retries+1, bc.maxRetries)
 				time.Sleep(backoff)
 			}
 		} else {
 			log.Printf("[CloudConnector] Successfully transmitted %s", item.Type)
-			bc.RemoveFromQueue()
+			bc.currentQueue().Remove(item.ID)
 		}
 	}
 }
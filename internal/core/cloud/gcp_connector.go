@@ -1,22 +1,26 @@
 package cloud
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 )
 
-// GoogleCloudConnector implements Connector for Google Cloud Pub/Sub
+// GoogleCloudConnector implements Connector for Google Cloud Pub/Sub,
+// publishing schemas.CloudMessage envelopes through a PubSubPublisher
 type GoogleCloudConnector struct {
 	*BaseConnector
 	projectID string
 	topicID   string
-	// Pub/Sub client would be initialized here in full implementation
-	// client *pubsub.Client
-	// topic  *pubsub.Topic
+	sensorID  string
+	pubsubCfg *PubSubConfig
+	publisher *PubSubPublisher
 }
 
 // NewGoogleCloudConnector creates a new Google Cloud Pub/Sub connector
@@ -33,10 +37,33 @@ func NewGoogleCloudConnector(cfg *config.GCPConfig) (*GoogleCloudConnector, erro
 		return nil, fmt.Errorf("GCP topic ID is required")
 	}
 
+	sensorID := cfg.SensorID
+	if sensorID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("GCP sensor ID is required when the hostname is unavailable: %w", err)
+		}
+		sensorID = hostname
+	}
+
+	pubsubCfg := DefaultPubSubConfig()
+	pubsubCfg.ProjectID = cfg.ProjectID
+	pubsubCfg.TopicID = cfg.TopicID
+	pubsubCfg.CredentialsPath = cfg.CredentialsPath
+	pubsubCfg.EmulatorHost = cfg.EmulatorHost
+	if cfg.Endpoint != "" {
+		pubsubCfg.Endpoint = cfg.Endpoint
+	}
+	// One ordering key per sensor keeps each sensor's messages in order
+	// without serializing the whole topic
+	pubsubCfg.OrderingKey = sensorID
+
 	connector := &GoogleCloudConnector{
 		BaseConnector: NewBaseConnector(5 * time.Minute),
 		projectID:     cfg.ProjectID,
 		topicID:       cfg.TopicID,
+		sensorID:      sensorID,
+		pubsubCfg:     pubsubCfg,
 	}
 
 	return connector, nil
@@ -44,18 +71,23 @@ func NewGoogleCloudConnector(cfg *config.GCPConfig) (*GoogleCloudConnector, erro
 
 // Connect establishes connection to Google Cloud Pub/Sub
 func (g *GoogleCloudConnector) Connect() error {
-	log.Printf("[Google Cloud] Connecting to Google Cloud Pub/Sub...")
-	log.Printf("[Google Cloud] Project ID: %s", g.projectID)
-	log.Printf("[Google Cloud] Topic ID: %s", g.topicID)
+	log.Printf("[Google Cloud] Connecting to Pub/Sub topic %s in project %s...", g.topicID, g.projectID)
 
-	// STUB: In a full implementation, this would:
-	// 1. Create Pub/Sub client with project ID
-	// 2. Get or create the topic
-	// 3. Configure topic settings
+	publisher, err := NewPubSubPublisher(g.pubsubCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create Pub/Sub publisher: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.pubsubCfg.RequestTimeout)
+	defer cancel()
+	if err := publisher.CheckTopic(ctx); err != nil {
+		publisher.Stop()
+		return fmt.Errorf("failed to connect to Pub/Sub: %w", err)
+	}
 
-	// For stub purposes, simulate successful connection
-	log.Println("[Google Cloud] STUB: Simulating successful connection")
+	g.publisher = publisher
 	g.SetConnected(true)
+	log.Println("[Google Cloud] Connected")
 
 	// Start transmission loop
 	g.StartTransmissionLoop(g)
@@ -70,10 +102,12 @@ func (g *GoogleCloudConnector) Disconnect() error {
 	// Stop transmission loop
 	g.StopTransmissionLoop()
 
-	// STUB: In a full implementation, stop topic and close client
+	if g.publisher != nil {
+		g.publisher.Stop()
+	}
 
 	g.SetConnected(false)
-	log.Println("[Google Cloud] STUB: Disconnected")
+	log.Println("[Google Cloud] Disconnected")
 
 	return nil
 }
@@ -84,38 +118,13 @@ func (g *GoogleCloudConnector) SendProfile(profile *database.BehavioralProfile,
 		return fmt.Errorf("profile is nil")
 	}
 
-	if !g.IsConnected() {
-		return fmt.Errorf("not connected to Google Cloud Pub/Sub")
+	msg := g.Anonymizer().AnonymizeProfile(schemas.ProfileToMessage(profile))
+	attributes := map[string]string{"mac_address": msg.MAC}
+	if err := g.publish(schemas.MessageTypeProfile, msg, deviceType, attributes); err != nil {
+		return err
 	}
 
-	// Create ProfileData with device type metadata
-	profileData := &ProfileData{
-		Profile:    profile,
-		DeviceType: deviceType,
-		Timestamp:  time.Now(),
-	}
-
-	// Serialize profile data to JSON
-	data, err := SerializeProfileData(profileData)
-	if err != nil {
-		return fmt.Errorf("failed to serialize profile data: %w", err)
-	}
-
-	log.Printf("[Google Cloud] Sending profile for MAC: %s (device type: %s)", profile.MAC, deviceType)
-	log.Printf("[Google Cloud] Profile data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, publish to Pub/Sub topic
-	// msg := &pubsub.Message{
-	//     Data: data,
-	//     Attributes: map[string]string{
-	//         "message_type": "profile",
-	//         "device_type":  string(deviceType),
-	//         "mac_address":  profile.MAC,
-	//     },
-	// }
-	// result := g.topic.Publish(ctx, msg)
-
-	log.Printf("[Google Cloud] STUB: Successfully sent profile for MAC: %s", profile.MAC)
+	log.Printf("[Google Cloud] Sent profile for MAC: %s (device type: %s)", profile.MAC, deviceType)
 	return nil
 }
 
@@ -125,38 +134,13 @@ func (g *GoogleCloudConnector) SendDevice(device *database.Device, deviceType De
 		return fmt.Errorf("device is nil")
 	}
 
-	if !g.IsConnected() {
-		return fmt.Errorf("not connected to Google Cloud Pub/Sub")
+	msg := g.Anonymizer().AnonymizeDevice(schemas.DeviceToMessage(device, g.sensorID, "", ""))
+	attributes := map[string]string{"mac_address": msg.MAC}
+	if err := g.publish(schemas.MessageTypeDevice, msg, deviceType, attributes); err != nil {
+		return err
 	}
 
-	// Create DeviceData with device type metadata
-	deviceData := &DeviceData{
-		Device:     device,
-		DeviceType: deviceType,
-		Timestamp:  time.Now(),
-	}
-
-	// Serialize device data to JSON
-	data, err := SerializeDeviceData(deviceData)
-	if err != nil {
-		return fmt.Errorf("failed to serialize device data: %w", err)
-	}
-
-	log.Printf("[Google Cloud] Sending device: %s (%s) (device type: %s)", device.MAC, device.IP, deviceType)
-	log.Printf("[Google Cloud] Device data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, publish to Pub/Sub topic
-	// msg := &pubsub.Message{
-	//     Data: data,
-	//     Attributes: map[string]string{
-	//         "message_type": "device",
-	//         "device_type":  string(deviceType),
-	//         "mac_address":  device.MAC,
-	//     },
-	// }
-	// result := g.topic.Publish(ctx, msg)
-
-	log.Printf("[Google Cloud] STUB: Successfully sent device: %s", device.MAC)
+	log.Printf("[Google Cloud] Sent device: %s (%s) (device type: %s)", device.MAC, device.IP, deviceType)
 	return nil
 }
 
@@ -166,31 +150,47 @@ func (g *GoogleCloudConnector) SendAnomaly(anomaly *AnomalyData, deviceType Devi
 		return fmt.Errorf("anomaly is nil")
 	}
 
+	msg := g.Anonymizer().AnonymizeAnomaly(&schemas.AnomalyMessage{
+		DeviceMAC:   anomaly.DeviceMAC,
+		Type:        anomaly.Type,
+		Severity:    anomaly.Severity,
+		Description: anomaly.Description,
+		Timestamp:   anomaly.Timestamp,
+		Evidence:    anomaly.Evidence,
+	})
+	attributes := map[string]string{"mac_address": msg.DeviceMAC, "anomaly_type": anomaly.Type}
+	if err := g.publish(schemas.MessageTypeAnomaly, msg, deviceType, attributes); err != nil {
+		return err
+	}
+
+	log.Printf("[Google Cloud] Sent anomaly: %s (device type: %s)", anomaly.Type, deviceType)
+	return nil
+}
+
+// publish wraps a payload in an envelope and publishes it with attributes
+// subscribers can filter on
+func (g *GoogleCloudConnector) publish(messageType schemas.MessageType, payload interface{}, deviceType DeviceType, attributes map[string]string) error {
 	if !g.IsConnected() {
 		return fmt.Errorf("not connected to Google Cloud Pub/Sub")
 	}
 
-	// Serialize anomaly data to JSON
-	data, err := SerializeAnomalyData(anomaly)
+	msg, err := schemas.WrapMessage(messageType, g.sensorID, payload)
 	if err != nil {
-		return fmt.Errorf("failed to serialize anomaly data: %w", err)
+		return fmt.Errorf("failed to serialize %s: %w", messageType, err)
+	}
+	msg.SensorType = string(deviceType)
+	data, err := schemas.SerializeMessage(msg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", messageType, err)
 	}
 
-	log.Printf("[Google Cloud] Sending anomaly: %s (device type: %s)", anomaly.Type, deviceType)
-	log.Printf("[Google Cloud] Anomaly data size: %d bytes", len(data))
-
-	// STUB: In a full implementation, publish to Pub/Sub topic
-	// msg := &pubsub.Message{
-	//     Data: data,
-	//     Attributes: map[string]string{
-	//         "message_type": "anomaly",
-	//         "device_type":  string(deviceType),
-	//         "anomaly_type": anomaly.Type,
-	//     },
-	// }
-	// result := g.topic.Publish(ctx, msg)
+	attributes["message_type"] = string(messageType)
+	attributes["device_type"] = string(deviceType)
+	attributes["sensor_id"] = g.sensorID
 
-	log.Printf("[Google Cloud] STUB: Successfully sent anomaly: %s", anomaly.Type)
+	if err := g.publisher.Publish(&PubSubMessage{Data: data, Attributes: attributes}); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", messageType, err)
+	}
 	return nil
 }
 
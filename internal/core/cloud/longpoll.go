@@ -0,0 +1,163 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// LongPollConfig contains configuration for an HTTP long-poll command source
+type LongPollConfig struct {
+	// URL is polled with GET ?sensor_id=<SensorID>. The server holds the
+	// request open until it has commands, then answers 200 with a JSON array
+	// of commands, or 204 when it has none before its own deadline.
+	URL      string
+	SensorID string
+
+	// RequestTimeout bounds one poll and must exceed the server's hold time
+	RequestTimeout time.Duration
+	// RetryInterval is the wait after a failed poll
+	RetryInterval time.Duration
+
+	HTTPClient *http.Client
+}
+
+// DefaultLongPollConfig returns a long-poll configuration with sensible defaults
+func DefaultLongPollConfig() *LongPollConfig {
+	return &LongPollConfig{
+		RequestTimeout: 90 * time.Second,
+		RetryInterval:  10 * time.Second,
+	}
+}
+
+// LongPoller receives commands by long-polling an HTTP endpoint, for
+// deployments whose cloud provider offers no subscription the sensor can
+// use. Each command in a response is passed to the handler as raw JSON.
+type LongPoller struct {
+	cfg     *LongPollConfig
+	pollURL string
+	client  *http.Client
+	handler func(data []byte)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewLongPoller creates a long poller and starts polling
+func NewLongPoller(cfg *LongPollConfig, handler func(data []byte)) (*LongPoller, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("long-poll configuration is required")
+	}
+	if cfg.SensorID == "" {
+		return nil, fmt.Errorf("sensor ID is required")
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("command handler is required")
+	}
+
+	pollURL, err := url.Parse(cfg.URL)
+	if err != nil || (pollURL.Scheme != "http" && pollURL.Scheme != "https") {
+		return nil, fmt.Errorf("invalid long-poll URL: %s", cfg.URL)
+	}
+	query := pollURL.Query()
+	query.Set("sensor_id", cfg.SensorID)
+	pollURL.RawQuery = query.Encode()
+
+	defaults := DefaultLongPollConfig()
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = defaults.RequestTimeout
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaults.RetryInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &LongPoller{
+		cfg:     cfg,
+		pollURL: pollURL.String(),
+		client:  cfg.HTTPClient,
+		handler: handler,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	if p.client == nil {
+		p.client = &http.Client{Timeout: cfg.RequestTimeout}
+	}
+
+	p.wg.Add(1)
+	go p.pollLoop()
+
+	return p, nil
+}
+
+// Stop abandons any poll in flight and waits for the poll loop to exit
+func (p *LongPoller) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// pollLoop polls until stopped, backing off after failures
+func (p *LongPoller) pollLoop() {
+	defer p.wg.Done()
+
+	for {
+		if err := p.poll(); err != nil {
+			if p.ctx.Err() != nil {
+				return
+			}
+			log.Printf("[LongPoll] Poll failed: %v", err)
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-time.After(p.cfg.RetryInterval):
+			}
+		}
+		if p.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// poll makes one request and hands every command received to the handler
+func (p *LongPoller) poll() error {
+	ctx, cancel := context.WithTimeout(p.ctx, p.cfg.RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.pollURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	// Commands are kept as raw JSON: their signatures cover the exact bytes
+	// of their params
+	var commands []json.RawMessage
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&commands); err != nil {
+		return fmt.Errorf("failed to decode commands: %w", err)
+	}
+	for _, command := range commands {
+		p.handler(command)
+	}
+	return nil
+}
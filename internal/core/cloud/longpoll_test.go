@@ -0,0 +1,72 @@
+package cloud
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLongPollerDeliversCommands(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	var sensorIDs []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		polls++
+		poll := polls
+		sensorIDs = append(sensorIDs, r.URL.Query().Get("sensor_id"))
+		mu.Unlock()
+
+		switch poll {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			// Params spacing is preserved, since signatures cover their bytes
+			w.Write([]byte(`[{"id":"a","params":{"mac": "aa"}},{"id":"b"}]`))
+		default:
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	handled := make(chan string, 4)
+	cfg := DefaultLongPollConfig()
+	cfg.URL = server.URL + "/commands?fleet=lab"
+	cfg.SensorID = "sensor-01"
+	cfg.RetryInterval = 10 * time.Millisecond
+
+	poller, err := NewLongPoller(cfg, func(data []byte) {
+		handled <- string(data)
+	})
+	if err != nil {
+		t.Fatalf("NewLongPoller failed: %v", err)
+	}
+	defer poller.Stop()
+
+	for _, want := range []string{`{"id":"a","params":{"mac": "aa"}}`, `{"id":"b"}`} {
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Handler did not receive %s", want)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range sensorIDs {
+		if id != "sensor-01" {
+			t.Errorf("Expected sensor_id=sensor-01 on every poll, got %q", id)
+		}
+	}
+
+	if _, err := NewLongPoller(&LongPollConfig{URL: "ftp://example.com", SensorID: "s"}, func([]byte) {}); err == nil {
+		t.Error("Expected non-HTTP URL to be rejected")
+	}
+}
@@ -0,0 +1,344 @@
+package cloud
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+)
+
+// DefaultMQTTPort is the MQTT over TLS port used when the endpoint has none
+const DefaultMQTTPort = 8883
+
+// MQTTConfig contains configuration for an MQTT transport
+type MQTTConfig struct {
+	// Endpoint is the broker host, host:port or URL (ssl://, tls:// or mqtts://)
+	Endpoint string
+	// ClientID identifies the connection to the broker and doubles as the
+	// sensor ID in published envelopes and topics
+	ClientID string
+	// CertPath and KeyPath hold the client certificate and key (PEM) used
+	// for mutual TLS
+	CertPath string
+	KeyPath  string
+	// CAPath optionally holds the CA bundle (PEM) used to verify the broker;
+	// the system roots are used when empty
+	CAPath string
+
+	KeepAlive            time.Duration
+	ConnectTimeout       time.Duration
+	PublishTimeout       time.Duration
+	MaxReconnectInterval time.Duration
+
+	// OnConnectionChange is called whenever the connection is established,
+	// re-established or lost
+	OnConnectionChange func(connected bool)
+}
+
+// DefaultMQTTConfig returns an MQTT configuration with sensible defaults
+func DefaultMQTTConfig() *MQTTConfig {
+	return &MQTTConfig{
+		KeepAlive:            60 * time.Second,
+		ConnectTimeout:       30 * time.Second,
+		PublishTimeout:       10 * time.Second,
+		MaxReconnectInterval: 2 * time.Minute,
+	}
+}
+
+// MQTTTransport publishes cloud message envelopes to an MQTT broker over
+// mutual TLS. Publishes use QoS 1, so the broker acknowledges every message.
+// The connection is kept alive with pings and re-established automatically
+// when it drops.
+type MQTTTransport struct {
+	cfg           *MQTTConfig
+	brokerURL     string
+	client        mqtt.Client
+	connected     bool
+	subscriptions map[string]func(payload []byte) // Topic filter -> handler
+	mu            sync.RWMutex
+}
+
+// NewMQTTTransport creates an MQTT transport. Certificates are loaded here so
+// configuration errors surface before the first connection attempt.
+func NewMQTTTransport(cfg *MQTTConfig) (*MQTTTransport, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("MQTT configuration is required")
+	}
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("MQTT endpoint is required")
+	}
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("MQTT client ID is required")
+	}
+
+	defaults := DefaultMQTTConfig()
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = defaults.KeepAlive
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = defaults.ConnectTimeout
+	}
+	if cfg.PublishTimeout <= 0 {
+		cfg.PublishTimeout = defaults.PublishTimeout
+	}
+	if cfg.MaxReconnectInterval <= 0 {
+		cfg.MaxReconnectInterval = defaults.MaxReconnectInterval
+	}
+
+	brokerURL, err := BrokerURL(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &MQTTTransport{
+		cfg:           cfg,
+		brokerURL:     brokerURL,
+		subscriptions: make(map[string]func([]byte)),
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(brokerURL)
+	opts.SetClientID(cfg.ClientID)
+	opts.SetKeepAlive(cfg.KeepAlive)
+	opts.SetPingTimeout(cfg.ConnectTimeout)
+	opts.SetConnectTimeout(cfg.ConnectTimeout)
+	opts.SetWriteTimeout(cfg.PublishTimeout)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(cfg.MaxReconnectInterval)
+	// Keep retrying the initial connection too, so a sensor that boots
+	// without network access connects once the uplink comes up
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(cfg.ConnectTimeout)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		// Handlers run on their own goroutines, so the connection may already
+		// be gone again by the time this one runs
+		t.setConnected(client.IsConnectionOpen())
+		t.resubscribe()
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		log.Printf("[MQTT] Connection to %s lost: %v", t.brokerURL, err)
+		t.setConnected(false)
+	})
+	opts.SetReconnectingHandler(func(mqtt.Client, *mqtt.ClientOptions) {
+		log.Printf("[MQTT] Reconnecting to %s", t.brokerURL)
+	})
+
+	tlsConfig, err := LoadTLSConfig(cfg.CertPath, cfg.KeyPath, cfg.CAPath)
+	if err != nil {
+		return nil, err
+	}
+	opts.SetTLSConfig(tlsConfig)
+
+	t.client = mqtt.NewClient(opts)
+	return t, nil
+}
+
+// ErrMQTTConnectPending is returned by Connect when the first connection has
+// not completed within the connect timeout but is still being retried
+var ErrMQTTConnectPending = errors.New("MQTT connection pending, retrying in the background")
+
+// Connect starts connecting to the broker and waits up to the connect timeout
+// for the first connection. When the broker is unreachable the transport keeps
+// retrying in the background and ErrMQTTConnectPending is returned.
+func (t *MQTTTransport) Connect() error {
+	token := t.client.Connect()
+	if !token.WaitTimeout(t.cfg.ConnectTimeout) {
+		return ErrMQTTConnectPending
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", t.brokerURL, err)
+	}
+	t.setConnected(t.client.IsConnectionOpen())
+	return nil
+}
+
+// Disconnect closes the connection, waiting briefly for in-flight work
+func (t *MQTTTransport) Disconnect() {
+	t.client.Disconnect(250)
+	t.setConnected(false)
+}
+
+// IsConnected returns whether the transport currently holds a broker connection
+func (t *MQTTTransport) IsConnected() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.connected
+}
+
+// Publish sends an envelope to the sensor's topic for its message type and
+// waits for the broker's acknowledgement
+func (t *MQTTTransport) Publish(msg *schemas.CloudMessage) error {
+	data, err := schemas.SerializeMessage(msg)
+	if err != nil {
+		return err
+	}
+	return t.PublishRaw(MessageTopic(msg.SensorID, msg.MessageType), data)
+}
+
+// PublishRaw sends a payload to a topic with QoS 1 and waits for the
+// broker's acknowledgement
+func (t *MQTTTransport) PublishRaw(topic string, payload []byte) error {
+	if !t.IsConnected() {
+		return fmt.Errorf("not connected to %s", t.brokerURL)
+	}
+
+	token := t.client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(t.cfg.PublishTimeout) {
+		return fmt.Errorf("timed out waiting for acknowledgement on %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for messages on a topic filter, received
+// with QoS 1. The broker forgets subscriptions with the clean session, so
+// they are renewed every time the connection is re-established; while
+// disconnected the subscription is made on the next connect.
+func (t *MQTTTransport) Subscribe(topic string, handler func(payload []byte)) error {
+	if topic == "" || handler == nil {
+		return fmt.Errorf("topic and handler are required")
+	}
+
+	t.mu.Lock()
+	t.subscriptions[topic] = handler
+	t.mu.Unlock()
+
+	if !t.IsConnected() {
+		return nil
+	}
+	return t.subscribe(topic, handler)
+}
+
+// subscribe subscribes to a topic and waits for the broker's acknowledgement
+func (t *MQTTTransport) subscribe(topic string, handler func([]byte)) error {
+	token := t.client.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		handler(msg.Payload())
+	})
+	if !token.WaitTimeout(t.cfg.PublishTimeout) {
+		return fmt.Errorf("timed out subscribing to %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// resubscribe renews every subscription after a (re)connect
+func (t *MQTTTransport) resubscribe() {
+	t.mu.RLock()
+	subscriptions := make(map[string]func([]byte), len(t.subscriptions))
+	for topic, handler := range t.subscriptions {
+		subscriptions[topic] = handler
+	}
+	t.mu.RUnlock()
+
+	for topic, handler := range subscriptions {
+		if err := t.subscribe(topic, handler); err != nil {
+			log.Printf("[MQTT] %v", err)
+		}
+	}
+}
+
+// setConnected records the connection state and notifies the callback when
+// it changes
+func (t *MQTTTransport) setConnected(connected bool) {
+	t.mu.Lock()
+	changed := t.connected != connected
+	t.connected = connected
+	t.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if connected {
+		log.Printf("[MQTT] Connected to %s", t.brokerURL)
+	}
+	if t.cfg.OnConnectionChange != nil {
+		t.cfg.OnConnectionChange(connected)
+	}
+}
+
+// MessageTopic returns the topic a sensor publishes messages of a type to,
+// e.g. heimdal/sensor/<sensorID>/profile
+func MessageTopic(sensorID string, messageType schemas.MessageType) string {
+	return fmt.Sprintf("heimdal/sensor/%s/%s", sensorID, messageType)
+}
+
+// FleetCommandTopic is the topic commands addressed to every sensor are
+// published to
+const FleetCommandTopic = "heimdal/fleet/commands"
+
+// CommandTopic returns the topic commands for one sensor are published to,
+// e.g. heimdal/sensor/<sensorID>/commands
+func CommandTopic(sensorID string) string {
+	return MessageTopic(sensorID, schemas.MessageTypeCommand)
+}
+
+// BrokerURL normalizes an endpoint into a TLS broker URL, defaulting the
+// port to 8883
+func BrokerURL(endpoint string) (string, error) {
+	hostPort := endpoint
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		switch scheme := endpoint[:i]; scheme {
+		case "ssl", "tls", "mqtts":
+			hostPort = endpoint[i+3:]
+		default:
+			// Brokers authenticate sensors by their client certificate
+			return "", fmt.Errorf("unsupported MQTT scheme (TLS is required): %s", scheme)
+		}
+	}
+	hostPort = strings.TrimSuffix(hostPort, "/")
+	if hostPort == "" {
+		return "", fmt.Errorf("invalid MQTT endpoint: %s", endpoint)
+	}
+
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(strings.Trim(hostPort, "[]"), fmt.Sprint(DefaultMQTTPort))
+	}
+	return "ssl://" + hostPort, nil
+}
+
+// LoadTLSConfig builds a mutual TLS configuration from a PEM client
+// certificate and key and an optional PEM CA bundle
+func LoadTLSConfig(certPath, keyPath, caPath string) (*tls.Config, error) {
+	if certPath == "" || keyPath == "" {
+		return nil, fmt.Errorf("client certificate and key are required for mutual TLS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if caPath != "" {
+		pem, err := os.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", caPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,511 @@
+package cloud
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// testBroker is a minimal MQTT 3.1.1 broker stand-in: it requires a client
+// certificate, acknowledges QoS 1 publishes, answers pings and records what
+// it received
+type testBroker struct {
+	listener net.Listener
+	messages chan brokerMessage
+	mu       sync.Mutex
+	conns    []net.Conn
+	peers    []string // Client certificate common names
+	subs     []string // Topic filters, one entry per SUBSCRIBE received
+}
+
+type brokerMessage struct {
+	topic   string
+	payload []byte
+}
+
+// testPKI writes a CA, a broker certificate for 127.0.0.1 and a client
+// certificate to dir
+type testPKI struct {
+	caPath, certPath, keyPath string
+	serverCert                tls.Certificate
+	pool                      *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to issue %s certificate: %v", name, err)
+		}
+		return der, key
+	}
+
+	writePEM := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	pki := &testPKI{pool: x509.NewCertPool()}
+	pki.pool.AddCert(caCert)
+	pki.caPath = writePEM("ca.crt", "CERTIFICATE", caDER)
+
+	serverDER, serverKey := issue(2, "broker", x509.ExtKeyUsageServerAuth)
+	pki.serverCert = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+
+	clientDER, clientKey := issue(3, "sensor-01", x509.ExtKeyUsageClientAuth)
+	keyDER, _ := x509.MarshalECPrivateKey(clientKey)
+	pki.certPath = writePEM("device.crt", "CERTIFICATE", clientDER)
+	pki.keyPath = writePEM("device.key", "EC PRIVATE KEY", keyDER)
+
+	return pki
+}
+
+func newTestBroker(t *testing.T, pki *testPKI) *testBroker {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{pki.serverCert},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	b := &testBroker{listener: listener, messages: make(chan brokerMessage, 16)}
+	go b.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		b.dropConnections()
+	})
+	return b
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.conns = append(b.conns, conn)
+		b.mu.Unlock()
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	tlsConn := conn.(*tls.Conn)
+	if err := tlsConn.Handshake(); err != nil {
+		return
+	}
+	if peers := tlsConn.ConnectionState().PeerCertificates; len(peers) > 0 {
+		b.mu.Lock()
+		b.peers = append(b.peers, peers[0].Subject.CommonName)
+		b.mu.Unlock()
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		body, err := readPacketBody(r)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			conn.Write([]byte{0x20, 2, 0, 0})
+		case 3: // PUBLISH
+			topicLen := int(binary.BigEndian.Uint16(body))
+			msg := brokerMessage{topic: string(body[2 : 2+topicLen])}
+			rest := body[2+topicLen:]
+			if qos := (header >> 1) & 3; qos > 0 {
+				conn.Write([]byte{0x40, 2, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			msg.payload = append([]byte(nil), rest...)
+			b.messages <- msg
+		case 8: // SUBSCRIBE
+			b.mu.Lock()
+			for rest := body[2:]; len(rest) > 2; {
+				topicLen := int(binary.BigEndian.Uint16(rest))
+				b.subs = append(b.subs, string(rest[2:2+topicLen]))
+				rest = rest[3+topicLen:]
+			}
+			b.mu.Unlock()
+			conn.Write([]byte{0x90, 3, body[0], body[1], 1})
+		case 12: // PINGREQ
+			conn.Write([]byte{0xd0, 0})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// dropConnections closes every client connection, as a broker restart would
+func (b *testBroker) dropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+// subscriptionCount returns how many subscriptions to a topic were received
+func (b *testBroker) subscriptionCount(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := 0
+	for _, sub := range b.subs {
+		if sub == topic {
+			count++
+		}
+	}
+	return count
+}
+
+// deliver sends a QoS 0 PUBLISH to every connected client
+func (b *testBroker) deliver(topic string, payload []byte) {
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+	body = append(append(body, topic...), payload...)
+	packet := []byte{0x30}
+	for length := len(body); ; {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 128
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Write(packet)
+	}
+}
+
+func readPacketBody(r *bufio.Reader) ([]byte, error) {
+	length, multiplier := 0, 1
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(digit&127) * multiplier
+		if digit&128 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+func (b *testBroker) expectMessage(t *testing.T) brokerMessage {
+	t.Helper()
+	select {
+	case msg := <-b.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broker did not receive a message")
+		return brokerMessage{}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAWSIoTConnectorPublishesEnvelopes(t *testing.T) {
+	pki := newTestPKI(t)
+	broker := newTestBroker(t, pki)
+
+	connector, err := NewAWSIoTConnector(&config.AWSConfig{
+		Endpoint: broker.listener.Addr().String(),
+		ClientID: "sensor-01",
+		CertPath: pki.certPath,
+		KeyPath:  pki.keyPath,
+		CAPath:   pki.caPath,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connector: %v", err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer connector.Disconnect()
+
+	if !connector.IsConnected() {
+		t.Fatal("Expected connector to be connected")
+	}
+	broker.mu.Lock()
+	peers := broker.peers
+	broker.mu.Unlock()
+	if len(peers) != 1 || peers[0] != "sensor-01" {
+		t.Errorf("Expected broker to see client certificate sensor-01, got %v", peers)
+	}
+
+	profile := &database.BehavioralProfile{MAC: "aa:bb:cc:dd:ee:ff", TotalPackets: 42}
+	if err := connector.SendProfile(profile, DeviceTypeHardware); err != nil {
+		t.Fatalf("SendProfile failed: %v", err)
+	}
+
+	msg := broker.expectMessage(t)
+	if msg.topic != "heimdal/sensor/sensor-01/profile" {
+		t.Errorf("Unexpected topic: %s", msg.topic)
+	}
+	envelope, err := schemas.DeserializeMessage(msg.payload)
+	if err != nil {
+		t.Fatalf("Failed to decode envelope: %v", err)
+	}
+	if envelope.MessageType != schemas.MessageTypeProfile || envelope.SensorID != "sensor-01" || envelope.SensorType != "hardware" {
+		t.Errorf("Unexpected envelope: %+v", envelope)
+	}
+	var payload schemas.ProfileMessage
+	if err := schemas.UnwrapMessage(envelope, &payload); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if payload.MAC != profile.MAC || payload.TotalPackets != 42 {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+
+	anomaly := &AnomalyData{DeviceMAC: profile.MAC, Type: "port_scan", Severity: "high"}
+	if err := connector.SendAnomaly(anomaly, DeviceTypeHardware); err != nil {
+		t.Fatalf("SendAnomaly failed: %v", err)
+	}
+	if msg := broker.expectMessage(t); msg.topic != "heimdal/sensor/sensor-01/anomaly" {
+		t.Errorf("Unexpected topic: %s", msg.topic)
+	}
+}
+
+func TestMQTTTransportReconnects(t *testing.T) {
+	pki := newTestPKI(t)
+	broker := newTestBroker(t, pki)
+
+	var mu sync.Mutex
+	var changes []bool
+	cfg := DefaultMQTTConfig()
+	cfg.Endpoint = "ssl://" + broker.listener.Addr().String()
+	cfg.ClientID = "sensor-01"
+	cfg.CertPath = pki.certPath
+	cfg.KeyPath = pki.keyPath
+	cfg.CAPath = pki.caPath
+	cfg.ConnectTimeout = 5 * time.Second
+	cfg.MaxReconnectInterval = 100 * time.Millisecond
+	cfg.OnConnectionChange = func(connected bool) {
+		mu.Lock()
+		changes = append(changes, connected)
+		mu.Unlock()
+	}
+
+	transport, err := NewMQTTTransport(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+	if err := transport.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer transport.Disconnect()
+
+	broker.dropConnections()
+	waitFor(t, "reconnect", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(changes) >= 3
+	})
+
+	mu.Lock()
+	if changes[0] != true || changes[1] != false || changes[2] != true {
+		t.Errorf("Expected connected, lost, reconnected; got %v", changes)
+	}
+	mu.Unlock()
+
+	if err := transport.PublishRaw("heimdal/sensor/sensor-01/test", []byte("after reconnect")); err != nil {
+		t.Fatalf("Publish after reconnect failed: %v", err)
+	}
+	if msg := broker.expectMessage(t); string(msg.payload) != "after reconnect" {
+		t.Errorf("Unexpected payload: %q", msg.payload)
+	}
+}
+
+func TestMQTTTransportResubscribesAfterReconnect(t *testing.T) {
+	pki := newTestPKI(t)
+	broker := newTestBroker(t, pki)
+
+	cfg := DefaultMQTTConfig()
+	cfg.Endpoint = "ssl://" + broker.listener.Addr().String()
+	cfg.ClientID = "sensor-01"
+	cfg.CertPath = pki.certPath
+	cfg.KeyPath = pki.keyPath
+	cfg.CAPath = pki.caPath
+	cfg.ConnectTimeout = 5 * time.Second
+	cfg.MaxReconnectInterval = 100 * time.Millisecond
+
+	transport, err := NewMQTTTransport(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	received := make(chan string, 4)
+	topic := CommandTopic("sensor-01")
+	if topic != "heimdal/sensor/sensor-01/commands" {
+		t.Errorf("Unexpected command topic %s", topic)
+	}
+	// Subscribing before connecting takes effect once connected
+	if err := transport.Subscribe(topic, func(payload []byte) {
+		received <- string(payload)
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := transport.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer transport.Disconnect()
+
+	expectDelivery := func(payload string) {
+		t.Helper()
+		broker.deliver(topic, []byte(payload))
+		select {
+		case got := <-received:
+			if got != payload {
+				t.Errorf("Expected %q, got %q", payload, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Handler did not receive %q", payload)
+		}
+	}
+
+	waitFor(t, "subscription", func() bool { return broker.subscriptionCount(topic) >= 1 })
+	expectDelivery("first")
+
+	broker.dropConnections()
+	waitFor(t, "resubscription", func() bool { return broker.subscriptionCount(topic) >= 2 })
+	expectDelivery("after reconnect")
+}
+
+func TestMQTTTransportRejectsUntrustedBroker(t *testing.T) {
+	pki := newTestPKI(t)
+	broker := newTestBroker(t, pki)
+
+	// A CA bundle that did not issue the broker's certificate
+	other := newTestPKI(t)
+
+	cfg := DefaultMQTTConfig()
+	cfg.Endpoint = broker.listener.Addr().String()
+	cfg.ClientID = "sensor-01"
+	cfg.CertPath = pki.certPath
+	cfg.KeyPath = pki.keyPath
+	cfg.CAPath = other.caPath
+	cfg.ConnectTimeout = 300 * time.Millisecond
+
+	transport, err := NewMQTTTransport(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+	defer transport.Disconnect()
+
+	if err := transport.Connect(); err == nil {
+		t.Fatal("Expected connecting to an untrusted broker to fail")
+	}
+	if transport.IsConnected() {
+		t.Error("Expected transport to stay disconnected")
+	}
+	if err := transport.PublishRaw("heimdal/sensor/sensor-01/test", nil); err == nil {
+		t.Error("Expected publish to fail while disconnected")
+	}
+}
+
+func TestBrokerURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{"a1b2.iot.us-east-1.amazonaws.com", "ssl://a1b2.iot.us-east-1.amazonaws.com:8883", false},
+		{"broker.local:443", "ssl://broker.local:443", false},
+		{"tls://broker.local", "ssl://broker.local:8883", false},
+		{"ssl://[::1]:8883", "ssl://[::1]:8883", false},
+		{"tcp://broker.local:1883", "", true},
+		{"ssl://", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := BrokerURL(tt.endpoint)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("BrokerURL(%q) error = %v, wantErr %v", tt.endpoint, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("BrokerURL(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,524 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPubSubEndpoint is the global Pub/Sub REST endpoint. Ordering is
+	// only guaranteed for messages published to the same region, so sensors
+	// that rely on it should use a regional endpoint such as
+	// https://us-east1-pubsub.googleapis.com
+	DefaultPubSubEndpoint = "https://pubsub.googleapis.com"
+
+	// pubsubAudience is the audience of self-signed service account JWTs
+	pubsubAudience = "https://pubsub.googleapis.com/"
+
+	// tokenLifetime is the validity of a signed token; tokens are re-signed
+	// when less than tokenRefreshMargin remains
+	tokenLifetime      = time.Hour
+	tokenRefreshMargin = 5 * time.Minute
+
+	// maxPubSubBatchBytes stays below the 10MB Pub/Sub request limit
+	maxPubSubBatchBytes = 9 * 1024 * 1024
+)
+
+// ErrPublisherStopped is returned when publishing after Stop
+var ErrPublisherStopped = errors.New("publisher stopped")
+
+// PubSubConfig contains configuration for a Pub/Sub publisher
+type PubSubConfig struct {
+	ProjectID string
+	TopicID   string
+	// CredentialsPath is a service account key file (JSON); the
+	// GOOGLE_APPLICATION_CREDENTIALS environment variable is used when empty
+	CredentialsPath string
+	// EmulatorHost (host:port) sends requests to a local Pub/Sub emulator
+	// without authentication; the PUBSUB_EMULATOR_HOST environment variable
+	// is used when empty
+	EmulatorHost string
+	// Endpoint overrides the Pub/Sub REST endpoint, e.g. a regional one
+	Endpoint string
+	// OrderingKey is attached to every message so subscribers receive them
+	// in publish order; typically the sensor ID
+	OrderingKey string
+
+	// A batch is sent when it holds BatchSize messages or BatchBytes of
+	// data, or BatchDelay after its first message, whichever comes first
+	BatchSize      int
+	BatchBytes     int
+	BatchDelay     time.Duration
+	RequestTimeout time.Duration
+
+	HTTPClient *http.Client
+}
+
+// DefaultPubSubConfig returns a Pub/Sub configuration with sensible defaults
+func DefaultPubSubConfig() *PubSubConfig {
+	return &PubSubConfig{
+		Endpoint:       DefaultPubSubEndpoint,
+		BatchSize:      100,
+		BatchBytes:     1024 * 1024,
+		BatchDelay:     50 * time.Millisecond,
+		RequestTimeout: 30 * time.Second,
+	}
+}
+
+// PubSubMessage is a message published to a topic
+type PubSubMessage struct {
+	Data       []byte
+	Attributes map[string]string
+}
+
+// pendingMessage is a message waiting in the current batch
+type pendingMessage struct {
+	msg  *PubSubMessage
+	done chan error
+}
+
+// serviceAccount holds the fields of a service account key file needed to
+// sign tokens
+type serviceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+
+	key *rsa.PrivateKey
+}
+
+// PubSubPublisher publishes messages to a Pub/Sub topic over the REST API.
+// Concurrent publishes are collected into batches, and batches are sent one
+// at a time so messages sharing an ordering key stay in order.
+type PubSubPublisher struct {
+	*pubsubClient
+	cfg      *PubSubConfig
+	topicURL string
+
+	pending chan *pendingMessage
+	stopMu  sync.RWMutex
+	stopped bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewPubSubPublisher creates a publisher and starts its batching goroutine.
+// Credentials are loaded here so configuration errors surface early.
+func NewPubSubPublisher(cfg *PubSubConfig) (*PubSubPublisher, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("Pub/Sub configuration is required")
+	}
+	if cfg.ProjectID == "" {
+		return nil, fmt.Errorf("Pub/Sub project ID is required")
+	}
+	if cfg.TopicID == "" {
+		return nil, fmt.Errorf("Pub/Sub topic ID is required")
+	}
+
+	defaults := DefaultPubSubConfig()
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaults.BatchSize
+	}
+	if cfg.BatchBytes <= 0 || cfg.BatchBytes > maxPubSubBatchBytes {
+		cfg.BatchBytes = defaults.BatchBytes
+	}
+	if cfg.BatchDelay <= 0 {
+		cfg.BatchDelay = defaults.BatchDelay
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = defaults.RequestTimeout
+	}
+
+	client, err := newPubSubClient(cfg.ProjectID, cfg.EmulatorHost, cfg.Endpoint, cfg.CredentialsPath, cfg.HTTPClient, cfg.RequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PubSubPublisher{
+		pubsubClient: client,
+		cfg:          cfg,
+		topicURL:     client.projectURL + "/topics/" + url.PathEscape(cfg.TopicID),
+		pending:      make(chan *pendingMessage, cfg.BatchSize),
+		stopCh:       make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.batchLoop()
+
+	return p, nil
+}
+
+// CheckTopic verifies the topic is reachable. Against the emulator a missing
+// topic is created, since emulator state does not survive restarts.
+func (p *PubSubPublisher) CheckTopic(ctx context.Context) error {
+	status, body, err := p.do(ctx, http.MethodGet, p.topicURL, nil)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case status == http.StatusOK:
+		return nil
+	case status == http.StatusNotFound && p.emulator:
+		status, body, err = p.do(ctx, http.MethodPut, p.topicURL, []byte("{}"))
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("failed to create topic on emulator: %s", apiError(status, body))
+		}
+		log.Printf("[Pub/Sub] Created topic %s on emulator", p.cfg.TopicID)
+		return nil
+	case status == http.StatusForbidden:
+		// Publisher-only service accounts may not read topic metadata
+		log.Printf("[Pub/Sub] Cannot read topic %s (%s), assuming it exists", p.cfg.TopicID, apiError(status, body))
+		return nil
+	default:
+		return fmt.Errorf("topic %s unavailable: %s", p.cfg.TopicID, apiError(status, body))
+	}
+}
+
+// Publish adds a message to the current batch and waits until the batch has
+// been acknowledged by Pub/Sub
+func (p *PubSubPublisher) Publish(msg *PubSubMessage) error {
+	if msg == nil {
+		return fmt.Errorf("message is nil")
+	}
+	if len(msg.Data) > maxPubSubBatchBytes {
+		return fmt.Errorf("message of %d bytes exceeds the Pub/Sub request limit", len(msg.Data))
+	}
+
+	pm := &pendingMessage{msg: msg, done: make(chan error, 1)}
+
+	p.stopMu.RLock()
+	if p.stopped {
+		p.stopMu.RUnlock()
+		return ErrPublisherStopped
+	}
+	p.pending <- pm
+	p.stopMu.RUnlock()
+
+	return <-pm.done
+}
+
+// Stop sends any batched messages and stops the batching goroutine
+func (p *PubSubPublisher) Stop() {
+	p.stopMu.Lock()
+	if p.stopped {
+		p.stopMu.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.stopCh)
+	p.stopMu.Unlock()
+
+	p.wg.Wait()
+}
+
+// batchLoop collects pending messages into batches and sends them in order
+func (p *PubSubPublisher) batchLoop() {
+	defer p.wg.Done()
+
+	for {
+		var first *pendingMessage
+		select {
+		case first = <-p.pending:
+		case <-p.stopCh:
+			p.drain()
+			return
+		}
+
+		batch := []*pendingMessage{first}
+		size := len(first.msg.Data)
+		timer := time.NewTimer(p.cfg.BatchDelay)
+	collect:
+		for len(batch) < p.cfg.BatchSize && size < p.cfg.BatchBytes {
+			select {
+			case pm := <-p.pending:
+				batch = append(batch, pm)
+				size += len(pm.msg.Data)
+			case <-timer.C:
+				break collect
+			case <-p.stopCh:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		p.sendBatch(batch)
+	}
+}
+
+// drain sends messages enqueued before Stop
+func (p *PubSubPublisher) drain() {
+	for {
+		batch := make([]*pendingMessage, 0)
+	collect:
+		for len(batch) < p.cfg.BatchSize {
+			select {
+			case pm := <-p.pending:
+				batch = append(batch, pm)
+			default:
+				break collect
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		p.sendBatch(batch)
+	}
+}
+
+// sendBatch publishes a batch and reports the outcome to every message in it
+func (p *PubSubPublisher) sendBatch(batch []*pendingMessage) {
+	type restMessage struct {
+		Data        string            `json:"data"`
+		Attributes  map[string]string `json:"attributes,omitempty"`
+		OrderingKey string            `json:"orderingKey,omitempty"`
+	}
+	request := struct {
+		Messages []restMessage `json:"messages"`
+	}{Messages: make([]restMessage, 0, len(batch))}
+	for _, pm := range batch {
+		request.Messages = append(request.Messages, restMessage{
+			Data:        base64.StdEncoding.EncodeToString(pm.msg.Data),
+			Attributes:  pm.msg.Attributes,
+			OrderingKey: p.cfg.OrderingKey,
+		})
+	}
+
+	err := p.publishRequest(request)
+	for _, pm := range batch {
+		pm.done <- err
+	}
+}
+
+// publishRequest sends a publish request body and checks every message was accepted
+func (p *PubSubPublisher) publishRequest(request interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal publish request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.RequestTimeout)
+	defer cancel()
+
+	status, respBody, err := p.do(ctx, http.MethodPost, p.topicURL+":publish", body)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("publish failed: %s", apiError(status, respBody))
+	}
+
+	var response struct {
+		MessageIDs []string `json:"messageIds"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return fmt.Errorf("failed to decode publish response: %w", err)
+	}
+	if len(response.MessageIDs) == 0 {
+		return fmt.Errorf("publish response contained no message IDs")
+	}
+	return nil
+}
+
+// pubsubClient sends authenticated requests to the Pub/Sub REST API of one
+// project, or unauthenticated ones to the emulator
+type pubsubClient struct {
+	projectURL string // <endpoint>/v1/projects/<project>
+	emulator   bool
+	account    *serviceAccount
+	client     *http.Client
+
+	tokenMu     sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// newPubSubClient resolves the endpoint and loads credentials. The emulator
+// and credentials fall back to PUBSUB_EMULATOR_HOST and
+// GOOGLE_APPLICATION_CREDENTIALS.
+func newPubSubClient(projectID, emulatorHost, endpoint, credentialsPath string, httpClient *http.Client, timeout time.Duration) (*pubsubClient, error) {
+	c := &pubsubClient{client: httpClient}
+	if c.client == nil {
+		c.client = &http.Client{Timeout: timeout}
+	}
+
+	if emulatorHost == "" {
+		emulatorHost = os.Getenv("PUBSUB_EMULATOR_HOST")
+	}
+
+	switch {
+	case emulatorHost != "":
+		endpoint = "http://" + emulatorHost
+		c.emulator = true
+	case endpoint == "":
+		endpoint = DefaultPubSubEndpoint
+	}
+	c.projectURL = fmt.Sprintf("%s/v1/projects/%s", strings.TrimSuffix(endpoint, "/"), url.PathEscape(projectID))
+
+	if !c.emulator {
+		if credentialsPath == "" {
+			credentialsPath = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		}
+		if credentialsPath == "" {
+			return nil, fmt.Errorf("service account credentials are required (credentials_path or GOOGLE_APPLICATION_CREDENTIALS)")
+		}
+		account, err := loadServiceAccount(credentialsPath)
+		if err != nil {
+			return nil, err
+		}
+		c.account = account
+	}
+
+	return c, nil
+}
+
+// do performs an authenticated request and returns the status and body
+func (p *pubsubClient) do(ctx context.Context, method, target string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if !p.emulator {
+		token, err := p.accessToken()
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request to Pub/Sub failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read Pub/Sub response: %w", err)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// accessToken returns a self-signed service account JWT, which Google APIs
+// accept as a bearer token without an OAuth exchange
+func (p *pubsubClient) accessToken() (string, error) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	now := time.Now()
+	if p.token != "" && now.Add(tokenRefreshMargin).Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	token, err := p.account.signJWT(pubsubAudience, now, tokenLifetime)
+	if err != nil {
+		return "", err
+	}
+	p.token = token
+	p.tokenExpiry = now.Add(tokenLifetime)
+	return token, nil
+}
+
+// loadServiceAccount reads and parses a service account key file
+func loadServiceAccount(path string) (*serviceAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account credentials: %w", err)
+	}
+
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse service account credentials: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("service account credentials must contain client_email and private_key")
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("service account private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse service account private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account private key must be RSA")
+	}
+	account.key = key
+
+	return &account, nil
+}
+
+// signJWT creates an RS256 token asserting the service account's identity
+// to the given audience
+func (a *serviceAccount) signJWT(audience string, now time.Time, lifetime time.Duration) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": a.PrivateKeyID,
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": a.ClientEmail,
+		"sub": a.ClientEmail,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
+
+// apiError formats a Google API error response
+func apiError(status int, body []byte) string {
+	var response struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Error.Message != "" {
+		return fmt.Sprintf("%d %s: %s", status, response.Error.Status, response.Error.Message)
+	}
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
@@ -0,0 +1,203 @@
+package cloud
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// PubSubSubscriberConfig contains configuration for a Pub/Sub pull subscriber
+type PubSubSubscriberConfig struct {
+	ProjectID      string
+	SubscriptionID string
+	// CredentialsPath, EmulatorHost and Endpoint work as in PubSubConfig
+	CredentialsPath string
+	EmulatorHost    string
+	Endpoint        string
+
+	// MaxMessages is the most messages returned by one pull
+	MaxMessages int
+	// RetryInterval is the wait after a failed pull
+	RetryInterval time.Duration
+	// RequestTimeout bounds one pull, which Pub/Sub holds open until
+	// messages arrive or its own deadline passes
+	RequestTimeout time.Duration
+
+	HTTPClient *http.Client
+}
+
+// DefaultPubSubSubscriberConfig returns a subscriber configuration with
+// sensible defaults
+func DefaultPubSubSubscriberConfig() *PubSubSubscriberConfig {
+	return &PubSubSubscriberConfig{
+		Endpoint:       DefaultPubSubEndpoint,
+		MaxMessages:    10,
+		RetryInterval:  10 * time.Second,
+		RequestTimeout: 90 * time.Second,
+	}
+}
+
+// PubSubSubscriber pulls messages from a Pub/Sub subscription over the REST
+// API and hands their data to a handler. Messages are acknowledged once the
+// handler returns, so a message is only redelivered when the sensor stops
+// before handling it.
+type PubSubSubscriber struct {
+	*pubsubClient
+	cfg             *PubSubSubscriberConfig
+	subscriptionURL string
+	handler         func(data []byte)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPubSubSubscriber creates a subscriber and starts pulling
+func NewPubSubSubscriber(cfg *PubSubSubscriberConfig, handler func(data []byte)) (*PubSubSubscriber, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("Pub/Sub subscriber configuration is required")
+	}
+	if cfg.ProjectID == "" {
+		return nil, fmt.Errorf("Pub/Sub project ID is required")
+	}
+	if cfg.SubscriptionID == "" {
+		return nil, fmt.Errorf("Pub/Sub subscription ID is required")
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("message handler is required")
+	}
+
+	defaults := DefaultPubSubSubscriberConfig()
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = defaults.MaxMessages
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaults.RetryInterval
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = defaults.RequestTimeout
+	}
+
+	client, err := newPubSubClient(cfg.ProjectID, cfg.EmulatorHost, cfg.Endpoint, cfg.CredentialsPath, cfg.HTTPClient, cfg.RequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &PubSubSubscriber{
+		pubsubClient:    client,
+		cfg:             cfg,
+		subscriptionURL: client.projectURL + "/subscriptions/" + url.PathEscape(cfg.SubscriptionID),
+		handler:         handler,
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+
+	s.wg.Add(1)
+	go s.pullLoop()
+
+	return s, nil
+}
+
+// Stop abandons any pull in flight and waits for the pull loop to exit
+func (s *PubSubSubscriber) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// pullLoop pulls until stopped, backing off after failures
+func (s *PubSubSubscriber) pullLoop() {
+	defer s.wg.Done()
+
+	for {
+		if _, err := s.pull(); err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			log.Printf("[Pub/Sub] Pull from %s failed: %v", s.cfg.SubscriptionID, err)
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(s.cfg.RetryInterval):
+			}
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// pull fetches one batch of messages, handles them and acknowledges them,
+// returning how many were handled
+func (s *PubSubSubscriber) pull() (int, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.RequestTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]int{"maxMessages": s.cfg.MaxMessages})
+	if err != nil {
+		return 0, err
+	}
+	status, respBody, err := s.do(ctx, http.MethodPost, s.subscriptionURL+":pull", body)
+	if err != nil {
+		return 0, err
+	}
+	if status != http.StatusOK {
+		return 0, fmt.Errorf("pull failed: %s", apiError(status, respBody))
+	}
+
+	var response struct {
+		ReceivedMessages []struct {
+			AckID   string `json:"ackId"`
+			Message struct {
+				Data string `json:"data"`
+			} `json:"message"`
+		} `json:"receivedMessages"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return 0, fmt.Errorf("failed to decode pull response: %w", err)
+	}
+	if len(response.ReceivedMessages) == 0 {
+		return 0, nil
+	}
+
+	ackIDs := make([]string, 0, len(response.ReceivedMessages))
+	for _, received := range response.ReceivedMessages {
+		ackIDs = append(ackIDs, received.AckID)
+		data, err := base64.StdEncoding.DecodeString(received.Message.Data)
+		if err != nil {
+			// Redelivering a malformed message would not fix it
+			log.Printf("[Pub/Sub] Dropping message with invalid data: %v", err)
+			continue
+		}
+		s.handler(data)
+	}
+
+	return len(ackIDs), s.acknowledge(ackIDs)
+}
+
+// acknowledge tells Pub/Sub not to redeliver the given messages
+func (s *PubSubSubscriber) acknowledge(ackIDs []string) error {
+	body, err := json.Marshal(map[string][]string{"ackIds": ackIDs})
+	if err != nil {
+		return err
+	}
+
+	// Acknowledge even while stopping, so handled messages are not redelivered
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.RequestTimeout)
+	defer cancel()
+
+	status, respBody, err := s.do(ctx, http.MethodPost, s.subscriptionURL+":acknowledge", body)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("acknowledge failed: %s", apiError(status, respBody))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package cloud
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPubSubSubscriberHandlesAndAcknowledges(t *testing.T) {
+	var mu sync.Mutex
+	pending := []string{"first", "second"}
+	var acked []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/subscriptions/commands:pull"):
+			type received struct {
+				AckID   string            `json:"ackId"`
+				Message map[string]string `json:"message"`
+			}
+			var response struct {
+				ReceivedMessages []received `json:"receivedMessages"`
+			}
+			for _, data := range pending {
+				response.ReceivedMessages = append(response.ReceivedMessages, received{
+					AckID:   "ack-" + data,
+					Message: map[string]string{"data": base64.StdEncoding.EncodeToString([]byte(data))},
+				})
+			}
+			pending = nil
+			if len(response.ReceivedMessages) == 0 {
+				// Stand in for Pub/Sub holding the pull open
+				time.Sleep(10 * time.Millisecond)
+			}
+			json.NewEncoder(w).Encode(response)
+		case strings.HasSuffix(r.URL.Path, "/subscriptions/commands:acknowledge"):
+			var request struct {
+				AckIDs []string `json:"ackIds"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			acked = append(acked, request.AckIDs...)
+			w.Write([]byte("{}"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	handled := make(chan string, 4)
+	cfg := DefaultPubSubSubscriberConfig()
+	cfg.ProjectID = "test-project"
+	cfg.SubscriptionID = "commands"
+	cfg.EmulatorHost = strings.TrimPrefix(server.URL, "http://")
+
+	subscriber, err := NewPubSubSubscriber(cfg, func(data []byte) {
+		handled <- string(data)
+	})
+	if err != nil {
+		t.Fatalf("NewPubSubSubscriber failed: %v", err)
+	}
+	defer subscriber.Stop()
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Handler did not receive %q", want)
+		}
+	}
+
+	waitFor(t, "acknowledgement", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(acked) == 2
+	})
+}
@@ -0,0 +1,252 @@
+package cloud
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+type publishedMessage struct {
+	Data        string            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	OrderingKey string            `json:"orderingKey"`
+}
+
+// fakePubSub is a stand-in for the Pub/Sub REST API and its emulator
+type fakePubSub struct {
+	server        *httptest.Server
+	mu            sync.Mutex
+	topics        map[string]bool
+	requests      [][]publishedMessage
+	authHeaders   []string
+	publishStatus int
+}
+
+func newFakePubSub(t *testing.T) *fakePubSub {
+	t.Helper()
+	f := &fakePubSub{topics: make(map[string]bool), publishStatus: http.StatusOK}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakePubSub) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.authHeaders = append(f.authHeaders, r.Header.Get("Authorization"))
+	topic, publish := strings.CutSuffix(r.URL.Path, ":publish")
+
+	switch {
+	case publish && r.Method == http.MethodPost:
+		if f.publishStatus != http.StatusOK {
+			w.WriteHeader(f.publishStatus)
+			w.Write([]byte(`{"error":{"code":403,"message":"permission denied on topic","status":"PERMISSION_DENIED"}}`))
+			return
+		}
+		var body struct {
+			Messages []publishedMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.requests = append(f.requests, body.Messages)
+		ids := make([]string, len(body.Messages))
+		for i := range ids {
+			ids[i] = string(rune('a' + i))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"messageIds": ids})
+	case r.Method == http.MethodGet:
+		if !f.topics[topic] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"name": topic})
+	case r.Method == http.MethodPut:
+		f.topics[topic] = true
+		json.NewEncoder(w).Encode(map[string]string{"name": topic})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakePubSub) published() [][]publishedMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]publishedMessage(nil), f.requests...)
+}
+
+func TestGoogleCloudConnectorPublishesToEmulator(t *testing.T) {
+	fake := newFakePubSub(t)
+
+	connector, err := NewGoogleCloudConnector(&config.GCPConfig{
+		ProjectID:    "heimdal-test",
+		TopicID:      "sensor-data",
+		EmulatorHost: strings.TrimPrefix(fake.server.URL, "http://"),
+		SensorID:     "sensor-01",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connector: %v", err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer connector.Disconnect()
+
+	if !fake.topics["/v1/projects/heimdal-test/topics/sensor-data"] {
+		t.Error("Expected the missing topic to be created on the emulator")
+	}
+
+	profile := &database.BehavioralProfile{MAC: "aa:bb:cc:dd:ee:ff", TotalPackets: 7}
+	if err := connector.SendProfile(profile, DeviceTypeDesktop); err != nil {
+		t.Fatalf("SendProfile failed: %v", err)
+	}
+
+	requests := fake.published()
+	if len(requests) != 1 || len(requests[0]) != 1 {
+		t.Fatalf("Expected one request with one message, got %v", requests)
+	}
+	msg := requests[0][0]
+	if msg.OrderingKey != "sensor-01" {
+		t.Errorf("Expected ordering key sensor-01, got %q", msg.OrderingKey)
+	}
+	if msg.Attributes["message_type"] != "profile" || msg.Attributes["device_type"] != "desktop" || msg.Attributes["mac_address"] != profile.MAC {
+		t.Errorf("Unexpected attributes: %v", msg.Attributes)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(msg.Data)
+	if err != nil {
+		t.Fatalf("Message data is not base64: %v", err)
+	}
+	envelope, err := schemas.DeserializeMessage(data)
+	if err != nil {
+		t.Fatalf("Failed to decode envelope: %v", err)
+	}
+	if envelope.MessageType != schemas.MessageTypeProfile || envelope.SensorID != "sensor-01" || envelope.SensorType != "desktop" {
+		t.Errorf("Unexpected envelope: %+v", envelope)
+	}
+
+	for _, header := range fake.authHeaders {
+		if header != "" {
+			t.Errorf("Expected no authentication against the emulator, got %q", header)
+		}
+	}
+}
+
+func TestPubSubPublisherBatchesWithSignedToken(t *testing.T) {
+	t.Setenv("PUBSUB_EMULATOR_HOST", "")
+	fake := newFakePubSub(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	credentials, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "sensor@heimdal-test.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+	})
+	credentialsPath := filepath.Join(t.TempDir(), "service-account.json")
+	if err := os.WriteFile(credentialsPath, credentials, 0600); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+
+	cfg := DefaultPubSubConfig()
+	cfg.ProjectID = "heimdal-test"
+	cfg.TopicID = "sensor-data"
+	cfg.CredentialsPath = credentialsPath
+	cfg.Endpoint = fake.server.URL
+	cfg.OrderingKey = "sensor-01"
+	cfg.BatchDelay = 200 * time.Millisecond
+
+	publisher, err := NewPubSubPublisher(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+	defer publisher.Stop()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- publisher.Publish(&PubSubMessage{Data: []byte{byte(i)}})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Publish failed: %v", err)
+		}
+	}
+
+	requests := fake.published()
+	if len(requests) != 1 || len(requests[0]) != 5 {
+		t.Fatalf("Expected the 5 messages in a single batch, got %d requests", len(requests))
+	}
+
+	// The bearer token is an RS256 JWT signed with the service account key
+	parts := strings.Split(strings.TrimPrefix(fake.authHeaders[0], "Bearer "), ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a JWT bearer token, got %q", fake.authHeaders[0])
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Token signature does not verify: %v", err)
+	}
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	json.Unmarshal(claimsJSON, &claims)
+	if claims["iss"] != "sensor@heimdal-test.iam.gserviceaccount.com" || claims["aud"] != "https://pubsub.googleapis.com/" {
+		t.Errorf("Unexpected claims: %v", claims)
+	}
+
+	// A rejected publish is reported to the caller with the API's message
+	fake.mu.Lock()
+	fake.publishStatus = http.StatusForbidden
+	fake.mu.Unlock()
+	err = publisher.Publish(&PubSubMessage{Data: []byte("denied")})
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Expected permission error, got %v", err)
+	}
+
+	publisher.Stop()
+	if err := publisher.Publish(&PubSubMessage{Data: []byte("late")}); err != ErrPublisherStopped {
+		t.Errorf("Expected ErrPublisherStopped after Stop, got %v", err)
+	}
+}
+
+func TestNewPubSubPublisherRequiresCredentials(t *testing.T) {
+	t.Setenv("PUBSUB_EMULATOR_HOST", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	cfg := DefaultPubSubConfig()
+	cfg.ProjectID = "heimdal-test"
+	cfg.TopicID = "sensor-data"
+	if _, err := NewPubSubPublisher(cfg); err == nil {
+		t.Fatal("Expected an error without credentials or emulator")
+	}
+}
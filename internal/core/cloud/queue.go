@@ -0,0 +1,355 @@
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+const (
+	// QueuePrefix is the storage key prefix for queued transmissions. Keys
+	// embed a zero-padded sequence number so they sort in enqueue order.
+	QueuePrefix = "cloudqueue:item:"
+
+	// DeadLetterPrefix is the storage key prefix for transmissions that
+	// exceeded their retries
+	DeadLetterPrefix = "cloudqueue:dead:"
+)
+
+// QueueItem is a transmission waiting in a Queue. The payload is kept
+// serialized so items of any type survive a restart.
+type QueueItem struct {
+	ID         uint64          `json:"id"`
+	Type       string          `json:"type"`
+	DeviceType DeviceType      `json:"device_type,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+	Enqueued   time.Time       `json:"enqueued"`
+	Retries    int             `json:"retries"`
+	LastError  string          `json:"last_error,omitempty"`
+}
+
+// QueueConfig contains configuration for a transmission queue
+type QueueConfig struct {
+	// MaxItems bounds the queue; the oldest items are evicted first
+	MaxItems int
+	// MaxDeadLetters bounds the dead-letter area; the oldest are removed first
+	MaxDeadLetters int
+}
+
+// DefaultQueueConfig returns a queue configuration with sensible defaults
+func DefaultQueueConfig() *QueueConfig {
+	return &QueueConfig{
+		MaxItems:       10000,
+		MaxDeadLetters: 1000,
+	}
+}
+
+// QueueStats summarizes the state of a queue for health reporting
+type QueueStats struct {
+	Depth            int     `json:"depth"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+	DeadLetters      int     `json:"dead_letters"`
+	Evicted          int64   `json:"evicted"` // Since startup
+	Durable          bool    `json:"durable"`
+}
+
+// Queue is a bounded FIFO of transmissions with a dead-letter area. With a
+// storage provider every change is written through, so queued items survive
+// restarts and outages; without one the queue only lives in memory.
+type Queue struct {
+	storage        platform.StorageProvider
+	maxItems       int
+	maxDeadLetters int
+	items          []*QueueItem // Oldest first
+	dead           []*QueueItem // Oldest first
+	nextID         uint64
+	evicted        int64
+	mu             sync.Mutex
+}
+
+// NewQueue creates a queue, loading items and dead letters left in storage by
+// a previous run. storage may be nil for a memory-only queue.
+func NewQueue(storage platform.StorageProvider, cfg *QueueConfig) (*Queue, error) {
+	if cfg == nil {
+		cfg = DefaultQueueConfig()
+	}
+	if cfg.MaxItems <= 0 {
+		return nil, fmt.Errorf("max items must be positive, got %d", cfg.MaxItems)
+	}
+	if cfg.MaxDeadLetters < 0 {
+		return nil, fmt.Errorf("max dead letters must be non-negative, got %d", cfg.MaxDeadLetters)
+	}
+
+	q := &Queue{
+		storage:        storage,
+		maxItems:       cfg.MaxItems,
+		maxDeadLetters: cfg.MaxDeadLetters,
+		items:          make([]*QueueItem, 0),
+		dead:           make([]*QueueItem, 0),
+		nextID:         1,
+	}
+	if storage == nil {
+		return q, nil
+	}
+
+	var err error
+	if q.items, err = q.load(QueuePrefix); err != nil {
+		return nil, err
+	}
+	if q.dead, err = q.load(DeadLetterPrefix); err != nil {
+		return nil, err
+	}
+	for _, item := range append(q.items, q.dead...) {
+		if item.ID >= q.nextID {
+			q.nextID = item.ID + 1
+		}
+	}
+
+	// A smaller limit than the previous run evicts the excess now
+	q.trimLocked()
+	if len(q.items) > 0 || len(q.dead) > 0 {
+		log.Printf("[CloudQueue] Restored %d queued items and %d dead letters", len(q.items), len(q.dead))
+	}
+
+	return q, nil
+}
+
+// load reads the items stored under prefix, oldest first
+func (q *Queue) load(prefix string) ([]*QueueItem, error) {
+	keys, err := q.storage.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", strings.TrimSuffix(prefix, ":"), err)
+	}
+
+	items := make([]*QueueItem, 0, len(keys))
+	for _, key := range keys {
+		data, err := q.storage.Get(key)
+		if err != nil {
+			log.Printf("[CloudQueue] Failed to load %s: %v", key, err)
+			continue
+		}
+		var item QueueItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			log.Printf("[CloudQueue] Failed to decode %s: %v", key, err)
+			continue
+		}
+		items = append(items, &item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+// Push appends an item, evicting the oldest items when the queue is full
+func (q *Queue) Push(itemType string, deviceType DeviceType, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", itemType, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item := &QueueItem{
+		ID:         q.nextID,
+		Type:       itemType,
+		DeviceType: deviceType,
+		Payload:    data,
+		Enqueued:   time.Now(),
+	}
+	if err := q.put(QueuePrefix, item); err != nil {
+		return err
+	}
+	q.nextID++
+	q.items = append(q.items, item)
+
+	q.trimLocked()
+	return nil
+}
+
+// Peek returns a copy of the oldest item, or nil when the queue is empty
+func (q *Queue) Peek() *QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil
+	}
+	item := *q.items[0]
+	return &item
+}
+
+// Remove deletes the item with the given ID, typically after it was sent
+func (q *Queue) Remove(id uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if i := q.indexLocked(id); i >= 0 {
+		q.delete(QueuePrefix, id)
+		q.items = append(q.items[:i], q.items[i+1:]...)
+	}
+}
+
+// MarkFailed records a failed transmission attempt and returns the item's
+// retry count
+func (q *Queue) MarkFailed(id uint64, cause error) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexLocked(id)
+	if i < 0 {
+		return 0
+	}
+	item := q.items[i]
+	item.Retries++
+	if cause != nil {
+		item.LastError = cause.Error()
+	}
+	if err := q.put(QueuePrefix, item); err != nil {
+		log.Printf("[CloudQueue] Failed to persist retry count: %v", err)
+	}
+	return item.Retries
+}
+
+// DeadLetter moves an item out of the queue into the dead-letter area, where
+// it is kept for inspection instead of being retried
+func (q *Queue) DeadLetter(id uint64, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexLocked(id)
+	if i < 0 {
+		return
+	}
+	item := q.items[i]
+	q.items = append(q.items[:i], q.items[i+1:]...)
+	if reason != "" {
+		item.LastError = reason
+	}
+
+	if q.maxDeadLetters == 0 {
+		q.delete(QueuePrefix, id)
+		return
+	}
+
+	// Write the dead letter before removing the queued item so a crash in
+	// between cannot lose it
+	if err := q.put(DeadLetterPrefix, item); err != nil {
+		log.Printf("[CloudQueue] Failed to store dead letter: %v", err)
+	}
+	q.delete(QueuePrefix, id)
+	q.dead = append(q.dead, item)
+
+	q.trimLocked()
+}
+
+// DeadLetters returns copies of the dead-lettered items, oldest first
+func (q *Queue) DeadLetters() []*QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result := make([]*QueueItem, 0, len(q.dead))
+	for _, item := range q.dead {
+		c := *item
+		result = append(result, &c)
+	}
+	return result
+}
+
+// Len returns the number of queued items, excluding dead letters
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Stats returns the queue's depth, age and dead-letter count
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := QueueStats{
+		Depth:       len(q.items),
+		DeadLetters: len(q.dead),
+		Evicted:     q.evicted,
+		Durable:     q.storage != nil,
+	}
+	if len(q.items) > 0 {
+		stats.OldestAgeSeconds = time.Since(q.items[0].Enqueued).Seconds()
+	}
+	return stats
+}
+
+// trimLocked evicts the oldest items and dead letters beyond the limits.
+// Caller must hold the lock.
+func (q *Queue) trimLocked() {
+	if excess := len(q.items) - q.maxItems; excess > 0 {
+		log.Printf("[CloudQueue] Queue full, evicting %d oldest items", excess)
+		q.deleteAll(QueuePrefix, q.items[:excess])
+		q.items = append(q.items[:0], q.items[excess:]...)
+		q.evicted += int64(excess)
+	}
+	if excess := len(q.dead) - q.maxDeadLetters; excess > 0 {
+		q.deleteAll(DeadLetterPrefix, q.dead[:excess])
+		q.dead = append(q.dead[:0], q.dead[excess:]...)
+	}
+}
+
+// indexLocked returns the position of the queued item with the given ID, or
+// -1. Caller must hold the lock.
+func (q *Queue) indexLocked(id uint64) int {
+	i := sort.Search(len(q.items), func(i int) bool { return q.items[i].ID >= id })
+	if i < len(q.items) && q.items[i].ID == id {
+		return i
+	}
+	return -1
+}
+
+// put writes an item under prefix
+func (q *Queue) put(prefix string, item *QueueItem) error {
+	if q.storage == nil {
+		return nil
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue item: %w", err)
+	}
+	if err := q.storage.Set(queueKey(prefix, item.ID), data); err != nil {
+		return fmt.Errorf("failed to store queue item: %w", err)
+	}
+	return nil
+}
+
+// delete removes an item stored under prefix
+func (q *Queue) delete(prefix string, id uint64) {
+	if q.storage == nil {
+		return
+	}
+	if err := q.storage.Delete(queueKey(prefix, id)); err != nil {
+		log.Printf("[CloudQueue] Failed to delete queue item %d: %v", id, err)
+	}
+}
+
+// deleteAll removes several items stored under prefix in one batch
+func (q *Queue) deleteAll(prefix string, items []*QueueItem) {
+	if q.storage == nil || len(items) == 0 {
+		return
+	}
+	ops := make([]platform.BatchOp, 0, len(items))
+	for _, item := range items {
+		ops = append(ops, platform.BatchOp{Type: platform.BatchOpDelete, Key: queueKey(prefix, item.ID)})
+	}
+	if err := q.storage.Batch(ops); err != nil {
+		log.Printf("[CloudQueue] Failed to delete evicted items: %v", err)
+	}
+}
+
+// queueKey returns the storage key of an item under prefix
+func queueKey(prefix string, id uint64) string {
+	return fmt.Sprintf("%s%020d", prefix, id)
+}
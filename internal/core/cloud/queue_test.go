@@ -0,0 +1,160 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+func newQueueStorage(t *testing.T) *mocks.MockStorageProvider {
+	t.Helper()
+	storage := mocks.NewMockStorageProvider()
+	if err := storage.Open("", nil); err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	return storage
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	storage := newQueueStorage(t)
+
+	queue, err := NewQueue(storage, DefaultQueueConfig())
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	for _, mac := range []string{"aa:00", "aa:01", "aa:02"} {
+		if err := queue.Push("anomaly", DeviceTypeHardware, &AnomalyData{DeviceMAC: mac}); err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+	}
+	first := queue.Peek()
+	queue.Remove(first.ID)
+	second := queue.Peek()
+	queue.MarkFailed(second.ID, errors.New("broker unavailable"))
+	queue.DeadLetter(second.ID, "")
+
+	// A new queue over the same storage sees exactly what was left
+	reopened, err := NewQueue(storage, DefaultQueueConfig())
+	if err != nil {
+		t.Fatalf("Reopening queue failed: %v", err)
+	}
+	if reopened.Len() != 1 {
+		t.Fatalf("Expected 1 queued item after restart, got %d", reopened.Len())
+	}
+	if item := reopened.Peek(); item.Type != "anomaly" || item.DeviceType != DeviceTypeHardware || string(item.Payload) == "" {
+		t.Errorf("Unexpected restored item: %+v", item)
+	}
+	dead := reopened.DeadLetters()
+	if len(dead) != 1 || dead[0].Retries != 1 || dead[0].LastError != "broker unavailable" {
+		t.Errorf("Unexpected dead letters after restart: %+v", dead)
+	}
+
+	// IDs continue after the restored ones so keys keep sorting in order
+	if err := reopened.Push("device", DeviceTypeHardware, &DeviceData{}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	reopened.Remove(reopened.Peek().ID)
+	if item := reopened.Peek(); item.Type != "device" || item.ID <= dead[0].ID {
+		t.Errorf("Expected the new item after the restored ones, got %+v", item)
+	}
+}
+
+func TestQueueEvictsOldestWhenFull(t *testing.T) {
+	storage := newQueueStorage(t)
+
+	queue, err := NewQueue(storage, &QueueConfig{MaxItems: 2, MaxDeadLetters: 1})
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		queue.Push("anomaly", DeviceTypeHardware, &AnomalyData{Type: string(rune('a' + i))})
+	}
+
+	stats := queue.Stats()
+	if stats.Depth != 2 || stats.Evicted != 1 || !stats.Durable {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	keys, _ := storage.List(QueuePrefix)
+	if len(keys) != 2 {
+		t.Errorf("Expected evicted item to be deleted from storage, %d keys remain", len(keys))
+	}
+
+	// The dead-letter area is bounded separately
+	queue.DeadLetter(queue.Peek().ID, "first")
+	queue.DeadLetter(queue.Peek().ID, "second")
+	if dead := queue.DeadLetters(); len(dead) != 1 || dead[0].LastError != "second" {
+		t.Errorf("Expected only the newest dead letter to be kept, got %+v", dead)
+	}
+	if stats := queue.Stats(); stats.Depth != 0 || stats.DeadLetters != 1 || stats.OldestAgeSeconds != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+// flakyConnector fails every send, optionally dropping its connection
+type flakyConnector struct {
+	*BaseConnector
+	disconnectOnSend bool
+	attempts         int
+}
+
+func (f *flakyConnector) Connect() error    { return nil }
+func (f *flakyConnector) Disconnect() error { return nil }
+
+func (f *flakyConnector) fail() error {
+	f.attempts++
+	if f.disconnectOnSend {
+		f.SetConnected(false)
+	}
+	return errors.New("send failed")
+}
+
+func (f *flakyConnector) SendProfile(*database.BehavioralProfile, DeviceType) error { return f.fail() }
+func (f *flakyConnector) SendDevice(*database.Device, DeviceType) error             { return f.fail() }
+func (f *flakyConnector) SendAnomaly(*AnomalyData, DeviceType) error                { return f.fail() }
+
+func TestBaseConnectorDeadLettersAfterMaxRetries(t *testing.T) {
+	connector := &flakyConnector{BaseConnector: NewBaseConnector(time.Minute)}
+	connector.retryDelay = time.Millisecond
+	connector.EnqueueAnomaly(&AnomalyData{DeviceMAC: "aa:bb", Type: "port_scan"}, DeviceTypeHardware)
+	if err := connector.SetQueueStorage(newQueueStorage(t), DefaultQueueConfig()); err != nil {
+		t.Fatalf("SetQueueStorage failed: %v", err)
+	}
+	connector.SetConnected(true)
+
+	connector.processQueue(connector)
+
+	if connector.attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", connector.attempts)
+	}
+	stats := connector.QueueStats()
+	if stats.Depth != 0 || stats.DeadLetters != 1 {
+		t.Errorf("Expected the item to be dead-lettered, got %+v", stats)
+	}
+	dead := connector.DeadLetters()
+	if len(dead) != 1 || dead[0].Type != "anomaly" || dead[0].LastError != "send failed" {
+		t.Errorf("Unexpected dead letters: %+v", dead)
+	}
+}
+
+func TestBaseConnectorKeepsItemsWhileDisconnected(t *testing.T) {
+	connector := &flakyConnector{BaseConnector: NewBaseConnector(time.Minute), disconnectOnSend: true}
+	connector.retryDelay = time.Millisecond
+	connector.EnqueueDevice(&database.Device{MAC: "aa:bb"}, DeviceTypeHardware)
+	connector.SetConnected(true)
+
+	connector.processQueue(connector)
+
+	if connector.attempts != 1 {
+		t.Errorf("Expected processing to stop after the connection dropped, got %d attempts", connector.attempts)
+	}
+	item := connector.DequeueNext()
+	if item == nil || item.Retries != 0 {
+		t.Fatalf("Expected the item to stay queued without using a retry, got %+v", item)
+	}
+	if device, ok := item.Data.(*DeviceData); !ok || device.Device.MAC != "aa:bb" {
+		t.Errorf("Unexpected decoded item: %+v", item.Data)
+	}
+}
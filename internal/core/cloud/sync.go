@@ -0,0 +1,90 @@
+package cloud
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// syncStatePrefix prefixes the storage keys of acknowledged entity versions
+const syncStatePrefix = "cloud:sync:"
+
+// SyncTracker remembers the version of each entity the cloud last
+// acknowledged, so a delta sync sends only entities that changed since. A
+// version is a fingerprint of the entity's content, which needs no change
+// counter in the entity itself and survives restarts when kept in storage.
+type SyncTracker struct {
+	storage  platform.StorageProvider
+	versions map[string]string // "<kind>:<id>" -> version
+	mu       sync.RWMutex
+}
+
+// NewSyncTracker creates a tracker, loading acknowledged versions from
+// storage. With nil storage versions are kept in memory only, so everything
+// is sent again after a restart.
+func NewSyncTracker(storage platform.StorageProvider) (*SyncTracker, error) {
+	t := &SyncTracker{
+		storage:  storage,
+		versions: make(map[string]string),
+	}
+	if storage == nil {
+		return t, nil
+	}
+
+	keys, err := storage.List(syncStatePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sync state: %w", err)
+	}
+	for _, key := range keys {
+		version, err := storage.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sync state %s: %w", key, err)
+		}
+		t.versions[strings.TrimPrefix(key, syncStatePrefix)] = string(version)
+	}
+	return t, nil
+}
+
+// Version returns the version of an entity: a hash of its JSON encoding
+func Version(entity interface{}) (string, error) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode entity: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// Changed reports whether an entity's version differs from the one last
+// acknowledged
+func (t *SyncTracker) Changed(kind, id, version string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.versions[SyncKey(kind, id)] != version
+}
+
+// Acknowledge records entity versions the cloud has accepted, keyed by SyncKey
+func (t *SyncTracker) Acknowledge(versions map[string]string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, version := range versions {
+		if t.storage != nil {
+			if err := t.storage.Set(syncStatePrefix+key, []byte(version)); err != nil {
+				return fmt.Errorf("failed to store sync state: %w", err)
+			}
+		}
+		t.versions[key] = version
+	}
+	return nil
+}
+
+// SyncKey returns the key of an entity in Acknowledge
+func SyncKey(kind, id string) string {
+	return kind + ":" + id
+}
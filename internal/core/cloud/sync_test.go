@@ -0,0 +1,43 @@
+package cloud
+
+import "testing"
+
+func TestSyncTrackerSendsOnlyChanges(t *testing.T) {
+	storage := newQueueStorage(t)
+
+	tracker, err := NewSyncTracker(storage)
+	if err != nil {
+		t.Fatalf("NewSyncTracker failed: %v", err)
+	}
+
+	v1, err := Version(map[string]string{"mac": "aa:bb:cc:dd:ee:ff", "name": "printer"})
+	if err != nil {
+		t.Fatalf("Version failed: %v", err)
+	}
+	if !tracker.Changed("device", "aa:bb:cc:dd:ee:ff", v1) {
+		t.Error("Expected a never-sent device to count as changed")
+	}
+	if err := tracker.Acknowledge(map[string]string{SyncKey("device", "aa:bb:cc:dd:ee:ff"): v1}); err != nil {
+		t.Fatalf("Acknowledge failed: %v", err)
+	}
+	if tracker.Changed("device", "aa:bb:cc:dd:ee:ff", v1) {
+		t.Error("Expected an acknowledged device to be unchanged")
+	}
+
+	v2, _ := Version(map[string]string{"mac": "aa:bb:cc:dd:ee:ff", "name": "office printer"})
+	if v2 == v1 || !tracker.Changed("device", "aa:bb:cc:dd:ee:ff", v2) {
+		t.Error("Expected an edited device to count as changed")
+	}
+	if !tracker.Changed("profile", "aa:bb:cc:dd:ee:ff", v1) {
+		t.Error("Expected kinds to be tracked separately")
+	}
+
+	// Acknowledged versions survive a restart
+	restarted, err := NewSyncTracker(storage)
+	if err != nil {
+		t.Fatalf("NewSyncTracker after restart failed: %v", err)
+	}
+	if restarted.Changed("device", "aa:bb:cc:dd:ee:ff", v1) {
+		t.Error("Expected the acknowledged version to be restored")
+	}
+}
@@ -0,0 +1,421 @@
+package cloud
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/config"
+)
+
+const (
+	// WebhookSignatureHeader carries "sha256=<hex HMAC>" of the timestamp,
+	// a dot and the body, so receivers can check both origin and freshness
+	WebhookSignatureHeader = "X-Heimdal-Signature"
+
+	// WebhookTimestampHeader carries the Unix time the request was signed
+	WebhookTimestampHeader = "X-Heimdal-Timestamp"
+)
+
+// WebhookConfig contains configuration for a webhook publisher
+type WebhookConfig struct {
+	// URL receives the POSTs. It must be HTTPS unless the host is loopback.
+	URL string
+	// Secret signs each body with HMAC-SHA256; no signature is sent when empty
+	Secret string
+	// BearerToken is sent as "Authorization: Bearer <token>" when set
+	BearerToken string
+	// Headers are added to every request, e.g. a collector's API key header
+	Headers map[string]string
+	// CAPath is a PEM bundle trusted for the endpoint in addition to the
+	// system roots, for collectors with a private CA
+	CAPath string
+	// Compress gzips request bodies (Content-Encoding: gzip). The signature
+	// covers the compressed bytes, so it can be checked before decompressing.
+	Compress bool
+
+	// A batch is sent when it holds BatchSize messages or BatchBytes of
+	// data, or BatchDelay after its first message, whichever comes first
+	BatchSize  int
+	BatchBytes int
+	BatchDelay time.Duration
+
+	// A failed POST is retried MaxRetries times, waiting RetryDelay and
+	// doubling it each time. Client errors other than 408 and 429 are not
+	// retried, since resending the same body cannot fix them.
+	MaxRetries     int
+	RetryDelay     time.Duration
+	RequestTimeout time.Duration
+
+	HTTPClient *http.Client
+}
+
+// DefaultWebhookConfig returns a webhook configuration with sensible defaults
+func DefaultWebhookConfig() *WebhookConfig {
+	return &WebhookConfig{
+		BatchSize:      50,
+		BatchBytes:     1024 * 1024,
+		BatchDelay:     100 * time.Millisecond,
+		MaxRetries:     3,
+		RetryDelay:     time.Second,
+		RequestTimeout: 30 * time.Second,
+	}
+}
+
+// WebhookPublisher POSTs messages to an HTTP endpoint. Concurrent publishes
+// are collected into batches sent as {"messages": [...]}, one batch at a
+// time so the receiver sees messages in publish order.
+type WebhookPublisher struct {
+	cfg    *WebhookConfig
+	client *http.Client
+
+	pending chan *pendingWebhookMessage
+	stopMu  sync.RWMutex
+	stopped bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// pendingWebhookMessage is a message waiting in the current batch
+type pendingWebhookMessage struct {
+	data json.RawMessage
+	done chan error
+}
+
+// NewWebhookPublisher creates a publisher and starts its batching goroutine
+func NewWebhookPublisher(cfg *WebhookConfig) (*WebhookPublisher, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("webhook configuration is required")
+	}
+	if err := config.ValidateWebhookURL(cfg.URL); err != nil {
+		return nil, err
+	}
+
+	defaults := DefaultWebhookConfig()
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaults.BatchSize
+	}
+	if cfg.BatchBytes <= 0 {
+		cfg.BatchBytes = defaults.BatchBytes
+	}
+	if cfg.BatchDelay <= 0 {
+		cfg.BatchDelay = defaults.BatchDelay
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaults.RetryDelay
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = defaults.RequestTimeout
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: cfg.RequestTimeout}
+		if cfg.CAPath != "" {
+			pool, err := loadCertPool(cfg.CAPath)
+			if err != nil {
+				return nil, err
+			}
+			client.Transport = &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			}
+		}
+	}
+
+	p := &WebhookPublisher{
+		cfg:     cfg,
+		client:  client,
+		pending: make(chan *pendingWebhookMessage, cfg.BatchSize),
+		stopCh:  make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.batchLoop()
+
+	return p, nil
+}
+
+// SignWebhook returns the signature header value for a request body signed
+// at the given Unix timestamp
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks a signature header against the body and timestamp,
+// rejecting timestamps further than maxSkew from now. Receivers written in
+// Go can use it directly; it also documents the scheme for others.
+func VerifyWebhook(secret, signature, timestamp string, body []byte, maxSkew time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp: %q", timestamp)
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > maxSkew || skew < -maxSkew {
+		return fmt.Errorf("webhook timestamp is %v from now", skew.Round(time.Second))
+	}
+	if !hmac.Equal([]byte(signature), []byte(SignWebhook(secret, timestamp, body))) {
+		return fmt.Errorf("webhook signature mismatch")
+	}
+	return nil
+}
+
+// Publish adds a JSON message to the current batch and waits until the
+// batch has been accepted by the endpoint
+func (p *WebhookPublisher) Publish(data []byte) error {
+	if !json.Valid(data) {
+		return fmt.Errorf("webhook message is not valid JSON")
+	}
+
+	pm := &pendingWebhookMessage{data: data, done: make(chan error, 1)}
+
+	p.stopMu.RLock()
+	if p.stopped {
+		p.stopMu.RUnlock()
+		return ErrPublisherStopped
+	}
+	p.pending <- pm
+	p.stopMu.RUnlock()
+
+	return <-pm.done
+}
+
+// PublishAll publishes several JSON messages at once, so they share
+// requests even though the caller does not publish concurrently. It waits
+// for all of them and returns the first error.
+func (p *WebhookPublisher) PublishAll(messages [][]byte) error {
+	pending := make([]*pendingWebhookMessage, 0, len(messages))
+	for _, data := range messages {
+		if !json.Valid(data) {
+			return fmt.Errorf("webhook message is not valid JSON")
+		}
+		pending = append(pending, &pendingWebhookMessage{data: data, done: make(chan error, 1)})
+	}
+
+	p.stopMu.RLock()
+	if p.stopped {
+		p.stopMu.RUnlock()
+		return ErrPublisherStopped
+	}
+	for _, pm := range pending {
+		p.pending <- pm
+	}
+	p.stopMu.RUnlock()
+
+	var firstErr error
+	for _, pm := range pending {
+		if err := <-pm.done; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stop sends any batched messages and stops the batching goroutine
+func (p *WebhookPublisher) Stop() {
+	p.stopMu.Lock()
+	if p.stopped {
+		p.stopMu.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.stopCh)
+	p.stopMu.Unlock()
+
+	p.wg.Wait()
+}
+
+// batchLoop collects pending messages into batches and sends them in order
+func (p *WebhookPublisher) batchLoop() {
+	defer p.wg.Done()
+
+	for {
+		var first *pendingWebhookMessage
+		select {
+		case first = <-p.pending:
+		case <-p.stopCh:
+			p.drain()
+			return
+		}
+
+		batch := []*pendingWebhookMessage{first}
+		size := len(first.data)
+		timer := time.NewTimer(p.cfg.BatchDelay)
+	collect:
+		for len(batch) < p.cfg.BatchSize && size < p.cfg.BatchBytes {
+			select {
+			case pm := <-p.pending:
+				batch = append(batch, pm)
+				size += len(pm.data)
+			case <-timer.C:
+				break collect
+			case <-p.stopCh:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		p.sendBatch(batch)
+	}
+}
+
+// drain sends messages enqueued before Stop, without retrying
+func (p *WebhookPublisher) drain() {
+	for {
+		batch := make([]*pendingWebhookMessage, 0)
+	collect:
+		for len(batch) < p.cfg.BatchSize {
+			select {
+			case pm := <-p.pending:
+				batch = append(batch, pm)
+			default:
+				break collect
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		p.sendBatch(batch)
+	}
+}
+
+// sendBatch POSTs a batch and reports the outcome to every message in it
+func (p *WebhookPublisher) sendBatch(batch []*pendingWebhookMessage) {
+	request := struct {
+		Messages []json.RawMessage `json:"messages"`
+	}{Messages: make([]json.RawMessage, 0, len(batch))}
+	for _, pm := range batch {
+		request.Messages = append(request.Messages, pm.data)
+	}
+
+	body, err := json.Marshal(request)
+	if err == nil && p.cfg.Compress {
+		body, err = gzipBody(body)
+	}
+	if err == nil {
+		err = p.post(body)
+	}
+	for _, pm := range batch {
+		pm.done <- err
+	}
+}
+
+// post sends a body, retrying transient failures with exponential backoff.
+// Retries stop early when the publisher is stopped.
+func (p *WebhookPublisher) post(body []byte) error {
+	delay := p.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := p.postOnce(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= p.cfg.MaxRetries {
+			return err
+		}
+
+		log.Printf("[Webhook] POST failed, retrying in %v (attempt %d/%d): %v", delay, attempt+1, p.cfg.MaxRetries, err)
+		select {
+		case <-time.After(delay):
+		case <-p.stopCh:
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// postOnce sends a body once and reports whether a failure is worth retrying
+func (p *WebhookPublisher) postOnce(body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	for name, value := range p.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.cfg.Compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if p.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.BearerToken)
+	}
+	if p.cfg.Secret != "" {
+		// Re-signed on every attempt so retries are not rejected as stale
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(p.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return true, err
+	case resp.StatusCode >= 500:
+		return true, err
+	default:
+		return false, err
+	}
+}
+
+// gzipBody compresses a request body
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, fmt.Errorf("failed to compress webhook body: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress webhook body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// loadCertPool returns the system roots plus the certificates in a PEM file
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,195 @@
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// WebhookConnector implements Connector for self-hosted collectors, POSTing
+// schemas.CloudMessage envelopes to an HTTPS endpoint through a
+// WebhookPublisher
+type WebhookConnector struct {
+	*BaseConnector
+	sensorID   string
+	webhookCfg *WebhookConfig
+	publisher  *WebhookPublisher
+}
+
+// NewWebhookConnector creates a new webhook connector
+func NewWebhookConnector(cfg *config.WebhookConfig) (*WebhookConnector, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("webhook configuration is required")
+	}
+	if err := config.ValidateWebhookURL(cfg.URL); err != nil {
+		return nil, err
+	}
+
+	sensorID := cfg.SensorID
+	if sensorID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("webhook sensor ID is required when the hostname is unavailable: %w", err)
+		}
+		sensorID = hostname
+	}
+
+	return &WebhookConnector{
+		BaseConnector: NewBaseConnector(5 * time.Minute),
+		sensorID:      sensorID,
+		webhookCfg:    NewWebhookConfig(cfg),
+	}, nil
+}
+
+// NewWebhookConfig converts the webhook section of the sensor
+// configuration into a publisher configuration
+func NewWebhookConfig(cfg *config.WebhookConfig) *WebhookConfig {
+	webhookCfg := DefaultWebhookConfig()
+	webhookCfg.URL = cfg.URL
+	webhookCfg.Secret = cfg.Secret
+	webhookCfg.BearerToken = cfg.BearerToken
+	webhookCfg.Headers = cfg.Headers
+	webhookCfg.CAPath = cfg.CAPath
+	webhookCfg.Compress = cfg.Compress
+	if cfg.BatchSize > 0 {
+		webhookCfg.BatchSize = cfg.BatchSize
+	}
+	if cfg.BatchDelayMs > 0 {
+		webhookCfg.BatchDelay = time.Duration(cfg.BatchDelayMs) * time.Millisecond
+	}
+	if cfg.MaxRetries > 0 {
+		webhookCfg.MaxRetries = cfg.MaxRetries
+	}
+	return webhookCfg
+}
+
+// Connect starts the publisher. Nothing is sent until there is data, so an
+// unreachable collector surfaces as failed transmissions, which are queued.
+func (w *WebhookConnector) Connect() error {
+	log.Printf("[Webhook] Connecting to %s...", w.webhookCfg.URL)
+
+	publisher, err := NewWebhookPublisher(w.webhookCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook publisher: %w", err)
+	}
+
+	w.publisher = publisher
+	w.SetConnected(true)
+	log.Println("[Webhook] Connected")
+
+	// Start transmission loop
+	w.StartTransmissionLoop(w)
+
+	return nil
+}
+
+// Disconnect stops the publisher after sending any batched messages
+func (w *WebhookConnector) Disconnect() error {
+	log.Println("[Webhook] Disconnecting...")
+
+	// Stop transmission loop
+	w.StopTransmissionLoop()
+
+	if w.publisher != nil {
+		w.publisher.Stop()
+	}
+
+	w.SetConnected(false)
+	log.Println("[Webhook] Disconnected")
+
+	return nil
+}
+
+// SendProfile posts a behavioral profile with device type metadata
+func (w *WebhookConnector) SendProfile(profile *database.BehavioralProfile, deviceType DeviceType) error {
+	if profile == nil {
+		return fmt.Errorf("profile is nil")
+	}
+
+	msg := w.Anonymizer().AnonymizeProfile(schemas.ProfileToMessage(profile))
+	if err := w.publish(schemas.MessageTypeProfile, msg, deviceType); err != nil {
+		return err
+	}
+
+	log.Printf("[Webhook] Sent profile for MAC: %s (device type: %s)", profile.MAC, deviceType)
+	return nil
+}
+
+// SendDevice posts device information with device type metadata
+func (w *WebhookConnector) SendDevice(device *database.Device, deviceType DeviceType) error {
+	if device == nil {
+		return fmt.Errorf("device is nil")
+	}
+
+	msg := w.Anonymizer().AnonymizeDevice(schemas.DeviceToMessage(device, w.sensorID, "", ""))
+	if err := w.publish(schemas.MessageTypeDevice, msg, deviceType); err != nil {
+		return err
+	}
+
+	log.Printf("[Webhook] Sent device: %s (%s) (device type: %s)", device.MAC, device.IP, deviceType)
+	return nil
+}
+
+// SendAnomaly posts an anomaly alert with device type metadata
+func (w *WebhookConnector) SendAnomaly(anomaly *AnomalyData, deviceType DeviceType) error {
+	if anomaly == nil {
+		return fmt.Errorf("anomaly is nil")
+	}
+
+	msg := w.Anonymizer().AnonymizeAnomaly(&schemas.AnomalyMessage{
+		DeviceMAC:   anomaly.DeviceMAC,
+		Type:        anomaly.Type,
+		Severity:    anomaly.Severity,
+		Description: anomaly.Description,
+		Timestamp:   anomaly.Timestamp,
+		Evidence:    anomaly.Evidence,
+	})
+	if err := w.publish(schemas.MessageTypeAnomaly, msg, deviceType); err != nil {
+		return err
+	}
+
+	log.Printf("[Webhook] Sent anomaly: %s (device type: %s)", anomaly.Type, deviceType)
+	return nil
+}
+
+// publish wraps a payload in an envelope and posts it
+func (w *WebhookConnector) publish(messageType schemas.MessageType, payload interface{}, deviceType DeviceType) error {
+	if !w.IsConnected() {
+		return fmt.Errorf("webhook connector is not connected")
+	}
+
+	msg, err := schemas.WrapMessage(messageType, w.sensorID, payload)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", messageType, err)
+	}
+	msg.SensorType = string(deviceType)
+	data, err := schemas.SerializeMessage(msg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", messageType, err)
+	}
+
+	if err := w.publisher.Publish(data); err != nil {
+		return fmt.Errorf("failed to post %s: %w", messageType, err)
+	}
+	return nil
+}
+
+// Start begins the webhook connector operations
+func (w *WebhookConnector) Start() error {
+	return w.Connect()
+}
+
+// Stop gracefully stops the webhook connector
+func (w *WebhookConnector) Stop() error {
+	return w.Disconnect()
+}
+
+// Name returns the component name
+func (w *WebhookConnector) Name() string {
+	return "Webhook Connector"
+}
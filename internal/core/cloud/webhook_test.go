@@ -0,0 +1,214 @@
+package cloud
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// fakeCollector is a stand-in for a customer's webhook collector
+type fakeCollector struct {
+	server   *httptest.Server
+	secret   string
+	mu       sync.Mutex
+	requests []*http.Request
+	batches  [][]json.RawMessage
+	failures int // Requests to answer with 503 before accepting
+}
+
+func newFakeCollector(t *testing.T, secret string) *fakeCollector {
+	t.Helper()
+	f := &fakeCollector{secret: secret}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeCollector) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r)
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if f.secret != "" {
+		if err := VerifyWebhook(f.secret, r.Header.Get(WebhookSignatureHeader), r.Header.Get(WebhookTimestampHeader), body, time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, _ = io.ReadAll(zr)
+	}
+
+	var request struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.batches = append(f.batches, request.Messages)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (f *fakeCollector) received() [][]json.RawMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]json.RawMessage(nil), f.batches...)
+}
+
+func TestWebhookConnectorPostsSignedEnvelopes(t *testing.T) {
+	collector := newFakeCollector(t, "s3cret")
+
+	connector, err := NewWebhookConnector(&config.WebhookConfig{
+		URL:         collector.server.URL + "/ingest",
+		Secret:      "s3cret",
+		BearerToken: "token-1",
+		Headers:     map[string]string{"X-Tenant": "lab"},
+		SensorID:    "sensor-01",
+		Compress:    true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connector: %v", err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer connector.Disconnect()
+
+	profile := &database.BehavioralProfile{MAC: "aa:bb:cc:dd:ee:ff", TotalPackets: 7}
+	if err := connector.SendProfile(profile, DeviceTypeHardware); err != nil {
+		t.Fatalf("SendProfile failed: %v", err)
+	}
+
+	batches := collector.received()
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatalf("Expected one request with one message, got %v", batches)
+	}
+	envelope, err := schemas.DeserializeMessage(batches[0][0])
+	if err != nil {
+		t.Fatalf("Failed to decode envelope: %v", err)
+	}
+	if envelope.MessageType != schemas.MessageTypeProfile || envelope.SensorID != "sensor-01" || envelope.SensorType != "hardware" {
+		t.Errorf("Unexpected envelope: %+v", envelope)
+	}
+
+	collector.mu.Lock()
+	r := collector.requests[0]
+	collector.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token-1" || r.Header.Get("X-Tenant") != "lab" {
+		t.Errorf("Expected bearer token and custom header, got %v", r.Header)
+	}
+
+	if _, err := NewWebhookConnector(&config.WebhookConfig{URL: "http://collector.example.com/ingest"}); err == nil {
+		t.Error("Expected plain HTTP to a remote host to be rejected")
+	}
+}
+
+func TestWebhookPublisherBatchesAndRetries(t *testing.T) {
+	collector := newFakeCollector(t, "")
+	collector.failures = 2
+
+	cfg := DefaultWebhookConfig()
+	cfg.URL = collector.server.URL
+	cfg.BatchSize = 3
+	cfg.RetryDelay = 10 * time.Millisecond
+	publisher, err := NewWebhookPublisher(cfg)
+	if err != nil {
+		t.Fatalf("NewWebhookPublisher failed: %v", err)
+	}
+	defer publisher.Stop()
+
+	messages := make([][]byte, 0, 5)
+	for i := 0; i < 5; i++ {
+		messages = append(messages, []byte(`{"n":`+strconv.Itoa(i)+`}`))
+	}
+	if err := publisher.PublishAll(messages); err != nil {
+		t.Fatalf("PublishAll failed after retries: %v", err)
+	}
+
+	batches := collector.received()
+	if len(batches) != 2 || len(batches[0]) != 3 || len(batches[1]) != 2 {
+		t.Fatalf("Expected batches of 3 and 2, got %v", batches)
+	}
+	if string(batches[0][0]) != `{"n":0}` || string(batches[1][1]) != `{"n":4}` {
+		t.Errorf("Expected messages in publish order, got %v", batches)
+	}
+
+	// Rejections other than 408 and 429 are final
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown tenant", http.StatusForbidden)
+	}))
+	defer rejecting.Close()
+
+	var attempts int
+	cfg = DefaultWebhookConfig()
+	cfg.URL = rejecting.URL
+	cfg.RetryDelay = 10 * time.Millisecond
+	cfg.HTTPClient = &http.Client{Transport: countingTransport{&attempts}}
+	publisher, err = NewWebhookPublisher(cfg)
+	if err != nil {
+		t.Fatalf("NewWebhookPublisher failed: %v", err)
+	}
+	defer publisher.Stop()
+
+	if err := publisher.Publish([]byte(`{}`)); err == nil {
+		t.Error("Expected a 403 to fail the publish")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected no retries of a 403, got %d attempts", attempts)
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"messages":[]}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := SignWebhook("key", now, body)
+
+	if err := VerifyWebhook("key", signature, now, body, time.Minute); err != nil {
+		t.Errorf("Expected valid signature, got %v", err)
+	}
+	if err := VerifyWebhook("other", signature, now, body, time.Minute); err == nil {
+		t.Error("Expected a signature made with another secret to fail")
+	}
+	if err := VerifyWebhook("key", signature, now, []byte(`{"messages":[{}]}`), time.Minute); err == nil {
+		t.Error("Expected a modified body to fail")
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if err := VerifyWebhook("key", SignWebhook("key", old, body), old, body, time.Minute); err == nil {
+		t.Error("Expected a stale timestamp to fail")
+	}
+}
+
+// countingTransport counts requests made through the default transport
+type countingTransport struct {
+	count *int
+}
+
+func (c countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	*c.count++
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -0,0 +1,264 @@
+// Package command executes operations requested by the cloud.
+//
+// Commands arrive from a cloud transport (an MQTT subscription, a Pub/Sub
+// pull subscription or an HTTP long poll) as signed schemas.Command JSON. The
+// Dispatcher verifies each one against the trusted issuer keys, drops
+// redeliveries, runs the handler registered for its type and reports the
+// outcome to the cloud as a schemas.CommandAckMessage. Commands are executed
+// one at a time, in arrival order, off the transport's goroutine.
+package command
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+)
+
+// Handler performs a command. The returned values are reported in the
+// acknowledgement's result; an error reports the command as failed.
+type Handler func(ctx context.Context, cmd *schemas.Command) (map[string]interface{}, error)
+
+// Publisher sends acknowledgements to the cloud
+type Publisher interface {
+	SendMessage(messageType schemas.MessageType, payload interface{}) error
+}
+
+// Config contains configuration for the command dispatcher
+type Config struct {
+	// SensorID is matched against each command's target
+	SensorID string
+
+	// PublicKeys are the Ed25519 keys of trusted command issuers
+	PublicKeys []ed25519.PublicKey
+
+	// QueueSize is how many verified commands may wait for execution;
+	// commands arriving when it is full are rejected
+	QueueSize int
+
+	// HandlerTimeout bounds the execution of one command
+	HandlerTimeout time.Duration
+}
+
+// DefaultConfig returns a configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		QueueSize:      32,
+		HandlerTimeout: 2 * time.Minute,
+	}
+}
+
+// Dispatcher verifies and executes cloud commands and acknowledges them
+type Dispatcher struct {
+	config    *Config
+	publisher Publisher
+	handlers  map[schemas.CommandType]Handler
+	seen      map[string]time.Time // Command ID -> expiry, for dropping redeliveries
+	now       func() time.Time
+
+	queue  chan *schemas.Command
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+// NewDispatcher creates a dispatcher that acknowledges commands through publisher
+func NewDispatcher(publisher Publisher, cfg *Config) (*Dispatcher, error) {
+	if publisher == nil {
+		return nil, fmt.Errorf("publisher is required")
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.SensorID == "" {
+		return nil, fmt.Errorf("sensor ID is required")
+	}
+	if len(cfg.PublicKeys) == 0 {
+		return nil, fmt.Errorf("at least one trusted public key is required")
+	}
+
+	defaults := DefaultConfig()
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+	if cfg.HandlerTimeout <= 0 {
+		cfg.HandlerTimeout = defaults.HandlerTimeout
+	}
+
+	return &Dispatcher{
+		config:    cfg,
+		publisher: publisher,
+		handlers:  make(map[schemas.CommandType]Handler),
+		seen:      make(map[string]time.Time),
+		now:       time.Now,
+		queue:     make(chan *schemas.Command, cfg.QueueSize),
+	}, nil
+}
+
+// Register sets the handler for a command type. Commands of types without a
+// handler are rejected as unsupported.
+func (d *Dispatcher) Register(commandType schemas.CommandType, handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[commandType] = handler
+}
+
+// Start begins executing queued commands
+func (d *Dispatcher) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopCh != nil {
+		return fmt.Errorf("command dispatcher already running")
+	}
+	d.stopCh = make(chan struct{})
+
+	d.wg.Add(1)
+	go d.executeLoop(d.stopCh)
+
+	log.Printf("[Commands] Accepting commands for %s (%d handlers)", d.config.SensorID, len(d.handlers))
+	return nil
+}
+
+// Stop halts execution after the command in progress, if any
+func (d *Dispatcher) Stop() error {
+	d.mu.Lock()
+	stopCh := d.stopCh
+	d.stopCh = nil
+	d.mu.Unlock()
+
+	if stopCh == nil {
+		return nil
+	}
+	close(stopCh)
+	d.wg.Wait()
+	return nil
+}
+
+// Name returns the component name
+func (d *Dispatcher) Name() string {
+	return "Command Dispatcher"
+}
+
+// Deliver accepts a command as received from a transport. It never blocks:
+// the command is verified and queued, or rejected, before returning.
+func (d *Dispatcher) Deliver(data []byte) {
+	cmd, err := schemas.ParseCommand(data)
+	if err != nil {
+		// Without an ID there is nothing to acknowledge
+		log.Printf("[Commands] Dropped malformed command: %v", err)
+		return
+	}
+
+	if err := schemas.VerifyCommand(cmd, d.config.PublicKeys, d.config.SensorID, d.now()); err != nil {
+		if errors.Is(err, schemas.ErrCommandTarget) {
+			// Meant for another sensor sharing the channel
+			return
+		}
+		log.Printf("[Commands] Rejected %s %s: %v", cmd.Type, cmd.ID, err)
+		d.acknowledge(cmd, schemas.CommandRejected, err.Error(), nil)
+		return
+	}
+
+	if !d.markSeen(cmd) {
+		log.Printf("[Commands] Ignored redelivered command %s", cmd.ID)
+		return
+	}
+
+	d.mu.Lock()
+	_, supported := d.handlers[cmd.Type]
+	d.mu.Unlock()
+	if !supported {
+		log.Printf("[Commands] Rejected unsupported command %s (%s)", cmd.ID, cmd.Type)
+		d.acknowledge(cmd, schemas.CommandRejected, fmt.Sprintf("command type %s is not supported by this sensor", cmd.Type), nil)
+		return
+	}
+
+	select {
+	case d.queue <- cmd:
+	default:
+		log.Printf("[Commands] Rejected %s %s: queue full", cmd.Type, cmd.ID)
+		d.acknowledge(cmd, schemas.CommandRejected, "sensor is busy, too many pending commands", nil)
+	}
+}
+
+// markSeen records a command ID until the command expires, returning false
+// when it was already seen. Expired commands fail verification anyway, so
+// IDs can be forgotten once they expire.
+func (d *Dispatcher) markSeen(cmd *schemas.Command) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for id, expires := range d.seen {
+		if !now.Before(expires) {
+			delete(d.seen, id)
+		}
+	}
+
+	if _, seen := d.seen[cmd.ID]; seen {
+		return false
+	}
+	d.seen[cmd.ID] = cmd.ExpiresAt
+	return true
+}
+
+// executeLoop runs queued commands until stopCh is closed
+func (d *Dispatcher) executeLoop(stopCh chan struct{}) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case cmd := <-d.queue:
+			d.execute(cmd)
+		}
+	}
+}
+
+// execute runs a command's handler and acknowledges the outcome
+func (d *Dispatcher) execute(cmd *schemas.Command) {
+	d.mu.Lock()
+	handler := d.handlers[cmd.Type]
+	d.mu.Unlock()
+
+	// The command may have expired while waiting in the queue
+	if !d.now().Before(cmd.ExpiresAt) {
+		d.acknowledge(cmd, schemas.CommandRejected, schemas.ErrCommandExpired.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.HandlerTimeout)
+	defer cancel()
+
+	log.Printf("[Commands] Executing %s %s", cmd.Type, cmd.ID)
+	result, err := handler(ctx, cmd)
+	if err != nil {
+		log.Printf("[Commands] %s %s failed: %v", cmd.Type, cmd.ID, err)
+		d.acknowledge(cmd, schemas.CommandFailed, err.Error(), result)
+		return
+	}
+	d.acknowledge(cmd, schemas.CommandSucceeded, "", result)
+}
+
+// acknowledge reports a command's outcome. Acknowledgements that cannot be
+// sent are dropped; the issuer sees the command as unanswered.
+func (d *Dispatcher) acknowledge(cmd *schemas.Command, status schemas.CommandStatus, message string, result map[string]interface{}) {
+	ack := &schemas.CommandAckMessage{
+		CommandID: cmd.ID,
+		Type:      cmd.Type,
+		Status:    status,
+		Error:     message,
+		Result:    result,
+		Timestamp: d.now(),
+	}
+	if err := d.publisher.SendMessage(schemas.MessageTypeCommandAck, ack); err != nil {
+		log.Printf("[Commands] Failed to acknowledge %s: %v", cmd.ID, err)
+	}
+}
@@ -0,0 +1,141 @@
+package command
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+)
+
+// recordingPublisher records the acknowledgements sent
+type recordingPublisher struct {
+	mu   sync.Mutex
+	acks []*schemas.CommandAckMessage
+}
+
+func (p *recordingPublisher) SendMessage(messageType schemas.MessageType, payload interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ack, ok := payload.(*schemas.CommandAckMessage); ok && messageType == schemas.MessageTypeCommandAck {
+		p.acks = append(p.acks, ack)
+	}
+	return nil
+}
+
+func (p *recordingPublisher) waitForAck(t *testing.T, id string) *schemas.CommandAckMessage {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		p.mu.Lock()
+		for _, ack := range p.acks {
+			if ack.CommandID == id {
+				p.mu.Unlock()
+				return ack
+			}
+		}
+		p.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("No acknowledgement for %s", id)
+	return nil
+}
+
+func (p *recordingPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.acks)
+}
+
+func signedCommand(t *testing.T, key ed25519.PrivateKey, id string, commandType schemas.CommandType, params string) []byte {
+	t.Helper()
+	cmd := &schemas.Command{
+		ID:        id,
+		Version:   schemas.CommandSchemaVersion,
+		Type:      commandType,
+		SensorID:  "sensor-01",
+		IssuedAt:  time.Now(),
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	if params != "" {
+		cmd.Params = json.RawMessage(params)
+	}
+	schemas.SignCommand(cmd, key)
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("Failed to marshal command: %v", err)
+	}
+	return data
+}
+
+func TestDispatcherExecutesAndAcknowledges(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, forger, _ := ed25519.GenerateKey(nil)
+
+	publisher := &recordingPublisher{}
+	cfg := DefaultConfig()
+	cfg.SensorID = "sensor-01"
+	cfg.PublicKeys = []ed25519.PublicKey{pub}
+	dispatcher, err := NewDispatcher(publisher, cfg)
+	if err != nil {
+		t.Fatalf("NewDispatcher failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var targets []string
+	dispatcher.Register(schemas.CommandAddInterceptTarget, func(ctx context.Context, cmd *schemas.Command) (map[string]interface{}, error) {
+		var params schemas.InterceptTargetParams
+		if err := cmd.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		targets = append(targets, params.MAC)
+		mu.Unlock()
+		return map[string]interface{}{"targets": 1}, nil
+	})
+	dispatcher.Register(schemas.CommandRescan, func(ctx context.Context, cmd *schemas.Command) (map[string]interface{}, error) {
+		return nil, errors.New("scanner not running")
+	})
+
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer dispatcher.Stop()
+
+	add := signedCommand(t, priv, "cmd-1", schemas.CommandAddInterceptTarget, `{"mac":"aa:bb:cc:dd:ee:ff"}`)
+	dispatcher.Deliver(add)
+	if ack := publisher.waitForAck(t, "cmd-1"); ack.Status != schemas.CommandSucceeded || ack.Result["targets"] != 1 {
+		t.Errorf("Unexpected acknowledgement: %+v", ack)
+	}
+
+	// A redelivery is neither executed nor acknowledged again
+	dispatcher.Deliver(add)
+
+	dispatcher.Deliver(signedCommand(t, priv, "cmd-2", schemas.CommandRescan, ""))
+	if ack := publisher.waitForAck(t, "cmd-2"); ack.Status != schemas.CommandFailed || ack.Error != "scanner not running" {
+		t.Errorf("Expected failed acknowledgement, got %+v", ack)
+	}
+
+	dispatcher.Deliver(signedCommand(t, forger, "cmd-3", schemas.CommandAddInterceptTarget, `{"mac":"11:22:33:44:55:66"}`))
+	if ack := publisher.waitForAck(t, "cmd-3"); ack.Status != schemas.CommandRejected {
+		t.Errorf("Expected forged command to be rejected, got %+v", ack)
+	}
+
+	dispatcher.Deliver(signedCommand(t, priv, "cmd-4", schemas.CommandRotateLogs, ""))
+	if ack := publisher.waitForAck(t, "cmd-4"); ack.Status != schemas.CommandRejected {
+		t.Errorf("Expected unsupported command to be rejected, got %+v", ack)
+	}
+
+	if n := publisher.count(); n != 4 {
+		t.Errorf("Expected 4 acknowledgements, got %d", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(targets) != 1 || targets[0] != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("Expected the forged and redelivered commands not to run, got %v", targets)
+	}
+}
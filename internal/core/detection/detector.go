@@ -8,6 +8,7 @@ package detection
 import (
 	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
@@ -24,6 +25,7 @@ const (
 	AnomalyDormantDevice         AnomalyType = "dormant_device"
 	AnomalyProtocolShift         AnomalyType = "protocol_shift"
 	AnomalyDestinationSpike      AnomalyType = "destination_spike"
+	AnomalyThreatIntelMatch      AnomalyType = "threat_intel_match"
 )
 
 // Severity represents the severity level of an anomaly
@@ -50,6 +52,14 @@ type Anomaly struct {
 type Detector struct {
 	sensitivity       float64
 	baselineThreshold int64 // Minimum packets before establishing baseline
+
+	// Rules: built-in statistical checks plus user-defined rules from a rule file
+	builtins         []Rule
+	userRules        []Rule
+	registeredRules  []Rule // Added by other subsystems, kept across rule file reloads
+	disabledBuiltins map[string]bool
+	commonPorts      map[uint16]bool
+	rulesMu          sync.RWMutex
 }
 
 // Config contains configuration for the anomaly detector
@@ -60,6 +70,21 @@ type Config struct {
 
 	// BaselineThreshold is the minimum number of packets before establishing baseline
 	BaselineThreshold int64
+
+	// CommonPorts are destination ports never reported as unusual
+	CommonPorts []uint16
+}
+
+// DefaultCommonPorts returns the ports the unusual port check ignores by default
+func DefaultCommonPorts() []uint16 {
+	return []uint16{
+		80,   // HTTP
+		443,  // HTTPS
+		53,   // DNS
+		123,  // NTP
+		8080, // HTTP alternate
+		8443, // HTTPS alternate
+	}
 }
 
 // DefaultConfig returns a configuration with sensible defaults
@@ -67,6 +92,7 @@ func DefaultConfig() *Config {
 	return &Config{
 		Sensitivity:       0.5, // Medium sensitivity
 		BaselineThreshold: 100, // Require 100 packets for baseline
+		CommonPorts:       DefaultCommonPorts(),
 	}
 }
 
@@ -86,51 +112,110 @@ func NewDetector(cfg *Config) (*Detector, error) {
 		return nil, fmt.Errorf("baseline threshold must be non-negative, got %d", cfg.BaselineThreshold)
 	}
 
+	commonPorts := cfg.CommonPorts
+	if commonPorts == nil {
+		commonPorts = DefaultCommonPorts()
+	}
+
 	detector := &Detector{
 		sensitivity:       cfg.Sensitivity,
 		baselineThreshold: cfg.BaselineThreshold,
+		disabledBuiltins:  make(map[string]bool),
+		commonPorts:       portSet(commonPorts),
 	}
+	detector.builtins = detector.builtinRules()
 
 	return detector, nil
 }
 
 // Analyze examines a profile for anomalies
 func (d *Detector) Analyze(profile *database.BehavioralProfile) ([]*Anomaly, error) {
+	return d.AnalyzeDevice(profile, nil)
+}
+
+// AnalyzeDevice examines a profile for anomalies, giving user-defined rules
+// access to the discovered device (which may be nil)
+func (d *Detector) AnalyzeDevice(profile *database.BehavioralProfile, device *database.Device) ([]*Anomaly, error) {
 	if profile == nil {
 		return nil, fmt.Errorf("profile is nil")
 	}
 
 	anomalies := make([]*Anomaly, 0)
+	ctx := &RuleContext{Profile: profile, Device: device}
+
+	d.rulesMu.RLock()
+	builtins := d.builtins
+	disabled := d.disabledBuiltins
+	userRules := d.userRules
+	registered := d.registeredRules
+	d.rulesMu.RUnlock()
+
+	// Statistical checks need enough data for a baseline
+	if profile.TotalPackets >= d.baselineThreshold {
+		for _, rule := range builtins {
+			if disabled[rule.Name()] {
+				continue
+			}
+			anomalies = append(anomalies, rule.Evaluate(ctx)...)
+		}
+	}
 
-	// Check if we have enough data for baseline
-	if profile.TotalPackets < d.baselineThreshold {
-		// Not enough data yet, skip analysis
-		return anomalies, nil
+	// User-defined and registered rules express hard policy and apply from the first packet
+	for _, rule := range userRules {
+		anomalies = append(anomalies, rule.Evaluate(ctx)...)
+	}
+	for _, rule := range registered {
+		anomalies = append(anomalies, rule.Evaluate(ctx)...)
 	}
 
-	// Detect unexpected destinations
-	destAnomalies := d.detectUnexpectedDestinations(profile)
-	anomalies = append(anomalies, destAnomalies...)
+	return anomalies, nil
+}
 
-	// Detect unusual ports
-	portAnomalies := d.detectUnusualPorts(profile)
-	anomalies = append(anomalies, portAnomalies...)
+// SetRules replaces the user-defined rules, the disabled built-in checks and
+// the common port list in one step
+func (d *Detector) SetRules(rules []Rule, disabledBuiltins []string, commonPorts []uint16) {
+	disabled := make(map[string]bool, len(disabledBuiltins))
+	for _, name := range disabledBuiltins {
+		disabled[name] = true
+	}
+	if commonPorts == nil {
+		commonPorts = DefaultCommonPorts()
+	}
 
-	// Detect traffic spikes
-	spikeAnomalies := d.detectTrafficSpikes(profile)
-	anomalies = append(anomalies, spikeAnomalies...)
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+	d.userRules = rules
+	d.disabledBuiltins = disabled
+	d.commonPorts = portSet(commonPorts)
+}
 
-	// Detect protocol shifts (if baseline available)
-	if profile.Baseline != nil && profile.Baseline.SampleCount > 3 {
-		protocolAnomalies := d.detectProtocolShifts(profile)
-		anomalies = append(anomalies, protocolAnomalies...)
+// RegisterRule adds a rule that runs for every profile alongside the
+// user-defined rules. Registered rules are not affected by SetRules.
+func (d *Detector) RegisterRule(rule Rule) {
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+	d.registeredRules = append(d.registeredRules, rule)
+}
+
+// Rules returns the names of the active user-defined rules
+func (d *Detector) Rules() []string {
+	d.rulesMu.RLock()
+	defer d.rulesMu.RUnlock()
 
-		// Detect destination count anomalies
-		destAnomalies := d.detectDestinationAnomalies(profile)
-		anomalies = append(anomalies, destAnomalies...)
+	names := make([]string, 0, len(d.userRules))
+	for _, rule := range d.userRules {
+		names = append(names, rule.Name())
 	}
+	return names
+}
 
-	return anomalies, nil
+// portSet converts a port list to a lookup set
+func portSet(ports []uint16) map[uint16]bool {
+	set := make(map[uint16]bool, len(ports))
+	for _, port := range ports {
+		set[port] = true
+	}
+	return set
 }
 
 // detectUnexpectedDestinations identifies communication with unusual destinations
@@ -180,15 +265,9 @@ func (d *Detector) detectUnexpectedDestinations(profile *database.BehavioralProf
 func (d *Detector) detectUnusualPorts(profile *database.BehavioralProfile) []*Anomaly {
 	anomalies := make([]*Anomaly, 0)
 
-	// Define common ports
-	commonPorts := map[uint16]bool{
-		80:   true, // HTTP
-		443:  true, // HTTPS
-		53:   true, // DNS
-		123:  true, // NTP
-		8080: true, // HTTP alternate
-		8443: true, // HTTPS alternate
-	}
+	d.rulesMu.RLock()
+	commonPorts := d.commonPorts
+	d.rulesMu.RUnlock()
 
 	// Calculate total port usage
 	var totalPortUsage int
@@ -239,12 +318,18 @@ func (d *Detector) detectTrafficSpikes(profile *database.BehavioralProfile) []*A
 		avgPackets := profile.Baseline.AvgPacketsPerHour
 		stdDev := math.Sqrt(profile.Baseline.StdDevPacketsPerHour)
 
-		// Calculate current hourly rate
-		hoursSinceFirstSeen := time.Since(profile.FirstSeen).Hours()
-		if hoursSinceFirstSeen < 1 {
-			return anomalies
+		// Calculate current hourly rate, preferring the traffic of the last hour
+		// over the lifetime average when the profile carries a time series
+		var currentRate float64
+		if profile.LastHour != nil {
+			currentRate = float64(profile.LastHour.Packets)
+		} else {
+			hoursSinceFirstSeen := time.Since(profile.FirstSeen).Hours()
+			if hoursSinceFirstSeen < 1 {
+				return anomalies
+			}
+			currentRate = float64(profile.TotalPackets) / hoursSinceFirstSeen
 		}
-		currentRate := float64(profile.TotalPackets) / hoursSinceFirstSeen
 
 		// Detect spike using z-score
 		zScore := (currentRate - avgPackets) / (stdDev + 1) // +1 to avoid division by zero
@@ -460,6 +545,9 @@ func (d *Detector) detectDestinationAnomalies(profile *database.BehavioralProfil
 	}
 
 	currentDestCount := float64(len(profile.Destinations))
+	if profile.LastHour != nil {
+		currentDestCount = float64(profile.LastHour.UniqueDestinations)
+	}
 	avgDests := profile.Baseline.AvgUniqueDestinations
 	stdDev := math.Sqrt(profile.Baseline.StdDevDestinations)
 
@@ -0,0 +1,255 @@
+package detection
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// Domain anomaly types, raised from the DNS lookups recorded in a profile
+const (
+	AnomalyNewDomain    AnomalyType = "new_domain"
+	AnomalyDGADomain    AnomalyType = "dga_domain"
+	AnomalyNXDomainRate AnomalyType = "nxdomain_rate"
+)
+
+const (
+	// recentWindow is how far back from the profile's last packet a domain
+	// lookup or TLS client counts as recent
+	recentWindow = time.Hour
+
+	// learningPeriod is how long a device is observed before unfamiliar
+	// domains and TLS clients are reported
+	learningPeriod = 24 * time.Hour
+
+	// minNXDomainCount is the number of recently failed names required
+	// before the NXDOMAIN rate is evaluated
+	minNXDomainCount = 10
+)
+
+// detectNewDomains reports registrable domains first looked up in the last
+// hour by a device that has been observed past its learning period
+func (d *Detector) detectNewDomains(profile *database.BehavioralProfile) []*Anomaly {
+	anomalies := make([]*Anomaly, 0)
+
+	learned := profile.FirstSeen.Add(learningPeriod)
+	since := profile.LastSeen.Add(-recentWindow)
+	if len(profile.Domains) == 0 || !since.After(learned) {
+		return anomalies
+	}
+
+	// A name is only new when no other name under the same registrable domain
+	// was known before the window (new CDN shards of a familiar service are not)
+	known := make(map[string]bool)
+	for name, domain := range profile.Domains {
+		if domain.FirstSeen.Before(since) {
+			known[RegistrableDomain(name)] = true
+		}
+	}
+
+	reported := make(map[string]bool)
+	for _, name := range sortedDomains(profile, since) {
+		domain := profile.Domains[name]
+		base := RegistrableDomain(name)
+		if known[base] || reported[base] || domain.FirstSeen.Before(since) || isLocalDomain(name) {
+			continue
+		}
+		reported[base] = true
+
+		anomalies = append(anomalies, &Anomaly{
+			DeviceMAC:   profile.MAC,
+			Type:        AnomalyNewDomain,
+			Severity:    SeverityLow,
+			Description: fmt.Sprintf("Device looked up previously unseen domain %s", name),
+			Timestamp:   time.Now(),
+			Evidence: map[string]interface{}{
+				"domain":     base,
+				"query_name": name,
+				"first_seen": domain.FirstSeen,
+				"count":      domain.Count,
+			},
+		})
+	}
+
+	return anomalies
+}
+
+// detectDGADomains reports recently looked up names whose registrable label
+// looks machine-generated, as produced by domain generation algorithms
+func (d *Detector) detectDGADomains(profile *database.BehavioralProfile) []*Anomaly {
+	anomalies := make([]*Anomaly, 0)
+
+	since := profile.LastSeen.Add(-recentWindow)
+	for _, name := range sortedDomains(profile, since) {
+		if isLocalDomain(name) {
+			continue
+		}
+		label := strings.SplitN(RegistrableDomain(name), ".", 2)[0]
+		entropy, generated := LooksGenerated(label)
+		if !generated {
+			continue
+		}
+
+		domain := profile.Domains[name]
+		severity := SeverityMedium
+		if domain.NXDomain > 0 {
+			severity = SeverityHigh
+		}
+
+		anomalies = append(anomalies, &Anomaly{
+			DeviceMAC:   profile.MAC,
+			Type:        AnomalyDGADomain,
+			Severity:    severity,
+			Description: fmt.Sprintf("Device looked up algorithmically generated-looking domain %s (entropy %.2f)", name, entropy),
+			Timestamp:   time.Now(),
+			Evidence: map[string]interface{}{
+				"domain":   name,
+				"entropy":  entropy,
+				"nxdomain": domain.NXDomain,
+				"count":    domain.Count,
+			},
+		})
+	}
+
+	return anomalies
+}
+
+// detectNXDomainRate reports devices for which most recently looked up names
+// do not exist, the signature of DGA malware probing for its rendezvous domain
+func (d *Detector) detectNXDomainRate(profile *database.BehavioralProfile) []*Anomaly {
+	anomalies := make([]*Anomaly, 0)
+
+	since := profile.LastSeen.Add(-recentWindow)
+	names := sortedDomains(profile, since)
+
+	failed := make([]string, 0)
+	for _, name := range names {
+		if profile.Domains[name].NXDomain > 0 {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) < minNXDomainCount {
+		return anomalies
+	}
+
+	// Sensitivity 0.5 flags devices with half of their recent names failing
+	rate := float64(len(failed)) / float64(len(names))
+	threshold := 0.75 - 0.5*d.sensitivity
+	if rate < threshold {
+		return anomalies
+	}
+
+	severity := SeverityMedium
+	if rate >= 0.8 && len(failed) >= 2*minNXDomainCount {
+		severity = SeverityHigh
+	}
+
+	samples := failed
+	if len(samples) > 5 {
+		samples = samples[:5]
+	}
+
+	anomalies = append(anomalies, &Anomaly{
+		DeviceMAC:   profile.MAC,
+		Type:        AnomalyNXDomainRate,
+		Severity:    severity,
+		Description: fmt.Sprintf("High NXDOMAIN rate: %d of %d domains looked up in the last hour do not exist", len(failed), len(names)),
+		Timestamp:   time.Now(),
+		Evidence: map[string]interface{}{
+			"nxdomain_count": len(failed),
+			"domain_count":   len(names),
+			"rate":           rate * 100,
+			"sample_domains": samples,
+		},
+	})
+
+	return anomalies
+}
+
+// sortedDomains returns the profile's domains last looked up at or after since, sorted by name
+func sortedDomains(profile *database.BehavioralProfile, since time.Time) []string {
+	names := make([]string, 0)
+	for name, domain := range profile.Domains {
+		if !domain.LastSeen.Before(since) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isLocalDomain reports names that never leave the local network
+func isLocalDomain(name string) bool {
+	return !strings.Contains(name, ".") ||
+		strings.HasSuffix(name, ".local") ||
+		strings.HasSuffix(name, ".lan") ||
+		strings.HasSuffix(name, ".home.arpa") ||
+		strings.HasSuffix(name, ".in-addr.arpa") ||
+		strings.HasSuffix(name, ".ip6.arpa")
+}
+
+// RegistrableDomain approximates the registrable part of a name: the last two
+// labels, or three when the second-level label is a short public suffix such
+// as co.uk or com.au
+func RegistrableDomain(name string) string {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	if len(labels) <= 2 {
+		return strings.Join(labels, ".")
+	}
+
+	keep := 2
+	tld, second := labels[len(labels)-1], labels[len(labels)-2]
+	if len(tld) == 2 && len(second) <= 3 {
+		keep = 3
+	}
+	return strings.Join(labels[len(labels)-keep:], ".")
+}
+
+// LooksGenerated scores a single DNS label and reports whether it resembles
+// the output of a domain generation algorithm: long, high character entropy,
+// and either few vowels, long consonant runs or many digits. The label's
+// Shannon entropy in bits per character is returned alongside.
+func LooksGenerated(label string) (float64, bool) {
+	label = strings.ToLower(label)
+	if len(label) < 10 || strings.HasPrefix(label, "xn--") {
+		return 0, false
+	}
+
+	counts := make(map[rune]int)
+	var vowels, digits, run, longestRun int
+	for _, c := range label {
+		counts[c]++
+		switch {
+		case strings.ContainsRune("aeiouy", c):
+			vowels++
+			run = 0
+		case c >= '0' && c <= '9':
+			digits++
+			run = 0
+		case c >= 'a' && c <= 'z':
+			run++
+			if run > longestRun {
+				longestRun = run
+			}
+		default:
+			run = 0
+		}
+	}
+
+	length := float64(len(label))
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+
+	if entropy < 3.2 {
+		return entropy, false
+	}
+	generated := float64(vowels)/length < 0.2 || longestRun >= 5 || float64(digits)/length > 0.3
+	return entropy, generated
+}
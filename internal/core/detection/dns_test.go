@@ -0,0 +1,104 @@
+package detection
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+func TestLooksGenerated(t *testing.T) {
+	for _, label := range []string{"googleusercontent", "microsoftonline", "cloudfront", "amazonaws", "akamaiedge",
+		"doubleclick", "googleapis", "icloud-content", "xboxlive", "whatsapp", "xn--mgbaam7a8h"} {
+		if entropy, generated := LooksGenerated(label); generated {
+			t.Errorf("Expected %s not to look generated (entropy %.2f)", label, entropy)
+		}
+	}
+	for _, label := range []string{"xjw9qpz3kvbt2lmh", "qwrtzpkdmnbvcx", "a8f3k2m9x7q1z5", "kxvbhtrqplmnsdfg"} {
+		if entropy, generated := LooksGenerated(label); !generated {
+			t.Errorf("Expected %s to look generated (entropy %.2f)", label, entropy)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"a.b.example.com": "example.com",
+		"www.bbc.co.uk":   "bbc.co.uk",
+		"example.com":     "example.com",
+		"localhost":       "localhost",
+	} {
+		if got := RegistrableDomain(name); got != want {
+			t.Errorf("RegistrableDomain(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestDomainRules(t *testing.T) {
+	detector, err := NewDetector(&Config{Sensitivity: 0.5, BaselineThreshold: 0})
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := first.Add(48 * time.Hour)
+	profile := &database.BehavioralProfile{
+		MAC:          "aa:bb:cc:dd:ee:ff",
+		FirstSeen:    first,
+		LastSeen:     now,
+		TotalPackets: 1000,
+		Domains:      make(map[string]*database.DomainInfo),
+	}
+	addDomain := func(name string, firstSeen time.Time, nx int64) {
+		profile.Domains[name] = &database.DomainInfo{Name: name, Count: 1, NXDomain: nx, FirstSeen: firstSeen, LastSeen: now}
+	}
+
+	// Familiar services, including a new shard of one of them
+	addDomain("www.example.com", first, 0)
+	addDomain("img.example.com", now.Add(-time.Minute), 0)
+	addDomain("printer.local", now.Add(-time.Minute), 0)
+	// A new service and a burst of generated names that do not resolve
+	addDomain("updates.newvendor.io", now.Add(-10*time.Minute), 0)
+	for i := 0; i < 12; i++ {
+		addDomain(fmt.Sprintf("xq%dzkvbt%dmhwp.biz", i, i), now.Add(-5*time.Minute), 1)
+	}
+
+	byType := func(anomalies []*Anomaly, anomalyType AnomalyType) []*Anomaly {
+		return FilterByType(anomalies, anomalyType)
+	}
+	anomalies, err := detector.Analyze(profile)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	newDomains := byType(anomalies, AnomalyNewDomain)
+	if len(newDomains) != 13 {
+		t.Errorf("Expected 13 new registrable domains, got %d", len(newDomains))
+	}
+	for _, anomaly := range newDomains {
+		if anomaly.Evidence["domain"] == "example.com" || anomaly.Evidence["domain"] == "printer.local" {
+			t.Errorf("Unexpected new domain anomaly: %s", anomaly.Description)
+		}
+	}
+
+	dga := byType(anomalies, AnomalyDGADomain)
+	if len(dga) != 12 {
+		t.Errorf("Expected 12 DGA anomalies, got %d", len(dga))
+	} else if dga[0].Severity != SeverityHigh {
+		t.Errorf("Expected high severity for non-existent generated names, got %s", dga[0].Severity)
+	}
+
+	nx := byType(anomalies, AnomalyNXDomainRate)
+	if len(nx) != 1 || nx[0].Evidence["nxdomain_count"] != 12 || nx[0].Evidence["domain_count"] != 16 {
+		t.Fatalf("Expected one NXDOMAIN rate anomaly over 12 of 16 names, got %+v", nx)
+	}
+
+	// Nothing is new during the learning period
+	profile.LastSeen = first.Add(time.Hour)
+	for _, domain := range profile.Domains {
+		domain.FirstSeen, domain.LastSeen = first.Add(30*time.Minute), first.Add(time.Hour)
+	}
+	anomalies, _ = detector.Analyze(profile)
+	if got := byType(anomalies, AnomalyNewDomain); len(got) != 0 {
+		t.Errorf("Expected no new domain anomalies while learning, got %d", len(got))
+	}
+}
@@ -0,0 +1,240 @@
+package detection
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// LifecycleConfig contains the rules for device lifecycle anomalies
+type LifecycleConfig struct {
+	// NewDeviceEnabled raises an anomaly when a device joins the network
+	NewDeviceEnabled bool
+
+	// BusinessHoursStart and BusinessHoursEnd bound the local hours (0-23) in which
+	// new devices are expected. Joins outside them get a higher severity.
+	// Equal values treat every hour as business hours.
+	BusinessHoursStart int
+	BusinessHoursEnd   int
+
+	// BusinessDaysOnly treats Saturdays and Sundays as outside business hours
+	BusinessDaysOnly bool
+
+	// LearningPeriod suppresses new-device anomalies after startup while the
+	// initial scans populate the device inventory
+	LearningPeriod time.Duration
+
+	// DormantAfter raises an anomaly when an always-on device has not been seen
+	// for this long (0 disables dormant detection)
+	DormantAfter time.Duration
+
+	// DormantDeviceTypes are classifier device types expected to be always on
+	DormantDeviceTypes []string
+
+	// DormantMACs are additional devices expected to be always on
+	DormantMACs []string
+}
+
+// DefaultLifecycleConfig returns lifecycle rules with sensible defaults
+func DefaultLifecycleConfig() *LifecycleConfig {
+	return &LifecycleConfig{
+		NewDeviceEnabled:   true,
+		BusinessHoursStart: 8,
+		BusinessHoursEnd:   18,
+		LearningPeriod:     10 * time.Minute,
+		DormantAfter:       30 * time.Minute,
+		DormantDeviceTypes: []string{"camera", "iot", "smarthome", "nas", "router"},
+	}
+}
+
+// LifecycleDetector turns device discovery events into new-device and
+// dormant-device anomalies
+type LifecycleDetector struct {
+	config       *LifecycleConfig
+	startedAt    time.Time
+	dormantTypes map[string]bool
+	dormantMACs  map[string]bool
+
+	// Always-on devices seen since startup, and whether they are already reported dormant
+	watched map[string]*watchedDevice
+	mu      sync.Mutex
+}
+
+type watchedDevice struct {
+	device   database.Device
+	lastSeen time.Time
+	reported bool
+}
+
+// NewLifecycleDetector creates a lifecycle detector with the given rules
+func NewLifecycleDetector(cfg *LifecycleConfig) (*LifecycleDetector, error) {
+	if cfg == nil {
+		cfg = DefaultLifecycleConfig()
+	}
+
+	if cfg.BusinessHoursStart < 0 || cfg.BusinessHoursStart > 23 {
+		return nil, fmt.Errorf("business hours start must be between 0 and 23, got %d", cfg.BusinessHoursStart)
+	}
+	if cfg.BusinessHoursEnd < 0 || cfg.BusinessHoursEnd > 23 {
+		return nil, fmt.Errorf("business hours end must be between 0 and 23, got %d", cfg.BusinessHoursEnd)
+	}
+	if cfg.LearningPeriod < 0 {
+		return nil, fmt.Errorf("learning period must be non-negative, got %v", cfg.LearningPeriod)
+	}
+	if cfg.DormantAfter < 0 {
+		return nil, fmt.Errorf("dormant threshold must be non-negative, got %v", cfg.DormantAfter)
+	}
+
+	d := &LifecycleDetector{
+		config:       cfg,
+		startedAt:    time.Now(),
+		dormantTypes: make(map[string]bool),
+		dormantMACs:  make(map[string]bool),
+		watched:      make(map[string]*watchedDevice),
+	}
+	for _, deviceType := range cfg.DormantDeviceTypes {
+		d.dormantTypes[strings.ToLower(deviceType)] = true
+	}
+	for _, mac := range cfg.DormantMACs {
+		d.dormantMACs[strings.ToLower(mac)] = true
+	}
+
+	return d, nil
+}
+
+// DeviceJoined evaluates a newly discovered device. Returns nil if no rule
+// flags it.
+func (d *LifecycleDetector) DeviceJoined(device *database.Device, at time.Time) *Anomaly {
+	if device == nil {
+		return nil
+	}
+
+	d.DeviceSeen(device, at)
+
+	if !d.config.NewDeviceEnabled || at.Before(d.startedAt.Add(d.config.LearningPeriod)) {
+		return nil
+	}
+
+	severity := SeverityLow
+	description := fmt.Sprintf("New device joined the network: %s", describeDevice(device))
+	if !d.withinBusinessHours(at) {
+		severity = SeverityMedium
+		description = fmt.Sprintf("New device joined the network outside business hours: %s", describeDevice(device))
+	}
+
+	return &Anomaly{
+		DeviceMAC:   device.MAC,
+		Type:        AnomalyNewDevice,
+		Severity:    severity,
+		Description: description,
+		Timestamp:   at,
+		Evidence: map[string]interface{}{
+			"ip":             device.IP,
+			"vendor":         device.Vendor,
+			"device_type":    device.DeviceType,
+			"business_hours": severity == SeverityLow,
+		},
+	}
+}
+
+// DeviceSeen records that a device answered a scan. Always-on devices start
+// being watched for dormancy, and a dormant device that returns is re-armed.
+func (d *LifecycleDetector) DeviceSeen(device *database.Device, at time.Time) {
+	if device == nil || !d.isAlwaysOn(device) {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	watched, exists := d.watched[device.MAC]
+	if !exists {
+		watched = &watchedDevice{}
+		d.watched[device.MAC] = watched
+	}
+	watched.device = *device
+	if at.After(watched.lastSeen) {
+		watched.lastSeen = at
+		watched.reported = false
+	}
+}
+
+// CheckDormant returns an anomaly for every always-on device that has not been
+// seen for the dormant threshold. Each dormancy is reported once.
+func (d *LifecycleDetector) CheckDormant(now time.Time) []*Anomaly {
+	anomalies := make([]*Anomaly, 0)
+	if d.config.DormantAfter <= 0 {
+		return anomalies
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for mac, watched := range d.watched {
+		silent := now.Sub(watched.lastSeen)
+		if watched.reported || silent < d.config.DormantAfter {
+			continue
+		}
+		watched.reported = true
+
+		anomalies = append(anomalies, &Anomaly{
+			DeviceMAC: mac,
+			Type:      AnomalyDormantDevice,
+			Severity:  SeverityMedium,
+			Description: fmt.Sprintf("Always-on device went dark: %s not seen for %v",
+				describeDevice(&watched.device), silent.Round(time.Minute)),
+			Timestamp: now,
+			Evidence: map[string]interface{}{
+				"last_seen":      watched.lastSeen,
+				"silent_minutes": silent.Minutes(),
+				"threshold":      d.config.DormantAfter.String(),
+				"device_type":    watched.device.DeviceType,
+				"ip":             watched.device.IP,
+			},
+		})
+	}
+
+	return anomalies
+}
+
+// isAlwaysOn reports whether a device is expected to stay online
+func (d *LifecycleDetector) isAlwaysOn(device *database.Device) bool {
+	return d.dormantMACs[strings.ToLower(device.MAC)] || d.dormantTypes[strings.ToLower(device.DeviceType)]
+}
+
+// withinBusinessHours reports whether t falls inside the configured business hours
+func (d *LifecycleDetector) withinBusinessHours(t time.Time) bool {
+	local := t.Local()
+	if d.config.BusinessDaysOnly && (local.Weekday() == time.Saturday || local.Weekday() == time.Sunday) {
+		return false
+	}
+
+	start, end, hour := d.config.BusinessHoursStart, d.config.BusinessHoursEnd, local.Hour()
+	switch {
+	case start == end:
+		return true
+	case start < end:
+		return hour >= start && hour < end
+	default:
+		// Window wraps past midnight (e.g. 22-6)
+		return hour >= start || hour < end
+	}
+}
+
+// describeDevice returns a short human-readable device label
+func describeDevice(device *database.Device) string {
+	name := device.Name
+	if name == "" {
+		name = device.Hostname
+	}
+	if name == "" {
+		name = device.Vendor
+	}
+	if name == "" {
+		return fmt.Sprintf("%s (%s)", device.MAC, device.IP)
+	}
+	return fmt.Sprintf("%s [%s, %s]", name, device.MAC, device.IP)
+}
@@ -0,0 +1,80 @@
+package detection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+func TestLifecycleNewDeviceSeverity(t *testing.T) {
+	cfg := DefaultLifecycleConfig()
+	cfg.LearningPeriod = 0
+	detector, err := NewLifecycleDetector(cfg)
+	if err != nil {
+		t.Fatalf("NewLifecycleDetector failed: %v", err)
+	}
+
+	detector.startedAt = time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+
+	device := &database.Device{MAC: "aa:bb:cc:dd:ee:01", IP: "192.168.1.50", DeviceType: "phone"}
+
+	workday := time.Date(2024, 3, 6, 10, 0, 0, 0, time.Local)
+	anomaly := detector.DeviceJoined(device, workday)
+	if anomaly == nil || anomaly.Type != AnomalyNewDevice || anomaly.Severity != SeverityLow {
+		t.Errorf("Expected low severity new device anomaly during business hours, got %+v", anomaly)
+	}
+
+	night := time.Date(2024, 3, 6, 2, 0, 0, 0, time.Local)
+	anomaly = detector.DeviceJoined(device, night)
+	if anomaly == nil || anomaly.Severity != SeverityMedium {
+		t.Errorf("Expected medium severity new device anomaly at night, got %+v", anomaly)
+	}
+}
+
+func TestLifecycleLearningPeriod(t *testing.T) {
+	detector, err := NewLifecycleDetector(DefaultLifecycleConfig())
+	if err != nil {
+		t.Fatalf("NewLifecycleDetector failed: %v", err)
+	}
+
+	device := &database.Device{MAC: "aa:bb:cc:dd:ee:01"}
+	if anomaly := detector.DeviceJoined(device, time.Now()); anomaly != nil {
+		t.Errorf("Expected no anomaly during learning period, got %+v", anomaly)
+	}
+}
+
+func TestLifecycleDormantDevice(t *testing.T) {
+	cfg := DefaultLifecycleConfig()
+	cfg.DormantAfter = 30 * time.Minute
+	detector, err := NewLifecycleDetector(cfg)
+	if err != nil {
+		t.Fatalf("NewLifecycleDetector failed: %v", err)
+	}
+
+	start := time.Now()
+	camera := &database.Device{MAC: "aa:bb:cc:dd:ee:02", DeviceType: "camera"}
+	laptop := &database.Device{MAC: "aa:bb:cc:dd:ee:03", DeviceType: "laptop"}
+	detector.DeviceSeen(camera, start)
+	detector.DeviceSeen(laptop, start)
+
+	if anomalies := detector.CheckDormant(start.Add(10 * time.Minute)); len(anomalies) != 0 {
+		t.Errorf("Expected no dormant anomalies before threshold, got %d", len(anomalies))
+	}
+
+	anomalies := detector.CheckDormant(start.Add(45 * time.Minute))
+	if len(anomalies) != 1 || anomalies[0].DeviceMAC != camera.MAC || anomalies[0].Type != AnomalyDormantDevice {
+		t.Fatalf("Expected one dormant anomaly for the camera, got %+v", anomalies)
+	}
+
+	// Reported once per dormancy
+	if anomalies := detector.CheckDormant(start.Add(60 * time.Minute)); len(anomalies) != 0 {
+		t.Errorf("Expected dormancy to be reported once, got %d", len(anomalies))
+	}
+
+	// Returning re-arms the rule
+	detector.DeviceSeen(camera, start.Add(70*time.Minute))
+	if anomalies := detector.CheckDormant(start.Add(110 * time.Minute)); len(anomalies) != 1 {
+		t.Errorf("Expected dormant anomaly after the device went dark again, got %d", len(anomalies))
+	}
+}
@@ -0,0 +1,78 @@
+package detection
+
+import (
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// AnomalyRuleViolation is raised by user-defined rules
+const AnomalyRuleViolation AnomalyType = "rule_violation"
+
+// Names of the built-in detection rules, usable in a rule file's disable_builtin list
+const (
+	BuiltinUnexpectedDestinations = "unexpected_destinations"
+	BuiltinUnusualPorts           = "unusual_ports"
+	BuiltinTrafficSpikes          = "traffic_spikes"
+	BuiltinProtocolShifts         = "protocol_shifts"
+	BuiltinDestinationCount       = "destination_count"
+	BuiltinNewDomains             = "new_domains"
+	BuiltinDGADomains             = "dga_domains"
+	BuiltinNXDomainRate           = "nxdomain_rate"
+	BuiltinNewTLSClients          = "new_tls_clients"
+)
+
+// RuleContext carries the data a rule can inspect
+type RuleContext struct {
+	Profile *database.BehavioralProfile
+
+	// Device is the discovered device for the profile, or nil if the device
+	// inventory is not available (e.g. offline replay)
+	Device *database.Device
+}
+
+// Rule evaluates a device's profile and reports anomalies
+type Rule interface {
+	// Name uniquely identifies the rule
+	Name() string
+
+	// Evaluate returns the anomalies the rule finds, or an empty slice
+	Evaluate(ctx *RuleContext) []*Anomaly
+}
+
+// builtinRule adapts one of the Detector's statistical checks to the Rule interface
+type builtinRule struct {
+	name  string
+	check func(*database.BehavioralProfile) []*Anomaly
+}
+
+func (r *builtinRule) Name() string {
+	return r.name
+}
+
+func (r *builtinRule) Evaluate(ctx *RuleContext) []*Anomaly {
+	return r.check(ctx.Profile)
+}
+
+// builtinRules returns the statistical checks in evaluation order
+func (d *Detector) builtinRules() []Rule {
+	return []Rule{
+		&builtinRule{name: BuiltinUnexpectedDestinations, check: d.detectUnexpectedDestinations},
+		&builtinRule{name: BuiltinUnusualPorts, check: d.detectUnusualPorts},
+		&builtinRule{name: BuiltinTrafficSpikes, check: d.detectTrafficSpikes},
+		&builtinRule{name: BuiltinProtocolShifts, check: d.withBaseline(d.detectProtocolShifts)},
+		&builtinRule{name: BuiltinDestinationCount, check: d.withBaseline(d.detectDestinationAnomalies)},
+		&builtinRule{name: BuiltinNewDomains, check: d.detectNewDomains},
+		&builtinRule{name: BuiltinDGADomains, check: d.detectDGADomains},
+		&builtinRule{name: BuiltinNXDomainRate, check: d.detectNXDomainRate},
+		&builtinRule{name: BuiltinNewTLSClients, check: d.detectNewTLSClients},
+	}
+}
+
+// withBaseline only runs check once the profile has an established baseline
+func (d *Detector) withBaseline(check func(*database.BehavioralProfile) []*Anomaly) func(*database.BehavioralProfile) []*Anomaly {
+	return func(profile *database.BehavioralProfile) []*Anomaly {
+		if profile.Baseline == nil || profile.Baseline.SampleCount <= 3 {
+			return make([]*Anomaly, 0)
+		}
+		return check(profile)
+	}
+}
@@ -0,0 +1,536 @@
+package detection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleSet is the content of a declarative rule file (YAML or JSON).
+//
+// Example (YAML):
+//
+//	common_ports: [80, 443, 53, 123]
+//	disable_builtin: [unexpected_destinations]
+//	rules:
+//	  - name: cameras-local-only
+//	    description: Cameras must only talk to the local network
+//	    severity: high
+//	    match:
+//	      device_types: [camera]
+//	    condition:
+//	      destinations_outside: [192.168.0.0/16, 10.0.0.0/8]
+//	  - name: printers-no-ssh
+//	    severity: critical
+//	    match:
+//	      device_types: [printer]
+//	    condition:
+//	      ports_any: [22]
+type RuleSet struct {
+	// CommonPorts replaces the ports the built-in unusual port check ignores
+	CommonPorts []uint16 `json:"common_ports,omitempty" yaml:"common_ports,omitempty"`
+
+	// DisableBuiltin lists built-in checks to turn off (see Builtin* constants)
+	DisableBuiltin []string `json:"disable_builtin,omitempty" yaml:"disable_builtin,omitempty"`
+
+	Rules []RuleDefinition `json:"rules" yaml:"rules"`
+}
+
+// RuleDefinition declares one user-defined rule. A rule raises an anomaly when
+// its match selects the device and every condition it sets is violated.
+type RuleDefinition struct {
+	Name        string        `json:"name" yaml:"name"`
+	Description string        `json:"description,omitempty" yaml:"description,omitempty"`
+	Enabled     *bool         `json:"enabled,omitempty" yaml:"enabled,omitempty"` // Defaults to true
+	Severity    Severity      `json:"severity" yaml:"severity"`
+	Match       RuleMatch     `json:"match" yaml:"match"`
+	Condition   RuleCondition `json:"condition" yaml:"condition"`
+}
+
+// RuleMatch selects the devices a rule applies to. Empty fields match everything.
+type RuleMatch struct {
+	DeviceTypes []string `json:"device_types,omitempty" yaml:"device_types,omitempty"` // Classifier device types
+	MACs        []string `json:"macs,omitempty" yaml:"macs,omitempty"`
+}
+
+// RuleCondition lists the violations a rule looks for
+type RuleCondition struct {
+	// DestinationsOutside is an allowlist: destinations outside every CIDR violate it
+	DestinationsOutside []string `json:"destinations_outside,omitempty" yaml:"destinations_outside,omitempty"`
+
+	// DestinationsIn is a blocklist: destinations inside any CIDR violate it
+	DestinationsIn []string `json:"destinations_in,omitempty" yaml:"destinations_in,omitempty"`
+
+	// PortsAny is a blocklist of destination ports
+	PortsAny []uint16 `json:"ports_any,omitempty" yaml:"ports_any,omitempty"`
+
+	// PortsOutside is an allowlist of destination ports
+	PortsOutside []uint16 `json:"ports_outside,omitempty" yaml:"ports_outside,omitempty"`
+
+	// ProtocolsAny is a blocklist of protocols (e.g. ICMP)
+	ProtocolsAny []string `json:"protocols_any,omitempty" yaml:"protocols_any,omitempty"`
+
+	// Metrics are numeric comparisons over profile fields
+	Metrics []MetricCondition `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+}
+
+// MetricCondition compares a profile field against a value, e.g.
+// {field: last_hour_packets, op: ">", value: 10000}
+type MetricCondition struct {
+	Field string  `json:"field" yaml:"field"`
+	Op    string  `json:"op" yaml:"op"`
+	Value float64 `json:"value" yaml:"value"`
+}
+
+// metricFields are the profile fields available to metric conditions
+var metricFields = map[string]func(*RuleContext) float64{
+	"total_packets":        func(c *RuleContext) float64 { return float64(c.Profile.TotalPackets) },
+	"total_bytes":          func(c *RuleContext) float64 { return float64(c.Profile.TotalBytes) },
+	"unique_destinations":  func(c *RuleContext) float64 { return float64(len(c.Profile.Destinations)) },
+	"unique_ports":         func(c *RuleContext) float64 { return float64(len(c.Profile.Ports)) },
+	"local_peers":          func(c *RuleContext) float64 { return float64(len(c.Profile.LocalCommunication)) },
+	"unique_domains":       func(c *RuleContext) float64 { return float64(len(c.Profile.Domains)) },
+	"dns_queries":          func(c *RuleContext) float64 { return float64(c.Profile.DNSQueries) },
+	"nxdomain_responses":   func(c *RuleContext) float64 { return float64(c.Profile.NXDomainResponses) },
+	"tls_clients":          func(c *RuleContext) float64 { return float64(len(c.Profile.TLSClients)) },
+	"flows":                func(c *RuleContext) float64 { return float64(c.Profile.Flows) },
+	"bytes_sent":           func(c *RuleContext) float64 { return float64(c.Profile.BytesSent) },
+	"bytes_received":       func(c *RuleContext) float64 { return float64(c.Profile.BytesReceived) },
+	"longest_flow_seconds": func(c *RuleContext) float64 { return c.Profile.LongestFlowSeconds },
+	"upload_ratio": func(c *RuleContext) float64 {
+		// Bytes sent per byte received; exfiltration turns a download-heavy device upload-heavy
+		return float64(c.Profile.BytesSent) / float64(max(c.Profile.BytesReceived, 1))
+	},
+	"hours_since_first_seen": func(c *RuleContext) float64 {
+		return time.Since(c.Profile.FirstSeen).Hours()
+	},
+	"last_hour_packets": func(c *RuleContext) float64 {
+		if c.Profile.LastHour == nil {
+			return 0
+		}
+		return float64(c.Profile.LastHour.Packets)
+	},
+	"last_hour_bytes": func(c *RuleContext) float64 {
+		if c.Profile.LastHour == nil {
+			return 0
+		}
+		return float64(c.Profile.LastHour.Bytes)
+	},
+	"last_hour_destinations": func(c *RuleContext) float64 {
+		if c.Profile.LastHour == nil {
+			return 0
+		}
+		return float64(c.Profile.LastHour.UniqueDestinations)
+	},
+}
+
+// metricOps are the supported metric comparison operators
+var metricOps = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// builtinNames are the names accepted in disable_builtin
+var builtinNames = map[string]bool{
+	BuiltinUnexpectedDestinations: true,
+	BuiltinUnusualPorts:           true,
+	BuiltinTrafficSpikes:          true,
+	BuiltinProtocolShifts:         true,
+	BuiltinDestinationCount:       true,
+	BuiltinNewDomains:             true,
+	BuiltinDGADomains:             true,
+	BuiltinNXDomainRate:           true,
+	BuiltinNewTLSClients:          true,
+}
+
+// LoadRuleFile reads a rule file. Files ending in .json are parsed as JSON,
+// anything else as YAML.
+func LoadRuleFile(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule file: %w", err)
+	}
+
+	var ruleSet RuleSet
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &ruleSet); err != nil {
+			return nil, fmt.Errorf("failed to parse rule file: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &ruleSet); err != nil {
+			return nil, fmt.Errorf("failed to parse rule file: %w", err)
+		}
+	}
+
+	return &ruleSet, nil
+}
+
+// Compile validates the rule set and returns its enabled rules
+func (rs *RuleSet) Compile() ([]Rule, error) {
+	for _, name := range rs.DisableBuiltin {
+		if !builtinNames[name] {
+			return nil, fmt.Errorf("unknown built-in rule: %s", name)
+		}
+	}
+
+	rules := make([]Rule, 0, len(rs.Rules))
+	seen := make(map[string]bool, len(rs.Rules))
+	for i := range rs.Rules {
+		def := &rs.Rules[i]
+		if def.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		}
+		if seen[def.Name] {
+			return nil, fmt.Errorf("rule %s: duplicate name", def.Name)
+		}
+		seen[def.Name] = true
+
+		rule, err := compileRule(def)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", def.Name, err)
+		}
+		if def.Enabled != nil && !*def.Enabled {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// ApplyRuleSet compiles a rule set and installs it on the detector. On error
+// the detector keeps its current rules.
+func (d *Detector) ApplyRuleSet(rs *RuleSet) error {
+	rules, err := rs.Compile()
+	if err != nil {
+		return err
+	}
+	d.SetRules(rules, rs.DisableBuiltin, rs.CommonPorts)
+	return nil
+}
+
+// declarativeRule is a compiled RuleDefinition
+type declarativeRule struct {
+	name        string
+	description string
+	severity    Severity
+
+	deviceTypes map[string]bool
+	macs        map[string]bool
+
+	allowedNets  []*net.IPNet
+	blockedNets  []*net.IPNet
+	blockedPorts map[uint16]bool
+	allowedPorts map[uint16]bool
+	protocols    map[string]bool
+	metrics      []MetricCondition
+}
+
+func compileRule(def *RuleDefinition) (*declarativeRule, error) {
+	switch def.Severity {
+	case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+	default:
+		return nil, fmt.Errorf("invalid severity %q (must be low, medium, high or critical)", def.Severity)
+	}
+
+	rule := &declarativeRule{
+		name:        def.Name,
+		description: def.Description,
+		severity:    def.Severity,
+		deviceTypes: lowerSet(def.Match.DeviceTypes),
+		macs:        lowerSet(def.Match.MACs),
+		protocols:   lowerSet(def.Condition.ProtocolsAny),
+		metrics:     def.Condition.Metrics,
+	}
+
+	var err error
+	if rule.allowedNets, err = parseCIDRs(def.Condition.DestinationsOutside); err != nil {
+		return nil, err
+	}
+	if rule.blockedNets, err = parseCIDRs(def.Condition.DestinationsIn); err != nil {
+		return nil, err
+	}
+	if len(def.Condition.PortsAny) > 0 {
+		rule.blockedPorts = portSet(def.Condition.PortsAny)
+	}
+	if len(def.Condition.PortsOutside) > 0 {
+		rule.allowedPorts = portSet(def.Condition.PortsOutside)
+	}
+
+	for _, metric := range rule.metrics {
+		if _, ok := metricFields[metric.Field]; !ok {
+			return nil, fmt.Errorf("unknown metric field %q", metric.Field)
+		}
+		if _, ok := metricOps[metric.Op]; !ok {
+			return nil, fmt.Errorf("unknown metric operator %q", metric.Op)
+		}
+	}
+
+	if rule.allowedNets == nil && rule.blockedNets == nil && rule.blockedPorts == nil &&
+		rule.allowedPorts == nil && len(rule.protocols) == 0 && len(rule.metrics) == 0 {
+		return nil, fmt.Errorf("at least one condition is required")
+	}
+
+	return rule, nil
+}
+
+func (r *declarativeRule) Name() string {
+	return r.name
+}
+
+func (r *declarativeRule) Evaluate(ctx *RuleContext) []*Anomaly {
+	profile := ctx.Profile
+	if !r.matches(ctx) {
+		return nil
+	}
+
+	evidence := map[string]interface{}{"rule": r.name}
+
+	if r.allowedNets != nil {
+		var outside []string
+		for ip := range profile.Destinations {
+			if !containsIP(r.allowedNets, ip) {
+				outside = append(outside, ip)
+			}
+		}
+		if len(outside) == 0 {
+			return nil
+		}
+		sort.Strings(outside)
+		evidence["destinations_outside"] = outside
+	}
+
+	if r.blockedNets != nil {
+		var blocked []string
+		for ip := range profile.Destinations {
+			if containsIP(r.blockedNets, ip) {
+				blocked = append(blocked, ip)
+			}
+		}
+		if len(blocked) == 0 {
+			return nil
+		}
+		sort.Strings(blocked)
+		evidence["destinations_in"] = blocked
+	}
+
+	if r.blockedPorts != nil {
+		ports := matchingPorts(profile.Ports, func(port uint16) bool { return r.blockedPorts[port] })
+		if len(ports) == 0 {
+			return nil
+		}
+		evidence["ports"] = ports
+	}
+
+	if r.allowedPorts != nil {
+		ports := matchingPorts(profile.Ports, func(port uint16) bool { return !r.allowedPorts[port] })
+		if len(ports) == 0 {
+			return nil
+		}
+		evidence["ports_outside"] = ports
+	}
+
+	if len(r.protocols) > 0 {
+		var protocols []string
+		for protocol := range profile.Protocols {
+			if r.protocols[strings.ToLower(protocol)] {
+				protocols = append(protocols, protocol)
+			}
+		}
+		if len(protocols) == 0 {
+			return nil
+		}
+		sort.Strings(protocols)
+		evidence["protocols"] = protocols
+	}
+
+	for _, metric := range r.metrics {
+		value := metricFields[metric.Field](ctx)
+		if !metricOps[metric.Op](value, metric.Value) {
+			return nil
+		}
+		evidence[metric.Field] = value
+	}
+
+	description := r.description
+	if description == "" {
+		description = fmt.Sprintf("Device violated rule %q", r.name)
+	}
+
+	return []*Anomaly{{
+		DeviceMAC:   profile.MAC,
+		Type:        AnomalyRuleViolation,
+		Severity:    r.severity,
+		Description: description,
+		Timestamp:   time.Now(),
+		Evidence:    evidence,
+	}}
+}
+
+// matches reports whether the rule applies to the device in ctx
+func (r *declarativeRule) matches(ctx *RuleContext) bool {
+	if len(r.macs) > 0 && !r.macs[strings.ToLower(ctx.Profile.MAC)] {
+		return false
+	}
+	if len(r.deviceTypes) > 0 {
+		if ctx.Device == nil || !r.deviceTypes[strings.ToLower(ctx.Device.DeviceType)] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCIDRs parses a CIDR list; bare IP addresses are treated as single hosts
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// containsIP reports whether ip falls inside any of nets
+func containsIP(nets []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingPorts returns the sorted ports of a profile that satisfy match
+func matchingPorts(ports map[uint16]int, match func(uint16) bool) []uint16 {
+	var result []uint16
+	for port := range ports {
+		if match(port) {
+			result = append(result, port)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// lowerSet converts a string list to a lowercase lookup set
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = true
+	}
+	return set
+}
+
+// RuleLoader keeps a Detector's user-defined rules in sync with a rule file
+type RuleLoader struct {
+	detector *Detector
+	path     string
+	modTime  time.Time
+	mu       sync.Mutex
+}
+
+// NewRuleLoader creates a loader for the rule file at path
+func NewRuleLoader(detector *Detector, path string) *RuleLoader {
+	return &RuleLoader{
+		detector: detector,
+		path:     path,
+	}
+}
+
+// Load reads the rule file and installs its rules. An empty path clears all
+// user-defined rules.
+func (l *RuleLoader) Load() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.loadLocked()
+}
+
+// SetPath switches to a different rule file and loads it if the path changed
+func (l *RuleLoader) SetPath(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if path == l.path {
+		return nil
+	}
+	l.path = path
+	l.modTime = time.Time{}
+	return l.loadLocked()
+}
+
+// ReloadIfChanged reloads the rule file if it was modified since the last load
+func (l *RuleLoader) ReloadIfChanged() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		return false, nil
+	}
+	stat, err := os.Stat(l.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat rule file: %w", err)
+	}
+	if !stat.ModTime().After(l.modTime) {
+		return false, nil
+	}
+	return true, l.loadLocked()
+}
+
+func (l *RuleLoader) loadLocked() error {
+	if l.path == "" {
+		l.detector.SetRules(nil, nil, nil)
+		return nil
+	}
+
+	stat, err := os.Stat(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat rule file: %w", err)
+	}
+
+	ruleSet, err := LoadRuleFile(l.path)
+	if err != nil {
+		return err
+	}
+	if err := l.detector.ApplyRuleSet(ruleSet); err != nil {
+		return fmt.Errorf("invalid rule file %s: %w", l.path, err)
+	}
+
+	l.modTime = stat.ModTime()
+	return nil
+}
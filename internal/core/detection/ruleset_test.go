@@ -0,0 +1,194 @@
+package detection
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+const testRuleFile = `
+common_ports: [80, 443]
+disable_builtin: [unexpected_destinations]
+rules:
+  - name: cameras-local-only
+    severity: high
+    match:
+      device_types: [Camera]
+    condition:
+      destinations_outside: [192.168.0.0/16]
+  - name: printers-no-ssh
+    severity: critical
+    match:
+      device_types: [printer]
+    condition:
+      ports_any: [22]
+  - name: disabled-rule
+    severity: low
+    enabled: false
+    condition:
+      metrics:
+        - {field: total_packets, op: ">", value: 0}
+`
+
+func testRuleProfile(destinations []string, ports []uint16) *database.BehavioralProfile {
+	profile := &database.BehavioralProfile{
+		MAC:          "aa:bb:cc:dd:ee:ff",
+		Destinations: make(map[string]*database.DestInfo),
+		Ports:        make(map[uint16]int),
+		Protocols:    map[string]int{"TCP": 10},
+		TotalPackets: 10,
+		FirstSeen:    time.Now().Add(-time.Hour),
+	}
+	for _, ip := range destinations {
+		profile.Destinations[ip] = &database.DestInfo{IP: ip, Count: 5}
+	}
+	for _, port := range ports {
+		profile.Ports[port] = 5
+	}
+	return profile
+}
+
+func writeRuleFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	return path
+}
+
+func TestRuleFileEvaluation(t *testing.T) {
+	detector, err := NewDetector(DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+
+	loader := NewRuleLoader(detector, writeRuleFile(t, "rules.yaml", testRuleFile))
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+	if rules := detector.Rules(); len(rules) != 2 {
+		t.Fatalf("Expected 2 enabled rules, got %v", rules)
+	}
+
+	camera := &database.Device{MAC: "aa:bb:cc:dd:ee:ff", DeviceType: "camera"}
+	profile := testRuleProfile([]string{"192.168.1.10", "203.0.113.7"}, []uint16{443})
+
+	anomalies, err := detector.AnalyzeDevice(profile, camera)
+	if err != nil {
+		t.Fatalf("AnalyzeDevice failed: %v", err)
+	}
+	if len(anomalies) != 1 {
+		t.Fatalf("Expected 1 anomaly, got %d", len(anomalies))
+	}
+	anomaly := anomalies[0]
+	if anomaly.Type != AnomalyRuleViolation || anomaly.Severity != SeverityHigh {
+		t.Errorf("Unexpected anomaly %s/%s", anomaly.Type, anomaly.Severity)
+	}
+	if anomaly.Evidence["rule"] != "cameras-local-only" {
+		t.Errorf("Expected evidence to name the rule, got %v", anomaly.Evidence["rule"])
+	}
+	outside, _ := anomaly.Evidence["destinations_outside"].([]string)
+	if len(outside) != 1 || outside[0] != "203.0.113.7" {
+		t.Errorf("Expected 203.0.113.7 outside the allowed range, got %v", outside)
+	}
+
+	// Device type rules need the discovered device
+	if anomalies, _ := detector.AnalyzeDevice(profile, nil); len(anomalies) != 0 {
+		t.Errorf("Expected no anomalies without device info, got %d", len(anomalies))
+	}
+
+	// A compliant camera raises nothing
+	profile = testRuleProfile([]string{"192.168.1.10"}, []uint16{443})
+	if anomalies, _ := detector.AnalyzeDevice(profile, camera); len(anomalies) != 0 {
+		t.Errorf("Expected no anomalies for a compliant camera, got %d", len(anomalies))
+	}
+}
+
+func TestRuleLoaderHotReload(t *testing.T) {
+	detector, err := NewDetector(DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+
+	path := writeRuleFile(t, "rules.json", `{"rules": [{"name": "no-ssh", "severity": "medium", "condition": {"ports_any": [22]}}]}`)
+	loader := NewRuleLoader(detector, path)
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	// An invalid edit keeps the previous rules
+	if err := os.WriteFile(path, []byte(`{"rules": [{"name": "bad", "severity": "urgent", "condition": {"ports_any": [22]}}]}`), 0644); err != nil {
+		t.Fatalf("Failed to rewrite rule file: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	if _, err := loader.ReloadIfChanged(); err == nil {
+		t.Fatal("Expected invalid severity to be rejected")
+	}
+	if rules := detector.Rules(); len(rules) != 1 || rules[0] != "no-ssh" {
+		t.Errorf("Expected previous rules to stay active, got %v", rules)
+	}
+
+	// A valid edit replaces them
+	if err := os.WriteFile(path, []byte(`{"rules": [{"name": "no-telnet", "severity": "high", "condition": {"ports_any": [23]}}]}`), 0644); err != nil {
+		t.Fatalf("Failed to rewrite rule file: %v", err)
+	}
+	future = future.Add(time.Minute)
+	os.Chtimes(path, future, future)
+	reloaded, err := loader.ReloadIfChanged()
+	if err != nil || !reloaded {
+		t.Fatalf("Expected rules to reload, got %v (%v)", reloaded, err)
+	}
+	if rules := detector.Rules(); len(rules) != 1 || rules[0] != "no-telnet" {
+		t.Errorf("Expected reloaded rules, got %v", rules)
+	}
+
+	// Clearing the path removes user rules
+	if err := loader.SetPath(""); err != nil {
+		t.Fatalf("SetPath failed: %v", err)
+	}
+	if rules := detector.Rules(); len(rules) != 0 {
+		t.Errorf("Expected no rules after clearing the path, got %v", rules)
+	}
+}
+
+func TestRuleSetCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		set  RuleSet
+	}{
+		{"missing name", RuleSet{Rules: []RuleDefinition{{Severity: SeverityLow, Condition: RuleCondition{PortsAny: []uint16{22}}}}}},
+		{"no condition", RuleSet{Rules: []RuleDefinition{{Name: "empty", Severity: SeverityLow}}}},
+		{"bad cidr", RuleSet{Rules: []RuleDefinition{{Name: "cidr", Severity: SeverityLow, Condition: RuleCondition{DestinationsIn: []string{"10.0.0.0/33"}}}}}},
+		{"bad metric", RuleSet{Rules: []RuleDefinition{{Name: "metric", Severity: SeverityLow, Condition: RuleCondition{Metrics: []MetricCondition{{Field: "cpu", Op: ">"}}}}}}},
+		{"unknown builtin", RuleSet{DisableBuiltin: []string{"everything"}}},
+		{"duplicate", RuleSet{Rules: []RuleDefinition{
+			{Name: "dup", Severity: SeverityLow, Condition: RuleCondition{PortsAny: []uint16{22}}},
+			{Name: "dup", Severity: SeverityLow, Condition: RuleCondition{PortsAny: []uint16{23}}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.set.Compile(); err == nil {
+			t.Errorf("%s: expected compile error", tt.name)
+		}
+	}
+}
+
+func TestRuleSetDisablesEveryBuiltin(t *testing.T) {
+	detector, err := NewDetector(nil)
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+
+	for _, rule := range detector.builtinRules() {
+		set := RuleSet{DisableBuiltin: []string{rule.Name()}}
+		if _, err := set.Compile(); err != nil {
+			t.Errorf("Expected %s to be accepted in disable_builtin: %v", rule.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package detection
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// AnomalyPrefix is the storage key prefix for stored anomalies
+const AnomalyPrefix = "anomaly:"
+
+// ErrAnomalyNotFound is returned when no anomaly has the requested ID
+var ErrAnomalyNotFound = errors.New("anomaly not found")
+
+// AnomalyState is the triage state of a stored anomaly
+type AnomalyState string
+
+const (
+	AnomalyStateOpen         AnomalyState = "open"
+	AnomalyStateAcknowledged AnomalyState = "acknowledged"
+	AnomalyStateResolved     AnomalyState = "resolved"
+	AnomalyStateSuppressed   AnomalyState = "suppressed"
+)
+
+// ValidAnomalyState reports whether s is a known anomaly state
+func ValidAnomalyState(s AnomalyState) bool {
+	switch s {
+	case AnomalyStateOpen, AnomalyStateAcknowledged, AnomalyStateResolved, AnomalyStateSuppressed:
+		return true
+	}
+	return false
+}
+
+// anomalyActions maps the triage actions exposed by the REST APIs to states
+var anomalyActions = map[string]AnomalyState{
+	"acknowledge": AnomalyStateAcknowledged,
+	"resolve":     AnomalyStateResolved,
+	"suppress":    AnomalyStateSuppressed,
+	"reopen":      AnomalyStateOpen,
+}
+
+// StateForAction returns the state a triage action (acknowledge, resolve,
+// suppress, reopen) moves an anomaly to
+func StateForAction(action string) (AnomalyState, bool) {
+	state, ok := anomalyActions[action]
+	return state, ok
+}
+
+// identityEvidence are the evidence fields that distinguish two anomalies of
+// the same type on the same device (e.g. two different unusual ports)
+var identityEvidence = []string{"rule", "destination_ip", "domain", "ja4", "port", "protocol", "hour"}
+
+// StoredAnomaly is a deduplicated anomaly with its history and triage state
+type StoredAnomaly struct {
+	ID          string                 `json:"id"`
+	DeviceMAC   string                 `json:"device_mac"`
+	Type        AnomalyType            `json:"type"`
+	Severity    Severity               `json:"severity"`
+	Description string                 `json:"description"`
+	Evidence    map[string]interface{} `json:"evidence"`
+	State       AnomalyState           `json:"state"`
+	FirstSeen   time.Time              `json:"first_seen"`
+	LastSeen    time.Time              `json:"last_seen"`
+	Occurrences int64                  `json:"occurrences"`
+	UpdatedAt   time.Time              `json:"updated_at"`     // Last state change
+	Note        string                 `json:"note,omitempty"` // Operator note from the last state change
+}
+
+// AnomalyFilter selects stored anomalies. Zero fields match everything.
+type AnomalyFilter struct {
+	DeviceMAC string
+	Type      AnomalyType
+	Severity  Severity
+	State     AnomalyState
+	Since     time.Time // Only anomalies seen at or after this time
+	Limit     int
+}
+
+// ParseAnomalyFilter builds a filter from URL query parameters:
+// device, type, severity, state, since (RFC3339) and limit
+func ParseAnomalyFilter(query url.Values) (AnomalyFilter, error) {
+	filter := AnomalyFilter{
+		DeviceMAC: query.Get("device"),
+		Type:      AnomalyType(query.Get("type")),
+		Severity:  Severity(query.Get("severity")),
+		State:     AnomalyState(query.Get("state")),
+	}
+
+	if filter.State != "" && !ValidAnomalyState(filter.State) {
+		return filter, fmt.Errorf("invalid state: %s", filter.State)
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since time (expected RFC3339): %s", since)
+		}
+		filter.Since = t
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("invalid limit: %s", limit)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+// AnomalyStoreConfig contains configuration for the anomaly store
+type AnomalyStoreConfig struct {
+	// Retention removes resolved and suppressed anomalies not seen for this long
+	// (0 keeps them forever)
+	Retention time.Duration
+}
+
+// DefaultAnomalyStoreConfig returns an anomaly store configuration with sensible defaults
+func DefaultAnomalyStoreConfig() *AnomalyStoreConfig {
+	return &AnomalyStoreConfig{
+		Retention: 30 * 24 * time.Hour,
+	}
+}
+
+// AnomalyStore persists anomalies, merging repeated detections of the same
+// anomaly into one record with an occurrence count
+type AnomalyStore struct {
+	storage   platform.StorageProvider
+	retention time.Duration
+	anomalies map[string]*StoredAnomaly
+	mu        sync.RWMutex
+}
+
+// NewAnomalyStore creates an anomaly store and loads previously stored anomalies
+func NewAnomalyStore(storage platform.StorageProvider, cfg *AnomalyStoreConfig) (*AnomalyStore, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("storage provider is required")
+	}
+	if cfg == nil {
+		cfg = DefaultAnomalyStoreConfig()
+	}
+	if cfg.Retention < 0 {
+		return nil, fmt.Errorf("retention must be non-negative, got %v", cfg.Retention)
+	}
+
+	s := &AnomalyStore{
+		storage:   storage,
+		retention: cfg.Retention,
+		anomalies: make(map[string]*StoredAnomaly),
+	}
+
+	keys, err := storage.List(AnomalyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anomalies: %w", err)
+	}
+	for _, key := range keys {
+		data, err := storage.Get(key)
+		if err != nil {
+			log.Printf("[AnomalyStore] Failed to load %s: %v", key, err)
+			continue
+		}
+		var stored StoredAnomaly
+		if err := json.Unmarshal(data, &stored); err != nil {
+			log.Printf("[AnomalyStore] Failed to decode %s: %v", key, err)
+			continue
+		}
+		s.anomalies[stored.ID] = &stored
+	}
+
+	return s, nil
+}
+
+// AnomalyID returns the stable ID shared by all detections of the same anomaly
+func AnomalyID(anomaly *Anomaly) string {
+	parts := []string{strings.ToLower(anomaly.DeviceMAC), string(anomaly.Type)}
+	for _, field := range identityEvidence {
+		if value, ok := anomaly.Evidence[field]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%v", field, value))
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Record stores a detection. It returns the stored anomaly and whether the
+// detection is news: a first sighting or a resolved anomaly recurring.
+// Repeats of open, acknowledged and suppressed anomalies only bump counters.
+func (s *AnomalyStore) Record(anomaly *Anomaly) (*StoredAnomaly, bool, error) {
+	if anomaly == nil {
+		return nil, false, fmt.Errorf("anomaly is nil")
+	}
+
+	seen := anomaly.Timestamp
+	if seen.IsZero() {
+		seen = time.Now()
+	}
+	id := AnomalyID(anomaly)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.anomalies[id]
+	isNew := !exists
+	if !exists {
+		stored = &StoredAnomaly{
+			ID:        id,
+			DeviceMAC: anomaly.DeviceMAC,
+			Type:      anomaly.Type,
+			State:     AnomalyStateOpen,
+			FirstSeen: seen,
+			UpdatedAt: seen,
+		}
+		s.anomalies[id] = stored
+	} else if stored.State == AnomalyStateResolved {
+		stored.State = AnomalyStateOpen
+		stored.UpdatedAt = seen
+		stored.Note = ""
+		isNew = true
+	}
+
+	stored.Severity = anomaly.Severity
+	stored.Description = anomaly.Description
+	stored.Evidence = anomaly.Evidence
+	stored.Occurrences++
+	if seen.After(stored.LastSeen) {
+		stored.LastSeen = seen
+	}
+
+	if err := s.saveLocked(stored); err != nil {
+		return nil, false, err
+	}
+	return copyStored(stored), isNew, nil
+}
+
+// Get returns a stored anomaly by ID
+func (s *AnomalyStore) Get(id string) (*StoredAnomaly, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, exists := s.anomalies[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrAnomalyNotFound, id)
+	}
+	return copyStored(stored), nil
+}
+
+// List returns the anomalies matching filter, most recently seen first
+func (s *AnomalyStore) List(filter AnomalyFilter) []*StoredAnomaly {
+	s.mu.RLock()
+	result := make([]*StoredAnomaly, 0)
+	for _, stored := range s.anomalies {
+		if filter.DeviceMAC != "" && !strings.EqualFold(stored.DeviceMAC, filter.DeviceMAC) {
+			continue
+		}
+		if filter.Type != "" && stored.Type != filter.Type {
+			continue
+		}
+		if filter.Severity != "" && stored.Severity != filter.Severity {
+			continue
+		}
+		if filter.State != "" && stored.State != filter.State {
+			continue
+		}
+		if !filter.Since.IsZero() && stored.LastSeen.Before(filter.Since) {
+			continue
+		}
+		result = append(result, copyStored(stored))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].LastSeen.Equal(result[j].LastSeen) {
+			return result[i].LastSeen.After(result[j].LastSeen)
+		}
+		return result[i].ID < result[j].ID
+	})
+
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result
+}
+
+// SetState moves an anomaly to a new triage state
+func (s *AnomalyStore) SetState(id string, state AnomalyState, note string) (*StoredAnomaly, error) {
+	if !ValidAnomalyState(state) {
+		return nil, fmt.Errorf("invalid anomaly state: %s", state)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.anomalies[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrAnomalyNotFound, id)
+	}
+
+	stored.State = state
+	stored.Note = note
+	stored.UpdatedAt = time.Now()
+
+	if err := s.saveLocked(stored); err != nil {
+		return nil, err
+	}
+	return copyStored(stored), nil
+}
+
+// Counts returns the number of stored anomalies in each state
+func (s *AnomalyStore) Counts() map[AnomalyState]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := map[AnomalyState]int{
+		AnomalyStateOpen:         0,
+		AnomalyStateAcknowledged: 0,
+		AnomalyStateResolved:     0,
+		AnomalyStateSuppressed:   0,
+	}
+	for _, stored := range s.anomalies {
+		counts[stored.State]++
+	}
+	return counts
+}
+
+// Prune removes resolved and suppressed anomalies not seen within the
+// retention period. Returns the number removed.
+func (s *AnomalyStore) Prune(now time.Time) int {
+	if s.retention <= 0 {
+		return 0
+	}
+	cutoff := now.Add(-s.retention)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops := make([]platform.BatchOp, 0)
+	for id, stored := range s.anomalies {
+		if stored.State != AnomalyStateResolved && stored.State != AnomalyStateSuppressed {
+			continue
+		}
+		if !stored.LastSeen.Before(cutoff) {
+			continue
+		}
+		delete(s.anomalies, id)
+		ops = append(ops, platform.BatchOp{Type: platform.BatchOpDelete, Key: AnomalyPrefix + id})
+	}
+
+	if len(ops) > 0 {
+		if err := s.storage.Batch(ops); err != nil {
+			log.Printf("[AnomalyStore] Failed to delete pruned anomalies: %v", err)
+		}
+	}
+	return len(ops)
+}
+
+// saveLocked persists an anomaly. Caller must hold the write lock.
+func (s *AnomalyStore) saveLocked(stored *StoredAnomaly) error {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal anomaly: %w", err)
+	}
+	if err := s.storage.Set(AnomalyPrefix+stored.ID, data); err != nil {
+		return fmt.Errorf("failed to store anomaly: %w", err)
+	}
+	return nil
+}
+
+// copyStored returns a copy safe to hand out of the store
+func copyStored(stored *StoredAnomaly) *StoredAnomaly {
+	c := *stored
+	return &c
+}
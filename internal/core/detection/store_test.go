@@ -0,0 +1,120 @@
+package detection
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+func newTestStorage(t *testing.T) *mocks.MockStorageProvider {
+	t.Helper()
+	storage := mocks.NewMockStorageProvider()
+	if err := storage.Open("", nil); err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	return storage
+}
+
+func testPortAnomaly(port uint16, at time.Time) *Anomaly {
+	return &Anomaly{
+		DeviceMAC:   "aa:bb:cc:dd:ee:ff",
+		Type:        AnomalyUnusualPort,
+		Severity:    SeverityMedium,
+		Description: "Unusual port",
+		Timestamp:   at,
+		Evidence:    map[string]interface{}{"port": port, "count": 10},
+	}
+}
+
+func TestAnomalyStoreDeduplicates(t *testing.T) {
+	storage := newTestStorage(t)
+	store, err := NewAnomalyStore(storage, nil)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	first, isNew, err := store.Record(testPortAnomaly(4444, base))
+	if err != nil || !isNew {
+		t.Fatalf("Expected first detection to be new, got %v (%v)", isNew, err)
+	}
+
+	// Re-raised every detector tick
+	for i := 1; i <= 3; i++ {
+		_, isNew, _ = store.Record(testPortAnomaly(4444, base.Add(time.Duration(i)*30*time.Second)))
+		if isNew {
+			t.Fatal("Expected repeat detection to be deduplicated")
+		}
+	}
+
+	stored, err := store.Get(first.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if stored.Occurrences != 4 {
+		t.Errorf("Expected 4 occurrences, got %d", stored.Occurrences)
+	}
+	if !stored.FirstSeen.Equal(base) || !stored.LastSeen.Equal(base.Add(90*time.Second)) {
+		t.Errorf("Unexpected first/last seen: %v / %v", stored.FirstSeen, stored.LastSeen)
+	}
+
+	// A different port is a different anomaly
+	if _, isNew, _ := store.Record(testPortAnomaly(5555, base)); !isNew {
+		t.Error("Expected a different port to be a new anomaly")
+	}
+
+	// Records survive a restart
+	reopened, err := NewAnomalyStore(storage, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if got := reopened.List(AnomalyFilter{}); len(got) != 2 {
+		t.Errorf("Expected 2 persisted anomalies, got %d", len(got))
+	}
+}
+
+func TestAnomalyStoreStates(t *testing.T) {
+	store, err := NewAnomalyStore(newTestStorage(t), nil)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stored, _, _ := store.Record(testPortAnomaly(4444, base))
+
+	if _, err := store.SetState(stored.ID, "closed", ""); err == nil {
+		t.Error("Expected unknown state to be rejected")
+	}
+	if _, err := store.SetState("missing", AnomalyStateResolved, ""); !errors.Is(err, ErrAnomalyNotFound) {
+		t.Errorf("Expected ErrAnomalyNotFound for an unknown ID, got %v", err)
+	}
+
+	// Acknowledged anomalies stay quiet
+	if _, err := store.SetState(stored.ID, AnomalyStateAcknowledged, "looking into it"); err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	if _, isNew, _ := store.Record(testPortAnomaly(4444, base.Add(time.Minute))); isNew {
+		t.Error("Expected acknowledged anomaly not to be re-raised")
+	}
+	if got := store.List(AnomalyFilter{State: AnomalyStateAcknowledged}); len(got) != 1 {
+		t.Errorf("Expected 1 acknowledged anomaly, got %d", len(got))
+	}
+
+	// Resolved anomalies reopen when they recur
+	store.SetState(stored.ID, AnomalyStateResolved, "")
+	recurred, isNew, _ := store.Record(testPortAnomaly(4444, base.Add(2*time.Minute)))
+	if !isNew || recurred.State != AnomalyStateOpen {
+		t.Errorf("Expected resolved anomaly to reopen, got new=%v state=%s", isNew, recurred.State)
+	}
+
+	// Pruning only removes old resolved/suppressed anomalies
+	store.SetState(stored.ID, AnomalyStateSuppressed, "")
+	if removed := store.Prune(base.Add(24 * time.Hour)); removed != 0 {
+		t.Errorf("Expected nothing pruned within retention, got %d", removed)
+	}
+	if removed := store.Prune(base.Add(31 * 24 * time.Hour)); removed != 1 {
+		t.Errorf("Expected 1 pruned anomaly, got %d", removed)
+	}
+}
@@ -0,0 +1,69 @@
+package detection
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// AnomalyNewTLSClient is raised when a device starts using an unfamiliar TLS stack
+const AnomalyNewTLSClient AnomalyType = "new_tls_client"
+
+// stableTLSClients is the number of known fingerprints up to which a device
+// is considered to have a fixed software stack (typical for IoT devices)
+const stableTLSClients = 3
+
+// detectNewTLSClients reports TLS client fingerprints first seen in the last
+// hour on a device observed past its learning period. A new client on a device
+// with a small, stable set of fingerprints is more suspicious than one on a
+// general-purpose computer running many applications.
+func (d *Detector) detectNewTLSClients(profile *database.BehavioralProfile) []*Anomaly {
+	anomalies := make([]*Anomaly, 0)
+
+	learned := profile.FirstSeen.Add(learningPeriod)
+	since := profile.LastSeen.Add(-recentWindow)
+	if len(profile.TLSClients) == 0 || !since.After(learned) {
+		return anomalies
+	}
+
+	established := 0
+	fingerprints := make([]string, 0)
+	for ja4, client := range profile.TLSClients {
+		if client.FirstSeen.Before(since) {
+			established++
+		} else {
+			fingerprints = append(fingerprints, ja4)
+		}
+	}
+	if established == 0 {
+		return anomalies
+	}
+	sort.Strings(fingerprints)
+
+	severity := SeverityLow
+	if established <= stableTLSClients {
+		severity = SeverityMedium
+	}
+
+	for _, ja4 := range fingerprints {
+		client := profile.TLSClients[ja4]
+		anomalies = append(anomalies, &Anomaly{
+			DeviceMAC:   profile.MAC,
+			Type:        AnomalyNewTLSClient,
+			Severity:    severity,
+			Description: fmt.Sprintf("Device started using a new TLS client %s (%d previously known)", ja4, established),
+			Timestamp:   time.Now(),
+			Evidence: map[string]interface{}{
+				"ja4":          ja4,
+				"ja3_hash":     client.JA3Hash,
+				"server_names": client.SNIs,
+				"known_count":  established,
+				"first_seen":   client.FirstSeen,
+			},
+		})
+	}
+
+	return anomalies
+}
@@ -0,0 +1,53 @@
+package detection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+func TestNewTLSClientRule(t *testing.T) {
+	detector, err := NewDetector(&Config{Sensitivity: 0.5, BaselineThreshold: 0})
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := first.Add(48 * time.Hour)
+	profile := &database.BehavioralProfile{
+		MAC:          "aa:bb:cc:dd:ee:ff",
+		FirstSeen:    first,
+		LastSeen:     now,
+		TotalPackets: 1000,
+		TLSClients: map[string]*database.TLSClientInfo{
+			"t13d1516h2_8daaf6152771_e5627efa2ab1": {JA4: "t13d1516h2_8daaf6152771_e5627efa2ab1", FirstSeen: first, LastSeen: now},
+			"t12i0903ht_a1b2c3d4e5f6_000000000000": {
+				JA4:       "t12i0903ht_a1b2c3d4e5f6_000000000000",
+				JA3Hash:   "e7d705a3286e19ea42f587b344ee6865",
+				SNIs:      []string{"c2.example.net"},
+				FirstSeen: now.Add(-5 * time.Minute),
+				LastSeen:  now,
+			},
+		},
+	}
+
+	anomalies, err := detector.Analyze(profile)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	found := FilterByType(anomalies, AnomalyNewTLSClient)
+	if len(found) != 1 {
+		t.Fatalf("Expected one new TLS client anomaly, got %d", len(found))
+	}
+	if found[0].Evidence["ja4"] != "t12i0903ht_a1b2c3d4e5f6_000000000000" || found[0].Severity != SeverityMedium {
+		t.Errorf("Unexpected anomaly: %+v", found[0])
+	}
+
+	// A device with no established fingerprints has nothing to compare against
+	delete(profile.TLSClients, "t13d1516h2_8daaf6152771_e5627efa2ab1")
+	anomalies, _ = detector.Analyze(profile)
+	if got := FilterByType(anomalies, AnomalyNewTLSClient); len(got) != 0 {
+		t.Errorf("Expected no anomalies without established clients, got %d", len(got))
+	}
+}
@@ -0,0 +1,257 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// RecordPrefix is the storage key prefix for completed flows. Keys embed the
+// flow's end time so they sort chronologically.
+const RecordPrefix = "flow:"
+
+// Filter selects stored flows. Zero fields match everything.
+type Filter struct {
+	DeviceMAC string // Either end of the flow
+	IP        string // Either end of the flow
+	Protocol  string
+	Port      uint16 // Destination port
+	Since     time.Time
+	MinBytes  int64 // Total bytes in both directions
+	Limit     int
+}
+
+// ParseFilter builds a filter from URL query parameters: device, ip,
+// protocol, port, since (RFC3339), min_bytes and limit
+func ParseFilter(query url.Values) (Filter, error) {
+	filter := Filter{
+		DeviceMAC: query.Get("device"),
+		IP:        query.Get("ip"),
+		Protocol:  strings.ToUpper(query.Get("protocol")),
+	}
+
+	if port := query.Get("port"); port != "" {
+		n, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return filter, fmt.Errorf("invalid port: %s", port)
+		}
+		filter.Port = uint16(n)
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since time (expected RFC3339): %s", since)
+		}
+		filter.Since = t
+	}
+	if minBytes := query.Get("min_bytes"); minBytes != "" {
+		n, err := strconv.ParseInt(minBytes, 10, 64)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("invalid min_bytes: %s", minBytes)
+		}
+		filter.MinBytes = n
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("invalid limit: %s", limit)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+// StoreConfig contains configuration for the flow store
+type StoreConfig struct {
+	// Retention removes flows that ended longer ago than this (0 keeps them
+	// until MaxRecords pushes them out)
+	Retention time.Duration
+	// MaxRecords bounds the number of stored flows; the oldest are removed first
+	MaxRecords int
+}
+
+// DefaultStoreConfig returns a flow store configuration with sensible defaults
+func DefaultStoreConfig() *StoreConfig {
+	return &StoreConfig{
+		Retention:  7 * 24 * time.Hour,
+		MaxRecords: 100000,
+	}
+}
+
+// Store persists completed flows and answers queries over them
+type Store struct {
+	storage    platform.StorageProvider
+	retention  time.Duration
+	maxRecords int
+	records    []*Record // Sorted by end time, oldest first
+	mu         sync.RWMutex
+}
+
+// NewStore creates a flow store and loads previously stored flows
+func NewStore(storage platform.StorageProvider, cfg *StoreConfig) (*Store, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("storage provider is required")
+	}
+	if cfg == nil {
+		cfg = DefaultStoreConfig()
+	}
+	if cfg.Retention < 0 {
+		return nil, fmt.Errorf("retention must be non-negative, got %v", cfg.Retention)
+	}
+	if cfg.MaxRecords <= 0 {
+		return nil, fmt.Errorf("max records must be positive, got %d", cfg.MaxRecords)
+	}
+
+	s := &Store{
+		storage:    storage,
+		retention:  cfg.Retention,
+		maxRecords: cfg.MaxRecords,
+		records:    make([]*Record, 0),
+	}
+
+	keys, err := storage.List(RecordPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flows: %w", err)
+	}
+	for _, key := range keys {
+		data, err := storage.Get(key)
+		if err != nil {
+			log.Printf("[FlowStore] Failed to load %s: %v", key, err)
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			log.Printf("[FlowStore] Failed to decode %s: %v", key, err)
+			continue
+		}
+		s.records = append(s.records, &rec)
+	}
+	sort.SliceStable(s.records, func(i, j int) bool {
+		return s.records[i].End.Before(s.records[j].End)
+	})
+
+	return s, nil
+}
+
+// Add stores a completed flow
+func (s *Store) Add(rec *Record) error {
+	if rec == nil {
+		return fmt.Errorf("flow record is nil")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal flow: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.storage.Set(recordKey(rec), data); err != nil {
+		return fmt.Errorf("failed to store flow: %w", err)
+	}
+
+	// Flows mostly complete in order, so this is usually an append
+	i := sort.Search(len(s.records), func(i int) bool {
+		return s.records[i].End.After(rec.End)
+	})
+	s.records = append(s.records, nil)
+	copy(s.records[i+1:], s.records[i:])
+	s.records[i] = rec
+
+	if excess := len(s.records) - s.maxRecords; excess > 0 {
+		s.removeOldestLocked(excess)
+	}
+	return nil
+}
+
+// List returns the flows matching filter, most recently ended first
+func (s *Store) List(filter Filter) []*Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Record, 0)
+	for i := len(s.records) - 1; i >= 0; i-- {
+		rec := s.records[i]
+		if !filter.Since.IsZero() && rec.End.Before(filter.Since) {
+			break
+		}
+		if filter.DeviceMAC != "" && !strings.EqualFold(rec.SrcMAC, filter.DeviceMAC) && !strings.EqualFold(rec.DstMAC, filter.DeviceMAC) {
+			continue
+		}
+		if filter.IP != "" && rec.SrcIP != filter.IP && rec.DstIP != filter.IP {
+			continue
+		}
+		if filter.Protocol != "" && rec.Protocol != filter.Protocol {
+			continue
+		}
+		if filter.Port != 0 && rec.DstPort != filter.Port {
+			continue
+		}
+		if rec.SrcBytes+rec.DstBytes < filter.MinBytes {
+			continue
+		}
+
+		c := *rec
+		result = append(result, &c)
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// Count returns the number of stored flows
+func (s *Store) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+// Prune removes flows that ended before the retention period. Returns the
+// number removed.
+func (s *Store) Prune(now time.Time) int {
+	if s.retention <= 0 {
+		return 0
+	}
+	cutoff := now.Add(-s.retention)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := sort.Search(len(s.records), func(i int) bool {
+		return !s.records[i].End.Before(cutoff)
+	})
+	s.removeOldestLocked(expired)
+	return expired
+}
+
+// removeOldestLocked deletes the n oldest flows. Caller must hold the write lock.
+func (s *Store) removeOldestLocked(n int) {
+	if n <= 0 {
+		return
+	}
+
+	ops := make([]platform.BatchOp, 0, n)
+	for _, rec := range s.records[:n] {
+		ops = append(ops, platform.BatchOp{Type: platform.BatchOpDelete, Key: recordKey(rec)})
+	}
+	if err := s.storage.Batch(ops); err != nil {
+		log.Printf("[FlowStore] Failed to delete old flows: %v", err)
+	}
+
+	s.records = append(s.records[:0], s.records[n:]...)
+}
+
+// recordKey returns the storage key of a flow
+func recordKey(rec *Record) string {
+	return fmt.Sprintf("%s%020d:%s", RecordPrefix, rec.End.UnixNano(), rec.ID)
+}
@@ -0,0 +1,80 @@
+package flow
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+func testRecord(id string, port uint16, end time.Time, sent int64) *Record {
+	return &Record{
+		ID:       id,
+		Protocol: "TCP",
+		SrcMAC:   "aa:bb:cc:00:00:01",
+		SrcIP:    "192.168.1.10",
+		SrcPort:  51000,
+		DstIP:    "93.184.216.34",
+		DstPort:  port,
+		Start:    end.Add(-time.Minute),
+		End:      end,
+		SrcBytes: sent,
+		DstBytes: 100,
+	}
+}
+
+func TestStoreQueryAndRetention(t *testing.T) {
+	storage := mocks.NewMockStorageProvider()
+	if err := storage.Open("", nil); err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	store, err := NewStore(storage, &StoreConfig{Retention: 24 * time.Hour, MaxRecords: 3})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, rec := range []*Record{
+		testRecord("a", 443, base, 1000),
+		testRecord("c", 22, base.Add(2*time.Hour), 50_000_000),
+		testRecord("b", 443, base.Add(time.Hour), 2000), // Out of order
+		testRecord("d", 443, base.Add(3*time.Hour), 3000),
+	} {
+		if err := store.Add(rec); err != nil {
+			t.Fatalf("Add %d failed: %v", i, err)
+		}
+	}
+
+	// The oldest flow was pushed out by the record limit
+	all := store.List(Filter{})
+	if len(all) != 3 || all[0].ID != "d" || all[1].ID != "c" || all[2].ID != "b" {
+		t.Fatalf("Expected flows d, c, b newest first, got %d", len(all))
+	}
+
+	filter, err := ParseFilter(url.Values{"device": {"AA:BB:CC:00:00:01"}, "min_bytes": {"1000000"}})
+	if err != nil {
+		t.Fatalf("ParseFilter failed: %v", err)
+	}
+	if got := store.List(filter); len(got) != 1 || got[0].ID != "c" {
+		t.Errorf("Expected the large upload only, got %d flows", len(got))
+	}
+	if got := store.List(Filter{Port: 443, Limit: 1}); len(got) != 1 || got[0].ID != "d" {
+		t.Errorf("Expected newest HTTPS flow, got %v", got)
+	}
+	if _, err := ParseFilter(url.Values{"port": {"70000"}}); err == nil {
+		t.Error("Expected invalid port to be rejected")
+	}
+
+	// Flows survive a restart, and expire with the retention period
+	reloaded, err := NewStore(storage, &StoreConfig{Retention: 24 * time.Hour, MaxRecords: 3})
+	if err != nil || reloaded.Count() != 3 {
+		t.Fatalf("Expected 3 flows after reload, got %d (%v)", reloaded.Count(), err)
+	}
+	if removed := reloaded.Prune(base.Add(26*time.Hour + 30*time.Minute)); removed != 2 {
+		t.Errorf("Expected 2 expired flows, got %d", removed)
+	}
+	if keys, _ := storage.List(RecordPrefix); len(keys) != 1 {
+		t.Errorf("Expected 1 stored flow after pruning, got %d", len(keys))
+	}
+}
@@ -0,0 +1,474 @@
+// Package flow tracks connections as bidirectional flows.
+//
+// The Table runs as a packet.Inspector inside the packet analyzer and groups
+// packets by 5-tuple (protocol, addresses and ports), counting packets and
+// bytes in each direction and following the TCP handshake and teardown. A
+// flow completes when TCP closes it (FIN from both sides or RST), when it has
+// been idle for its protocol's timeout, or when it is evicted from a full
+// table. Completed flows are sent to an output channel as Records, to be
+// applied to behavioral profiles and kept in a Store for querying.
+//
+// Time is measured against packet timestamps so offline replays expire flows
+// as they would have expired live.
+package flow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// State is the connection state of a flow
+type State string
+
+const (
+	StateNew         State = "new"         // No reply yet, or TCP handshake not completed
+	StateEstablished State = "established" // Both sides have sent packets
+	StateClosing     State = "closing"     // One side sent FIN
+	StateClosed      State = "closed"      // Both sides sent FIN, or either sent RST
+)
+
+// EndReason records why a flow completed
+type EndReason string
+
+const (
+	EndReasonFIN      EndReason = "fin"
+	EndReasonRST      EndReason = "rst"
+	EndReasonIdle     EndReason = "idle"
+	EndReasonEvicted  EndReason = "evicted"
+	EndReasonShutdown EndReason = "shutdown"
+)
+
+// Key identifies a flow by its 5-tuple, oriented from the side that opened it
+type Key struct {
+	Protocol string
+	SrcIP    string
+	SrcPort  uint16
+	DstIP    string
+	DstPort  uint16
+}
+
+// Reverse returns the key of the opposite direction
+func (k Key) Reverse() Key {
+	return Key{Protocol: k.Protocol, SrcIP: k.DstIP, SrcPort: k.DstPort, DstIP: k.SrcIP, DstPort: k.SrcPort}
+}
+
+// String formats the key as "TCP 10.0.0.5:51000 > 93.184.216.34:443"
+func (k Key) String() string {
+	return fmt.Sprintf("%s %s:%d > %s:%d", k.Protocol, k.SrcIP, k.SrcPort, k.DstIP, k.DstPort)
+}
+
+// Record is a flow. Src is the side that opened the connection: Src* counters
+// cover packets it sent and Dst* counters the replies.
+type Record struct {
+	ID         string    `json:"id"`
+	Protocol   string    `json:"protocol"`
+	SrcMAC     string    `json:"src_mac"`
+	SrcIP      string    `json:"src_ip"`
+	SrcPort    uint16    `json:"src_port"`
+	DstMAC     string    `json:"dst_mac,omitempty"`
+	DstIP      string    `json:"dst_ip"`
+	DstPort    uint16    `json:"dst_port"`
+	State      State     `json:"state"`
+	EndReason  EndReason `json:"end_reason,omitempty"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Duration   float64   `json:"duration_seconds"`
+	SrcPackets int64     `json:"src_packets"`
+	SrcBytes   int64     `json:"src_bytes"`
+	DstPackets int64     `json:"dst_packets"`
+	DstBytes   int64     `json:"dst_bytes"`
+}
+
+// Key returns the flow's 5-tuple
+func (r *Record) Key() Key {
+	return Key{Protocol: r.Protocol, SrcIP: r.SrcIP, SrcPort: r.SrcPort, DstIP: r.DstIP, DstPort: r.DstPort}
+}
+
+// Sent returns the bytes the device with the given MAC sent and received in
+// the flow. ok is false if the device is at neither end.
+func (r *Record) Sent(mac string) (sentBytes, receivedBytes int64, ok bool) {
+	switch mac {
+	case r.SrcMAC:
+		return r.SrcBytes, r.DstBytes, true
+	case r.DstMAC:
+		return r.DstBytes, r.SrcBytes, true
+	}
+	return 0, 0, false
+}
+
+// Peer returns the IP address at the other end of the flow from the device
+// with the given MAC
+func (r *Record) Peer(mac string) string {
+	if mac == r.DstMAC && mac != r.SrcMAC {
+		return r.SrcIP
+	}
+	return r.DstIP
+}
+
+// Config contains configuration for the flow table
+type Config struct {
+	// TCPIdleTimeout expires established TCP flows without packets for this long
+	TCPIdleTimeout time.Duration
+	// HandshakeTimeout expires TCP flows whose handshake never completes
+	HandshakeTimeout time.Duration
+	// IdleTimeout expires UDP, ICMP and other flows without packets for this long
+	IdleTimeout time.Duration
+	// ClosedTimeout is how long closed TCP flows linger to absorb trailing ACKs
+	// and retransmissions before they are emitted
+	ClosedTimeout time.Duration
+	// MaxFlows bounds the number of flows tracked at once
+	MaxFlows int
+}
+
+// DefaultConfig returns a configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		TCPIdleTimeout:   5 * time.Minute,
+		HandshakeTimeout: 30 * time.Second,
+		IdleTimeout:      time.Minute,
+		ClosedTimeout:    5 * time.Second,
+		MaxFlows:         65536,
+	}
+}
+
+// sweepInterval is how often, in packet time, Inspect checks for expired flows
+const sweepInterval = time.Second
+
+// entry is a tracked flow with the TCP state needed to close it
+type entry struct {
+	record   *Record
+	lastSeen time.Time
+	finSrc   bool
+	finDst   bool
+}
+
+// Table tracks active flows and emits them as they complete. It implements
+// packet.Inspector.
+type Table struct {
+	cfg    Config
+	output chan<- *Record
+	flows  map[Key]*entry
+
+	// The table clock follows packet timestamps, advancing with the wall
+	// clock between packets so idle flows expire on a quiet network
+	latestPacket time.Time
+	latestWall   time.Time
+	lastSweep    time.Time
+
+	dropped uint64
+	mu      sync.Mutex
+}
+
+// NewTable creates a flow table that sends completed flows to output.
+// Sends never block; records are dropped while output is full.
+func NewTable(output chan<- *Record, cfg *Config) (*Table, error) {
+	if output == nil {
+		return nil, fmt.Errorf("output channel is required")
+	}
+	defaults := DefaultConfig()
+	if cfg == nil {
+		cfg = defaults
+	}
+	c := *cfg
+	if c.TCPIdleTimeout <= 0 {
+		c.TCPIdleTimeout = defaults.TCPIdleTimeout
+	}
+	if c.HandshakeTimeout <= 0 {
+		c.HandshakeTimeout = defaults.HandshakeTimeout
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = defaults.IdleTimeout
+	}
+	if c.ClosedTimeout <= 0 {
+		c.ClosedTimeout = defaults.ClosedTimeout
+	}
+	if c.MaxFlows <= 0 {
+		c.MaxFlows = defaults.MaxFlows
+	}
+
+	return &Table{
+		cfg:    c,
+		output: output,
+		flows:  make(map[Key]*entry),
+	}, nil
+}
+
+// Inspect adds a captured packet to its flow
+func (t *Table) Inspect(pkt *platform.Packet, info *packet.PacketInfo) {
+	if pkt.SrcIP == nil || pkt.DstIP == nil {
+		return
+	}
+
+	at := pkt.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	key := Key{
+		Protocol: pkt.Protocol,
+		SrcIP:    pkt.SrcIP.String(),
+		SrcPort:  pkt.SrcPort,
+		DstIP:    pkt.DstIP.String(),
+		DstPort:  pkt.DstPort,
+	}
+
+	var flags uint8
+	var hasFlags bool
+	if pkt.Protocol == "TCP" {
+		flags, hasFlags = packet.TCPFlags(pkt.RawData)
+	}
+
+	var completed []*Record
+
+	t.mu.Lock()
+	if at.After(t.latestPacket) {
+		t.latestPacket = at
+		t.latestWall = time.Now()
+	}
+	if at.Sub(t.lastSweep) >= sweepInterval {
+		t.lastSweep = at
+		completed = t.expireLocked(at)
+	}
+
+	e, fromSrc := t.flows[key], true
+	if e == nil {
+		if e = t.flows[key.Reverse()]; e != nil {
+			fromSrc = false
+		}
+	}
+
+	// A new SYN on a closed connection's ports starts a new connection
+	if e != nil && e.record.State == StateClosed && hasFlags && flags&(packet.TCPFlagSYN|packet.TCPFlagACK) == packet.TCPFlagSYN {
+		completed = append(completed, t.removeLocked(e, e.record.EndReason))
+		e = nil
+	}
+
+	if e == nil {
+		if len(t.flows) >= t.cfg.MaxFlows {
+			completed = append(completed, t.evictLocked())
+		}
+
+		// A SYN-ACK seen first means the handshake started before capture did;
+		// orient the flow from the side that sent the SYN
+		srcMAC, dstMAC := info.SrcMAC, info.DstMAC
+		if hasFlags && flags&(packet.TCPFlagSYN|packet.TCPFlagACK) == packet.TCPFlagSYN|packet.TCPFlagACK {
+			key = key.Reverse()
+			srcMAC, dstMAC = dstMAC, srcMAC
+			fromSrc = false
+		}
+		e = &entry{record: &Record{
+			Protocol: key.Protocol,
+			SrcMAC:   srcMAC,
+			SrcIP:    key.SrcIP,
+			SrcPort:  key.SrcPort,
+			DstMAC:   dstMAC,
+			DstIP:    key.DstIP,
+			DstPort:  key.DstPort,
+			State:    StateNew,
+			Start:    at,
+		}}
+		// Without a SYN the connection was already open when capture started
+		if hasFlags && flags&packet.TCPFlagSYN == 0 {
+			e.record.State = StateEstablished
+		}
+		t.flows[key] = e
+	}
+
+	rec := e.record
+	if fromSrc {
+		rec.SrcPackets++
+		rec.SrcBytes += int64(pkt.PayloadSize)
+	} else {
+		rec.DstPackets++
+		rec.DstBytes += int64(pkt.PayloadSize)
+		if rec.DstMAC == "" {
+			rec.DstMAC = info.SrcMAC
+		}
+	}
+	if at.After(rec.End) {
+		rec.End = at
+		e.lastSeen = at
+	}
+
+	if hasFlags {
+		e.updateTCP(flags, fromSrc)
+	} else if !fromSrc && rec.State == StateNew {
+		rec.State = StateEstablished
+	}
+	t.mu.Unlock()
+
+	t.emit(completed)
+}
+
+// updateTCP advances the connection state for a TCP segment
+func (e *entry) updateTCP(flags uint8, fromSrc bool) {
+	rec := e.record
+	if rec.State == StateClosed {
+		return
+	}
+
+	switch {
+	case flags&packet.TCPFlagRST != 0:
+		rec.State = StateClosed
+		rec.EndReason = EndReasonRST
+		return
+	case flags&packet.TCPFlagSYN != 0:
+		if !fromSrc && flags&packet.TCPFlagACK != 0 {
+			rec.State = StateEstablished
+		}
+		return
+	}
+
+	if flags&packet.TCPFlagFIN != 0 {
+		if fromSrc {
+			e.finSrc = true
+		} else {
+			e.finDst = true
+		}
+		rec.State = StateClosing
+		if e.finSrc && e.finDst {
+			rec.State = StateClosed
+			rec.EndReason = EndReasonFIN
+		}
+		return
+	}
+
+	// Data or ACK from the responder completes a handshake whose SYN-ACK was missed
+	if rec.State == StateNew && !fromSrc {
+		rec.State = StateEstablished
+	}
+}
+
+// timeout returns how long a flow may go without packets in its current state
+func (t *Table) timeout(e *entry) time.Duration {
+	rec := e.record
+	switch {
+	case rec.State == StateClosed:
+		return t.cfg.ClosedTimeout
+	case rec.Protocol != "TCP":
+		return t.cfg.IdleTimeout
+	case rec.State == StateNew:
+		return t.cfg.HandshakeTimeout
+	default:
+		return t.cfg.TCPIdleTimeout
+	}
+}
+
+// Sweep emits flows that have expired by the table clock and returns how
+// many. Inspect sweeps as packets arrive; call Sweep periodically so flows
+// also complete while no packets are captured.
+func (t *Table) Sweep() int {
+	t.mu.Lock()
+	now := t.now()
+	t.lastSweep = now
+	completed := t.expireLocked(now)
+	t.mu.Unlock()
+
+	t.emit(completed)
+	return len(completed)
+}
+
+// Flush completes every active flow and returns them instead of sending them
+// to the output channel. Used on shutdown, when nothing reads the channel.
+func (t *Table) Flush() []*Record {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	completed := make([]*Record, 0, len(t.flows))
+	for _, e := range t.flows {
+		reason := EndReasonShutdown
+		if e.record.State == StateClosed {
+			reason = e.record.EndReason
+		}
+		completed = append(completed, t.removeLocked(e, reason))
+	}
+	return completed
+}
+
+// Len returns the number of active flows
+func (t *Table) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.flows)
+}
+
+// Dropped returns the number of completed flows dropped because the output
+// channel was full
+func (t *Table) Dropped() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// now returns the table clock. Caller must hold the lock.
+func (t *Table) now() time.Time {
+	if t.latestPacket.IsZero() {
+		return time.Now()
+	}
+	return t.latestPacket.Add(time.Since(t.latestWall))
+}
+
+// expireLocked removes and returns the flows idle past their timeout at now.
+// Caller must hold the lock.
+func (t *Table) expireLocked(now time.Time) []*Record {
+	var completed []*Record
+	for _, e := range t.flows {
+		if now.Sub(e.lastSeen) < t.timeout(e) {
+			continue
+		}
+		reason := EndReasonIdle
+		if e.record.State == StateClosed {
+			reason = e.record.EndReason
+		}
+		completed = append(completed, t.removeLocked(e, reason))
+	}
+	return completed
+}
+
+// evictLocked removes the least recently active flow to make room in a full
+// table. Caller must hold the lock.
+func (t *Table) evictLocked() *Record {
+	var oldest *entry
+	for _, e := range t.flows {
+		if oldest == nil || e.lastSeen.Before(oldest.lastSeen) {
+			oldest = e
+		}
+	}
+	return t.removeLocked(oldest, EndReasonEvicted)
+}
+
+// removeLocked stops tracking a flow and finalizes its record. Caller must
+// hold the lock.
+func (t *Table) removeLocked(e *entry, reason EndReason) *Record {
+	rec := e.record
+	delete(t.flows, rec.Key())
+
+	rec.EndReason = reason
+	rec.Duration = rec.End.Sub(rec.Start).Seconds()
+	rec.ID = recordID(rec)
+	return rec
+}
+
+// emit sends completed flows to the output channel without blocking
+func (t *Table) emit(completed []*Record) {
+	for _, rec := range completed {
+		select {
+		case t.output <- rec:
+		default:
+			t.mu.Lock()
+			t.dropped++
+			t.mu.Unlock()
+		}
+	}
+}
+
+// recordID derives a stable ID from a flow's 5-tuple and start time
+func recordID(rec *Record) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d", rec.Key(), rec.SrcMAC, rec.Start.UnixNano())))
+	return hex.EncodeToString(sum[:8])
+}
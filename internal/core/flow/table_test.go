@@ -0,0 +1,175 @@
+package flow
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+var (
+	clientMAC, _ = net.ParseMAC("aa:bb:cc:00:00:01")
+	routerMAC, _ = net.ParseMAC("aa:bb:cc:00:00:fe")
+	clientIP     = net.ParseIP("192.168.1.10").To4()
+	serverIP     = net.ParseIP("93.184.216.34").To4()
+)
+
+// tcpFrame builds an Ethernet/IPv4/TCP frame carrying the given flags
+func tcpFrame(flags uint8) []byte {
+	frame := make([]byte, 54)
+	binary.BigEndian.PutUint16(frame[12:14], 0x0800)
+	frame[14] = 0x45
+	binary.BigEndian.PutUint16(frame[16:18], 40)
+	frame[23] = 6
+	frame[14+20+12] = 5 << 4
+	frame[14+20+13] = flags
+	return frame
+}
+
+// segment builds a captured TCP packet in the client→server direction, or
+// the reverse when reply is set
+func segment(at time.Time, flags uint8, size uint32, reply bool) (*platform.Packet, *packet.PacketInfo) {
+	pkt := &platform.Packet{
+		Timestamp:   at,
+		SrcMAC:      clientMAC,
+		DstMAC:      routerMAC,
+		SrcIP:       clientIP,
+		DstIP:       serverIP,
+		SrcPort:     51000,
+		DstPort:     443,
+		Protocol:    "TCP",
+		PayloadSize: size,
+		RawData:     tcpFrame(flags),
+	}
+	if reply {
+		pkt.SrcMAC, pkt.DstMAC = pkt.DstMAC, pkt.SrcMAC
+		pkt.SrcIP, pkt.DstIP = pkt.DstIP, pkt.SrcIP
+		pkt.SrcPort, pkt.DstPort = pkt.DstPort, pkt.SrcPort
+	}
+	return pkt, &packet.PacketInfo{Timestamp: at, SrcMAC: pkt.SrcMAC.String(), DstMAC: pkt.DstMAC.String(), Protocol: "TCP", Size: size}
+}
+
+func newTestTable(t *testing.T) (*Table, chan *Record) {
+	t.Helper()
+	output := make(chan *Record, 10)
+	table, err := NewTable(output, nil)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	return table, output
+}
+
+func TestTableTCPLifecycle(t *testing.T) {
+	table, output := newTestTable(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	syn, ack, fin := packet.TCPFlagSYN, packet.TCPFlagACK, packet.TCPFlagFIN
+
+	steps := []struct {
+		flags uint8
+		size  uint32
+		reply bool
+	}{
+		{syn, 0, false},
+		{syn | ack, 0, true},
+		{ack, 0, false},
+		{ack, 5000, false}, // Upload
+		{ack, 200, true},
+		{fin | ack, 0, false},
+		{fin | ack, 0, true},
+		{ack, 0, false}, // Trailing ACK is absorbed by the closed flow
+	}
+	for i, step := range steps {
+		table.Inspect(segment(start.Add(time.Duration(i)*100*time.Millisecond), step.flags, step.size, step.reply))
+	}
+	if table.Len() != 1 {
+		t.Fatalf("Expected one active flow, got %d", table.Len())
+	}
+
+	// The closed flow is emitted once it has lingered
+	table.Inspect(segment(start.Add(10*time.Second), syn, 0, false))
+	select {
+	case rec := <-output:
+		if rec.State != StateClosed || rec.EndReason != EndReasonFIN {
+			t.Errorf("Expected flow closed by FIN, got %s/%s", rec.State, rec.EndReason)
+		}
+		if rec.SrcMAC != clientMAC.String() || rec.DstIP != serverIP.String() || rec.DstPort != 443 {
+			t.Errorf("Expected flow oriented from the client, got %s", rec.Key())
+		}
+		if rec.SrcPackets != 5 || rec.SrcBytes != 5000 || rec.DstPackets != 3 || rec.DstBytes != 200 {
+			t.Errorf("Unexpected counters: %+v", rec)
+		}
+		if rec.Duration < 0.69 || rec.Duration > 0.71 {
+			t.Errorf("Expected 0.7s duration, got %v", rec.Duration)
+		}
+		if sent, received, ok := rec.Sent(routerMAC.String()); !ok || sent != 200 || received != 5000 {
+			t.Errorf("Expected router to have sent 200 and received 5000 bytes, got %d/%d", sent, received)
+		}
+	default:
+		t.Fatal("Expected completed flow")
+	}
+
+	// The new SYN started a fresh connection on the same ports
+	if table.Len() != 1 {
+		t.Fatalf("Expected the new connection to be tracked, got %d flows", table.Len())
+	}
+	flushed := table.Flush()
+	if len(flushed) != 1 || flushed[0].EndReason != EndReasonShutdown || flushed[0].State != StateNew {
+		t.Errorf("Expected flushed half-open flow, got %+v", flushed)
+	}
+}
+
+func TestTableMidstreamAndIdle(t *testing.T) {
+	table, output := newTestTable(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Capture started after the handshake; the SYN-ACK still orients the flow
+	table.Inspect(segment(start, packet.TCPFlagSYN|packet.TCPFlagACK, 0, true))
+	table.Inspect(segment(start.Add(time.Second), packet.TCPFlagACK, 100, false))
+
+	// A UDP exchange on the side
+	pkt, info := segment(start, 0, 60, false)
+	pkt.Protocol, pkt.RawData, pkt.DstPort = "UDP", nil, 53
+	table.Inspect(pkt, info)
+
+	// Reset closes immediately but lingers; idle UDP expires after a minute
+	table.Inspect(segment(start.Add(2*time.Second), packet.TCPFlagRST, 0, true))
+	table.Inspect(segment(start.Add(2*time.Minute), packet.TCPFlagSYN, 0, false))
+
+	reasons := make(map[string]EndReason)
+	for len(output) > 0 {
+		rec := <-output
+		reasons[rec.Protocol] = rec.EndReason
+		if rec.Protocol == "TCP" && (rec.SrcIP != clientIP.String() || rec.State != StateClosed) {
+			t.Errorf("Expected reset flow from the client, got %s (%s)", rec.Key(), rec.State)
+		}
+	}
+	if reasons["TCP"] != EndReasonRST || reasons["UDP"] != EndReasonIdle {
+		t.Errorf("Unexpected end reasons: %v", reasons)
+	}
+}
+
+func TestTableEviction(t *testing.T) {
+	output := make(chan *Record, 10)
+	table, err := NewTable(output, &Config{MaxFlows: 2})
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for port := uint16(1); port <= 3; port++ {
+		pkt, info := segment(start.Add(time.Duration(port)*time.Millisecond), packet.TCPFlagSYN, 0, false)
+		pkt.SrcPort = port
+		table.Inspect(pkt, info)
+	}
+
+	if table.Len() != 2 {
+		t.Fatalf("Expected table bounded to 2 flows, got %d", table.Len())
+	}
+	rec := <-output
+	if rec.EndReason != EndReasonEvicted || rec.SrcPort != 1 {
+		t.Errorf("Expected the oldest flow to be evicted, got %s (%s)", rec.Key(), rec.EndReason)
+	}
+}
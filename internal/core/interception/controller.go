@@ -0,0 +1,282 @@
+// Package interception lets users change which devices a traffic interceptor
+// spoofs while it runs, and remembers their choices across restarts.
+//
+// The configured targets are the starting point. The Controller records each
+// device added or removed at runtime, and whether interception is paused, and
+// replays those changes on top of the configuration at the next start. Both
+// the hardware ARP spoofer and the desktop interceptor implement Interceptor.
+package interception
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// StateKey is the storage key of the runtime interception changes
+const StateKey = "interception:state"
+
+// ErrInvalidTarget is returned when a device cannot be added or removed
+var ErrInvalidTarget = errors.New("invalid interception target")
+
+// Interceptor is a traffic interceptor whose targets can change at runtime.
+// MACs are in the canonical lowercase colon-separated form.
+type Interceptor interface {
+	// AddTarget starts spoofing a device; ip is nil when its address is unknown
+	AddTarget(mac string, ip net.IP) error
+	// RemoveTarget stops spoofing a device and restores its ARP cache
+	RemoveTarget(mac string) error
+	// Targets returns the devices being spoofed
+	Targets() []Target
+	// Pause stops spoofing every target and restores their ARP caches
+	Pause() error
+	// Resume starts spoofing the targets again
+	Resume()
+	Paused() bool
+}
+
+// Target is a device chosen for interception and how spoofing it is going
+type Target struct {
+	MAC       string     `json:"mac"`
+	IP        string     `json:"ip,omitempty"` // Empty until discovery reports the device's address
+	Active    bool       `json:"active"`
+	Healthy   bool       `json:"healthy"` // Spoofed within the last few intervals without errors
+	LastSpoof *time.Time `json:"last_spoof,omitempty"`
+	Failures  int        `json:"consecutive_failures"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Status is the interception state returned by the API
+type Status struct {
+	Paused    bool      `json:"paused"`
+	Targets   []Target  `json:"targets"`
+	Count     int       `json:"count"`
+	UpdatedAt time.Time `json:"updated_at"` // Last runtime change, zero if none
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+// State is the persisted set of runtime changes
+type State struct {
+	Added     []string  `json:"added,omitempty"`   // Added at runtime, whether configured or not
+	Removed   []string  `json:"removed,omitempty"` // Removed at runtime
+	Paused    bool      `json:"paused"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+// DeviceLookup returns the inventory entry of a device, or nil when unknown.
+// It supplies the address of devices added by MAC.
+type DeviceLookup func(mac string) *database.Device
+
+// Controller applies and persists runtime changes to an interceptor
+type Controller struct {
+	storage     platform.StorageProvider
+	interceptor Interceptor
+	lookup      DeviceLookup
+	state       State
+	mu          sync.Mutex
+}
+
+// NewController creates a controller for interceptor and loads the changes
+// saved by a previous run. lookup may be nil.
+func NewController(storage platform.StorageProvider, interceptor Interceptor, lookup DeviceLookup) (*Controller, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("storage provider is required")
+	}
+	if interceptor == nil {
+		return nil, fmt.Errorf("interceptor is required")
+	}
+
+	c := &Controller{
+		storage:     storage,
+		interceptor: interceptor,
+		lookup:      lookup,
+	}
+
+	data, err := storage.Get(StateKey)
+	if err == nil {
+		if err := json.Unmarshal(data, &c.state); err != nil {
+			log.Printf("Warning: ignoring unreadable interception state: %v", err)
+			c.state = State{}
+		}
+	}
+
+	return c, nil
+}
+
+// Restore applies the configured targets and the saved runtime changes to the
+// interceptor. Call it once, before the interceptor starts.
+func (c *Controller) Restore(configured []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	targets := make([]string, 0, len(configured)+len(c.state.Added))
+	for _, mac := range append(slices.Clone(configured), c.state.Added...) {
+		if normalized, err := normalizeMAC(mac); err == nil && !slices.Contains(targets, normalized) {
+			targets = append(targets, normalized)
+		}
+	}
+
+	for _, mac := range targets {
+		if slices.Contains(c.state.Removed, mac) {
+			continue
+		}
+		if err := c.interceptor.AddTarget(mac, c.address(mac)); err != nil {
+			log.Printf("Warning: failed to restore interception target %s: %v", mac, err)
+		}
+	}
+	// A removed device may never have been a target of this interceptor, so
+	// failures here are expected
+	for _, mac := range c.state.Removed {
+		c.interceptor.RemoveTarget(mac)
+	}
+
+	if c.state.Paused {
+		if err := c.interceptor.Pause(); err != nil {
+			log.Printf("Warning: failed to pause interception: %v", err)
+		}
+		log.Printf("Interception has been paused since %s", c.state.UpdatedAt.Format(time.RFC3339))
+	}
+}
+
+// Status returns the current targets and whether interception is paused
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	targets := c.interceptor.Targets()
+	slices.SortFunc(targets, func(a, b Target) int { return strings.Compare(a.MAC, b.MAC) })
+
+	return Status{
+		Paused:    c.interceptor.Paused(),
+		Targets:   targets,
+		Count:     len(targets),
+		UpdatedAt: c.state.UpdatedAt,
+		UpdatedBy: c.state.UpdatedBy,
+	}
+}
+
+// AddTarget starts intercepting a device and returns its target entry
+func (c *Controller) AddTarget(mac, user string) (*Target, error) {
+	mac, err := normalizeMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.interceptor.AddTarget(mac, c.address(mac)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+
+	c.state.Removed = remove(c.state.Removed, mac)
+	if !slices.Contains(c.state.Added, mac) {
+		c.state.Added = append(c.state.Added, mac)
+	}
+	if err := c.save(user); err != nil {
+		return nil, err
+	}
+
+	target := &Target{MAC: mac}
+	for _, t := range c.interceptor.Targets() {
+		if t.MAC == mac {
+			*target = t
+			break
+		}
+	}
+	return target, nil
+}
+
+// RemoveTarget stops intercepting a device
+func (c *Controller) RemoveTarget(mac, user string) error {
+	mac, err := normalizeMAC(mac)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.interceptor.RemoveTarget(mac); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+
+	c.state.Added = remove(c.state.Added, mac)
+	if !slices.Contains(c.state.Removed, mac) {
+		c.state.Removed = append(c.state.Removed, mac)
+	}
+	return c.save(user)
+}
+
+// Pause stops intercepting every target until Resume
+func (c *Controller) Pause(user string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.interceptor.Pause(); err != nil {
+		log.Printf("Warning: interception paused but ARP caches were not fully restored: %v", err)
+	}
+	c.state.Paused = true
+	return c.save(user)
+}
+
+// Resume intercepts the targets again after Pause
+func (c *Controller) Resume(user string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interceptor.Resume()
+	c.state.Paused = false
+	return c.save(user)
+}
+
+// address returns the last known IP of a device, or nil
+func (c *Controller) address(mac string) net.IP {
+	if c.lookup == nil {
+		return nil
+	}
+	device := c.lookup(mac)
+	if device == nil {
+		return nil
+	}
+	return net.ParseIP(device.IP)
+}
+
+// save persists the state; callers hold c.mu
+func (c *Controller) save(user string) error {
+	c.state.UpdatedAt = time.Now()
+	c.state.UpdatedBy = user
+
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode interception state: %w", err)
+	}
+	if err := c.storage.Set(StateKey, data); err != nil {
+		return fmt.Errorf("failed to save interception state: %w", err)
+	}
+	return nil
+}
+
+// normalizeMAC returns mac in canonical form
+func normalizeMAC(mac string) (string, error) {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid MAC address %q", ErrInvalidTarget, mac)
+	}
+	return hwAddr.String(), nil
+}
+
+// remove returns macs without mac
+func remove(macs []string, mac string) []string {
+	return slices.DeleteFunc(macs, func(m string) bool { return m == mac })
+}
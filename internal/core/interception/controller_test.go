@@ -0,0 +1,151 @@
+package interception
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+// fakeInterceptor records targets like an interceptor without sending packets
+type fakeInterceptor struct {
+	targets map[string]string // MAC -> IP
+	paused  bool
+}
+
+func newFakeInterceptor() *fakeInterceptor {
+	return &fakeInterceptor{targets: make(map[string]string)}
+}
+
+func (f *fakeInterceptor) AddTarget(mac string, ip net.IP) error {
+	if ip == nil {
+		f.targets[mac] = ""
+	} else {
+		f.targets[mac] = ip.String()
+	}
+	return nil
+}
+
+func (f *fakeInterceptor) RemoveTarget(mac string) error {
+	if _, exists := f.targets[mac]; !exists {
+		return fmt.Errorf("target %s not found", mac)
+	}
+	delete(f.targets, mac)
+	return nil
+}
+
+func (f *fakeInterceptor) Targets() []Target {
+	targets := make([]Target, 0, len(f.targets))
+	for mac, ip := range f.targets {
+		targets = append(targets, Target{MAC: mac, IP: ip, Active: true})
+	}
+	return targets
+}
+
+func (f *fakeInterceptor) Pause() error { f.paused = true; return nil }
+func (f *fakeInterceptor) Resume()      { f.paused = false }
+func (f *fakeInterceptor) Paused() bool { return f.paused }
+
+func lookup(mac string) *database.Device {
+	if mac == "aa:00:00:00:00:02" {
+		return &database.Device{MAC: mac, IP: "192.168.1.2"}
+	}
+	return nil
+}
+
+func TestControllerPersistsChanges(t *testing.T) {
+	storage := mocks.NewMockStorageProvider()
+	if err := storage.Open("", nil); err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	configured := []string{"AA:00:00:00:00:01", "aa:00:00:00:00:03"}
+
+	first := newFakeInterceptor()
+	controller, err := NewController(storage, first, lookup)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	controller.Restore(configured)
+	if len(first.targets) != 2 {
+		t.Fatalf("Expected the configured targets, got %v", first.targets)
+	}
+
+	target, err := controller.AddTarget("aa-00-00-00-00-02", "alice")
+	if err != nil {
+		t.Fatalf("Failed to add target: %v", err)
+	}
+	if target.MAC != "aa:00:00:00:00:02" || target.IP != "192.168.1.2" {
+		t.Errorf("Expected the target with its known address, got %+v", target)
+	}
+	if err := controller.RemoveTarget("aa:00:00:00:00:03", "alice"); err != nil {
+		t.Fatalf("Failed to remove target: %v", err)
+	}
+	if err := controller.Pause("bob"); err != nil {
+		t.Fatalf("Failed to pause: %v", err)
+	}
+
+	status := controller.Status()
+	if !status.Paused || status.Count != 2 || status.UpdatedBy != "bob" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if status.Targets[0].MAC != "aa:00:00:00:00:01" || status.Targets[1].MAC != "aa:00:00:00:00:02" {
+		t.Errorf("Expected targets sorted by MAC, got %+v", status.Targets)
+	}
+
+	// The next run starts from the same configuration plus the saved changes
+	second := newFakeInterceptor()
+	restarted, err := NewController(storage, second, lookup)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+	restarted.Restore(configured)
+	if len(second.targets) != 2 || second.targets["aa:00:00:00:00:02"] != "192.168.1.2" {
+		t.Errorf("Expected the runtime changes to be restored, got %v", second.targets)
+	}
+	if _, exists := second.targets["aa:00:00:00:00:03"]; exists {
+		t.Error("Expected the removed target to stay removed")
+	}
+	if !second.paused {
+		t.Error("Expected interception to stay paused")
+	}
+
+	// Adding a removed device back clears the removal
+	if _, err := restarted.AddTarget("aa:00:00:00:00:03", "alice"); err != nil {
+		t.Fatalf("Failed to add target: %v", err)
+	}
+	if err := restarted.Resume("alice"); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	third := newFakeInterceptor()
+	again, _ := NewController(storage, third, lookup)
+	again.Restore(configured)
+	if len(third.targets) != 3 || third.paused {
+		t.Errorf("Expected 3 unpaused targets, got %v (paused %v)", third.targets, third.paused)
+	}
+}
+
+func TestControllerRejectsInvalidTargets(t *testing.T) {
+	storage := mocks.NewMockStorageProvider()
+	storage.Open("", nil)
+	controller, err := NewController(storage, newFakeInterceptor(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+
+	if _, err := controller.AddTarget("not-a-mac", ""); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("Expected ErrInvalidTarget for a bad MAC, got %v", err)
+	}
+	if err := controller.RemoveTarget("aa:00:00:00:00:09", ""); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("Expected ErrInvalidTarget when the interceptor rejects a removal, got %v", err)
+	}
+	if target, err := controller.AddTarget("aa:00:00:00:00:09", ""); err != nil || target.IP != "" {
+		t.Errorf("Expected a target without an address, got %+v, %v", target, err)
+	}
+
+	if _, err := NewController(storage, nil, nil); err == nil {
+		t.Error("Expected an error without an interceptor")
+	}
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/alerting"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
+)
+
+// FuncChannel adapts a function to the Channel interface, e.g. to show
+// notifications in the system tray
+type FuncChannel struct {
+	name string
+	send func(n *Notification) error
+}
+
+// NewFuncChannel creates a channel that calls send for every notification
+func NewFuncChannel(name string, send func(n *Notification) error) *FuncChannel {
+	return &FuncChannel{name: name, send: send}
+}
+
+// Name returns the channel name
+func (c *FuncChannel) Name() string {
+	return c.name
+}
+
+// Send calls the channel function
+func (c *FuncChannel) Send(n *Notification) error {
+	return c.send(n)
+}
+
+// WebhookChannel posts notifications as JSON to an HTTPS endpoint, signed
+// like the cloud webhook transport
+type WebhookChannel struct {
+	publisher *cloud.WebhookPublisher
+}
+
+// NewWebhookChannel creates a webhook channel
+func NewWebhookChannel(cfg *cloud.WebhookConfig) (*WebhookChannel, error) {
+	publisher, err := cloud.NewWebhookPublisher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookChannel{publisher: publisher}, nil
+}
+
+// Name returns the channel name
+func (c *WebhookChannel) Name() string {
+	return "webhook"
+}
+
+// Send posts the notification and waits for the endpoint to accept it
+func (c *WebhookChannel) Send(n *Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	return c.publisher.Publish(data)
+}
+
+// Close stops the publisher
+func (c *WebhookChannel) Close() error {
+	c.publisher.Stop()
+	return nil
+}
+
+// SyslogChannel hands events to the syslog alert forwarder. Digests are
+// unpacked, since a SIEM wants every event as its own record.
+type SyslogChannel struct {
+	forwarder *alerting.Forwarder
+}
+
+// NewSyslogChannel creates a syslog channel. The forwarder is started and
+// stopped by its owner.
+func NewSyslogChannel(forwarder *alerting.Forwarder) *SyslogChannel {
+	return &SyslogChannel{forwarder: forwarder}
+}
+
+// Name returns the channel name
+func (c *SyslogChannel) Name() string {
+	return "syslog"
+}
+
+// Send queues each event of the notification
+func (c *SyslogChannel) Send(n *Notification) error {
+	for _, event := range n.Events {
+		c.forwarder.Forward(event)
+	}
+	return nil
+}
@@ -0,0 +1,453 @@
+// Package notify routes detected anomalies to notification channels (tray,
+// email, webhook, syslog) according to user-defined rules. Each channel has
+// its own quiet hours, rate limit and digest interval, so a burst of anomalies
+// ends up as one summary instead of a popup per anomaly.
+package notify
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/alerting"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+)
+
+// Channel delivers notifications. Send may block; the engine calls it from
+// a per-channel goroutine.
+type Channel interface {
+	Name() string
+	Send(n *Notification) error
+}
+
+// Notification is a single event or a digest of held events
+type Notification struct {
+	Title    string             `json:"title"`
+	Message  string             `json:"message"`
+	Severity detection.Severity `json:"severity"` // Highest severity among the events
+	Digest   bool               `json:"digest"`
+	Events   []*alerting.Event  `json:"events"`
+	Omitted  int                `json:"omitted,omitempty"` // Events left out of a full digest
+}
+
+// Rule routes matching events to channels. Empty match fields match any
+// event; a rule without channels mutes the events it matches.
+type Rule struct {
+	Name        string
+	MinSeverity detection.Severity // Lowest severity matched
+	Types       []string           // Anomaly types
+	Devices     []string           // Device MAC addresses
+	DeviceTypes []string           // Device categories, e.g. "Camera"
+	Channels    []string           // Channel names
+	Digest      bool               // Hold matches for the next digest instead of notifying now
+}
+
+// QuietHours is a daily local-time window in which only severe events are
+// delivered immediately. End before Start wraps past midnight.
+type QuietHours struct {
+	Start  time.Duration      // Offset from midnight
+	End    time.Duration      // Offset from midnight
+	Bypass detection.Severity // Events at or above this severity still notify (default: critical)
+}
+
+// Contains reports whether t falls within the quiet hours
+func (q *QuietHours) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if q.Start <= q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
+
+// ParseClock parses a "15:04" time of day into an offset from midnight
+func ParseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Policy controls when a channel delivers
+type Policy struct {
+	QuietHours     *QuietHours
+	MaxPerHour     int           // Immediate notifications per rolling hour; 0 is unlimited
+	DigestInterval time.Duration // How often held events are summarized (default 1h)
+}
+
+// Config contains configuration for the notification engine
+type Config struct {
+	Rules        []Rule        // Evaluated in order; the first match wins
+	TickInterval time.Duration // How often digests are checked
+	QueueSize    int           // Notifications buffered per channel
+	MaxDigest    int           // Events kept per digest; further events are only counted
+}
+
+// DefaultConfig returns an engine configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		TickInterval: time.Minute,
+		QueueSize:    100,
+		MaxDigest:    200,
+	}
+}
+
+// channelState is a channel with its policy and delivery bookkeeping
+type channelState struct {
+	channel Channel
+	policy  Policy
+	outbox  chan *Notification
+
+	sent       []time.Time // Immediate deliveries within the last hour
+	pending    []*alerting.Event
+	omitted    int
+	lastDigest time.Time
+	wasQuiet   bool
+}
+
+// Engine matches events against rules and delivers them through channels
+type Engine struct {
+	cfg      *Config
+	channels map[string]*channelState
+	now      func() time.Time
+
+	mu      sync.Mutex
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	running bool
+}
+
+// NewEngine creates a notification engine; add channels before Start
+func NewEngine(cfg *Config) *Engine {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	defaults := DefaultConfig()
+	if cfg.TickInterval <= 0 {
+		cfg.TickInterval = defaults.TickInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+	if cfg.MaxDigest <= 0 {
+		cfg.MaxDigest = defaults.MaxDigest
+	}
+
+	return &Engine{
+		cfg:      cfg,
+		channels: make(map[string]*channelState),
+		now:      time.Now,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// AddChannel registers a channel under its name with a delivery policy
+func (e *Engine) AddChannel(channel Channel, policy Policy) {
+	if policy.DigestInterval <= 0 {
+		policy.DigestInterval = time.Hour
+	}
+	if policy.QuietHours != nil && policy.QuietHours.Bypass == "" {
+		policy.QuietHours.Bypass = detection.SeverityCritical
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.channels[channel.Name()] = &channelState{
+		channel:    channel,
+		policy:     policy,
+		outbox:     make(chan *Notification, e.cfg.QueueSize),
+		lastDigest: e.now(),
+	}
+}
+
+// Validate checks that every rule names a registered channel
+func (e *Engine) Validate() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.validate()
+}
+
+func (e *Engine) validate() error {
+	for _, rule := range e.cfg.Rules {
+		for _, name := range rule.Channels {
+			if _, ok := e.channels[name]; !ok {
+				return fmt.Errorf("notification rule %q uses unknown channel %q", rule.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Start validates the rules and begins delivering
+func (e *Engine) Start() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running {
+		return nil
+	}
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	for _, state := range e.channels {
+		e.wg.Add(1)
+		go e.deliverLoop(state)
+	}
+	e.wg.Add(1)
+	go e.digestLoop()
+	e.running = true
+
+	log.Printf("[Notify] Routing notifications with %d rules to %d channels", len(e.cfg.Rules), len(e.channels))
+	return nil
+}
+
+// Stop stops delivery; held events and queued notifications are discarded
+func (e *Engine) Stop() error {
+	e.mu.Lock()
+	if !e.running {
+		e.mu.Unlock()
+		return nil
+	}
+	e.running = false
+	close(e.stopCh)
+	e.mu.Unlock()
+
+	e.wg.Wait()
+	for _, state := range e.channels {
+		if closer, ok := state.channel.(interface{ Close() error }); ok {
+			closer.Close()
+		}
+	}
+	return nil
+}
+
+// Name returns the component name
+func (e *Engine) Name() string {
+	return "Notification Engine"
+}
+
+// Notify routes an event through the first matching rule. It never blocks on
+// delivery.
+func (e *Engine) Notify(event *alerting.Event) {
+	if event == nil {
+		return
+	}
+	rule := e.match(event)
+	if rule == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.running {
+		return
+	}
+
+	now := e.now()
+	for _, name := range rule.Channels {
+		state := e.channels[name]
+		if rule.Digest || state.quiet(now, event.Severity) || !state.allow(now) {
+			state.hold(event, e.cfg.MaxDigest)
+			continue
+		}
+		e.deliver(state, single(event))
+	}
+}
+
+// match returns the first rule matching the event, or nil
+func (e *Engine) match(event *alerting.Event) *Rule {
+	for i := range e.cfg.Rules {
+		if e.cfg.Rules[i].matches(event) {
+			return &e.cfg.Rules[i]
+		}
+	}
+	return nil
+}
+
+// matches reports whether an event satisfies every condition of the rule
+func (r *Rule) matches(event *alerting.Event) bool {
+	if r.MinSeverity != "" && severityRank(event.Severity) < severityRank(r.MinSeverity) {
+		return false
+	}
+	return containsFold(r.Types, event.ID) &&
+		containsFold(r.Devices, event.DeviceMAC) &&
+		containsFold(r.DeviceTypes, event.DeviceType)
+}
+
+// containsFold reports whether value is in list, ignoring case; an empty list
+// contains everything
+func containsFold(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// quiet reports whether an event of this severity must wait for quiet hours
+// to end
+func (s *channelState) quiet(now time.Time, severity detection.Severity) bool {
+	q := s.policy.QuietHours
+	return q != nil && q.Contains(now) && severityRank(severity) < severityRank(q.Bypass)
+}
+
+// allow records an immediate delivery unless the hourly limit is reached
+func (s *channelState) allow(now time.Time) bool {
+	cutoff := now.Add(-time.Hour)
+	kept := s.sent[:0]
+	for _, t := range s.sent {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.sent = kept
+
+	if s.policy.MaxPerHour > 0 && len(s.sent) >= s.policy.MaxPerHour {
+		return false
+	}
+	s.sent = append(s.sent, now)
+	return true
+}
+
+// hold keeps an event for the channel's next digest
+func (s *channelState) hold(event *alerting.Event, max int) {
+	if len(s.pending) >= max {
+		s.omitted++
+		return
+	}
+	s.pending = append(s.pending, event)
+}
+
+// deliver queues a notification for the channel without blocking
+func (e *Engine) deliver(state *channelState, n *Notification) {
+	select {
+	case state.outbox <- n:
+	default:
+		log.Printf("[Notify] %s queue full, dropping notification %q", state.channel.Name(), n.Title)
+	}
+}
+
+// deliverLoop sends a channel's notifications one at a time
+func (e *Engine) deliverLoop(state *channelState) {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case n := <-state.outbox:
+			if err := state.channel.Send(n); err != nil {
+				log.Printf("[Notify] Failed to send %q via %s: %v", n.Title, state.channel.Name(), err)
+			}
+		case <-e.stopCh:
+			return
+		}
+	}
+}
+
+// digestLoop periodically sends digests that are due
+func (e *Engine) digestLoop() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.cfg.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.flush()
+		case <-e.stopCh:
+			return
+		}
+	}
+}
+
+// flush sends a digest on every channel whose interval has passed, and right
+// away on channels whose quiet hours just ended
+func (e *Engine) flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	for _, state := range e.channels {
+		if q := state.policy.QuietHours; q != nil && q.Contains(now) {
+			state.wasQuiet = true
+			continue
+		}
+		due := state.wasQuiet || now.Sub(state.lastDigest) >= state.policy.DigestInterval
+		if !due {
+			continue
+		}
+		state.wasQuiet = false
+		state.lastDigest = now
+		if len(state.pending) == 0 {
+			continue
+		}
+
+		e.deliver(state, digest(state.pending, state.omitted))
+		state.pending = nil
+		state.omitted = 0
+	}
+}
+
+// single builds the notification for one event
+func single(event *alerting.Event) *Notification {
+	return &Notification{
+		Title:    event.Name,
+		Message:  fmt.Sprintf("Device: %s\n%s", deviceLabel(event), event.Description),
+		Severity: event.Severity,
+		Events:   []*alerting.Event{event},
+	}
+}
+
+// digest summarizes held events, one line per event
+func digest(events []*alerting.Event, omitted int) *Notification {
+	n := &Notification{
+		Title:   fmt.Sprintf("Heimdal digest: %d alerts", len(events)+omitted),
+		Digest:  true,
+		Events:  events,
+		Omitted: omitted,
+	}
+
+	var b strings.Builder
+	for _, event := range events {
+		if severityRank(event.Severity) > severityRank(n.Severity) {
+			n.Severity = event.Severity
+		}
+		fmt.Fprintf(&b, "%s [%s] %s on %s: %s\n",
+			event.Time.Local().Format("15:04"), event.Severity, event.Name, deviceLabel(event), event.Description)
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "... and %d more\n", omitted)
+	}
+	n.Message = strings.TrimSuffix(b.String(), "\n")
+	return n
+}
+
+// deviceLabel names a device by name and MAC when the name is known
+func deviceLabel(event *alerting.Event) string {
+	if event.DeviceName != "" {
+		return fmt.Sprintf("%s (%s)", event.DeviceName, event.DeviceMAC)
+	}
+	return event.DeviceMAC
+}
+
+// severityRank orders severities; unknown ones rank 0
+func severityRank(severity detection.Severity) int {
+	switch severity {
+	case detection.SeverityLow:
+		return 1
+	case detection.SeverityMedium:
+		return 2
+	case detection.SeverityHigh:
+		return 3
+	case detection.SeverityCritical:
+		return 4
+	default:
+		return 0
+	}
+}
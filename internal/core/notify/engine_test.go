@@ -0,0 +1,343 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/alerting"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+)
+
+// recordingChannel collects the notifications it is sent
+type recordingChannel struct {
+	name string
+	sent chan *Notification
+}
+
+func newRecordingChannel(name string) *recordingChannel {
+	return &recordingChannel{name: name, sent: make(chan *Notification, 100)}
+}
+
+func (c *recordingChannel) Name() string { return c.name }
+
+func (c *recordingChannel) Send(n *Notification) error {
+	c.sent <- n
+	return nil
+}
+
+// next waits for the next notification, or returns nil if none arrives
+func (c *recordingChannel) next(t *testing.T) *Notification {
+	t.Helper()
+	select {
+	case n := <-c.sent:
+		return n
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// expectNone fails if the channel was sent anything
+func (c *recordingChannel) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case n := <-c.sent:
+		t.Errorf("Expected nothing on %s, got %q", c.name, n.Title)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func anomalyEvent(anomalyType string, severity detection.Severity, mac, deviceType string) *alerting.Event {
+	return &alerting.Event{
+		ID:          anomalyType,
+		Name:        anomalyType,
+		Category:    alerting.CategoryAnomaly,
+		Severity:    severity,
+		Time:        time.Now(),
+		Description: "test",
+		DeviceMAC:   mac,
+		DeviceType:  deviceType,
+	}
+}
+
+// startEngine starts an engine whose clock is under the test's control
+func startEngine(t *testing.T, rules []Rule, clock *time.Time, channels map[Channel]Policy) *Engine {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Rules = rules
+	cfg.TickInterval = time.Hour // Digests are flushed by the test
+	engine := NewEngine(cfg)
+	engine.now = func() time.Time { return *clock }
+	for channel, policy := range channels {
+		engine.AddChannel(channel, policy)
+	}
+	if err := engine.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { engine.Stop() })
+	return engine
+}
+
+func TestEngineRoutesByFirstMatchingRule(t *testing.T) {
+	tray, email := newRecordingChannel("tray"), newRecordingChannel("email")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	engine := startEngine(t, []Rule{
+		{Name: "mute printer", Devices: []string{"AA:AA:AA:AA:AA:AA"}},
+		{Name: "cameras", DeviceTypes: []string{"camera"}, Channels: []string{"email"}},
+		{Name: "severe", MinSeverity: detection.SeverityHigh, Channels: []string{"tray", "email"}},
+		{Name: "port scans", Types: []string{"port_scan"}, Channels: []string{"tray"}},
+	}, &now, map[Channel]Policy{tray: {}, email: {}})
+
+	engine.Notify(anomalyEvent("port_scan", detection.SeverityCritical, "aa:aa:aa:aa:aa:aa", ""))
+	tray.expectNone(t)
+
+	engine.Notify(anomalyEvent("unusual_port", detection.SeverityCritical, "bb:bb:bb:bb:bb:bb", "Camera"))
+	if n := email.next(t); n == nil || n.Events[0].DeviceMAC != "bb:bb:bb:bb:bb:bb" {
+		t.Errorf("Expected the camera rule to email, got %+v", n)
+	}
+	tray.expectNone(t)
+
+	engine.Notify(anomalyEvent("high_volume", detection.SeverityHigh, "cc:cc:cc:cc:cc:cc", ""))
+	if tray.next(t) == nil || email.next(t) == nil {
+		t.Error("Expected a high severity anomaly on tray and email")
+	}
+
+	engine.Notify(anomalyEvent("port_scan", detection.SeverityLow, "cc:cc:cc:cc:cc:cc", ""))
+	if n := tray.next(t); n == nil || n.Title != "port_scan" {
+		t.Errorf("Expected a port scan on the tray, got %+v", n)
+	}
+
+	engine.Notify(anomalyEvent("new_destination", detection.SeverityLow, "cc:cc:cc:cc:cc:cc", ""))
+	tray.expectNone(t)
+	email.expectNone(t)
+}
+
+func TestEngineQuietHoursAndDigests(t *testing.T) {
+	tray := newRecordingChannel("tray")
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.Local)
+	engine := startEngine(t, []Rule{{Name: "all", Channels: []string{"tray"}}}, &now, map[Channel]Policy{
+		tray: {QuietHours: &QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}, DigestInterval: time.Hour},
+	})
+
+	engine.Notify(anomalyEvent("new_destination", detection.SeverityMedium, "aa:aa:aa:aa:aa:aa", ""))
+	engine.Notify(anomalyEvent("unusual_port", detection.SeverityHigh, "aa:aa:aa:aa:aa:aa", ""))
+	tray.expectNone(t)
+
+	engine.Notify(anomalyEvent("threat_intel_match", detection.SeverityCritical, "aa:aa:aa:aa:aa:aa", ""))
+	if n := tray.next(t); n == nil || n.Digest || n.Title != "threat_intel_match" {
+		t.Fatalf("Expected critical anomalies to bypass quiet hours, got %+v", n)
+	}
+
+	// Still quiet two hours later, past midnight
+	now = now.Add(2 * time.Hour)
+	engine.flush()
+	tray.expectNone(t)
+
+	now = time.Date(2024, 5, 2, 7, 1, 0, 0, time.Local)
+	engine.flush()
+	n := tray.next(t)
+	if n == nil || !n.Digest || len(n.Events) != 2 || n.Severity != detection.SeverityHigh {
+		t.Fatalf("Expected a digest of the two held anomalies when quiet hours end, got %+v", n)
+	}
+	if !strings.Contains(n.Message, "unusual_port on aa:aa:aa:aa:aa:aa") {
+		t.Errorf("Expected one line per anomaly, got %q", n.Message)
+	}
+
+	engine.flush()
+	tray.expectNone(t)
+}
+
+func TestEngineRateLimitFallsBackToDigest(t *testing.T) {
+	tray := newRecordingChannel("tray")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	engine := startEngine(t, []Rule{
+		{Name: "low", MinSeverity: detection.SeverityLow, Types: []string{"new_destination"}, Channels: []string{"tray"}, Digest: true},
+		{Name: "all", Channels: []string{"tray"}},
+	}, &now, map[Channel]Policy{tray: {MaxPerHour: 2, DigestInterval: 30 * time.Minute}})
+
+	for i := 0; i < 4; i++ {
+		engine.Notify(anomalyEvent("unusual_port", detection.SeverityMedium, "aa:aa:aa:aa:aa:0"+strconv.Itoa(i), ""))
+	}
+	engine.Notify(anomalyEvent("new_destination", detection.SeverityLow, "aa:aa:aa:aa:aa:aa", ""))
+	for i := 0; i < 2; i++ {
+		if n := tray.next(t); n == nil || n.Digest {
+			t.Fatalf("Expected immediate notification %d, got %+v", i, n)
+		}
+	}
+	tray.expectNone(t)
+
+	now = now.Add(31 * time.Minute)
+	engine.flush()
+	if n := tray.next(t); n == nil || !n.Digest || len(n.Events) != 3 {
+		t.Fatalf("Expected rate-limited and digest-only anomalies in one digest, got %+v", n)
+	}
+
+	// The hour has passed, so immediate notifications resume
+	now = now.Add(30 * time.Minute)
+	engine.Notify(anomalyEvent("unusual_port", detection.SeverityMedium, "aa:aa:aa:aa:aa:aa", ""))
+	if n := tray.next(t); n == nil || n.Digest {
+		t.Errorf("Expected the rate limit to reset, got %+v", n)
+	}
+}
+
+func TestEngineRejectsUnknownChannel(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Rules = []Rule{{Name: "pager", Channels: []string{"pager"}}}
+	if err := NewEngine(cfg).Start(); err == nil {
+		t.Error("Expected a rule naming an unregistered channel to be rejected")
+	}
+}
+
+// smtpStandIn is a minimal SMTP server that records the messages it accepts
+type smtpStandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	from     string
+	to       []string
+	data     string
+	done     chan struct{}
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &smtpStandIn{listener: listener, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.Trim(cmd[len("MAIL FROM:"):], "<>")
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			s.mu.Lock()
+			s.to = append(s.to, strings.Trim(cmd[len("RCPT TO:"):], "<>"))
+			s.mu.Unlock()
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case upper == "QUIT":
+			reply("221 Bye")
+			close(s.done)
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestEmailChannelSendsThroughSMTP(t *testing.T) {
+	server := newSMTPStandIn(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	channel, err := NewEmailChannel(&EmailConfig{
+		Host: host,
+		Port: portNum,
+		From: "heimdal@example.com",
+		To:   []string{"soc@example.com", "oncall@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("NewEmailChannel failed: %v", err)
+	}
+
+	n := digest([]*alerting.Event{
+		anomalyEvent("unusual_port", detection.SeverityHigh, "aa:aa:aa:aa:aa:aa", ""),
+		anomalyEvent("port_scan", detection.SeverityMedium, "bb:bb:bb:bb:bb:bb", ""),
+	}, 3)
+	if err := channel.Send(n); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	select {
+	case <-server.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP session did not finish")
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.from != "heimdal@example.com" || len(server.to) != 2 {
+		t.Errorf("Unexpected envelope: from %q to %v", server.from, server.to)
+	}
+	for _, want := range []string{
+		"Subject: Heimdal digest: 5 alerts\r\n",
+		"To: soc@example.com, oncall@example.com\r\n",
+		"unusual_port on aa:aa:aa:aa:aa:aa: test\r\n",
+		"... and 3 more\r\n",
+	} {
+		if !strings.Contains(server.data, want) {
+			t.Errorf("Expected email to contain %q, got:\n%s", want, server.data)
+		}
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := &QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}
+	daytime := &QuietHours{Start: 9 * time.Hour, End: 17 * time.Hour}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 5, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	for _, tc := range []struct {
+		q    *QuietHours
+		t    time.Time
+		want bool
+	}{
+		{overnight, at(23, 30), true},
+		{overnight, at(3, 0), true},
+		{overnight, at(7, 0), false},
+		{overnight, at(12, 0), false},
+		{daytime, at(9, 0), true},
+		{daytime, at(17, 0), false},
+		{daytime, at(20, 0), false},
+	} {
+		if got := tc.q.Contains(tc.t); got != tc.want {
+			t.Errorf("Contains(%s) with %v-%v = %v, want %v", tc.t.Format("15:04"), tc.q.Start, tc.q.End, got, tc.want)
+		}
+	}
+}
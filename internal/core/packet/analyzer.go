@@ -9,7 +9,9 @@ package packet
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"sync"
 	"time"
@@ -28,6 +30,18 @@ type PacketInfo struct {
 	DstPort   uint16
 	Protocol  string
 	Size      uint32
+
+	// DNS is the parsed DNS message for packets to or from port 53, or nil
+	DNS *DNSInfo
+
+	// TLS is the parsed ClientHello for the packet completing one, or nil
+	TLS *TLSClientHello
+}
+
+// Inspector examines packets inline in the capture loop. Inspect runs once for
+// every packet that passes the rate limiter, so it must be fast and must not block.
+type Inspector interface {
+	Inspect(packet *platform.Packet, info *PacketInfo)
 }
 
 // Analyzer processes packets from any capture provider
@@ -35,9 +49,14 @@ type Analyzer struct {
 	provider    platform.PacketCaptureProvider
 	rateLimiter *rate.Limiter
 	outputChan  chan<- PacketInfo
+	inspectors  []Inspector
+	hellos      *helloAssembler
+	lossless    bool
 	ctx         context.Context
 	cancel      context.CancelFunc
 	wg          sync.WaitGroup
+	doneMu      sync.Mutex
+	done        chan struct{}
 }
 
 // Config contains configuration for the packet analyzer
@@ -46,6 +65,9 @@ type Config struct {
 	RateLimit int
 	// BufferSize is the size of the output channel buffer
 	BufferSize int
+	// Lossless blocks on a full output channel instead of dropping packets.
+	// Used for offline replay where the source can be slowed down.
+	Lossless bool
 }
 
 // DefaultConfig returns a configuration with sensible defaults
@@ -80,13 +102,21 @@ func NewAnalyzer(provider platform.PacketCaptureProvider, outputChan chan<- Pack
 		provider:    provider,
 		rateLimiter: limiter,
 		outputChan:  outputChan,
+		hellos:      newHelloAssembler(),
+		lossless:    cfg.Lossless,
 		ctx:         ctx,
 		cancel:      cancel,
+		done:        make(chan struct{}),
 	}
 
 	return analyzer, nil
 }
 
+// AddInspector registers an inline packet inspector. Must be called before Start.
+func (a *Analyzer) AddInspector(inspector Inspector) {
+	a.inspectors = append(a.inspectors, inspector)
+}
+
 // Start begins packet capture and analysis
 func (a *Analyzer) Start(interfaceName string, promiscuous bool, filter string) error {
 	// Open the packet capture provider
@@ -97,9 +127,15 @@ func (a *Analyzer) Start(interfaceName string, promiscuous bool, filter string)
 	log.Printf("[Packet Analyzer] Started packet capture on interface %s (promiscuous: %v, filter: %s)",
 		interfaceName, promiscuous, filter)
 
+	// Each run gets its own done channel so Stop/Start cycles never close it twice
+	done := make(chan struct{})
+	a.doneMu.Lock()
+	a.done = done
+	a.doneMu.Unlock()
+
 	// Start packet processing goroutine
 	a.wg.Add(1)
-	go a.captureLoop()
+	go a.captureLoop(done)
 
 	return nil
 }
@@ -119,14 +155,23 @@ func (a *Analyzer) Stop() error {
 	return nil
 }
 
+// Done returns a channel that is closed when the capture loop exits,
+// either because Stop was called or because the provider reported io.EOF
+func (a *Analyzer) Done() <-chan struct{} {
+	a.doneMu.Lock()
+	defer a.doneMu.Unlock()
+	return a.done
+}
+
 // GetStats returns capture statistics from the provider
 func (a *Analyzer) GetStats() (*platform.CaptureStats, error) {
 	return a.provider.GetStats()
 }
 
 // captureLoop continuously captures and processes packets
-func (a *Analyzer) captureLoop() {
+func (a *Analyzer) captureLoop(done chan struct{}) {
 	defer a.wg.Done()
+	defer close(done)
 
 	for {
 		select {
@@ -140,6 +185,11 @@ func (a *Analyzer) captureLoop() {
 				if a.ctx.Err() != nil {
 					return
 				}
+				// Offline sources signal the end of input with io.EOF
+				if errors.Is(err, io.EOF) {
+					log.Println("[Packet Analyzer] Capture source exhausted")
+					return
+				}
 				// Log error and continue
 				log.Printf("[Packet Analyzer] Error reading packet: %v", err)
 				continue
@@ -168,6 +218,18 @@ func (a *Analyzer) processPacket(packet *platform.Packet) {
 		return
 	}
 
+	for _, inspector := range a.inspectors {
+		inspector.Inspect(packet, packetInfo)
+	}
+
+	if a.lossless {
+		select {
+		case a.outputChan <- *packetInfo:
+		case <-a.ctx.Done():
+		}
+		return
+	}
+
 	// Send to output channel (non-blocking)
 	select {
 	case a.outputChan <- *packetInfo:
@@ -205,9 +267,32 @@ func (a *Analyzer) extractPacketInfo(packet *platform.Packet) *PacketInfo {
 	// Extract destination port
 	info.DstPort = packet.DstPort
 
+	// Parse DNS queries and responses for domain profiling
+	info.DNS = ParseDNS(packet)
+
+	// Fingerprint TLS clients from their ClientHello
+	if packet.Protocol == "TCP" {
+		info.TLS = a.parseClientHello(packet)
+	}
+
 	return info
 }
 
+// parseClientHello returns the ClientHello completed by a TCP packet, if any
+func (a *Analyzer) parseClientHello(packet *platform.Packet) *TLSClientHello {
+	payload := tcpPayload(packet.RawData)
+	if len(payload) == 0 || (payload[0] != tlsRecordHandshake && !a.hellos.hasPending()) {
+		return nil
+	}
+
+	flow := fmt.Sprintf("%s:%d>%s:%d", packet.SrcIP, packet.SrcPort, packet.DstIP, packet.DstPort)
+	record := a.hellos.add(flow, payload, packet.Timestamp)
+	if record == nil {
+		return nil
+	}
+	return ParseClientHello(record)
+}
+
 // ProcessPacket is a public method for testing that processes a single packet
 // This allows tests to inject packets directly without going through the capture loop
 func (a *Analyzer) ProcessPacket(packet *platform.Packet) (*PacketInfo, error) {
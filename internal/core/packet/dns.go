@@ -0,0 +1,108 @@
+package packet
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// DNSPort is the well-known DNS port; only packets to or from it are parsed
+const DNSPort = 53
+
+// DNS response codes the profiler distinguishes
+const (
+	DNSRCodeSuccess  = uint8(layers.DNSResponseCodeNoErr)
+	DNSRCodeNXDomain = uint8(layers.DNSResponseCodeNXDomain)
+)
+
+// DNSInfo is the part of a DNS message used for domain profiling
+type DNSInfo struct {
+	ID       uint16
+	Response bool
+	RCode    uint8
+	Name     string // First question name, lowercased without the trailing dot
+	QType    string // First question type (A, AAAA, ...)
+	Answers  []DNSAnswer
+}
+
+// DNSAnswer is an address or alias record from a DNS response
+type DNSAnswer struct {
+	Name  string
+	IP    string // Set for A and AAAA records
+	CNAME string // Set for CNAME records
+	TTL   uint32
+}
+
+// ParseDNS decodes the DNS message carried by a captured Ethernet frame over
+// UDP or TCP port 53. It returns nil for any other packet or a malformed message.
+func ParseDNS(pkt *platform.Packet) *DNSInfo {
+	if pkt == nil || len(pkt.RawData) == 0 || (pkt.SrcPort != DNSPort && pkt.DstPort != DNSPort) {
+		return nil
+	}
+
+	decoded := gopacket.NewPacket(pkt.RawData, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+
+	if dns, ok := decoded.Layer(layers.LayerTypeDNS).(*layers.DNS); ok {
+		return newDNSInfo(dns)
+	}
+
+	// gopacket only decodes DNS over UDP; over TCP each message carries a two-byte length prefix
+	tcp, ok := decoded.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok || len(tcp.Payload) < 2 {
+		return nil
+	}
+	length := int(binary.BigEndian.Uint16(tcp.Payload))
+	if length == 0 || len(tcp.Payload) < 2+length {
+		return nil
+	}
+	dns := &layers.DNS{}
+	if err := dns.DecodeFromBytes(tcp.Payload[2:2+length], gopacket.NilDecodeFeedback); err != nil {
+		return nil
+	}
+	return newDNSInfo(dns)
+}
+
+// newDNSInfo extracts the profiling fields from a decoded DNS layer
+func newDNSInfo(dns *layers.DNS) *DNSInfo {
+	if len(dns.Questions) == 0 {
+		return nil
+	}
+
+	info := &DNSInfo{
+		ID:       dns.ID,
+		Response: dns.QR,
+		RCode:    uint8(dns.ResponseCode),
+		Name:     NormalizeDomain(string(dns.Questions[0].Name)),
+		QType:    dns.Questions[0].Type.String(),
+	}
+	if info.Name == "" {
+		return nil
+	}
+
+	for _, answer := range dns.Answers {
+		record := DNSAnswer{Name: NormalizeDomain(string(answer.Name)), TTL: answer.TTL}
+		switch answer.Type {
+		case layers.DNSTypeA, layers.DNSTypeAAAA:
+			if answer.IP == nil {
+				continue
+			}
+			record.IP = answer.IP.String()
+		case layers.DNSTypeCNAME:
+			record.CNAME = NormalizeDomain(string(answer.CNAME))
+		default:
+			continue
+		}
+		info.Answers = append(info.Answers, record)
+	}
+
+	return info
+}
+
+// NormalizeDomain lowercases a domain name and strips the trailing root dot
+func NormalizeDomain(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
@@ -0,0 +1,81 @@
+package packet
+
+import "encoding/binary"
+
+// TCP header flags
+const (
+	TCPFlagFIN uint8 = 0x01
+	TCPFlagSYN uint8 = 0x02
+	TCPFlagRST uint8 = 0x04
+	TCPFlagPSH uint8 = 0x08
+	TCPFlagACK uint8 = 0x10
+)
+
+// tcpPayload returns the TCP payload of a raw frame, or nil for anything else
+func tcpPayload(frame []byte) []byte {
+	_, payload := tcpSegment(frame)
+	return payload
+}
+
+// TCPFlags returns the flags byte of the TCP header in a raw frame. ok is
+// false when the frame does not carry a TCP segment.
+func TCPFlags(frame []byte) (flags uint8, ok bool) {
+	header, _ := tcpSegment(frame)
+	if header == nil {
+		return 0, false
+	}
+	return header[13], true
+}
+
+// tcpSegment walks the Ethernet, optional VLAN, IPv4/IPv6 and TCP headers of
+// a raw frame and returns the TCP header and payload, or nils for anything
+// else. It avoids a full gopacket decode since it runs for every TCP packet.
+func tcpSegment(frame []byte) (header, payload []byte) {
+	if len(frame) < 14 {
+		return nil, nil
+	}
+	etherType := binary.BigEndian.Uint16(frame[12:14])
+	offset := 14
+	for etherType == 0x8100 || etherType == 0x88a8 {
+		if len(frame) < offset+4 {
+			return nil, nil
+		}
+		etherType = binary.BigEndian.Uint16(frame[offset+2 : offset+4])
+		offset += 4
+	}
+
+	switch etherType {
+	case 0x0800: // IPv4
+		if len(frame) < offset+20 || frame[offset+9] != 6 {
+			return nil, nil
+		}
+		headerLen := int(frame[offset]&0x0f) * 4
+		totalLen := int(binary.BigEndian.Uint16(frame[offset+2 : offset+4]))
+		if headerLen < 20 || totalLen < headerLen || len(frame) < offset+headerLen {
+			return nil, nil
+		}
+		if end := offset + totalLen; end < len(frame) {
+			frame = frame[:end] // Drop Ethernet padding
+		}
+		offset += headerLen
+	case 0x86dd: // IPv6 without extension headers
+		if len(frame) < offset+40 || frame[offset+6] != 6 {
+			return nil, nil
+		}
+		if end := offset + 40 + int(binary.BigEndian.Uint16(frame[offset+4:offset+6])); end < len(frame) {
+			frame = frame[:end]
+		}
+		offset += 40
+	default:
+		return nil, nil
+	}
+
+	if len(frame) < offset+20 {
+		return nil, nil
+	}
+	dataOffset := int(frame[offset+12]>>4) * 4
+	if dataOffset < 20 || len(frame) < offset+dataOffset {
+		return nil, nil
+	}
+	return frame[offset : offset+dataOffset], frame[offset+dataOffset:]
+}
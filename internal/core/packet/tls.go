@@ -0,0 +1,365 @@
+package packet
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLS record and handshake constants used to recognise a ClientHello
+const (
+	tlsRecordHandshake   = 0x16
+	tlsHandshakeClientHi = 0x01
+	tlsRecordHeaderLen   = 5
+	tlsMaxHelloLen       = 16384
+)
+
+// TLS extension types read from a ClientHello
+const (
+	tlsExtServerName          = 0x0000
+	tlsExtSupportedGroups     = 0x000a
+	tlsExtECPointFormats      = 0x000b
+	tlsExtSignatureAlgorithms = 0x000d
+	tlsExtALPN                = 0x0010
+	tlsExtSupportedVersions   = 0x002b
+)
+
+// TLSClientHello is the part of a TLS ClientHello used to fingerprint the client
+type TLSClientHello struct {
+	SNI     string   // Server name, lowercased
+	ALPN    []string // Offered application protocols, in order
+	Version uint16   // Highest offered version (from supported_versions when present)
+	JA3     string   // Full JA3 string
+	JA3Hash string   // MD5 of the JA3 string
+	JA4     string   // JA4 fingerprint (TLS over TCP)
+}
+
+// isGREASE reports the reserved values clients advertise to keep servers
+// tolerant of unknown values (RFC 8701); fingerprints ignore them
+func isGREASE(value uint16) bool {
+	return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+// ParseClientHello parses a TLS record carrying a complete ClientHello. It
+// returns nil if data is not a ClientHello or is truncated.
+func ParseClientHello(data []byte) *TLSClientHello {
+	if len(data) < tlsRecordHeaderLen || data[0] != tlsRecordHandshake {
+		return nil
+	}
+	recordLen := int(binary.BigEndian.Uint16(data[3:5]))
+	if len(data) < tlsRecordHeaderLen+recordLen {
+		return nil
+	}
+
+	r := helloReader{data: data[tlsRecordHeaderLen : tlsRecordHeaderLen+recordLen]}
+	if msgType := r.uint8(); msgType != tlsHandshakeClientHi {
+		return nil
+	}
+	r.skip(3) // Handshake length
+	legacyVersion := r.uint16()
+	r.skip(32) // Random
+	r.skip(int(r.uint8()))
+
+	var ciphers []uint16
+	cipherData := r.bytes(int(r.uint16()))
+	for i := 0; i+1 < len(cipherData); i += 2 {
+		if cipher := binary.BigEndian.Uint16(cipherData[i:]); !isGREASE(cipher) {
+			ciphers = append(ciphers, cipher)
+		}
+	}
+	r.skip(int(r.uint8())) // Compression methods
+	if r.err {
+		return nil
+	}
+
+	hello := &TLSClientHello{Version: legacyVersion}
+	var extensions, groups, sigAlgs []uint16
+	var pointFormats []uint8
+
+	if r.remaining() >= 2 {
+		ext := helloReader{data: r.bytes(int(r.uint16()))}
+		for ext.remaining() >= 4 && !ext.err {
+			extType := ext.uint16()
+			body := helloReader{data: ext.bytes(int(ext.uint16()))}
+			if isGREASE(extType) {
+				continue
+			}
+			extensions = append(extensions, extType)
+
+			switch extType {
+			case tlsExtServerName:
+				body.skip(2) // List length
+				if body.uint8() == 0 {
+					hello.SNI = strings.ToLower(string(body.bytes(int(body.uint16()))))
+				}
+			case tlsExtSupportedGroups:
+				list := body.bytes(int(body.uint16()))
+				for i := 0; i+1 < len(list); i += 2 {
+					if group := binary.BigEndian.Uint16(list[i:]); !isGREASE(group) {
+						groups = append(groups, group)
+					}
+				}
+			case tlsExtECPointFormats:
+				pointFormats = append(pointFormats, body.bytes(int(body.uint8()))...)
+			case tlsExtSignatureAlgorithms:
+				list := body.bytes(int(body.uint16()))
+				for i := 0; i+1 < len(list); i += 2 {
+					if alg := binary.BigEndian.Uint16(list[i:]); !isGREASE(alg) {
+						sigAlgs = append(sigAlgs, alg)
+					}
+				}
+			case tlsExtALPN:
+				list := helloReader{data: body.bytes(int(body.uint16()))}
+				for list.remaining() > 0 && !list.err {
+					if proto := list.bytes(int(list.uint8())); len(proto) > 0 {
+						hello.ALPN = append(hello.ALPN, string(proto))
+					}
+				}
+			case tlsExtSupportedVersions:
+				list := body.bytes(int(body.uint8()))
+				for i := 0; i+1 < len(list); i += 2 {
+					if version := binary.BigEndian.Uint16(list[i:]); !isGREASE(version) && version > hello.Version {
+						hello.Version = version
+					}
+				}
+			}
+		}
+		if ext.err {
+			return nil
+		}
+	}
+
+	hello.JA3 = strings.Join([]string{
+		strconv.Itoa(int(legacyVersion)),
+		joinDecimal(ciphers),
+		joinDecimal(extensions),
+		joinDecimal(groups),
+		joinDecimal8(pointFormats),
+	}, ",")
+	sum := md5.Sum([]byte(hello.JA3))
+	hello.JA3Hash = hex.EncodeToString(sum[:])
+	hello.JA4 = ja4(hello, ciphers, extensions, sigAlgs)
+
+	return hello
+}
+
+// ja4 computes the JA4 fingerprint: a readable prefix describing the hello,
+// then truncated hashes of the sorted cipher suites and of the sorted
+// extensions followed by the signature algorithms
+func ja4(hello *TLSClientHello, ciphers, extensions, sigAlgs []uint16) string {
+	sni := "i"
+	if hello.SNI != "" {
+		sni = "d"
+	}
+
+	alpn := "00"
+	if len(hello.ALPN) > 0 && hello.ALPN[0] != "" {
+		first, last := hello.ALPN[0][0], hello.ALPN[0][len(hello.ALPN[0])-1]
+		if isAlphanumeric(first) && isAlphanumeric(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			encoded := hex.EncodeToString([]byte{first, last})
+			alpn = encoded[:1] + encoded[len(encoded)-1:]
+		}
+	}
+
+	prefix := fmt.Sprintf("t%s%s%02d%02d%s", ja4Version(hello.Version), sni,
+		min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	cipherHash := "000000000000"
+	if len(ciphers) > 0 {
+		cipherHash = truncatedSHA256(sortedHex(ciphers, nil))
+	}
+
+	extensionHash := "000000000000"
+	if len(extensions) > 0 {
+		input := sortedHex(extensions, map[uint16]bool{tlsExtServerName: true, tlsExtALPN: true})
+		if len(sigAlgs) > 0 {
+			algs := make([]string, len(sigAlgs))
+			for i, alg := range sigAlgs {
+				algs[i] = fmt.Sprintf("%04x", alg)
+			}
+			input += "_" + strings.Join(algs, ",")
+		}
+		extensionHash = truncatedSHA256(input)
+	}
+
+	return prefix + "_" + cipherHash + "_" + extensionHash
+}
+
+// ja4Version maps a TLS protocol version to its two-character JA4 code
+func ja4Version(version uint16) string {
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	default:
+		return "00"
+	}
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// sortedHex renders values as sorted four-digit hex, comma separated, leaving out skip
+func sortedHex(values []uint16, skip map[uint16]bool) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		if !skip[value] {
+			parts = append(parts, fmt.Sprintf("%04x", value))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func truncatedSHA256(input string) string {
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func joinDecimal(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(int(value))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinDecimal8(values []uint8) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(int(value))
+	}
+	return strings.Join(parts, "-")
+}
+
+// helloReader reads big-endian fields from a ClientHello, recording rather
+// than panicking on truncated input
+type helloReader struct {
+	data []byte
+	err  bool
+}
+
+func (r *helloReader) remaining() int {
+	return len(r.data)
+}
+
+func (r *helloReader) bytes(n int) []byte {
+	if n > len(r.data) {
+		r.err = true
+		r.data = nil
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *helloReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *helloReader) uint8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *helloReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// Pending ClientHellos larger than one TCP segment are reassembled per flow
+const (
+	maxPendingHellos = 256
+	pendingHelloTTL  = 5 * time.Second
+)
+
+// pendingHello is the start of a ClientHello waiting for its remaining segments
+type pendingHello struct {
+	data    []byte
+	need    int
+	started time.Time
+}
+
+// helloAssembler joins ClientHellos split across TCP segments, which is
+// common once post-quantum key shares are offered
+type helloAssembler struct {
+	pending map[string]*pendingHello
+	mu      sync.Mutex
+}
+
+func newHelloAssembler() *helloAssembler {
+	return &helloAssembler{pending: make(map[string]*pendingHello)}
+}
+
+// hasPending reports whether any ClientHello is waiting for more segments
+func (a *helloAssembler) hasPending() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending) > 0
+}
+
+// add consumes a TCP payload for a flow and returns a complete ClientHello
+// record once one is available, or nil
+func (a *helloAssembler) add(flow string, payload []byte, at time.Time) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if pending, ok := a.pending[flow]; ok {
+		if at.Sub(pending.started) > pendingHelloTTL {
+			delete(a.pending, flow)
+		} else {
+			pending.data = append(pending.data, payload...)
+			if len(pending.data) < pending.need {
+				return nil
+			}
+			delete(a.pending, flow)
+			return pending.data
+		}
+	}
+
+	if len(payload) < tlsRecordHeaderLen+1 || payload[0] != tlsRecordHandshake || payload[5] != tlsHandshakeClientHi {
+		return nil
+	}
+	need := tlsRecordHeaderLen + int(binary.BigEndian.Uint16(payload[3:5]))
+	if len(payload) >= need {
+		return payload
+	}
+	if need > tlsMaxHelloLen+tlsRecordHeaderLen {
+		return nil
+	}
+
+	if len(a.pending) >= maxPendingHellos {
+		for key, pending := range a.pending {
+			if at.Sub(pending.started) > pendingHelloTTL {
+				delete(a.pending, key)
+			}
+		}
+		if len(a.pending) >= maxPendingHellos {
+			return nil
+		}
+	}
+	a.pending[flow] = &pendingHello{data: append([]byte(nil), payload...), need: need, started: at}
+	return nil
+}
@@ -0,0 +1,137 @@
+package packet
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildClientHello assembles a ClientHello record offering the given cipher
+// suites and extensions (type followed by raw body)
+func buildClientHello(ciphers []uint16, extensions [][2][]byte) []byte {
+	u16 := func(v int) []byte { return binary.BigEndian.AppendUint16(nil, uint16(v)) }
+
+	body := append(u16(0x0303), make([]byte, 32)...) // Version, random
+	body = append(body, 0)                           // Session ID
+	body = append(body, u16(len(ciphers)*2)...)
+	for _, cipher := range ciphers {
+		body = append(body, u16(int(cipher))...)
+	}
+	body = append(body, 1, 0) // Null compression
+
+	var ext []byte
+	for _, e := range extensions {
+		ext = append(ext, e[0]...)
+		ext = append(ext, u16(len(e[1]))...)
+		ext = append(ext, e[1]...)
+	}
+	body = append(body, u16(len(ext))...)
+	body = append(body, ext...)
+
+	handshake := append([]byte{tlsHandshakeClientHi, 0}, u16(len(body))...)
+	handshake = append(handshake, body...)
+	record := append([]byte{tlsRecordHandshake, 0x03, 0x01}, u16(len(handshake))...)
+	return append(record, handshake...)
+}
+
+func testExtensions(grease bool) [][2][]byte {
+	u16 := func(v int) []byte { return binary.BigEndian.AppendUint16(nil, uint16(v)) }
+
+	name := "Example.COM"
+	sni := append(u16(len(name)+3), 0)
+	sni = append(append(sni, u16(len(name))...), name...)
+	alpn := append(u16(3), 2, 'h', '2')
+	groups := append(u16(4), 0x00, 0x1d, 0x00, 0x17)
+	versions := []byte{4, 0x03, 0x04, 0x03, 0x03}
+	sigAlgs := append(u16(4), 0x04, 0x03, 0x08, 0x04)
+
+	extensions := [][2][]byte{
+		{u16(tlsExtServerName), sni},
+		{u16(tlsExtSupportedGroups), groups},
+		{u16(tlsExtECPointFormats), []byte{1, 0}},
+		{u16(tlsExtSignatureAlgorithms), sigAlgs},
+		{u16(tlsExtALPN), alpn},
+		{u16(tlsExtSupportedVersions), versions},
+	}
+	if grease {
+		greaseGroups := append(u16(6), 0x3a, 0x3a, 0x00, 0x1d, 0x00, 0x17)
+		extensions[1][1] = greaseGroups
+		extensions = append([][2][]byte{{u16(0x0a0a), nil}}, extensions...)
+	}
+	return extensions
+}
+
+func TestParseClientHello(t *testing.T) {
+	hello := ParseClientHello(buildClientHello([]uint16{0x1301, 0x1302, 0xc02b}, testExtensions(false)))
+	if hello == nil {
+		t.Fatal("Expected ClientHello to parse")
+	}
+
+	if hello.SNI != "example.com" {
+		t.Errorf("Expected SNI example.com, got %q", hello.SNI)
+	}
+	if len(hello.ALPN) != 1 || hello.ALPN[0] != "h2" {
+		t.Errorf("Expected ALPN [h2], got %v", hello.ALPN)
+	}
+	if hello.Version != 0x0304 {
+		t.Errorf("Expected TLS 1.3 from supported_versions, got %#x", hello.Version)
+	}
+
+	wantJA3 := "771,4865-4866-49195,0-10-11-13-16-43,29-23,0"
+	if hello.JA3 != wantJA3 {
+		t.Errorf("JA3 = %s, want %s", hello.JA3, wantJA3)
+	}
+	if len(hello.JA3Hash) != 32 {
+		t.Errorf("Expected MD5 JA3 hash, got %q", hello.JA3Hash)
+	}
+	if !strings.HasPrefix(hello.JA4, "t13d0306h2_") || len(hello.JA4) != len("t13d0306h2_")+25 {
+		t.Errorf("Unexpected JA4 %s", hello.JA4)
+	}
+
+	// GREASE values must not change either fingerprint
+	greased := ParseClientHello(buildClientHello([]uint16{0x2a2a, 0x1301, 0x1302, 0xc02b}, testExtensions(true)))
+	if greased == nil || greased.JA3 != hello.JA3 || greased.JA4 != hello.JA4 {
+		t.Errorf("Expected GREASE to be ignored, got %+v", greased)
+	}
+
+	// Anything but a complete ClientHello is rejected
+	record := buildClientHello([]uint16{0x1301}, testExtensions(false))
+	if ParseClientHello(record[:len(record)-1]) != nil {
+		t.Error("Expected truncated record to be rejected")
+	}
+	record[5] = 0x02 // ServerHello
+	if ParseClientHello(record) != nil {
+		t.Error("Expected ServerHello to be rejected")
+	}
+}
+
+func TestHelloAssembler(t *testing.T) {
+	record := buildClientHello([]uint16{0x1301, 0x1302, 0xc02b}, testExtensions(false))
+	assembler := newHelloAssembler()
+	now := time.Now()
+
+	if got := assembler.add("a", record, now); len(got) != len(record) {
+		t.Fatalf("Expected a complete hello in one segment to be returned")
+	}
+
+	if got := assembler.add("a", record[:40], now); got != nil || !assembler.hasPending() {
+		t.Fatal("Expected first segment to be held")
+	}
+	if got := assembler.add("b", []byte("GET / HTTP/1.1"), now); got != nil {
+		t.Error("Expected unrelated flow to be ignored")
+	}
+	got := assembler.add("a", record[40:], now.Add(time.Second))
+	if hello := ParseClientHello(got); hello == nil || hello.SNI != "example.com" {
+		t.Fatalf("Expected reassembled hello to parse, got %v", hello)
+	}
+	if assembler.hasPending() {
+		t.Error("Expected no pending hellos after reassembly")
+	}
+
+	// Segments arriving after the TTL start over
+	assembler.add("a", record[:40], now)
+	if got := assembler.add("a", record[40:], now.Add(2*pendingHelloTTL)); got != nil {
+		t.Error("Expected stale partial hello to be discarded")
+	}
+}
@@ -0,0 +1,172 @@
+package profiler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// MaxDomainsPerProfile bounds the domains kept per device; the least recently
+// seen domain is dropped when a new one would exceed it
+const MaxDomainsPerProfile = 1024
+
+// DefaultDomainCacheSize is the default number of IP→domain mappings retained
+const DefaultDomainCacheSize = 8192
+
+// Cached mappings outlive short CDN TTLs, since connections commonly continue
+// long after the record expired, but are not kept beyond a day
+const (
+	minDomainCacheTTL = 10 * time.Minute
+	maxDomainCacheTTL = 24 * time.Hour
+)
+
+// domainEntry is a cached IP→domain mapping
+type domainEntry struct {
+	name    string
+	expires time.Time
+}
+
+// DomainTracker records DNS activity into behavioral profiles and resolves
+// destination IPs to the names devices looked them up by
+type DomainTracker struct {
+	cache      map[string]domainEntry
+	maxEntries int
+	mu         sync.RWMutex
+}
+
+// NewDomainTracker creates a tracker caching up to maxEntries IP→domain mappings
+func NewDomainTracker(maxEntries int) *DomainTracker {
+	if maxEntries <= 0 {
+		maxEntries = DefaultDomainCacheSize
+	}
+	return &DomainTracker{
+		cache:      make(map[string]domainEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// RecordQuery counts a DNS query sent by the device owning profile
+func (t *DomainTracker) RecordQuery(profile *database.BehavioralProfile, dns *packet.DNSInfo, at time.Time) {
+	if profile == nil || dns == nil || dns.Response {
+		return
+	}
+
+	profile.DNSQueries++
+	domain := profileDomain(profile, dns.Name, at)
+	domain.Count++
+	domain.LastSeen = at
+}
+
+// RecordResponse caches the addresses in a DNS response under the queried
+// name and, when profile is the device the response was sent to, counts
+// NXDOMAIN answers against it. profile may be nil.
+func (t *DomainTracker) RecordResponse(profile *database.BehavioralProfile, dns *packet.DNSInfo, at time.Time) {
+	if dns == nil || !dns.Response {
+		return
+	}
+
+	if profile != nil && dns.RCode == packet.DNSRCodeNXDomain {
+		profile.NXDomainResponses++
+		domain := profileDomain(profile, dns.Name, at)
+		domain.NXDomain++
+	}
+
+	if dns.RCode != packet.DNSRCodeSuccess {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, answer := range dns.Answers {
+		if answer.IP == "" {
+			continue
+		}
+		// Addresses reached through a CNAME chain are attributed to the name the device asked for
+		ttl := time.Duration(answer.TTL) * time.Second
+		if ttl < minDomainCacheTTL {
+			ttl = minDomainCacheTTL
+		} else if ttl > maxDomainCacheTTL {
+			ttl = maxDomainCacheTTL
+		}
+		if _, exists := t.cache[answer.IP]; !exists && len(t.cache) >= t.maxEntries {
+			t.evictLocked(at)
+		}
+		t.cache[answer.IP] = domainEntry{name: dns.Name, expires: at.Add(ttl)}
+	}
+}
+
+// Lookup returns the domain ip was most recently resolved from, or "" if the
+// mapping is unknown or expired at the given time
+func (t *DomainTracker) Lookup(ip string, at time.Time) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	entry, ok := t.cache[ip]
+	if !ok || at.After(entry.expires) {
+		return ""
+	}
+	return entry.name
+}
+
+// Annotate sets the resolved domain on a destination when one is known
+func (t *DomainTracker) Annotate(dest *database.DestInfo, at time.Time) {
+	if dest == nil {
+		return
+	}
+	if name := t.Lookup(dest.IP, at); name != "" {
+		dest.Domain = name
+	}
+}
+
+// Size returns the number of cached IP→domain mappings
+func (t *DomainTracker) Size() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.cache)
+}
+
+// evictLocked drops expired mappings, then arbitrary ones until a tenth of
+// the cache is free. Caller must hold t.mu.
+func (t *DomainTracker) evictLocked(now time.Time) {
+	for ip, entry := range t.cache {
+		if now.After(entry.expires) {
+			delete(t.cache, ip)
+		}
+	}
+
+	target := t.maxEntries - t.maxEntries/10 - 1
+	for ip := range t.cache {
+		if len(t.cache) <= target {
+			break
+		}
+		delete(t.cache, ip)
+	}
+}
+
+// profileDomain returns the profile's entry for name, creating it (and
+// evicting the least recently seen domain at the limit) if needed
+func profileDomain(profile *database.BehavioralProfile, name string, at time.Time) *database.DomainInfo {
+	if profile.Domains == nil {
+		profile.Domains = make(map[string]*database.DomainInfo)
+	}
+	if domain, exists := profile.Domains[name]; exists {
+		return domain
+	}
+
+	if len(profile.Domains) >= MaxDomainsPerProfile {
+		var oldest *database.DomainInfo
+		for _, domain := range profile.Domains {
+			if oldest == nil || domain.LastSeen.Before(oldest.LastSeen) {
+				oldest = domain
+			}
+		}
+		delete(profile.Domains, oldest.Name)
+	}
+
+	domain := &database.DomainInfo{Name: name, FirstSeen: at, LastSeen: at}
+	profile.Domains[name] = domain
+	return domain
+}
@@ -0,0 +1,151 @@
+package profiler
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+var (
+	testDeviceMAC   = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	testResolverMAC = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+)
+
+// dnsFrame serializes a DNS message over UDP between the test device and its resolver
+func dnsFrame(t *testing.T, dns *layers.DNS) *platform.Packet {
+	t.Helper()
+
+	device, resolver := net.IP{192, 168, 1, 20}, net.IP{192, 168, 1, 1}
+	eth := &layers.Ethernet{SrcMAC: testDeviceMAC, DstMAC: testResolverMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: device, DstIP: resolver}
+	udp := &layers.UDP{SrcPort: 40000, DstPort: 53}
+	if dns.QR {
+		eth.SrcMAC, eth.DstMAC = testResolverMAC, testDeviceMAC
+		ip.SrcIP, ip.DstIP = resolver, device
+		udp.SrcPort, udp.DstPort = 53, 40000
+	}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, dns); err != nil {
+		t.Fatalf("Failed to serialize DNS frame: %v", err)
+	}
+
+	return &platform.Packet{
+		SrcMAC:  eth.SrcMAC,
+		DstMAC:  eth.DstMAC,
+		SrcIP:   ip.SrcIP,
+		DstIP:   ip.DstIP,
+		SrcPort: uint16(udp.SrcPort),
+		DstPort: uint16(udp.DstPort),
+		RawData: buf.Bytes(),
+	}
+}
+
+func dnsQuestion(name string) []layers.DNSQuestion {
+	return []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}}
+}
+
+func TestParseDNSAndDomainProfile(t *testing.T) {
+	storage := mocks.NewMockStorageProvider()
+	if err := storage.Open("", nil); err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	p, err := NewProfiler(storage, make(chan packet.PacketInfo), nil)
+	if err != nil {
+		t.Fatalf("Failed to create profiler: %v", err)
+	}
+
+	analyzer, err := packet.NewAnalyzer(mocks.NewMockPacketCaptureProvider(nil), make(chan packet.PacketInfo), nil)
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	process := func(pkt *platform.Packet, at time.Time) *packet.PacketInfo {
+		pkt.Timestamp = at
+		info, err := analyzer.ProcessPacket(pkt)
+		if err != nil {
+			t.Fatalf("Failed to process packet: %v", err)
+		}
+		p.updateProfile(*info)
+		return info
+	}
+
+	query := process(dnsFrame(t, &layers.DNS{ID: 7, Questions: dnsQuestion("WWW.Example.com")}), base)
+	if query.DNS == nil || query.DNS.Response || query.DNS.Name != "www.example.com" || query.DNS.QType != "A" {
+		t.Fatalf("Unexpected parsed query: %+v", query.DNS)
+	}
+
+	// The address is reached through a CNAME and attributed to the queried name
+	response := process(dnsFrame(t, &layers.DNS{
+		ID: 7, QR: true, Questions: dnsQuestion("www.example.com"),
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("www.example.com"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 300, CNAME: []byte("edge.cdn.example")},
+			{Name: []byte("edge.cdn.example"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 20, IP: net.IP{93, 184, 216, 34}},
+		},
+	}), base.Add(time.Millisecond))
+	if response.DNS == nil || !response.DNS.Response || len(response.DNS.Answers) != 2 || response.DNS.Answers[0].CNAME != "edge.cdn.example" {
+		t.Fatalf("Unexpected parsed response: %+v", response.DNS)
+	}
+
+	process(dnsFrame(t, &layers.DNS{ID: 8, Questions: dnsQuestion("missing.example")}), base.Add(time.Second))
+	process(dnsFrame(t, &layers.DNS{
+		ID: 8, QR: true, ResponseCode: layers.DNSResponseCodeNXDomain, Questions: dnsQuestion("missing.example"),
+	}), base.Add(time.Second))
+
+	// The device connects to the resolved address well after the 20s TTL
+	p.updateProfile(packet.PacketInfo{
+		Timestamp: base.Add(5 * time.Minute),
+		SrcMAC:    testDeviceMAC.String(),
+		DstIP:     "93.184.216.34",
+		DstPort:   443,
+		Protocol:  "TCP",
+	})
+
+	profile, err := p.GetProfile(testDeviceMAC.String())
+	if err != nil {
+		t.Fatalf("Failed to get profile: %v", err)
+	}
+	if profile.DNSQueries != 2 || profile.NXDomainResponses != 1 {
+		t.Errorf("Expected 2 queries and 1 NXDOMAIN, got %d and %d", profile.DNSQueries, profile.NXDomainResponses)
+	}
+	if domain := profile.Domains["www.example.com"]; domain == nil || domain.Count != 1 || domain.NXDomain != 0 {
+		t.Errorf("Unexpected www.example.com entry: %+v", domain)
+	}
+	if domain := profile.Domains["missing.example"]; domain == nil || domain.NXDomain != 1 {
+		t.Errorf("Unexpected missing.example entry: %+v", domain)
+	}
+	if dest := profile.Destinations["93.184.216.34"]; dest == nil || dest.Domain != "www.example.com" {
+		t.Errorf("Expected destination annotated with www.example.com, got %+v", dest)
+	}
+	if name := p.domains.Lookup("93.184.216.34", base.Add(25*time.Hour)); name != "" {
+		t.Errorf("Expected mapping to expire, got %s", name)
+	}
+}
+
+func TestDomainTrackerBounds(t *testing.T) {
+	tracker := NewDomainTracker(10)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 50; i++ {
+		tracker.RecordResponse(nil, &packet.DNSInfo{
+			Response: true,
+			Name:     "host.example",
+			Answers:  []packet.DNSAnswer{{IP: net.IPv4(10, 0, 0, byte(i)).String(), TTL: 60}},
+		}, base)
+	}
+	if size := tracker.Size(); size > 10 {
+		t.Errorf("Expected cache bounded to 10 entries, got %d", size)
+	}
+	if tracker.Lookup("10.0.0.49", base) != "host.example" {
+		t.Error("Expected the newest mapping to be cached")
+	}
+}
@@ -0,0 +1,48 @@
+package profiler
+
+import (
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// ApplyFlow adds a completed flow to the connection totals of the profile of
+// a device at one of its ends, counting volume from the device's side. Flows
+// the device is not part of are ignored.
+func ApplyFlow(profile *database.BehavioralProfile, rec *flow.Record) {
+	if profile == nil || rec == nil {
+		return
+	}
+	sent, received, ok := rec.Sent(profile.MAC)
+	if !ok {
+		return
+	}
+
+	profile.Flows++
+	profile.BytesSent += sent
+	profile.BytesReceived += received
+	if rec.Duration > profile.LongestFlowSeconds {
+		profile.LongestFlowSeconds = rec.Duration
+	}
+
+	// Destinations are created by packets; flows only add their volume
+	if dest, exists := profile.Destinations[rec.Peer(profile.MAC)]; exists {
+		dest.BytesSent += sent
+		dest.BytesReceived += received
+	}
+}
+
+// RecordFlow applies a completed flow to the profiles of the devices at both
+// of its ends
+func (p *Profiler) RecordFlow(rec *flow.Record) {
+	if rec == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ApplyFlow(p.profiles[rec.SrcMAC], rec)
+	if rec.DstMAC != rec.SrcMAC {
+		ApplyFlow(p.profiles[rec.DstMAC], rec)
+	}
+}
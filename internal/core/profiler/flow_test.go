@@ -0,0 +1,55 @@
+package profiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+func TestApplyFlow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rec := &flow.Record{
+		Protocol: "TCP",
+		SrcMAC:   "aa:bb:cc:dd:ee:ff",
+		SrcIP:    "192.168.1.20",
+		DstMAC:   "00:11:22:33:44:55",
+		DstIP:    "93.184.216.34",
+		DstPort:  443,
+		Start:    now.Add(-10 * time.Minute),
+		End:      now,
+		Duration: 600,
+		SrcBytes: 40_000_000,
+		DstBytes: 12_000,
+	}
+
+	device := &database.BehavioralProfile{
+		MAC:          rec.SrcMAC,
+		Destinations: map[string]*database.DestInfo{rec.DstIP: {IP: rec.DstIP}},
+	}
+	gateway := &database.BehavioralProfile{
+		MAC:          rec.DstMAC,
+		Destinations: map[string]*database.DestInfo{rec.SrcIP: {IP: rec.SrcIP}},
+	}
+	ApplyFlow(device, rec)
+	ApplyFlow(gateway, rec)
+
+	if device.Flows != 1 || device.BytesSent != 40_000_000 || device.BytesReceived != 12_000 || device.LongestFlowSeconds != 600 {
+		t.Errorf("Unexpected device totals: flows=%d sent=%d received=%d longest=%v",
+			device.Flows, device.BytesSent, device.BytesReceived, device.LongestFlowSeconds)
+	}
+	if dest := device.Destinations[rec.DstIP]; dest.BytesSent != 40_000_000 || dest.BytesReceived != 12_000 {
+		t.Errorf("Unexpected destination volume: %+v", dest)
+	}
+	if dest := gateway.Destinations[rec.SrcIP]; gateway.BytesSent != 12_000 || dest.BytesReceived != 40_000_000 {
+		t.Errorf("Expected the reply side to be counted from the gateway, got sent=%d dest=%+v", gateway.BytesSent, dest)
+	}
+
+	// Flows between other devices leave the profile untouched
+	other := &database.BehavioralProfile{MAC: "de:ad:be:ef:00:01"}
+	ApplyFlow(other, rec)
+	if other.Flows != 0 {
+		t.Error("Expected unrelated flow to be ignored")
+	}
+}
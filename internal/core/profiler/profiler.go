@@ -21,6 +21,11 @@ import (
 // Profiler aggregates packet data into behavioral profiles
 type Profiler struct {
 	profiles        map[string]*database.BehavioralProfile
+	traffic         map[string]*database.DeviceTraffic
+	domains         *DomainTracker
+	resolutions     []Resolution
+	packetClock     bool
+	latestPacket    time.Time
 	mu              sync.RWMutex
 	packetChan      <-chan packet.PacketInfo
 	storage         platform.StorageProvider
@@ -35,12 +40,25 @@ type Profiler struct {
 type Config struct {
 	// PersistInterval is how often to persist profiles to storage
 	PersistInterval time.Duration
+
+	// Resolutions are the bucket widths of each device's traffic time series,
+	// ordered from finest to coarsest
+	Resolutions []Resolution
+
+	// PacketClock measures time windows against the newest packet timestamp
+	// instead of the wall clock (for offline replay)
+	PacketClock bool
+
+	// DomainCacheSize is the number of IP→domain mappings kept from observed
+	// DNS responses (0 = DefaultDomainCacheSize)
+	DomainCacheSize int
 }
 
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
 		PersistInterval: 60 * time.Second, // Persist every 60 seconds
+		Resolutions:     DefaultResolutions(),
 	}
 }
 
@@ -58,11 +76,22 @@ func NewProfiler(storage platform.StorageProvider, packetChan <-chan packet.Pack
 	if cfg.PersistInterval <= 0 {
 		cfg.PersistInterval = 60 * time.Second
 	}
+	resolutions := cfg.Resolutions
+	if len(resolutions) == 0 {
+		resolutions = DefaultResolutions()
+	}
+	if err := validateResolutions(resolutions); err != nil {
+		return nil, fmt.Errorf("invalid time series resolutions: %w", err)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	profiler := &Profiler{
 		profiles:        make(map[string]*database.BehavioralProfile),
+		traffic:         make(map[string]*database.DeviceTraffic),
+		domains:         NewDomainTracker(cfg.DomainCacheSize),
+		resolutions:     resolutions,
+		packetClock:     cfg.PacketClock,
 		packetChan:      packetChan,
 		storage:         storage,
 		persistInterval: cfg.PersistInterval,
@@ -110,6 +139,31 @@ func (p *Profiler) loadProfiles() error {
 		}
 	}
 
+	// Load traffic time series
+	trafficKeys, err := p.storage.List(database.TimeSeriesPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list traffic history from storage: %w", err)
+	}
+
+	for _, key := range trafficKeys {
+		data, err := p.storage.Get(key)
+		if err != nil {
+			log.Printf("[Profiler] Warning: failed to load traffic history %s: %v", key, err)
+			continue
+		}
+
+		var traffic database.DeviceTraffic
+		if err := json.Unmarshal(data, &traffic); err != nil {
+			log.Printf("[Profiler] Warning: failed to unmarshal traffic history %s: %v", key, err)
+			continue
+		}
+
+		if traffic.MAC != "" {
+			alignSeries(&traffic, p.resolutions)
+			p.traffic[traffic.MAC] = &traffic
+		}
+	}
+
 	log.Printf("[Profiler] Loaded %d existing profiles from storage", len(p.profiles))
 	return nil
 }
@@ -196,9 +250,21 @@ func (p *Profiler) updateProfile(packetInfo packet.PacketInfo) {
 	// Update LastSeen timestamp
 	profile.LastSeen = packetInfo.Timestamp
 
+	// Queries count against the sending device; responses fill the IP→domain
+	// cache and count NXDOMAIN answers against the device they are sent to
+	if dns := packetInfo.DNS; dns != nil {
+		if dns.Response {
+			p.domains.RecordResponse(p.profiles[packetInfo.DstMAC], dns, packetInfo.Timestamp)
+		} else {
+			p.domains.RecordQuery(profile, dns, packetInfo.Timestamp)
+		}
+	}
+
 	// Update Destinations map with destination IP and count
+	var destInfo *database.DestInfo
 	if packetInfo.DstIP != "" {
-		destInfo, destExists := profile.Destinations[packetInfo.DstIP]
+		var destExists bool
+		destInfo, destExists = profile.Destinations[packetInfo.DstIP]
 		if !destExists {
 			destInfo = &database.DestInfo{
 				IP:       packetInfo.DstIP,
@@ -209,6 +275,12 @@ func (p *Profiler) updateProfile(packetInfo packet.PacketInfo) {
 		}
 		destInfo.Count++
 		destInfo.LastSeen = packetInfo.Timestamp
+		p.domains.Annotate(destInfo, packetInfo.Timestamp)
+	}
+
+	// Record the TLS client fingerprint of ClientHellos
+	if packetInfo.TLS != nil {
+		RecordClientHello(profile, packetInfo.TLS, destInfo, packetInfo.Timestamp)
 	}
 
 	// Update Ports map with destination port frequency
@@ -241,6 +313,37 @@ func (p *Profiler) updateProfile(packetInfo packet.PacketInfo) {
 		}
 		profile.LocalCommunication[packetInfo.DstMAC]++
 	}
+
+	// Update the bucketed traffic time series
+	traffic, exists := p.traffic[packetInfo.SrcMAC]
+	if !exists {
+		traffic = newDeviceTraffic(packetInfo.SrcMAC, p.resolutions)
+		p.traffic[packetInfo.SrcMAC] = traffic
+	}
+	recordTraffic(traffic, packetInfo)
+
+	if packetInfo.Timestamp.After(p.latestPacket) {
+		p.latestPacket = packetInfo.Timestamp
+	}
+}
+
+// now returns the reference time for time windows
+func (p *Profiler) now() time.Time {
+	if p.packetClock && !p.latestPacket.IsZero() {
+		return p.latestPacket
+	}
+	return time.Now()
+}
+
+// snapshotLocked returns a copy of a profile with its recent activity refreshed.
+// Caller must hold p.mu.
+func (p *Profiler) snapshotLocked(profile *database.BehavioralProfile) *database.BehavioralProfile {
+	profileCopy := *profile
+	if traffic, exists := p.traffic[profile.MAC]; exists {
+		now := p.now()
+		profileCopy.LastHour = &queryWindow(traffic, now.Add(-time.Hour), now, now).TrafficSummary
+	}
+	return &profileCopy
 }
 
 // GetProfile returns a copy of the profile for a given MAC address
@@ -254,8 +357,7 @@ func (p *Profiler) GetProfile(mac string) (*database.BehavioralProfile, error) {
 	}
 
 	// Return a copy to prevent external modification
-	profileCopy := *profile
-	return &profileCopy, nil
+	return p.snapshotLocked(profile), nil
 }
 
 // GetAllProfiles returns copies of all profiles
@@ -265,13 +367,39 @@ func (p *Profiler) GetAllProfiles() []*database.BehavioralProfile {
 
 	profiles := make([]*database.BehavioralProfile, 0, len(p.profiles))
 	for _, profile := range p.profiles {
-		profileCopy := *profile
-		profiles = append(profiles, &profileCopy)
+		profiles = append(profiles, p.snapshotLocked(profile))
 	}
 
 	return profiles
 }
 
+// GetTraffic summarizes a device's traffic between start and end using the
+// finest resolution that still covers start
+func (p *Profiler) GetTraffic(mac string, start, end time.Time) (*database.TrafficWindow, error) {
+	if !end.After(start) {
+		return nil, fmt.Errorf("window end must be after start")
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	traffic, exists := p.traffic[mac]
+	if !exists {
+		return nil, fmt.Errorf("traffic history not found for MAC: %s", mac)
+	}
+
+	return queryWindow(traffic, start, end, p.now()), nil
+}
+
+// GetRecentTraffic summarizes a device's traffic over the trailing duration
+func (p *Profiler) GetRecentTraffic(mac string, duration time.Duration) (*database.TrafficWindow, error) {
+	p.mu.RLock()
+	now := p.now()
+	p.mu.RUnlock()
+
+	return p.GetTraffic(mac, now.Add(-duration), now)
+}
+
 // persistenceLoop runs the periodic profile persistence operation
 func (p *Profiler) persistenceLoop() {
 	defer p.wg.Done()
@@ -290,46 +418,50 @@ func (p *Profiler) persistenceLoop() {
 
 // persistProfiles saves all profiles to storage using batch operations
 func (p *Profiler) persistProfiles() error {
-	p.mu.RLock()
-
-	// Create a slice of profiles to persist
-	profiles := make([]*database.BehavioralProfile, 0, len(p.profiles))
-	for _, profile := range p.profiles {
-		// Create a copy to avoid holding the lock during storage operations
-		profileCopy := *profile
-		profiles = append(profiles, &profileCopy)
-	}
-
-	p.mu.RUnlock()
+	// Baselines and retention are applied to the live profiles, and everything
+	// is serialized under the lock so concurrent packet updates can't race the encoder
+	p.mu.Lock()
 
-	if len(profiles) == 0 {
-		return nil
-	}
+	now := p.now()
+	ops := make([]platform.BatchOp, 0, len(p.profiles)+len(p.traffic))
+	for mac, profile := range p.profiles {
+		traffic := p.traffic[mac]
+		if traffic != nil {
+			pruneTraffic(traffic, now)
+		}
+		p.calculateBaseline(profile, traffic, now)
 
-	// Prepare batch operations
-	ops := make([]platform.BatchOp, 0, len(profiles))
-	for _, profile := range profiles {
 		// Serialize profile to JSON
-		data, err := json.Marshal(profile)
+		data, err := json.Marshal(p.snapshotLocked(profile))
 		if err != nil {
 			log.Printf("[Profiler] Warning: failed to serialize profile %s: %v", profile.MAC, err)
 			continue
 		}
 
 		// Create batch operation
-		op := platform.BatchOp{
+		ops = append(ops, platform.BatchOp{
 			Type:  platform.BatchOpSet,
 			Key:   "profile:" + profile.MAC,
 			Value: data,
-		}
-		ops = append(ops, op)
+		})
 	}
 
-	// Calculate baselines before persisting
-	for _, profile := range profiles {
-		p.calculateBaseline(profile)
+	for mac, traffic := range p.traffic {
+		data, err := json.Marshal(traffic)
+		if err != nil {
+			log.Printf("[Profiler] Warning: failed to serialize traffic history %s: %v", mac, err)
+			continue
+		}
+
+		ops = append(ops, platform.BatchOp{
+			Type:  platform.BatchOpSet,
+			Key:   database.TimeSeriesPrefix + mac,
+			Value: data,
+		})
 	}
 
+	p.mu.Unlock()
+
 	// Execute batch operation
 	if len(ops) > 0 {
 		err := p.storage.Batch(ops)
@@ -344,12 +476,21 @@ func (p *Profiler) persistProfiles() error {
 			}
 		}
 
-		log.Printf("[Profiler] Successfully persisted %d profiles to storage", len(ops))
+		log.Printf("[Profiler] Successfully persisted %d profiles and time series to storage", len(ops))
 	}
 
 	return nil
 }
 
+// ResolveDomain returns the domain a destination IP was last resolved from, or ""
+func (p *Profiler) ResolveDomain(ip string) string {
+	p.mu.RLock()
+	now := p.now()
+	p.mu.RUnlock()
+
+	return p.domains.Lookup(ip, now)
+}
+
 // GetProfileCount returns the number of profiles currently tracked
 func (p *Profiler) GetProfileCount() int {
 	p.mu.RLock()
@@ -357,10 +498,11 @@ func (p *Profiler) GetProfileCount() int {
 	return len(p.profiles)
 }
 
-// DeleteProfile removes a profile from memory and storage
+// DeleteProfile removes a profile and its traffic history from memory and storage
 func (p *Profiler) DeleteProfile(mac string) error {
 	p.mu.Lock()
 	delete(p.profiles, mac)
+	delete(p.traffic, mac)
 	p.mu.Unlock()
 
 	// Delete from storage
@@ -368,23 +510,33 @@ func (p *Profiler) DeleteProfile(mac string) error {
 	if err := p.storage.Delete(key); err != nil {
 		return fmt.Errorf("failed to delete profile from storage: %w", err)
 	}
+	if err := p.storage.Delete(database.TimeSeriesPrefix + mac); err != nil {
+		return fmt.Errorf("failed to delete traffic history from storage: %w", err)
+	}
 
 	return nil
 }
 
-// ClearProfiles removes all profiles from memory (does not affect storage)
+// ClearProfiles removes all profiles and traffic history from memory (does not affect storage)
 func (p *Profiler) ClearProfiles() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.profiles = make(map[string]*database.BehavioralProfile)
+	p.traffic = make(map[string]*database.DeviceTraffic)
 }
 
-// calculateBaseline calculates rolling baseline metrics for a profile
-func (p *Profiler) calculateBaseline(profile *database.BehavioralProfile) {
+// calculateBaseline calculates baseline metrics for a profile. Devices with a
+// traffic time series get a baseline over the last week; profiles without one
+// (e.g. loaded from storage and not seen since) keep the lifetime estimate.
+func (p *Profiler) calculateBaseline(profile *database.BehavioralProfile, traffic *database.DeviceTraffic, now time.Time) {
 	if profile == nil {
 		return
 	}
 
+	if traffic != nil && calculateWindowedBaseline(profile, traffic, now) {
+		return
+	}
+
 	// Initialize baseline if it doesn't exist
 	if profile.Baseline == nil {
 		profile.Baseline = &database.ProfileBaseline{
@@ -394,7 +546,6 @@ func (p *Profiler) calculateBaseline(profile *database.BehavioralProfile) {
 	}
 
 	baseline := profile.Baseline
-	now := time.Now()
 
 	// Calculate time since first seen (in hours)
 	hoursSinceFirstSeen := now.Sub(profile.FirstSeen).Hours()
@@ -0,0 +1,405 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// maxBucketKeys bounds the distinct destinations and ports tracked per bucket so
+// a scanning device cannot grow its history without limit
+const maxBucketKeys = 512
+
+// baselineWindow is how much history the windowed baseline is computed from
+const baselineWindow = 7 * 24 * time.Hour
+
+// Resolution describes one bucket width tracked by the profiler and how long
+// buckets of that width are retained
+type Resolution struct {
+	Width     time.Duration
+	Retention time.Duration
+}
+
+// DefaultResolutions returns 5-minute buckets for the last day and hourly
+// buckets for the last eight days
+func DefaultResolutions() []Resolution {
+	return []Resolution{
+		{Width: 5 * time.Minute, Retention: 24 * time.Hour},
+		{Width: time.Hour, Retention: 8 * 24 * time.Hour},
+	}
+}
+
+// validateResolutions checks that resolutions are usable and ordered finest first
+func validateResolutions(resolutions []Resolution) error {
+	for i, res := range resolutions {
+		if res.Width <= 0 {
+			return fmt.Errorf("resolution %d: width must be positive", i)
+		}
+		if res.Retention < res.Width {
+			return fmt.Errorf("resolution %d: retention must be at least one bucket width", i)
+		}
+		if i > 0 && res.Width <= resolutions[i-1].Width {
+			return fmt.Errorf("resolution %d: resolutions must be ordered from finest to coarsest", i)
+		}
+	}
+	return nil
+}
+
+// newDeviceTraffic creates an empty traffic history with the given resolutions
+func newDeviceTraffic(mac string, resolutions []Resolution) *database.DeviceTraffic {
+	traffic := &database.DeviceTraffic{MAC: mac}
+	alignSeries(traffic, resolutions)
+	return traffic
+}
+
+// alignSeries makes traffic track exactly the given resolutions, keeping the
+// buckets of any resolution it already had
+func alignSeries(traffic *database.DeviceTraffic, resolutions []Resolution) {
+	existing := make(map[time.Duration]*database.TrafficSeries, len(traffic.Series))
+	for _, series := range traffic.Series {
+		// Empty maps are omitted when persisted
+		for _, bucket := range series.Buckets {
+			if bucket.Destinations == nil {
+				bucket.Destinations = make(map[string]int64)
+			}
+			if bucket.Ports == nil {
+				bucket.Ports = make(map[uint16]int64)
+			}
+			if bucket.Protocols == nil {
+				bucket.Protocols = make(map[string]int64)
+			}
+		}
+		existing[series.Width] = series
+	}
+
+	traffic.Series = make([]*database.TrafficSeries, 0, len(resolutions))
+	for _, res := range resolutions {
+		series, ok := existing[res.Width]
+		if !ok {
+			series = &database.TrafficSeries{Width: res.Width}
+		}
+		series.Retention = res.Retention
+		traffic.Series = append(traffic.Series, series)
+	}
+}
+
+// recordTraffic adds a packet to every series of a device's traffic history
+func recordTraffic(traffic *database.DeviceTraffic, info packet.PacketInfo) {
+	for _, series := range traffic.Series {
+		bucket := bucketFor(series, info.Timestamp)
+		if bucket == nil {
+			continue
+		}
+
+		bucket.Packets++
+		bucket.Bytes += int64(info.Size)
+
+		if info.DstIP != "" {
+			if _, ok := bucket.Destinations[info.DstIP]; ok || len(bucket.Destinations) < maxBucketKeys {
+				bucket.Destinations[info.DstIP]++
+			} else {
+				bucket.DroppedKeys++
+			}
+		}
+		if info.DstPort > 0 {
+			if _, ok := bucket.Ports[info.DstPort]; ok || len(bucket.Ports) < maxBucketKeys {
+				bucket.Ports[info.DstPort]++
+			} else {
+				bucket.DroppedKeys++
+			}
+		}
+		if info.Protocol != "" {
+			bucket.Protocols[info.Protocol]++
+		}
+	}
+}
+
+// bucketFor returns the bucket covering timestamp, creating it if necessary.
+// Returns nil if the timestamp is older than the series retention.
+func bucketFor(series *database.TrafficSeries, timestamp time.Time) *database.TrafficBucket {
+	start := timestamp.Truncate(series.Width)
+	n := len(series.Buckets)
+
+	// Fast path: packets almost always land in the newest bucket
+	if n > 0 && series.Buckets[n-1].Start.Equal(start) {
+		return series.Buckets[n-1]
+	}
+
+	if n > 0 && start.Before(series.Buckets[n-1].Start) {
+		// Out-of-order packet: find or insert its bucket
+		if start.Before(seriesHorizon(series).Add(-series.Retention)) {
+			return nil
+		}
+		i := sort.Search(n, func(i int) bool { return !series.Buckets[i].Start.Before(start) })
+		if i < n && series.Buckets[i].Start.Equal(start) {
+			return series.Buckets[i]
+		}
+		bucket := newBucket(start)
+		series.Buckets = append(series.Buckets, nil)
+		copy(series.Buckets[i+1:], series.Buckets[i:])
+		series.Buckets[i] = bucket
+		return bucket
+	}
+
+	bucket := newBucket(start)
+	series.Buckets = append(series.Buckets, bucket)
+	pruneSeries(series, seriesHorizon(series))
+	return bucket
+}
+
+// newBucket creates an empty bucket starting at start
+func newBucket(start time.Time) *database.TrafficBucket {
+	return &database.TrafficBucket{
+		Start:        start,
+		Destinations: make(map[string]int64),
+		Ports:        make(map[uint16]int64),
+		Protocols:    make(map[string]int64),
+	}
+}
+
+// seriesHorizon returns the end of the newest bucket in a series
+func seriesHorizon(series *database.TrafficSeries) time.Time {
+	if len(series.Buckets) == 0 {
+		return time.Time{}
+	}
+	return series.Buckets[len(series.Buckets)-1].Start.Add(series.Width)
+}
+
+// pruneSeries drops buckets that ended more than the retention before now
+func pruneSeries(series *database.TrafficSeries, now time.Time) {
+	cutoff := now.Add(-series.Retention)
+	drop := 0
+	for drop < len(series.Buckets) && !series.Buckets[drop].Start.Add(series.Width).After(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		series.Buckets = append(series.Buckets[:0:0], series.Buckets[drop:]...)
+	}
+}
+
+// pruneTraffic applies retention to every series relative to now
+func pruneTraffic(traffic *database.DeviceTraffic, now time.Time) {
+	for _, series := range traffic.Series {
+		pruneSeries(series, now)
+	}
+}
+
+// selectSeries returns the finest series whose retention still reaches start,
+// falling back to the coarsest series
+func selectSeries(traffic *database.DeviceTraffic, start, now time.Time) *database.TrafficSeries {
+	if traffic == nil || len(traffic.Series) == 0 {
+		return nil
+	}
+	for _, series := range traffic.Series {
+		if !start.Before(now.Add(-series.Retention)) {
+			return series
+		}
+	}
+	return traffic.Series[len(traffic.Series)-1]
+}
+
+// queryWindow summarizes the traffic between start and end. The window is
+// widened to the bucket boundaries of the selected resolution.
+func queryWindow(traffic *database.DeviceTraffic, start, end, now time.Time) *database.TrafficWindow {
+	window := &database.TrafficWindow{
+		MAC:       traffic.MAC,
+		Protocols: make(map[string]int64),
+		Buckets:   make([]*database.TrafficBucket, 0),
+	}
+
+	series := selectSeries(traffic, start, now)
+	if series == nil {
+		window.Start, window.End = start, end
+		return window
+	}
+
+	window.Resolution = series.Width
+	window.Start = start.Truncate(series.Width)
+	window.End = end.Truncate(series.Width)
+	if window.End.Before(end) {
+		window.End = window.End.Add(series.Width)
+	}
+
+	destinations := make(map[string]struct{})
+	ports := make(map[uint16]struct{})
+	for _, bucket := range series.Buckets {
+		if bucket.Start.Before(window.Start) || !bucket.Start.Before(window.End) {
+			continue
+		}
+
+		window.Packets += bucket.Packets
+		window.Bytes += bucket.Bytes
+		for ip := range bucket.Destinations {
+			destinations[ip] = struct{}{}
+		}
+		for port := range bucket.Ports {
+			ports[port] = struct{}{}
+		}
+		for protocol, count := range bucket.Protocols {
+			window.Protocols[protocol] += count
+		}
+		window.Buckets = append(window.Buckets, cloneBucket(bucket))
+	}
+	window.UniqueDestinations = len(destinations)
+	window.UniquePorts = len(ports)
+
+	return window
+}
+
+// cloneBucket returns a deep copy of a bucket
+func cloneBucket(bucket *database.TrafficBucket) *database.TrafficBucket {
+	clone := *bucket
+	clone.Destinations = make(map[string]int64, len(bucket.Destinations))
+	for k, v := range bucket.Destinations {
+		clone.Destinations[k] = v
+	}
+	clone.Ports = make(map[uint16]int64, len(bucket.Ports))
+	for k, v := range bucket.Ports {
+		clone.Ports[k] = v
+	}
+	clone.Protocols = make(map[string]int64, len(bucket.Protocols))
+	for k, v := range bucket.Protocols {
+		clone.Protocols[k] = v
+	}
+	return &clone
+}
+
+// calculateWindowedBaseline derives hourly and daily baselines from the last
+// week of bucketed traffic. Hours without traffic count as zero. Returns false
+// if the traffic history has no resolution of an hour or finer.
+func calculateWindowedBaseline(profile *database.BehavioralProfile, traffic *database.DeviceTraffic, now time.Time) bool {
+	end := now.Truncate(time.Hour) // Exclude the hour in progress
+	start := end.Add(-baselineWindow)
+	if firstHour := profile.FirstSeen.Truncate(time.Hour); firstHour.After(start) {
+		start = firstHour
+	}
+
+	series := selectSeries(traffic, start, now)
+	if series == nil || series.Width > time.Hour {
+		return false
+	}
+
+	hours := int(end.Sub(start) / time.Hour)
+	if hours < 1 {
+		// Not enough data yet
+		return true
+	}
+
+	packets := make([]float64, hours)
+	destinations := make([]map[string]struct{}, hours)
+	ports := make([]map[uint16]struct{}, hours)
+	protocols := make(map[string]int64)
+	var totalProtocolPackets int64
+
+	for _, bucket := range series.Buckets {
+		if bucket.Start.Before(start) || !bucket.Start.Before(end) {
+			continue
+		}
+		slot := int(bucket.Start.Sub(start) / time.Hour)
+
+		packets[slot] += float64(bucket.Packets)
+		if destinations[slot] == nil {
+			destinations[slot] = make(map[string]struct{})
+			ports[slot] = make(map[uint16]struct{})
+		}
+		for ip := range bucket.Destinations {
+			destinations[slot][ip] = struct{}{}
+		}
+		for port := range bucket.Ports {
+			ports[slot][port] = struct{}{}
+		}
+		for protocol, count := range bucket.Protocols {
+			protocols[protocol] += count
+			totalProtocolPackets += count
+		}
+	}
+
+	uniqueDests := make([]float64, hours)
+	uniquePorts := make([]float64, hours)
+	for i := range packets {
+		uniqueDests[i] = float64(len(destinations[i]))
+		uniquePorts[i] = float64(len(ports[i]))
+	}
+
+	if profile.Baseline == nil {
+		profile.Baseline = &database.ProfileBaseline{}
+	}
+	baseline := profile.Baseline
+
+	// StdDev fields hold variances; the detector takes the square root
+	baseline.AvgPacketsPerHour, baseline.StdDevPacketsPerHour = meanVariance(packets)
+	baseline.AvgUniqueDestinations, baseline.StdDevDestinations = meanVariance(uniqueDests)
+	baseline.AvgUniquePorts, baseline.StdDevPorts = meanVariance(uniquePorts)
+
+	if days := hours / 24; days >= 1 {
+		daily := make([]float64, days)
+		offset := hours - days*24 // Use the most recent complete days
+		for i := offset; i < hours; i++ {
+			daily[(i-offset)/24] += packets[i]
+		}
+		baseline.AvgPacketsPerDay, baseline.StdDevPacketsPerDay = meanVariance(daily)
+	}
+
+	baseline.ProtocolDistribution = make(map[string]float64, len(protocols))
+	for protocol, count := range protocols {
+		baseline.ProtocolDistribution[protocol] = float64(count) / float64(totalProtocolPackets)
+	}
+
+	baseline.LastCalculated = now
+	baseline.SampleCount = hours
+	return true
+}
+
+// meanVariance returns the mean and population variance of values
+func meanVariance(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, squares / float64(len(values))
+}
+
+// LoadTraffic reads a device's bucketed traffic history from storage
+func LoadTraffic(storage platform.StorageProvider, mac string) (*database.DeviceTraffic, error) {
+	data, err := storage.Get(database.TimeSeriesPrefix + mac)
+	if err != nil {
+		return nil, fmt.Errorf("traffic history not found for MAC: %s", mac)
+	}
+
+	var traffic database.DeviceTraffic
+	if err := json.Unmarshal(data, &traffic); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal traffic history: %w", err)
+	}
+
+	return &traffic, nil
+}
+
+// QueryTraffic summarizes a device's persisted traffic between start and end.
+// It is intended for readers that do not own the Profiler, such as dashboards.
+func QueryTraffic(storage platform.StorageProvider, mac string, start, end time.Time) (*database.TrafficWindow, error) {
+	if !end.After(start) {
+		return nil, fmt.Errorf("window end must be after start")
+	}
+
+	traffic, err := LoadTraffic(storage, mac)
+	if err != nil {
+		return nil, err
+	}
+
+	return queryWindow(traffic, start, end, time.Now()), nil
+}
@@ -0,0 +1,119 @@
+package profiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+func testPacketInfo(ts time.Time, dstIP string, dstPort uint16) packet.PacketInfo {
+	return packet.PacketInfo{
+		Timestamp: ts,
+		SrcMAC:    "aa:bb:cc:dd:ee:ff",
+		DstIP:     dstIP,
+		DstPort:   dstPort,
+		Protocol:  "TCP",
+		Size:      100,
+	}
+}
+
+func TestRecordTrafficBucketsAndRetention(t *testing.T) {
+	traffic := newDeviceTraffic("aa:bb:cc:dd:ee:ff", DefaultResolutions())
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// One packet every 30 minutes for two days
+	for i := 0; i < 96; i++ {
+		recordTraffic(traffic, testPacketInfo(base.Add(time.Duration(i)*30*time.Minute), "10.0.0.1", 443))
+	}
+
+	fine, coarse := traffic.Series[0], traffic.Series[1]
+
+	// 5-minute buckets are kept for 24 hours: 48 half-hour packets
+	if len(fine.Buckets) != 48 {
+		t.Errorf("Expected 48 fine buckets within retention, got %d", len(fine.Buckets))
+	}
+	if len(coarse.Buckets) != 48 {
+		t.Errorf("Expected 48 hourly buckets, got %d", len(coarse.Buckets))
+	}
+	for _, bucket := range coarse.Buckets {
+		if bucket.Packets != 2 {
+			t.Fatalf("Expected 2 packets per hourly bucket, got %d at %v", bucket.Packets, bucket.Start)
+		}
+	}
+
+	// Out-of-order packets land in their own bucket
+	late := base.Add(47*time.Hour + 10*time.Minute)
+	recordTraffic(traffic, testPacketInfo(late, "10.0.0.2", 80))
+	window := queryWindow(traffic, late, late.Add(time.Minute), late)
+	if window.Packets != 1 {
+		t.Errorf("Expected out-of-order packet in its bucket, got %d packets", window.Packets)
+	}
+}
+
+func TestQueryWindowSelectsResolution(t *testing.T) {
+	traffic := newDeviceTraffic("aa:bb:cc:dd:ee:ff", DefaultResolutions())
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 24*6; i++ {
+		ts := now.Add(-time.Duration(i) * time.Hour).Add(-time.Minute)
+		recordTraffic(traffic, testPacketInfo(ts, "10.0.0.1", uint16(1000+i%3)))
+	}
+
+	lastHour := queryWindow(traffic, now.Add(-time.Hour), now, now)
+	if lastHour.Resolution != 5*time.Minute {
+		t.Errorf("Expected 5m resolution for the last hour, got %v", lastHour.Resolution)
+	}
+	if lastHour.Packets != 1 {
+		t.Errorf("Expected 1 packet in the last hour, got %d", lastHour.Packets)
+	}
+
+	lastWeek := queryWindow(traffic, now.Add(-7*24*time.Hour), now, now)
+	if lastWeek.Resolution != time.Hour {
+		t.Errorf("Expected 1h resolution for the last week, got %v", lastWeek.Resolution)
+	}
+	if lastWeek.Packets != 24*6 {
+		t.Errorf("Expected %d packets in the last week, got %d", 24*6, lastWeek.Packets)
+	}
+	if lastWeek.UniquePorts != 3 || lastWeek.UniqueDestinations != 1 {
+		t.Errorf("Unexpected unique counts: %d ports, %d destinations", lastWeek.UniquePorts, lastWeek.UniqueDestinations)
+	}
+}
+
+func TestWindowedBaselineAgesOut(t *testing.T) {
+	traffic := newDeviceTraffic("aa:bb:cc:dd:ee:ff", DefaultResolutions())
+	now := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	profile := &database.BehavioralProfile{
+		MAC:       "aa:bb:cc:dd:ee:ff",
+		FirstSeen: now.Add(-30 * 24 * time.Hour),
+	}
+
+	// A burst three weeks ago is outside the baseline window
+	for i := 0; i < 10000; i++ {
+		recordTraffic(traffic, testPacketInfo(now.Add(-21*24*time.Hour), "10.0.0.9", 22))
+	}
+	// Steady 10 packets per hour for the last two days
+	for h := 1; h <= 48; h++ {
+		for i := 0; i < 10; i++ {
+			recordTraffic(traffic, testPacketInfo(now.Add(-time.Duration(h)*time.Hour), "10.0.0.1", 443))
+		}
+	}
+	pruneTraffic(traffic, now)
+
+	if !calculateWindowedBaseline(profile, traffic, now) {
+		t.Fatal("Expected windowed baseline to be calculated")
+	}
+
+	// 480 packets spread across a 168 hour window
+	expected := 480.0 / 168.0
+	if diff := profile.Baseline.AvgPacketsPerHour - expected; diff > 0.001 || diff < -0.001 {
+		t.Errorf("Expected %.3f packets/hour, got %.3f", expected, profile.Baseline.AvgPacketsPerHour)
+	}
+	if profile.Baseline.SampleCount != 168 {
+		t.Errorf("Expected 168 hourly samples, got %d", profile.Baseline.SampleCount)
+	}
+	if profile.Baseline.ProtocolDistribution["TCP"] != 1.0 {
+		t.Errorf("Expected TCP distribution of 1.0, got %v", profile.Baseline.ProtocolDistribution["TCP"])
+	}
+}
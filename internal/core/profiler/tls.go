@@ -0,0 +1,79 @@
+package profiler
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+)
+
+// MaxTLSClientsPerProfile bounds the TLS fingerprints kept per device
+const MaxTLSClientsPerProfile = 64
+
+// maxSNIsPerClient bounds the sample of server names kept per fingerprint
+const maxSNIsPerClient = 10
+
+// RecordClientHello adds a ClientHello sent by the device owning profile to
+// its TLS client fingerprints, and names the destination by the SNI when DNS
+// did not already resolve it. dest may be nil.
+func RecordClientHello(profile *database.BehavioralProfile, hello *packet.TLSClientHello, dest *database.DestInfo, at time.Time) {
+	if profile == nil || hello == nil || hello.JA4 == "" {
+		return
+	}
+
+	if profile.TLSClients == nil {
+		profile.TLSClients = make(map[string]*database.TLSClientInfo)
+	}
+	client, exists := profile.TLSClients[hello.JA4]
+	if !exists {
+		if len(profile.TLSClients) >= MaxTLSClientsPerProfile {
+			var oldest *database.TLSClientInfo
+			for _, candidate := range profile.TLSClients {
+				if oldest == nil || candidate.LastSeen.Before(oldest.LastSeen) {
+					oldest = candidate
+				}
+			}
+			delete(profile.TLSClients, oldest.JA4)
+		}
+		client = &database.TLSClientInfo{
+			JA4:       hello.JA4,
+			JA3:       hello.JA3,
+			JA3Hash:   hello.JA3Hash,
+			FirstSeen: at,
+		}
+		profile.TLSClients[hello.JA4] = client
+	}
+	client.Count++
+	client.LastSeen = at
+
+	if hello.SNI != "" {
+		known := false
+		for _, sni := range client.SNIs {
+			if sni == hello.SNI {
+				known = true
+				break
+			}
+		}
+		if !known && len(client.SNIs) < maxSNIsPerClient {
+			client.SNIs = append(client.SNIs, hello.SNI)
+		}
+
+		if dest != nil && dest.Domain == "" {
+			dest.Domain = hello.SNI
+		}
+	}
+}
+
+// Fingerprints returns the JA4 fingerprints seen for a profile, sorted
+func Fingerprints(profile *database.BehavioralProfile) []string {
+	if profile == nil {
+		return nil
+	}
+	fingerprints := make([]string, 0, len(profile.TLSClients))
+	for ja4 := range profile.TLSClients {
+		fingerprints = append(fingerprints, ja4)
+	}
+	sort.Strings(fingerprints)
+	return fingerprints
+}
@@ -0,0 +1,553 @@
+// Package recorder provides rolling per-device packet recording shared by the
+// hardware and desktop products.
+//
+// The Recorder tees raw frames from a PacketCaptureProvider into pcap files, one
+// ring of files per recorded device. Each ring rotates when the current file
+// reaches a size or age limit and keeps only the newest files, so a recording can
+// be left running without exhausting disk space. Recordings are started and
+// stopped on demand (typically from the REST API when an anomaly fires) and the
+// ring can be downloaded as a single pcap for analysis in Wireshark or tcpdump.
+//
+// On-disk layout:
+//
+//	<directory>/<mac>/<timestamp>.pcap
+//
+// where <mac> uses dashes instead of colons so the layout is valid on every platform.
+package recorder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// pcapFileHeaderSize is the size of the classic pcap global header
+const pcapFileHeaderSize = 24
+
+// fileTimeFormat names ring files so lexical order matches creation order
+const fileTimeFormat = "20060102T150405.000000000Z"
+
+// Config contains configuration for the packet recorder
+type Config struct {
+	// Directory is the root directory for recordings
+	Directory string
+
+	// MaxFileSize is the size in bytes after which a ring file is rotated
+	MaxFileSize int64
+
+	// MaxFileAge is the duration after which a ring file is rotated
+	MaxFileAge time.Duration
+
+	// MaxFiles is the number of ring files kept per device
+	MaxFiles int
+
+	// SnapLen is the maximum number of bytes stored per frame
+	SnapLen int
+}
+
+// DefaultConfig returns a configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Directory:   "recordings",
+		MaxFileSize: 10 * 1024 * 1024, // 10MB per file
+		MaxFileAge:  15 * time.Minute,
+		MaxFiles:    5, // Up to 50MB per device
+		SnapLen:     65535,
+	}
+}
+
+// Status describes the recording state of a device
+type Status struct {
+	MAC       string     `json:"mac"`
+	Active    bool       `json:"active"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Packets   uint64     `json:"packets"`
+	Files     int        `json:"files"`
+	SizeBytes int64      `json:"size_bytes"`
+}
+
+// session tracks an active recording for one device
+type session struct {
+	mac       string
+	dir       string
+	startedAt time.Time
+	expiresAt time.Time // Zero when the recording has no time limit
+	packets   uint64
+
+	file     *os.File
+	buffer   *bufio.Writer
+	writer   *pcapgo.Writer
+	fileSize int64
+	openedAt time.Time
+}
+
+// Recorder writes per-device rolling pcap files
+type Recorder struct {
+	config   *Config
+	sessions map[string]*session
+	mu       sync.Mutex
+}
+
+// NewRecorder creates a new packet recorder instance
+func NewRecorder(cfg *Config) (*Recorder, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.Directory == "" {
+		return nil, fmt.Errorf("recording directory is required")
+	}
+	if cfg.MaxFileSize <= 0 {
+		return nil, fmt.Errorf("max file size must be positive, got %d", cfg.MaxFileSize)
+	}
+	if cfg.MaxFiles < 1 {
+		return nil, fmt.Errorf("max files must be at least 1, got %d", cfg.MaxFiles)
+	}
+	if cfg.SnapLen <= 0 {
+		cfg.SnapLen = 65535
+	}
+
+	if err := os.MkdirAll(cfg.Directory, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	return &Recorder{
+		config:   cfg,
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+// NormalizeMAC parses a MAC address and returns its canonical lowercase form
+func NormalizeMAC(mac string) (string, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return "", fmt.Errorf("invalid MAC address %q: %w", mac, err)
+	}
+	return hw.String(), nil
+}
+
+// Start begins recording traffic to and from a device.
+// A zero duration records until Stop is called.
+func (r *Recorder) Start(mac string, duration time.Duration) (*Status, error) {
+	mac, err := NormalizeMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+	if duration < 0 {
+		return nil, fmt.Errorf("duration must be non-negative")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if s := r.activeSessionLocked(mac, now); s != nil {
+		// Extend or clear the time limit of a running recording
+		s.expiresAt = time.Time{}
+		if duration > 0 {
+			s.expiresAt = now.Add(duration)
+		}
+		return r.statusLocked(mac), nil
+	}
+
+	dir := r.deviceDir(mac)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create device recording directory: %w", err)
+	}
+
+	s := &session{
+		mac:       mac,
+		dir:       dir,
+		startedAt: now,
+	}
+	if duration > 0 {
+		s.expiresAt = now.Add(duration)
+	}
+
+	if err := r.rotateLocked(s, now); err != nil {
+		return nil, err
+	}
+
+	r.sessions[mac] = s
+	log.Printf("[Recorder] Started recording for %s", mac)
+	return r.statusLocked(mac), nil
+}
+
+// Stop ends the recording for a device. The ring files are kept for download.
+func (r *Recorder) Stop(mac string) (*Status, error) {
+	mac, err := NormalizeMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.activeSessionLocked(mac, time.Now())
+	if s == nil {
+		return nil, fmt.Errorf("no active recording for %s", mac)
+	}
+
+	r.stopLocked(s)
+	return r.statusLocked(mac), nil
+}
+
+// stopLocked closes a session and removes it from the active set
+func (r *Recorder) stopLocked(s *session) {
+	if err := closeSessionFile(s); err != nil {
+		log.Printf("[Recorder] Warning: failed to close recording for %s: %v", s.mac, err)
+	}
+	delete(r.sessions, s.mac)
+	log.Printf("[Recorder] Stopped recording for %s (%d packets)", s.mac, s.packets)
+}
+
+// activeSessionLocked returns the session for mac, stopping it first if its time limit passed
+func (r *Recorder) activeSessionLocked(mac string, now time.Time) *session {
+	s, exists := r.sessions[mac]
+	if !exists {
+		return nil
+	}
+	if !s.expiresAt.IsZero() && now.After(s.expiresAt) {
+		r.stopLocked(s)
+		return nil
+	}
+	return s
+}
+
+// IsRecording reports whether a device is currently being recorded
+func (r *Recorder) IsRecording(mac string) bool {
+	mac, err := NormalizeMAC(mac)
+	if err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.activeSessionLocked(mac, time.Now()) != nil
+}
+
+// Record writes a captured frame to the rings of the devices it belongs to
+func (r *Recorder) Record(packet *platform.Packet) {
+	if packet == nil || len(packet.RawData) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.sessions) == 0 {
+		return
+	}
+
+	now := time.Now()
+	timestamp := packet.Timestamp
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+
+	macs := make([]string, 0, 2)
+	if len(packet.SrcMAC) > 0 {
+		macs = append(macs, packet.SrcMAC.String())
+	}
+	if len(packet.DstMAC) > 0 && (len(macs) == 0 || packet.DstMAC.String() != macs[0]) {
+		macs = append(macs, packet.DstMAC.String())
+	}
+
+	for _, mac := range macs {
+		s := r.activeSessionLocked(mac, now)
+		if s == nil {
+			continue
+		}
+
+		if err := r.writeLocked(s, timestamp, packet.RawData, now); err != nil {
+			log.Printf("[Recorder] Error writing packet for %s: %v", s.mac, err)
+		}
+	}
+}
+
+// writeLocked appends a frame to the session, rotating the ring when limits are hit
+func (r *Recorder) writeLocked(s *session, timestamp time.Time, data []byte, now time.Time) error {
+	if s.fileSize >= r.config.MaxFileSize ||
+		(r.config.MaxFileAge > 0 && now.Sub(s.openedAt) >= r.config.MaxFileAge) {
+		if err := r.rotateLocked(s, now); err != nil {
+			return err
+		}
+	}
+
+	captured := data
+	if len(captured) > r.config.SnapLen {
+		captured = captured[:r.config.SnapLen]
+	}
+
+	ci := gopacket.CaptureInfo{
+		Timestamp:     timestamp,
+		CaptureLength: len(captured),
+		Length:        len(data),
+	}
+	if err := s.writer.WritePacket(ci, captured); err != nil {
+		return fmt.Errorf("failed to write packet: %w", err)
+	}
+
+	s.fileSize += int64(16 + len(captured)) // Record header plus frame
+	s.packets++
+	return nil
+}
+
+// rotateLocked closes the current ring file, opens a new one and prunes old files
+func (r *Recorder) rotateLocked(s *session, now time.Time) error {
+	if err := closeSessionFile(s); err != nil {
+		log.Printf("[Recorder] Warning: failed to close ring file for %s: %v", s.mac, err)
+	}
+
+	path := filepath.Join(s.dir, now.UTC().Format(fileTimeFormat)+".pcap")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create ring file: %w", err)
+	}
+
+	buffer := bufio.NewWriter(file)
+	writer := pcapgo.NewWriter(buffer)
+	if err := writer.WriteFileHeader(uint32(r.config.SnapLen), layers.LinkTypeEthernet); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write pcap header: %w", err)
+	}
+
+	s.file = file
+	s.buffer = buffer
+	s.writer = writer
+	s.fileSize = pcapFileHeaderSize
+	s.openedAt = now
+
+	r.pruneLocked(s.dir)
+	return nil
+}
+
+// pruneLocked removes the oldest ring files beyond MaxFiles
+func (r *Recorder) pruneLocked(dir string) {
+	files, err := listRingFiles(dir)
+	if err != nil {
+		log.Printf("[Recorder] Warning: failed to list ring files in %s: %v", dir, err)
+		return
+	}
+
+	for len(files) > r.config.MaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			log.Printf("[Recorder] Warning: failed to remove ring file %s: %v", files[0], err)
+		}
+		files = files[1:]
+	}
+}
+
+// closeSessionFile flushes and closes the session's current ring file
+func closeSessionFile(s *session) error {
+	if s.file == nil {
+		return nil
+	}
+
+	flushErr := s.buffer.Flush()
+	closeErr := s.file.Close()
+	s.file = nil
+	s.buffer = nil
+	s.writer = nil
+
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// Status returns the recording state for a device, including stopped recordings on disk
+func (r *Recorder) Status(mac string) (*Status, error) {
+	mac, err := NormalizeMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.statusLocked(mac), nil
+}
+
+// List returns the recording state of every device with an active or stored recording
+func (r *Recorder) List() ([]*Status, error) {
+	entries, err := os.ReadDir(r.config.Directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording directory: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool)
+	statuses := make([]*Status, 0, len(entries))
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		mac, err := NormalizeMAC(strings.ReplaceAll(entry.Name(), "-", ":"))
+		if err != nil {
+			continue
+		}
+		seen[mac] = true
+		statuses = append(statuses, r.statusLocked(mac))
+	}
+
+	for mac := range r.sessions {
+		if !seen[mac] {
+			statuses = append(statuses, r.statusLocked(mac))
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].MAC < statuses[j].MAC
+	})
+	return statuses, nil
+}
+
+// statusLocked builds the status for a normalized MAC address
+func (r *Recorder) statusLocked(mac string) *Status {
+	status := &Status{MAC: mac}
+
+	if s := r.activeSessionLocked(mac, time.Now()); s != nil {
+		status.Active = true
+		startedAt := s.startedAt
+		status.StartedAt = &startedAt
+		if !s.expiresAt.IsZero() {
+			expiresAt := s.expiresAt
+			status.ExpiresAt = &expiresAt
+		}
+		status.Packets = s.packets
+	}
+
+	files, _ := listRingFiles(r.deviceDir(mac))
+	status.Files = len(files)
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			status.SizeBytes += info.Size()
+		}
+	}
+
+	return status
+}
+
+// WritePcap writes the device's ring files to w as a single pcap stream, oldest first
+func (r *Recorder) WritePcap(mac string, w io.Writer) error {
+	mac, err := NormalizeMAC(mac)
+	if err != nil {
+		return err
+	}
+
+	// Flush the active file and note its size so a concurrent write
+	// never leaves a partial record in the output
+	r.mu.Lock()
+	var activePath string
+	var activeSize int64
+	if s := r.activeSessionLocked(mac, time.Now()); s != nil && s.file != nil {
+		if err := s.buffer.Flush(); err != nil {
+			r.mu.Unlock()
+			return fmt.Errorf("failed to flush active recording: %w", err)
+		}
+		activePath = s.file.Name()
+		activeSize = s.fileSize
+	}
+	files, err := listRingFiles(r.deviceDir(mac))
+	r.mu.Unlock()
+
+	if err != nil || len(files) == 0 {
+		return fmt.Errorf("no recording found for %s", mac)
+	}
+
+	writer := pcapgo.NewWriter(w)
+	if err := writer.WriteFileHeader(uint32(r.config.SnapLen), layers.LinkTypeEthernet); err != nil {
+		return fmt.Errorf("failed to write pcap header: %w", err)
+	}
+
+	for _, path := range files {
+		limit := int64(-1)
+		if path == activePath {
+			limit = activeSize
+		}
+		if err := copyRecords(w, path, limit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyRecords copies the packet records of a ring file (everything after the
+// global header) to w. A non-negative limit bounds the bytes read from the file.
+func copyRecords(w io.Writer, path string, limit int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Pruned while downloading
+		}
+		return fmt.Errorf("failed to open ring file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(pcapFileHeaderSize, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek ring file: %w", err)
+	}
+
+	var src io.Reader = file
+	if limit >= 0 {
+		src = io.LimitReader(file, limit-pcapFileHeaderSize)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("failed to copy ring file: %w", err)
+	}
+	return nil
+}
+
+// Close stops all active recordings
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		r.stopLocked(s)
+	}
+	return nil
+}
+
+// deviceDir returns the ring directory for a normalized MAC address
+func (r *Recorder) deviceDir(mac string) string {
+	return filepath.Join(r.config.Directory, strings.ReplaceAll(mac, ":", "-"))
+}
+
+// listRingFiles returns the pcap files in a ring directory, oldest first
+func listRingFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".pcap") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
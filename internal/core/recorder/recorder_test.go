@@ -0,0 +1,189 @@
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcapgo"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+func newTestRecorder(t *testing.T, cfg *Config) *Recorder {
+	t.Helper()
+	cfg.Directory = t.TempDir()
+	rec, err := NewRecorder(cfg)
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+	t.Cleanup(func() { rec.Close() })
+	return rec
+}
+
+func testPacket(src, dst string, size int) *platform.Packet {
+	srcMAC, _ := net.ParseMAC(src)
+	dstMAC, _ := net.ParseMAC(dst)
+	return &platform.Packet{
+		Timestamp: time.Now(),
+		SrcMAC:    srcMAC,
+		DstMAC:    dstMAC,
+		RawData:   bytes.Repeat([]byte{0xab}, size),
+	}
+}
+
+func TestRecordOnlyActiveDevices(t *testing.T) {
+	rec := newTestRecorder(t, DefaultConfig())
+
+	if _, err := rec.Start("AA-BB-CC-DD-EE-01", 0); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	rec.Record(testPacket("aa:bb:cc:dd:ee:01", "aa:bb:cc:dd:ee:02", 100))
+	rec.Record(testPacket("aa:bb:cc:dd:ee:02", "aa:bb:cc:dd:ee:01", 100))
+	rec.Record(testPacket("aa:bb:cc:dd:ee:03", "aa:bb:cc:dd:ee:04", 100))
+
+	status, err := rec.Status("aa:bb:cc:dd:ee:01")
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !status.Active {
+		t.Error("Expected recording to be active")
+	}
+	if status.Packets != 2 {
+		t.Errorf("Expected 2 packets, got %d", status.Packets)
+	}
+
+	if rec.IsRecording("aa:bb:cc:dd:ee:03") {
+		t.Error("Unrelated device should not be recording")
+	}
+}
+
+func TestRotationAndPruning(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxFileSize = 1024
+	cfg.MaxFiles = 2
+	rec := newTestRecorder(t, cfg)
+
+	mac := "aa:bb:cc:dd:ee:01"
+	if _, err := rec.Start(mac, 0); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	// Each packet is ~416 bytes on disk, so every third packet rotates
+	for i := 0; i < 12; i++ {
+		rec.Record(testPacket(mac, "aa:bb:cc:dd:ee:02", 400))
+		time.Sleep(2 * time.Millisecond) // Distinct ring file names
+	}
+
+	files, err := listRingFiles(rec.deviceDir(mac))
+	if err != nil {
+		t.Fatalf("listRingFiles failed: %v", err)
+	}
+	if len(files) != cfg.MaxFiles {
+		t.Errorf("Expected %d ring files after pruning, got %d", cfg.MaxFiles, len(files))
+	}
+	for _, file := range files {
+		if filepath.Ext(file) != ".pcap" {
+			t.Errorf("Unexpected ring file %s", file)
+		}
+	}
+}
+
+func TestWritePcapIsReadable(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxFileSize = 1024
+	rec := newTestRecorder(t, cfg)
+
+	mac := "aa:bb:cc:dd:ee:01"
+	if _, err := rec.Start(mac, 0); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		rec.Record(testPacket(mac, "aa:bb:cc:dd:ee:02", 300))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// Download while the recording is still active
+	var buf bytes.Buffer
+	if err := rec.WritePcap(mac, &buf); err != nil {
+		t.Fatalf("WritePcap failed: %v", err)
+	}
+
+	reader, err := pcapgo.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("Downloaded pcap is not readable: %v", err)
+	}
+
+	count := 0
+	for {
+		data, _, err := reader.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read packet %d: %v", count, err)
+		}
+		if len(data) != 300 {
+			t.Errorf("Expected 300 byte frame, got %d", len(data))
+		}
+		count++
+	}
+	if count != 5 {
+		t.Errorf("Expected 5 packets in download, got %d", count)
+	}
+}
+
+func TestRecordingExpires(t *testing.T) {
+	rec := newTestRecorder(t, DefaultConfig())
+
+	mac := "aa:bb:cc:dd:ee:01"
+	status, err := rec.Start(mac, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if status.ExpiresAt == nil {
+		t.Fatal("Expected an expiry time for a bounded recording")
+	}
+
+	rec.Record(testPacket(mac, "aa:bb:cc:dd:ee:02", 64))
+	time.Sleep(40 * time.Millisecond)
+
+	if rec.IsRecording(mac) {
+		t.Error("Recording should have expired")
+	}
+	if _, err := rec.Stop(mac); err == nil {
+		t.Error("Expected error stopping an expired recording")
+	}
+
+	// The captured data stays available for download
+	status, err = rec.Status(mac)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Files != 1 {
+		t.Errorf("Expected 1 stored file, got %d", status.Files)
+	}
+}
+
+func TestInvalidMAC(t *testing.T) {
+	rec := newTestRecorder(t, DefaultConfig())
+
+	if _, err := rec.Start("not-a-mac", 0); err == nil {
+		t.Error("Expected error for invalid MAC")
+	}
+	if _, err := rec.Status("../etc"); err == nil {
+		t.Error("Expected error for path-like MAC")
+	}
+
+	entries, err := os.ReadDir(rec.config.Directory)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Invalid MACs should not create directories, found %d", len(entries))
+	}
+}
@@ -0,0 +1,31 @@
+package recorder
+
+import (
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// TeeProvider wraps a PacketCaptureProvider and hands every packet it reads
+// to a Recorder before returning it to the caller
+type TeeProvider struct {
+	platform.PacketCaptureProvider
+	recorder *Recorder
+}
+
+// NewTeeProvider creates a capture provider that records packets from provider
+func NewTeeProvider(provider platform.PacketCaptureProvider, recorder *Recorder) *TeeProvider {
+	return &TeeProvider{
+		PacketCaptureProvider: provider,
+		recorder:              recorder,
+	}
+}
+
+// ReadPacket reads the next packet from the wrapped provider and records it
+func (t *TeeProvider) ReadPacket() (*platform.Packet, error) {
+	packet, err := t.PacketCaptureProvider.ReadPacket()
+	if err == nil && packet != nil && t.recorder != nil {
+		t.recorder.Record(packet)
+	}
+	return packet, err
+}
+
+var _ platform.PacketCaptureProvider = (*TeeProvider)(nil)
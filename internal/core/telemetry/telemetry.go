@@ -0,0 +1,274 @@
+// Package telemetry reports sensor liveness and diagnostics to the cloud.
+//
+// The Reporter periodically publishes a heartbeat (uptime, version, inventory
+// counts and component health) so the fleet backend can tell a dead sensor
+// from a quiet network, and, when enabled, a telemetry message with capture,
+// queue, database and memory statistics. Both are sent directly through the
+// active cloud connector; a message that cannot be sent is dropped, since the
+// next one supersedes it.
+package telemetry
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// Publisher sends a schema message to the cloud without queueing it
+type Publisher interface {
+	SendMessage(messageType schemas.MessageType, payload interface{}) error
+}
+
+// Inventory summarizes what the sensor knows about the network
+type Inventory struct {
+	Devices       int
+	ActiveDevices int
+	Profiles      int
+}
+
+// Sources supplies the values reported in heartbeats and telemetry. Any
+// source may be nil; the corresponding values are then left out.
+type Sources struct {
+	// ComponentStatus reports whether each component is running, typically
+	// the orchestrator's GetComponentStatus
+	ComponentStatus func() map[string]bool
+
+	// Inventory counts devices and profiles
+	Inventory func() (Inventory, error)
+
+	// Capture is the packet capture provider whose statistics are reported
+	Capture platform.PacketCaptureProvider
+
+	// QueueStats reports the cloud transmission queue
+	QueueStats func() (cloud.QueueStats, bool)
+
+	// DatabaseSize reports the size of the sensor database in bytes
+	DatabaseSize func() (int64, error)
+}
+
+// Config contains configuration for the telemetry reporter
+type Config struct {
+	SensorID string
+	Platform string // "hardware" or "desktop"
+	Version  string
+
+	// HeartbeatInterval is how often a heartbeat is sent
+	HeartbeatInterval time.Duration
+
+	// TelemetryInterval is how often diagnostics are sent
+	TelemetryInterval time.Duration
+
+	// SendTelemetry enables diagnostics; heartbeats are always sent
+	SendTelemetry bool
+}
+
+// DefaultConfig returns a configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		HeartbeatInterval: time.Minute,
+		TelemetryInterval: 15 * time.Minute,
+		SendTelemetry:     true,
+	}
+}
+
+// Reporter periodically publishes heartbeats and telemetry
+type Reporter struct {
+	config    *Config
+	publisher Publisher
+	sources   Sources
+	started   time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+// NewReporter creates a telemetry reporter that publishes through publisher
+func NewReporter(publisher Publisher, cfg *Config, sources Sources) (*Reporter, error) {
+	if publisher == nil {
+		return nil, fmt.Errorf("publisher is required")
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.SensorID == "" {
+		return nil, fmt.Errorf("sensor ID is required")
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		return nil, fmt.Errorf("heartbeat interval must be positive, got %v", cfg.HeartbeatInterval)
+	}
+	if cfg.SendTelemetry && cfg.TelemetryInterval <= 0 {
+		return nil, fmt.Errorf("telemetry interval must be positive, got %v", cfg.TelemetryInterval)
+	}
+
+	return &Reporter{
+		config:    cfg,
+		publisher: publisher,
+		sources:   sources,
+		started:   time.Now(),
+	}, nil
+}
+
+// Start begins publishing. The first heartbeat is sent immediately.
+func (r *Reporter) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopCh != nil {
+		return fmt.Errorf("telemetry reporter already running")
+	}
+	r.stopCh = make(chan struct{})
+
+	r.wg.Add(1)
+	go r.loop(r.stopCh)
+
+	log.Printf("[Telemetry] Started (heartbeat every %v, telemetry %s)", r.config.HeartbeatInterval, r.telemetrySchedule())
+	return nil
+}
+
+// Stop halts publishing
+func (r *Reporter) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopCh == nil {
+		return nil
+	}
+	close(r.stopCh)
+	r.wg.Wait()
+	r.stopCh = nil
+	return nil
+}
+
+// Name returns the component name
+func (r *Reporter) Name() string {
+	return "Telemetry Reporter"
+}
+
+// loop sends heartbeats and telemetry until stopCh is closed
+func (r *Reporter) loop(stopCh chan struct{}) {
+	defer r.wg.Done()
+
+	heartbeat := time.NewTicker(r.config.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// A nil channel never fires, which disables telemetry
+	var telemetryC <-chan time.Time
+	if r.config.SendTelemetry {
+		telemetry := time.NewTicker(r.config.TelemetryInterval)
+		defer telemetry.Stop()
+		telemetryC = telemetry.C
+	}
+
+	r.send(schemas.MessageTypeHeartbeat, r.Heartbeat())
+	if r.config.SendTelemetry {
+		r.send(schemas.MessageTypeTelemetry, r.Telemetry())
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-heartbeat.C:
+			r.send(schemas.MessageTypeHeartbeat, r.Heartbeat())
+		case <-telemetryC:
+			r.send(schemas.MessageTypeTelemetry, r.Telemetry())
+		}
+	}
+}
+
+// send publishes a message, dropping it on failure
+func (r *Reporter) send(messageType schemas.MessageType, payload interface{}) {
+	if err := r.publisher.SendMessage(messageType, payload); err != nil {
+		log.Printf("[Telemetry] Dropped %s: %v", messageType, err)
+	}
+}
+
+// Heartbeat builds a heartbeat message from the current state
+func (r *Reporter) Heartbeat() *schemas.HeartbeatMessage {
+	msg := &schemas.HeartbeatMessage{
+		SensorID:  r.config.SensorID,
+		Timestamp: time.Now(),
+		Uptime:    int64(time.Since(r.started).Seconds()),
+		Version:   r.config.Version,
+	}
+
+	if r.sources.Inventory != nil {
+		if inventory, err := r.sources.Inventory(); err != nil {
+			log.Printf("[Telemetry] Failed to count devices: %v", err)
+		} else {
+			msg.DeviceCount = inventory.Devices
+			msg.ActiveDevices = inventory.ActiveDevices
+			msg.ProfileCount = inventory.Profiles
+		}
+	}
+
+	if r.sources.ComponentStatus != nil {
+		msg.ComponentStatus = r.sources.ComponentStatus()
+	}
+
+	return msg
+}
+
+// Telemetry builds a diagnostics message from the current state
+func (r *Reporter) Telemetry() *schemas.TelemetryMessage {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	msg := &schemas.TelemetryMessage{
+		SensorID:    r.config.SensorID,
+		Timestamp:   time.Now(),
+		Platform:    r.config.Platform,
+		OS:          runtime.GOOS,
+		Version:     r.config.Version,
+		MemoryUsage: int64(mem.Sys),
+		Metrics: map[string]interface{}{
+			"heap_alloc_bytes": mem.HeapAlloc,
+			"goroutines":       runtime.NumGoroutine(),
+			"uptime_seconds":   int64(time.Since(r.started).Seconds()),
+		},
+	}
+
+	if r.sources.Capture != nil {
+		if stats, err := r.sources.Capture.GetStats(); err != nil {
+			log.Printf("[Telemetry] Failed to read capture statistics: %v", err)
+		} else if stats != nil {
+			msg.Metrics["packets_captured"] = stats.PacketsCaptured
+			msg.Metrics["packets_dropped"] = stats.PacketsDropped
+			msg.Metrics["packets_filtered"] = stats.PacketsFiltered
+		}
+	}
+
+	if r.sources.QueueStats != nil {
+		if stats, ok := r.sources.QueueStats(); ok {
+			msg.Metrics["queue_depth"] = stats.Depth
+			msg.Metrics["queue_oldest_age_seconds"] = stats.OldestAgeSeconds
+			msg.Metrics["queue_dead_letters"] = stats.DeadLetters
+			msg.Metrics["queue_evicted"] = stats.Evicted
+		}
+	}
+
+	if r.sources.DatabaseSize != nil {
+		if size, err := r.sources.DatabaseSize(); err != nil {
+			log.Printf("[Telemetry] Failed to read database size: %v", err)
+		} else {
+			msg.Metrics["db_size_bytes"] = size
+		}
+	}
+
+	return msg
+}
+
+// telemetrySchedule describes when telemetry is sent, for logging
+func (r *Reporter) telemetrySchedule() string {
+	if !r.config.SendTelemetry {
+		return "disabled"
+	}
+	return fmt.Sprintf("every %v", r.config.TelemetryInterval)
+}
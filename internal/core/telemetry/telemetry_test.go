@@ -0,0 +1,133 @@
+package telemetry
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+// recordingPublisher records sent messages and can be made to fail
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages map[schemas.MessageType][]interface{}
+	err      error
+}
+
+func newRecordingPublisher() *recordingPublisher {
+	return &recordingPublisher{messages: make(map[schemas.MessageType][]interface{})}
+}
+
+func (p *recordingPublisher) SendMessage(messageType schemas.MessageType, payload interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.messages[messageType] = append(p.messages[messageType], payload)
+	return nil
+}
+
+func (p *recordingPublisher) count(messageType schemas.MessageType) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.messages[messageType])
+}
+
+func testSources() Sources {
+	return Sources{
+		ComponentStatus: func() map[string]bool {
+			return map[string]bool{"Analyzer": true, "Device Scanner": false}
+		},
+		Inventory: func() (Inventory, error) {
+			return Inventory{Devices: 12, ActiveDevices: 9, Profiles: 10}, nil
+		},
+		Capture: mocks.NewMockPacketCaptureProvider(make([]*platform.Packet, 42)),
+		QueueStats: func() (cloud.QueueStats, bool) {
+			return cloud.QueueStats{Depth: 3, DeadLetters: 1}, true
+		},
+		DatabaseSize: func() (int64, error) { return 4096, nil },
+	}
+}
+
+func TestReporterBuildsMessages(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SensorID = "sensor-01"
+	cfg.Platform = "hardware"
+	cfg.Version = "2.0.0"
+
+	reporter, err := NewReporter(newRecordingPublisher(), cfg, testSources())
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+
+	heartbeat := reporter.Heartbeat()
+	if heartbeat.SensorID != "sensor-01" || heartbeat.Version != "2.0.0" {
+		t.Errorf("Unexpected heartbeat identity: %+v", heartbeat)
+	}
+	if heartbeat.DeviceCount != 12 || heartbeat.ActiveDevices != 9 || heartbeat.ProfileCount != 10 {
+		t.Errorf("Unexpected heartbeat inventory: %+v", heartbeat)
+	}
+	if running, ok := heartbeat.ComponentStatus["Device Scanner"]; !ok || running {
+		t.Errorf("Expected component status to be reported, got %v", heartbeat.ComponentStatus)
+	}
+
+	msg := reporter.Telemetry()
+	if msg.Platform != "hardware" || msg.OS == "" || msg.MemoryUsage <= 0 {
+		t.Errorf("Unexpected telemetry header: %+v", msg)
+	}
+	for key, want := range map[string]interface{}{
+		"packets_captured":   uint64(42),
+		"queue_depth":        3,
+		"queue_dead_letters": 1,
+		"db_size_bytes":      int64(4096),
+	} {
+		if msg.Metrics[key] != want {
+			t.Errorf("Expected %s = %v, got %v", key, want, msg.Metrics[key])
+		}
+	}
+}
+
+func TestReporterPublishesPeriodically(t *testing.T) {
+	publisher := newRecordingPublisher()
+	cfg := DefaultConfig()
+	cfg.SensorID = "sensor-01"
+	cfg.HeartbeatInterval = 10 * time.Millisecond
+	cfg.SendTelemetry = false
+
+	reporter, err := NewReporter(publisher, cfg, Sources{})
+	if err != nil {
+		t.Fatalf("NewReporter failed: %v", err)
+	}
+	if err := reporter.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for publisher.count(schemas.MessageTypeHeartbeat) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	reporter.Stop()
+
+	if n := publisher.count(schemas.MessageTypeHeartbeat); n < 3 {
+		t.Errorf("Expected at least 3 heartbeats, got %d", n)
+	}
+	if n := publisher.count(schemas.MessageTypeTelemetry); n != 0 {
+		t.Errorf("Expected no telemetry when disabled, got %d", n)
+	}
+
+	// Failed sends are dropped rather than stopping the reporter
+	publisher.mu.Lock()
+	publisher.err = errors.New("not connected")
+	publisher.mu.Unlock()
+	if err := reporter.Start(); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	reporter.Stop()
+}
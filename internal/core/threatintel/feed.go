@@ -0,0 +1,293 @@
+package threatintel
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+)
+
+// FeedFormat identifies the file format of an indicator feed
+type FeedFormat string
+
+const (
+	FormatAuto  FeedFormat = ""      // Chosen from the file extension
+	FormatPlain FeedFormat = "plain" // One indicator per line, # comments
+	FormatCSV   FeedFormat = "csv"   // Indicator column named indicator/ip/domain/value, or the first column
+	FormatSTIX  FeedFormat = "stix"  // STIX 2.1 bundle (indicator patterns and IP/domain observables)
+)
+
+// IndicatorType is the kind of value an indicator matches
+type IndicatorType string
+
+const (
+	IndicatorIP     IndicatorType = "ip"
+	IndicatorCIDR   IndicatorType = "cidr"
+	IndicatorDomain IndicatorType = "domain"
+)
+
+// Indicator is a single entry from a threat-intel feed
+type Indicator struct {
+	Value       string             `json:"value"`
+	Type        IndicatorType      `json:"type"`
+	Feed        string             `json:"feed"`
+	Severity    detection.Severity `json:"severity"`
+	Description string             `json:"description,omitempty"`
+
+	prefix netip.Prefix
+}
+
+// FeedConfig describes an indicator feed file
+type FeedConfig struct {
+	Name     string
+	Path     string
+	Format   FeedFormat
+	Severity detection.Severity // Severity of matches (default: high)
+}
+
+// csvColumns are the header names recognised as the indicator column
+var csvColumns = []string{"indicator", "ioc", "ip", "domain", "value"}
+
+// csvDescriptionColumns are the header names recognised as a description
+var csvDescriptionColumns = []string{"description", "comment", "threat", "tags"}
+
+// stixPattern extracts values from STIX comparison expressions such as
+// [ipv4-addr:value = '198.51.100.1' OR domain-name:value = 'evil.example']
+var stixPattern = regexp.MustCompile(`(ipv4-addr|ipv6-addr|domain-name):value\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// LoadFeed reads and parses a feed file
+func LoadFeed(cfg FeedConfig) ([]*Indicator, error) {
+	file, err := os.Open(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feed %s: %w", cfg.Name, err)
+	}
+	defer file.Close()
+
+	format := cfg.Format
+	if format == FormatAuto {
+		switch strings.ToLower(filepath.Ext(cfg.Path)) {
+		case ".json":
+			format = FormatSTIX
+		case ".csv":
+			format = FormatCSV
+		default:
+			format = FormatPlain
+		}
+	}
+
+	var entries []feedEntry
+	switch format {
+	case FormatPlain:
+		entries, err = parsePlain(file)
+	case FormatCSV:
+		entries, err = parseCSV(file)
+	case FormatSTIX:
+		entries, err = parseSTIX(file)
+	default:
+		return nil, fmt.Errorf("feed %s: unsupported format %q", cfg.Name, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feed %s: %w", cfg.Name, err)
+	}
+
+	severity := cfg.Severity
+	if severity == "" {
+		severity = detection.SeverityHigh
+	}
+
+	indicators := make([]*Indicator, 0, len(entries))
+	for _, entry := range entries {
+		indicator, ok := newIndicator(entry.value)
+		if !ok {
+			continue
+		}
+		indicator.Feed = cfg.Name
+		indicator.Severity = severity
+		indicator.Description = entry.description
+		indicators = append(indicators, indicator)
+	}
+
+	return indicators, nil
+}
+
+// feedEntry is a raw value read from a feed before classification
+type feedEntry struct {
+	value       string
+	description string
+}
+
+// newIndicator classifies a raw feed value as an IP, CIDR or domain
+func newIndicator(value string) (*Indicator, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, false
+	}
+
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return &Indicator{Value: prefix.Masked().String(), Type: IndicatorCIDR, prefix: prefix.Masked()}, true
+	}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		addr = addr.Unmap()
+		return &Indicator{Value: addr.String(), Type: IndicatorIP, prefix: netip.PrefixFrom(addr, addr.BitLen())}, true
+	}
+
+	domain := normalizeDomain(value)
+	if !validDomain(domain) {
+		return nil, false
+	}
+	return &Indicator{Value: domain, Type: IndicatorDomain}, true
+}
+
+// parsePlain reads one indicator per line; text after # is ignored
+func parsePlain(r io.Reader) ([]feedEntry, error) {
+	var entries []feedEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		// Hosts-file style lines ("0.0.0.0 evil.example") list the domain last
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entries = append(entries, feedEntry{value: fields[len(fields)-1]})
+	}
+	return entries, scanner.Err()
+}
+
+// parseCSV reads the indicator column of a CSV feed
+func parseCSV(r io.Reader) ([]feedEntry, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	valueCol, descCol := 0, -1
+	header := records[0]
+	if col := findColumn(header, csvColumns); col >= 0 {
+		valueCol = col
+		descCol = findColumn(header, csvDescriptionColumns)
+		records = records[1:]
+	}
+
+	entries := make([]feedEntry, 0, len(records))
+	for _, record := range records {
+		if valueCol >= len(record) {
+			continue
+		}
+		entry := feedEntry{value: record[valueCol]}
+		if descCol >= 0 && descCol < len(record) {
+			entry.description = record[descCol]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// findColumn returns the index of the first header matching one of names, or -1
+func findColumn(header []string, names []string) int {
+	for _, name := range names {
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// stixBundle is the subset of a STIX 2.1 bundle the parser reads
+type stixBundle struct {
+	Type    string       `json:"type"`
+	Objects []stixObject `json:"objects"`
+}
+
+type stixObject struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Pattern     string `json:"pattern"`
+	PatternType string `json:"pattern_type"`
+	Value       string `json:"value"`
+	Revoked     bool   `json:"revoked"`
+}
+
+// parseSTIX reads indicator patterns and IP/domain observables from a STIX 2.1 bundle
+func parseSTIX(r io.Reader) ([]feedEntry, error) {
+	var bundle stixBundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, err
+	}
+	if bundle.Type != "bundle" {
+		return nil, fmt.Errorf("not a STIX bundle (type %q)", bundle.Type)
+	}
+
+	var entries []feedEntry
+	for _, object := range bundle.Objects {
+		if object.Revoked {
+			continue
+		}
+
+		switch object.Type {
+		case "indicator":
+			if object.PatternType != "" && object.PatternType != "stix" {
+				continue
+			}
+			description := object.Name
+			if description == "" {
+				description = object.Description
+			}
+			for _, match := range stixPattern.FindAllStringSubmatch(object.Pattern, -1) {
+				value := strings.ReplaceAll(match[2], `\'`, `'`)
+				entries = append(entries, feedEntry{value: value, description: description})
+			}
+		case "ipv4-addr", "ipv6-addr", "domain-name":
+			entries = append(entries, feedEntry{value: object.Value})
+		}
+	}
+	return entries, nil
+}
+
+// normalizeDomain lowercases a domain and strips a trailing dot and wildcard label
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimSuffix(domain, ".")
+	domain = strings.TrimPrefix(domain, "*.")
+	return domain
+}
+
+// validDomain performs a light syntax check on a normalized domain name
+func validDomain(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
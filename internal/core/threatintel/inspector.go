@@ -0,0 +1,214 @@
+package threatintel
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// AnomalySink receives anomalies raised by threat-intel matches
+type AnomalySink func(*detection.Anomaly)
+
+// DefaultCooldown is how long an inline match for the same device and
+// destination is suppressed after it has been reported
+const DefaultCooldown = 10 * time.Minute
+
+// maxCooldownEntries bounds the inspector's memory of recent matches
+const maxCooldownEntries = 4096
+
+// NewAnomaly builds the anomaly raised when a device contacts an indicator
+func NewAnomaly(mac, destination string, indicator *Indicator, at time.Time) *detection.Anomaly {
+	evidence := map[string]interface{}{
+		"feed":           indicator.Feed,
+		"indicator":      indicator.Value,
+		"indicator_type": string(indicator.Type),
+		"destination_ip": destination,
+	}
+	if indicator.Description != "" {
+		evidence["threat"] = indicator.Description
+	}
+
+	return &detection.Anomaly{
+		DeviceMAC:   mac,
+		Type:        detection.AnomalyThreatIntelMatch,
+		Severity:    indicator.Severity,
+		Description: fmt.Sprintf("Device contacted %s listed in threat feed %s (%s)", destination, indicator.Feed, indicator.Value),
+		Timestamp:   at,
+		Evidence:    evidence,
+	}
+}
+
+// NewDomainAnomaly builds the anomaly raised when a device looks up a domain
+// listed in a feed
+func NewDomainAnomaly(mac, domain string, indicator *Indicator, at time.Time) *detection.Anomaly {
+	evidence := map[string]interface{}{
+		"feed":           indicator.Feed,
+		"indicator":      indicator.Value,
+		"indicator_type": string(indicator.Type),
+		"domain":         domain,
+	}
+	if indicator.Description != "" {
+		evidence["threat"] = indicator.Description
+	}
+
+	return &detection.Anomaly{
+		DeviceMAC:   mac,
+		Type:        detection.AnomalyThreatIntelMatch,
+		Severity:    indicator.Severity,
+		Description: fmt.Sprintf("Device looked up %s listed in threat feed %s (%s)", domain, indicator.Feed, indicator.Value),
+		Timestamp:   at,
+		Evidence:    evidence,
+	}
+}
+
+// Inspector checks the destination of every captured packet, and the name in
+// every DNS query, against the matcher. It implements packet.Inspector.
+type Inspector struct {
+	matcher  *Matcher
+	sink     AnomalySink
+	cooldown time.Duration
+
+	reported map[string]time.Time
+	mu       sync.Mutex
+}
+
+// NewInspector creates an inline inspector that reports matches to sink
+func NewInspector(matcher *Matcher, sink AnomalySink) *Inspector {
+	return &Inspector{
+		matcher:  matcher,
+		sink:     sink,
+		cooldown: DefaultCooldown,
+		reported: make(map[string]time.Time),
+	}
+}
+
+var _ packet.Inspector = (*Inspector)(nil)
+
+// Inspect implements packet.Inspector
+func (i *Inspector) Inspect(pkt *platform.Packet, info *packet.PacketInfo) {
+	if info.DNS != nil && !info.DNS.Response {
+		i.inspectQuery(info)
+	}
+
+	if pkt.DstIP == nil {
+		return
+	}
+	addr, ok := netip.AddrFromSlice(pkt.DstIP)
+	if !ok {
+		return
+	}
+	indicator := i.matcher.MatchAddr(addr)
+	if indicator == nil {
+		return
+	}
+
+	at := info.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if !i.shouldReport(info.SrcMAC+"|"+info.DstIP, at) {
+		return
+	}
+
+	i.sink(NewAnomaly(info.SrcMAC, info.DstIP, indicator, at))
+}
+
+// inspectQuery checks the name in a DNS query sent by a device
+func (i *Inspector) inspectQuery(info *packet.PacketInfo) {
+	indicator := i.matcher.MatchDomain(info.DNS.Name)
+	if indicator == nil {
+		return
+	}
+
+	at := info.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if !i.shouldReport(info.SrcMAC+"|"+info.DNS.Name, at) {
+		return
+	}
+
+	i.sink(NewDomainAnomaly(info.SrcMAC, info.DNS.Name, indicator, at))
+}
+
+// shouldReport applies the per device and destination cooldown
+func (i *Inspector) shouldReport(key string, at time.Time) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if last, ok := i.reported[key]; ok && at.Sub(last) < i.cooldown {
+		return false
+	}
+
+	if len(i.reported) >= maxCooldownEntries {
+		for k, last := range i.reported {
+			if at.Sub(last) >= i.cooldown {
+				delete(i.reported, k)
+			}
+		}
+	}
+	if len(i.reported) < maxCooldownEntries {
+		i.reported[key] = at
+	}
+	return true
+}
+
+// profileRule checks every destination and looked-up domain in a behavioral
+// profile against the matcher, catching contacts made before a feed listed
+// the indicator
+type profileRule struct {
+	matcher *Matcher
+}
+
+// Rule returns a detection rule that checks profile destinations and domains against the feeds
+func (m *Matcher) Rule() detection.Rule {
+	return &profileRule{matcher: m}
+}
+
+func (r *profileRule) Name() string {
+	return "threat_intel"
+}
+
+func (r *profileRule) Evaluate(ctx *detection.RuleContext) []*detection.Anomaly {
+	anomalies := make([]*detection.Anomaly, 0)
+
+	destinations := make([]string, 0, len(ctx.Profile.Destinations))
+	for ip := range ctx.Profile.Destinations {
+		destinations = append(destinations, ip)
+	}
+	sort.Strings(destinations)
+
+	for _, ip := range destinations {
+		indicator := r.matcher.MatchIP(ip)
+		if indicator == nil {
+			continue
+		}
+		at := ctx.Profile.LastSeen
+		if dest := ctx.Profile.Destinations[ip]; dest != nil && !dest.LastSeen.IsZero() {
+			at = dest.LastSeen
+		}
+		anomalies = append(anomalies, NewAnomaly(ctx.Profile.MAC, ip, indicator, at))
+	}
+
+	domains := make([]string, 0, len(ctx.Profile.Domains))
+	for name := range ctx.Profile.Domains {
+		domains = append(domains, name)
+	}
+	sort.Strings(domains)
+
+	for _, name := range domains {
+		indicator := r.matcher.MatchDomain(name)
+		if indicator == nil {
+			continue
+		}
+		anomalies = append(anomalies, NewDomainAnomaly(ctx.Profile.MAC, name, indicator, ctx.Profile.Domains[name].LastSeen))
+	}
+
+	return anomalies
+}
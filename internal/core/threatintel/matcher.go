@@ -0,0 +1,228 @@
+// Package threatintel matches network destinations against threat-intelligence
+// indicator feeds.
+//
+// Feeds are local files (plain lists, CSV or STIX 2.1 bundles) containing IP
+// addresses, CIDR ranges and domains. The Matcher compiles them into a prefix
+// tree and a domain index that are swapped atomically on refresh, so lookups
+// never take a lock and are cheap enough to run for every captured packet.
+package threatintel
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config contains configuration for the threat-intel matcher
+type Config struct {
+	Feeds []FeedConfig
+
+	// RefreshInterval is how often feed files are re-read (0 disables refresh)
+	RefreshInterval time.Duration
+}
+
+// DefaultConfig returns a configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		RefreshInterval: time.Hour,
+	}
+}
+
+// FeedStatus reports the state of a loaded feed
+type FeedStatus struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Indicators int       `json:"indicators"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// index is an immutable snapshot of all loaded indicators
+type index struct {
+	prefixes *prefixTree
+	domains  map[string]*Indicator
+}
+
+// Matcher checks IP addresses and domains against the loaded feeds
+type Matcher struct {
+	config  *Config
+	current atomic.Pointer[index]
+
+	// Last successful parse of each feed, kept when a refresh fails
+	feeds   map[string][]*Indicator
+	status  map[string]*FeedStatus
+	feedsMu sync.Mutex
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewMatcher creates a matcher for the configured feeds. Call Refresh to load them.
+func NewMatcher(cfg *Config) (*Matcher, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.RefreshInterval < 0 {
+		return nil, fmt.Errorf("refresh interval must be non-negative, got %v", cfg.RefreshInterval)
+	}
+
+	names := make(map[string]bool, len(cfg.Feeds))
+	for _, feed := range cfg.Feeds {
+		if feed.Name == "" {
+			return nil, fmt.Errorf("feed name is required")
+		}
+		if feed.Path == "" {
+			return nil, fmt.Errorf("feed %s: path is required", feed.Name)
+		}
+		if names[feed.Name] {
+			return nil, fmt.Errorf("duplicate feed name: %s", feed.Name)
+		}
+		names[feed.Name] = true
+	}
+
+	m := &Matcher{
+		config: cfg,
+		feeds:  make(map[string][]*Indicator),
+		status: make(map[string]*FeedStatus),
+	}
+	m.current.Store(&index{prefixes: newPrefixTree(), domains: make(map[string]*Indicator)})
+
+	return m, nil
+}
+
+// Refresh re-reads every feed and swaps in the new index. A feed that fails
+// to load keeps its previous indicators; the first error is returned.
+func (m *Matcher) Refresh() error {
+	m.feedsMu.Lock()
+	defer m.feedsMu.Unlock()
+
+	var firstErr error
+	for _, feed := range m.config.Feeds {
+		status := &FeedStatus{Name: feed.Name, Path: feed.Path}
+		indicators, err := LoadFeed(feed)
+		if err != nil {
+			log.Printf("[ThreatIntel] %v", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			if previous, ok := m.status[feed.Name]; ok {
+				status.Indicators = previous.Indicators
+				status.LoadedAt = previous.LoadedAt
+			}
+			status.Error = err.Error()
+		} else {
+			m.feeds[feed.Name] = indicators
+			status.Indicators = len(indicators)
+			status.LoadedAt = time.Now()
+		}
+		m.status[feed.Name] = status
+	}
+
+	next := &index{prefixes: newPrefixTree(), domains: make(map[string]*Indicator)}
+	for _, feed := range m.config.Feeds {
+		for _, indicator := range m.feeds[feed.Name] {
+			if indicator.Type == IndicatorDomain {
+				if _, exists := next.domains[indicator.Value]; !exists {
+					next.domains[indicator.Value] = indicator
+				}
+				continue
+			}
+			next.prefixes.insert(indicator.prefix, indicator)
+		}
+	}
+	m.current.Store(next)
+
+	log.Printf("[ThreatIntel] Loaded %d IP/CIDR and %d domain indicators from %d feeds",
+		next.prefixes.size, len(next.domains), len(m.config.Feeds))
+	return firstErr
+}
+
+// Start begins refreshing the feeds on the configured interval
+func (m *Matcher) Start() {
+	if m.config.RefreshInterval <= 0 || m.stopCh != nil {
+		return
+	}
+	m.stopCh = make(chan struct{})
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stopCh:
+				return
+			case <-ticker.C:
+				m.Refresh()
+			}
+		}
+	}()
+}
+
+// Stop halts scheduled refreshes
+func (m *Matcher) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.stopCh = nil
+}
+
+// MatchIP returns the indicator matching an IP address string, or nil
+func (m *Matcher) MatchIP(ip string) *Indicator {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	return m.MatchAddr(addr)
+}
+
+// MatchAddr returns the most specific indicator containing addr, or nil
+func (m *Matcher) MatchAddr(addr netip.Addr) *Indicator {
+	return m.current.Load().prefixes.lookup(addr)
+}
+
+// MatchDomain returns the indicator matching a domain or any of its parent
+// domains (an indicator for evil.example also matches cdn.evil.example), or nil
+func (m *Matcher) MatchDomain(domain string) *Indicator {
+	domains := m.current.Load().domains
+	if len(domains) == 0 {
+		return nil
+	}
+
+	domain = normalizeDomain(domain)
+	for domain != "" {
+		if indicator, ok := domains[domain]; ok {
+			return indicator
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+	return nil
+}
+
+// Feeds returns the load status of every configured feed
+func (m *Matcher) Feeds() []FeedStatus {
+	m.feedsMu.Lock()
+	defer m.feedsMu.Unlock()
+
+	result := make([]FeedStatus, 0, len(m.config.Feeds))
+	for _, feed := range m.config.Feeds {
+		if status, ok := m.status[feed.Name]; ok {
+			result = append(result, *status)
+		} else {
+			result = append(result, FeedStatus{Name: feed.Name, Path: feed.Path})
+		}
+	}
+	return result
+}
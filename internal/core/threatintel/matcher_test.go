@@ -0,0 +1,217 @@
+package threatintel
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+const testPlainFeed = `# Known C2 servers
+198.51.100.7
+203.0.113.0/24   # bulletproof hoster
+2001:db8:bad::/48
+0.0.0.0 evil.example
+`
+
+const testCSVFeed = `first_seen,indicator,description
+2024-01-01,192.0.2.10,Mirai C2
+2024-01-02,*.tracker.example,Tracking
+`
+
+const testSTIXFeed = `{
+  "type": "bundle",
+  "id": "bundle--1",
+  "objects": [
+    {"type": "indicator", "name": "Emotet", "pattern_type": "stix",
+     "pattern": "[ipv4-addr:value = '198.18.0.5' OR domain-name:value = 'emotet.example']"},
+    {"type": "indicator", "name": "Revoked", "revoked": true, "pattern_type": "stix",
+     "pattern": "[ipv4-addr:value = '198.18.0.6']"},
+    {"type": "ipv4-addr", "value": "198.18.1.0/24"}
+  ]
+}`
+
+func writeFeed(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write feed: %v", err)
+	}
+	return path
+}
+
+func newTestMatcher(t *testing.T) *Matcher {
+	t.Helper()
+	matcher, err := NewMatcher(&Config{Feeds: []FeedConfig{
+		{Name: "plain", Path: writeFeed(t, "plain.txt", testPlainFeed)},
+		{Name: "csv", Path: writeFeed(t, "feed.csv", testCSVFeed), Severity: detection.SeverityCritical},
+		{Name: "stix", Path: writeFeed(t, "bundle.json", testSTIXFeed)},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+	if err := matcher.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	return matcher
+}
+
+func TestMatcherFeedFormats(t *testing.T) {
+	matcher := newTestMatcher(t)
+
+	tests := []struct {
+		ip   string
+		feed string
+	}{
+		{"198.51.100.7", "plain"},
+		{"203.0.113.99", "plain"},
+		{"2001:db8:bad::1", "plain"},
+		{"192.0.2.10", "csv"},
+		{"198.18.0.5", "stix"},
+		{"198.18.1.200", "stix"},
+		{"198.18.0.6", ""}, // Revoked
+		{"8.8.8.8", ""},
+		{"not-an-ip", ""},
+	}
+	for _, tt := range tests {
+		indicator := matcher.MatchIP(tt.ip)
+		switch {
+		case tt.feed == "" && indicator != nil:
+			t.Errorf("%s: expected no match, got %s from %s", tt.ip, indicator.Value, indicator.Feed)
+		case tt.feed != "" && indicator == nil:
+			t.Errorf("%s: expected match from %s", tt.ip, tt.feed)
+		case tt.feed != "" && indicator.Feed != tt.feed:
+			t.Errorf("%s: expected feed %s, got %s", tt.ip, tt.feed, indicator.Feed)
+		}
+	}
+
+	if indicator := matcher.MatchIP("192.0.2.10"); indicator.Severity != detection.SeverityCritical || indicator.Description != "Mirai C2" {
+		t.Errorf("Unexpected CSV indicator: %+v", indicator)
+	}
+
+	for _, domain := range []string{"evil.example", "cdn.evil.example.", "a.b.tracker.example", "EMOTET.example"} {
+		if matcher.MatchDomain(domain) == nil {
+			t.Errorf("Expected domain %s to match", domain)
+		}
+	}
+	if matcher.MatchDomain("notevil.example") != nil {
+		t.Error("Expected notevil.example not to match evil.example")
+	}
+}
+
+func TestPrefixTreeLongestMatch(t *testing.T) {
+	tree := newPrefixTree()
+	wide := &Indicator{Value: "10.0.0.0/8"}
+	narrow := &Indicator{Value: "10.1.2.0/24"}
+	tree.insert(netip.MustParsePrefix("10.0.0.0/8"), wide)
+	tree.insert(netip.MustParsePrefix("10.1.2.0/24"), narrow)
+
+	if got := tree.lookup(netip.MustParseAddr("10.1.2.3")); got != narrow {
+		t.Errorf("Expected narrow match, got %v", got)
+	}
+	if got := tree.lookup(netip.MustParseAddr("10.9.9.9")); got != wide {
+		t.Errorf("Expected wide match, got %v", got)
+	}
+	if got := tree.lookup(netip.MustParseAddr("::ffff:10.1.2.3")); got != narrow {
+		t.Errorf("Expected IPv4-mapped address to match, got %v", got)
+	}
+	if got := tree.lookup(netip.MustParseAddr("11.0.0.1")); got != nil {
+		t.Errorf("Expected no match, got %v", got)
+	}
+}
+
+func TestRefreshKeepsFeedOnError(t *testing.T) {
+	path := writeFeed(t, "feed.txt", "198.51.100.7\n")
+	matcher, err := NewMatcher(&Config{Feeds: []FeedConfig{{Name: "feed", Path: path}}})
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+	if err := matcher.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	os.Remove(path)
+	if err := matcher.Refresh(); err == nil {
+		t.Fatal("Expected refresh error for missing feed")
+	}
+	if matcher.MatchIP("198.51.100.7") == nil {
+		t.Error("Expected indicators to survive a failed refresh")
+	}
+	if status := matcher.Feeds(); len(status) != 1 || status[0].Error == "" || status[0].Indicators != 1 {
+		t.Errorf("Unexpected feed status: %+v", status)
+	}
+}
+
+func TestInspectorAndProfileRule(t *testing.T) {
+	matcher := newTestMatcher(t)
+
+	var raised []*detection.Anomaly
+	inspector := NewInspector(matcher, func(a *detection.Anomaly) { raised = append(raised, a) })
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		pkt := &platform.Packet{DstIP: net.ParseIP("198.51.100.7")}
+		info := &packet.PacketInfo{Timestamp: base.Add(time.Duration(i) * time.Second), SrcMAC: "aa:bb:cc:dd:ee:ff", DstIP: "198.51.100.7"}
+		inspector.Inspect(pkt, info)
+	}
+	if len(raised) != 1 {
+		t.Fatalf("Expected 1 anomaly within the cooldown, got %d", len(raised))
+	}
+	anomaly := raised[0]
+	if anomaly.Type != detection.AnomalyThreatIntelMatch || anomaly.Evidence["feed"] != "plain" || anomaly.Evidence["indicator"] != "198.51.100.7" {
+		t.Errorf("Unexpected anomaly: %+v", anomaly)
+	}
+
+	profile := &database.BehavioralProfile{
+		MAC: "aa:bb:cc:dd:ee:ff",
+		Destinations: map[string]*database.DestInfo{
+			"203.0.113.5": {IP: "203.0.113.5", Count: 3, LastSeen: base},
+			"8.8.8.8":     {IP: "8.8.8.8", Count: 50, LastSeen: base},
+		},
+	}
+	anomalies := matcher.Rule().Evaluate(&detection.RuleContext{Profile: profile})
+	if len(anomalies) != 1 || anomalies[0].Evidence["indicator"] != "203.0.113.0/24" {
+		t.Errorf("Expected one CIDR match from the profile, got %+v", anomalies)
+	}
+
+	// DNS lookups of listed domains are matched inline and from the profile
+	query := &packet.PacketInfo{Timestamp: base, SrcMAC: "aa:bb:cc:dd:ee:ff", DNS: &packet.DNSInfo{Name: "cdn.evil.example"}}
+	inspector.Inspect(&platform.Packet{}, query)
+	if len(raised) != 2 || raised[1].Evidence["domain"] != "cdn.evil.example" || raised[1].Evidence["indicator"] != "evil.example" {
+		t.Errorf("Expected a domain match from the DNS query, got %+v", raised)
+	}
+
+	profile.Destinations = nil
+	profile.Domains = map[string]*database.DomainInfo{
+		"emotet.example": {Name: "emotet.example", Count: 1, LastSeen: base},
+		"example.org":    {Name: "example.org", Count: 1, LastSeen: base},
+	}
+	anomalies = matcher.Rule().Evaluate(&detection.RuleContext{Profile: profile})
+	if len(anomalies) != 1 || anomalies[0].Evidence["domain"] != "emotet.example" {
+		t.Errorf("Expected one domain match from the profile, got %+v", anomalies)
+	}
+}
+
+func BenchmarkMatchAddr(b *testing.B) {
+	matcher, _ := NewMatcher(nil)
+	tree := newPrefixTree()
+	for i := 0; i < 100000; i++ {
+		prefix := netip.MustParsePrefix(fmt.Sprintf("%d.%d.%d.0/24", 1+i%200, (i/200)%256, i%256))
+		tree.insert(prefix, &Indicator{Value: prefix.String()})
+	}
+	matcher.current.Store(&index{prefixes: tree, domains: map[string]*Indicator{}})
+
+	addr := netip.MustParseAddr("100.100.100.100")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matcher.MatchAddr(addr)
+	}
+}
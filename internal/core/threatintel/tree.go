@@ -0,0 +1,76 @@
+package threatintel
+
+import (
+	"net/netip"
+)
+
+// prefixTree is a binary radix tree over IP address bits. Lookups walk at most
+// 32 (IPv4) or 128 (IPv6) nodes and return the longest matching prefix, so the
+// cost is independent of the number of indicators loaded.
+type prefixTree struct {
+	v4   *treeNode
+	v6   *treeNode
+	size int
+}
+
+type treeNode struct {
+	children  [2]*treeNode
+	indicator *Indicator
+}
+
+func newPrefixTree() *prefixTree {
+	return &prefixTree{
+		v4: &treeNode{},
+		v6: &treeNode{},
+	}
+}
+
+// insert adds a prefix. An existing indicator for the same prefix is kept.
+func (t *prefixTree) insert(prefix netip.Prefix, indicator *Indicator) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr()
+
+	node := t.v6
+	if addr.Is4() {
+		node = t.v4
+	}
+
+	bytes := addr.AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := (bytes[i/8] >> (7 - uint(i%8))) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &treeNode{}
+		}
+		node = node.children[bit]
+	}
+
+	if node.indicator == nil {
+		node.indicator = indicator
+		t.size++
+	}
+}
+
+// lookup returns the indicator of the longest prefix containing addr, or nil
+func (t *prefixTree) lookup(addr netip.Addr) *Indicator {
+	addr = addr.Unmap()
+
+	node := t.v6
+	if addr.Is4() {
+		node = t.v4
+	}
+
+	var match *Indicator
+	bytes := addr.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.indicator != nil {
+			match = node.indicator
+		}
+		if i == len(bytes)*8 {
+			break
+		}
+		bit := (bytes[i/8] >> (7 - uint(i%8))) & 1
+		node = node.children[bit]
+	}
+
+	return match
+}
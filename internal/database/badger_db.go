@@ -11,6 +11,8 @@
 // Data is stored with prefixed keys:
 //   - device:<MAC_ADDRESS>   → JSON-serialized Device struct
 //   - profile:<MAC_ADDRESS>  → JSON-serialized BehavioralProfile struct
+//   - timeseries:<MAC>       → JSON-serialized DeviceTraffic (bucketed history)
+//   - idx:device:<field>:... → Device secondary indexes (see device_index.go)
 //   - meta:config            → System metadata
 //
 // The DatabaseManager provides CRUD operations, batch operations for efficient writes,
@@ -50,6 +52,9 @@ type Device struct {
 	FirstSeen    time.Time `json:"first_seen"`
 	LastSeen     time.Time `json:"last_seen"`
 	IsActive     bool      `json:"is_active"`
+
+	// User-edited inventory details, kept when discovery saves the device
+	Metadata *DeviceMetadata `json:"metadata,omitempty"`
 }
 
 // BehavioralProfile represents aggregated traffic patterns for a device
@@ -67,9 +72,26 @@ type BehavioralProfile struct {
 	// Baseline metrics for anomaly detection
 	Baseline *ProfileBaseline `json:"baseline,omitempty"`
 
+	// Traffic over the most recent hour, refreshed from the device's time series
+	LastHour *TrafficSummary `json:"last_hour,omitempty"`
+
 	// Device-to-device communication (for topology visualization)
 	// Maps destination MAC → packet count (only for local network devices)
 	LocalCommunication map[string]int64 `json:"local_communication,omitempty"`
+
+	// Domains the device looked up, keyed by name, with DNS query counters
+	Domains           map[string]*DomainInfo `json:"domains,omitempty"`
+	DNSQueries        int64                  `json:"dns_queries,omitempty"`
+	NXDomainResponses int64                  `json:"nxdomain_responses,omitempty"`
+
+	// TLS client fingerprints seen in the device's ClientHellos, keyed by JA4
+	TLSClients map[string]*TLSClientInfo `json:"tls_clients,omitempty"`
+
+	// Totals over completed connections (flows), from the device's side
+	Flows              int64   `json:"flows,omitempty"`
+	BytesSent          int64   `json:"bytes_sent,omitempty"`
+	BytesReceived      int64   `json:"bytes_received,omitempty"`
+	LongestFlowSeconds float64 `json:"longest_flow_seconds,omitempty"`
 }
 
 // ProfileBaseline contains rolling baseline metrics for anomaly detection
@@ -101,8 +123,33 @@ type ProfileBaseline struct {
 // DestInfo contains information about a communication destination
 type DestInfo struct {
 	IP       string    `json:"ip"`
+	Domain   string    `json:"domain,omitempty"` // Name the device resolved the IP from, or its TLS SNI
 	Count    int64     `json:"count"`
 	LastSeen time.Time `json:"last_seen"`
+
+	// Volume of completed flows with the destination, from the device's side
+	BytesSent     int64 `json:"bytes_sent,omitempty"`
+	BytesReceived int64 `json:"bytes_received,omitempty"`
+}
+
+// DomainInfo contains information about a domain a device looked up
+type DomainInfo struct {
+	Name      string    `json:"name"`
+	Count     int64     `json:"count"`              // DNS queries for the name
+	NXDomain  int64     `json:"nxdomain,omitempty"` // Responses reporting the name does not exist
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// TLSClientInfo describes a TLS client stack identified by its ClientHello fingerprint
+type TLSClientInfo struct {
+	JA4       string    `json:"ja4"`
+	JA3       string    `json:"ja3"`
+	JA3Hash   string    `json:"ja3_hash"`
+	Count     int64     `json:"count"`
+	SNIs      []string  `json:"snis,omitempty"` // Sample of server names requested with this client
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
 }
 
 // MemoryBuffer provides in-memory storage when database is unavailable
@@ -191,24 +238,15 @@ func (dm *DatabaseManager) SaveDevice(device *Device) error {
 		return fmt.Errorf("device MAC address cannot be empty")
 	}
 
-	// Serialize device to JSON
-	data, err := json.Marshal(device)
-	if err != nil {
-		return errors.Wrap(err, "failed to serialize device %s", device.MAC)
-	}
-
-	// Create key with prefix
-	key := []byte(DevicePrefix + device.MAC)
-
 	// Write to database with retry logic
-	err = errors.RetryWithBackoff("save device", errors.RetryConfig{
+	err := errors.RetryWithBackoff("save device", errors.RetryConfig{
 		MaxAttempts:   3,
 		InitialDelay:  100 * time.Millisecond,
 		MaxDelay:      1 * time.Second,
 		BackoffFactor: 2.0,
 	}, func() error {
 		return dm.db.Update(func(txn *badger.Txn) error {
-			return txn.Set(key, data)
+			return putDevice(txn, device)
 		})
 	})
 
@@ -325,12 +363,16 @@ func (dm *DatabaseManager) DeleteDevice(mac string) error {
 	delete(dm.buffer.devices, mac)
 	dm.buffer.mu.Unlock()
 
-	// Create key with prefix
-	key := []byte(DevicePrefix + mac)
-
-	// Delete from database
+	// Delete from database along with the device's index entries
 	err := dm.db.Update(func(txn *badger.Txn) error {
-		return txn.Delete(key)
+		previous, err := getDevice(txn, mac)
+		if err != nil || previous == nil {
+			return err
+		}
+		if err := applyBatchOps(txn, deviceIndexOps(previous, nil)); err != nil {
+			return err
+		}
+		return txn.Delete([]byte(DevicePrefix + mac))
 	})
 
 	if err != nil && err != badger.ErrKeyNotFound {
@@ -340,6 +382,90 @@ func (dm *DatabaseManager) DeleteDevice(mac string) error {
 	return nil
 }
 
+// QueryDevices returns a page of devices matching the filter using the device index
+func (dm *DatabaseManager) QueryDevices(filter DeviceFilter) (*DevicePage, error) {
+	return QueryDevices(dm, filter)
+}
+
+// QueryAllDevices returns every device matching the filter
+func (dm *DatabaseManager) QueryAllDevices(filter DeviceFilter) (*DevicePage, error) {
+	return QueryAllDevices(dm, filter)
+}
+
+// getDevice reads a device within a transaction, returning nil if it does not exist
+func getDevice(txn *badger.Txn, mac string) (*Device, error) {
+	item, err := txn.Get([]byte(DevicePrefix + mac))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var device Device
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &device)
+	}); err != nil {
+		// An unreadable record has no index entries worth keeping track of
+		return nil, nil
+	}
+	return &device, nil
+}
+
+// putDevice writes a device and updates its index entries within a
+// transaction, keeping the stored metadata
+func putDevice(txn *badger.Txn, device *Device) error {
+	previous, err := getDevice(txn, device.MAC)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		merged := WithMetadata(device, previous.Metadata)
+		device = &merged
+	}
+	return writeDevice(txn, previous, device)
+}
+
+// writeDevice replaces the previous record of a device (nil if new) within a transaction
+func writeDevice(txn *badger.Txn, previous, device *Device) error {
+	data, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("failed to serialize device %s: %w", device.MAC, err)
+	}
+	if err := applyBatchOps(txn, deviceIndexOps(previous, device)); err != nil {
+		return err
+	}
+	return txn.Set([]byte(DevicePrefix+device.MAC), data)
+}
+
+// UpdateDeviceMetadata applies a metadata patch to a stored device and returns the updated device
+func (dm *DatabaseManager) UpdateDeviceMetadata(mac string, patch *DeviceMetadataPatch, user string) (*Device, error) {
+	var device *Device
+	err := dm.db.Update(func(txn *badger.Txn) error {
+		stored, err := getDevice(txn, mac)
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			return ErrDeviceNotFound
+		}
+
+		if device, err = patchDevice(stored, patch, user); err != nil {
+			return err
+		}
+		return writeDevice(txn, stored, device)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// DeviceMetadata returns the metadata of a stored device, or nil if it has none
+func (dm *DatabaseManager) DeviceMetadata(mac string) *DeviceMetadata {
+	return LoadDeviceMetadata(dm, mac)
+}
+
 // SaveProfile persists a behavioral profile to the database with JSON serialization
 func (dm *DatabaseManager) SaveProfile(profile *BehavioralProfile) error {
 	if profile == nil {
@@ -484,17 +610,8 @@ func (dm *DatabaseManager) SaveDeviceBatch(devices []*Device) error {
 				continue
 			}
 
-			// Serialize device to JSON
-			data, err := json.Marshal(device)
-			if err != nil {
-				return fmt.Errorf("failed to serialize device %s: %w", device.MAC, err)
-			}
-
-			// Create key with prefix
-			key := []byte(DevicePrefix + device.MAC)
-
 			// Set in transaction
-			if err := txn.Set(key, data); err != nil {
+			if err := putDevice(txn, device); err != nil {
 				return err
 			}
 		}
@@ -579,13 +696,7 @@ func (dm *DatabaseManager) FlushBuffer() error {
 
 		err := dm.db.Update(func(txn *badger.Txn) error {
 			for _, device := range devices {
-				data, err := json.Marshal(device)
-				if err != nil {
-					return fmt.Errorf("failed to serialize device %s: %w", device.MAC, err)
-				}
-
-				key := []byte(DevicePrefix + device.MAC)
-				if err := txn.Set(key, data); err != nil {
+				if err := putDevice(txn, device); err != nil {
 					return err
 				}
 			}
@@ -0,0 +1,19 @@
+package database
+
+import "time"
+
+// DeviceEventType identifies a device lifecycle transition.
+type DeviceEventType string
+
+const (
+	DeviceEventNew      DeviceEventType = "new"      // First time the device is discovered
+	DeviceEventSeen     DeviceEventType = "seen"     // A known device answered a scan
+	DeviceEventInactive DeviceEventType = "inactive" // Device not seen within the inactive timeout
+)
+
+// DeviceEvent describes a device lifecycle transition observed by discovery.
+type DeviceEvent struct {
+	Type   DeviceEventType
+	Device Device // Snapshot at the time of the event
+	Time   time.Time
+}
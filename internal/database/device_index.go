@@ -0,0 +1,778 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/discovery/classifier"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// Device listings are served from secondary index keys so that filtering,
+// sorting and paging only read the keys of the matching index ranges and the
+// records of the devices on the requested page. Index keys have empty values
+// and end with the device MAC:
+//
+//	idx:device:<field>:<value>\x00<MAC>
+//
+// Times are zero-padded Unix nanoseconds, IPs the hex of their 16-byte form
+// and text lowercased, so keys sort in value order.
+const (
+	DeviceIndexPrefix = "idx:device:"
+
+	// deviceIndexMarker records the index format; a missing or older marker
+	// makes the next query rebuild the index from the device records
+	deviceIndexMarker  = MetaPrefix + "device_index"
+	deviceIndexVersion = "2"
+
+	// deviceIndexBatch bounds the operations per transaction when rebuilding
+	deviceIndexBatch = 1000
+)
+
+// Indexed device fields
+const (
+	DeviceSortLastSeen  = "last_seen"
+	DeviceSortFirstSeen = "first_seen"
+	DeviceSortIP        = "ip"
+	DeviceSortVendor    = "vendor"
+	DeviceSortMAC       = "mac"
+
+	deviceIndexType     = "type"
+	deviceIndexCategory = "category"
+	deviceIndexActive   = "active"
+	deviceIndexTrusted  = "trusted"
+	deviceIndexTag      = "tag" // One entry per tag
+)
+
+// Page sizes for device listings
+const (
+	DefaultDeviceLimit = 100
+	MaxDeviceLimit     = 1000
+)
+
+var deviceIndexFields = []string{
+	DeviceSortLastSeen,
+	DeviceSortFirstSeen,
+	DeviceSortIP,
+	DeviceSortVendor,
+	deviceIndexType,
+	deviceIndexCategory,
+	deviceIndexActive,
+	deviceIndexTrusted,
+	deviceIndexTag,
+}
+
+// deviceFields are the JSON fields of a device that can be selected
+var deviceFields = map[string]bool{
+	"mac": true, "ip": true, "name": true, "vendor": true, "manufacturer": true,
+	"device_type": true, "hostname": true, "services": true,
+	"first_seen": true, "last_seen": true, "is_active": true, "metadata": true,
+}
+
+// indexMu serializes index rebuilds and the read-modify-write of device
+// records on storage providers without transactions, so a discovery save
+// cannot undo a concurrent metadata edit or leave stale index entries
+var indexMu sync.Mutex
+
+// DeviceFilter selects, orders and pages devices
+type DeviceFilter struct {
+	Active     *bool
+	Trusted    *bool
+	Vendors    []string // Case-insensitive, any of
+	Types      []string // Device types, any of
+	Categories []string // Device categories, any of
+	Tags       []string // Case-insensitive, any of
+
+	FirstSeenAfter  time.Time
+	FirstSeenBefore time.Time
+	LastSeenAfter   time.Time
+	LastSeenBefore  time.Time
+
+	Network *net.IPNet // Only devices with an IP in the network
+
+	Sort       string // One of the DeviceSort* fields (default last_seen)
+	Descending bool
+	Cursor     string // NextCursor of the previous page
+	Limit      int    // Page size (default DefaultDeviceLimit, at most MaxDeviceLimit)
+
+	Fields []string // JSON fields to return (default all)
+}
+
+// DevicePage is one page of a device listing
+type DevicePage struct {
+	Devices    []*Device
+	NextCursor string // Empty on the last page
+	Total      int    // Devices matching the filter across all pages
+}
+
+// ParseDeviceFilter builds a device filter from URL query parameters:
+// active, trusted, vendor, type, category, tag, first_seen_after, first_seen_before,
+// last_seen_after, last_seen_before, cidr, sort, order, cursor, limit and
+// fields. List parameters take comma-separated values.
+func ParseDeviceFilter(query url.Values) (DeviceFilter, error) {
+	filter := DeviceFilter{
+		Vendors:    listParam(query, "vendor"),
+		Types:      listParam(query, "type"),
+		Categories: listParam(query, "category"),
+		Tags:       listParam(query, "tag"),
+		Sort:       DeviceSortLastSeen,
+		Cursor:     query.Get("cursor"),
+		Limit:      DefaultDeviceLimit,
+	}
+
+	flags := []struct {
+		name   string
+		target **bool
+	}{
+		{"active", &filter.Active},
+		{"trusted", &filter.Trusted},
+	}
+	for _, flag := range flags {
+		value := query.Get(flag.name)
+		if value == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %s", flag.name, value)
+		}
+		*flag.target = &b
+	}
+
+	times := []struct {
+		name   string
+		target *time.Time
+	}{
+		{"first_seen_after", &filter.FirstSeenAfter},
+		{"first_seen_before", &filter.FirstSeenBefore},
+		{"last_seen_after", &filter.LastSeenAfter},
+		{"last_seen_before", &filter.LastSeenBefore},
+	}
+	for _, param := range times {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s time (expected RFC3339): %s", param.name, value)
+		}
+		*param.target = t
+	}
+
+	if cidr := query.Get("cidr"); cidr != "" {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return filter, fmt.Errorf("invalid cidr: %s", cidr)
+		}
+		filter.Network = network
+	}
+
+	if s := query.Get("sort"); s != "" {
+		switch s {
+		case DeviceSortLastSeen, DeviceSortFirstSeen, DeviceSortIP, DeviceSortVendor, DeviceSortMAC:
+			filter.Sort = s
+		default:
+			return filter, fmt.Errorf("invalid sort: %s", s)
+		}
+	}
+	switch order := query.Get("order"); order {
+	case "":
+		filter.Descending = filter.Sort == DeviceSortLastSeen || filter.Sort == DeviceSortFirstSeen
+	case "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, fmt.Errorf("invalid order (expected asc or desc): %s", order)
+	}
+
+	if _, err := filter.cursorKey(); err != nil {
+		return filter, err
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxDeviceLimit {
+			return filter, fmt.Errorf("invalid limit (expected 1-%d): %s", MaxDeviceLimit, limit)
+		}
+		filter.Limit = n
+	}
+
+	for _, field := range listParam(query, "fields") {
+		if !deviceFields[field] {
+			return filter, fmt.Errorf("unknown field: %s", field)
+		}
+		filter.Fields = append(filter.Fields, field)
+	}
+
+	return filter, nil
+}
+
+// listParam returns the lowercased comma-separated values of a query parameter
+func listParam(query url.Values, name string) []string {
+	var values []string
+	for _, raw := range query[name] {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// Matches reports whether a device passes the filter's conditions
+func (f *DeviceFilter) Matches(device *Device) bool {
+	if f.Active != nil && device.IsActive != *f.Active {
+		return false
+	}
+	if len(f.Vendors) > 0 && !slices.Contains(f.Vendors, deviceIndexValue(DeviceSortVendor, device)) {
+		return false
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, deviceIndexValue(deviceIndexType, device)) {
+		return false
+	}
+	if len(f.Categories) > 0 && !slices.Contains(f.Categories, deviceIndexValue(deviceIndexCategory, device)) {
+		return false
+	}
+	if f.Trusted != nil && (device.Metadata != nil && device.Metadata.Trusted) != *f.Trusted {
+		return false
+	}
+	if len(f.Tags) > 0 && !slices.ContainsFunc(deviceIndexValues(deviceIndexTag, device), func(tag string) bool {
+		return slices.Contains(f.Tags, tag)
+	}) {
+		return false
+	}
+	if !inRange(device.FirstSeen, f.FirstSeenAfter, f.FirstSeenBefore) ||
+		!inRange(device.LastSeen, f.LastSeenAfter, f.LastSeenBefore) {
+		return false
+	}
+	if f.Network != nil {
+		ip := net.ParseIP(device.IP)
+		if ip == nil || !f.Network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// inRange reports whether t is at or after after and before before; zero
+// bounds are open
+func inRange(t, after, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+	return true
+}
+
+// SelectFields returns the record as a map holding only the filter's fields,
+// or the record itself when no fields were selected. The record must encode
+// to a JSON object using the device field names.
+func (f *DeviceFilter) SelectFields(record interface{}) (interface{}, error) {
+	if len(f.Fields) == 0 {
+		return record, nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]json.RawMessage, len(f.Fields))
+	for _, field := range f.Fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
+// sortPrefix returns the key prefix the filter's sort order walks
+func (f *DeviceFilter) sortPrefix() string {
+	if f.Sort == DeviceSortMAC {
+		return DevicePrefix
+	}
+	return DeviceIndexPrefix + f.Sort + ":"
+}
+
+// cursorKey decodes the cursor into the last key of the previous page
+func (f *DeviceFilter) cursorKey() (string, error) {
+	if f.Cursor == "" {
+		return "", nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil || !strings.HasPrefix(string(key), f.sortPrefix()) {
+		return "", fmt.Errorf("invalid cursor for sort %s", f.Sort)
+	}
+	return string(key), nil
+}
+
+// deviceIndexValue returns the indexed value of a device field
+func deviceIndexValue(field string, device *Device) string {
+	switch field {
+	case DeviceSortLastSeen:
+		return timeIndexValue(device.LastSeen)
+	case DeviceSortFirstSeen:
+		return timeIndexValue(device.FirstSeen)
+	case DeviceSortIP:
+		if ip := net.ParseIP(device.IP); ip != nil {
+			return hex.EncodeToString(ip.To16())
+		}
+		return ""
+	case DeviceSortVendor:
+		return strings.ToLower(device.Vendor)
+	case deviceIndexType:
+		return strings.ToLower(device.DeviceType)
+	case deviceIndexCategory:
+		return classifier.DeviceType(strings.ToLower(device.DeviceType)).GetCategory().String()
+	case deviceIndexActive:
+		return strconv.FormatBool(device.IsActive)
+	case deviceIndexTrusted:
+		return strconv.FormatBool(device.Metadata != nil && device.Metadata.Trusted)
+	}
+	return ""
+}
+
+// deviceIndexValues returns the indexed values of a device field
+func deviceIndexValues(field string, device *Device) []string {
+	if field != deviceIndexTag {
+		return []string{deviceIndexValue(field, device)}
+	}
+	if device.Metadata == nil {
+		return nil
+	}
+	tags := make([]string, 0, len(device.Metadata.Tags))
+	for _, tag := range device.Metadata.Tags {
+		tags = append(tags, strings.ToLower(tag))
+	}
+	return tags
+}
+
+func timeIndexValue(t time.Time) string {
+	if t.Unix() <= 0 {
+		return fmt.Sprintf("%020d", 0)
+	}
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+func deviceIndexKey(field, value, mac string) string {
+	return DeviceIndexPrefix + field + ":" + value + "\x00" + mac
+}
+
+// splitIndexKey returns the value and MAC of an index key under prefix
+func splitIndexKey(prefix, key string) (value, mac string, ok bool) {
+	i := strings.LastIndexByte(key, 0)
+	if i < len(prefix) || !strings.HasPrefix(key, prefix) {
+		return "", "", false
+	}
+	return key[len(prefix):i], key[i+1:], true
+}
+
+// deviceSortKey returns the key a device is found under in a sort order
+func deviceSortKey(sortField string, device *Device) string {
+	if sortField == DeviceSortMAC {
+		return DevicePrefix + device.MAC
+	}
+	return deviceIndexKey(sortField, deviceIndexValue(sortField, device), device.MAC)
+}
+
+// deviceIndexKeys returns every index key of a device
+func deviceIndexKeys(device *Device) []string {
+	keys := make([]string, 0, len(deviceIndexFields))
+	for _, field := range deviceIndexFields {
+		for _, value := range deviceIndexValues(field, device) {
+			keys = append(keys, deviceIndexKey(field, value, device.MAC))
+		}
+	}
+	return keys
+}
+
+// deviceIndexOps returns the operations that move a device's index entries
+// from its previous record (nil for a new device) to device (nil when the
+// device is deleted)
+func deviceIndexOps(previous, device *Device) []platform.BatchOp {
+	old := make(map[string]bool)
+	if previous != nil {
+		for _, key := range deviceIndexKeys(previous) {
+			old[key] = true
+		}
+	}
+
+	var ops []platform.BatchOp
+	if device != nil {
+		for _, key := range deviceIndexKeys(device) {
+			if old[key] {
+				delete(old, key)
+				continue
+			}
+			ops = append(ops, platform.BatchOp{Type: platform.BatchOpSet, Key: key, Value: []byte{}})
+		}
+	}
+	for key := range old {
+		ops = append(ops, platform.BatchOp{Type: platform.BatchOpDelete, Key: key})
+	}
+	return ops
+}
+
+// StoreDevice saves a device to a storage provider together with its index
+// entries, keeping the stored metadata
+func StoreDevice(storage platform.StorageProvider, device *Device) error {
+	if device == nil {
+		return fmt.Errorf("device cannot be nil")
+	}
+	if device.MAC == "" {
+		return fmt.Errorf("device MAC address cannot be empty")
+	}
+
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	previous, _ := loadDevice(storage, DevicePrefix+device.MAC)
+	if previous != nil {
+		merged := WithMetadata(device, previous.Metadata)
+		device = &merged
+	}
+	return writeStoredDevice(storage, previous, device)
+}
+
+// writeStoredDevice replaces the previous record of a device (nil if new)
+func writeStoredDevice(storage platform.StorageProvider, previous, device *Device) error {
+	data, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("failed to serialize device %s: %w", device.MAC, err)
+	}
+
+	ops := append(deviceIndexOps(previous, device), platform.BatchOp{
+		Type:  platform.BatchOpSet,
+		Key:   DevicePrefix + device.MAC,
+		Value: data,
+	})
+	return storage.Batch(ops)
+}
+
+func loadDevice(storage platform.StorageProvider, key string) (*Device, error) {
+	data, err := storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var device Device
+	if err := json.Unmarshal(data, &device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// RebuildDeviceIndex recreates the device index from the stored device records
+func RebuildDeviceIndex(storage platform.StorageProvider) error {
+	stale, err := storage.List(DeviceIndexPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list device index: %w", err)
+	}
+	keys, err := storage.List(DevicePrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	ops := make([]platform.BatchOp, 0, len(stale)+len(keys)*len(deviceIndexFields)+1)
+	for _, key := range stale {
+		ops = append(ops, platform.BatchOp{Type: platform.BatchOpDelete, Key: key})
+	}
+	for _, key := range keys {
+		device, err := loadDevice(storage, key)
+		if err != nil {
+			continue
+		}
+		ops = append(ops, deviceIndexOps(nil, device)...)
+	}
+	ops = append(ops, platform.BatchOp{Type: platform.BatchOpSet, Key: deviceIndexMarker, Value: []byte(deviceIndexVersion)})
+
+	for len(ops) > 0 {
+		n := min(len(ops), deviceIndexBatch)
+		if err := storage.Batch(ops[:n]); err != nil {
+			return fmt.Errorf("failed to write device index: %w", err)
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+// ensureDeviceIndex rebuilds the device index when it is missing or outdated
+// and reports whether the storage holds a usable index
+func ensureDeviceIndex(storage platform.StorageProvider) (bool, error) {
+	if marker, err := storage.Get(deviceIndexMarker); err == nil && string(marker) == deviceIndexVersion {
+		return true, nil
+	}
+
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	if marker, err := storage.Get(deviceIndexMarker); err == nil && string(marker) == deviceIndexVersion {
+		return true, nil
+	}
+	if err := RebuildDeviceIndex(storage); err != nil {
+		return false, err
+	}
+
+	// Storage that drops writes cannot hold an index
+	marker, err := storage.Get(deviceIndexMarker)
+	return err == nil && string(marker) == deviceIndexVersion, nil
+}
+
+// QueryDevices returns the page of devices matching the filter. It reads the
+// device index, building it first if needed, and falls back to scanning the
+// device records on storage that cannot hold an index.
+func QueryDevices(storage platform.StorageProvider, filter DeviceFilter) (*DevicePage, error) {
+	if filter.Sort == "" {
+		filter.Sort = DeviceSortLastSeen
+	}
+	if filter.Limit <= 0 || filter.Limit > MaxDeviceLimit {
+		filter.Limit = DefaultDeviceLimit
+	}
+	cursor, err := filter.cursorKey()
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, err := ensureDeviceIndex(storage)
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		return scanDevices(storage, &filter, cursor)
+	}
+
+	candidates, err := filter.candidates(storage)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := storage.List(filter.sortPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device index: %w", err)
+	}
+	sort.Strings(keys)
+
+	total := len(keys)
+	if candidates != nil {
+		total = len(candidates)
+	}
+
+	page := filter.page(keys, cursor, func(key string) *Device {
+		mac := strings.TrimPrefix(key, DevicePrefix)
+		if filter.Sort != DeviceSortMAC {
+			_, mac, _ = splitIndexKey(filter.sortPrefix(), key)
+		}
+		if candidates != nil && !candidates[mac] {
+			return nil
+		}
+		device, err := loadDevice(storage, DevicePrefix+mac)
+		// Entries left behind by a concurrent update no longer match the record
+		if err != nil || deviceSortKey(filter.Sort, device) != key || !filter.Matches(device) {
+			return nil
+		}
+		return device
+	})
+	page.Total = total
+	return page, nil
+}
+
+// QueryAllDevices returns every device matching the filter, following the
+// page cursors from filter.Cursor; the returned page has no NextCursor
+func QueryAllDevices(storage platform.StorageProvider, filter DeviceFilter) (*DevicePage, error) {
+	filter.Limit = MaxDeviceLimit
+	all, err := QueryDevices(storage, filter)
+	if err != nil {
+		return nil, err
+	}
+	for all.NextCursor != "" {
+		filter.Cursor = all.NextCursor
+		page, err := QueryDevices(storage, filter)
+		if err != nil {
+			return nil, err
+		}
+		all.Devices = append(all.Devices, page.Devices...)
+		all.NextCursor = page.NextCursor
+	}
+	return all, nil
+}
+
+// scanDevices answers a query by reading every device record
+func scanDevices(storage platform.StorageProvider, filter *DeviceFilter, cursor string) (*DevicePage, error) {
+	keys, err := storage.List(DevicePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	matched := make(map[string]*Device)
+	sortKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		device, err := loadDevice(storage, key)
+		if err != nil || !filter.Matches(device) {
+			continue
+		}
+		sortKey := deviceSortKey(filter.Sort, device)
+		matched[sortKey] = device
+		sortKeys = append(sortKeys, sortKey)
+	}
+	sort.Strings(sortKeys)
+
+	page := filter.page(sortKeys, cursor, func(key string) *Device { return matched[key] })
+	page.Total = len(matched)
+	return page, nil
+}
+
+// page walks sorted keys in the filter's order from after the cursor and
+// collects up to Limit devices; load returns nil for keys to skip
+func (f *DeviceFilter) page(keys []string, cursor string, load func(key string) *Device) *DevicePage {
+	page := &DevicePage{Devices: make([]*Device, 0, min(f.Limit, len(keys)))}
+
+	i, step := 0, 1
+	if f.Descending {
+		i, step = len(keys)-1, -1
+	}
+	if cursor != "" {
+		i = sort.SearchStrings(keys, cursor)
+		if f.Descending {
+			i--
+		} else if i < len(keys) && keys[i] == cursor {
+			i++
+		}
+	}
+
+	last := ""
+	for ; i >= 0 && i < len(keys); i += step {
+		device := load(keys[i])
+		if device == nil {
+			continue
+		}
+		if len(page.Devices) == f.Limit {
+			page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		page.Devices = append(page.Devices, device)
+		last = keys[i]
+	}
+	return page
+}
+
+// candidates returns the MACs of the devices whose index entries match the
+// filter, or nil when the filter has no conditions
+func (f *DeviceFilter) candidates(storage platform.StorageProvider) (map[string]bool, error) {
+	var set map[string]bool
+	restrict := func(macs map[string]bool) {
+		if set == nil {
+			set = macs
+			return
+		}
+		for mac := range set {
+			if !macs[mac] {
+				delete(set, mac)
+			}
+		}
+	}
+
+	lists := []struct {
+		field  string
+		values []string
+	}{
+		{DeviceSortVendor, f.Vendors},
+		{deviceIndexType, f.Types},
+		{deviceIndexCategory, f.Categories},
+		{deviceIndexTag, f.Tags},
+	}
+	for field, flag := range map[string]*bool{deviceIndexActive: f.Active, deviceIndexTrusted: f.Trusted} {
+		if flag != nil {
+			lists = append(lists, struct {
+				field  string
+				values []string
+			}{field, []string{strconv.FormatBool(*flag)}})
+		}
+	}
+	for _, list := range lists {
+		if len(list.values) == 0 {
+			continue
+		}
+		macs := make(map[string]bool)
+		for _, value := range list.values {
+			if err := scanIndex(storage, list.field, value+"\x00", macs, nil); err != nil {
+				return nil, err
+			}
+		}
+		restrict(macs)
+	}
+
+	ranges := []struct {
+		field         string
+		after, before time.Time
+	}{
+		{DeviceSortFirstSeen, f.FirstSeenAfter, f.FirstSeenBefore},
+		{DeviceSortLastSeen, f.LastSeenAfter, f.LastSeenBefore},
+	}
+	for _, r := range ranges {
+		if r.after.IsZero() && r.before.IsZero() {
+			continue
+		}
+		low, high := "", ""
+		if !r.after.IsZero() {
+			low = timeIndexValue(r.after)
+		}
+		if !r.before.IsZero() {
+			high = timeIndexValue(r.before)
+		}
+		macs := make(map[string]bool)
+		err := scanIndex(storage, r.field, "", macs, func(value string) bool {
+			return value >= low && (high == "" || value < high)
+		})
+		if err != nil {
+			return nil, err
+		}
+		restrict(macs)
+	}
+
+	if f.Network != nil {
+		macs := make(map[string]bool)
+		err := scanIndex(storage, DeviceSortIP, "", macs, func(value string) bool {
+			ip, err := hex.DecodeString(value)
+			return err == nil && len(ip) == net.IPv6len && f.Network.Contains(net.IP(ip))
+		})
+		if err != nil {
+			return nil, err
+		}
+		restrict(macs)
+	}
+
+	return set, nil
+}
+
+// scanIndex adds to macs the devices whose index entries for field start with
+// valuePrefix and whose value passes match (all when match is nil)
+func scanIndex(storage platform.StorageProvider, field, valuePrefix string, macs map[string]bool, match func(value string) bool) error {
+	fieldPrefix := DeviceIndexPrefix + field + ":"
+	keys, err := storage.List(fieldPrefix + valuePrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list device index: %w", err)
+	}
+	for _, key := range keys {
+		value, mac, ok := splitIndexKey(fieldPrefix, key)
+		if ok && (match == nil || match(value)) {
+			macs[mac] = true
+		}
+	}
+	return nil
+}
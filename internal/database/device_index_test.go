@@ -0,0 +1,228 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+func newTestDatabase(t *testing.T) *DatabaseManager {
+	t.Helper()
+	dm, err := NewDatabaseManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { dm.Close() })
+	return dm
+}
+
+func mustParse(t *testing.T, query string) DeviceFilter {
+	t.Helper()
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("Bad query %q: %v", query, err)
+	}
+	filter, err := ParseDeviceFilter(values)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", query, err)
+	}
+	return filter
+}
+
+func queryMACs(t *testing.T, dm *DatabaseManager, query string) []string {
+	t.Helper()
+	page, err := dm.QueryDevices(mustParse(t, query))
+	if err != nil {
+		t.Fatalf("Query %q failed: %v", query, err)
+	}
+	macs := make([]string, 0, len(page.Devices))
+	for _, device := range page.Devices {
+		macs = append(macs, device.MAC)
+	}
+	return macs
+}
+
+func TestQueryDevicesFilters(t *testing.T) {
+	dm := newTestDatabase(t)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	devices := []*Device{
+		{MAC: "aa:00:00:00:00:01", IP: "192.168.1.10", Vendor: "Apple", DeviceType: "phone", FirstSeen: base, LastSeen: base.Add(4 * time.Hour), IsActive: true},
+		{MAC: "aa:00:00:00:00:02", IP: "192.168.1.20", Vendor: "Apple", DeviceType: "laptop", FirstSeen: base, LastSeen: base.Add(1 * time.Hour), IsActive: false},
+		{MAC: "aa:00:00:00:00:03", IP: "10.0.0.5", Vendor: "Philips", DeviceType: "smarthome", FirstSeen: base.Add(48 * time.Hour), LastSeen: base.Add(50 * time.Hour), IsActive: true},
+		{MAC: "aa:00:00:00:00:04", IP: "192.168.2.7", Vendor: "HP", DeviceType: "printer", FirstSeen: base.Add(24 * time.Hour), LastSeen: base.Add(30 * time.Hour), IsActive: true},
+		{MAC: "aa:00:00:00:00:05", IP: "fd00::5", Vendor: "Google", DeviceType: "streaming", FirstSeen: base, LastSeen: base.Add(2 * time.Hour), IsActive: false},
+	}
+	for _, device := range devices {
+		if err := dm.SaveDevice(device); err != nil {
+			t.Fatalf("Failed to save device: %v", err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"aa:00:00:00:00:03", "aa:00:00:00:00:04", "aa:00:00:00:00:01", "aa:00:00:00:00:05", "aa:00:00:00:00:02"}},
+		{"vendor=apple", []string{"aa:00:00:00:00:01", "aa:00:00:00:00:02"}},
+		{"vendor=apple&active=true", []string{"aa:00:00:00:00:01"}},
+		{"type=printer,smarthome&sort=mac", []string{"aa:00:00:00:00:03", "aa:00:00:00:00:04"}},
+		{"category=endpoint&sort=mac", []string{"aa:00:00:00:00:01", "aa:00:00:00:00:02"}},
+		{"cidr=192.168.0.0/16&sort=ip", []string{"aa:00:00:00:00:01", "aa:00:00:00:00:02", "aa:00:00:00:00:04"}},
+		{"cidr=fd00::/8", []string{"aa:00:00:00:00:05"}},
+		{"first_seen_after=2026-03-02T00:00:00Z&order=asc", []string{"aa:00:00:00:00:04", "aa:00:00:00:00:03"}},
+		{"last_seen_before=2026-03-01T14:30:00Z&sort=last_seen&order=asc", []string{"aa:00:00:00:00:02", "aa:00:00:00:00:05"}},
+		{"sort=vendor", []string{"aa:00:00:00:00:01", "aa:00:00:00:00:02", "aa:00:00:00:00:05", "aa:00:00:00:00:04", "aa:00:00:00:00:03"}},
+	}
+	for _, tt := range tests {
+		got := queryMACs(t, dm, tt.query)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Query %q: expected %v, got %v", tt.query, tt.want, got)
+		}
+	}
+
+	// Updates move the device between index entries
+	devices[0].Vendor = "Samsung"
+	devices[0].IsActive = false
+	if err := dm.SaveDevice(devices[0]); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+	if got := queryMACs(t, dm, "vendor=apple"); fmt.Sprint(got) != "[aa:00:00:00:00:02]" {
+		t.Errorf("Expected the updated device to leave the Apple index, got %v", got)
+	}
+	if got := queryMACs(t, dm, "active=false&sort=mac"); len(got) != 3 {
+		t.Errorf("Expected 3 inactive devices, got %v", got)
+	}
+
+	if err := dm.DeleteDevice(devices[3].MAC); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+	if got := queryMACs(t, dm, "type=printer"); len(got) != 0 {
+		t.Errorf("Expected the deleted device to leave the index, got %v", got)
+	}
+	want := 0
+	for _, device := range []*Device{devices[0], devices[1], devices[2], devices[4]} {
+		want += len(deviceIndexKeys(device))
+	}
+	if keys, _ := dm.List(DeviceIndexPrefix); len(keys) != want {
+		t.Errorf("Expected %d index entries, got %d", want, len(keys))
+	}
+}
+
+func TestQueryDevicesPaging(t *testing.T) {
+	dm := newTestDatabase(t)
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var batch []*Device
+	for i := 0; i < 25; i++ {
+		batch = append(batch, &Device{
+			MAC:       fmt.Sprintf("bb:00:00:00:00:%02x", i),
+			IP:        fmt.Sprintf("192.168.1.%d", i+1),
+			FirstSeen: base,
+			LastSeen:  base.Add(time.Duration(i) * time.Minute),
+			IsActive:  i%2 == 0,
+		})
+	}
+	if err := dm.SaveDeviceBatch(batch); err != nil {
+		t.Fatalf("Failed to save devices: %v", err)
+	}
+
+	for _, query := range []string{"limit=10", "limit=4&active=true", "limit=7&sort=ip&order=desc"} {
+		filter := mustParse(t, query)
+		seen := make(map[string]bool)
+		var previous *Device
+		pages := 0
+		for {
+			page, err := dm.QueryDevices(filter)
+			if err != nil {
+				t.Fatalf("Query %q failed: %v", query, err)
+			}
+			pages++
+			for _, device := range page.Devices {
+				if seen[device.MAC] {
+					t.Errorf("Query %q: device %s returned twice", query, device.MAC)
+				}
+				seen[device.MAC] = true
+				if previous != nil && filter.Sort == DeviceSortLastSeen && device.LastSeen.After(previous.LastSeen) {
+					t.Errorf("Query %q: devices out of order", query)
+				}
+				previous = device
+			}
+			if page.NextCursor == "" {
+				if len(seen) != page.Total {
+					t.Errorf("Query %q: got %d devices, total %d", query, len(seen), page.Total)
+				}
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+
+		want := 25
+		if filter.Active != nil {
+			want = 13
+		}
+		if len(seen) != want {
+			t.Errorf("Query %q: expected %d devices, got %d", query, want, len(seen))
+		}
+		if wantPages := (want + filter.Limit - 1) / filter.Limit; pages != wantPages {
+			t.Errorf("Query %q: expected %d pages, got %d", query, wantPages, pages)
+		}
+	}
+
+	// A cursor from another sort order is rejected
+	page, _ := dm.QueryDevices(mustParse(t, "limit=5"))
+	if _, err := ParseDeviceFilter(url.Values{"cursor": {page.NextCursor}, "sort": {"ip"}}); err == nil {
+		t.Error("Expected an error for a cursor from another sort order")
+	}
+}
+
+func TestDeviceIndexRebuild(t *testing.T) {
+	storage := mocks.NewMockStorageProvider()
+	storage.Open("", nil)
+
+	// Records written before the index existed
+	for i, vendor := range []string{"Apple", "Dell", "Apple"} {
+		device := &Device{MAC: fmt.Sprintf("cc:00:00:00:00:%02x", i), Vendor: vendor, LastSeen: time.Now()}
+		data, _ := json.Marshal(device)
+		storage.Set(DevicePrefix+device.MAC, data)
+	}
+
+	page, err := QueryDevices(storage, mustParse(t, "vendor=apple&fields=mac,vendor"))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if page.Total != 2 || len(page.Devices) != 2 {
+		t.Fatalf("Expected 2 Apple devices, got %d (total %d)", len(page.Devices), page.Total)
+	}
+	if keys, _ := storage.List(DeviceIndexPrefix); len(keys) != 3*(len(deviceIndexFields)-1) {
+		t.Errorf("Expected the index to be built, got %d entries", len(keys))
+	}
+
+	filter := mustParse(t, "fields=mac,vendor")
+	selected, err := filter.SelectFields(page.Devices[0])
+	if err != nil {
+		t.Fatalf("SelectFields failed: %v", err)
+	}
+	if fields := selected.(map[string]json.RawMessage); len(fields) != 2 || fields["mac"] == nil {
+		t.Errorf("Expected only mac and vendor, got %v", fields)
+	}
+
+	// New writes keep the index current
+	if err := StoreDevice(storage, &Device{MAC: "cc:00:00:00:00:09", Vendor: "apple", LastSeen: time.Now()}); err != nil {
+		t.Fatalf("Failed to store device: %v", err)
+	}
+	if page, _ := QueryDevices(storage, mustParse(t, "vendor=Apple")); page.Total != 3 {
+		t.Errorf("Expected 3 Apple devices, got %d", page.Total)
+	}
+
+	for _, query := range []string{"active=maybe", "cidr=10.0.0.0", "sort=name", "order=up", "limit=0", "limit=5000", "fields=password", "cursor=not-a-cursor", "last_seen_after=yesterday"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseDeviceFilter(values); err == nil {
+			t.Errorf("Expected an error for %q", query)
+		}
+	}
+}
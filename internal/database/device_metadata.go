@@ -0,0 +1,177 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/discovery/classifier"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// Limits on user-edited device metadata
+const (
+	MaxMetadataTextLength  = 128
+	MaxMetadataNotesLength = 4096
+	MaxMetadataTags        = 32
+)
+
+// Errors returned when updating device metadata
+var (
+	ErrDeviceNotFound  = errors.New("device not found")
+	ErrInvalidMetadata = errors.New("invalid device metadata")
+)
+
+// DeviceMetadata holds the inventory details users keep about a device.
+// Discovery never changes it: saving a device keeps the stored metadata, and
+// only UpdateDeviceMetadata writes it.
+type DeviceMetadata struct {
+	Label      string    `json:"label,omitempty"` // Friendly name shown instead of the discovered name
+	Owner      string    `json:"owner,omitempty"`
+	Location   string    `json:"location,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Notes      string    `json:"notes,omitempty"`
+	Trusted    bool      `json:"trusted,omitempty"`     // Approved to be on the network
+	DeviceType string    `json:"device_type,omitempty"` // Manual type, used instead of the classifier's
+	UpdatedAt  time.Time `json:"updated_at"`
+	UpdatedBy  string    `json:"updated_by,omitempty"`
+}
+
+// DeviceMetadataPatch changes the metadata fields it sets; an empty string or
+// list clears a field
+type DeviceMetadataPatch struct {
+	Label      *string   `json:"label"`
+	Owner      *string   `json:"owner"`
+	Location   *string   `json:"location"`
+	Tags       *[]string `json:"tags"`
+	Notes      *string   `json:"notes"`
+	Trusted    *bool     `json:"trusted"`
+	DeviceType *string   `json:"device_type"`
+}
+
+// Apply validates the patch and applies it to metadata
+func (p *DeviceMetadataPatch) Apply(metadata *DeviceMetadata) error {
+	texts := []struct {
+		name   string
+		value  *string
+		target *string
+		limit  int
+	}{
+		{"label", p.Label, &metadata.Label, MaxMetadataTextLength},
+		{"owner", p.Owner, &metadata.Owner, MaxMetadataTextLength},
+		{"location", p.Location, &metadata.Location, MaxMetadataTextLength},
+		{"notes", p.Notes, &metadata.Notes, MaxMetadataNotesLength},
+	}
+	for _, text := range texts {
+		if text.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*text.value)
+		if utf8.RuneCountInString(value) > text.limit {
+			return fmt.Errorf("%s is longer than %d characters", text.name, text.limit)
+		}
+		*text.target = value
+	}
+
+	if p.Tags != nil {
+		tags := make([]string, 0, len(*p.Tags))
+		for _, tag := range *p.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || slices.Contains(tags, tag) {
+				continue
+			}
+			if utf8.RuneCountInString(tag) > MaxMetadataTextLength || strings.Contains(tag, ",") {
+				return fmt.Errorf("invalid tag: %q", tag)
+			}
+			tags = append(tags, tag)
+		}
+		if len(tags) > MaxMetadataTags {
+			return fmt.Errorf("at most %d tags are allowed", MaxMetadataTags)
+		}
+		metadata.Tags = tags
+	}
+
+	if p.Trusted != nil {
+		metadata.Trusted = *p.Trusted
+	}
+
+	if p.DeviceType != nil {
+		deviceType := strings.ToLower(strings.TrimSpace(*p.DeviceType))
+		// Every type other than unknown belongs to a category
+		known := classifier.DeviceType(deviceType).GetCategory() != classifier.CategoryUnknown
+		if deviceType != "" && !known {
+			return fmt.Errorf("unknown device type: %s", *p.DeviceType)
+		}
+		metadata.DeviceType = deviceType
+	}
+
+	return nil
+}
+
+// WithMetadata returns a copy of the device carrying metadata, with the
+// manual device type in place of the classified one
+func WithMetadata(device *Device, metadata *DeviceMetadata) Device {
+	merged := *device
+	merged.Metadata = metadata
+	if metadata != nil && metadata.DeviceType != "" {
+		merged.DeviceType = metadata.DeviceType
+	}
+	return merged
+}
+
+// patchDevice returns the stored device with a metadata patch applied
+func patchDevice(stored *Device, patch *DeviceMetadataPatch, user string) (*Device, error) {
+	metadata := &DeviceMetadata{}
+	if stored.Metadata != nil {
+		*metadata = *stored.Metadata
+		metadata.Tags = slices.Clone(stored.Metadata.Tags)
+	}
+	override := metadata.DeviceType
+
+	if err := patch.Apply(metadata); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+	metadata.UpdatedAt = time.Now()
+	metadata.UpdatedBy = user
+
+	device := WithMetadata(stored, metadata)
+	if override != "" && metadata.DeviceType == "" {
+		// Let discovery classify the device again
+		device.DeviceType = ""
+	}
+	return &device, nil
+}
+
+// UpdateDeviceMetadata applies a metadata patch to a device in a storage
+// provider and returns the updated device
+func UpdateDeviceMetadata(storage platform.StorageProvider, mac string, patch *DeviceMetadataPatch, user string) (*Device, error) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	stored, err := loadDevice(storage, DevicePrefix+mac)
+	if err != nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	device, err := patchDevice(stored, patch, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeStoredDevice(storage, stored, device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// LoadDeviceMetadata returns the metadata of a device in a storage provider,
+// or nil if it has none
+func LoadDeviceMetadata(storage platform.StorageProvider, mac string) *DeviceMetadata {
+	device, err := loadDevice(storage, DevicePrefix+mac)
+	if err != nil {
+		return nil
+	}
+	return device.Metadata
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestDeviceMetadataSurvivesDiscovery(t *testing.T) {
+	dm := newTestDatabase(t)
+	discovered := &Device{MAC: "dd:00:00:00:00:01", IP: "192.168.1.50", DeviceType: "computer", LastSeen: time.Now(), IsActive: true}
+	if err := dm.SaveDevice(discovered); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	trusted := true
+	tags := []string{" finance ", "Laptops", "finance"}
+	device, err := dm.UpdateDeviceMetadata(discovered.MAC, &DeviceMetadataPatch{
+		Label:      strPtr("Reception PC"),
+		Owner:      strPtr("Front desk"),
+		Tags:       &tags,
+		Trusted:    &trusted,
+		DeviceType: strPtr("Server"),
+	}, "admin")
+	if err != nil {
+		t.Fatalf("Failed to update metadata: %v", err)
+	}
+	if device.DeviceType != "server" || device.Metadata.UpdatedBy != "admin" {
+		t.Errorf("Expected the manual type and editor, got %q and %q", device.DeviceType, device.Metadata.UpdatedBy)
+	}
+	if len(device.Metadata.Tags) != 2 || device.Metadata.Tags[0] != "finance" {
+		t.Errorf("Expected trimmed, deduplicated tags, got %v", device.Metadata.Tags)
+	}
+
+	// A discovery refresh carries no metadata and the classified type
+	discovered.IP = "192.168.1.51"
+	if err := dm.SaveDevice(discovered); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	stored, _ := dm.GetDevice(discovered.MAC)
+	if stored.IP != "192.168.1.51" || stored.Metadata == nil || stored.Metadata.Label != "Reception PC" {
+		t.Fatalf("Expected the refresh to keep the metadata, got %+v", stored)
+	}
+	if stored.DeviceType != "server" {
+		t.Errorf("Expected the manual type to survive the refresh, got %q", stored.DeviceType)
+	}
+	if got := queryMACs(t, dm, "tag=laptops&trusted=true&type=server"); len(got) != 1 {
+		t.Errorf("Expected the device to be found by tag, trust and manual type, got %v", got)
+	}
+
+	// Clearing the manual type leaves the device for discovery to classify
+	device, err = dm.UpdateDeviceMetadata(discovered.MAC, &DeviceMetadataPatch{DeviceType: strPtr("")}, "admin")
+	if err != nil {
+		t.Fatalf("Failed to clear the type: %v", err)
+	}
+	if device.DeviceType != "" || device.Metadata.Label != "Reception PC" {
+		t.Errorf("Expected the type cleared and the label kept, got %q and %q", device.DeviceType, device.Metadata.Label)
+	}
+
+	if _, err := dm.UpdateDeviceMetadata("dd:00:00:00:00:99", &DeviceMetadataPatch{}, ""); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+	for _, patch := range []*DeviceMetadataPatch{
+		{DeviceType: strPtr("toaster")},
+		{Label: strPtr(strings.Repeat("x", MaxMetadataTextLength+1))},
+		{Tags: &[]string{"a,b"}},
+	} {
+		if _, err := dm.UpdateDeviceMetadata(discovered.MAC, patch, ""); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("Expected ErrInvalidMetadata for %+v, got %v", patch, err)
+		}
+	}
+}
+
+// slowReadStorage pauses the first read of a key so another writer can run
+// between a read and the write that follows it
+type slowReadStorage struct {
+	platform.StorageProvider
+	key     string
+	reading chan struct{}
+	once    sync.Once
+}
+
+func (s *slowReadStorage) Get(key string) ([]byte, error) {
+	data, err := s.StorageProvider.Get(key)
+	if key == s.key {
+		s.once.Do(func() {
+			close(s.reading)
+			time.Sleep(100 * time.Millisecond)
+		})
+	}
+	return data, err
+}
+
+func TestDeviceMetadataSurvivesConcurrentDiscovery(t *testing.T) {
+	storage := mocks.NewMockStorageProvider()
+	storage.Open("", nil)
+	device := &Device{MAC: "dd:00:00:00:00:02", IP: "192.168.1.60", LastSeen: time.Now()}
+	if err := StoreDevice(storage, device); err != nil {
+		t.Fatalf("Failed to store device: %v", err)
+	}
+
+	slow := &slowReadStorage{StorageProvider: storage, key: DevicePrefix + device.MAC, reading: make(chan struct{})}
+	refreshed := make(chan error, 1)
+	go func() {
+		refresh := *device
+		refresh.IP = "192.168.1.61"
+		refreshed <- StoreDevice(slow, &refresh)
+	}()
+
+	// The discovery save has read the record; the edit must not be lost when it writes
+	<-slow.reading
+	if _, err := UpdateDeviceMetadata(storage, device.MAC, &DeviceMetadataPatch{Label: strPtr("Lab printer")}, "admin"); err != nil {
+		t.Fatalf("Failed to update metadata: %v", err)
+	}
+	if err := <-refreshed; err != nil {
+		t.Fatalf("Failed to store device: %v", err)
+	}
+
+	stored, err := loadDevice(storage, DevicePrefix+device.MAC)
+	if err != nil {
+		t.Fatalf("Failed to load device: %v", err)
+	}
+	if stored.Metadata == nil || stored.Metadata.Label != "Lab printer" {
+		t.Errorf("Expected the concurrent edit to be kept, got %+v", stored.Metadata)
+	}
+	if stored.IP != "192.168.1.61" {
+		t.Errorf("Expected the discovery refresh to be kept, got %s", stored.IP)
+	}
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// DatabaseManager also implements platform.StorageProvider so the shared core
+// components (profiler, replay, stores) can run on top of the hardware database.
+var _ platform.StorageProvider = (*DatabaseManager)(nil)
+
+// Open satisfies platform.StorageProvider. The database is opened by
+// NewDatabaseManager, so Open only verifies that it is still available.
+func (dm *DatabaseManager) Open(path string, options *platform.StorageOptions) error {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	if dm.db == nil || dm.db.IsClosed() {
+		return fmt.Errorf("database at %s is closed", dm.path)
+	}
+	return nil
+}
+
+// Get retrieves a raw value by key
+func (dm *DatabaseManager) Get(key string) ([]byte, error) {
+	var value []byte
+	err := dm.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, fmt.Errorf("key not found: %s", key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key %s: %w", key, err)
+	}
+
+	return value, nil
+}
+
+// Set stores a raw value with the given key
+func (dm *DatabaseManager) Set(key string, value []byte) error {
+	err := dm.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), value)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set key %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete removes a key-value pair
+func (dm *DatabaseManager) Delete(key string) error {
+	err := dm.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		return fmt.Errorf("failed to delete key %s: %w", key, err)
+	}
+	return nil
+}
+
+// List returns all keys matching the prefix
+func (dm *DatabaseManager) List(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	prefixBytes := []byte(prefix)
+
+	err := dm.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false // We only need keys
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefixBytes); it.ValidForPrefix(prefixBytes); it.Next() {
+			keys = append(keys, string(it.Item().KeyCopy(nil)))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys with prefix %s: %w", prefix, err)
+	}
+
+	return keys, nil
+}
+
+// Batch performs multiple operations atomically
+func (dm *DatabaseManager) Batch(ops []platform.BatchOp) error {
+	return dm.db.Update(func(txn *badger.Txn) error {
+		return applyBatchOps(txn, ops)
+	})
+}
+
+// applyBatchOps performs batch operations within a transaction
+func applyBatchOps(txn *badger.Txn, ops []platform.BatchOp) error {
+	for _, op := range ops {
+		switch op.Type {
+		case platform.BatchOpSet:
+			if err := txn.Set([]byte(op.Key), op.Value); err != nil {
+				return fmt.Errorf("batch set failed for key %s: %w", op.Key, err)
+			}
+		case platform.BatchOpDelete:
+			if err := txn.Delete([]byte(op.Key)); err != nil {
+				return fmt.Errorf("batch delete failed for key %s: %w", op.Key, err)
+			}
+		default:
+			return fmt.Errorf("unknown batch operation type: %v", op.Type)
+		}
+	}
+	return nil
+}
+
+// GetDatabaseSize returns the approximate size of the database in bytes
+func (dm *DatabaseManager) GetDatabaseSize() (int64, error) {
+	if dm.db == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	lsm, vlog := dm.db.Size()
+	return lsm + vlog, nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import "time"
+
+// TimeSeriesPrefix is the storage key prefix for bucketed device traffic
+const TimeSeriesPrefix = "timeseries:"
+
+// TrafficBucket aggregates a device's traffic over one fixed-width interval
+type TrafficBucket struct {
+	Start        time.Time        `json:"start"`
+	Packets      int64            `json:"packets"`
+	Bytes        int64            `json:"bytes"`
+	Destinations map[string]int64 `json:"destinations,omitempty"`
+	Ports        map[uint16]int64 `json:"ports,omitempty"`
+	Protocols    map[string]int64 `json:"protocols,omitempty"`
+
+	// DroppedKeys counts destinations/ports not tracked because the bucket was full
+	DroppedKeys int64 `json:"dropped_keys,omitempty"`
+}
+
+// TrafficSeries is one resolution of a device's traffic history
+type TrafficSeries struct {
+	Width     time.Duration    `json:"width"`
+	Retention time.Duration    `json:"retention"`
+	Buckets   []*TrafficBucket `json:"buckets"` // Oldest first
+}
+
+// DeviceTraffic holds a device's traffic history at every tracked resolution
+type DeviceTraffic struct {
+	MAC    string           `json:"mac"`
+	Series []*TrafficSeries `json:"series"` // Finest resolution first
+}
+
+// TrafficSummary contains aggregate traffic counters for a time window
+type TrafficSummary struct {
+	Start              time.Time `json:"start"`
+	End                time.Time `json:"end"`
+	Packets            int64     `json:"packets"`
+	Bytes              int64     `json:"bytes"`
+	UniqueDestinations int       `json:"unique_destinations"`
+	UniquePorts        int       `json:"unique_ports"`
+}
+
+// TrafficWindow is the result of a time-window traffic query
+type TrafficWindow struct {
+	TrafficSummary
+	MAC        string           `json:"mac"`
+	Resolution time.Duration    `json:"resolution"`
+	Protocols  map[string]int64 `json:"protocols"`
+	Buckets    []*TrafficBucket `json:"buckets"`
+}
@@ -10,9 +10,13 @@
 //   - Network: Interface selection and auto-detection
 //   - Discovery: Device discovery settings
 //   - Interceptor: Traffic interception settings (Pro tier)
-//   - Detection: Anomaly detection sensitivity
+//   - Detection: Anomaly detection sensitivity and device lifecycle rules
 //   - Visualizer: Local dashboard settings
+//   - Recorder: Per-device rolling pcap recording limits
+//   - ThreatIntel: Indicator feeds matched against destinations
+//   - Syslog: Alert forwarding to a SIEM (optional)
 //   - SystemTray: System tray integration settings
+//   - Notifications: Routing rules, quiet hours and digests for alerts
 //   - FeatureGate: Tier and license configuration
 //   - Cloud: Cloud connectivity settings (optional)
 //   - Logging: Log level and file path
@@ -25,6 +29,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -34,16 +39,20 @@ import (
 
 // DesktopConfig represents the complete desktop agent configuration
 type DesktopConfig struct {
-	Database    DatabaseConfig    `json:"database"`
-	Network     NetworkConfig     `json:"network"`
-	Discovery   DiscoveryConfig   `json:"discovery"`
-	Interceptor InterceptorConfig `json:"interceptor"`
-	Detection   DetectionConfig   `json:"detection"`
-	Visualizer  VisualizerConfig  `json:"visualizer"`
-	SystemTray  SystemTrayConfig  `json:"system_tray"`
-	FeatureGate FeatureGateConfig `json:"feature_gate"`
-	Cloud       CloudConfig       `json:"cloud"`
-	Logging     LoggingConfig     `json:"logging"`
+	Database      DatabaseConfig      `json:"database"`
+	Network       NetworkConfig       `json:"network"`
+	Discovery     DiscoveryConfig     `json:"discovery"`
+	Interceptor   InterceptorConfig   `json:"interceptor"`
+	Detection     DetectionConfig     `json:"detection"`
+	Visualizer    VisualizerConfig    `json:"visualizer"`
+	Recorder      RecorderConfig      `json:"recorder"`
+	ThreatIntel   ThreatIntelConfig   `json:"threat_intel"`
+	Syslog        SyslogConfig        `json:"syslog"`
+	SystemTray    SystemTrayConfig    `json:"system_tray"`
+	Notifications NotificationsConfig `json:"notifications"`
+	FeatureGate   FeatureGateConfig   `json:"feature_gate"`
+	Cloud         CloudConfig         `json:"cloud"`
+	Logging       LoggingConfig       `json:"logging"`
 
 	// Internal fields
 	configPath string
@@ -78,14 +87,90 @@ type InterceptorConfig struct {
 
 // DetectionConfig contains anomaly detection settings
 type DetectionConfig struct {
-	Enabled     bool    `json:"enabled"`
-	Sensitivity float64 `json:"sensitivity"` // 0.0 to 1.0
+	Enabled       bool                `json:"enabled"`
+	Sensitivity   float64             `json:"sensitivity"` // 0.0 to 1.0
+	NewDevice     NewDeviceRuleConfig `json:"new_device"`
+	DormantDevice DormantRuleConfig   `json:"dormant_device"`
+	RulesFile     string              `json:"rules_file"` // Optional YAML/JSON rule file, reloaded on change
+}
+
+// NewDeviceRuleConfig controls anomalies for devices joining the network
+type NewDeviceRuleConfig struct {
+	Enabled               bool `json:"enabled"`
+	BusinessHoursStart    int  `json:"business_hours_start"` // Local hour, 0-23
+	BusinessHoursEnd      int  `json:"business_hours_end"`   // Local hour, 0-23
+	BusinessDaysOnly      bool `json:"business_days_only"`   // Weekends count as outside hours
+	LearningPeriodMinutes int  `json:"learning_period_minutes"`
+}
+
+// DormantRuleConfig controls anomalies for always-on devices going dark
+type DormantRuleConfig struct {
+	Enabled      bool     `json:"enabled"`
+	AfterMinutes int      `json:"after_minutes"`
+	DeviceTypes  []string `json:"device_types"` // Classifier types expected to be always on
+	Devices      []string `json:"devices"`      // Additional MAC addresses expected to be always on
 }
 
 // VisualizerConfig contains local dashboard settings
 type VisualizerConfig struct {
-	Enabled bool `json:"enabled"`
-	Port    int  `json:"port"`
+	Enabled bool       `json:"enabled"`
+	Port    int        `json:"port"`
+	Auth    AuthConfig `json:"auth"`
+	TLS     TLSConfig  `json:"tls"`
+}
+
+// TLSConfig contains HTTPS settings for the dashboard
+type TLSConfig struct {
+	Enabled   bool     `json:"enabled"`
+	CertFile  string   `json:"cert_file,omitempty"` // User-supplied certificate (PEM); a local CA issues one when empty
+	KeyFile   string   `json:"key_file,omitempty"`  // Key for cert_file
+	Directory string   `json:"directory"`           // Generated CA and certificate
+	Hostnames []string `json:"hostnames,omitempty"` // Extra names or addresses for the generated certificate
+	HSTS      bool     `json:"hsts"`                // Send Strict-Transport-Security, remembered for a day
+}
+
+// AuthConfig contains dashboard and API authentication settings
+type AuthConfig struct {
+	Enabled             bool   `json:"enabled"`
+	SessionHours        int    `json:"session_hours"`         // Dashboard session lifetime (default: 12)
+	InitialPasswordFile string `json:"initial_password_file"` // Where the generated admin password is written on first start
+}
+
+// SyslogConfig contains settings for forwarding alerts to a SIEM as CEF or
+// LEEF over syslog
+type SyslogConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Address      string `json:"address"`                // host:port of the syslog receiver
+	Protocol     string `json:"protocol"`               // "udp", "tcp" or "tls"
+	Format       string `json:"format"`                 // "cef" or "leef"
+	CAPath       string `json:"ca_path,omitempty"`      // CA bundle for verifying a TLS receiver
+	Facility     int    `json:"facility,omitempty"`     // Syslog facility (0 = 4, security/authorization)
+	MinSeverity  string `json:"min_severity,omitempty"` // Lowest anomaly severity forwarded
+	DeviceEvents bool   `json:"device_events"`          // Also forward devices joining and going inactive
+}
+
+// ThreatIntelConfig contains threat-intelligence feed settings
+type ThreatIntelConfig struct {
+	Enabled        bool               `json:"enabled"`
+	RefreshMinutes int                `json:"refresh_minutes"` // How often feed files are re-read (0 = load once)
+	Feeds          []ThreatFeedConfig `json:"feeds"`
+}
+
+// ThreatFeedConfig describes a local indicator feed file
+type ThreatFeedConfig struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Format   string `json:"format"`   // "plain", "csv" or "stix" (default: from file extension)
+	Severity string `json:"severity"` // Severity of matches (default: "high")
+}
+
+// RecorderConfig contains per-device packet recording settings
+type RecorderConfig struct {
+	Enabled           bool   `json:"enabled"`
+	Directory         string `json:"directory"`
+	MaxFileSizeMB     int    `json:"max_file_size_mb"`
+	MaxFileAgeMinutes int    `json:"max_file_age_minutes"`
+	MaxFilesPerDevice int    `json:"max_files_per_device"`
 }
 
 // SystemTrayConfig contains system tray integration settings
@@ -94,6 +179,57 @@ type SystemTrayConfig struct {
 	AutoStart bool `json:"auto_start"`
 }
 
+// NotificationsConfig contains the notification policy: which anomalies reach
+// which channels, and when
+type NotificationsConfig struct {
+	Enabled bool                      `json:"enabled"` // When disabled, every anomaly shows a tray popup
+	Tray    NotificationChannelConfig `json:"tray"`
+	Email   EmailNotificationConfig   `json:"email"`
+	Webhook WebhookNotificationConfig `json:"webhook"`
+	Syslog  NotificationChannelConfig `json:"syslog"` // Sends to the receiver in the syslog section
+	Rules   []NotificationRuleConfig  `json:"rules"`
+}
+
+// NotificationChannelConfig contains the delivery policy of a channel
+type NotificationChannelConfig struct {
+	Enabled          bool   `json:"enabled"`
+	QuietHoursStart  string `json:"quiet_hours_start,omitempty"`  // "HH:MM" local time
+	QuietHoursEnd    string `json:"quiet_hours_end,omitempty"`    // "HH:MM" local time
+	QuietHoursBypass string `json:"quiet_hours_bypass,omitempty"` // Severity still delivered during quiet hours (default: critical)
+	MaxPerHour       int    `json:"max_per_hour,omitempty"`       // 0 = unlimited; the rest wait for the digest
+	DigestMinutes    int    `json:"digest_minutes,omitempty"`     // Digest interval (default: 60)
+}
+
+// EmailNotificationConfig contains SMTP settings for email notifications
+type EmailNotificationConfig struct {
+	NotificationChannelConfig
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// WebhookNotificationConfig contains settings for webhook notifications
+type WebhookNotificationConfig struct {
+	NotificationChannelConfig
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // Signs requests like the cloud webhook transport
+}
+
+// NotificationRuleConfig routes matching anomalies to channels. Rules are
+// evaluated in order and the first match wins.
+type NotificationRuleConfig struct {
+	Name        string   `json:"name"`
+	MinSeverity string   `json:"min_severity,omitempty"`
+	Types       []string `json:"types,omitempty"`        // Anomaly types
+	Devices     []string `json:"devices,omitempty"`      // Device MAC addresses
+	DeviceTypes []string `json:"device_types,omitempty"` // Device categories
+	Channels    []string `json:"channels"`               // Empty mutes matching anomalies
+	Digest      bool     `json:"digest,omitempty"`       // Only include matches in digests
+}
+
 // FeatureGateConfig contains tier and licensing settings
 type FeatureGateConfig struct {
 	Tier       string `json:"tier"`        // "free", "pro", "enterprise"
@@ -271,15 +407,64 @@ func DefaultConfig() (*DesktopConfig, error) {
 		Detection: DetectionConfig{
 			Enabled:     true,
 			Sensitivity: 0.7,
+			NewDevice: NewDeviceRuleConfig{
+				Enabled:               true,
+				BusinessHoursStart:    8,
+				BusinessHoursEnd:      18,
+				BusinessDaysOnly:      false,
+				LearningPeriodMinutes: 10,
+			},
+			DormantDevice: DormantRuleConfig{
+				Enabled:      true,
+				AfterMinutes: 30,
+				DeviceTypes:  []string{"camera", "iot", "smarthome", "nas", "router"},
+				Devices:      []string{},
+			},
+			RulesFile: "",
 		},
 		Visualizer: VisualizerConfig{
 			Enabled: true,
 			Port:    8080,
+			Auth: AuthConfig{
+				Enabled:             true,
+				SessionHours:        12,
+				InitialPasswordFile: filepath.Join(filepath.Dir(dbPath), "initial-admin-password"),
+			},
+			TLS: TLSConfig{
+				Enabled:   true,
+				Directory: filepath.Join(filepath.Dir(dbPath), "tls"),
+				HSTS:      false, // Would also force HTTPS on other local servers at localhost
+			},
+		},
+		Recorder: RecorderConfig{
+			Enabled:           true,
+			Directory:         filepath.Join(filepath.Dir(dbPath), "recordings"),
+			MaxFileSizeMB:     10,
+			MaxFileAgeMinutes: 15,
+			MaxFilesPerDevice: 5,
+		},
+		ThreatIntel: ThreatIntelConfig{
+			Enabled:        false,
+			RefreshMinutes: 60,
+			Feeds:          []ThreatFeedConfig{},
+		},
+		Syslog: SyslogConfig{
+			Enabled:  false,
+			Protocol: "udp",
+			Format:   "cef",
 		},
 		SystemTray: SystemTrayConfig{
 			Enabled:   true,
 			AutoStart: false,
 		},
+		Notifications: NotificationsConfig{
+			Enabled: false,
+			Tray:    NotificationChannelConfig{Enabled: true},
+			Email:   EmailNotificationConfig{Port: 587},
+			Rules: []NotificationRuleConfig{
+				{Name: "all", Channels: []string{"tray"}},
+			},
+		},
 		FeatureGate: FeatureGateConfig{
 			Tier:       "free",
 			LicenseKey: "",
@@ -404,8 +589,11 @@ func (c *DesktopConfig) Reload() error {
 		return fmt.Errorf("failed to read configuration file: %w", err)
 	}
 
-	// Create a temporary config to parse into
-	tempConfig := &DesktopConfig{}
+	// Parse over the defaults, so sections missing from the file keep them
+	tempConfig, err := DefaultConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create default config: %w", err)
+	}
 	if err := json.Unmarshal(data, tempConfig); err != nil {
 		return fmt.Errorf("failed to parse configuration file: %w", err)
 	}
@@ -422,7 +610,11 @@ func (c *DesktopConfig) Reload() error {
 	c.Interceptor = tempConfig.Interceptor
 	c.Detection = tempConfig.Detection
 	c.Visualizer = tempConfig.Visualizer
+	c.Recorder = tempConfig.Recorder
+	c.ThreatIntel = tempConfig.ThreatIntel
+	c.Syslog = tempConfig.Syslog
 	c.SystemTray = tempConfig.SystemTray
+	c.Notifications = tempConfig.Notifications
 	c.FeatureGate = tempConfig.FeatureGate
 	c.Cloud = tempConfig.Cloud
 	c.Logging = tempConfig.Logging
@@ -437,6 +629,33 @@ func (c *DesktopConfig) Reload() error {
 	return nil
 }
 
+// Clone returns a copy of the configuration for the same file, without its
+// watchers. Reloading the copy leaves this configuration untouched, so
+// components reading it without the lock are not affected.
+func (c *DesktopConfig) Clone() *DesktopConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &DesktopConfig{
+		Database:      c.Database,
+		Network:       c.Network,
+		Discovery:     c.Discovery,
+		Interceptor:   c.Interceptor,
+		Detection:     c.Detection,
+		Visualizer:    c.Visualizer,
+		Recorder:      c.Recorder,
+		ThreatIntel:   c.ThreatIntel,
+		Syslog:        c.Syslog,
+		SystemTray:    c.SystemTray,
+		Notifications: c.Notifications,
+		FeatureGate:   c.FeatureGate,
+		Cloud:         c.Cloud,
+		Logging:       c.Logging,
+		configPath:    c.configPath,
+		watchers:      make([]ConfigWatcher, 0),
+	}
+}
+
 // AddWatcher adds a configuration change watcher
 func (c *DesktopConfig) AddWatcher(watcher ConfigWatcher) {
 	c.mu.Lock()
@@ -504,11 +723,109 @@ func (c *DesktopConfig) Validate() error {
 	if c.Detection.Sensitivity < 0.0 || c.Detection.Sensitivity > 1.0 {
 		return fmt.Errorf("detection sensitivity must be between 0.0 and 1.0")
 	}
+	if c.Detection.NewDevice.Enabled {
+		if c.Detection.NewDevice.BusinessHoursStart < 0 || c.Detection.NewDevice.BusinessHoursStart > 23 ||
+			c.Detection.NewDevice.BusinessHoursEnd < 0 || c.Detection.NewDevice.BusinessHoursEnd > 23 {
+			return fmt.Errorf("new device business hours must be between 0 and 23")
+		}
+		if c.Detection.NewDevice.LearningPeriodMinutes < 0 {
+			return fmt.Errorf("new device learning period cannot be negative")
+		}
+	}
+	if c.Detection.DormantDevice.Enabled && c.Detection.DormantDevice.AfterMinutes < 1 {
+		return fmt.Errorf("dormant device threshold must be at least 1 minute")
+	}
 
 	// Validate visualizer configuration
 	if c.Visualizer.Port < 1 || c.Visualizer.Port > 65535 {
 		return fmt.Errorf("visualizer port must be between 1 and 65535")
 	}
+	if c.Visualizer.Auth.Enabled {
+		if c.Visualizer.Auth.SessionHours < 1 {
+			return fmt.Errorf("dashboard session lifetime must be at least 1 hour")
+		}
+		if c.Visualizer.Auth.InitialPasswordFile == "" {
+			return fmt.Errorf("initial password file cannot be empty when dashboard authentication is enabled")
+		}
+	}
+	if c.Visualizer.TLS.Enabled {
+		if (c.Visualizer.TLS.CertFile == "") != (c.Visualizer.TLS.KeyFile == "") {
+			return fmt.Errorf("dashboard TLS requires both cert_file and key_file, or neither")
+		}
+		if c.Visualizer.TLS.CertFile == "" && c.Visualizer.TLS.Directory == "" {
+			return fmt.Errorf("dashboard TLS directory cannot be empty without a certificate file")
+		}
+	}
+
+	// Validate recorder configuration if enabled
+	if c.Recorder.Enabled {
+		if c.Recorder.Directory == "" {
+			return fmt.Errorf("recorder directory cannot be empty when recording is enabled")
+		}
+		if c.Recorder.MaxFileSizeMB < 1 {
+			return fmt.Errorf("recorder max file size must be at least 1 MB")
+		}
+		if c.Recorder.MaxFileAgeMinutes < 0 {
+			return fmt.Errorf("recorder max file age cannot be negative")
+		}
+		if c.Recorder.MaxFilesPerDevice < 1 {
+			return fmt.Errorf("recorder must keep at least 1 file per device")
+		}
+	}
+
+	// Validate threat intel configuration if enabled
+	if c.ThreatIntel.Enabled {
+		if c.ThreatIntel.RefreshMinutes < 0 {
+			return fmt.Errorf("threat intel refresh interval cannot be negative")
+		}
+		feedNames := make(map[string]bool)
+		for _, feed := range c.ThreatIntel.Feeds {
+			if feed.Name == "" || feed.Path == "" {
+				return fmt.Errorf("threat intel feeds require a name and a path")
+			}
+			if feedNames[feed.Name] {
+				return fmt.Errorf("duplicate threat intel feed name: %s", feed.Name)
+			}
+			feedNames[feed.Name] = true
+			switch feed.Format {
+			case "", "plain", "csv", "stix":
+			default:
+				return fmt.Errorf("invalid format for threat intel feed %s: %s (must be plain, csv or stix)", feed.Name, feed.Format)
+			}
+			switch feed.Severity {
+			case "", "low", "medium", "high", "critical":
+			default:
+				return fmt.Errorf("invalid severity for threat intel feed %s: %s", feed.Name, feed.Severity)
+			}
+		}
+	}
+
+	// Validate syslog forwarding if enabled
+	if c.Syslog.Enabled {
+		if _, _, err := net.SplitHostPort(c.Syslog.Address); err != nil {
+			return fmt.Errorf("syslog address must be host:port: %q", c.Syslog.Address)
+		}
+		if c.Syslog.Protocol != "udp" && c.Syslog.Protocol != "tcp" && c.Syslog.Protocol != "tls" {
+			return fmt.Errorf("invalid syslog protocol: %s (must be udp, tcp, or tls)", c.Syslog.Protocol)
+		}
+		if c.Syslog.Format != "cef" && c.Syslog.Format != "leef" {
+			return fmt.Errorf("invalid syslog format: %s (must be cef or leef)", c.Syslog.Format)
+		}
+		if c.Syslog.Facility < 0 || c.Syslog.Facility > 23 {
+			return fmt.Errorf("syslog facility must be between 0 and 23")
+		}
+		switch c.Syslog.MinSeverity {
+		case "", "low", "medium", "high", "critical":
+		default:
+			return fmt.Errorf("invalid syslog minimum severity: %s", c.Syslog.MinSeverity)
+		}
+	}
+
+	if c.Notifications.Enabled {
+		if err := c.Notifications.validate(c.Syslog.Enabled); err != nil {
+			return err
+		}
+	}
 
 	// Validate feature gate configuration
 	validTiers := map[string]bool{
@@ -580,3 +897,74 @@ func (c *DesktopConfig) Validate() error {
 
 	return nil
 }
+
+// validate checks the channels and rules of an enabled notification policy
+func (n *NotificationsConfig) validate(syslogEnabled bool) error {
+	enabled := map[string]bool{
+		"tray":    n.Tray.Enabled,
+		"email":   n.Email.Enabled,
+		"webhook": n.Webhook.Enabled,
+		"syslog":  n.Syslog.Enabled,
+	}
+	policies := map[string]NotificationChannelConfig{
+		"tray":    n.Tray,
+		"email":   n.Email.NotificationChannelConfig,
+		"webhook": n.Webhook.NotificationChannelConfig,
+		"syslog":  n.Syslog,
+	}
+	for name, policy := range policies {
+		if !policy.Enabled {
+			continue
+		}
+		if (policy.QuietHoursStart == "") != (policy.QuietHoursEnd == "") {
+			return fmt.Errorf("%s notifications need both quiet hours start and end", name)
+		}
+		for _, clock := range []string{policy.QuietHoursStart, policy.QuietHoursEnd} {
+			if _, err := time.Parse("15:04", clock); clock != "" && err != nil {
+				return fmt.Errorf("invalid %s quiet hours time %q (expected HH:MM)", name, clock)
+			}
+		}
+		if !validSeverity(policy.QuietHoursBypass) {
+			return fmt.Errorf("invalid %s quiet hours bypass severity: %s", name, policy.QuietHoursBypass)
+		}
+		if policy.MaxPerHour < 0 || policy.DigestMinutes < 0 {
+			return fmt.Errorf("%s notification limits cannot be negative", name)
+		}
+	}
+
+	if n.Email.Enabled {
+		if n.Email.Host == "" || n.Email.From == "" || len(n.Email.To) == 0 {
+			return fmt.Errorf("email notifications need an SMTP host, sender and recipients")
+		}
+		if n.Email.Port < 1 || n.Email.Port > 65535 {
+			return fmt.Errorf("SMTP port must be between 1 and 65535")
+		}
+	}
+	if n.Webhook.Enabled && n.Webhook.URL == "" {
+		return fmt.Errorf("webhook notifications need a URL")
+	}
+	if n.Syslog.Enabled && !syslogEnabled {
+		return fmt.Errorf("syslog notifications need the syslog section enabled")
+	}
+
+	for _, rule := range n.Rules {
+		if !validSeverity(rule.MinSeverity) {
+			return fmt.Errorf("notification rule %q has invalid minimum severity: %s", rule.Name, rule.MinSeverity)
+		}
+		for _, channel := range rule.Channels {
+			if !enabled[channel] {
+				return fmt.Errorf("notification rule %q uses channel %q, which is not enabled", rule.Name, channel)
+			}
+		}
+	}
+	return nil
+}
+
+// validSeverity reports whether s is empty or an anomaly severity
+func validSeverity(s string) bool {
+	switch s {
+	case "", "low", "medium", "high", "critical":
+		return true
+	}
+	return false
+}
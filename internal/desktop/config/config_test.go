@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadKeepsDefaultsForMissingSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg, err := LoadConfigFromPath(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	defaults, _ := DefaultConfig()
+
+	// A file from an older release only has some of the sections
+	if err := os.WriteFile(path, []byte(`{"detection": {"enabled": true, "sensitivity": 0.7, "rules_file": "/etc/heimdal/rules.yaml"}}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	watched := cfg.Clone()
+	if err := watched.Reload(); err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+
+	if watched.Detection.RulesFile != "/etc/heimdal/rules.yaml" {
+		t.Errorf("Expected the new rules file, got %q", watched.Detection.RulesFile)
+	}
+	if watched.Recorder != defaults.Recorder || watched.Visualizer.Auth != defaults.Visualizer.Auth {
+		t.Errorf("Expected missing sections to keep their defaults, got %+v", watched.Recorder)
+	}
+	if cfg.Detection.RulesFile != "" {
+		t.Error("Expected reloading a clone to leave the original untouched")
+	}
+}
@@ -378,7 +378,7 @@ func (w *OnboardingWizard) printCompletion() {
 	fmt.Println()
 	fmt.Println("Next steps:")
 	fmt.Println("  • The agent will start monitoring your network")
-	fmt.Println("  • Access the dashboard at: http://localhost:8080")
+	fmt.Println("  • Access the dashboard at: https://localhost:8080")
 	fmt.Println("  • Check the system tray for status and controls")
 	fmt.Println()
 	fmt.Println("For help and documentation, visit:")
@@ -38,6 +38,7 @@ import (
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
 )
 
 // DesktopTrafficInterceptor manages ARP spoofing operations from a desktop endpoint
@@ -51,10 +52,13 @@ type DesktopTrafficInterceptor struct {
 
 	// Packet capture handle
 	handle *pcap.Handle
+	writer packetWriter // Sends ARP packets; the pcap handle once started
 
 	// Spoofing targets
 	targets   map[string]*SpoofTarget // MAC -> SpoofTarget
+	paused    bool                    // Targets are kept but not spoofed
 	targetsMu sync.RWMutex
+	spoofMu   sync.Mutex // Held for a whole spoofing iteration and while restoring ARP caches
 
 	// Original ARP cache for restoration
 	originalARPCache map[string]ARPEntry
@@ -75,12 +79,19 @@ type DesktopTrafficInterceptor struct {
 	signalChan chan os.Signal
 }
 
+// packetWriter sends raw packets on the capture interface
+type packetWriter interface {
+	WritePacketData(data []byte) error
+}
+
 // SpoofTarget represents a device being spoofed
 type SpoofTarget struct {
 	MAC       net.HardwareAddr
 	IP        net.IP
 	LastSpoof time.Time
 	IsActive  bool
+	Failures  int    // Consecutive failed spoofing attempts
+	LastError string // Error of the last failed attempt
 }
 
 // ARPEntry represents an original ARP cache entry
@@ -215,6 +226,7 @@ func (dti *DesktopTrafficInterceptor) Start() error {
 		return dti.enhancePermissionError(err)
 	}
 	dti.handle = handle
+	dti.writer = handle
 
 	// Set up signal handling for crash recovery
 	signal.Notify(dti.signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT)
@@ -334,6 +346,11 @@ func (dti *DesktopTrafficInterceptor) RemoveTarget(mac net.HardwareAddr) error {
 
 	macStr := mac.String()
 
+	// Let a spoofing iteration in progress finish first, so it cannot spoof
+	// the target again after its ARP entry is restored
+	dti.spoofMu.Lock()
+	defer dti.spoofMu.Unlock()
+
 	dti.targetsMu.Lock()
 	defer dti.targetsMu.Unlock()
 
@@ -351,6 +368,70 @@ func (dti *DesktopTrafficInterceptor) RemoveTarget(mac net.HardwareAddr) error {
 	return fmt.Errorf("target %s not found", mac)
 }
 
+// Targets returns the devices being spoofed
+func (dti *DesktopTrafficInterceptor) Targets() []interception.Target {
+	dti.targetsMu.RLock()
+	defer dti.targetsMu.RUnlock()
+
+	targets := make([]interception.Target, 0, len(dti.targets))
+	for mac, target := range dti.targets {
+		status := interception.Target{
+			MAC:       mac,
+			IP:        target.IP.String(),
+			Active:    target.IsActive,
+			Failures:  target.Failures,
+			LastError: target.LastError,
+		}
+		if !target.LastSpoof.IsZero() {
+			lastSpoof := target.LastSpoof
+			status.LastSpoof = &lastSpoof
+			// Allow a couple of missed intervals before reporting a target as unhealthy
+			status.Healthy = target.IsActive && !dti.paused && target.Failures == 0 &&
+				time.Since(target.LastSpoof) <= 3*dti.spoofInterval
+		}
+		targets = append(targets, status)
+	}
+	return targets
+}
+
+// Pause stops spoofing every target and restores their ARP caches, keeping
+// the targets for Resume. It waits for a spoofing iteration in progress to
+// end before restoring.
+func (dti *DesktopTrafficInterceptor) Pause() error {
+	dti.targetsMu.Lock()
+	dti.paused = true
+	dti.targetsMu.Unlock()
+
+	dti.spoofMu.Lock()
+	defer dti.spoofMu.Unlock()
+
+	dti.runningMu.Lock()
+	running := dti.running
+	dti.runningMu.Unlock()
+
+	log.Println("Desktop traffic interception paused")
+	if running {
+		return dti.restoreARPTables()
+	}
+	return nil
+}
+
+// Resume starts spoofing the targets again from the next interval
+func (dti *DesktopTrafficInterceptor) Resume() {
+	dti.targetsMu.Lock()
+	dti.paused = false
+	dti.targetsMu.Unlock()
+
+	log.Println("Desktop traffic interception resumed")
+}
+
+// Paused reports whether spoofing is paused
+func (dti *DesktopTrafficInterceptor) Paused() bool {
+	dti.targetsMu.RLock()
+	defer dti.targetsMu.RUnlock()
+	return dti.paused
+}
+
 // checkPermissions verifies that the application has necessary permissions
 func (dti *DesktopTrafficInterceptor) checkPermissions() error {
 	switch runtime.GOOS {
@@ -505,7 +586,14 @@ func (dti *DesktopTrafficInterceptor) spoofingLoop() {
 
 // performSpoofing sends spoofed ARP packets to all active targets
 func (dti *DesktopTrafficInterceptor) performSpoofing() {
+	dti.spoofMu.Lock()
+	defer dti.spoofMu.Unlock()
+
 	dti.targetsMu.RLock()
+	if dti.paused {
+		dti.targetsMu.RUnlock()
+		return
+	}
 	targets := make([]*SpoofTarget, 0, len(dti.targets))
 	for _, target := range dti.targets {
 		if target.IsActive {
@@ -516,25 +604,46 @@ func (dti *DesktopTrafficInterceptor) performSpoofing() {
 
 	// Send spoofed ARP packets
 	for _, target := range targets {
+		// Stop early when paused part way through
+		if dti.Paused() {
+			return
+		}
+
 		// Send spoofed packet to target (tell target that gateway is at our MAC)
 		if err := dti.spoofTarget(target.IP, target.MAC, dti.gatewayIP, dti.localMAC); err != nil {
 			log.Printf("Warning: failed to spoof target %s: %v", target.IP, err)
+			dti.recordSpoof(target, err)
 			continue
 		}
 
 		// Send spoofed packet to gateway (tell gateway that target is at our MAC)
 		if err := dti.spoofTarget(dti.gatewayIP, dti.gatewayMAC, target.IP, dti.localMAC); err != nil {
 			log.Printf("Warning: failed to spoof gateway for target %s: %v", target.IP, err)
+			dti.recordSpoof(target, err)
 			continue
 		}
 
-		// Update last spoof time
-		dti.targetsMu.Lock()
-		if t, exists := dti.targets[target.MAC.String()]; exists {
-			t.LastSpoof = time.Now()
-		}
-		dti.targetsMu.Unlock()
+		dti.recordSpoof(target, nil)
+	}
+}
+
+// recordSpoof updates a target's last spoof time or failure count
+func (dti *DesktopTrafficInterceptor) recordSpoof(target *SpoofTarget, err error) {
+	dti.targetsMu.Lock()
+	defer dti.targetsMu.Unlock()
+
+	t, exists := dti.targets[target.MAC.String()]
+	if !exists {
+		return
+	}
+	if err != nil {
+		t.Failures++
+		t.LastError = err.Error()
+		return
 	}
+	t.LastSpoof = time.Now()
+	t.Failures = 0
+	t.LastError = ""
 }
 
 // spoofTarget sends a spoofed ARP reply to a specific target
@@ -603,11 +712,11 @@ func (dti *DesktopTrafficInterceptor) buildARPReply(dstIP net.IP, dstMAC net.Har
 
 // sendARPPacket transmits an ARP packet via the raw socket
 func (dti *DesktopTrafficInterceptor) sendARPPacket(packet []byte) error {
-	if dti.handle == nil {
+	if dti.writer == nil {
 		return fmt.Errorf("pcap handle not initialized")
 	}
 
-	if err := dti.handle.WritePacketData(packet); err != nil {
+	if err := dti.writer.WritePacketData(packet); err != nil {
 		return fmt.Errorf("failed to write packet: %w", err)
 	}
 
@@ -0,0 +1,103 @@
+package interceptor
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter records packets and holds the first write until released
+type blockingWriter struct {
+	mu      sync.Mutex
+	packets [][]byte
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *blockingWriter) WritePacketData(data []byte) error {
+	w.mu.Lock()
+	w.packets = append(w.packets, data)
+	first := len(w.packets) == 1
+	w.mu.Unlock()
+
+	if first {
+		close(w.started)
+		<-w.release
+	}
+	return nil
+}
+
+func TestPauseRestoresAfterSpoofingIteration(t *testing.T) {
+	localMAC, _ := net.ParseMAC("aa:00:00:00:00:ff")
+	gatewayMAC, _ := net.ParseMAC("aa:00:00:00:00:fe")
+	writer := newBlockingWriter()
+	dti := &DesktopTrafficInterceptor{
+		localMAC:         localMAC,
+		gatewayIP:        net.ParseIP("192.168.1.1"),
+		gatewayMAC:       gatewayMAC,
+		writer:           writer,
+		targets:          make(map[string]*SpoofTarget),
+		originalARPCache: make(map[string]ARPEntry),
+		spoofInterval:    time.Second,
+		maxTargets:       10,
+		running:          true,
+	}
+	for i, ip := range []string{"192.168.1.11", "192.168.1.12"} {
+		mac := net.HardwareAddr{0xaa, 0, 0, 0, 0, byte(i + 1)}
+		if err := dti.AddTarget(net.ParseIP(ip), mac); err != nil {
+			t.Fatalf("Failed to add target: %v", err)
+		}
+	}
+
+	spoofed := make(chan struct{})
+	go func() {
+		dti.performSpoofing()
+		close(spoofed)
+	}()
+	<-writer.started
+
+	// Pause while the first packet of the iteration is being sent
+	paused := make(chan struct{})
+	go func() {
+		dti.Pause()
+		close(paused)
+	}()
+	for !dti.Paused() {
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-paused:
+		t.Fatal("Expected Pause to wait for the spoofing iteration")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(writer.release)
+	<-paused
+	<-spoofed
+
+	// Spoofed packets claim our MAC as their Ethernet source; none may follow
+	// the restoring packets
+	restoring := false
+	restored := 0
+	for _, packet := range writer.packets {
+		if bytes.Equal(packet[6:12], localMAC) {
+			if restoring {
+				t.Fatal("Expected no spoofed packet after the ARP caches were restored")
+			}
+			continue
+		}
+		restoring = true
+		restored++
+	}
+	// Each restoring packet is sent three times
+	if restored != 12 {
+		t.Errorf("Expected both targets and the gateway to be restored, got %d packets", restored)
+	}
+}
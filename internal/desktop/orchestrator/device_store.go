@@ -21,20 +21,7 @@ func newStorageDeviceStore(storage platform.StorageProvider) (*storageDeviceStor
 }
 
 func (s *storageDeviceStore) SaveDevice(device *database.Device) error {
-	if device == nil {
-		return fmt.Errorf("device cannot be nil")
-	}
-	if device.MAC == "" {
-		return fmt.Errorf("device MAC address cannot be empty")
-	}
-
-	data, err := json.Marshal(device)
-	if err != nil {
-		return fmt.Errorf("failed to serialize device %s: %w", device.MAC, err)
-	}
-
-	key := "device:" + device.MAC
-	return s.storage.Set(key, data)
+	return database.StoreDevice(s.storage, device)
 }
 
 func (s *storageDeviceStore) GetAllDevices() ([]*database.Device, error) {
@@ -60,3 +47,8 @@ func (s *storageDeviceStore) GetAllDevices() ([]*database.Device, error) {
 
 	return devices, nil
 }
+
+// DeviceMetadata returns the user-edited metadata of a stored device
+func (s *storageDeviceStore) DeviceMetadata(mac string) *database.DeviceMetadata {
+	return database.LoadDeviceMetadata(s.storage, mac)
+}
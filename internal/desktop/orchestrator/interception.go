@@ -0,0 +1,34 @@
+package orchestrator
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/desktop/interceptor"
+)
+
+// interceptorTargets adapts the desktop interceptor to interception.Interceptor.
+// The desktop interceptor does not follow discovery, so a device can only be
+// added once its address is known.
+type interceptorTargets struct {
+	*interceptor.DesktopTrafficInterceptor
+}
+
+func (t interceptorTargets) AddTarget(mac string, ip net.IP) error {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address %s: %w", mac, err)
+	}
+	if ip == nil {
+		return fmt.Errorf("the address of %s is not known yet", mac)
+	}
+	return t.DesktopTrafficInterceptor.AddTarget(ip, hwAddr)
+}
+
+func (t interceptorTargets) RemoveTarget(mac string) error {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address %s: %w", mac, err)
+	}
+	return t.DesktopTrafficInterceptor.RemoveTarget(hwAddr)
+}
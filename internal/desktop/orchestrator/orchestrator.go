@@ -16,9 +16,19 @@ import (
 	"time"
 
 	"github.com/mosiko1234/heimdal/sensor/internal/cloud"
+	sensorconfig "github.com/mosiko1234/heimdal/sensor/internal/config"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/alerting"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/auth"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/certs"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
 	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/notify"
 	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
 	"github.com/mosiko1234/heimdal/sensor/internal/core/profiler"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/recorder"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/threatintel"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 	"github.com/mosiko1234/heimdal/sensor/internal/desktop/config"
 	"github.com/mosiko1234/heimdal/sensor/internal/desktop/featuregate"
@@ -54,9 +64,21 @@ type DesktopOrchestrator struct {
 	deviceScanner       *discovery.Scanner
 	deviceStore         database.DeviceStore
 	trafficInterceptor  *interceptor.DesktopTrafficInterceptor
+	interception        *interception.Controller
 	analyzer            *packet.Analyzer
+	recorder            *recorder.Recorder
 	profilerComp        *profiler.Profiler
 	detector            *detection.Detector
+	lifecycleDetector   *detection.LifecycleDetector
+	ruleLoader          *detection.RuleLoader
+	anomalyStore        *detection.AnomalyStore
+	flowTable           *flow.Table
+	flowStore           *flow.Store
+	threatMatcher       *threatintel.Matcher
+	alerts              *alerting.Forwarder
+	certs               *certs.Manager
+	notifier            *notify.Engine
+	configWatchStop     chan struct{}
 	visualizerComp      *visualizer.Visualizer
 	systemTray          *systray.SystemTray
 	cloudOrch           *cloud.Orchestrator
@@ -67,6 +89,7 @@ type DesktopOrchestrator struct {
 	// Communication channels
 	packetChan  chan packet.PacketInfo
 	anomalyChan chan *detection.Anomaly
+	flowChan    chan *flow.Record
 
 	// Lifecycle management
 	ctx        context.Context
@@ -118,6 +141,7 @@ func NewDesktopOrchestrator(
 		cancel:            cancel,
 		packetChan:        make(chan packet.PacketInfo, 1000),
 		anomalyChan:       make(chan *detection.Anomaly, 100),
+		flowChan:          make(chan *flow.Record, 1000),
 		shutdownCh:        make(chan struct{}),
 		componentHealth:   make(map[string]*componentHealthInfo),
 		discoveryStatusCh: make(chan discovery.StatusUpdate, 16),
@@ -185,7 +209,23 @@ func (o *DesktopOrchestrator) initializeComponents() error {
 
 	// 4. Initialize Packet Analyzer
 	o.logger.Info("Initializing packet analyzer with platform interface...")
-	analyzer, err := packet.NewAnalyzer(o.packetCapture, o.packetChan, nil)
+	captureProvider := o.packetCapture
+	if o.config.Recorder.Enabled && o.featureGate.CanAccess(featuregate.FeatureTrafficBlocking) {
+		rec, err := recorder.NewRecorder(&recorder.Config{
+			Directory:   o.config.Recorder.Directory,
+			MaxFileSize: int64(o.config.Recorder.MaxFileSizeMB) * 1024 * 1024,
+			MaxFileAge:  time.Duration(o.config.Recorder.MaxFileAgeMinutes) * time.Minute,
+			MaxFiles:    o.config.Recorder.MaxFilesPerDevice,
+			SnapLen:     recorder.DefaultConfig().SnapLen,
+		})
+		if err != nil {
+			o.logger.Warn("Failed to initialize packet recorder: %v", err)
+		} else {
+			o.recorder = rec
+			captureProvider = recorder.NewTeeProvider(o.packetCapture, rec)
+		}
+	}
+	analyzer, err := packet.NewAnalyzer(captureProvider, o.packetChan, nil)
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize packet analyzer")
 	}
@@ -200,6 +240,20 @@ func (o *DesktopOrchestrator) initializeComponents() error {
 	}
 	o.profilerComp = profilerComp
 	o.initComponentHealth("Profiler")
+	o.deviceScanner.SetFingerprintSource(o.tlsFingerprints)
+
+	// Flow table groups packets into connections for upload/download volume and duration
+	flowTable, err := flow.NewTable(o.flowChan, flow.DefaultConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize flow table")
+	}
+	flowStore, err := flow.NewStore(o.storage, flow.DefaultStoreConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize flow store")
+	}
+	o.flowTable = flowTable
+	o.flowStore = flowStore
+	o.analyzer.AddInspector(flowTable)
 
 	// 6. Initialize Anomaly Detector
 	o.logger.Info("Initializing anomaly detector...")
@@ -214,13 +268,73 @@ func (o *DesktopOrchestrator) initializeComponents() error {
 	o.detector = detector
 	o.initComponentHealth("Detector")
 
+	// Anomaly store deduplicates detections and tracks their triage state
+	anomalyStore, err := detection.NewAnomalyStore(o.storage, detection.DefaultAnomalyStoreConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize anomaly store")
+	}
+	o.anomalyStore = anomalyStore
+
+	// User-defined rules; a broken rule file leaves the built-in checks running
+	o.ruleLoader = detection.NewRuleLoader(detector, o.config.Detection.RulesFile)
+	if err := o.ruleLoader.Load(); err != nil {
+		o.logger.Error("Failed to load detection rules: %v", err)
+	} else if o.config.Detection.RulesFile != "" {
+		o.logger.Info("Loaded %d detection rules from %s", len(detector.Rules()), o.config.Detection.RulesFile)
+	}
+
+	// Threat intel checks packets inline and profile destinations on every detector pass
+	if o.config.ThreatIntel.Enabled {
+		o.logger.Info("Initializing threat intel with %d feeds...", len(o.config.ThreatIntel.Feeds))
+		matcher, err := threatintel.NewMatcher(o.threatIntelConfig())
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize threat intel")
+		}
+		if err := matcher.Refresh(); err != nil {
+			o.logger.Warn("Some threat intel feeds failed to load: %v", err)
+		}
+		o.threatMatcher = matcher
+		o.analyzer.AddInspector(threatintel.NewInspector(matcher, o.publishAnomaly))
+		o.detector.RegisterRule(matcher.Rule())
+	}
+
+	// Device lifecycle rules turn discovery events into new/dormant device anomalies
+	if o.config.Detection.Enabled {
+		lifecycleDetector, err := detection.NewLifecycleDetector(o.lifecycleConfig())
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize lifecycle detector")
+		}
+		o.lifecycleDetector = lifecycleDetector
+	}
+
+	// Syslog forwarding ships anomalies to the SOC alongside the tray and dashboard
+	if o.config.Syslog.Enabled {
+		o.logger.Info("Initializing syslog alert forwarding to %s...", o.config.Syslog.Address)
+		forwarder, err := alerting.NewForwarder(o.alertingConfig(), o.lookupDevice)
+		if err != nil {
+			o.logger.Warn("Failed to initialize syslog forwarding: %v", err)
+		} else {
+			o.alerts = forwarder
+			o.initComponentHealth(forwarder.Name())
+		}
+	}
+	if o.lifecycleDetector != nil || (o.alerts != nil && o.config.Syslog.DeviceEvents) {
+		o.deviceScanner.SetDeviceEventSink(o.handleDeviceEvent)
+	}
+
 	// 7. Initialize Traffic Interceptor (if enabled and tier allows)
 	if o.config.Interceptor.Enabled {
 		if o.featureGate.CanAccess(featuregate.FeatureTrafficBlocking) {
 			o.logger.Info("Initializing traffic interceptor...")
+			// Only detected when interception is enabled; without a gateway the
+			// interceptor cannot be created
+			gateway := detectGatewayAddress(o.config.Network.Interface)
+			if gateway == nil {
+				o.logger.Warn("Could not detect the default gateway on %s", o.config.Network.Interface)
+			}
 			interceptorCfg := &interceptor.Config{
 				InterfaceName: o.config.Network.Interface,
-				GatewayIP:     nil, // Will be auto-detected
+				GatewayIP:     gateway,
 				SpoofInterval: 2 * time.Second,
 				MaxTargets:    50,
 			}
@@ -231,6 +345,14 @@ func (o *DesktopOrchestrator) initializeComponents() error {
 			} else {
 				o.trafficInterceptor = trafficInterceptor
 				o.initComponentHealth("TrafficInterceptor")
+
+				// Targets changed from the dashboard survive restarts
+				controller, err := interception.NewController(o.storage, interceptorTargets{trafficInterceptor}, o.lookupDevice)
+				if err != nil {
+					return errors.Wrap(err, "failed to initialize interception control")
+				}
+				controller.Restore(o.config.Interceptor.TargetDevices)
+				o.interception = controller
 			}
 		} else {
 			o.logger.Info("Traffic interceptor requires Pro tier or higher")
@@ -242,9 +364,36 @@ func (o *DesktopOrchestrator) initializeComponents() error {
 	// 8. Initialize Local Visualizer
 	o.logger.Info("Initializing local visualizer on port %d", o.config.Visualizer.Port)
 	visualizerCfg := &visualizer.Config{
-		Port:        o.config.Visualizer.Port,
-		Storage:     o.storage,
-		FeatureGate: o.featureGate,
+		Port:         o.config.Visualizer.Port,
+		Storage:      o.storage,
+		FeatureGate:  o.featureGate,
+		Recorder:     o.recorder,
+		Anomalies:    o.anomalyStore,
+		Flows:        o.flowStore,
+		Interception: o.interception,
+	}
+	if o.config.Visualizer.TLS.Enabled {
+		certManager, err := certs.NewManager(o.certsConfig())
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize dashboard certificates")
+		}
+		o.certs = certManager
+		o.initComponentHealth(certManager.Name())
+		visualizerCfg.TLS = certManager
+	} else {
+		o.logger.Warn("Dashboard HTTPS is disabled; logins and device data travel in cleartext")
+	}
+	if o.config.Visualizer.Auth.Enabled {
+		authManager, err := auth.NewManager(o.storage, o.authConfig())
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize dashboard authentication")
+		}
+		if _, err := authManager.Bootstrap(o.config.Visualizer.Auth.InitialPasswordFile); err != nil {
+			return errors.Wrap(err, "failed to create the initial admin user")
+		}
+		visualizerCfg.Auth = authManager
+	} else {
+		o.logger.Warn("Dashboard authentication is disabled; device data is readable by anyone on the network")
 	}
 	visualizerComp, err := visualizer.NewVisualizer(visualizerCfg)
 	if err != nil {
@@ -259,6 +408,16 @@ func (o *DesktopOrchestrator) initializeComponents() error {
 	o.systemTray = systemTray
 	o.initComponentHealth("SystemTray")
 
+	// Notification policy routes anomalies to channels instead of a popup per anomaly
+	if o.config.Notifications.Enabled {
+		o.logger.Info("Initializing notification policy with %d rules...", len(o.config.Notifications.Rules))
+		if err := o.initializeNotifications(); err != nil {
+			o.logger.Warn("Failed to initialize notification policy: %v", err)
+			o.logger.Info("Falling back to a tray notification per anomaly")
+			o.notifier = nil
+		}
+	}
+
 	// 10. Initialize Cloud Connector (if enabled)
 	if o.config.Cloud.Enabled {
 		o.logger.Info("Initializing cloud connector...")
@@ -301,12 +460,26 @@ func (o *DesktopOrchestrator) startComponents() error {
 		return errors.Wrap(err, "failed to start profiler")
 	}
 	o.markComponentRunning("Profiler", true)
+	o.wg.Add(1)
+	go o.flowLoop()
 
 	// 3. Start Detector (runs in background)
 	o.logger.Info("Starting anomaly detector...")
 	o.wg.Add(1)
 	go o.detectorLoop()
+
+	// Watch the configuration file so rule file changes apply without a
+	// restart. Reloads go to a copy: the running components read o.config
+	// without its lock, and only the rule file is applied live.
+	watched := o.config.Clone()
+	watched.AddWatcher(func(cfg *config.DesktopConfig) error {
+		return o.ruleLoader.SetPath(cfg.Detection.RulesFile)
+	})
+	o.configWatchStop = watched.StartWatching(10 * time.Second)
 	o.markComponentRunning("Detector", true)
+	if o.threatMatcher != nil {
+		o.threatMatcher.Start()
+	}
 
 	// 4. Start Traffic Interceptor (if initialized)
 	if o.trafficInterceptor != nil {
@@ -346,6 +519,33 @@ func (o *DesktopOrchestrator) startComponents() error {
 		}
 	}
 
+	// Start certificate renewal (if HTTPS is enabled)
+	if o.certs != nil {
+		if err := o.certs.Start(); err != nil {
+			o.logger.Warn("Failed to start certificate renewal: %v", err)
+		} else {
+			o.markComponentRunning(o.certs.Name(), true)
+		}
+	}
+
+	// Start syslog alert forwarding (if initialized)
+	if o.alerts != nil {
+		if err := o.alerts.Start(); err != nil {
+			o.logger.Warn("Failed to start syslog forwarding: %v", err)
+		} else {
+			o.markComponentRunning(o.alerts.Name(), true)
+		}
+	}
+
+	// Start notification policy (if initialized)
+	if o.notifier != nil {
+		if err := o.notifier.Start(); err != nil {
+			o.logger.Warn("Failed to start notification policy: %v", err)
+		} else {
+			o.markComponentRunning(o.notifier.Name(), true)
+		}
+	}
+
 	// 8. Start event notification handler
 	o.wg.Add(1)
 	go o.eventNotificationLoop()
@@ -370,12 +570,32 @@ func (o *DesktopOrchestrator) detectorLoop() {
 		case <-o.shutdownCh:
 			return
 		case <-ticker.C:
+			// Check for always-on devices that went dark
+			if o.lifecycleDetector != nil {
+				for _, anomaly := range o.lifecycleDetector.CheckDormant(time.Now()) {
+					o.publishAnomaly(anomaly)
+				}
+			}
+
+			// Drop old resolved and suppressed anomalies
+			if removed := o.anomalyStore.Prune(time.Now()); removed > 0 {
+				o.logger.Info("Pruned %d old anomalies", removed)
+			}
+
+			// Pick up edits to the rule file
+			if reloaded, err := o.ruleLoader.ReloadIfChanged(); err != nil {
+				o.logger.Error("Failed to reload detection rules: %v", err)
+			} else if reloaded {
+				o.logger.Info("Reloaded detection rules: %v", o.detector.Rules())
+			}
+
 			// Get all profiles from storage and analyze
 			profiles := o.profilerComp.GetAllProfiles()
+			devices := o.devicesByMAC()
 
 			// Analyze each profile for anomalies
 			for _, profile := range profiles {
-				anomalies, err := o.detector.Analyze(profile)
+				anomalies, err := o.detector.AnalyzeDevice(profile, devices[profile.MAC])
 				if err != nil {
 					o.logger.Error("Failed to analyze profile %s: %v", profile.MAC, err)
 					continue
@@ -383,17 +603,288 @@ func (o *DesktopOrchestrator) detectorLoop() {
 
 				// Send anomalies to notification channel
 				for _, anomaly := range anomalies {
-					select {
-					case o.anomalyChan <- anomaly:
-					default:
-						// Channel full, drop anomaly
-					}
+					o.publishAnomaly(anomaly)
 				}
 			}
 		}
 	}
 }
 
+// flowLoop applies completed flows to profiles and stores them, expiring idle
+// flows while the network is quiet
+func (o *DesktopOrchestrator) flowLoop() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.shutdownCh:
+			// Keep the connections still open at shutdown
+			for _, rec := range o.flowTable.Flush() {
+				o.storeFlow(rec)
+			}
+			return
+		case rec := <-o.flowChan:
+			o.profilerComp.RecordFlow(rec)
+			o.storeFlow(rec)
+		case <-ticker.C:
+			o.flowTable.Sweep()
+			o.flowStore.Prune(time.Now())
+		}
+	}
+}
+
+// storeFlow adds a completed flow to the flow store
+func (o *DesktopOrchestrator) storeFlow(rec *flow.Record) {
+	if err := o.flowStore.Add(rec); err != nil {
+		o.logger.Warn("Failed to store flow %s: %v", rec.Key(), err)
+	}
+}
+
+// devicesByMAC returns the discovered devices keyed by MAC address, giving
+// detection rules access to classifier device types
+func (o *DesktopOrchestrator) devicesByMAC() map[string]*database.Device {
+	devices := make(map[string]*database.Device)
+	if o.deviceStore == nil {
+		return devices
+	}
+
+	all, err := o.deviceStore.GetAllDevices()
+	if err != nil {
+		o.logger.Warn("Failed to load devices for detection rules: %v", err)
+		return devices
+	}
+	for _, device := range all {
+		devices[device.MAC] = device
+	}
+	return devices
+}
+
+// tlsFingerprints returns the TLS client fingerprints profiled for a device
+func (o *DesktopOrchestrator) tlsFingerprints(mac string) []string {
+	profile, err := o.profilerComp.GetProfile(mac)
+	if err != nil {
+		return nil
+	}
+	return profiler.Fingerprints(profile)
+}
+
+// publishAnomaly records an anomaly and hands it to the notification loop
+// without blocking. Repeats of an already known anomaly are only recorded.
+func (o *DesktopOrchestrator) publishAnomaly(anomaly *detection.Anomaly) {
+	if _, isNew, err := o.anomalyStore.Record(anomaly); err != nil {
+		o.logger.Warn("Failed to store %s anomaly for %s: %v", anomaly.Type, anomaly.DeviceMAC, err)
+	} else if !isNew {
+		return
+	}
+	if o.alerts != nil && !o.syslogRouted() {
+		o.alerts.Anomaly(anomaly)
+	}
+
+	select {
+	case o.anomalyChan <- anomaly:
+	default:
+		// Channel full, drop anomaly
+		o.logger.Warn("Anomaly channel full, dropping %s anomaly for %s", anomaly.Type, anomaly.DeviceMAC)
+	}
+}
+
+// handleDeviceEvent feeds discovery lifecycle events to the lifecycle detector
+// and the syslog forwarder
+func (o *DesktopOrchestrator) handleDeviceEvent(event discovery.DeviceEvent) {
+	if o.alerts != nil {
+		o.alerts.DeviceEvent(event)
+	}
+	if o.lifecycleDetector == nil {
+		return
+	}
+
+	switch event.Type {
+	case discovery.DeviceEventNew:
+		if anomaly := o.lifecycleDetector.DeviceJoined(&event.Device, event.Time); anomaly != nil {
+			o.publishAnomaly(anomaly)
+		}
+	case discovery.DeviceEventSeen:
+		o.lifecycleDetector.DeviceSeen(&event.Device, event.Time)
+	}
+}
+
+// lifecycleConfig converts the detection rules from the desktop configuration
+func (o *DesktopOrchestrator) lifecycleConfig() *detection.LifecycleConfig {
+	rules := o.config.Detection
+	cfg := &detection.LifecycleConfig{
+		NewDeviceEnabled:   rules.NewDevice.Enabled,
+		BusinessHoursStart: rules.NewDevice.BusinessHoursStart,
+		BusinessHoursEnd:   rules.NewDevice.BusinessHoursEnd,
+		BusinessDaysOnly:   rules.NewDevice.BusinessDaysOnly,
+		LearningPeriod:     time.Duration(rules.NewDevice.LearningPeriodMinutes) * time.Minute,
+	}
+	if rules.DormantDevice.Enabled {
+		cfg.DormantAfter = time.Duration(rules.DormantDevice.AfterMinutes) * time.Minute
+		cfg.DormantDeviceTypes = rules.DormantDevice.DeviceTypes
+		cfg.DormantMACs = rules.DormantDevice.Devices
+	}
+	return cfg
+}
+
+// initializeNotifications creates the notification engine and its channels
+func (o *DesktopOrchestrator) initializeNotifications() error {
+	cfg := o.config.Notifications
+	engineCfg := notify.DefaultConfig()
+	for _, rule := range cfg.Rules {
+		engineCfg.Rules = append(engineCfg.Rules, notify.Rule{
+			Name:        rule.Name,
+			MinSeverity: detection.Severity(rule.MinSeverity),
+			Types:       rule.Types,
+			Devices:     rule.Devices,
+			DeviceTypes: rule.DeviceTypes,
+			Channels:    rule.Channels,
+			Digest:      rule.Digest,
+		})
+	}
+	o.notifier = notify.NewEngine(engineCfg)
+
+	if cfg.Tray.Enabled && o.systemTray != nil {
+		o.notifier.AddChannel(notify.NewFuncChannel("tray", o.showTrayNotification), notificationPolicy(cfg.Tray))
+	}
+	if cfg.Email.Enabled {
+		email, err := notify.NewEmailChannel(&notify.EmailConfig{
+			Host:     cfg.Email.Host,
+			Port:     cfg.Email.Port,
+			Username: cfg.Email.Username,
+			Password: cfg.Email.Password,
+			From:     cfg.Email.From,
+			To:       cfg.Email.To,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create email channel")
+		}
+		o.notifier.AddChannel(email, notificationPolicy(cfg.Email.NotificationChannelConfig))
+	}
+	if cfg.Webhook.Enabled {
+		webhookCfg := corecloud.DefaultWebhookConfig()
+		webhookCfg.URL = cfg.Webhook.URL
+		webhookCfg.Secret = cfg.Webhook.Secret
+		webhook, err := notify.NewWebhookChannel(webhookCfg)
+		if err != nil {
+			return errors.Wrap(err, "failed to create webhook channel")
+		}
+		o.notifier.AddChannel(webhook, notificationPolicy(cfg.Webhook.NotificationChannelConfig))
+	}
+	if cfg.Syslog.Enabled && o.alerts != nil {
+		o.notifier.AddChannel(notify.NewSyslogChannel(o.alerts), notificationPolicy(cfg.Syslog))
+	}
+
+	if err := o.notifier.Validate(); err != nil {
+		return err
+	}
+	o.initComponentHealth(o.notifier.Name())
+	return nil
+}
+
+// notificationPolicy converts a channel's delivery settings; the
+// configuration has already been validated
+func notificationPolicy(cfg config.NotificationChannelConfig) notify.Policy {
+	policy := notify.Policy{
+		MaxPerHour:     cfg.MaxPerHour,
+		DigestInterval: time.Duration(cfg.DigestMinutes) * time.Minute,
+	}
+	if cfg.QuietHoursStart != "" {
+		start, _ := notify.ParseClock(cfg.QuietHoursStart)
+		end, _ := notify.ParseClock(cfg.QuietHoursEnd)
+		policy.QuietHours = &notify.QuietHours{
+			Start:  start,
+			End:    end,
+			Bypass: detection.Severity(cfg.QuietHoursBypass),
+		}
+	}
+	return policy
+}
+
+// showTrayNotification shows a notification or digest in the system tray
+func (o *DesktopOrchestrator) showTrayNotification(n *notify.Notification) error {
+	severity := systray.NotificationWarning
+	if n.Severity == detection.SeverityHigh || n.Severity == detection.SeverityCritical {
+		severity = systray.NotificationError
+	}
+	(*o.systemTray).ShowNotification(n.Title, n.Message, severity)
+	return nil
+}
+
+// syslogRouted reports whether the notification policy, rather than the
+// syslog section alone, decides which anomalies reach syslog
+func (o *DesktopOrchestrator) syslogRouted() bool {
+	return o.notifier != nil && o.config.Notifications.Syslog.Enabled
+}
+
+// lookupDevice returns a discovered device, or nil when unknown
+func (o *DesktopOrchestrator) lookupDevice(mac string) *database.Device {
+	return o.devicesByMAC()[mac]
+}
+
+// authConfig converts the dashboard authentication settings. API tokens are
+// an Enterprise feature; dashboard logins are available on every tier.
+func (o *DesktopOrchestrator) authConfig() *auth.Config {
+	cfg := auth.DefaultConfig()
+	cfg.SessionTTL = time.Duration(o.config.Visualizer.Auth.SessionHours) * time.Hour
+	cfg.TokensAllowed = func() error {
+		return o.featureGate.CheckAccess(featuregate.FeatureAPIAccess)
+	}
+	if o.config.Visualizer.TLS.Enabled {
+		cfg.PublicPaths = []string{"/api/v1/tls/ca.crt"}
+	}
+	return cfg
+}
+
+// certsConfig converts the dashboard TLS settings
+func (o *DesktopOrchestrator) certsConfig() *certs.Config {
+	cfg := certs.DefaultConfig()
+	cfg.Directory = o.config.Visualizer.TLS.Directory
+	cfg.Hostnames = o.config.Visualizer.TLS.Hostnames
+	cfg.CertFile = o.config.Visualizer.TLS.CertFile
+	cfg.KeyFile = o.config.Visualizer.TLS.KeyFile
+	cfg.HSTS = o.config.Visualizer.TLS.HSTS
+	// Browsers apply HSTS to every port of localhost, so keep it short
+	cfg.HSTSMaxAge = 24 * time.Hour
+	return cfg
+}
+
+// alertingConfig converts the syslog section of the desktop configuration
+func (o *DesktopOrchestrator) alertingConfig() *alerting.Config {
+	cfg := alerting.DefaultConfig()
+	cfg.Address = o.config.Syslog.Address
+	cfg.Protocol = alerting.Protocol(o.config.Syslog.Protocol)
+	cfg.Format = alerting.Format(o.config.Syslog.Format)
+	cfg.CAPath = o.config.Syslog.CAPath
+	if o.config.Syslog.Facility != 0 {
+		cfg.Facility = o.config.Syslog.Facility
+	}
+	if o.config.Syslog.MinSeverity != "" {
+		cfg.MinSeverity = detection.Severity(o.config.Syslog.MinSeverity)
+	}
+	cfg.DeviceEvents = o.config.Syslog.DeviceEvents
+	cfg.Version = sensorconfig.Version
+	return cfg
+}
+
+// threatIntelConfig converts the threat intel feeds from the desktop configuration
+func (o *DesktopOrchestrator) threatIntelConfig() *threatintel.Config {
+	cfg := &threatintel.Config{
+		RefreshInterval: time.Duration(o.config.ThreatIntel.RefreshMinutes) * time.Minute,
+	}
+	for _, feed := range o.config.ThreatIntel.Feeds {
+		cfg.Feeds = append(cfg.Feeds, threatintel.FeedConfig{
+			Name:     feed.Name,
+			Path:     feed.Path,
+			Format:   threatintel.FeedFormat(feed.Format),
+			Severity: detection.Severity(feed.Severity),
+		})
+	}
+	return cfg
+}
+
 // eventNotificationLoop handles anomaly events for notifications
 func (o *DesktopOrchestrator) eventNotificationLoop() {
 	defer o.wg.Done()
@@ -404,7 +895,9 @@ func (o *DesktopOrchestrator) eventNotificationLoop() {
 			return
 		case anomaly := <-o.anomalyChan:
 			// Anomaly detected
-			if o.systemTray != nil {
+			if o.notifier != nil {
+				o.notifier.Notify(alerting.NewAnomalyEvent(anomaly, o.lookupDevice))
+			} else if o.systemTray != nil {
 				severity := systray.NotificationWarning
 				if anomaly.Severity == detection.SeverityHigh || anomaly.Severity == detection.SeverityCritical {
 					severity = systray.NotificationError
@@ -482,6 +975,9 @@ func (o *DesktopOrchestrator) initializeDeviceDiscovery() error {
 
 	statusSink := o.discoveryStatusSink()
 	o.deviceScanner = discovery.NewScanner(provider, o.deviceStore, nil, scanInterval, o.config.Discovery.MDNSEnabled, inactiveTimeout, nil, statusSink)
+	if store, ok := o.deviceStore.(*storageDeviceStore); ok {
+		o.deviceScanner.SetMetadataSource(store.DeviceMetadata)
+	}
 	o.initComponentHealth(o.deviceScanner.Name())
 	o.startDiscoveryStatusMonitor()
 
@@ -504,6 +1000,12 @@ func (o *DesktopOrchestrator) initializeCloudConnector() error {
 	// 1. Creating adapter types to convert desktop.config types to config types
 	// 2. Refactoring cloud package to use interface-based config
 	// 3. Creating a separate desktop cloud connector package
+	//
+	// When wired, Cloud.AnonymizeData must attach corecloud.LoadAnonymizer(o.storage)
+	// to the connector with SetAnonymizer, and a telemetry.Reporter should be
+	// added with SendTelemetry set from Cloud.SendDiagnostics, as the hardware
+	// orchestrator does. A command.Dispatcher could then also handle
+	// set_detector_sensitivity, since the desktop agent runs the detector.
 	
 	return nil
 }
@@ -605,6 +1107,9 @@ func (o *DesktopOrchestrator) shutdown() error {
 	// Signal all goroutines to stop
 	close(o.shutdownCh)
 	o.cancel()
+	if o.configWatchStop != nil {
+		close(o.configWatchStop)
+	}
 
 	// Create a timeout context for shutdown
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -640,6 +1145,9 @@ func (o *DesktopOrchestrator) shutdown() error {
 
 	// 4. Stop Detector (will stop via shutdownCh)
 	o.markComponentRunning("Detector", false)
+	if o.threatMatcher != nil {
+		o.threatMatcher.Stop()
+	}
 
 	// 5. Stop Profiler
 	if o.profilerComp != nil {
@@ -668,6 +1176,28 @@ func (o *DesktopOrchestrator) shutdown() error {
 		o.markComponentRunning(o.cloudOrch.Name(), false)
 	}
 
+	if o.notifier != nil {
+		o.logger.Info("Stopping notification policy...")
+		if err := o.notifier.Stop(); err != nil {
+			o.logger.Warn("Error stopping notification policy: %v", err)
+		}
+		o.markComponentRunning(o.notifier.Name(), false)
+	}
+	if o.alerts != nil {
+		o.logger.Info("Stopping syslog forwarding...")
+		if err := o.alerts.Stop(); err != nil {
+			o.logger.Warn("Error stopping syslog forwarding: %v", err)
+		}
+		o.markComponentRunning(o.alerts.Name(), false)
+	}
+	if o.certs != nil {
+		o.logger.Info("Stopping certificate renewal...")
+		if err := o.certs.Stop(); err != nil {
+			o.logger.Warn("Error stopping certificate renewal: %v", err)
+		}
+		o.markComponentRunning(o.certs.Name(), false)
+	}
+
 	// 8. Stop Device Discovery
 	if o.deviceScanner != nil {
 		o.logger.Info("Stopping device discovery scanner...")
@@ -685,6 +1215,14 @@ func (o *DesktopOrchestrator) shutdown() error {
 		}
 	}
 
+	// Flush and close open recordings
+	if o.recorder != nil {
+		o.logger.Info("Closing packet recorder...")
+		if err := o.recorder.Close(); err != nil {
+			o.logger.Warn("Error closing packet recorder: %v", err)
+		}
+	}
+
 	// Close communication channels
 	o.logger.Info("Closing communication channels...")
 	close(o.packetChan)
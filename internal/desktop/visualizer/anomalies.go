@@ -0,0 +1,127 @@
+package visualizer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/desktop/featuregate"
+)
+
+// AnomalyListResponse represents the JSON response for the anomaly list
+type AnomalyListResponse struct {
+	Anomalies []*detection.StoredAnomaly     `json:"anomalies"`
+	Count     int                            `json:"count"`
+	States    map[detection.AnomalyState]int `json:"states"` // Totals per state, ignoring filters
+}
+
+// AnomalyActionRequest is the optional body of an anomaly triage request
+type AnomalyActionRequest struct {
+	Note string `json:"note"`
+}
+
+// HandleAnomalies handles GET /api/v1/anomalies - list anomalies
+//
+// Query parameters: device, type, severity, state, since (RFC3339), limit
+func (v *Visualizer) HandleAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	if !v.checkAnomalyAccess(w) {
+		return
+	}
+
+	filter, err := detection.ParseAnomalyFilter(r.URL.Query())
+	if err != nil {
+		v.sendError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+
+	anomalies := v.anomalies.List(filter)
+	v.sendJSON(w, http.StatusOK, AnomalyListResponse{
+		Anomalies: anomalies,
+		Count:     len(anomalies),
+		States:    v.anomalies.Counts(),
+	})
+}
+
+// HandleAnomalyByID handles the per-anomaly endpoints:
+//
+//	GET  /api/v1/anomalies/:id         - anomaly details
+//	POST /api/v1/anomalies/:id/:action - acknowledge, resolve, suppress or reopen
+func (v *Visualizer) HandleAnomalyByID(w http.ResponseWriter, r *http.Request) {
+	if !v.checkAnomalyAccess(w) {
+		return
+	}
+
+	// Path format: /api/v1/anomalies/:id[/action]
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/anomalies/")
+	id, action, _ := strings.Cut(path, "/")
+	if id == "" {
+		v.sendError(w, http.StatusBadRequest, "invalid_id", "Anomaly ID is required")
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+			return
+		}
+		anomaly, err := v.anomalies.Get(id)
+		if err != nil {
+			v.sendError(w, http.StatusNotFound, "anomaly_not_found", err.Error())
+			return
+		}
+		v.sendJSON(w, http.StatusOK, anomaly)
+		return
+	}
+
+	state, ok := detection.StateForAction(action)
+	if !ok {
+		v.sendError(w, http.StatusNotFound, "not_found", fmt.Sprintf("Unknown anomaly action: %s", action))
+		return
+	}
+	if r.Method != http.MethodPost {
+		v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	var req AnomalyActionRequest
+	if r.ContentLength != 0 && !v.decodeRequest(w, r, &req) {
+		return
+	}
+
+	anomaly, err := v.anomalies.SetState(id, state, req.Note)
+	if errors.Is(err, detection.ErrAnomalyNotFound) {
+		v.sendError(w, http.StatusNotFound, "anomaly_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[Visualizer] Error applying %s to anomaly %s: %v", action, id, err)
+		v.sendError(w, http.StatusInternalServerError, "storage_error", "Failed to update anomaly")
+		return
+	}
+	v.sendJSON(w, http.StatusOK, anomaly)
+}
+
+// checkAnomalyAccess verifies the anomaly store is available and the tier allows viewing it
+func (v *Visualizer) checkAnomalyAccess(w http.ResponseWriter) bool {
+	if v.anomalies == nil {
+		v.sendError(w, http.StatusServiceUnavailable, "anomalies_disabled", "Anomaly detection is not enabled")
+		return false
+	}
+
+	if v.featureGate != nil {
+		if err := v.featureGate.CheckAccess(featuregate.FeatureNetworkVisibility); err != nil {
+			v.sendError(w, http.StatusForbidden, "access_denied", err.Error())
+			return false
+		}
+	}
+
+	return true
+}
@@ -2,9 +2,11 @@ package visualizer
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
@@ -24,26 +26,58 @@ type DeviceResponse struct {
 	FirstSeen    string   `json:"first_seen"`
 	LastSeen     string   `json:"last_seen"`
 	IsActive     bool     `json:"is_active"`
+
+	Metadata *database.DeviceMetadata `json:"metadata,omitempty"`
 }
 
 // ProfileResponse represents the JSON response for a behavioral profile
 type ProfileResponse struct {
-	MAC            string                      `json:"mac"`
-	Destinations   map[string]*DestinationInfo `json:"destinations"`
-	Ports          map[string]int              `json:"ports"` // Changed to string keys for JSON
-	Protocols      map[string]int              `json:"protocols"`
-	TotalPackets   int64                       `json:"total_packets"`
-	TotalBytes     int64                       `json:"total_bytes"`
-	FirstSeen      string                      `json:"first_seen"`
-	LastSeen       string                      `json:"last_seen"`
-	HourlyActivity [24]int                     `json:"hourly_activity"`
+	MAC            string                        `json:"mac"`
+	Destinations   map[string]*DestinationInfo   `json:"destinations"`
+	Ports          map[string]int                `json:"ports"` // Changed to string keys for JSON
+	Protocols      map[string]int                `json:"protocols"`
+	TotalPackets   int64                         `json:"total_packets"`
+	TotalBytes     int64                         `json:"total_bytes"`
+	FirstSeen      string                        `json:"first_seen"`
+	LastSeen       string                        `json:"last_seen"`
+	HourlyActivity [24]int                       `json:"hourly_activity"`
+	Domains        map[string]*DomainResponse    `json:"domains,omitempty"`
+	DNSQueries     int64                         `json:"dns_queries"`
+	NXDomains      int64                         `json:"nxdomain_responses"`
+	TLSClients     map[string]*TLSClientResponse `json:"tls_clients,omitempty"`
+	Flows          int64                         `json:"flows"`
+	BytesSent      int64                         `json:"bytes_sent"`
+	BytesReceived  int64                         `json:"bytes_received"`
+	LongestFlow    float64                       `json:"longest_flow_seconds"`
 }
 
 // DestinationInfo represents destination information in the API response
 type DestinationInfo struct {
-	IP       string `json:"ip"`
-	Count    int64  `json:"count"`
-	LastSeen string `json:"last_seen"`
+	IP            string `json:"ip"`
+	Domain        string `json:"domain,omitempty"`
+	Count         int64  `json:"count"`
+	LastSeen      string `json:"last_seen"`
+	BytesSent     int64  `json:"bytes_sent,omitempty"`
+	BytesReceived int64  `json:"bytes_received,omitempty"`
+}
+
+// DomainResponse represents a domain the device looked up in the API response
+type DomainResponse struct {
+	Name      string `json:"name"`
+	Count     int64  `json:"count"`
+	NXDomain  int64  `json:"nxdomain"`
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+}
+
+// TLSClientResponse represents a TLS client fingerprint of the device in the API response
+type TLSClientResponse struct {
+	JA4       string   `json:"ja4"`
+	JA3Hash   string   `json:"ja3_hash"`
+	Count     int64    `json:"count"`
+	SNIs      []string `json:"snis,omitempty"`
+	FirstSeen string   `json:"first_seen"`
+	LastSeen  string   `json:"last_seen"`
 }
 
 // TierInfoResponse represents the JSON response for tier information
@@ -85,7 +119,8 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
-// HandleDevices handles GET /api/v1/devices - list all devices
+// HandleDevices handles GET /api/v1/devices - list devices matching the query filters.
+// Requests with a limit or cursor get a page at a time; others get every device.
 func (v *Visualizer) HandleDevices(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET method
 	if r.Method != http.MethodGet {
@@ -101,29 +136,54 @@ func (v *Visualizer) HandleDevices(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Retrieve all devices from storage
-	devices, err := v.getAllDevicesFromStorage()
+	query := r.URL.Query()
+	filter, err := database.ParseDeviceFilter(query)
+	if err != nil {
+		v.sendError(w, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+
+	// Retrieve the requested page of devices from the device index. Clients
+	// that do not page, like dashboards from before paging, get every device.
+	var page *database.DevicePage
+	if query.Has("limit") || query.Has("cursor") {
+		page, err = database.QueryDevices(v.storage, filter)
+	} else {
+		page, err = database.QueryAllDevices(v.storage, filter)
+	}
 	if err != nil {
 		log.Printf("[Visualizer] Error retrieving devices: %v", err)
 		v.sendError(w, http.StatusInternalServerError, "storage_error", "Failed to retrieve devices")
 		return
 	}
 
-	// Convert to response format
-	response := make([]DeviceResponse, 0, len(devices))
-	for _, device := range devices {
-		response = append(response, v.deviceToResponse(device))
+	// Convert to response format, keeping only the selected fields
+	response := make([]interface{}, 0, len(page.Devices))
+	for _, device := range page.Devices {
+		selected, err := filter.SelectFields(v.deviceToResponse(device))
+		if err != nil {
+			log.Printf("[Visualizer] Warning: failed to encode device %s: %v", device.MAC, err)
+			continue
+		}
+		response = append(response, selected)
+	}
+
+	// Paging details travel in headers so the body stays a plain device array
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
 	}
 
 	// Send JSON response
 	v.sendJSON(w, http.StatusOK, response)
 }
 
-// HandleDeviceByMAC handles GET /api/v1/devices/:mac - get device details
+// HandleDeviceByMAC handles GET /api/v1/devices/:mac - get device details,
+// and PATCH /api/v1/devices/:mac - edit the device's metadata
 func (v *Visualizer) HandleDeviceByMAC(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET method
-	if r.Method != http.MethodGet {
-		v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+	// Only allow GET and PATCH methods
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+		v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET and PATCH methods are allowed")
 		return
 	}
 
@@ -143,6 +203,11 @@ func (v *Visualizer) HandleDeviceByMAC(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodPatch {
+		v.updateDeviceMetadata(w, r, mac)
+		return
+	}
+
 	// Retrieve device from storage
 	device, err := v.getDeviceFromStorage(mac)
 	if err != nil {
@@ -158,6 +223,30 @@ func (v *Visualizer) HandleDeviceByMAC(w http.ResponseWriter, r *http.Request) {
 	v.sendJSON(w, http.StatusOK, response)
 }
 
+// updateDeviceMetadata applies the metadata patch in the request body to a device
+func (v *Visualizer) updateDeviceMetadata(w http.ResponseWriter, r *http.Request, mac string) {
+	var patch database.DeviceMetadataPatch
+	if !v.decodeRequest(w, r, &patch) {
+		return
+	}
+
+	device, err := database.UpdateDeviceMetadata(v.storage, mac, &patch, requestUser(r))
+	switch {
+	case errors.Is(err, database.ErrDeviceNotFound):
+		v.sendError(w, http.StatusNotFound, "device_not_found", fmt.Sprintf("Device not found: %s", mac))
+		return
+	case errors.Is(err, database.ErrInvalidMetadata):
+		v.sendError(w, http.StatusBadRequest, "invalid_metadata", err.Error())
+		return
+	case err != nil:
+		log.Printf("[Visualizer] Error updating device %s: %v", mac, err)
+		v.sendError(w, http.StatusInternalServerError, "storage_error", "Failed to update device")
+		return
+	}
+
+	v.sendJSON(w, http.StatusOK, v.deviceToResponse(device))
+}
+
 // HandleProfileByMAC handles GET /api/v1/profiles/:mac - get behavioral profile
 func (v *Visualizer) HandleProfileByMAC(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET method
@@ -328,6 +417,7 @@ func (v *Visualizer) deviceToResponse(device *database.Device) DeviceResponse {
 		FirstSeen:    device.FirstSeen.Format("2006-01-02T15:04:05Z07:00"),
 		LastSeen:     device.LastSeen.Format("2006-01-02T15:04:05Z07:00"),
 		IsActive:     device.IsActive,
+		Metadata:     device.Metadata,
 	}
 }
 
@@ -337,9 +427,37 @@ func (v *Visualizer) profileToResponse(profile *database.BehavioralProfile) Prof
 	destinations := make(map[string]*DestinationInfo)
 	for ip, destInfo := range profile.Destinations {
 		destinations[ip] = &DestinationInfo{
-			IP:       destInfo.IP,
-			Count:    destInfo.Count,
-			LastSeen: destInfo.LastSeen.Format("2006-01-02T15:04:05Z07:00"),
+			IP:            destInfo.IP,
+			Domain:        destInfo.Domain,
+			Count:         destInfo.Count,
+			LastSeen:      destInfo.LastSeen.Format("2006-01-02T15:04:05Z07:00"),
+			BytesSent:     destInfo.BytesSent,
+			BytesReceived: destInfo.BytesReceived,
+		}
+	}
+
+	// Convert looked-up domains
+	domains := make(map[string]*DomainResponse, len(profile.Domains))
+	for name, domain := range profile.Domains {
+		domains[name] = &DomainResponse{
+			Name:      domain.Name,
+			Count:     domain.Count,
+			NXDomain:  domain.NXDomain,
+			FirstSeen: domain.FirstSeen.Format("2006-01-02T15:04:05Z07:00"),
+			LastSeen:  domain.LastSeen.Format("2006-01-02T15:04:05Z07:00"),
+		}
+	}
+
+	// Convert TLS client fingerprints
+	tlsClients := make(map[string]*TLSClientResponse, len(profile.TLSClients))
+	for ja4, client := range profile.TLSClients {
+		tlsClients[ja4] = &TLSClientResponse{
+			JA4:       client.JA4,
+			JA3Hash:   client.JA3Hash,
+			Count:     client.Count,
+			SNIs:      client.SNIs,
+			FirstSeen: client.FirstSeen.Format("2006-01-02T15:04:05Z07:00"),
+			LastSeen:  client.LastSeen.Format("2006-01-02T15:04:05Z07:00"),
 		}
 	}
 
@@ -359,6 +477,14 @@ func (v *Visualizer) profileToResponse(profile *database.BehavioralProfile) Prof
 		FirstSeen:      profile.FirstSeen.Format("2006-01-02T15:04:05Z07:00"),
 		LastSeen:       profile.LastSeen.Format("2006-01-02T15:04:05Z07:00"),
 		HourlyActivity: profile.HourlyActivity,
+		Domains:        domains,
+		DNSQueries:     profile.DNSQueries,
+		NXDomains:      profile.NXDomainResponses,
+		TLSClients:     tlsClients,
+		Flows:          profile.Flows,
+		BytesSent:      profile.BytesSent,
+		BytesReceived:  profile.BytesReceived,
+		LongestFlow:    profile.LongestFlowSeconds,
 	}
 }
 
@@ -372,6 +498,27 @@ func (v *Visualizer) sendJSON(w http.ResponseWriter, statusCode int, data interf
 	}
 }
 
+// maxRequestBody caps the size of JSON request bodies
+const maxRequestBody = 64 << 10
+
+// decodeRequest decodes a JSON request body into dst, rejecting oversized
+// bodies and fields dst does not have. It sends an error and returns false on failure.
+func (v *Visualizer) decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			v.sendError(w, http.StatusRequestEntityTooLarge, "request_too_large", "Request body is too large")
+			return false
+		}
+		v.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
 // sendError sends an error response
 func (v *Visualizer) sendError(w http.ResponseWriter, statusCode int, errorCode string, message string) {
 	response := ErrorResponse{
@@ -0,0 +1,65 @@
+package visualizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/test/mocks"
+)
+
+func TestHandleDevicesListsEveryDeviceWithoutPaging(t *testing.T) {
+	storage := mocks.NewMockStorageProvider()
+	if err := storage.Open("", nil); err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	// More than the default page size and the largest page
+	const count = database.MaxDeviceLimit + 50
+	now := time.Now()
+	for i := 0; i < count; i++ {
+		device := &database.Device{
+			MAC:       fmt.Sprintf("aa:00:00:00:%02x:%02x", i/256, i%256),
+			IP:        fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+			FirstSeen: now,
+			LastSeen:  now.Add(-time.Duration(i) * time.Second),
+		}
+		if err := database.StoreDevice(storage, device); err != nil {
+			t.Fatalf("Failed to store device: %v", err)
+		}
+	}
+	v := &Visualizer{storage: storage}
+
+	list := func(query string) ([]map[string]interface{}, *httptest.ResponseRecorder) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		v.HandleDevices(w, httptest.NewRequest(http.MethodGet, "/api/v1/devices"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %q, got %d: %s", query, w.Code, w.Body.String())
+		}
+		var devices []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &devices); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return devices, w
+	}
+
+	devices, w := list("")
+	if len(devices) != count {
+		t.Errorf("Expected all %d devices, got %d", count, len(devices))
+	}
+	if w.Header().Get("X-Next-Cursor") != "" {
+		t.Error("Expected no cursor when every device is returned")
+	}
+
+	devices, w = list("?limit=100")
+	if len(devices) != 100 || w.Header().Get("X-Next-Cursor") == "" {
+		t.Errorf("Expected a page of 100 devices with a cursor, got %d", len(devices))
+	}
+	if total := w.Header().Get("X-Total-Count"); total != fmt.Sprint(count) {
+		t.Errorf("Expected a total of %d, got %s", count, total)
+	}
+}
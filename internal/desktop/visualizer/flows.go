@@ -0,0 +1,49 @@
+package visualizer
+
+import (
+	"net/http"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	"github.com/mosiko1234/heimdal/sensor/internal/desktop/featuregate"
+)
+
+// FlowListResponse represents the JSON response for the flow list
+type FlowListResponse struct {
+	Flows []*flow.Record `json:"flows"`
+	Count int            `json:"count"`
+	Total int            `json:"total"` // Stored flows, ignoring filters
+}
+
+// HandleFlows handles GET /api/v1/flows - list completed flows
+//
+// Query parameters: device, ip, protocol, port, since (RFC3339), min_bytes, limit
+func (v *Visualizer) HandleFlows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	if v.flows == nil {
+		v.sendError(w, http.StatusServiceUnavailable, "flows_disabled", "Flow tracking is not enabled")
+		return
+	}
+	if v.featureGate != nil {
+		if err := v.featureGate.CheckAccess(featuregate.FeatureNetworkVisibility); err != nil {
+			v.sendError(w, http.StatusForbidden, "access_denied", err.Error())
+			return
+		}
+	}
+
+	filter, err := flow.ParseFilter(r.URL.Query())
+	if err != nil {
+		v.sendError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+
+	flows := v.flows.List(filter)
+	v.sendJSON(w, http.StatusOK, FlowListResponse{
+		Flows: flows,
+		Count: len(flows),
+		Total: v.flows.Count(),
+	})
+}
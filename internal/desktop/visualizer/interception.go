@@ -0,0 +1,135 @@
+package visualizer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/auth"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
+	"github.com/mosiko1234/heimdal/sensor/internal/desktop/featuregate"
+)
+
+// InterceptionTargetRequest is the body of an add interception target request
+type InterceptionTargetRequest struct {
+	MAC string `json:"mac"`
+}
+
+// HandleInterception handles GET /api/v1/interception - interception targets
+// with their spoofing health, and whether interception is paused
+func (v *Visualizer) HandleInterception(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	if !v.checkInterceptionAccess(w) {
+		return
+	}
+
+	v.sendJSON(w, http.StatusOK, v.interception.Status())
+}
+
+// HandleInterceptionAction handles the interception control endpoints:
+//
+//	POST   /api/v1/interception/targets      - start intercepting a device
+//	DELETE /api/v1/interception/targets/:mac - stop intercepting a device
+//	POST   /api/v1/interception/pause        - pause interception of every target
+//	POST   /api/v1/interception/resume       - resume interception
+func (v *Visualizer) HandleInterceptionAction(w http.ResponseWriter, r *http.Request) {
+	if !v.checkInterceptionAccess(w) {
+		return
+	}
+
+	// Path format: /api/v1/interception/:action[/mac]
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/interception/")
+	action, mac, _ := strings.Cut(path, "/")
+	user := requestUser(r)
+
+	switch {
+	case action == "targets" && mac == "":
+		if r.Method != http.MethodPost {
+			v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+			return
+		}
+		var req InterceptionTargetRequest
+		if !v.decodeRequest(w, r, &req) {
+			return
+		}
+		target, err := v.interception.AddTarget(req.MAC, user)
+		if err != nil {
+			v.sendInterceptionError(w, req.MAC, err)
+			return
+		}
+		v.sendJSON(w, http.StatusOK, target)
+
+	case action == "targets":
+		if r.Method != http.MethodDelete {
+			v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE method is allowed")
+			return
+		}
+		if err := v.interception.RemoveTarget(mac, user); err != nil {
+			v.sendInterceptionError(w, mac, err)
+			return
+		}
+		v.sendJSON(w, http.StatusOK, v.interception.Status())
+
+	case (action == "pause" || action == "resume") && mac == "":
+		if r.Method != http.MethodPost {
+			v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+			return
+		}
+		var err error
+		if action == "pause" {
+			err = v.interception.Pause(user)
+		} else {
+			err = v.interception.Resume(user)
+		}
+		if err != nil {
+			log.Printf("[Visualizer] Error saving interception state: %v", err)
+			v.sendError(w, http.StatusInternalServerError, "storage_error", "Failed to save interception state")
+			return
+		}
+		v.sendJSON(w, http.StatusOK, v.interception.Status())
+
+	default:
+		v.sendError(w, http.StatusNotFound, "not_found", fmt.Sprintf("Unknown interception action: %s", path))
+	}
+}
+
+// sendInterceptionError maps an interception controller error to a response
+func (v *Visualizer) sendInterceptionError(w http.ResponseWriter, mac string, err error) {
+	if errors.Is(err, interception.ErrInvalidTarget) {
+		v.sendError(w, http.StatusBadRequest, "invalid_target", err.Error())
+		return
+	}
+	log.Printf("[Visualizer] Error updating interception target %s: %v", mac, err)
+	v.sendError(w, http.StatusInternalServerError, "storage_error", "Failed to update interception target")
+}
+
+// checkInterceptionAccess verifies interception is running and the tier allows it
+func (v *Visualizer) checkInterceptionAccess(w http.ResponseWriter) bool {
+	if v.interception == nil {
+		v.sendError(w, http.StatusServiceUnavailable, "interception_disabled", "Traffic interception is not enabled")
+		return false
+	}
+
+	if v.featureGate != nil {
+		if err := v.featureGate.CheckAccess(featuregate.FeatureTrafficBlocking); err != nil {
+			v.sendError(w, http.StatusForbidden, "access_denied", err.Error())
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestUser returns the name of the authenticated user, if any
+func requestUser(r *http.Request) string {
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		return principal.Username
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package visualizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/desktop/featuregate"
+)
+
+// StartRecordingRequest is the optional body of a start recording request
+type StartRecordingRequest struct {
+	// DurationSeconds stops the recording automatically (0 = until stopped)
+	DurationSeconds int `json:"duration_seconds"`
+}
+
+// HandleRecordings handles GET /api/v1/recordings - list packet recordings
+func (v *Visualizer) HandleRecordings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	if !v.checkRecordingAccess(w) {
+		return
+	}
+
+	recordings, err := v.recorder.List()
+	if err != nil {
+		log.Printf("[Visualizer] Error listing recordings: %v", err)
+		v.sendError(w, http.StatusInternalServerError, "recorder_error", "Failed to list recordings")
+		return
+	}
+
+	v.sendJSON(w, http.StatusOK, recordings)
+}
+
+// HandleRecordingByMAC handles the per-device recording endpoints:
+//
+//	GET  /api/v1/recordings/:mac          - recording state
+//	POST /api/v1/recordings/:mac/start    - start recording
+//	POST /api/v1/recordings/:mac/stop     - stop recording
+//	GET  /api/v1/recordings/:mac/download - download as pcap
+func (v *Visualizer) HandleRecordingByMAC(w http.ResponseWriter, r *http.Request) {
+	if !v.checkRecordingAccess(w) {
+		return
+	}
+
+	// Path format: /api/v1/recordings/:mac[/action]
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
+	mac, action, _ := strings.Cut(path, "/")
+	if mac == "" {
+		v.sendError(w, http.StatusBadRequest, "invalid_mac", "MAC address is required")
+		return
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+			return
+		}
+		status, err := v.recorder.Status(mac)
+		if err != nil {
+			v.sendError(w, http.StatusBadRequest, "invalid_mac", err.Error())
+			return
+		}
+		v.sendJSON(w, http.StatusOK, status)
+
+	case "start":
+		if r.Method != http.MethodPost {
+			v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+			return
+		}
+		var req StartRecordingRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				v.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+				return
+			}
+		}
+		if req.DurationSeconds < 0 {
+			v.sendError(w, http.StatusBadRequest, "invalid_request", "duration_seconds cannot be negative")
+			return
+		}
+		status, err := v.recorder.Start(mac, time.Duration(req.DurationSeconds)*time.Second)
+		if err != nil {
+			log.Printf("[Visualizer] Error starting recording for %s: %v", mac, err)
+			v.sendError(w, http.StatusBadRequest, "recorder_error", err.Error())
+			return
+		}
+		v.sendJSON(w, http.StatusOK, status)
+
+	case "stop":
+		if r.Method != http.MethodPost {
+			v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+			return
+		}
+		status, err := v.recorder.Stop(mac)
+		if err != nil {
+			v.sendError(w, http.StatusNotFound, "recording_not_found", err.Error())
+			return
+		}
+		v.sendJSON(w, http.StatusOK, status)
+
+	case "download":
+		if r.Method != http.MethodGet {
+			v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+			return
+		}
+		v.downloadRecording(w, mac)
+
+	default:
+		v.sendError(w, http.StatusNotFound, "not_found", fmt.Sprintf("Unknown recording action: %s", action))
+	}
+}
+
+// downloadRecording streams a device recording as a single pcap file
+func (v *Visualizer) downloadRecording(w http.ResponseWriter, mac string) {
+	status, err := v.recorder.Status(mac)
+	if err != nil {
+		v.sendError(w, http.StatusBadRequest, "invalid_mac", err.Error())
+		return
+	}
+	if status.Files == 0 {
+		v.sendError(w, http.StatusNotFound, "recording_not_found", fmt.Sprintf("No recording found for %s", status.MAC))
+		return
+	}
+
+	// Recordings can be large; lift the server write timeout for this response
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[Visualizer] Warning: failed to extend write deadline: %v", err)
+	}
+
+	filename := fmt.Sprintf("heimdal-%s-%s.pcap",
+		strings.ReplaceAll(status.MAC, ":", ""), time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	if err := v.recorder.WritePcap(status.MAC, w); err != nil {
+		log.Printf("[Visualizer] Error streaming recording for %s: %v", status.MAC, err)
+	}
+}
+
+// checkRecordingAccess verifies the recorder is available and the tier allows recording
+func (v *Visualizer) checkRecordingAccess(w http.ResponseWriter) bool {
+	if v.recorder == nil {
+		v.sendError(w, http.StatusServiceUnavailable, "recorder_disabled", "Packet recording is not enabled")
+		return false
+	}
+
+	// Recording captures intercepted traffic, so it follows the interception tier
+	if v.featureGate != nil {
+		if err := v.featureGate.CheckAccess(featuregate.FeatureTrafficBlocking); err != nil {
+			v.sendError(w, http.StatusForbidden, "access_denied", err.Error())
+			return false
+		}
+	}
+
+	return true
+}
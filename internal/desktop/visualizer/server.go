@@ -3,6 +3,9 @@
 // The LocalVisualizer serves a web-based interface for network visualization,
 // device management, and real-time traffic monitoring. It provides both HTTP
 // endpoints for the dashboard UI and REST API endpoints for device data.
+// When an auth.Manager is configured, the API and WebSocket require a session
+// cookie or API token; the dashboard's static files stay public. When a
+// certs.Manager is configured, everything is served over HTTPS.
 package visualizer
 
 import (
@@ -10,29 +13,46 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/mosiko1234/heimdal/sensor/internal/core/auth"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/certs"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/recorder"
 	"github.com/mosiko1234/heimdal/sensor/internal/desktop/featuregate"
 	"github.com/mosiko1234/heimdal/sensor/internal/platform"
 )
 
 // Visualizer serves the local web dashboard
 type Visualizer struct {
-	server      *http.Server
-	storage     platform.StorageProvider
-	featureGate *featuregate.FeatureGate
-	wsHub       *WebSocketHub
-	port        int
-	mu          sync.RWMutex
-	running     bool
+	server       *http.Server
+	storage      platform.StorageProvider
+	featureGate  *featuregate.FeatureGate
+	recorder     *recorder.Recorder
+	anomalies    *detection.AnomalyStore
+	flows        *flow.Store
+	interception *interception.Controller
+	wsHub        *WebSocketHub
+	port         int
+	mu           sync.RWMutex
+	running      bool
 }
 
 // Config contains configuration for the visualizer
 type Config struct {
-	Port        int
-	Storage     platform.StorageProvider
-	FeatureGate *featuregate.FeatureGate
+	Port         int
+	Storage      platform.StorageProvider
+	FeatureGate  *featuregate.FeatureGate
+	Recorder     *recorder.Recorder       // Optional: enables packet recording endpoints
+	Anomalies    *detection.AnomalyStore  // Optional: enables anomaly endpoints
+	Flows        *flow.Store              // Optional: enables flow endpoints
+	Interception *interception.Controller // Optional: enables interception control endpoints
+	Auth         *auth.Manager            // Optional: requires authentication
+	TLS          *certs.Manager           // Optional: serves HTTPS
 }
 
 // NewVisualizer creates a new LocalVisualizer instance
@@ -51,24 +71,41 @@ func NewVisualizer(cfg *Config) (*Visualizer, error) {
 	wsHub := NewWebSocketHub()
 
 	v := &Visualizer{
-		storage:     cfg.Storage,
-		featureGate: cfg.FeatureGate,
-		wsHub:       wsHub,
-		port:        cfg.Port,
-		running:     false,
+		storage:      cfg.Storage,
+		featureGate:  cfg.FeatureGate,
+		recorder:     cfg.Recorder,
+		anomalies:    cfg.Anomalies,
+		flows:        cfg.Flows,
+		interception: cfg.Interception,
+		wsHub:        wsHub,
+		port:         cfg.Port,
+		running:      false,
 	}
 
 	// Create HTTP server with configured routes
 	mux := http.NewServeMux()
 	v.setupRoutes(mux)
 
+	var handler http.Handler = mux
+	if cfg.Auth != nil {
+		mux.Handle(auth.AuthPath, cfg.Auth.Handler())
+		handler = cfg.Auth.Middleware(mux)
+	}
+	if cfg.TLS != nil {
+		mux.HandleFunc("/api/v1/tls/ca.crt", cfg.TLS.HandleCA)
+		handler = cfg.TLS.HSTS(handler)
+	}
+
 	v.server = &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      mux,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	if cfg.TLS != nil {
+		v.server.TLSConfig = cfg.TLS.TLSConfig()
+	}
 
 	return v, nil
 }
@@ -79,8 +116,16 @@ func (v *Visualizer) setupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/devices", v.HandleDevices)
 	mux.HandleFunc("/api/v1/devices/", v.HandleDeviceByMAC)
 	mux.HandleFunc("/api/v1/profiles/", v.HandleProfileByMAC)
+	mux.HandleFunc("/api/v1/traffic/", v.HandleTrafficByMAC)
 	mux.HandleFunc("/api/v1/tier", v.HandleTierInfo)
 	mux.HandleFunc("/api/v1/topology", v.HandleTopology)
+	mux.HandleFunc("/api/v1/recordings", v.HandleRecordings)
+	mux.HandleFunc("/api/v1/recordings/", v.HandleRecordingByMAC)
+	mux.HandleFunc("/api/v1/anomalies", v.HandleAnomalies)
+	mux.HandleFunc("/api/v1/anomalies/", v.HandleAnomalyByID)
+	mux.HandleFunc("/api/v1/flows", v.HandleFlows)
+	mux.HandleFunc("/api/v1/interception", v.HandleInterception)
+	mux.HandleFunc("/api/v1/interception/", v.HandleInterceptionAction)
 
 	// WebSocket endpoint for real-time updates
 	mux.HandleFunc("/ws", v.handleWebSocket)
@@ -100,19 +145,29 @@ func (v *Visualizer) Start() error {
 	v.running = true
 	v.mu.Unlock()
 
-	log.Printf("[Visualizer] Starting HTTP server on port %d...", v.port)
+	scheme := "http"
+	if v.server.TLSConfig != nil {
+		scheme = "https"
+	}
+	log.Printf("[Visualizer] Starting %s server on port %d...", strings.ToUpper(scheme), v.port)
 
 	// Start WebSocket hub
 	go v.wsHub.Run()
 
 	// Start HTTP server in a goroutine
 	go func() {
-		if err := v.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if v.server.TLSConfig != nil {
+			err = v.server.ListenAndServeTLS("", "")
+		} else {
+			err = v.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Printf("[Visualizer] HTTP server error: %v", err)
 		}
 	}()
 
-	log.Printf("[Visualizer] Dashboard available at http://localhost:%d", v.port)
+	log.Printf("[Visualizer] Dashboard available at %s://localhost:%d", scheme, v.port)
 	return nil
 }
 
@@ -173,6 +228,11 @@ func (v *Visualizer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Path == "/login.html" {
+		http.ServeFile(w, r, "web/dashboard/login.html")
+		return
+	}
+
 	// Serve other static files (CSS, JS)
 	if r.URL.Path == "/styles.css" {
 		w.Header().Set("Content-Type", "text/css")
@@ -0,0 +1,94 @@
+package visualizer
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/profiler"
+	"github.com/mosiko1234/heimdal/sensor/internal/desktop/featuregate"
+)
+
+// defaultTrafficWindow is the window returned when no range is requested
+const defaultTrafficWindow = time.Hour
+
+// HandleTrafficByMAC handles GET /api/v1/traffic/:mac - bucketed device traffic.
+//
+// The window is selected with either ?window=<duration> (e.g. 1h, 168h) ending now,
+// or ?start=<RFC3339>&end=<RFC3339>. Defaults to the last hour.
+func (v *Visualizer) HandleTrafficByMAC(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		v.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	// Check feature gate access
+	if v.featureGate != nil {
+		if err := v.featureGate.CheckAccess(featuregate.FeatureNetworkVisibility); err != nil {
+			v.sendError(w, http.StatusForbidden, "access_denied", err.Error())
+			return
+		}
+	}
+
+	// Extract MAC address from URL path
+	// Path format: /api/v1/traffic/:mac
+	mac := strings.TrimPrefix(r.URL.Path, "/api/v1/traffic/")
+	if mac == "" {
+		v.sendError(w, http.StatusBadRequest, "invalid_mac", "MAC address is required")
+		return
+	}
+
+	start, end, err := parseTrafficWindow(r)
+	if err != nil {
+		v.sendError(w, http.StatusBadRequest, "invalid_window", err.Error())
+		return
+	}
+
+	window, err := profiler.QueryTraffic(v.storage, mac, start, end)
+	if err != nil {
+		log.Printf("[Visualizer] Error retrieving traffic for %s: %v", mac, err)
+		v.sendError(w, http.StatusNotFound, "traffic_not_found", fmt.Sprintf("Traffic history not found: %s", mac))
+		return
+	}
+
+	v.sendJSON(w, http.StatusOK, window)
+}
+
+// parseTrafficWindow extracts the requested time range from query parameters
+func parseTrafficWindow(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	end := time.Now()
+
+	if raw := query.Get("end"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end time: %s", raw)
+		}
+		end = parsed
+	}
+
+	if raw := query.Get("start"); raw != "" {
+		start, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start time: %s", raw)
+		}
+		if !end.After(start) {
+			return time.Time{}, time.Time{}, fmt.Errorf("end must be after start")
+		}
+		return start, end, nil
+	}
+
+	window := defaultTrafficWindow
+	if raw := query.Get("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid window: %s", raw)
+		}
+		window = parsed
+	}
+
+	return end.Add(-window), end, nil
+}
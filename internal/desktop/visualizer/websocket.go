@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/auth"
 )
 
 // UpdateMessage represents a real-time update sent to WebSocket clients
@@ -39,11 +40,9 @@ type WebSocketHub struct {
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins for local dashboard
-		// In production, this should be more restrictive
-		return true
-	},
+	// Only the dashboard itself (or a non-browser client) may connect, so
+	// other sites cannot ride on the session cookie
+	CheckOrigin: auth.CheckOrigin,
 }
 
 const (
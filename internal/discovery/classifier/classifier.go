@@ -2,22 +2,33 @@ package classifier
 
 import (
 	"strings"
+	"sync"
 )
 
 // Classifier classifies devices based on multiple signals
 type Classifier struct {
-	// Future: could add ML models, custom rules, etc.
+	// TLS fingerprint (JA4) -> MAC -> type of confidently classified devices
+	fingerprints   map[string]map[string]DeviceType
+	fingerprintsMu sync.RWMutex
 }
 
 // NewClassifier creates a new device classifier
 func NewClassifier() *Classifier {
-	return &Classifier{}
+	return &Classifier{
+		fingerprints: make(map[string]map[string]DeviceType),
+	}
 }
 
 // ClassifyDevice determines the device type based on available information
 // It combines signals from vendor, hostname, and mDNS services with weighted confidence
 func (c *Classifier) ClassifyDevice(vendor, manufacturer, hostname string, services []string) *DeviceInfo {
-	signals := make([]string, 0, 4)
+	return c.ClassifyWithFingerprints("", vendor, manufacturer, hostname, services, nil)
+}
+
+// ClassifyWithFingerprints classifies a device like ClassifyDevice, adding the
+// types of other devices that share its TLS client fingerprints as a signal
+func (c *Classifier) ClassifyWithFingerprints(mac, vendor, manufacturer, hostname string, services, fingerprints []string) *DeviceInfo {
+	signals := make([]string, 0, 5)
 	var totalConfidence float64
 	var weightedType map[DeviceType]float64 = make(map[DeviceType]float64)
 
@@ -46,6 +57,13 @@ func (c *Classifier) ClassifyDevice(vendor, manufacturer, hostname string, servi
 		signals = append(signals, "mdns_service")
 	}
 
+	// Signal 4: TLS client fingerprints shared with classified devices
+	if deviceType, confidence, matched := c.matchFingerprints(mac, fingerprints); matched {
+		weightedType[deviceType] += confidence * 1.5
+		totalConfidence += confidence * 1.5
+		signals = append(signals, "tls_fingerprint")
+	}
+
 	// Find device type with highest weighted score
 	var finalType DeviceType = DeviceTypeUnknown
 	var maxWeight float64 = 0
@@ -170,3 +170,34 @@ func BenchmarkClassifyDevice(b *testing.B) {
 		c.ClassifyDevice("Apple", "Apple Inc.", "Johns-iPhone", []string{"_airplay._tcp"})
 	}
 }
+
+func TestClassifyWithFingerprints(t *testing.T) {
+	c := NewClassifier()
+	fingerprint := "t12d1209h1_3b5074b1b5d0_a1e935682795"
+
+	// An unnamed device has nothing to go on
+	result := c.ClassifyWithFingerprints("aa:00:00:00:00:09", "", "", "", nil, []string{fingerprint})
+	if result.Type != DeviceTypeUnknown {
+		t.Fatalf("Expected unknown type before any fingerprints are learned, got %s", result.Type)
+	}
+
+	for _, mac := range []string{"aa:00:00:00:00:01", "aa:00:00:00:00:02", "aa:00:00:00:00:03"} {
+		c.LearnFingerprints(mac, DeviceTypeCamera, []string{fingerprint})
+	}
+
+	result = c.ClassifyWithFingerprints("aa:00:00:00:00:09", "", "", "", nil, []string{fingerprint})
+	if result.Type != DeviceTypeCamera {
+		t.Errorf("Expected camera from shared fingerprint, got %s", result.Type)
+	}
+	if len(result.Signals) != 1 || result.Signals[0] != "tls_fingerprint" {
+		t.Errorf("Expected tls_fingerprint signal, got %v", result.Signals)
+	}
+
+	// A device never confirms its own learned type
+	c = NewClassifier()
+	c.LearnFingerprints("aa:00:00:00:00:01", DeviceTypeCamera, []string{fingerprint})
+	result = c.ClassifyWithFingerprints("aa:00:00:00:00:01", "", "", "", nil, []string{fingerprint})
+	if result.Type != DeviceTypeUnknown {
+		t.Errorf("Expected device not to match its own fingerprints, got %s", result.Type)
+	}
+}
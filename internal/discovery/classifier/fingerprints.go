@@ -0,0 +1,77 @@
+package classifier
+
+// MinLearnConfidence is the classification confidence, from signals other than
+// TLS fingerprints, required before a device's fingerprints are learned
+const MinLearnConfidence = 0.5
+
+// minFingerprintDevices is the number of classified devices sharing a
+// fingerprint needed for the fingerprint signal to reach full confidence
+const minFingerprintDevices = 3
+
+// LearnFingerprints records the TLS client fingerprints (JA4) of a device
+// whose type is known from other signals. Devices sharing a fingerprint
+// usually run the same firmware, so the type can later be inferred for
+// devices whose vendor and hostname are uninformative. A later call for the
+// same MAC replaces its earlier entry.
+func (c *Classifier) LearnFingerprints(mac string, deviceType DeviceType, fingerprints []string) {
+	if mac == "" || deviceType == DeviceTypeUnknown {
+		return
+	}
+
+	c.fingerprintsMu.Lock()
+	defer c.fingerprintsMu.Unlock()
+
+	for _, devices := range c.fingerprints {
+		delete(devices, mac)
+	}
+	for _, fingerprint := range fingerprints {
+		devices, ok := c.fingerprints[fingerprint]
+		if !ok {
+			devices = make(map[string]DeviceType)
+			c.fingerprints[fingerprint] = devices
+		}
+		devices[mac] = deviceType
+	}
+}
+
+// matchFingerprints votes on a device type using the types of other devices
+// sharing the given fingerprints. mac is excluded so a device never confirms itself.
+func (c *Classifier) matchFingerprints(mac string, fingerprints []string) (DeviceType, float64, bool) {
+	if len(fingerprints) == 0 {
+		return DeviceTypeUnknown, 0, false
+	}
+
+	c.fingerprintsMu.RLock()
+	defer c.fingerprintsMu.RUnlock()
+
+	votes := make(map[DeviceType]int)
+	total := 0
+	for _, fingerprint := range fingerprints {
+		for other, deviceType := range c.fingerprints[fingerprint] {
+			if other == mac {
+				continue
+			}
+			votes[deviceType]++
+			total++
+		}
+	}
+	if total == 0 {
+		return DeviceTypeUnknown, 0, false
+	}
+
+	var bestMatch DeviceType
+	var bestVotes int
+	for deviceType, count := range votes {
+		if count > bestVotes || (count == bestVotes && deviceType < bestMatch) {
+			bestMatch = deviceType
+			bestVotes = count
+		}
+	}
+
+	// Agreement between the sharing devices, discounted while few are known
+	confidence := float64(bestVotes) / float64(total)
+	if total < minFingerprintDevices {
+		confidence *= float64(total) / minFingerprintDevices
+	}
+	return bestMatch, confidence, true
+}
@@ -20,6 +20,7 @@
 //   - Marks devices inactive if not seen within timeout period (default: 5 minutes)
 //   - Updates database immediately on discovery or status change
 //   - Sends discovered devices to deviceChan for traffic interception
+//   - Reports new, seen and inactive transitions to an optional DeviceEventSink
 //
 // The Scanner implements the Component interface for lifecycle management by the orchestrator.
 package discovery
@@ -58,6 +59,31 @@ type StatusUpdate struct {
 // StatusSink receives scanner status updates.
 type StatusSink func(StatusUpdate)
 
+// DeviceEventType identifies a device lifecycle transition. The event types
+// live in the database package so consumers need not import discovery.
+type DeviceEventType = database.DeviceEventType
+
+const (
+	DeviceEventNew      = database.DeviceEventNew
+	DeviceEventSeen     = database.DeviceEventSeen
+	DeviceEventInactive = database.DeviceEventInactive
+)
+
+// DeviceEvent describes a device lifecycle transition observed by the scanner.
+type DeviceEvent = database.DeviceEvent
+
+// DeviceEventSink receives device lifecycle events. It is called outside the
+// scanner's locks and must not block.
+type DeviceEventSink func(DeviceEvent)
+
+// FingerprintSource returns the TLS client fingerprints (JA4) observed for a
+// device, used as an extra classification signal. It must not block.
+type FingerprintSource func(mac string) []string
+
+// MetadataSource returns the user-edited metadata of a device, or nil. A
+// manual device type in it replaces classification. It must not block.
+type MetadataSource func(mac string) *database.DeviceMetadata
+
 // ScannerOptions exposes tuning knobs for discovery behavior.
 type ScannerOptions struct {
 	ARPReplyTimeout  time.Duration
@@ -90,6 +116,9 @@ type Scanner struct {
 	logger          *logger.Logger
 	options         *ScannerOptions
 	statusSink      StatusSink
+	eventSink       DeviceEventSink
+	fingerprints    FingerprintSource
+	metadata        MetadataSource
 
 	// Device enrichment
 	ouiLookup        *oui.OUILookup
@@ -101,6 +130,9 @@ type Scanner struct {
 	deviceServices map[string][]string         // MAC -> mDNS services
 	devicesMu      sync.RWMutex
 
+	// rescanCh requests an ARP scan ahead of schedule
+	rescanCh chan struct{}
+
 	// Lifecycle management
 	ctx       context.Context
 	cancel    context.CancelFunc
@@ -146,6 +178,7 @@ func NewScanner(netConfig NetworkConfigProvider, db database.DeviceStore, device
 		hostnameResolver: hostnameResolver,
 		devices:          make(map[string]*database.Device),
 		deviceServices:   make(map[string][]string),
+		rescanCh:         make(chan struct{}, 1),
 		ctx:              ctx,
 		cancel:           cancel,
 	}
@@ -244,6 +277,65 @@ func (s *Scanner) reportStatus(level StatusLevel, format string, args ...interfa
 	})
 }
 
+// SetDeviceEventSink registers a receiver for device lifecycle events.
+// Must be called before Start.
+func (s *Scanner) SetDeviceEventSink(sink DeviceEventSink) {
+	s.eventSink = sink
+}
+
+// SetFingerprintSource registers a lookup of TLS client fingerprints per
+// device for classification. Must be called before Start.
+func (s *Scanner) SetFingerprintSource(source FingerprintSource) {
+	s.fingerprints = source
+}
+
+// SetMetadataSource registers a lookup of user-edited device metadata, so
+// events carry it and manual device types are respected. Must be called
+// before Start.
+func (s *Scanner) SetMetadataSource(source MetadataSource) {
+	s.metadata = source
+}
+
+// overridden reports whether the device has a manual device type
+func overridden(device *database.Device) bool {
+	return device.Metadata != nil && device.Metadata.DeviceType != ""
+}
+
+// classify determines a device's type from its enrichment data and the TLS
+// fingerprints it shares with other devices
+func (s *Scanner) classify(device *database.Device, services []string) *classifier.DeviceInfo {
+	var fingerprints []string
+	if s.fingerprints != nil {
+		fingerprints = s.fingerprints(device.MAC)
+	}
+
+	s.learnFingerprints(device, services, fingerprints)
+	return s.classifier.ClassifyWithFingerprints(device.MAC, device.Vendor, device.Manufacturer, device.Name, services, fingerprints)
+}
+
+// learnFingerprints teaches the classifier the TLS fingerprints of a device
+// whose type is clear from its vendor, hostname and services alone
+func (s *Scanner) learnFingerprints(device *database.Device, services []string, fingerprints []string) {
+	if len(fingerprints) == 0 {
+		return
+	}
+	classInfo := s.classifier.ClassifyDevice(device.Vendor, device.Manufacturer, device.Name, services)
+	if classInfo.Confidence >= classifier.MinLearnConfidence {
+		s.classifier.LearnFingerprints(device.MAC, classInfo.Type, fingerprints)
+	}
+}
+
+func (s *Scanner) emitDeviceEvent(eventType DeviceEventType, device database.Device, at time.Time) {
+	if s.eventSink == nil {
+		return
+	}
+	s.eventSink(DeviceEvent{
+		Type:   eventType,
+		Device: device,
+		Time:   at,
+	})
+}
+
 // Name returns the component name
 func (s *Scanner) Name() string {
 	return "DeviceDiscoveryScanner"
@@ -260,6 +352,10 @@ func (s *Scanner) loadExistingDevices() error {
 	defer s.devicesMu.Unlock()
 
 	for _, device := range devices {
+		if overridden(device) {
+			// The stored type is the manual one; classify the device afresh
+			device.DeviceType = ""
+		}
 		s.devices[device.MAC] = device
 	}
 
@@ -271,11 +367,19 @@ func (s *Scanner) loadExistingDevices() error {
 func (s *Scanner) updateDevice(mac, ip, name, vendor string) {
 	now := time.Now()
 
+	var metadata *database.DeviceMetadata
+	if s.metadata != nil {
+		metadata = s.metadata(mac)
+	}
+
 	s.devicesMu.Lock()
 	device, exists := s.devices[mac]
 
 	if exists {
 		// Update existing device
+		if s.metadata != nil {
+			device.Metadata = metadata
+		}
 		device.IP = ip
 		device.LastSeen = now
 		device.IsActive = true
@@ -306,13 +410,18 @@ func (s *Scanner) updateDevice(mac, ip, name, vendor string) {
 			}
 		}
 
-		// Re-classify if device type missing
-		if device.DeviceType == "" && s.classifier != nil {
+		// Re-classify if device type missing, or still unknown once TLS fingerprints may help,
+		// unless the user set the type
+		unknown := device.DeviceType == string(classifier.DeviceTypeUnknown) && s.fingerprints != nil
+		if !overridden(device) && (device.DeviceType == "" || unknown) && s.classifier != nil {
 			services := s.deviceServices[mac]
-			classInfo := s.classifier.ClassifyDevice(device.Vendor, device.Manufacturer, device.Name, services)
+			classInfo := s.classify(device, services)
 			device.DeviceType = string(classInfo.Type)
 			device.Services = services
 			s.logger.Debug("Re-classified existing device %s as %s", mac, classInfo.Type)
+		} else if s.fingerprints != nil && s.classifier != nil {
+			// Fingerprints appear once the device has sent traffic, after its first classification
+			s.learnFingerprints(device, s.deviceServices[mac], s.fingerprints(mac))
 		}
 	} else {
 		// Create new device
@@ -324,6 +433,7 @@ func (s *Scanner) updateDevice(mac, ip, name, vendor string) {
 			FirstSeen: now,
 			LastSeen:  now,
 			IsActive:  true,
+			Metadata:  metadata,
 		}
 		s.devices[mac] = device
 
@@ -340,11 +450,11 @@ func (s *Scanner) updateDevice(mac, ip, name, vendor string) {
 		}
 
 		// Classify device type
-		if s.classifier != nil {
+		if s.classifier != nil && !overridden(device) {
 			// Get services for this device
 			services := s.deviceServices[mac]
 
-			classInfo := s.classifier.ClassifyDevice(device.Vendor, device.Manufacturer, device.Name, services)
+			classInfo := s.classify(device, services)
 			device.DeviceType = string(classInfo.Type)
 			device.Services = services
 			s.logger.Debug("Classified device %s as %s (confidence: %.2f, signals: %v)",
@@ -352,10 +462,16 @@ func (s *Scanner) updateDevice(mac, ip, name, vendor string) {
 		}
 	}
 
-	// Make a copy for sending
-	deviceCopy := *device
+	// Make a copy for sending, with any manual device type applied
+	deviceCopy := database.WithMetadata(device, device.Metadata)
 	s.devicesMu.Unlock()
 
+	if exists {
+		s.emitDeviceEvent(DeviceEventSeen, deviceCopy, now)
+	} else {
+		s.emitDeviceEvent(DeviceEventNew, deviceCopy, now)
+	}
+
 	// Save to database immediately
 	if err := s.db.SaveDevice(&deviceCopy); err != nil {
 		s.logger.Error("Error saving device %s to database: %v", mac, err)
@@ -397,11 +513,11 @@ func (s *Scanner) checkInactiveDevices() {
 	inactiveThreshold := now.Add(-s.inactiveTimeout)
 
 	s.devicesMu.Lock()
-	defer s.devicesMu.Unlock()
-
+	var inactive []database.Device
 	for mac, device := range s.devices {
 		if device.IsActive && device.LastSeen.Before(inactiveThreshold) {
 			device.IsActive = false
+			inactive = append(inactive, database.WithMetadata(device, device.Metadata))
 
 			// Save updated status to database
 			if err := s.db.SaveDevice(device); err != nil {
@@ -411,6 +527,11 @@ func (s *Scanner) checkInactiveDevices() {
 			}
 		}
 	}
+	s.devicesMu.Unlock()
+
+	for _, device := range inactive {
+		s.emitDeviceEvent(DeviceEventInactive, device, now)
+	}
 }
 
 // arpScanLoop runs ARP scanning at regular intervals
@@ -429,10 +550,30 @@ func (s *Scanner) arpScanLoop() {
 			return
 		case <-ticker.C:
 			s.runARPScanWithRetry()
+		case <-s.rescanCh:
+			s.runARPScanWithRetry()
+			ticker.Reset(s.scanInterval)
 		}
 	}
 }
 
+// Rescan requests an ARP scan now instead of at the next interval. It returns
+// immediately; requests made while one is already pending are merged.
+func (s *Scanner) Rescan() error {
+	s.runningMu.Lock()
+	running := s.running
+	s.runningMu.Unlock()
+	if !running {
+		return fmt.Errorf("scanner not running")
+	}
+
+	select {
+	case s.rescanCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
 func (s *Scanner) runARPScanWithRetry() {
 	attempts := s.options.ARPMaxAttempts
 	if attempts < 1 {
@@ -0,0 +1,134 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/command"
+	"github.com/mosiko1234/heimdal/sensor/internal/logger"
+)
+
+// commandUser is recorded as the author of changes made by cloud commands
+const commandUser = "cloud"
+
+// initializeCommands creates the command dispatcher and connects it to the
+// configured command channel: the HTTP long-poll endpoint when one is set,
+// otherwise the cloud connector's own subscription
+func (o *HardwareOrchestrator) initializeCommands(cloudOrch *cloud.Orchestrator) error {
+	cfg := command.DefaultConfig()
+	cfg.SensorID = o.cloudSensorID()
+	for _, encoded := range o.config.Cloud.Commands.PublicKeys {
+		key, err := schemas.ParsePublicKey(encoded)
+		if err != nil {
+			return err
+		}
+		cfg.PublicKeys = append(cfg.PublicKeys, key)
+	}
+
+	dispatcher, err := command.NewDispatcher(cloudOrch, cfg)
+	if err != nil {
+		return err
+	}
+	o.registerCommandHandlers(dispatcher, cloudOrch)
+
+	if pollURL := o.config.Cloud.Commands.PollURL; pollURL != "" {
+		pollCfg := corecloud.DefaultLongPollConfig()
+		pollCfg.URL = pollURL
+		pollCfg.SensorID = cfg.SensorID
+		poller := &longPollComponent{config: pollCfg, handler: dispatcher.Deliver}
+		o.components = append(o.components, poller)
+		o.initComponentHealth(poller.Name())
+	} else if err := cloudOrch.SubscribeCommands(dispatcher.Deliver); err != nil {
+		return err
+	}
+
+	o.components = append(o.components, dispatcher)
+	o.initComponentHealth(dispatcher.Name())
+	o.logger.Info("Cloud commands enabled for sensor %s", cfg.SensorID)
+	return nil
+}
+
+// registerCommandHandlers registers a handler for every command this sensor
+// can perform. The hardware sensor runs no statistical anomaly detector, so
+// set_detector_sensitivity is left unregistered and rejected as unsupported.
+func (o *HardwareOrchestrator) registerCommandHandlers(dispatcher *command.Dispatcher, cloudOrch *cloud.Orchestrator) {
+	dispatcher.Register(schemas.CommandRescan, func(ctx context.Context, cmd *schemas.Command) (map[string]interface{}, error) {
+		return nil, o.scanner.Rescan()
+	})
+
+	if o.interception != nil {
+		dispatcher.Register(schemas.CommandAddInterceptTarget, func(ctx context.Context, cmd *schemas.Command) (map[string]interface{}, error) {
+			var params schemas.InterceptTargetParams
+			if err := cmd.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+			// A device whose address is not known yet is picked up when
+			// discovery next reports it
+			target, err := o.interception.AddTarget(params.MAC, commandUser)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"address_known": target.IP != ""}, nil
+		})
+		dispatcher.Register(schemas.CommandRemoveInterceptTarget, func(ctx context.Context, cmd *schemas.Command) (map[string]interface{}, error) {
+			var params schemas.InterceptTargetParams
+			if err := cmd.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+			return nil, o.interception.RemoveTarget(params.MAC, commandUser)
+		})
+	}
+
+	dispatcher.Register(schemas.CommandProfileSnapshot, func(ctx context.Context, cmd *schemas.Command) (map[string]interface{}, error) {
+		var params schemas.ProfileSnapshotParams
+		if len(cmd.Params) > 0 {
+			if err := cmd.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+		}
+		sent, err := cloudOrch.SendSnapshot(params.MACs)
+		return map[string]interface{}{"records_sent": sent}, err
+	})
+
+	dispatcher.Register(schemas.CommandRotateLogs, func(ctx context.Context, cmd *schemas.Command) (map[string]interface{}, error) {
+		rotated, err := logger.Rotate()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"rotated_file": rotated}, nil
+	})
+}
+
+// longPollComponent runs an HTTP long poller for the lifetime of the sensor
+type longPollComponent struct {
+	config  *corecloud.LongPollConfig
+	handler func([]byte)
+	poller  *corecloud.LongPoller
+}
+
+func (l *longPollComponent) Start() error {
+	if l.poller != nil {
+		return fmt.Errorf("command poller already running")
+	}
+	poller, err := corecloud.NewLongPoller(l.config, l.handler)
+	if err != nil {
+		return err
+	}
+	l.poller = poller
+	return nil
+}
+
+func (l *longPollComponent) Stop() error {
+	if l.poller != nil {
+		l.poller.Stop()
+		l.poller = nil
+	}
+	return nil
+}
+
+func (l *longPollComponent) Name() string {
+	return "Command Poller"
+}
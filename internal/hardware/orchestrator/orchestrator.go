@@ -20,8 +20,21 @@ import (
 	"github.com/mosiko1234/heimdal/sensor/internal/cloud"
 	"github.com/mosiko1234/heimdal/sensor/internal/cloud/aws"
 	"github.com/mosiko1234/heimdal/sensor/internal/cloud/gcp"
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/schemas"
+	"github.com/mosiko1234/heimdal/sensor/internal/cloud/webhook"
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/alerting"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/auth"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/certs"
+	corecloud "github.com/mosiko1234/heimdal/sensor/internal/core/cloud"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
 	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	coreprofiler "github.com/mosiko1234/heimdal/sensor/internal/core/profiler"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/recorder"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/telemetry"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/threatintel"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 	"github.com/mosiko1234/heimdal/sensor/internal/discovery"
 	"github.com/mosiko1234/heimdal/sensor/internal/errors"
@@ -52,18 +65,27 @@ type HardwareOrchestrator struct {
 	systemIntegrator platform.SystemIntegrator
 
 	// Component instances
-	netConfig    *netconfig.AutoConfig
-	scanner      *discovery.Scanner
-	arpSpoofer   *interceptor.ARPSpoofer
-	analyzer     *packet.Analyzer
-	profilerComp *profiler.Profiler
-	apiServer    *api.APIServer
-	cloudOrch    *cloud.Orchestrator
+	netConfig     *netconfig.AutoConfig
+	scanner       *discovery.Scanner
+	arpSpoofer    *interceptor.ARPSpoofer
+	interception  *interception.Controller
+	analyzer      *packet.Analyzer
+	recorder      *recorder.Recorder
+	profilerComp  *profiler.Profiler
+	anomalyStore  *detection.AnomalyStore
+	lifecycle     *detection.LifecycleDetector
+	flowTable     *flow.Table
+	flowStore     *flow.Store
+	threatMatcher *threatintel.Matcher
+	alerts        *alerting.Forwarder
+	apiServer     *api.APIServer
+	cloudOrch     *cloud.Orchestrator
 
 	// Communication channels
 	deviceChan   chan *database.Device
 	packetChan   chan packet.PacketInfo   // For analyzer output
 	profilerChan chan analyzer.PacketInfo // For profiler input (old format)
+	flowChan     chan *flow.Record        // Completed flows from the flow table
 
 	// Lifecycle management
 	shutdownCh chan struct{}
@@ -106,6 +128,7 @@ func NewHardwareOrchestrator(
 		deviceChan:       make(chan *database.Device, 100),
 		packetChan:       make(chan packet.PacketInfo, 1000),
 		profilerChan:     make(chan analyzer.PacketInfo, 1000),
+		flowChan:         make(chan *flow.Record, 1000),
 		shutdownCh:       make(chan struct{}),
 		componentHealth:  make(map[string]*componentHealthInfo),
 	}, nil
@@ -184,6 +207,7 @@ func (o *HardwareOrchestrator) initializeComponents() error {
 		nil,
 		nil,
 	)
+	o.scanner.SetMetadataSource(o.db.DeviceMetadata)
 	o.components = append(o.components, o.scanner)
 	o.initComponentHealth(o.scanner.Name())
 
@@ -199,13 +223,37 @@ func (o *HardwareOrchestrator) initializeComponents() error {
 		)
 		o.components = append(o.components, o.arpSpoofer)
 		o.initComponentHealth(o.arpSpoofer.Name())
+
+		// Targets added, removed or paused through the API survive restarts
+		controller, err := interception.NewController(o.db, o.arpSpoofer, o.lookupDevice)
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize interception control")
+		}
+		controller.Restore(o.config.Interceptor.TargetMACs)
+		o.interception = controller
 	} else {
 		o.logger.Info("Traffic interceptor is disabled in configuration")
 	}
 
 	// 5. Initialize Packet Analyzer using platform interface
 	o.logger.Info("Initializing packet analyzer with platform interface...")
-	analyzer, err := packet.NewAnalyzer(o.packetCapture, o.packetChan, nil)
+	captureProvider := o.packetCapture
+	if o.config.Recorder.Enabled {
+		rec, err := recorder.NewRecorder(&recorder.Config{
+			Directory:   o.config.Recorder.Directory,
+			MaxFileSize: int64(o.config.Recorder.MaxFileSizeMB) * 1024 * 1024,
+			MaxFileAge:  time.Duration(o.config.Recorder.MaxFileAgeMinutes) * time.Minute,
+			MaxFiles:    o.config.Recorder.MaxFilesPerDevice,
+			SnapLen:     recorder.DefaultConfig().SnapLen,
+		})
+		if err != nil {
+			o.logger.Warn("Failed to initialize packet recorder: %v", err)
+		} else {
+			o.recorder = rec
+			captureProvider = recorder.NewTeeProvider(o.packetCapture, rec)
+		}
+	}
+	analyzer, err := packet.NewAnalyzer(captureProvider, o.packetChan, nil)
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize packet analyzer")
 	}
@@ -233,11 +281,28 @@ func (o *HardwareOrchestrator) initializeComponents() error {
 	o.profilerComp = profilerComp
 	o.components = append(o.components, o.profilerComp)
 	o.initComponentHealth(o.profilerComp.Name())
+	o.scanner.SetFingerprintSource(o.tlsFingerprints)
 
 	// Start adapter goroutine to convert packet.PacketInfo to analyzer.PacketInfo
 	o.wg.Add(1)
 	go o.packetInfoAdapter()
 
+	// Flow table groups packets into connections for upload/download volume and duration
+	flowTable, err := flow.NewTable(o.flowChan, flow.DefaultConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize flow table")
+	}
+	o.flowTable = flowTable
+	o.analyzer.AddInspector(flowTable)
+	flowStore, err := flow.NewStore(o.db, flow.DefaultStoreConfig())
+	if err != nil {
+		o.logger.Warn("Failed to initialize flow store: %v", err)
+	} else {
+		o.flowStore = flowStore
+	}
+	o.wg.Add(1)
+	go o.flowLoop()
+
 	// 7. Initialize Web API Server
 	o.logger.Info("Initializing web API server...")
 	o.apiServer = api.NewAPIServer(
@@ -246,8 +311,86 @@ func (o *HardwareOrchestrator) initializeComponents() error {
 		o.config.API.Port,
 		o.config.API.RateLimitPerMinute,
 	)
+	if o.recorder != nil {
+		o.apiServer.SetRecorder(o.recorder)
+	}
+	anomalyStore, err := detection.NewAnomalyStore(o.db, detection.DefaultAnomalyStoreConfig())
+	if err != nil {
+		o.logger.Warn("Failed to initialize anomaly store: %v", err)
+	} else {
+		o.anomalyStore = anomalyStore
+		o.apiServer.SetAnomalyStore(anomalyStore)
+	}
+	if o.flowStore != nil {
+		o.apiServer.SetFlowStore(o.flowStore)
+	}
+	if o.interception != nil {
+		o.apiServer.SetInterception(o.interception)
+	}
+	if o.config.API.TLS.Enabled {
+		certManager, err := certs.NewManager(o.certsConfig())
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize API certificates")
+		}
+		o.apiServer.SetTLS(certManager)
+		o.components = append(o.components, certManager)
+	} else {
+		o.logger.Warn("API HTTPS is disabled; logins and device data travel in cleartext")
+	}
+	if o.config.API.Auth.Enabled {
+		manager, err := auth.NewManager(o.db, o.authConfig())
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize API authentication")
+		}
+		if _, err := manager.Bootstrap(o.config.InitialPasswordPath()); err != nil {
+			return errors.Wrap(err, "failed to create the initial admin user")
+		}
+		o.apiServer.SetAuth(manager)
+	} else {
+		o.logger.Warn("API authentication is disabled; device data is readable by anyone on the network")
+	}
+
+	// Threat intel checks every captured destination inline
+	if o.config.ThreatIntel.Enabled && o.anomalyStore != nil {
+		o.logger.Info("Initializing threat intel with %d feeds...", len(o.config.ThreatIntel.Feeds))
+		matcher, err := threatintel.NewMatcher(o.threatIntelConfig())
+		if err != nil {
+			o.logger.Warn("Failed to initialize threat intel: %v", err)
+		} else {
+			if err := matcher.Refresh(); err != nil {
+				o.logger.Warn("Some threat intel feeds failed to load: %v", err)
+			}
+			o.threatMatcher = matcher
+			o.analyzer.AddInspector(threatintel.NewInspector(matcher, o.recordAnomaly))
+		}
+	}
 	o.initComponentHealth(o.apiServer.Name())
 
+	// Forward anomalies (and optionally device events) to the SOC's syslog receiver
+	if o.config.Syslog.Enabled {
+		o.logger.Info("Initializing syslog alert forwarding to %s...", o.config.Syslog.Address)
+		forwarder, err := alerting.NewForwarder(o.alertingConfig(), o.lookupDevice)
+		if err != nil {
+			o.logger.Warn("Failed to initialize syslog forwarding: %v", err)
+		} else {
+			o.alerts = forwarder
+			o.components = append(o.components, forwarder)
+			o.initComponentHealth(forwarder.Name())
+		}
+	}
+
+	// Device lifecycle rules turn discovery events into new/dormant device anomalies
+	if o.anomalyStore != nil && (o.config.Lifecycle.NewDevice.Enabled || o.config.Lifecycle.DormantDevice.Enabled) {
+		lifecycle, err := detection.NewLifecycleDetector(o.lifecycleConfig())
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize lifecycle detector")
+		}
+		o.lifecycle = lifecycle
+	}
+	if o.lifecycle != nil || (o.alerts != nil && o.config.Syslog.DeviceEvents) {
+		o.scanner.SetDeviceEventSink(o.handleDeviceEvent)
+	}
+
 	// 8. Initialize Cloud Connector (if enabled)
 	if o.config.Cloud.Enabled {
 		o.logger.Info("Initializing cloud connector...")
@@ -257,28 +400,81 @@ func (o *HardwareOrchestrator) initializeComponents() error {
 			o.logger.Info("Local operations will continue without cloud connectivity")
 		} else {
 			// Create the appropriate connector based on provider
+			// Only assign on success: a nil *AWSIoTConnector stored in the
+			// interface would not compare equal to nil
 			var connector cloud.CloudConnector
-			var err error
 			switch o.config.Cloud.Provider {
 			case "aws":
-				connector, err = aws.NewAWSIoTConnector(&o.config.Cloud.AWS, o.db)
+				awsConnector, err := aws.NewAWSIoTConnector(&o.config.Cloud.AWS, o.db)
 				if err != nil {
 					o.logger.Warn("Failed to create AWS connector: %v", err)
+				} else {
+					connector = awsConnector
 				}
 			case "gcp":
-				connector, err = gcp.NewGoogleCloudConnector(&o.config.Cloud.GCP, o.db)
+				gcpConnector, err := gcp.NewGoogleCloudConnector(&o.config.Cloud.GCP, o.db)
 				if err != nil {
 					o.logger.Warn("Failed to create GCP connector: %v", err)
+				} else {
+					connector = gcpConnector
+				}
+			case "webhook":
+				webhookConnector, err := webhook.NewWebhookConnector(&o.config.Cloud.Webhook, o.db)
+				if err != nil {
+					o.logger.Warn("Failed to create webhook connector: %v", err)
+				} else {
+					connector = webhookConnector
 				}
 			default:
 				o.logger.Warn("Unknown cloud provider: %s", o.config.Cloud.Provider)
 			}
 
+			if connector != nil {
+				// Keep queued transmissions across restarts and outages
+				if queued, ok := connector.(interface {
+					SetQueueStorage(platform.StorageProvider, *corecloud.QueueConfig) error
+				}); ok {
+					if err := queued.SetQueueStorage(o.db, corecloud.DefaultQueueConfig()); err != nil {
+						o.logger.Warn("Cloud transmission queue will not survive restarts: %v", err)
+					}
+				}
+
+				if o.config.Cloud.AnonymizeData {
+					if err := o.enableCloudAnonymization(connector); err != nil {
+						// Never upload identifying data the operator asked to withhold
+						o.logger.Warn("Cloud connector disabled: %v", err)
+						connector = nil
+					}
+				}
+			}
+
 			if connector != nil {
 				cloudOrch.SetConnector(connector)
 				o.cloudOrch = cloudOrch
 				o.components = append(o.components, o.cloudOrch)
 				o.initComponentHealth(o.cloudOrch.Name())
+				o.apiServer.SetCloudQueue(cloudOrch)
+
+				// Heartbeats let the fleet backend tell a dead sensor from a quiet network
+				reporter, err := telemetry.NewReporter(cloudOrch, o.telemetryConfig(), telemetry.Sources{
+					ComponentStatus: o.GetComponentStatus,
+					Inventory:       o.inventory,
+					Capture:         o.packetCapture,
+					QueueStats:      cloudOrch.QueueStats,
+					DatabaseSize:    o.db.GetDatabaseSize,
+				})
+				if err != nil {
+					o.logger.Warn("Failed to initialize telemetry reporter: %v", err)
+				} else {
+					o.components = append(o.components, reporter)
+					o.initComponentHealth(reporter.Name())
+				}
+
+				if o.config.Cloud.Commands.Enabled {
+					if err := o.initializeCommands(cloudOrch); err != nil {
+						o.logger.Warn("Cloud commands disabled: %v", err)
+					}
+				}
 			}
 		}
 	} else {
@@ -289,6 +485,78 @@ func (o *HardwareOrchestrator) initializeComponents() error {
 	return nil
 }
 
+// telemetryConfig returns the telemetry reporter configuration
+func (o *HardwareOrchestrator) telemetryConfig() *telemetry.Config {
+	cfg := telemetry.DefaultConfig()
+	cfg.Platform = string(corecloud.DeviceTypeHardware)
+	cfg.Version = config.Version
+	cfg.SendTelemetry = o.config.Cloud.SendTelemetry
+	if o.config.Cloud.HeartbeatSeconds > 0 {
+		cfg.HeartbeatInterval = time.Duration(o.config.Cloud.HeartbeatSeconds) * time.Second
+	}
+
+	cfg.SensorID = o.cloudSensorID()
+	return cfg
+}
+
+// cloudSensorID returns the sensor ID the cloud connector puts on its envelopes
+func (o *HardwareOrchestrator) cloudSensorID() string {
+	switch {
+	case o.config.Cloud.Provider == "aws":
+		return o.config.Cloud.AWS.ClientID
+	case o.config.Cloud.Provider == "webhook" && o.config.Cloud.Webhook.SensorID != "":
+		return o.config.Cloud.Webhook.SensorID
+	case o.config.Cloud.Provider == "gcp" && o.config.Cloud.GCP.SensorID != "":
+		return o.config.Cloud.GCP.SensorID
+	default:
+		hostname, _ := os.Hostname()
+		return hostname
+	}
+}
+
+// inventory counts the devices and profiles in the database for heartbeats
+func (o *HardwareOrchestrator) inventory() (telemetry.Inventory, error) {
+	var inventory telemetry.Inventory
+
+	devices, err := o.db.GetAllDevices()
+	if err != nil {
+		return inventory, err
+	}
+	inventory.Devices = len(devices)
+	for _, device := range devices {
+		if device.IsActive {
+			inventory.ActiveDevices++
+		}
+	}
+
+	profiles, err := o.db.GetAllProfiles()
+	if err != nil {
+		return inventory, err
+	}
+	inventory.Profiles = len(profiles)
+
+	return inventory, nil
+}
+
+// enableCloudAnonymization keys an anonymizer with this sensor's stored secret
+// and attaches it to the cloud connector
+func (o *HardwareOrchestrator) enableCloudAnonymization(connector cloud.CloudConnector) error {
+	anonymized, ok := connector.(interface {
+		SetAnonymizer(*schemas.Anonymizer)
+	})
+	if !ok {
+		return fmt.Errorf("connector does not support anonymization")
+	}
+
+	anonymizer, err := corecloud.LoadAnonymizer(o.db)
+	if err != nil {
+		return err
+	}
+	anonymized.SetAnonymizer(anonymizer)
+	o.logger.Info("Cloud uploads will be anonymized")
+	return nil
+}
+
 // startComponents launches all components as goroutines in the correct order
 func (o *HardwareOrchestrator) startComponents() error {
 	o.logger.Info("Starting components...")
@@ -332,6 +600,17 @@ func (o *HardwareOrchestrator) startComponents() error {
 		o.markComponentRunning(o.apiServer.Name(), true)
 	}
 
+	// Schedule threat intel feed refreshes
+	if o.threatMatcher != nil {
+		o.threatMatcher.Start()
+	}
+
+	// Check for dormant devices and prune old anomalies in the background
+	if o.anomalyStore != nil {
+		o.wg.Add(1)
+		go o.anomalyLoop()
+	}
+
 	// Start component health monitoring
 	o.wg.Add(1)
 	go o.healthMonitorLoop()
@@ -446,6 +725,10 @@ func (o *HardwareOrchestrator) shutdown() error {
 	// Stop components in reverse order
 	o.logger.Info("Stopping components in reverse order...")
 
+	if o.threatMatcher != nil {
+		o.threatMatcher.Stop()
+	}
+
 	// Stop API server first
 	if o.apiServer != nil {
 		o.logger.Info("Stopping component: %s", o.apiServer.Name())
@@ -473,6 +756,14 @@ func (o *HardwareOrchestrator) shutdown() error {
 		}
 	}
 
+	// Flush and close open recordings
+	if o.recorder != nil {
+		o.logger.Info("Closing packet recorder...")
+		if err := o.recorder.Close(); err != nil {
+			o.logger.Warn("Error closing packet recorder: %v", err)
+		}
+	}
+
 	// Close communication channels
 	o.logger.Info("Closing communication channels...")
 	close(o.deviceChan)
@@ -535,6 +826,9 @@ func (o *HardwareOrchestrator) packetInfoAdapter() {
 				DstPort:   info.DstPort,
 				Protocol:  info.Protocol,
 				Size:      info.Size,
+				DstMAC:    info.DstMAC,
+				DNS:       info.DNS,
+				TLS:       info.TLS,
 			}
 
 			// Send to profiler channel (non-blocking)
@@ -548,6 +842,69 @@ func (o *HardwareOrchestrator) packetInfoAdapter() {
 	}
 }
 
+// flowLoop applies completed flows to profiles and stores them, expiring idle
+// flows while the network is quiet
+func (o *HardwareOrchestrator) flowLoop() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.shutdownCh:
+			// Keep the connections still open at shutdown
+			for _, rec := range o.flowTable.Flush() {
+				o.storeFlow(rec)
+			}
+			return
+		case rec := <-o.flowChan:
+			o.profilerComp.RecordFlow(rec)
+			o.storeFlow(rec)
+		case <-ticker.C:
+			o.flowTable.Sweep()
+			if o.flowStore != nil {
+				o.flowStore.Prune(time.Now())
+			}
+		}
+	}
+}
+
+// anomalyLoop raises anomalies for always-on devices that went dark and drops
+// old resolved and suppressed anomalies
+func (o *HardwareOrchestrator) anomalyLoop() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.shutdownCh:
+			return
+		case <-ticker.C:
+			if o.lifecycle != nil {
+				for _, anomaly := range o.lifecycle.CheckDormant(time.Now()) {
+					o.recordAnomaly(anomaly)
+				}
+			}
+			if removed := o.anomalyStore.Prune(time.Now()); removed > 0 {
+				o.logger.Info("Pruned %d old anomalies", removed)
+			}
+		}
+	}
+}
+
+// storeFlow adds a completed flow to the flow store, if enabled
+func (o *HardwareOrchestrator) storeFlow(rec *flow.Record) {
+	if o.flowStore == nil {
+		return
+	}
+	if err := o.flowStore.Add(rec); err != nil {
+		o.logger.Warn("Failed to store flow %s: %v", rec.Key(), err)
+	}
+}
+
 // analyzerComponent wraps the packet.Analyzer to implement the Component interface
 type analyzerComponent struct {
 	analyzer  *packet.Analyzer
@@ -566,3 +923,134 @@ func (a *analyzerComponent) Stop() error {
 func (a *analyzerComponent) Name() string {
 	return "PacketAnalyzer"
 }
+
+// recordAnomaly stores an anomaly raised by an inline packet inspector or the
+// lifecycle detector
+func (o *HardwareOrchestrator) recordAnomaly(anomaly *detection.Anomaly) {
+	stored, isNew, err := o.anomalyStore.Record(anomaly)
+	if err != nil {
+		o.logger.Warn("Failed to store %s anomaly for %s: %v", anomaly.Type, anomaly.DeviceMAC, err)
+		return
+	}
+	if isNew {
+		o.logger.Warn("Anomaly %s (%s): %s", stored.ID, stored.Severity, stored.Description)
+		if o.alerts != nil {
+			o.alerts.Anomaly(anomaly)
+		}
+	}
+}
+
+// handleDeviceEvent feeds discovery lifecycle events to the lifecycle detector
+// and the syslog forwarder
+func (o *HardwareOrchestrator) handleDeviceEvent(event discovery.DeviceEvent) {
+	if o.alerts != nil {
+		o.alerts.DeviceEvent(event)
+	}
+	if o.lifecycle == nil {
+		return
+	}
+
+	switch event.Type {
+	case discovery.DeviceEventNew:
+		if anomaly := o.lifecycle.DeviceJoined(&event.Device, event.Time); anomaly != nil {
+			o.recordAnomaly(anomaly)
+		}
+	case discovery.DeviceEventSeen:
+		o.lifecycle.DeviceSeen(&event.Device, event.Time)
+	}
+}
+
+// lifecycleConfig converts the lifecycle section of the sensor configuration
+func (o *HardwareOrchestrator) lifecycleConfig() *detection.LifecycleConfig {
+	rules := o.config.Lifecycle
+	cfg := &detection.LifecycleConfig{
+		NewDeviceEnabled:   rules.NewDevice.Enabled,
+		BusinessHoursStart: rules.NewDevice.BusinessHoursStart,
+		BusinessHoursEnd:   rules.NewDevice.BusinessHoursEnd,
+		BusinessDaysOnly:   rules.NewDevice.BusinessDaysOnly,
+		LearningPeriod:     time.Duration(rules.NewDevice.LearningPeriodMinutes) * time.Minute,
+	}
+	if rules.DormantDevice.Enabled {
+		cfg.DormantAfter = time.Duration(rules.DormantDevice.AfterMinutes) * time.Minute
+		cfg.DormantDeviceTypes = rules.DormantDevice.DeviceTypes
+		cfg.DormantMACs = rules.DormantDevice.Devices
+	}
+	return cfg
+}
+
+// alertingConfig converts the syslog section of the sensor configuration
+func (o *HardwareOrchestrator) alertingConfig() *alerting.Config {
+	cfg := alerting.DefaultConfig()
+	cfg.Address = o.config.Syslog.Address
+	cfg.Protocol = alerting.Protocol(o.config.Syslog.Protocol)
+	cfg.Format = alerting.Format(o.config.Syslog.Format)
+	cfg.CAPath = o.config.Syslog.CAPath
+	if o.config.Syslog.Facility != 0 {
+		cfg.Facility = o.config.Syslog.Facility
+	}
+	if o.config.Syslog.MinSeverity != "" {
+		cfg.MinSeverity = detection.Severity(o.config.Syslog.MinSeverity)
+	}
+	cfg.DeviceEvents = o.config.Syslog.DeviceEvents
+	cfg.Version = config.Version
+	return cfg
+}
+
+// authConfig converts the API authentication section of the sensor configuration
+func (o *HardwareOrchestrator) authConfig() *auth.Config {
+	cfg := auth.DefaultConfig()
+	cfg.SessionTTL = time.Duration(o.config.API.Auth.SessionHours) * time.Hour
+	if o.config.API.Auth.PublicHealth {
+		cfg.PublicPaths = append(cfg.PublicPaths, "/api/v1/health")
+	}
+	if o.config.API.TLS.Enabled {
+		// Needed before a browser trusts the sensor, so before anyone logs in
+		cfg.PublicPaths = append(cfg.PublicPaths, "/api/v1/tls/ca.crt")
+	}
+	return cfg
+}
+
+// certsConfig converts the API TLS section of the sensor configuration
+func (o *HardwareOrchestrator) certsConfig() *certs.Config {
+	cfg := certs.DefaultConfig()
+	cfg.Directory = o.config.TLSDirectory()
+	cfg.Hostnames = o.config.API.TLS.Hostnames
+	cfg.CertFile = o.config.API.TLS.CertFile
+	cfg.KeyFile = o.config.API.TLS.KeyFile
+	cfg.HSTS = o.config.API.TLS.HSTS
+	return cfg
+}
+
+// lookupDevice returns a device from the inventory, or nil when unknown
+func (o *HardwareOrchestrator) lookupDevice(mac string) *database.Device {
+	device, err := o.db.GetDevice(mac)
+	if err != nil {
+		return nil
+	}
+	return device
+}
+
+// tlsFingerprints returns the TLS client fingerprints profiled for a device
+func (o *HardwareOrchestrator) tlsFingerprints(mac string) []string {
+	profile, err := o.profilerComp.GetProfile(mac)
+	if err != nil {
+		return nil
+	}
+	return coreprofiler.Fingerprints(profile)
+}
+
+// threatIntelConfig converts the threat intel feeds from the sensor configuration
+func (o *HardwareOrchestrator) threatIntelConfig() *threatintel.Config {
+	cfg := &threatintel.Config{
+		RefreshInterval: time.Duration(o.config.ThreatIntel.RefreshMinutes) * time.Minute,
+	}
+	for _, feed := range o.config.ThreatIntel.Feeds {
+		cfg.Feeds = append(cfg.Feeds, threatintel.FeedConfig{
+			Name:     feed.Name,
+			Path:     feed.Path,
+			Format:   threatintel.FeedFormat(feed.Format),
+			Severity: detection.Severity(feed.Severity),
+		})
+	}
+	return cfg
+}
@@ -15,6 +15,8 @@
 //   - Maintains a map of active spoof targets
 //   - Sends ARP replies periodically (default: every 2 seconds)
 //   - Removes inactive devices from spoofing list
+//   - Targets can be added or removed and spoofing paused at runtime
+//     (see core/interception)
 //   - Monitors spoofing health and restarts on failure
 //
 // Safety Mechanisms:
@@ -41,6 +43,7 @@ import (
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 	"github.com/mosiko1234/heimdal/sensor/internal/netconfig"
 )
@@ -51,19 +54,26 @@ type SpoofTarget struct {
 	IP        net.IP
 	LastSpoof time.Time
 	IsActive  bool
+	Failures  int    // Consecutive failed spoofing attempts
+	LastError string // Error of the last failed attempt
 }
 
 // ARPSpoofer manages ARP spoofing operations to intercept network traffic
 type ARPSpoofer struct {
 	netConfig  *netconfig.AutoConfig
 	handle     *pcap.Handle
+	writer     packetWriter            // Sends ARP packets; the pcap handle once started
 	targets    map[string]*SpoofTarget // MAC -> SpoofTarget
 	targetsMu  sync.RWMutex
+	spoofMu    sync.Mutex // Held for a whole spoofing iteration and while restoring ARP caches
 	deviceChan <-chan *database.Device
 	
 	// Configuration
 	spoofInterval time.Duration
-	targetMACs    []string // If empty, spoof all devices
+	targetMACs    []string        // Devices to spoof, unless spoofAll
+	spoofAll      bool            // No targets were configured: spoof every device
+	excludedMACs  map[string]bool // Devices removed at runtime while spoofing all
+	paused        bool            // Targets are kept but not spoofed
 	
 	// Lifecycle management
 	ctx       context.Context
@@ -77,6 +87,11 @@ type ARPSpoofer struct {
 	arpCacheMu       sync.Mutex
 }
 
+// packetWriter sends raw packets on the capture interface
+type packetWriter interface {
+	WritePacketData(data []byte) error
+}
+
 // NewARPSpoofer creates a new ARPSpoofer instance
 func NewARPSpoofer(netConfig *netconfig.AutoConfig, deviceChan <-chan *database.Device, spoofInterval time.Duration, targetMACs []string) *ARPSpoofer {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -86,6 +101,8 @@ func NewARPSpoofer(netConfig *netconfig.AutoConfig, deviceChan <-chan *database.
 		deviceChan:       deviceChan,
 		spoofInterval:    spoofInterval,
 		targetMACs:       targetMACs,
+		spoofAll:         len(targetMACs) == 0,
+		excludedMACs:     make(map[string]bool),
 		targets:          make(map[string]*SpoofTarget),
 		originalARPCache: make(map[string]net.HardwareAddr),
 		ctx:              ctx,
@@ -129,6 +146,7 @@ func (as *ARPSpoofer) Start() error {
 		return fmt.Errorf("failed to open pcap handle: %w", err)
 	}
 	as.handle = handle
+	as.writer = handle
 
 	// Start device listener goroutine
 	as.wg.Add(1)
@@ -324,8 +342,15 @@ func (as *ARPSpoofer) deviceListenerLoop() {
 
 // shouldSpoofDevice checks if a device should be spoofed based on configuration
 func (as *ARPSpoofer) shouldSpoofDevice(mac string) bool {
+	as.targetsMu.RLock()
+	defer as.targetsMu.RUnlock()
+
+	if as.excludedMACs[mac] {
+		return false
+	}
+
 	// If no target MACs specified, spoof all devices
-	if len(as.targetMACs) == 0 {
+	if as.spoofAll {
 		return true
 	}
 
@@ -339,6 +364,177 @@ func (as *ARPSpoofer) shouldSpoofDevice(mac string) bool {
 	return false
 }
 
+// AddTarget starts intercepting a device at runtime. When its IP is known the
+// device is spoofed from the next interval; otherwise it is picked up the next
+// time discovery reports it.
+func (as *ARPSpoofer) AddTarget(mac string, ip net.IP) error {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address %s: %w", mac, err)
+	}
+	mac = hwAddr.String()
+
+	as.targetsMu.Lock()
+	defer as.targetsMu.Unlock()
+
+	delete(as.excludedMACs, mac)
+	if !as.spoofAll && !containsMAC(as.targetMACs, mac) {
+		as.targetMACs = append(as.targetMACs, mac)
+	}
+	if ip != nil {
+		if target, exists := as.targets[mac]; exists {
+			target.IP = ip
+			target.IsActive = true
+		} else {
+			as.targets[mac] = &SpoofTarget{MAC: hwAddr, IP: ip, IsActive: true}
+		}
+	}
+
+	log.Printf("Added device %s to spoofing targets", mac)
+	return nil
+}
+
+// RemoveTarget stops intercepting a device at runtime and restores its ARP
+// cache and the gateway's, so its traffic flows directly again
+func (as *ARPSpoofer) RemoveTarget(mac string) error {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address %s: %w", mac, err)
+	}
+	mac = hwAddr.String()
+
+	as.targetsMu.Lock()
+	if as.spoofAll {
+		as.excludedMACs[mac] = true
+	} else {
+		remaining := as.targetMACs[:0]
+		for _, targetMAC := range as.targetMACs {
+			if targetMAC != mac {
+				remaining = append(remaining, targetMAC)
+			}
+		}
+		as.targetMACs = remaining
+	}
+	target, exists := as.targets[mac]
+	delete(as.targets, mac)
+	as.targetsMu.Unlock()
+
+	as.runningMu.Lock()
+	running := as.running
+	as.runningMu.Unlock()
+
+	if exists && running {
+		// Let an iteration that already picked up the target finish first, so
+		// it cannot spoof the target again after its cache is restored
+		as.spoofMu.Lock()
+		defer as.spoofMu.Unlock()
+		if err := as.restoreTarget(target); err != nil {
+			return fmt.Errorf("stopped spoofing %s but failed to restore its ARP cache: %w", mac, err)
+		}
+	}
+
+	log.Printf("Removed device %s from spoofing targets", mac)
+	return nil
+}
+
+// restoreTarget sends correct ARP replies to one target and the gateway
+func (as *ARPSpoofer) restoreTarget(target *SpoofTarget) error {
+	config := as.netConfig.GetConfig()
+	if config == nil {
+		return fmt.Errorf("network configuration not available")
+	}
+	gatewayMAC, err := as.getGatewayMAC()
+	if err != nil {
+		return fmt.Errorf("failed to get gateway MAC: %w", err)
+	}
+	if err := as.sendCorrectARP(target.IP, target.MAC, config.Gateway, gatewayMAC); err != nil {
+		return err
+	}
+	return as.sendCorrectARP(config.Gateway, gatewayMAC, target.IP, target.MAC)
+}
+
+// containsMAC reports whether macs contains mac
+func containsMAC(macs []string, mac string) bool {
+	for _, m := range macs {
+		if m == mac {
+			return true
+		}
+	}
+	return false
+}
+
+// Targets returns the devices being spoofed, including configured or added
+// devices whose address discovery has not reported yet
+func (as *ARPSpoofer) Targets() []interception.Target {
+	as.targetsMu.RLock()
+	defer as.targetsMu.RUnlock()
+
+	targets := make([]interception.Target, 0, len(as.targets))
+	for mac, target := range as.targets {
+		status := interception.Target{
+			MAC:       mac,
+			IP:        target.IP.String(),
+			Active:    target.IsActive,
+			Failures:  target.Failures,
+			LastError: target.LastError,
+		}
+		if !target.LastSpoof.IsZero() {
+			lastSpoof := target.LastSpoof
+			status.LastSpoof = &lastSpoof
+			// Allow a couple of missed intervals before reporting a target as unhealthy
+			status.Healthy = target.IsActive && !as.paused && target.Failures == 0 &&
+				time.Since(target.LastSpoof) <= 3*as.spoofInterval
+		}
+		targets = append(targets, status)
+	}
+	if !as.spoofAll {
+		for _, mac := range as.targetMACs {
+			if _, exists := as.targets[mac]; !exists {
+				targets = append(targets, interception.Target{MAC: mac})
+			}
+		}
+	}
+	return targets
+}
+
+// Pause stops spoofing every target and restores their ARP caches. Targets
+// and discovery updates are kept, so Resume picks up where it left off.
+// It waits for a spoofing iteration in progress to end before restoring.
+func (as *ARPSpoofer) Pause() error {
+	as.targetsMu.Lock()
+	as.paused = true
+	as.targetsMu.Unlock()
+
+	as.spoofMu.Lock()
+	defer as.spoofMu.Unlock()
+
+	as.runningMu.Lock()
+	running := as.running
+	as.runningMu.Unlock()
+
+	log.Println("ARP spoofing paused")
+	if running {
+		return as.restoreARPTables()
+	}
+	return nil
+}
+
+// Resume starts spoofing the targets again from the next interval
+func (as *ARPSpoofer) Resume() {
+	as.targetsMu.Lock()
+	as.paused = false
+	as.targetsMu.Unlock()
+
+	log.Println("ARP spoofing resumed")
+}
+
+// Paused reports whether spoofing is paused
+func (as *ARPSpoofer) Paused() bool {
+	as.targetsMu.RLock()
+	defer as.targetsMu.RUnlock()
+	return as.paused
+}
+
 // spoofingLoop sends ARP spoofing packets at regular intervals
 func (as *ARPSpoofer) spoofingLoop() {
 	defer as.wg.Done()
@@ -371,7 +567,26 @@ func (as *ARPSpoofer) performSpoofing() {
 		return
 	}
 
+	gatewayMAC, err := as.getGatewayMAC()
+	if err != nil {
+		log.Printf("Warning: failed to get gateway MAC: %v", err)
+		return
+	}
+
+	as.spoofTargets(config.Gateway, gatewayMAC, iface.HardwareAddr)
+}
+
+// spoofTargets sends spoofed ARP packets to every active target and the
+// gateway, claiming localMAC for both. Pause waits for it to return.
+func (as *ARPSpoofer) spoofTargets(gateway net.IP, gatewayMAC, localMAC net.HardwareAddr) {
+	as.spoofMu.Lock()
+	defer as.spoofMu.Unlock()
+
 	as.targetsMu.RLock()
+	if as.paused {
+		as.targetsMu.RUnlock()
+		return
+	}
 	targets := make([]*SpoofTarget, 0, len(as.targets))
 	for _, target := range as.targets {
 		if target.IsActive {
@@ -382,30 +597,46 @@ func (as *ARPSpoofer) performSpoofing() {
 
 	// Send spoofed ARP packets
 	for _, target := range targets {
+		// Stop early when paused part way through
+		if as.Paused() {
+			return
+		}
+
 		// Send spoofed packet to target (tell target that gateway is at our MAC)
-		if err := as.spoofTarget(target.IP, target.MAC, config.Gateway, iface.HardwareAddr); err != nil {
+		if err := as.spoofTarget(target.IP, target.MAC, gateway, localMAC); err != nil {
 			log.Printf("Warning: failed to spoof target %s: %v", target.IP, err)
+			as.recordSpoof(target, err)
 			continue
 		}
 
 		// Send spoofed packet to gateway (tell gateway that target is at our MAC)
-		gatewayMAC, err := as.getGatewayMAC()
-		if err != nil {
-			log.Printf("Warning: failed to get gateway MAC: %v", err)
-			continue
-		}
-		if err := as.spoofTarget(config.Gateway, gatewayMAC, target.IP, iface.HardwareAddr); err != nil {
+		if err := as.spoofTarget(gateway, gatewayMAC, target.IP, localMAC); err != nil {
 			log.Printf("Warning: failed to spoof gateway for target %s: %v", target.IP, err)
+			as.recordSpoof(target, err)
 			continue
 		}
 
-		// Update last spoof time
-		as.targetsMu.Lock()
-		if t, exists := as.targets[target.MAC.String()]; exists {
-			t.LastSpoof = time.Now()
-		}
-		as.targetsMu.Unlock()
+		as.recordSpoof(target, nil)
+	}
+}
+
+// recordSpoof updates a target's last spoof time or failure count
+func (as *ARPSpoofer) recordSpoof(target *SpoofTarget, err error) {
+	as.targetsMu.Lock()
+	defer as.targetsMu.Unlock()
+
+	t, exists := as.targets[target.MAC.String()]
+	if !exists {
+		return
+	}
+	if err != nil {
+		t.Failures++
+		t.LastError = err.Error()
+		return
 	}
+	t.LastSpoof = time.Now()
+	t.Failures = 0
+	t.LastError = ""
 }
 
 // spoofTarget sends a spoofed ARP reply to a specific target
@@ -531,11 +762,11 @@ func (as *ARPSpoofer) buildARPReply(dstIP net.IP, dstMAC net.HardwareAddr, srcIP
 
 // sendARPPacket transmits an ARP packet via the raw socket
 func (as *ARPSpoofer) sendARPPacket(packet []byte) error {
-	if as.handle == nil {
+	if as.writer == nil {
 		return fmt.Errorf("pcap handle not initialized")
 	}
 
-	if err := as.handle.WritePacketData(packet); err != nil {
+	if err := as.writer.WritePacketData(packet); err != nil {
 		return fmt.Errorf("failed to write packet: %w", err)
 	}
 
@@ -0,0 +1,88 @@
+package interceptor
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/netconfig"
+)
+
+// blockingWriter records packets and holds the first write until released
+type blockingWriter struct {
+	mu      sync.Mutex
+	packets [][]byte
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *blockingWriter) WritePacketData(data []byte) error {
+	w.mu.Lock()
+	w.packets = append(w.packets, data)
+	first := len(w.packets) == 1
+	w.mu.Unlock()
+
+	if first {
+		close(w.started)
+		<-w.release
+	}
+	return nil
+}
+
+func (w *blockingWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.packets)
+}
+
+func TestPauseWaitsForSpoofingIteration(t *testing.T) {
+	as := NewARPSpoofer(netconfig.NewAutoConfig(), nil, time.Second, nil)
+	as.AddTarget("aa:00:00:00:00:01", net.ParseIP("192.168.1.11"))
+	as.AddTarget("aa:00:00:00:00:02", net.ParseIP("192.168.1.12"))
+	writer := newBlockingWriter()
+	as.writer = writer
+
+	gatewayMAC, _ := net.ParseMAC("aa:00:00:00:00:fe")
+	localMAC, _ := net.ParseMAC("aa:00:00:00:00:ff")
+	spoofed := make(chan struct{})
+	go func() {
+		as.spoofTargets(net.ParseIP("192.168.1.1"), gatewayMAC, localMAC)
+		close(spoofed)
+	}()
+	<-writer.started
+
+	// Pause while the first packet of the iteration is being sent
+	paused := make(chan struct{})
+	go func() {
+		as.Pause()
+		close(paused)
+	}()
+	for !as.Paused() {
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-paused:
+		t.Fatal("Expected Pause to wait for the spoofing iteration")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(writer.release)
+	<-paused
+	<-spoofed
+
+	// The target being spoofed is finished, the other one is skipped
+	if count := writer.count(); count != 2 {
+		t.Errorf("Expected 2 packets from the interrupted iteration, got %d", count)
+	}
+
+	as.spoofTargets(net.ParseIP("192.168.1.1"), gatewayMAC, localMAC)
+	if count := writer.count(); count != 2 {
+		t.Errorf("Expected no packets while paused, got %d", count-2)
+	}
+}
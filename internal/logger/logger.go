@@ -64,9 +64,44 @@ type Logger struct {
 
 var (
 	globalLogger *Logger
+	globalFile   *rotatingFile
 	globalMu     sync.RWMutex
 )
 
+// rotatingFile is the log file shared by all loggers. Rotate swaps the file
+// underneath, so loggers created earlier keep writing to the current one.
+type rotatingFile struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// Write appends to the current log file
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// rotate renames the current file to path.<timestamp> and opens a new one
+func (f *rotatingFile) rotate() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rotated := f.path + "." + time.Now().Format("20060102-150405")
+	if err := os.Rename(f.path, rotated); err != nil {
+		return "", fmt.Errorf("failed to rename log file: %w", err)
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		// Keep writing to the renamed file rather than losing messages
+		return "", fmt.Errorf("failed to open new log file: %w", err)
+	}
+	f.file.Close()
+	f.file = file
+	return rotated, nil
+}
+
 // Initialize sets up the global logger with file and stdout output
 func Initialize(logFile string, level string) error {
 	// Create log directory if it doesn't exist
@@ -82,10 +117,12 @@ func Initialize(logFile string, level string) error {
 	}
 
 	// Create multi-writer for both stdout and file
-	multiWriter := io.MultiWriter(os.Stdout, file)
+	lf := &rotatingFile{path: logFile, file: file}
+	multiWriter := io.MultiWriter(os.Stdout, lf)
 
 	// Create global logger
 	globalMu.Lock()
+	globalFile = lf
 	globalLogger = &Logger{
 		component: "main",
 		level:     ParseLogLevel(level),
@@ -96,6 +133,19 @@ func Initialize(logFile string, level string) error {
 	return nil
 }
 
+// Rotate moves the log file aside to <file>.<timestamp> and starts a new one,
+// returning the rotated file's path
+func Rotate() (string, error) {
+	globalMu.RLock()
+	lf := globalFile
+	globalMu.RUnlock()
+
+	if lf == nil {
+		return "", fmt.Errorf("logging to a file is not initialized")
+	}
+	return lf.rotate()
+}
+
 // NewComponentLogger creates a new logger for a specific component
 func NewComponentLogger(component string) *Logger {
 	globalMu.RLock()
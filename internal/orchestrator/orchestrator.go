@@ -33,6 +33,9 @@ import (
 	"github.com/mosiko1234/heimdal/sensor/internal/cloud/aws"
 	"github.com/mosiko1234/heimdal/sensor/internal/cloud/gcp"
 	"github.com/mosiko1234/heimdal/sensor/internal/config"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/auth"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/certs"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/interception"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 	"github.com/mosiko1234/heimdal/sensor/internal/discovery"
 	"github.com/mosiko1234/heimdal/sensor/internal/errors"
@@ -60,6 +63,7 @@ type Orchestrator struct {
 	netConfig    *netconfig.AutoConfig
 	scanner      *discovery.Scanner
 	arpSpoofer   *interceptor.ARPSpoofer
+	interception *interception.Controller
 	sniffer      *analyzer.Sniffer
 	profilerComp *profiler.Profiler
 	apiServer    *api.APIServer
@@ -178,6 +182,7 @@ func (o *Orchestrator) initializeComponents() error {
 		nil,
 		nil,
 	)
+	o.scanner.SetMetadataSource(o.db.DeviceMetadata)
 	o.components = append(o.components, o.scanner)
 	o.initComponentHealth(o.scanner.Name())
 
@@ -193,6 +198,20 @@ func (o *Orchestrator) initializeComponents() error {
 		)
 		o.components = append(o.components, o.arpSpoofer)
 		o.initComponentHealth(o.arpSpoofer.Name())
+
+		// Targets changed through the API survive restarts
+		controller, err := interception.NewController(o.db, o.arpSpoofer, func(mac string) *database.Device {
+			device, err := o.db.GetDevice(mac)
+			if err != nil {
+				return nil
+			}
+			return device
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize interception control")
+		}
+		controller.Restore(o.config.Interceptor.TargetMACs)
+		o.interception = controller
 	} else {
 		o.logger.Info("Traffic interceptor is disabled in configuration")
 	}
@@ -226,6 +245,45 @@ func (o *Orchestrator) initializeComponents() error {
 		o.config.API.Port,
 		o.config.API.RateLimitPerMinute,
 	)
+	if o.interception != nil {
+		o.apiServer.SetInterception(o.interception)
+	}
+	if o.config.API.TLS.Enabled {
+		certsCfg := certs.DefaultConfig()
+		certsCfg.Directory = o.config.TLSDirectory()
+		certsCfg.Hostnames = o.config.API.TLS.Hostnames
+		certsCfg.CertFile = o.config.API.TLS.CertFile
+		certsCfg.KeyFile = o.config.API.TLS.KeyFile
+		certsCfg.HSTS = o.config.API.TLS.HSTS
+		certManager, err := certs.NewManager(certsCfg)
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize API certificates")
+		}
+		o.apiServer.SetTLS(certManager)
+		o.components = append(o.components, certManager)
+	} else {
+		o.logger.Warn("API HTTPS is disabled; logins and device data travel in cleartext")
+	}
+	if o.config.API.Auth.Enabled {
+		authCfg := auth.DefaultConfig()
+		authCfg.SessionTTL = time.Duration(o.config.API.Auth.SessionHours) * time.Hour
+		if o.config.API.Auth.PublicHealth {
+			authCfg.PublicPaths = append(authCfg.PublicPaths, "/api/v1/health")
+		}
+		if o.config.API.TLS.Enabled {
+			authCfg.PublicPaths = append(authCfg.PublicPaths, "/api/v1/tls/ca.crt")
+		}
+		manager, err := auth.NewManager(o.db, authCfg)
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize API authentication")
+		}
+		if _, err := manager.Bootstrap(o.config.InitialPasswordPath()); err != nil {
+			return errors.Wrap(err, "failed to create the initial admin user")
+		}
+		o.apiServer.SetAuth(manager)
+	} else {
+		o.logger.Warn("API authentication is disabled; device data is readable by anyone on the network")
+	}
 	// Note: API server has a different Start signature, we'll handle it specially
 	o.initComponentHealth(o.apiServer.Name())
 
@@ -40,6 +40,7 @@ type CaptureStats struct {
 	PacketsCaptured uint64
 	PacketsDropped  uint64
 	PacketsFiltered uint64
+	FilesSkipped    uint64 // Capture files that could not be read (replay only)
 }
 
 // SystemIntegrator abstracts OS-level service integration
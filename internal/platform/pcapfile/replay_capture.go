@@ -0,0 +1,403 @@
+// Package pcapfile provides a PacketCaptureProvider that replays packets from
+// pcap and pcapng capture files instead of a live network interface.
+//
+// The provider needs neither root privileges nor a network interface, which
+// makes it suitable for reproducing incidents from customer captures and for
+// regression-testing detection changes. Packets are parsed into platform.Packet
+// values exactly as the live providers do, except that the capture timestamp
+// recorded in the file is preserved.
+//
+// The source passed to Open may be a single capture file or a directory of
+// rotated capture files, which are replayed in lexical file name order.
+package pcapfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform"
+)
+
+// SpeedUnlimited replays packets as fast as they can be read
+const SpeedUnlimited = 0
+
+// pcapngMagic is the block type of a pcapng Section Header Block
+const pcapngMagic = 0x0A0D0D0A
+
+// captureExtensions lists the file extensions picked up when replaying a directory
+var captureExtensions = map[string]bool{
+	".pcap":   true,
+	".pcapng": true,
+	".cap":    true,
+}
+
+// packetDataReader is implemented by both the pcap and pcapng readers
+type packetDataReader interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+}
+
+// Config contains configuration for the replay provider
+type Config struct {
+	// Speed is the replay speed multiplier relative to the original capture timing.
+	// 1.0 replays at original speed, 10.0 replays ten times faster and
+	// SpeedUnlimited (0) replays as fast as possible.
+	Speed float64
+}
+
+// DefaultConfig returns a configuration that replays as fast as possible
+func DefaultConfig() *Config {
+	return &Config{
+		Speed: SpeedUnlimited,
+	}
+}
+
+// ReplayCapture implements PacketCaptureProvider by reading capture files
+type ReplayCapture struct {
+	speed float64
+
+	mu        sync.Mutex
+	files     []string
+	fileIdx   int
+	file      *os.File
+	reader    packetDataReader
+	bpf       *pcap.BPF
+	filter    string
+	stats     platform.CaptureStats
+	isOpen    bool
+	closeCh   chan struct{}
+	closeOnce sync.Once
+
+	// Pacing state: the first capture timestamp and the wall clock time it was replayed at
+	firstCaptured time.Time
+	replayStart   time.Time
+}
+
+// NewReplayCapture creates a new capture file replay provider
+func NewReplayCapture(cfg *Config) (*ReplayCapture, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.Speed < 0 {
+		return nil, fmt.Errorf("replay speed must be non-negative, got %f", cfg.Speed)
+	}
+
+	return &ReplayCapture{
+		speed: cfg.Speed,
+	}, nil
+}
+
+// Open prepares replay of the capture file or directory at source.
+// The promiscuous flag has no meaning for offline captures and is ignored.
+// A non-empty filter is compiled as a BPF expression and applied to every packet.
+func (r *ReplayCapture) Open(source string, promiscuous bool, filter string) error {
+	if source == "" {
+		return fmt.Errorf("capture source path is required")
+	}
+
+	files, err := ListCaptureFiles(source)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closeCurrentLocked()
+
+	r.files = files
+	r.fileIdx = 0
+	r.filter = filter
+	r.bpf = nil
+	r.stats = platform.CaptureStats{}
+	r.firstCaptured = time.Time{}
+	r.replayStart = time.Time{}
+	r.closeCh = make(chan struct{})
+	r.closeOnce = sync.Once{}
+
+	if err := r.openFileLocked(0); err != nil {
+		return err
+	}
+
+	r.isOpen = true
+	return nil
+}
+
+// ListCaptureFiles returns the capture files to replay for a file or directory path
+func ListCaptureFiles(source string) ([]string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat capture source %s: %w", source, err)
+	}
+
+	if !info.IsDir() {
+		return []string{source}, nil
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture directory %s: %w", source, err)
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if captureExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			files = append(files, filepath.Join(source, entry.Name()))
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no capture files found in %s", source)
+	}
+
+	// Rotated captures carry a sequence number or timestamp in their name
+	sort.Strings(files)
+	return files, nil
+}
+
+// openFileLocked opens the capture file at index idx and creates the matching reader
+func (r *ReplayCapture) openFileLocked(idx int) error {
+	path := r.files[idx]
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open capture file %s: %w", path, err)
+	}
+
+	reader, err := newPacketDataReader(bufio.NewReader(file))
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to read capture file %s: %w", path, err)
+	}
+
+	// Compile the BPF filter once per link type
+	if r.filter != "" && (r.bpf == nil || r.reader == nil || r.reader.LinkType() != reader.LinkType()) {
+		bpf, err := pcap.NewBPF(reader.LinkType(), 65535, r.filter)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to compile BPF filter '%s': %w", r.filter, err)
+		}
+		r.bpf = bpf
+	}
+
+	r.file = file
+	r.reader = reader
+	r.fileIdx = idx
+	return nil
+}
+
+// newPacketDataReader detects the capture format and returns a pcap or pcapng reader
+func newPacketDataReader(br *bufio.Reader) (packetDataReader, error) {
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture header: %w", err)
+	}
+
+	// The section header block type is byte-order independent
+	if binary.LittleEndian.Uint32(magic) == pcapngMagic {
+		return pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+	}
+
+	return pcapgo.NewReader(br)
+}
+
+// ReadPacket returns the next packet from the capture files.
+// It returns io.EOF once every file has been replayed.
+func (r *ReplayCapture) ReadPacket() (*platform.Packet, error) {
+	r.mu.Lock()
+	if !r.isOpen {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("packet capture not initialized, call Open first")
+	}
+
+	data, ci, err := r.nextPacketLocked()
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	linkType := r.reader.LinkType()
+	delay := r.replayDelayLocked(ci.Timestamp)
+	closeCh := r.closeCh
+	r.mu.Unlock()
+
+	// Sleep outside the lock so Close can interrupt pacing
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-closeCh:
+			timer.Stop()
+			return nil, fmt.Errorf("packet capture closed")
+		}
+	}
+
+	packet := parsePacket(gopacket.NewPacket(data, linkType, gopacket.NoCopy), ci)
+
+	r.mu.Lock()
+	r.stats.PacketsCaptured++
+	r.mu.Unlock()
+
+	return packet, nil
+}
+
+// nextPacketLocked reads the next packet that passes the filter, advancing through files
+func (r *ReplayCapture) nextPacketLocked() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		if r.reader == nil {
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+
+		data, ci, err := r.reader.ReadPacketData()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// Truncated trailing records are common in rotated captures; move on
+			if err := r.advanceFileLocked(); err != nil {
+				return nil, gopacket.CaptureInfo{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, gopacket.CaptureInfo{}, fmt.Errorf("failed to read packet from %s: %w", r.files[r.fileIdx], err)
+		}
+
+		if r.bpf != nil && !r.bpf.Matches(ci, data) {
+			r.stats.PacketsFiltered++
+			continue
+		}
+
+		return data, ci, nil
+	}
+}
+
+// advanceFileLocked closes the current file and opens the next one, returning io.EOF after the last.
+// Files that cannot be opened are skipped so one corrupt rotation does not end the replay.
+func (r *ReplayCapture) advanceFileLocked() error {
+	r.closeCurrentLocked()
+
+	for next := r.fileIdx + 1; next < len(r.files); next++ {
+		err := r.openFileLocked(next)
+		if err == nil {
+			return nil
+		}
+		log.Printf("[Replay] Warning: %v; skipping it", err)
+		r.stats.FilesSkipped++
+	}
+
+	return io.EOF
+}
+
+// replayDelayLocked returns how long to wait before releasing a packet captured at ts
+func (r *ReplayCapture) replayDelayLocked(ts time.Time) time.Duration {
+	if r.speed == SpeedUnlimited {
+		return 0
+	}
+
+	now := time.Now()
+	if r.replayStart.IsZero() {
+		r.firstCaptured = ts
+		r.replayStart = now
+		return 0
+	}
+
+	offset := time.Duration(float64(ts.Sub(r.firstCaptured)) / r.speed)
+	return r.replayStart.Add(offset).Sub(now)
+}
+
+// parsePacket extracts metadata from a gopacket.Packet into platform.Packet
+func parsePacket(goPacket gopacket.Packet, ci gopacket.CaptureInfo) *platform.Packet {
+	packet := &platform.Packet{
+		Timestamp:   ci.Timestamp,
+		PayloadSize: uint32(ci.Length),
+		RawData:     goPacket.Data(),
+	}
+
+	// Extract Ethernet layer for MAC addresses
+	if eth, ok := goPacket.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		packet.SrcMAC = eth.SrcMAC
+		packet.DstMAC = eth.DstMAC
+	}
+
+	// Extract IP layer for IP addresses
+	if ipv4, ok := goPacket.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok {
+		packet.SrcIP = ipv4.SrcIP
+		packet.DstIP = ipv4.DstIP
+		packet.Protocol = ipv4.Protocol.String()
+	} else if ipv6, ok := goPacket.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok {
+		packet.SrcIP = ipv6.SrcIP
+		packet.DstIP = ipv6.DstIP
+		packet.Protocol = ipv6.NextHeader.String()
+	}
+
+	// Extract TCP/UDP layer for ports
+	if tcp, ok := goPacket.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+		packet.SrcPort = uint16(tcp.SrcPort)
+		packet.DstPort = uint16(tcp.DstPort)
+		packet.Protocol = "TCP"
+	} else if udp, ok := goPacket.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		packet.SrcPort = uint16(udp.SrcPort)
+		packet.DstPort = uint16(udp.DstPort)
+		packet.Protocol = "UDP"
+	}
+
+	return packet
+}
+
+// closeCurrentLocked closes the currently open capture file, if any
+func (r *ReplayCapture) closeCurrentLocked() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	r.reader = nil
+}
+
+// Close releases replay resources and interrupts a paced ReadPacket
+func (r *ReplayCapture) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closeCh != nil {
+		r.closeOnce.Do(func() { close(r.closeCh) })
+	}
+
+	r.closeCurrentLocked()
+	r.isOpen = false
+	return nil
+}
+
+// GetStats returns replay statistics
+func (r *ReplayCapture) GetStats() (*platform.CaptureStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statsCopy := r.stats
+	return &statsCopy, nil
+}
+
+// Files returns the capture files selected by the last Open call
+func (r *ReplayCapture) Files() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files := make([]string, len(r.files))
+	copy(files, r.files)
+	return files
+}
+
+var _ platform.PacketCaptureProvider = (*ReplayCapture)(nil)
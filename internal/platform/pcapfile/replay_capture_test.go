@@ -0,0 +1,293 @@
+package pcapfile
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var testBaseTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// buildTCPPacket serializes an Ethernet/IPv4/TCP frame
+func buildTCPPacket(t *testing.T, srcMAC string, dstIP string, dstPort uint16) []byte {
+	t.Helper()
+
+	src, err := net.ParseMAC(srcMAC)
+	if err != nil {
+		t.Fatalf("invalid MAC: %v", err)
+	}
+
+	eth := &layers.Ethernet{
+		SrcMAC:       src,
+		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IPv4(192, 168, 1, 10),
+		DstIP:    net.ParseIP(dstIP),
+	}
+	tcp := &layers.TCP{
+		SrcPort: 51000,
+		DstPort: layers.TCPPort(dstPort),
+		SYN:     true,
+	}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatalf("failed to set network layer: %v", err)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp); err != nil {
+		t.Fatalf("failed to serialize packet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// writePcap writes count packets spaced by interval starting at start
+func writePcap(t *testing.T, path string, start time.Time, interval time.Duration, count int) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create pcap: %v", err)
+	}
+	defer f.Close()
+
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+
+	for i := 0; i < count; i++ {
+		data := buildTCPPacket(t, "aa:bb:cc:dd:ee:01", "10.0.0.1", 443)
+		ci := gopacket.CaptureInfo{
+			Timestamp:     start.Add(time.Duration(i) * interval),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+	}
+}
+
+// writePcapng writes count packets in pcapng format
+func writePcapng(t *testing.T, path string, start time.Time, count int) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create pcapng: %v", err)
+	}
+	defer f.Close()
+
+	w, err := pcapgo.NewNgWriter(f, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatalf("failed to create pcapng writer: %v", err)
+	}
+
+	for i := 0; i < count; i++ {
+		data := buildTCPPacket(t, "aa:bb:cc:dd:ee:02", "10.0.0.2", 8883)
+		ci := gopacket.CaptureInfo{
+			Timestamp:     start.Add(time.Duration(i) * time.Second),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("failed to flush pcapng: %v", err)
+	}
+}
+
+// readAll drains the provider until io.EOF
+func readAll(t *testing.T, r *ReplayCapture) []time.Time {
+	t.Helper()
+
+	var timestamps []time.Time
+	for {
+		pkt, err := r.ReadPacket()
+		if err == io.EOF {
+			return timestamps
+		}
+		if err != nil {
+			t.Fatalf("unexpected read error: %v", err)
+		}
+		timestamps = append(timestamps, pkt.Timestamp)
+	}
+}
+
+func TestReplaySingleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	writePcap(t, path, testBaseTime, time.Second, 5)
+
+	r, err := NewReplayCapture(nil)
+	if err != nil {
+		t.Fatalf("NewReplayCapture failed: %v", err)
+	}
+	if err := r.Open(path, false, ""); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+
+	pkt, err := r.ReadPacket()
+	if err != nil {
+		t.Fatalf("ReadPacket failed: %v", err)
+	}
+	if pkt.SrcMAC.String() != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("unexpected source MAC %s", pkt.SrcMAC)
+	}
+	if pkt.DstIP.String() != "10.0.0.1" || pkt.DstPort != 443 || pkt.Protocol != "TCP" {
+		t.Errorf("unexpected packet metadata: %s:%d %s", pkt.DstIP, pkt.DstPort, pkt.Protocol)
+	}
+	if !pkt.Timestamp.Equal(testBaseTime) {
+		t.Errorf("expected capture timestamp %v, got %v", testBaseTime, pkt.Timestamp)
+	}
+
+	if remaining := readAll(t, r); len(remaining) != 4 {
+		t.Errorf("expected 4 remaining packets, got %d", len(remaining))
+	}
+
+	stats, _ := r.GetStats()
+	if stats.PacketsCaptured != 5 {
+		t.Errorf("expected 5 packets captured, got %d", stats.PacketsCaptured)
+	}
+}
+
+func TestReplayDirectoryInOrder(t *testing.T) {
+	dir := t.TempDir()
+	// Written out of order to verify the files are sorted by name
+	writePcapng(t, filepath.Join(dir, "capture-002.pcapng"), testBaseTime.Add(time.Hour), 3)
+	writePcap(t, filepath.Join(dir, "capture-001.pcap"), testBaseTime, time.Second, 2)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644); err != nil {
+		t.Fatalf("failed to write notes: %v", err)
+	}
+
+	r, _ := NewReplayCapture(nil)
+	if err := r.Open(dir, false, ""); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+
+	if files := r.Files(); len(files) != 2 {
+		t.Fatalf("expected 2 capture files, got %v", files)
+	}
+
+	timestamps := readAll(t, r)
+	if len(timestamps) != 5 {
+		t.Fatalf("expected 5 packets across files, got %d", len(timestamps))
+	}
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i].Before(timestamps[i-1]) {
+			t.Errorf("packet %d replayed out of order", i)
+		}
+	}
+}
+
+func TestReplaySkipsCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	writePcap(t, filepath.Join(dir, "capture-001.pcap"), testBaseTime, time.Second, 2)
+	if err := os.WriteFile(filepath.Join(dir, "capture-002.pcap"), []byte("not a capture file"), 0644); err != nil {
+		t.Fatalf("failed to write corrupt capture: %v", err)
+	}
+	writePcap(t, filepath.Join(dir, "capture-003.pcap"), testBaseTime.Add(time.Hour), time.Second, 3)
+
+	r, _ := NewReplayCapture(nil)
+	if err := r.Open(dir, false, ""); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+
+	if timestamps := readAll(t, r); len(timestamps) != 5 {
+		t.Errorf("expected 5 packets from the readable files, got %d", len(timestamps))
+	}
+
+	stats, _ := r.GetStats()
+	if stats.FilesSkipped != 1 {
+		t.Errorf("expected 1 skipped file, got %d", stats.FilesSkipped)
+	}
+}
+
+func TestReplayPacing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	// 3 packets spanning 2 seconds of capture time
+	writePcap(t, path, testBaseTime, time.Second, 3)
+
+	r, err := NewReplayCapture(&Config{Speed: 20})
+	if err != nil {
+		t.Fatalf("NewReplayCapture failed: %v", err)
+	}
+	if err := r.Open(path, false, ""); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+
+	start := time.Now()
+	readAll(t, r)
+	elapsed := time.Since(start)
+
+	// 2s of capture at 20x speed should take about 100ms
+	if elapsed < 80*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected accelerated replay of about 100ms, took %v", elapsed)
+	}
+}
+
+func TestReplayCloseInterruptsPacing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	writePcap(t, path, testBaseTime, time.Hour, 2)
+
+	r, _ := NewReplayCapture(&Config{Speed: 1})
+	if err := r.Open(path, false, ""); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if _, err := r.ReadPacket(); err != nil {
+		t.Fatalf("first ReadPacket failed: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		r.Close()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.ReadPacket()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected error after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not interrupt paced ReadPacket")
+	}
+}
+
+func TestReplayInvalidSource(t *testing.T) {
+	r, _ := NewReplayCapture(nil)
+
+	if err := r.Open(filepath.Join(t.TempDir(), "missing.pcap"), false, ""); err == nil {
+		t.Error("expected error for missing capture file")
+	}
+	if err := r.Open(t.TempDir(), false, ""); err == nil {
+		t.Error("expected error for directory without captures")
+	}
+	if _, err := NewReplayCapture(&Config{Speed: -1}); err == nil {
+		t.Error("expected error for negative speed")
+	}
+}
@@ -10,6 +10,9 @@
 //   - Protocols: Count of TCP, UDP, ICMP, and other protocols
 //   - Volume: Total packets and bytes transmitted
 //   - Timing: Hourly activity pattern (24-hour array)
+//   - Domains: Names looked up over DNS, with NXDOMAIN counts
+//   - TLS clients: JA3/JA4 fingerprints of the device's TLS ClientHellos
+//   - Flows: Connection count, bytes sent and received, longest connection
 //
 // Aggregation Logic:
 //   1. Receive PacketInfo from packetChan
@@ -42,6 +45,8 @@ import (
 	"time"
 
 	"github.com/mosiko1234/heimdal/sensor/internal/analyzer"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	coreprofiler "github.com/mosiko1234/heimdal/sensor/internal/core/profiler"
 	"github.com/mosiko1234/heimdal/sensor/internal/database"
 )
 
@@ -56,6 +61,7 @@ type DestInfo = database.DestInfo
 // Profiler aggregates packet data into behavioral profiles
 type Profiler struct {
 	profiles       map[string]*BehavioralProfile
+	domains        *coreprofiler.DomainTracker
 	mu             sync.RWMutex
 	packetChan     <-chan analyzer.PacketInfo
 	db             *database.DatabaseManager
@@ -82,6 +88,7 @@ func NewProfiler(db *database.DatabaseManager, packetChan <-chan analyzer.Packet
 
 	profiler := &Profiler{
 		profiles:        make(map[string]*BehavioralProfile),
+		domains:         coreprofiler.NewDomainTracker(0),
 		packetChan:      packetChan,
 		db:              db,
 		persistInterval: persistInterval,
@@ -204,9 +211,20 @@ func (p *Profiler) updateProfile(packetInfo analyzer.PacketInfo) {
 	// Update LastSeen timestamp
 	profile.LastSeen = packetInfo.Timestamp
 
+	// Track looked-up domains and resolve destinations to them
+	if dns := packetInfo.DNS; dns != nil {
+		if dns.Response {
+			p.domains.RecordResponse(p.profiles[packetInfo.DstMAC], dns, packetInfo.Timestamp)
+		} else {
+			p.domains.RecordQuery(profile, dns, packetInfo.Timestamp)
+		}
+	}
+
 	// Update Destinations map with destination IP and count
+	var destInfo *DestInfo
 	if packetInfo.DstIP != "" {
-		destInfo, destExists := profile.Destinations[packetInfo.DstIP]
+		var destExists bool
+		destInfo, destExists = profile.Destinations[packetInfo.DstIP]
 		if !destExists {
 			destInfo = &DestInfo{
 				IP:       packetInfo.DstIP,
@@ -217,6 +235,12 @@ func (p *Profiler) updateProfile(packetInfo analyzer.PacketInfo) {
 		}
 		destInfo.Count++
 		destInfo.LastSeen = packetInfo.Timestamp
+		p.domains.Annotate(destInfo, packetInfo.Timestamp)
+	}
+
+	// Record the TLS client fingerprint of ClientHellos
+	if packetInfo.TLS != nil {
+		coreprofiler.RecordClientHello(profile, packetInfo.TLS, destInfo, packetInfo.Timestamp)
 	}
 
 	// Update Ports map with destination port frequency
@@ -242,6 +266,22 @@ func (p *Profiler) updateProfile(packetInfo analyzer.PacketInfo) {
 	}
 }
 
+// RecordFlow applies a completed flow to the profiles of the devices at both
+// of its ends
+func (p *Profiler) RecordFlow(rec *flow.Record) {
+	if rec == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	coreprofiler.ApplyFlow(p.profiles[rec.SrcMAC], rec)
+	if rec.DstMAC != rec.SrcMAC {
+		coreprofiler.ApplyFlow(p.profiles[rec.DstMAC], rec)
+	}
+}
+
 // GetProfile returns a copy of the profile for a given MAC address
 func (p *Profiler) GetProfile(mac string) (*BehavioralProfile, error) {
 	p.mu.RLock()
@@ -0,0 +1,268 @@
+// Package replay runs the shared packet pipeline against recorded captures.
+//
+// A Runner feeds packets from pcap/pcapng files through the core Analyzer,
+// Profiler and Detector exactly as live traffic would flow, then reports the
+// resulting behavioral profiles and anomalies. It is used to reproduce incidents
+// from customer captures and to regression-test detection changes without a
+// live network.
+package replay
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mosiko1234/heimdal/sensor/internal/core/detection"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/flow"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/packet"
+	"github.com/mosiko1234/heimdal/sensor/internal/core/profiler"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/internal/logger"
+	"github.com/mosiko1234/heimdal/sensor/internal/platform/pcapfile"
+)
+
+// Config contains configuration for a replay run
+type Config struct {
+	// Path is a capture file or a directory of rotated capture files
+	Path string
+
+	// Speed is the replay speed multiplier (1.0 = original timing, 0 = as fast as possible)
+	Speed float64
+
+	// Filter is an optional BPF expression applied to replayed packets
+	Filter string
+
+	// DatabasePath is where profiles are persisted. When empty a temporary
+	// database is created and removed after the run.
+	DatabasePath string
+
+	// Sensitivity is the detector sensitivity (0.0 to 1.0)
+	Sensitivity float64
+
+	// BaselineThreshold is the minimum packets per device before analysis
+	BaselineThreshold int64
+
+	// BufferSize is the packet channel buffer size
+	BufferSize int
+
+	// RulesFile is an optional detection rule file (YAML or JSON)
+	RulesFile string
+}
+
+// DefaultConfig returns a configuration with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Speed:             pcapfile.SpeedUnlimited,
+		Sensitivity:       0.5,
+		BaselineThreshold: 100,
+		BufferSize:        1000,
+	}
+}
+
+// Report summarizes the outcome of a replay run
+type Report struct {
+	Source          string                        `json:"source"`
+	Files           []string                      `json:"files"`
+	StartedAt       time.Time                     `json:"started_at"`
+	FinishedAt      time.Time                     `json:"finished_at"`
+	PacketsReplayed uint64                        `json:"packets_replayed"`
+	PacketsFiltered uint64                        `json:"packets_filtered"`
+	FilesSkipped    uint64                        `json:"files_skipped"`
+	Flows           int                           `json:"flows"`
+	Interrupted     bool                          `json:"interrupted"`
+	Profiles        []*database.BehavioralProfile `json:"profiles"`
+	Anomalies       []*detection.Anomaly          `json:"anomalies"`
+}
+
+// Runner replays capture files through the packet pipeline
+type Runner struct {
+	config *Config
+	logger *logger.Logger
+}
+
+// NewRunner creates a new replay runner
+func NewRunner(cfg *Config) (*Runner, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("replay config is required")
+	}
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("replay path is required")
+	}
+	if cfg.Speed < 0 {
+		return nil, fmt.Errorf("replay speed must be non-negative, got %f", cfg.Speed)
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+
+	return &Runner{
+		config: cfg,
+		logger: logger.NewComponentLogger("Replay"),
+	}, nil
+}
+
+// Run replays the configured captures until they are exhausted or ctx is cancelled
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	report := &Report{
+		Source:    r.config.Path,
+		StartedAt: time.Now(),
+	}
+
+	dbPath := r.config.DatabasePath
+	if dbPath == "" {
+		tmpDir, err := os.MkdirTemp("", "heimdal-replay-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary database directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		dbPath = tmpDir
+	}
+
+	db, err := database.NewDatabaseManager(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay database: %w", err)
+	}
+	defer db.Close()
+
+	provider, err := pcapfile.NewReplayCapture(&pcapfile.Config{Speed: r.config.Speed})
+	if err != nil {
+		return nil, err
+	}
+
+	packetChan := make(chan packet.PacketInfo, r.config.BufferSize)
+
+	// Replay must not lose packets: disable rate limiting and block on a full channel
+	analyzer, err := packet.NewAnalyzer(provider, packetChan, &packet.Config{
+		RateLimit:  0,
+		BufferSize: r.config.BufferSize,
+		Lossless:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create packet analyzer: %w", err)
+	}
+
+	// Measure time windows against the capture, not the wall clock
+	profilerCfg := profiler.DefaultConfig()
+	profilerCfg.PacketClock = true
+	prof, err := profiler.NewProfiler(db, packetChan, profilerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profiler: %w", err)
+	}
+
+	detector, err := detection.NewDetector(&detection.Config{
+		Sensitivity:       r.config.Sensitivity,
+		BaselineThreshold: r.config.BaselineThreshold,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create detector: %w", err)
+	}
+	if r.config.RulesFile != "" {
+		if err := detection.NewRuleLoader(detector, r.config.RulesFile).Load(); err != nil {
+			return nil, fmt.Errorf("failed to load detection rules: %w", err)
+		}
+	}
+
+	// Completed flows add connection volume and duration to the profiles
+	flowChan := make(chan *flow.Record, r.config.BufferSize)
+	flowTable, err := flow.NewTable(flowChan, flow.DefaultConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create flow table: %w", err)
+	}
+	analyzer.AddInspector(flowTable)
+
+	if err := prof.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start profiler: %w", err)
+	}
+
+	flowsDone := make(chan struct{})
+	go func() {
+		defer close(flowsDone)
+		for rec := range flowChan {
+			prof.RecordFlow(rec)
+			report.Flows++
+		}
+	}()
+
+	r.logger.Info("Replaying %s (speed: %s, filter: %q)", r.config.Path, speedString(r.config.Speed), r.config.Filter)
+
+	if err := analyzer.Start(r.config.Path, false, r.config.Filter); err != nil {
+		prof.Stop()
+		return nil, fmt.Errorf("failed to start replay: %w", err)
+	}
+	report.Files = provider.Files()
+
+	select {
+	case <-analyzer.Done():
+	case <-ctx.Done():
+		report.Interrupted = true
+		r.logger.Warn("Replay interrupted before the end of the capture")
+	}
+
+	if stats, err := analyzer.GetStats(); err == nil {
+		report.PacketsReplayed = stats.PacketsCaptured
+		report.PacketsFiltered = stats.PacketsFiltered
+		report.FilesSkipped = stats.FilesSkipped
+	}
+	if report.FilesSkipped > 0 {
+		r.logger.Warn("Skipped %d unreadable capture files", report.FilesSkipped)
+	}
+
+	analyzer.Stop()
+
+	// Let the profiler consume everything the analyzer produced
+	if !report.Interrupted {
+		waitForDrain(packetChan)
+	}
+
+	// Connections still open at the end of the capture complete with it
+	for _, rec := range flowTable.Flush() {
+		flowChan <- rec
+	}
+	close(flowChan)
+	<-flowsDone
+	if dropped := flowTable.Dropped(); dropped > 0 {
+		r.logger.Warn("Dropped %d flows while the profiler was busy", dropped)
+	}
+
+	if err := prof.Stop(); err != nil {
+		r.logger.Warn("Failed to stop profiler cleanly: %v", err)
+	}
+
+	report.Profiles = prof.GetAllProfiles()
+	sort.Slice(report.Profiles, func(i, j int) bool {
+		return report.Profiles[i].MAC < report.Profiles[j].MAC
+	})
+
+	anomalies, err := detector.AnalyzeBatch(report.Profiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze replayed profiles: %w", err)
+	}
+	report.Anomalies = anomalies
+	report.FinishedAt = time.Now()
+
+	r.logger.Info("Replay finished: %d packets, %d flows, %d devices, %d anomalies in %v",
+		report.PacketsReplayed, report.Flows, len(report.Profiles), len(report.Anomalies),
+		report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond))
+
+	return report, nil
+}
+
+// waitForDrain blocks until the packet channel has been emptied by the profiler
+func waitForDrain(packetChan chan packet.PacketInfo) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for len(packetChan) > 0 {
+		<-ticker.C
+	}
+}
+
+// speedString formats a replay speed for logging
+func speedString(speed float64) string {
+	if speed == pcapfile.SpeedUnlimited {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%gx", speed)
+}
@@ -0,0 +1,161 @@
+package integration
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/mosiko1234/heimdal/sensor/internal/database"
+	"github.com/mosiko1234/heimdal/sensor/internal/replay"
+)
+
+// writeReplayCapture writes a pcap with count UDP packets from srcMAC to dstIP:dstPort
+func writeReplayCapture(t *testing.T, path string, srcMAC string, dstIP string, dstPort uint16, count int) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create capture: %v", err)
+	}
+	defer f.Close()
+
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		t.Fatalf("Failed to write capture header: %v", err)
+	}
+
+	mac, _ := net.ParseMAC(srcMAC)
+	eth := &layers.Ethernet{
+		SrcMAC:       mac,
+		DstMAC:       net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IPv4(192, 168, 1, 20),
+		DstIP:    net.ParseIP(dstIP),
+	}
+	udp := &layers.UDP{SrcPort: 40000, DstPort: layers.UDPPort(dstPort)}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload([]byte("heimdal"))); err != nil {
+		t.Fatalf("Failed to serialize packet: %v", err)
+	}
+	data := buf.Bytes()
+
+	start := time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < count; i++ {
+		ci := gopacket.CaptureInfo{
+			Timestamp:     start.Add(time.Duration(i) * time.Millisecond),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatalf("Failed to write packet: %v", err)
+		}
+	}
+}
+
+// TestReplayToProfilerToDatabaseFlow replays a rotated capture directory through the
+// analyzer, profiler and detector and verifies profiles are built and persisted
+func TestReplayToProfilerToDatabaseFlow(t *testing.T) {
+	tmpDir := t.TempDir()
+	captureDir := filepath.Join(tmpDir, "captures")
+	if err := os.MkdirAll(captureDir, 0755); err != nil {
+		t.Fatalf("Failed to create capture directory: %v", err)
+	}
+
+	writeReplayCapture(t, filepath.Join(captureDir, "rotate-0001.pcap"), "aa:bb:cc:00:00:01", "10.1.1.1", 53, 150)
+	writeReplayCapture(t, filepath.Join(captureDir, "rotate-0002.pcap"), "aa:bb:cc:00:00:01", "10.1.1.2", 4444, 150)
+
+	dbPath := filepath.Join(tmpDir, "replay_db")
+	cfg := replay.DefaultConfig()
+	cfg.Path = captureDir
+	cfg.DatabasePath = dbPath
+
+	runner, err := replay.NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create replay runner: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := runner.Run(ctx)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	if report.Interrupted {
+		t.Error("Replay should have completed")
+	}
+	if len(report.Files) != 2 {
+		t.Errorf("Expected 2 replayed files, got %d", len(report.Files))
+	}
+	if report.PacketsReplayed != 300 {
+		t.Errorf("Expected 300 packets replayed, got %d", report.PacketsReplayed)
+	}
+	if len(report.Profiles) != 1 {
+		t.Fatalf("Expected 1 profile, got %d", len(report.Profiles))
+	}
+
+	profile := report.Profiles[0]
+	if profile.TotalPackets != 300 {
+		t.Errorf("Expected 300 packets in profile (lossless replay), got %d", profile.TotalPackets)
+	}
+	if len(profile.Destinations) != 2 {
+		t.Errorf("Expected 2 destinations, got %d", len(profile.Destinations))
+	}
+	if profile.Ports[4444] != 150 {
+		t.Errorf("Expected 150 packets on port 4444, got %d", profile.Ports[4444])
+	}
+
+	// Each file holds one one-way UDP conversation, completed at the end of the capture
+	if report.Flows != 2 || profile.Flows != 2 {
+		t.Errorf("Expected 2 flows, got %d in report and %d in profile", report.Flows, profile.Flows)
+	}
+	if profile.BytesSent == 0 || profile.BytesReceived != 0 {
+		t.Errorf("Expected upload-only volume, got sent=%d received=%d", profile.BytesSent, profile.BytesReceived)
+	}
+
+	// Capture timestamps are preserved rather than replaced by wall clock time
+	if profile.FirstSeen.Year() != 2024 {
+		t.Errorf("Expected FirstSeen from capture time, got %v", profile.FirstSeen)
+	}
+
+	// Half the traffic on a non-standard port must be flagged
+	foundUnusualPort := false
+	for _, anomaly := range report.Anomalies {
+		if anomaly.Type == "unusual_port" && anomaly.Evidence["port"] == uint16(4444) {
+			foundUnusualPort = true
+		}
+	}
+	if !foundUnusualPort {
+		t.Errorf("Expected unusual_port anomaly for port 4444, got %d anomalies", len(report.Anomalies))
+	}
+
+	// Profiles are persisted in the replay database
+	db, err := database.NewDatabaseManager(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen replay database: %v", err)
+	}
+	defer db.Close()
+
+	stored, err := db.GetProfile("aa:bb:cc:00:00:01")
+	if err != nil {
+		t.Fatalf("Replayed profile not persisted: %v", err)
+	}
+	if stored.TotalPackets != 300 {
+		t.Errorf("Expected 300 packets in persisted profile, got %d", stored.TotalPackets)
+	}
+}
@@ -24,6 +24,26 @@ document.addEventListener('DOMContentLoaded', () => {
     connectWebSocket();
 });
 
+// Fetch from the API, sending the session cookie. When the sensor requires
+// authentication and the session is missing or expired, go to the login page.
+async function apiFetch(url, options = {}) {
+    const response = await fetch(url, { credentials: 'same-origin', ...options });
+    if (response.status === 401) {
+        window.location.href = '/login.html';
+        throw new Error('Authentication required');
+    }
+    return response;
+}
+
+// End the dashboard session
+async function logout() {
+    try {
+        await fetch(`${API_BASE}/auth/logout`, { method: 'POST', credentials: 'same-origin' });
+    } finally {
+        window.location.href = '/login.html';
+    }
+}
+
 // Start auto-refresh
 function startAutoRefresh() {
     if (refreshTimer) {
@@ -67,7 +87,7 @@ async function loadDashboard() {
 // Load system statistics
 async function loadStats() {
     try {
-        const response = await fetch(`${API_BASE}/stats`);
+        const response = await apiFetch(`${API_BASE}/stats`);
         if (!response.ok) throw new Error('Failed to fetch stats');
         
         const stats = await response.json();
@@ -81,13 +101,31 @@ async function loadStats() {
     }
 }
 
+// Fetch every device, following the page cursors of the devices endpoint
+async function fetchAllDevices() {
+    const fields = 'mac,ip,name,hostname,vendor,manufacturer,device_type,last_seen,is_active,metadata';
+    const devices = [];
+    let cursor = '';
+
+    do {
+        const params = new URLSearchParams({ limit: '1000', fields: fields });
+        if (cursor) params.set('cursor', cursor);
+
+        const response = await apiFetch(`${API_BASE}/devices?${params}`);
+        if (!response.ok) throw new Error('Failed to fetch devices');
+
+        const body = await response.json();
+        devices.push(...(Array.isArray(body) ? body : body.devices || []));
+        cursor = response.headers.get('X-Next-Cursor') || body.next_cursor || '';
+    } while (cursor);
+
+    return devices;
+}
+
 // Load devices list
 async function loadDevices() {
     try {
-        const response = await fetch(`${API_BASE}/devices`);
-        if (!response.ok) throw new Error('Failed to fetch devices');
-        
-        const devices = await response.json();
+        const devices = await fetchAllDevices();
         
         // Store all devices globally
         allDevices = devices;
@@ -123,6 +161,11 @@ async function loadDevices() {
     }
 }
 
+// Name to show for a device: the user's label, else the discovered name
+function deviceLabel(device) {
+    return (device.metadata && device.metadata.label) || device.name || device.hostname || 'Unknown';
+}
+
 // Render devices table
 function renderDevices(devices) {
     const tbody = document.getElementById('devicesTableBody');
@@ -144,7 +187,7 @@ function renderDevices(devices) {
                 <td>
                     <div class="device-name">
                         ${getDeviceIcon(device.device_type)}
-                        <span>${escapeHtml(device.name || device.hostname || 'Unknown')}</span>
+                        <span>${escapeHtml(deviceLabel(device))}</span>
                     </div>
                     ${device.device_type && device.device_type !== 'unknown' ? 
                         `<div class="device-type-badge">${escapeHtml(device.device_type)}</div>` : ''}
@@ -178,7 +221,7 @@ async function viewProfile(mac) {
 // Load behavioral profile
 async function loadProfile(mac) {
     try {
-        const response = await fetch(`${API_BASE}/profiles/${encodeURIComponent(mac)}`);
+        const response = await apiFetch(`${API_BASE}/profiles/${encodeURIComponent(mac)}`);
         if (!response.ok) {
             if (response.status === 404) {
                 showProfileError('No behavioral profile available yet');
@@ -527,7 +570,12 @@ function applyFilters() {
         
         // Search filter
         if (searchText) {
+            const metadata = device.metadata || {};
             const searchableText = [
+                metadata.label,
+                metadata.owner,
+                metadata.location,
+                ...(metadata.tags || []),
                 device.name,
                 device.hostname,
                 device.ip,
@@ -635,7 +683,7 @@ function initializeTopology() {
 // Load network topology data
 async function loadTopology() {
     try {
-        const response = await fetch(`${API_BASE}/topology`);
+        const response = await apiFetch(`${API_BASE}/topology`);
         if (!response.ok) {
             console.error('Failed to fetch topology');
             return;